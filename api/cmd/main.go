@@ -9,6 +9,7 @@ import (
 	"github.com/base-org/blob-archiver/api/metrics"
 	"github.com/base-org/blob-archiver/api/service"
 	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/logging"
 	"github.com/base-org/blob-archiver/common/storage"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 	"github.com/ethereum-optimism/optimism/op-service/cliapp"
@@ -50,13 +51,22 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("config check failed: %w", err)
 		}
 
-		l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+		loggers, err := logging.NewLoggers(oplog.AppOut(cliCtx), cfg.LogConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.StorageConfig.InstanceID != "" {
+			loggers = loggers.With("instance", cfg.StorageConfig.InstanceID)
+		}
+
+		l := loggers.Root()
 		oplog.SetGlobalLogHandler(l.GetHandler())
 		opservice.ValidateEnvVars(flags.EnvVarPrefix, flags.Flags, l)
 
 		m := metrics.NewMetrics()
 
-		storageClient, err := storage.NewStorage(cfg.StorageConfig, l)
+		storageClient, err := storage.NewStorage(cfg.StorageConfig, m, loggers.Subsystem(logging.Storage))
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize storage: %w", err)
 		}
@@ -66,8 +76,13 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("failed to initialize beacon client: %w", err)
 		}
 
+		storageClient, err = service.NewVerifyingStorageFromConfig(storageClient, cfg, beaconClient, m, loggers.Subsystem(logging.Storage))
+		if err != nil {
+			return nil, err
+		}
+
 		l.Info("Initializing API Service")
-		api := service.NewAPI(storageClient, beaconClient, m, l)
+		api := service.NewAPI(storageClient, beaconClient, cfg, m, loggers.Subsystem(logging.API))
 		return service.NewService(l, api, cfg, m.Registry()), nil
 	}
 }
@@ -2,23 +2,556 @@ package flags
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	common "github.com/base-org/blob-archiver/common/flags"
-	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/base-org/blob-archiver/common/logging"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/urfave/cli/v2"
 )
 
 type APIConfig struct {
-	LogConfig     oplog.CLIConfig
+	LogConfig     logging.Config
 	MetricsConfig opmetrics.CLIConfig
 	BeaconConfig  common.BeaconConfig
 	StorageConfig common.StorageConfig
 
-	ListenAddr string
+	ListenAddr    string
+	TLS           TLSConfig
+	RequestLimits RequestLimitsConfig
+	RateLimits    RateLimitsConfig
+	ContentType   ContentTypeConfig
+
+	// PathPrefix is the path all routes are served under, empty or starting with a slash. The health endpoint is only
+	// served under it if PrefixHealth is set.
+	PathPrefix   string
+	PrefixHealth bool
+	// TrailingSlash is how requests to a route followed by a slash are handled.
+	TrailingSlash TrailingSlashAction
+
+	LazyBackfill       bool
+	AvailabilityWindow uint64
+	// AssemblePartials merges the partial blob data of blocks archived incrementally into the blob sidecars served, see
+	// storage.AssembleBlobData.
+	AssemblePartials bool
+
+	AllowOrigin string
+
+	StorageRead StorageReadConfig
+
+	// SidecarCacheSize is the number of blocks kept in the sidecar cache, 0 disables the cache.
+	SidecarCacheSize int
+	// SidecarCacheStatsInterval is the interval at which the effectiveness of the sidecar cache is logged, 0 disables
+	// the log.
+	SidecarCacheStatsInterval time.Duration
+
+	HeadMaxAge      time.Duration
+	StaleHeadAction StaleHeadAction
+
+	CacheControl CacheControlConfig
+	// FinalizedResolutionTTL is how long the block "finalized" resolved to is reused before it is resolved by the
+	// beacon node again, 0 to resolve it on every request.
+	FinalizedResolutionTTL time.Duration
+
+	Verify VerifyConfig
+
+	Peers PeersConfig
+
+	Wanted WantedConfig
+
+	// DisabledRoutes are the names of the routes that aren't registered, see Routes.
+	DisabledRoutes []string
+
+	// PreloadLink is the name of the route that blob sidecars responses link to with a Link preload header, so that
+	// clients and CDNs can prefetch the metadata of the block, see PreloadLinkRoutes. Empty disables the header.
+	PreloadLink string
+}
+
+// Names of the routes of the API that can be disabled. The blob sidecars endpoint is split into a route per kind of
+// block identifier, so that e.g. only lookups by hash are served.
+const (
+	RouteBlobSidecarsHash  = "blob_sidecars_hash"
+	RouteBlobSidecarsSlot  = "blob_sidecars_slot"
+	RouteBlobSidecarsNamed = "blob_sidecars_named"
+	RouteLatest            = "latest"
+	RouteBlobAvailability  = "blob_availability"
+	RouteHeader            = "header"
+	RouteDataColumns       = "data_column_sidecars"
+	RouteExecutionBlock    = "execution_block"
+	RouteForks             = "forks"
+)
+
+// Routes are the names of all routes that can be disabled.
+var Routes = []string{RouteBlobSidecarsHash, RouteBlobSidecarsSlot, RouteBlobSidecarsNamed, RouteLatest, RouteBlobAvailability, RouteHeader, RouteDataColumns, RouteExecutionBlock, RouteForks}
+
+// PreloadLinkRoutes are the names of the routes that blob sidecars responses can link to, see APIConfig.PreloadLink.
+var PreloadLinkRoutes = []string{RouteHeader, RouteBlobAvailability}
+
+// RouteEnabled returns whether the route with the given name is registered.
+func (c APIConfig) RouteEnabled(name string) bool {
+	return !slices.Contains(c.DisabledRoutes, name)
+}
+
+// WantedConfig configures recording blocks the API couldn't find in the wanted queue of the data store, which the
+// archiver fetches them from. A block is recorded once it was missed Threshold times, unless the queue already holds
+// Size blocks. Disabled if Size is 0.
+type WantedConfig struct {
+	Size      int
+	Threshold int
+}
+
+func (c WantedConfig) Check() error {
+	if c.Size < 0 {
+		return fmt.Errorf("wanted queue size must not be negative")
+	}
+
+	if c.Size > 0 && c.Threshold <= 0 {
+		return fmt.Errorf("wanted miss threshold must be positive")
+	}
+
+	return nil
+}
+
+// PeersConfig configures the API to query the APIs of other blob-archivers for blocks it can't serve itself, before
+// responding with a 404. Peers are tried in order, up to MaxTried of them, each for up to Timeout. If Cache is set,
+// blobs found on a peer are stored, so subsequent requests are served from storage.
+type PeersConfig struct {
+	URLs     []string
+	Timeout  time.Duration
+	MaxTried int
+	Cache    bool
+}
+
+func (c PeersConfig) Enabled() bool {
+	return len(c.URLs) > 0
+}
+
+func (c PeersConfig) Check() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	for _, peer := range c.URLs {
+		if !strings.HasPrefix(peer, "http://") && !strings.HasPrefix(peer, "https://") {
+			return fmt.Errorf("invalid peer url: \"%s\"", peer)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("peer timeout must be positive")
+	}
+
+	if c.MaxTried <= 0 {
+		return fmt.Errorf("max peers tried must be positive")
+	}
+
+	return nil
+}
+
+// VerifySourceBeacon is the VerifyConfig.Source comparing blobs with those served by the beacon node.
+const VerifySourceBeacon = "beacon"
+
+// VerifyConfig configures comparing the blobs read from storage with a second source before serving them. Source is
+// either VerifySourceBeacon or the URL of another data store, see common.ParseStorageURL; verification is disabled if it
+// is empty. One in SampleRate reads from storage is verified.
+type VerifyConfig struct {
+	Source     string
+	SampleRate uint64
+}
+
+func (c VerifyConfig) Enabled() bool {
+	return c.Source != ""
+}
+
+func (c VerifyConfig) Check(storage common.StorageConfig) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	if c.SampleRate == 0 {
+		return fmt.Errorf("verify sample rate must be positive")
+	}
+
+	if c.Source == VerifySourceBeacon {
+		return nil
+	}
+
+	cfg, err := common.ParseStorageURL(c.Source, storage)
+	if err != nil {
+		return fmt.Errorf("invalid verify source \"%s\": %w", c.Source, err)
+	}
+
+	if err := cfg.Check(); err != nil {
+		return fmt.Errorf("invalid verify source \"%s\": %w", c.Source, err)
+	}
+
+	return nil
+}
+
+// CacheControlConfig is the max-age of blob sidecars responses per type of block identifier, depending on how long the
+// block an identifier resolves to stays the same. A max-age of 0 marks responses as not cacheable.
+type CacheControlConfig struct {
+	// Hash applies to block hashes, genesis and finalized slots, which always resolve to the same block.
+	Hash time.Duration
+	// Finalized applies to "finalized", which advances every epoch.
+	Finalized time.Duration
+	// Slot applies to slots that are not finalized yet, which may still be reorged.
+	Slot time.Duration
+	// Head applies to "head", which advances every slot.
+	Head time.Duration
+}
+
+func (c CacheControlConfig) Check() error {
+	if c.Hash < 0 || c.Finalized < 0 || c.Slot < 0 || c.Head < 0 {
+		return fmt.Errorf("cache control max ages must not be negative")
+	}
+
+	return nil
+}
+
+// TrailingSlashAction is how the API handles requests to the path of a route followed by a slash, e.g.
+// /eth/v1/beacon/blob_sidecars/head/.
+type TrailingSlashAction string
+
+const (
+	// TrailingSlashReject responds with a 404, as to any other unknown path.
+	TrailingSlashReject TrailingSlashAction = "reject"
+	// TrailingSlashAccept serves the request as if the slash wasn't there. Paths ending in more than one slash are
+	// still unknown.
+	TrailingSlashAccept TrailingSlashAction = "accept"
+	// TrailingSlashRedirect responds with a permanent redirect to the path without the slash.
+	TrailingSlashRedirect TrailingSlashAction = "redirect"
+)
+
+type StaleHeadAction string
+
+const (
+	StaleHeadActionReject StaleHeadAction = "reject"
+	StaleHeadActionWarn   StaleHeadAction = "warn"
+)
+
+// TLSConfig configures the API to serve HTTPS with the certificate and key in CertFile and KeyFile. Plain HTTP is served
+// if neither is set.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// Reload reloads the certificate when its files change, e.g. when they are renewed.
+	Reload bool
+	// RedirectAddr is the address of a plain HTTP server redirecting to HTTPS, disabled if empty.
+	RedirectAddr string
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c TLSConfig) Check() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("tls certificate and key files must be set together")
+	}
+
+	if !c.Enabled() && (c.Reload || c.RedirectAddr != "") {
+		return fmt.Errorf("tls certificate reloading and https redirects require a tls certificate")
+	}
+
+	return nil
+}
+
+// RequestLimitsConfig bounds the size of requests. Requests with larger headers are refused with a 431, requests with
+// longer URLs with a 414, requests with larger bodies with a 413, and requests with more indices with a 400.
+type RequestLimitsConfig struct {
+	// MaxHeaderBytes is the maximum size of the request line and headers, 0 for net/http's default of 1MB.
+	MaxHeaderBytes int
+	// MaxURLBytes is the maximum length of the URL of requests, its path and query, 0 for no limit.
+	MaxURLBytes int
+	// MaxBodyBytes is the maximum size of request bodies, 0 for no limit.
+	MaxBodyBytes int64
+	// MaxIndices is the maximum number of values of the indices query parameter, duplicates included, 0 for no limit.
+	MaxIndices int
+}
+
+func (c RequestLimitsConfig) Check() error {
+	if c.MaxHeaderBytes < 0 {
+		return fmt.Errorf("max header bytes must not be negative")
+	}
+
+	if c.MaxURLBytes < 0 {
+		return fmt.Errorf("max url bytes must not be negative")
+	}
+
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("max body bytes must not be negative")
+	}
+
+	if c.MaxIndices < 0 {
+		return fmt.Errorf("max indices must not be negative")
+	}
+
+	return nil
+}
+
+// RateLimitKey is what the requests counted against a rate limit are grouped by.
+type RateLimitKey string
+
+const (
+	// RateLimitKeyGlobal counts the requests of all clients together.
+	RateLimitKeyGlobal RateLimitKey = "global"
+	// RateLimitKeyIP counts the requests of each client IP separately.
+	RateLimitKeyIP RateLimitKey = "ip"
+	// RateLimitKeyAPIKey counts the requests of each API key separately, as sent in RateLimitsConfig.KeyHeader. Requests
+	// without an API key are counted by client IP.
+	RateLimitKeyAPIKey RateLimitKey = "api-key"
+)
+
+// RateLimit is a token bucket limiting the requests to a group of routes to Rate per second, with bursts of up to Burst
+// requests.
+type RateLimit struct {
+	// Routes are the names of the routes the limit applies to, see Routes, or empty for all of them.
+	Routes []string
+	Rate   float64
+	Burst  int
+	Key    RateLimitKey
+}
+
+// AppliesTo returns whether the limit applies to the route with the given name.
+func (l RateLimit) AppliesTo(route string) bool {
+	return len(l.Routes) == 0 || slices.Contains(l.Routes, route)
+}
+
+// ParseRateLimit parses a rate limit of the form <routes>=<rate>:<burst>[:<key>], where routes are route names joined by
+// "+", or "*" for all routes, e.g. blob_sidecars_slot+blob_sidecars_named=10:20:ip. The key defaults to
+// RateLimitKeyGlobal.
+func ParseRateLimit(input string) (RateLimit, error) {
+	invalid := fmt.Errorf("invalid rate limit: \"%s\"", input)
+
+	routes, limit, found := strings.Cut(strings.TrimSpace(input), "=")
+	if !found {
+		return RateLimit{}, invalid
+	}
+
+	var result RateLimit
+	if routes = strings.TrimSpace(routes); routes != "*" {
+		for _, route := range strings.Split(routes, "+") {
+			route = strings.TrimSpace(route)
+			if !slices.Contains(Routes, route) {
+				return RateLimit{}, fmt.Errorf("invalid rate limit route: \"%s\", must be one of %s", route, strings.Join(Routes, ", "))
+			}
+			result.Routes = append(result.Routes, route)
+		}
+	}
+
+	fields := strings.Split(limit, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return RateLimit{}, invalid
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil || rate <= 0 {
+		return RateLimit{}, invalid
+	}
+	result.Rate = rate
+
+	burst, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+	if err != nil || burst <= 0 {
+		return RateLimit{}, invalid
+	}
+	result.Burst = burst
+
+	result.Key = RateLimitKeyGlobal
+	if len(fields) == 3 {
+		result.Key = RateLimitKey(strings.TrimSpace(fields[2]))
+		if result.Key != RateLimitKeyGlobal && result.Key != RateLimitKeyIP && result.Key != RateLimitKeyAPIKey {
+			return RateLimit{}, fmt.Errorf("invalid rate limit key: \"%s\"", result.Key)
+		}
+	}
+
+	return result, nil
+}
+
+// RateLimitsConfig configures rate limits on the requests to the API, see ParseRateLimit for the format of Rules.
+// Requests exceeding any limit that applies to their route are rejected with a 429.
+type RateLimitsConfig struct {
+	Rules []string
+	// KeyHeader is the header carrying the API key of limits keyed by RateLimitKeyAPIKey.
+	KeyHeader string
+	// MaxClients is the maximum number of clients tracked per limit keyed by client, beyond which the clients that
+	// haven't sent requests for the longest are forgotten.
+	MaxClients int
+}
+
+// Limits parses the rules of the rate limits.
+func (c RateLimitsConfig) Limits() ([]RateLimit, error) {
+	var limits []RateLimit
+	for _, rule := range c.Rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		limit, err := ParseRateLimit(rule)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+
+	return limits, nil
+}
+
+func (c RateLimitsConfig) Check() error {
+	limits, err := c.Limits()
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range limits {
+		if limit.Key == RateLimitKeyGlobal {
+			continue
+		}
+
+		if c.MaxClients <= 0 {
+			return fmt.Errorf("rate limit max clients must be positive")
+		}
+
+		if limit.Key == RateLimitKeyAPIKey && c.KeyHeader == "" {
+			return fmt.Errorf("rate limit key header must be set")
+		}
+	}
+
+	return nil
+}
+
+// ContentType is the representation of the responses to requests that don't choose one with their Accept header.
+type ContentType string
+
+const (
+	ContentTypeJSON ContentType = "json"
+	ContentTypeSSZ  ContentType = "ssz"
+)
+
+// ContentTypeOverride replaces the default content type of the requests whose path, with the path prefix removed,
+// starts with Path, or of those sending APIKey. Exactly one of Path and APIKey is set.
+type ContentTypeOverride struct {
+	Path   string
+	APIKey string
+	Type   ContentType
+}
+
+// ParseContentTypeOverride parses a content type override of the form path:<path>=<type> or key:<api key>=<type>, e.g.
+// path:/eth/v1/beacon/blob_sidecars=ssz.
+func ParseContentTypeOverride(input string) (ContentTypeOverride, error) {
+	invalid := fmt.Errorf("invalid content type override: \"%s\"", input)
+
+	match, contentType, found := strings.Cut(strings.TrimSpace(input), "=")
+	if !found {
+		return ContentTypeOverride{}, invalid
+	}
+
+	result := ContentTypeOverride{Type: ContentType(strings.TrimSpace(contentType))}
+	if result.Type != ContentTypeJSON && result.Type != ContentTypeSSZ {
+		return ContentTypeOverride{}, fmt.Errorf("invalid content type: \"%s\"", result.Type)
+	}
+
+	kind, value, found := strings.Cut(match, ":")
+	if !found || value == "" {
+		return ContentTypeOverride{}, invalid
+	}
+
+	switch kind {
+	case "path":
+		if !strings.HasPrefix(value, "/") {
+			return ContentTypeOverride{}, fmt.Errorf("content type override path must start with a slash: \"%s\"", value)
+		}
+		result.Path = value
+	case "key":
+		result.APIKey = value
+	default:
+		return ContentTypeOverride{}, invalid
+	}
+
+	return result, nil
+}
+
+// ContentTypeConfig configures the content type of the responses to requests without an Accept header, or accepting any
+// type, to Default, unless one of the Overrides, see ParseContentTypeOverride, applies. Overrides by API key, as sent in
+// KeyHeader, take precedence over those by path, and are otherwise applied in order.
+type ContentTypeConfig struct {
+	Default   ContentType
+	Overrides []string
+	KeyHeader string
+}
+
+// ParseOverrides parses the overrides of the default content type.
+func (c ContentTypeConfig) ParseOverrides() ([]ContentTypeOverride, error) {
+	var overrides []ContentTypeOverride
+	for _, input := range c.Overrides {
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		override, err := ParseContentTypeOverride(input)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+func (c ContentTypeConfig) Check() error {
+	if c.Default != ContentTypeJSON && c.Default != ContentTypeSSZ {
+		return fmt.Errorf("invalid default content type: \"%s\"", c.Default)
+	}
+
+	overrides, err := c.ParseOverrides()
+	if err != nil {
+		return err
+	}
+
+	for _, override := range overrides {
+		if override.APIKey != "" && c.KeyHeader == "" {
+			return fmt.Errorf("content type key header must be set")
+		}
+	}
+
+	return nil
+}
+
+// StorageReadConfig limits the concurrent reads from storage. A Concurrency of 0 doesn't limit reads.
+type StorageReadConfig struct {
+	Concurrency  int
+	QueueSize    int
+	QueueTimeout time.Duration
+}
+
+func (c StorageReadConfig) Check() error {
+	if c.Concurrency < 0 {
+		return fmt.Errorf("storage read concurrency must not be negative")
+	}
+
+	if c.Concurrency == 0 {
+		return nil
+	}
+
+	if c.QueueSize < 0 {
+		return fmt.Errorf("storage read queue size must not be negative")
+	}
+
+	if c.QueueTimeout <= 0 {
+		return fmt.Errorf("storage read queue timeout must be positive")
+	}
+
+	return nil
 }
 
 func (c APIConfig) Check() error {
+	if err := c.LogConfig.Check(); err != nil {
+		return fmt.Errorf("log config check failed: %w", err)
+	}
+
 	if err := c.StorageConfig.Check(); err != nil {
 		return fmt.Errorf("storage config check failed: %w", err)
 	}
@@ -31,15 +564,186 @@ func (c APIConfig) Check() error {
 		return fmt.Errorf("listen address must be set")
 	}
 
+	if err := c.TLS.Check(); err != nil {
+		return err
+	}
+
+	if err := c.RequestLimits.Check(); err != nil {
+		return err
+	}
+
+	if err := c.RateLimits.Check(); err != nil {
+		return err
+	}
+
+	if err := c.ContentType.Check(); err != nil {
+		return err
+	}
+
+	if c.PathPrefix != "" && !strings.HasPrefix(c.PathPrefix, "/") {
+		return fmt.Errorf("path prefix must start with a slash: \"%s\"", c.PathPrefix)
+	}
+
+	if c.TrailingSlash != TrailingSlashReject && c.TrailingSlash != TrailingSlashAccept && c.TrailingSlash != TrailingSlashRedirect {
+		return fmt.Errorf("invalid trailing slash action: \"%s\"", c.TrailingSlash)
+	}
+
+	if err := c.StorageRead.Check(); err != nil {
+		return err
+	}
+
+	if c.SidecarCacheSize < 0 {
+		return fmt.Errorf("sidecar cache size must not be negative")
+	}
+
+	// Cached sidecars are served as they were first read, so they must not change, and hits are not read again
+	if c.SidecarCacheSize > 0 && c.AssemblePartials {
+		return fmt.Errorf("the sidecar cache can't be enabled while assembling partial blob data, which changes as partials arrive")
+	}
+
+	if c.SidecarCacheSize > 0 && c.Verify.Enabled() {
+		return fmt.Errorf("the sidecar cache can't be enabled while verifying reads, as cache hits aren't read and verified")
+	}
+
+	if c.SidecarCacheStatsInterval < 0 {
+		return fmt.Errorf("sidecar cache stats interval must not be negative")
+	}
+
+	if c.HeadMaxAge < 0 {
+		return fmt.Errorf("head max age must not be negative")
+	}
+
+	if c.StaleHeadAction != StaleHeadActionReject && c.StaleHeadAction != StaleHeadActionWarn {
+		return fmt.Errorf("invalid stale head action: \"%s\"", c.StaleHeadAction)
+	}
+
+	if err := c.CacheControl.Check(); err != nil {
+		return err
+	}
+
+	if c.FinalizedResolutionTTL < 0 {
+		return fmt.Errorf("finalized resolution ttl must not be negative")
+	}
+
+	if err := c.Verify.Check(c.StorageConfig); err != nil {
+		return err
+	}
+
+	if err := c.Peers.Check(); err != nil {
+		return err
+	}
+
+	if err := c.Wanted.Check(); err != nil {
+		return err
+	}
+
+	for _, route := range c.DisabledRoutes {
+		if !slices.Contains(Routes, route) {
+			return fmt.Errorf("invalid disabled route: \"%s\", must be one of %s", route, strings.Join(Routes, ", "))
+		}
+	}
+
+	if c.PreloadLink != "" {
+		if !slices.Contains(PreloadLinkRoutes, c.PreloadLink) {
+			return fmt.Errorf("invalid preload link: \"%s\", must be one of %s", c.PreloadLink, strings.Join(PreloadLinkRoutes, ", "))
+		}
+
+		if !c.RouteEnabled(c.PreloadLink) {
+			return fmt.Errorf("preload link route %s is disabled", c.PreloadLink)
+		}
+	}
+
 	return nil
 }
 
 func ReadConfig(cliCtx *cli.Context) APIConfig {
+	queueTimeout, _ := time.ParseDuration(cliCtx.String(StorageReadQueueTimeoutFlag.Name))
+	headMaxAge, _ := time.ParseDuration(cliCtx.String(HeadMaxAgeFlag.Name))
+	hashMaxAge, _ := time.ParseDuration(cliCtx.String(CacheMaxAgeHashFlag.Name))
+	finalizedMaxAge, _ := time.ParseDuration(cliCtx.String(CacheMaxAgeFinalizedFlag.Name))
+	slotMaxAge, _ := time.ParseDuration(cliCtx.String(CacheMaxAgeSlotFlag.Name))
+	headCacheMaxAge, _ := time.ParseDuration(cliCtx.String(CacheMaxAgeHeadFlag.Name))
+	peerTimeout, _ := time.ParseDuration(cliCtx.String(PeerTimeoutFlag.Name))
+	cacheStatsInterval, _ := time.ParseDuration(cliCtx.String(SidecarCacheStatsIntervalFlag.Name))
+	finalizedTTL, _ := time.ParseDuration(cliCtx.String(FinalizedResolutionTTLFlag.Name))
 	return APIConfig{
-		LogConfig:     oplog.ReadCLIConfig(cliCtx),
+		LogConfig:     logging.ReadConfig(cliCtx),
 		MetricsConfig: opmetrics.ReadCLIConfig(cliCtx),
 		BeaconConfig:  common.NewBeaconConfig(cliCtx),
 		StorageConfig: common.NewStorageConfig(cliCtx),
 		ListenAddr:    cliCtx.String(ListenAddressFlag.Name),
+		TLS: TLSConfig{
+			CertFile:     cliCtx.String(TLSCertFileFlag.Name),
+			KeyFile:      cliCtx.String(TLSKeyFileFlag.Name),
+			Reload:       cliCtx.Bool(TLSReloadFlag.Name),
+			RedirectAddr: cliCtx.String(TLSRedirectAddressFlag.Name),
+		},
+		RequestLimits: RequestLimitsConfig{
+			MaxHeaderBytes: cliCtx.Int(MaxHeaderBytesFlag.Name),
+			MaxURLBytes:    cliCtx.Int(MaxURLBytesFlag.Name),
+			MaxBodyBytes:   cliCtx.Int64(MaxBodyBytesFlag.Name),
+			MaxIndices:     cliCtx.Int(MaxIndicesFlag.Name),
+		},
+		RateLimits: RateLimitsConfig{
+			Rules:      cliCtx.StringSlice(RateLimitsFlag.Name),
+			KeyHeader:  cliCtx.String(RateLimitKeyHeaderFlag.Name),
+			MaxClients: cliCtx.Int(RateLimitMaxClientsFlag.Name),
+		},
+		ContentType: ContentTypeConfig{
+			Default:   ContentType(cliCtx.String(DefaultContentTypeFlag.Name)),
+			Overrides: cliCtx.StringSlice(ContentTypeOverridesFlag.Name),
+			KeyHeader: cliCtx.String(ContentTypeKeyHeaderFlag.Name),
+		},
+
+		PathPrefix:   strings.TrimSuffix(cliCtx.String(PathPrefixFlag.Name), "/"),
+		PrefixHealth: cliCtx.Bool(PrefixHealthFlag.Name),
+
+		TrailingSlash: TrailingSlashAction(cliCtx.String(TrailingSlashFlag.Name)),
+
+		LazyBackfill:       cliCtx.Bool(LazyBackfillFlag.Name),
+		AvailabilityWindow: cliCtx.Uint64(AvailabilityWindowFlag.Name),
+		AssemblePartials:   cliCtx.Bool(AssemblePartialsFlag.Name),
+
+		AllowOrigin: cliCtx.String(AllowOriginFlag.Name),
+
+		StorageRead: StorageReadConfig{
+			Concurrency:  cliCtx.Int(StorageReadConcurrencyFlag.Name),
+			QueueSize:    cliCtx.Int(StorageReadQueueSizeFlag.Name),
+			QueueTimeout: queueTimeout,
+		},
+
+		SidecarCacheSize:          cliCtx.Int(SidecarCacheSizeFlag.Name),
+		SidecarCacheStatsInterval: cacheStatsInterval,
+
+		HeadMaxAge:      headMaxAge,
+		StaleHeadAction: StaleHeadAction(cliCtx.String(StaleHeadActionFlag.Name)),
+
+		CacheControl: CacheControlConfig{
+			Hash:      hashMaxAge,
+			Finalized: finalizedMaxAge,
+			Slot:      slotMaxAge,
+			Head:      headCacheMaxAge,
+		},
+		FinalizedResolutionTTL: finalizedTTL,
+
+		Verify: VerifyConfig{
+			Source:     cliCtx.String(VerifySourceFlag.Name),
+			SampleRate: cliCtx.Uint64(VerifySampleRateFlag.Name),
+		},
+
+		Peers: PeersConfig{
+			URLs:     cliCtx.StringSlice(PeerURLsFlag.Name),
+			Timeout:  peerTimeout,
+			MaxTried: cliCtx.Int(PeerMaxTriedFlag.Name),
+			Cache:    cliCtx.Bool(PeerCacheFlag.Name),
+		},
+
+		Wanted: WantedConfig{
+			Size:      cliCtx.Int(WantedQueueSizeFlag.Name),
+			Threshold: cliCtx.Int(WantedMissThresholdFlag.Name),
+		},
+
+		DisabledRoutes: cliCtx.StringSlice(DisabledRoutesFlag.Name),
+		PreloadLink:    cliCtx.String(PreloadLinkFlag.Name),
 	}
 }
@@ -2,6 +2,7 @@ package flags
 
 import (
 	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/logging"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
@@ -17,13 +18,273 @@ var (
 		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "LISTEN_ADDRESS"),
 		Value:   "0.0.0.0:8000",
 	}
+	TLSCertFileFlag = &cli.StringFlag{
+		Name:    "api-tls-cert-file",
+		Usage:   "The PEM encoded certificate (chain) to serve HTTPS with. Plain HTTP is served if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TLS_CERT_FILE"),
+	}
+	TLSKeyFileFlag = &cli.StringFlag{
+		Name:    "api-tls-key-file",
+		Usage:   "The PEM encoded private key of the TLS certificate",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TLS_KEY_FILE"),
+	}
+	TLSReloadFlag = &cli.BoolFlag{
+		Name:    "api-tls-reload",
+		Usage:   "Whether to reload the TLS certificate and key when their files change, e.g. when they are renewed",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TLS_RELOAD"),
+	}
+	TLSRedirectAddressFlag = &cli.StringFlag{
+		Name:    "api-tls-redirect-address",
+		Usage:   "The address to serve plain HTTP on, redirecting every request to HTTPS, e.g. 0.0.0.0:80. Disabled if empty",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TLS_REDIRECT_ADDRESS"),
+	}
+	MaxHeaderBytesFlag = &cli.IntFlag{
+		Name:    "api-max-header-bytes",
+		Usage:   "The maximum size of the request line and headers of requests, larger requests are refused with a 431",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "MAX_HEADER_BYTES"),
+		Value:   16 << 10,
+	}
+	MaxURLBytesFlag = &cli.IntFlag{
+		Name:    "api-max-url-bytes",
+		Usage:   "The maximum length of the URL of requests, its path and query, longer requests are refused with a 414. 0 disables the limit",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "MAX_URL_BYTES"),
+		Value:   8 << 10,
+	}
+	MaxBodyBytesFlag = &cli.Int64Flag{
+		Name:    "api-max-body-bytes",
+		Usage:   "The maximum size of request bodies, larger requests are refused with a 413. 0 disables the limit",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "MAX_BODY_BYTES"),
+		Value:   1 << 20,
+	}
+	MaxIndicesFlag = &cli.IntFlag{
+		Name:    "api-max-indices",
+		Usage:   "The maximum number of values of the indices query parameter, duplicates included, more are refused with a 400. 0 disables the limit",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "MAX_INDICES"),
+		Value:   128,
+	}
+	RateLimitsFlag = &cli.StringSliceFlag{
+		Name: "api-rate-limits",
+		Usage: "Token bucket rate limits of the form <routes>=<requests per second>:<burst>[:<key>], where routes are route " +
+			"names joined by + or * for all routes, and key is global (default), ip or api-key, e.g. " +
+			"blob_sidecars_slot+blob_sidecars_named=10:20:ip. Requests exceeding a limit are rejected with a 429",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMITS"),
+	}
+	RateLimitKeyHeaderFlag = &cli.StringFlag{
+		Name:    "api-rate-limit-key-header",
+		Usage:   "The header carrying the API key of rate limits keyed by api-key. Requests without it are limited by client IP",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT_KEY_HEADER"),
+		Value:   "X-Api-Key",
+	}
+	RateLimitMaxClientsFlag = &cli.IntFlag{
+		Name:    "api-rate-limit-max-clients",
+		Usage:   "The maximum number of clients tracked per rate limit keyed by ip or api-key, beyond which the least recently seen are forgotten",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "RATE_LIMIT_MAX_CLIENTS"),
+		Value:   10000,
+	}
+	DefaultContentTypeFlag = &cli.StringFlag{
+		Name:    "api-default-content-type",
+		Usage:   "The content type of responses to requests without an Accept header, or accepting any type: json or ssz",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DEFAULT_CONTENT_TYPE"),
+		Value:   string(ContentTypeJSON),
+	}
+	ContentTypeOverridesFlag = &cli.StringSliceFlag{
+		Name: "api-content-type-overrides",
+		Usage: "Overrides of the default content type of the form path:<path prefix>=<type> or key:<api key>=<type>, e.g. " +
+			"path:/eth/v1/beacon/blob_sidecars=ssz. Overrides by API key take precedence over those by path",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CONTENT_TYPE_OVERRIDES"),
+	}
+	ContentTypeKeyHeaderFlag = &cli.StringFlag{
+		Name:    "api-content-type-key-header",
+		Usage:   "The header carrying the API key of content type overrides by API key",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CONTENT_TYPE_KEY_HEADER"),
+		Value:   "X-Api-Key",
+	}
+	PathPrefixFlag = &cli.StringFlag{
+		Name:    "api-path-prefix",
+		Usage:   "The path prefix all routes are served under, e.g. /blobs when the API is mounted at a subpath behind a reverse proxy",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PATH_PREFIX"),
+	}
+	PrefixHealthFlag = &cli.BoolFlag{
+		Name:    "api-prefix-health",
+		Usage:   "Whether the /healthz endpoint is served under the path prefix, rather than at the root",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PREFIX_HEALTH"),
+	}
+	TrailingSlashFlag = &cli.StringFlag{
+		Name:    "api-trailing-slash",
+		Usage:   "How requests to a route followed by a slash are handled, options are [accept, redirect, reject]. accept serves them as if the slash wasn't there, redirect responds with a 301 to the path without it, reject with a 404",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "TRAILING_SLASH"),
+		Value:   string(TrailingSlashAccept),
+	}
+	LazyBackfillFlag = &cli.BoolFlag{
+		Name:    "api-lazy-backfill",
+		Usage:   "Whether to fetch blobs that are missing from storage from the beacon node, and store them",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "LAZY_BACKFILL"),
+	}
+	AssemblePartialsFlag = &cli.BoolFlag{
+		Name:    "api-assemble-partials",
+		Usage:   "Whether to merge the partial blob data of blocks whose sidecars were archived incrementally into the blob sidecars served, at the cost of listing it on every read",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "ASSEMBLE_PARTIALS"),
+	}
+	AvailabilityWindowFlag = &cli.Uint64Flag{
+		Name:    "api-availability-window",
+		Usage:   "The number of slots behind the current slot the beacon node is expected to serve blobs for. Lazy backfill is not attempted for older blocks, which are answered with a 404. 0 disables the check",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "AVAILABILITY_WINDOW"),
+		Value:   131072,
+	}
+	AllowOriginFlag = &cli.StringFlag{
+		Name:    "api-allow-origin",
+		Usage:   "The origin to allow in the CORS headers of responses to OPTIONS and unsupported methods. Empty omits the CORS headers",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "ALLOW_ORIGIN"),
+	}
+	StorageReadConcurrencyFlag = &cli.IntFlag{
+		Name:    "api-storage-read-concurrency",
+		Usage:   "The maximum number of concurrent reads from storage, further reads are queued. 0 disables the limit",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STORAGE_READ_CONCURRENCY"),
+	}
+	StorageReadQueueSizeFlag = &cli.IntFlag{
+		Name:    "api-storage-read-queue-size",
+		Usage:   "The maximum number of reads waiting for the concurrency limit, further requests are rejected with a 503",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STORAGE_READ_QUEUE_SIZE"),
+		Value:   100,
+	}
+	StorageReadQueueTimeoutFlag = &cli.StringFlag{
+		Name:    "api-storage-read-queue-timeout",
+		Usage:   "How long a read waits for the concurrency limit before the request is rejected with a 503",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STORAGE_READ_QUEUE_TIMEOUT"),
+		Value:   "1s",
+	}
+	SidecarCacheSizeFlag = &cli.IntFlag{
+		Name:    "api-sidecar-cache-size",
+		Usage:   "The number of recently requested blocks whose blob sidecars are kept in memory, pre-serialized per index. 0 disables the cache",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "SIDECAR_CACHE_SIZE"),
+	}
+	SidecarCacheStatsIntervalFlag = &cli.StringFlag{
+		Name:    "api-sidecar-cache-stats-interval",
+		Usage:   "The interval at which the hit ratio and evictions of the sidecar cache are logged, e.g. 5m. Empty disables the log",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "SIDECAR_CACHE_STATS_INTERVAL"),
+		Value:   "5m",
+	}
+	HeadMaxAgeFlag = &cli.StringFlag{
+		Name:    "api-head-max-age",
+		Usage:   "The maximum age of the head resolved by the beacon node, e.g. 2m. An older head indicates the beacon node may be stalled. Empty disables the check",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "HEAD_MAX_AGE"),
+	}
+	StaleHeadActionFlag = &cli.StringFlag{
+		Name:    "api-stale-head-action",
+		Usage:   "What to do with requests for a head older than the maximum age, options are [reject, warn]. reject responds with a 503, warn only logs and serves the head",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "STALE_HEAD_ACTION"),
+		Value:   string(StaleHeadActionReject),
+	}
+	CacheMaxAgeHashFlag = &cli.StringFlag{
+		Name:    "api-cache-max-age-hash",
+		Usage:   "The Cache-Control max-age of blob sidecars requested by block hash, genesis or finalized slot. 0 disables caching",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_MAX_AGE_HASH"),
+		Value:   "24h",
+	}
+	CacheMaxAgeFinalizedFlag = &cli.StringFlag{
+		Name:    "api-cache-max-age-finalized",
+		Usage:   "The Cache-Control max-age of blob sidecars requested as finalized, which advances every epoch. 0 disables caching",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_MAX_AGE_FINALIZED"),
+		Value:   "1m",
+	}
+	FinalizedResolutionTTLFlag = &cli.StringFlag{
+		Name:    "api-finalized-resolution-ttl",
+		Usage:   "How long the block finalized resolved to is reused before the beacon node is asked again. 0 resolves it on every request",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "FINALIZED_RESOLUTION_TTL"),
+		Value:   "36s",
+	}
+	CacheMaxAgeSlotFlag = &cli.StringFlag{
+		Name:    "api-cache-max-age-slot",
+		Usage:   "The Cache-Control max-age of blob sidecars requested by a slot that is not finalized yet. 0 disables caching",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_MAX_AGE_SLOT"),
+		Value:   "0s",
+	}
+	CacheMaxAgeHeadFlag = &cli.StringFlag{
+		Name:    "api-cache-max-age-head",
+		Usage:   "The Cache-Control max-age of blob sidecars requested as head, which advances every slot. 0 disables caching",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CACHE_MAX_AGE_HEAD"),
+		Value:   "0s",
+	}
+	VerifySourceFlag = &cli.StringFlag{
+		Name: "api-verify-source",
+		Usage: "The source blobs read from storage are compared with before they are served: \"beacon\" for the beacon " +
+			"node, or another data-store as a URL, s3://<bucket> (using the s3 settings of the data-store) or " +
+			"file://<directory>. Blobs that differ are not served. Empty disables verification",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "VERIFY_SOURCE"),
+	}
+	VerifySampleRateFlag = &cli.Uint64Flag{
+		Name:    "api-verify-sample-rate",
+		Usage:   "Verify one in this many reads from storage, 1 verifies every read",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "VERIFY_SAMPLE_RATE"),
+		Value:   1,
+	}
+	PeerURLsFlag = &cli.StringSliceFlag{
+		Name:    "api-peer-urls",
+		Usage:   "The URLs of other blob-archiver APIs queried, in order, for blocks that can't be served from storage or the beacon node, before responding with a 404",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PEER_URLS"),
+	}
+	PeerTimeoutFlag = &cli.StringFlag{
+		Name:    "api-peer-timeout",
+		Usage:   "How long a request to a peer may take before the next peer is tried",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PEER_TIMEOUT"),
+		Value:   "2s",
+	}
+	PeerMaxTriedFlag = &cli.IntFlag{
+		Name:    "api-peer-max-tried",
+		Usage:   "The maximum number of peers queried for a block",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PEER_MAX_TRIED"),
+		Value:   3,
+	}
+	PeerCacheFlag = &cli.BoolFlag{
+		Name:    "api-peer-cache",
+		Usage:   "Whether to store the blobs found on a peer, so that subsequent requests are served from storage",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PEER_CACHE"),
+	}
+	WantedQueueSizeFlag = &cli.IntFlag{
+		Name:    "api-wanted-queue-size",
+		Usage:   "The maximum number of blocks in the wanted queue of the data store, which blocks requested but not found are recorded in for the archiver to fetch. 0 disables recording them",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WANTED_QUEUE_SIZE"),
+	}
+	WantedMissThresholdFlag = &cli.IntFlag{
+		Name:    "api-wanted-miss-threshold",
+		Usage:   "The number of requests for a block that isn't found after which it is recorded in the wanted queue",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "WANTED_MISS_THRESHOLD"),
+		Value:   3,
+	}
+	DisabledRoutesFlag = &cli.StringSliceFlag{
+		Name: "api-disabled-routes",
+		Usage: "The routes that are not served and respond with a 404: blob_sidecars_hash, blob_sidecars_slot and " +
+			"blob_sidecars_named for blob sidecars requested by hash, slot or named identifier, latest, blob_availability, header, data_column_sidecars, execution_block and forks",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "DISABLED_ROUTES"),
+	}
+	PreloadLinkFlag = &cli.StringFlag{
+		Name: "api-preload-link",
+		Usage: "The route that blob sidecars responses link to with a Link preload header, for clients and CDNs to prefetch the metadata of the block, " +
+			"options are [header, blob_availability]. Empty disables the header",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PRELOAD_LINK"),
+	}
 )
 
 func init() {
 	Flags = append(Flags, common.CLIFlags(EnvVarPrefix)...)
 	Flags = append(Flags, opmetrics.CLIFlags(EnvVarPrefix)...)
 	Flags = append(Flags, oplog.CLIFlags(EnvVarPrefix)...)
-	Flags = append(Flags, ListenAddressFlag)
+	Flags = append(Flags, logging.CLIFlags(EnvVarPrefix)...)
+	Flags = append(Flags, ListenAddressFlag, PathPrefixFlag, PrefixHealthFlag, TrailingSlashFlag, LazyBackfillFlag, AvailabilityWindowFlag, AllowOriginFlag)
+	Flags = append(Flags, AssemblePartialsFlag)
+	Flags = append(Flags, StorageReadConcurrencyFlag, StorageReadQueueSizeFlag, StorageReadQueueTimeoutFlag)
+	Flags = append(Flags, SidecarCacheSizeFlag, SidecarCacheStatsIntervalFlag)
+	Flags = append(Flags, TLSCertFileFlag, TLSKeyFileFlag, TLSReloadFlag, TLSRedirectAddressFlag)
+	Flags = append(Flags, MaxHeaderBytesFlag, MaxURLBytesFlag, MaxBodyBytesFlag, MaxIndicesFlag)
+	Flags = append(Flags, RateLimitsFlag, RateLimitKeyHeaderFlag, RateLimitMaxClientsFlag)
+	Flags = append(Flags, DefaultContentTypeFlag, ContentTypeOverridesFlag, ContentTypeKeyHeaderFlag)
+	Flags = append(Flags, HeadMaxAgeFlag, StaleHeadActionFlag)
+	Flags = append(Flags, CacheMaxAgeHashFlag, CacheMaxAgeFinalizedFlag, CacheMaxAgeSlotFlag, CacheMaxAgeHeadFlag)
+	Flags = append(Flags, FinalizedResolutionTTLFlag)
+	Flags = append(Flags, VerifySourceFlag, VerifySampleRateFlag)
+	Flags = append(Flags, PeerURLsFlag, PeerTimeoutFlag, PeerMaxTriedFlag, PeerCacheFlag)
+	Flags = append(Flags, WantedQueueSizeFlag, WantedMissThresholdFlag)
+	Flags = append(Flags, DisabledRoutesFlag, PreloadLinkFlag)
 }
 
 // Flags contains the list of configuration options available to the binary.
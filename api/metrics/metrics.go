@@ -1,6 +1,11 @@
 package metrics
 
 import (
+	"context"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/tracing"
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/prometheus/client_golang/prometheus"
@@ -8,36 +13,158 @@ import (
 
 type BlockIdType string
 
+// RequestPhase is a part of serving a blob sidecars request that is timed separately.
+type RequestPhase string
+
 var (
 	MetricsNamespace = "blob_api"
 
 	BlockIdTypeHash    BlockIdType = "hash"
 	BlockIdTypeBeacon  BlockIdType = "beacon"
 	BlockIdTypeInvalid BlockIdType = "invalid"
+
+	// RequestPhaseResolve is the resolution of the requested block id to a block root, by the beacon node unless it is
+	// a hash.
+	RequestPhaseResolve RequestPhase = "resolve"
+	// RequestPhaseRead is the lookup of the sidecars in the sidecar cache, storage, the beacon node or peers.
+	RequestPhaseRead RequestPhase = "read"
+	// RequestPhaseSerialize is the encoding of the sidecars in the requested format and writing the response.
+	RequestPhaseSerialize RequestPhase = "serialize"
 )
 
 type Metricer interface {
+	storage.Metricer
 	Registry() *prometheus.Registry
 	RecordBlockIdType(t BlockIdType)
+	// RecordRequestPhaseDuration records the duration of a phase of a request, with an exemplar linking to the trace of
+	// the request's context if it is traced, see tracing.Observe.
+	RecordRequestPhaseDuration(ctx context.Context, phase RequestPhase, duration time.Duration)
+	SetStorageReadsInFlight(count int)
+	SetStorageReadsQueued(count int)
+	RecordStorageReadShed()
+	// RecordRateLimited records a request rejected by a rate limit on the route with the given name, keyed by key.
+	RecordRateLimited(route string, key string)
+	RecordSidecarCacheRequest(hit bool)
+	RecordSidecarCacheEviction()
+	SetSidecarCacheHitRatio(ratio float64)
+	RecordSidecarResponse(cached bool)
+	RecordVerification(result string)
+	RecordPeerLookup(result string)
+	RecordCorruptRead(reason string)
+	// SetForkStartSlot records the first slot of a fork of the fork schedule of the chain, by its name and version.
+	SetForkStartSlot(fork string, version string, slot uint64)
 }
 
 type metricsRecorder struct {
+	storage.Metricer
 	// blockIdType records the type of block id used to request a block. This could be a hash (BlockIdTypeHash), or a
 	// beacon block identifier (BlockIdTypeBeacon).
 	blockIdType *prometheus.CounterVec
-	registry    *prometheus.Registry
+	// requestPhases records the time taken by each phase of successful blob sidecars requests.
+	requestPhases *prometheus.HistogramVec
+	// storageReadsInFlight and storageReadsQueued are the storage reads currently running and waiting for a slot, and
+	// storageReadsShed counts the reads that were rejected because too many were waiting.
+	storageReadsInFlight prometheus.Gauge
+	storageReadsQueued   prometheus.Gauge
+	storageReadsShed     prometheus.Counter
+	// rateLimited counts the requests rejected by rate limits, by route and by what the limit is keyed by.
+	rateLimited *prometheus.CounterVec
+	// sidecarCacheRequests counts the lookups in the sidecar cache, by whether the block was cached.
+	sidecarCacheRequests *prometheus.CounterVec
+	// sidecarCacheEvictions counts the blocks evicted from the sidecar cache to make room for another, and
+	// sidecarCacheHitRatio is the hit ratio of its most recent lookups.
+	sidecarCacheEvictions prometheus.Counter
+	sidecarCacheHitRatio  prometheus.Gauge
+	// sidecarResponses counts the blob sidecars responses, by whether they were served from the sidecar cache alone.
+	sidecarResponses *prometheus.CounterVec
+	// verifications counts the reads compared with a second source, by result.
+	verifications *prometheus.CounterVec
+	// peerLookups counts the blocks looked up on peers, by result.
+	peerLookups *prometheus.CounterVec
+	// corruptReads counts the blocks read from storage whose blob data failed validation, by reason.
+	corruptReads *prometheus.CounterVec
+	// forkStartSlots is the first slot of each fork of the fork schedule fetched from the beacon node.
+	forkStartSlots *prometheus.GaugeVec
+	registry       *prometheus.Registry
 }
 
 func NewMetrics() Metricer {
 	registry := opmetrics.NewRegistry()
 	factory := metrics.With(registry)
 	return &metricsRecorder{
+		Metricer: storage.NewMetrics(factory, MetricsNamespace),
 		registry: registry,
 		blockIdType: factory.NewCounterVec(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "block_id_type",
 			Help:      "The type of block id used to request a block",
 		}, []string{"type"}),
+		requestPhases: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "request_phase_duration_seconds",
+			Help:      "The time taken by each phase of serving blob sidecars: resolving the block id, reading the sidecars and serializing the response",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"phase"}),
+		storageReadsInFlight: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_reads_in_flight",
+			Help:      "The number of storage reads in flight",
+		}),
+		storageReadsQueued: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_reads_queued",
+			Help:      "The number of storage reads waiting for the concurrency limit",
+		}),
+		storageReadsShed: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "storage_reads_shed",
+			Help:      "The number of storage reads rejected because the concurrency limit was reached",
+		}),
+		rateLimited: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "rate_limited_requests",
+			Help:      "The number of requests rejected by rate limits, by route and by what the limit is keyed by",
+		}, []string{"route", "key"}),
+		sidecarCacheRequests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "sidecar_cache_requests",
+			Help:      "The number of lookups in the sidecar cache, by result",
+		}, []string{"result"}),
+		sidecarCacheEvictions: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "sidecar_cache_evictions",
+			Help:      "The number of blocks evicted from the sidecar cache",
+		}),
+		sidecarCacheHitRatio: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "sidecar_cache_hit_ratio",
+			Help:      "The hit ratio of the most recent lookups in the sidecar cache",
+		}),
+		sidecarResponses: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "sidecar_responses",
+			Help:      "The number of blob sidecars responses, by whether they were served from the sidecar cache without calling storage or the beacon node",
+		}, []string{"source"}),
+		verifications: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "verifications",
+			Help:      "The number of reads from storage compared with a second source, by result",
+		}, []string{"result"}),
+		peerLookups: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "peer_lookups",
+			Help:      "The number of blocks missing locally that were looked up on peers, by result",
+		}, []string{"result"}),
+		corruptReads: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "corrupt_reads",
+			Help:      "The number of blocks read from storage whose blob data failed validation and was not served, by reason",
+		}, []string{"reason"}),
+		forkStartSlots: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "fork_start_slot",
+			Help:      "The first slot of each fork of the fork schedule of the chain, by fork name and version",
+		}, []string{"fork", "version"}),
 	}
 }
 
@@ -45,6 +172,68 @@ func (m *metricsRecorder) RecordBlockIdType(t BlockIdType) {
 	m.blockIdType.WithLabelValues(string(t)).Inc()
 }
 
+func (m *metricsRecorder) RecordRequestPhaseDuration(ctx context.Context, phase RequestPhase, duration time.Duration) {
+	tracing.Observe(ctx, m.requestPhases.WithLabelValues(string(phase)), duration.Seconds())
+}
+
+func (m *metricsRecorder) SetStorageReadsInFlight(count int) {
+	m.storageReadsInFlight.Set(float64(count))
+}
+
+func (m *metricsRecorder) SetStorageReadsQueued(count int) {
+	m.storageReadsQueued.Set(float64(count))
+}
+
+func (m *metricsRecorder) RecordStorageReadShed() {
+	m.storageReadsShed.Inc()
+}
+
+func (m *metricsRecorder) RecordRateLimited(route string, key string) {
+	m.rateLimited.WithLabelValues(route, key).Inc()
+}
+
 func (m *metricsRecorder) Registry() *prometheus.Registry {
 	return m.registry
 }
+
+func (m *metricsRecorder) RecordSidecarCacheRequest(hit bool) {
+	result := "hit"
+	if !hit {
+		result = "miss"
+	}
+
+	m.sidecarCacheRequests.WithLabelValues(result).Inc()
+}
+
+func (m *metricsRecorder) RecordSidecarCacheEviction() {
+	m.sidecarCacheEvictions.Inc()
+}
+
+func (m *metricsRecorder) SetSidecarCacheHitRatio(ratio float64) {
+	m.sidecarCacheHitRatio.Set(ratio)
+}
+
+func (m *metricsRecorder) RecordSidecarResponse(cached bool) {
+	source := "cache"
+	if !cached {
+		source = "backend"
+	}
+
+	m.sidecarResponses.WithLabelValues(source).Inc()
+}
+
+func (m *metricsRecorder) RecordVerification(result string) {
+	m.verifications.WithLabelValues(result).Inc()
+}
+
+func (m *metricsRecorder) RecordPeerLookup(result string) {
+	m.peerLookups.WithLabelValues(result).Inc()
+}
+
+func (m *metricsRecorder) RecordCorruptRead(reason string) {
+	m.corruptReads.WithLabelValues(reason).Inc()
+}
+
+func (m *metricsRecorder) SetForkStartSlot(fork string, version string, slot uint64) {
+	m.forkStartSlots.WithLabelValues(fork, version).Set(float64(slot))
+}
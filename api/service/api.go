@@ -1,27 +1,36 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	client "github.com/attestantio/go-eth2-client"
 	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/flags"
 	m "github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
 	"github.com/base-org/blob-archiver/common/storage"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/klauspost/compress/zstd"
 )
 
 type httpError struct {
@@ -30,6 +39,11 @@ type httpError struct {
 }
 
 func (e httpError) write(w http.ResponseWriter) {
+	// Errors may be transient, e.g. a block that is not archived yet, so they must not be cached
+	w.Header().Set("Cache-Control", "no-cache")
+	if e.Code == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
 	w.WriteHeader(e.Code)
 	_ = json.NewEncoder(w).Encode(e)
 }
@@ -41,7 +55,10 @@ func (e httpError) Error() string {
 const (
 	jsonAcceptType = "application/json"
 	sszAcceptType  = "application/octet-stream"
+	cborAcceptType = "application/cbor"
 	serverTimeout  = 60 * time.Second
+	// slotClockMaximumRetries is the number of attempts at fetching the slot clock at startup.
+	slotClockMaximumRetries = 5
 )
 
 var (
@@ -49,10 +66,46 @@ var (
 		Code:    http.StatusNotFound,
 		Message: "Block not found",
 	}
+	errNoDataColumns = &httpError{
+		Code:    http.StatusNotFound,
+		Message: "No data column sidecars stored for block",
+	}
 	errServerError = &httpError{
 		Code:    http.StatusInternalServerError,
 		Message: "Internal server error",
 	}
+	errMethodNotAllowed = &httpError{
+		Code:    http.StatusMethodNotAllowed,
+		Message: "Method not allowed",
+	}
+	errOutsideAvailabilityWindow = &httpError{
+		Code:    http.StatusNotFound,
+		Message: "Block not found: outside availability window",
+	}
+	errStaleHead = &httpError{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Head is stale: the upstream beacon node may be stalled",
+	}
+	errServiceUnavailable = &httpError{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Service unavailable: too many requests",
+	}
+	errFailedVerification = &httpError{
+		Code:    http.StatusInternalServerError,
+		Message: "Blob sidecars failed verification",
+	}
+	errCorruptData = &httpError{
+		Code:    http.StatusInternalServerError,
+		Message: "Stored blob sidecars are corrupt",
+	}
+	errRequestBodyTooLarge = &httpError{
+		Code:    http.StatusRequestEntityTooLarge,
+		Message: "Request body too large",
+	}
+	errRequestURLTooLong = &httpError{
+		Code:    http.StatusRequestURITooLong,
+		Message: "Request URL too long",
+	}
 )
 
 func newBlockIdError(input string) *httpError {
@@ -69,47 +122,309 @@ func newIndicesError(input string) *httpError {
 	}
 }
 
-func newOutOfRangeError(input uint64, blobCount int) *httpError {
+func newExecutionBlockNumberError(input string) *httpError {
+	return &httpError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid execution block number: %s", input),
+	}
+}
+
+func newTooManyIndicesError(count int, maxIndices int) *httpError {
+	return &httpError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("too many indices: %d given, at most %d accepted", count, maxIndices),
+	}
+}
+
+func newOutOfRangeError(input uint64, blobCount uint64) *httpError {
 	return &httpError{
 		Code:    http.StatusBadRequest,
 		Message: fmt.Sprintf("invalid index: %d block contains %d blobs", input, blobCount),
 	}
 }
 
+// storageHTTPError maps an error reading blob data from storage, see API.readBlobs, to the error response for it.
+// Unexpected errors are internal server errors, which callers should log.
+func storageHTTPError(err error) *httpError {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return errUnknownBlock
+	case errors.Is(err, errReadsOverloaded):
+		return errServiceUnavailable
+	case errors.Is(err, errVerificationFailed):
+		return errFailedVerification
+	case errors.Is(err, errCorruptBlobData):
+		return errCorruptData
+	default:
+		return errServerError
+	}
+}
+
 type API struct {
 	dataStoreClient storage.DataStoreReader
-	beaconClient    client.BeaconBlockHeadersProvider
+	beaconClient    beacon.Client
+	cfg             flags.APIConfig
 	router          *chi.Mux
 	logger          log.Logger
 	metrics         m.Metricer
+	readLimiter     *readLimiter
+	rateLimiter     *rateLimiter
+	contentTypes    *contentNegotiator
+	sidecarCache    *sidecarCache
+	// finalizedCache holds the block "finalized" resolved to, nil if it is resolved on every request.
+	finalizedCache *finalizedCache
+	peers          []*beacon.BlobArchiverSource
+	// wanted records blocks that weren't found for the archiver to fetch, nil if disabled.
+	wanted *wantedRecorder
+
+	// clock is the source of the current time of the slot clock.
+	clock beacon.Clock
+	// slotClock is fetched from the beacon node at startup, or once it is first needed, see getSlotClock.
+	slotClockMu sync.Mutex
+	slotClock   *beacon.SlotClock
+	// forks is the fork schedule of the chain, fetched from the beacon node at startup, or once it is first needed, see
+	// getForkSchedule.
+	forksMu sync.Mutex
+	forks   []beacon.Fork
 }
 
-func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient client.BeaconBlockHeadersProvider, metrics m.Metricer, logger log.Logger) *API {
+func NewAPI(dataStoreClient storage.DataStoreReader, beaconClient beacon.Client, cfg flags.APIConfig, metrics m.Metricer, logger log.Logger) *API {
 	result := &API{
 		dataStoreClient: dataStoreClient,
 		beaconClient:    beaconClient,
+		cfg:             cfg,
 		router:          chi.NewRouter(),
 		logger:          logger,
 		metrics:         metrics,
+		readLimiter:     newReadLimiter(cfg.StorageRead.Concurrency, cfg.StorageRead.QueueSize, cfg.StorageRead.QueueTimeout, metrics),
+		sidecarCache:    newSidecarCache(cfg.SidecarCacheSize, metrics),
+		finalizedCache:  newFinalizedCache(cfg.FinalizedResolutionTTL),
+		peers:           newPeerSources(cfg.Peers),
+		wanted:          newWantedRecorder(cfg.Wanted, dataStoreClient, logger),
+		clock:           beacon.SystemClock{},
+	}
+
+	limits, err := cfg.RateLimits.Limits()
+	if err != nil {
+		logger.Error("invalid rate limits, requests are not rate limited", "err", err)
+	}
+	result.rateLimiter = newRateLimiter(limits, cfg.RateLimits.KeyHeader, cfg.RateLimits.MaxClients, metrics)
+
+	overrides, err := cfg.ContentType.ParseOverrides()
+	if err != nil {
+		logger.Error("invalid content type overrides, the default content type applies to all requests", "err", err)
 	}
+	result.contentTypes = newContentNegotiator(cfg.ContentType, cfg.PathPrefix, overrides)
 
 	r := result.router
 	r.Use(middleware.Logger)
 	r.Use(middleware.Timeout(serverTimeout))
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Heartbeat("/healthz"))
-	r.Use(middleware.Compress(5, jsonAcceptType, sszAcceptType))
+
+	// Routes are registered without trailing slashes, so unless they are stripped or redirected, paths with them are
+	// unknown
+	switch cfg.TrailingSlash {
+	case flags.TrailingSlashAccept:
+		r.Use(middleware.StripSlashes)
+	case flags.TrailingSlashRedirect:
+		r.Use(redirectTrailingSlash)
+	}
+	if cfg.PrefixHealth {
+		r.Use(middleware.Heartbeat(cfg.PathPrefix + "/healthz"))
+	} else {
+		r.Use(middleware.Heartbeat("/healthz"))
+	}
+
+	if cfg.RequestLimits.MaxURLBytes > 0 {
+		r.Use(limitRequestURL(cfg.RequestLimits.MaxURLBytes))
+	}
+	if cfg.RequestLimits.MaxBodyBytes > 0 {
+		r.Use(limitRequestBody(cfg.RequestLimits.MaxBodyBytes))
+	}
+
+	// zstd takes precedence over the built-in gzip and deflate encoders for clients that accept it
+	compressor := middleware.NewCompressor(5, jsonAcceptType, sszAcceptType, cborAcceptType)
+	compressor.SetEncoder("zstd", newZstdEncoder)
+	r.Use(compressor.Handler)
 
 	recorder := opmetrics.NewPromHTTPRecorder(metrics.Registry(), m.MetricsNamespace)
 	r.Use(func(handler http.Handler) http.Handler {
 		return opmetrics.NewHTTPRecordingMiddleware(recorder, handler)
 	})
 
-	r.Get("/eth/v1/beacon/blob_sidecars/{id}", result.blobSidecarHandler)
+	// The handler is set before the routes, so that the router of a path prefix inherits it
+	r.MethodNotAllowed(result.methodNotAllowedHandler)
+
+	routes := func(r chi.Router) {
+		result.blobSidecarRoutes(r)
+		if cfg.RouteEnabled(flags.RouteLatest) {
+			r.With(result.rateLimit(flags.RouteLatest)).Get("/eth/v1/archiver/latest", result.latestHandler)
+		}
+		if cfg.RouteEnabled(flags.RouteBlobAvailability) {
+			r.With(result.rateLimit(flags.RouteBlobAvailability)).Get("/eth/v1/archiver/blob_availability/{id}", result.blobAvailabilityHandler)
+		}
+		if cfg.RouteEnabled(flags.RouteHeader) {
+			r.With(result.rateLimit(flags.RouteHeader)).Get("/eth/v1/archiver/header/{id}", result.headerHandler)
+		}
+		if cfg.RouteEnabled(flags.RouteDataColumns) {
+			r.With(result.rateLimit(flags.RouteDataColumns)).Get("/eth/v1/archiver/data_column_sidecars/{id}", result.dataColumnSidecarsHandler)
+		}
+		if cfg.RouteEnabled(flags.RouteExecutionBlock) {
+			r.With(result.rateLimit(flags.RouteExecutionBlock)).Get("/eth/v1/archiver/execution_block/{number}/blob_sidecars", result.executionBlockHandler)
+		}
+		if cfg.RouteEnabled(flags.RouteForks) {
+			r.With(result.rateLimit(flags.RouteForks)).Get("/eth/v1/archiver/forks", result.forksHandler)
+		}
+	}
+
+	if cfg.PathPrefix == "" {
+		routes(r)
+	} else {
+		r.Route(cfg.PathPrefix, routes)
+	}
 
 	return result
 }
 
+// blockIdPatterns are the patterns of the kinds of block identifiers, by the route of the blob sidecars endpoint serving
+// them.
+var blockIdPatterns = []struct {
+	route   string
+	pattern string
+}{
+	{route: flags.RouteBlobSidecarsHash, pattern: "0x[0-9a-fA-F]{64}"},
+	{route: flags.RouteBlobSidecarsSlot, pattern: "[0-9]+"},
+	{route: flags.RouteBlobSidecarsNamed, pattern: "(?i)(genesis|finalized|head)"},
+}
+
+// blobSidecarRoutes registers the blob sidecars endpoint for the kinds of block identifiers whose routes are enabled.
+// If all of them are, every identifier is routed to the handler, which rejects invalid ones with a 400. Otherwise only
+// identifiers of the enabled kinds are, and all others are answered with a 404.
+func (a *API) blobSidecarRoutes(r chi.Router) {
+	var enabled []string
+	for _, id := range blockIdPatterns {
+		if a.cfg.RouteEnabled(id.route) {
+			enabled = append(enabled, id.route)
+		}
+	}
+
+	if len(enabled) == len(blockIdPatterns) {
+		r.With(a.rateLimitBlobSidecars()).Get("/eth/v1/beacon/blob_sidecars/{id}", a.blobSidecarHandler)
+		return
+	}
+
+	for _, id := range blockIdPatterns {
+		if slices.Contains(enabled, id.route) {
+			r.With(a.rateLimit(id.route)).Get(fmt.Sprintf("/eth/v1/beacon/blob_sidecars/{id:%s}", id.pattern), a.blobSidecarHandler)
+		}
+	}
+}
+
+// limitRequestURL refuses requests whose URL, its path and query as sent by the client, is longer than limit bytes with
+// a 414.
+func limitRequestURL(limit int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uri := r.RequestURI
+			if uri == "" {
+				uri = r.URL.RequestURI()
+			}
+
+			if len(uri) > limit {
+				errRequestURLTooLong.write(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitRequestBody refuses requests whose body is declared larger than limit bytes with a 413, and stops handlers from
+// reading more than limit bytes of bodies of unknown length.
+func limitRequestBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				errRequestBodyTooLarge.write(w)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// redirectTrailingSlash responds to requests whose path ends in a slash with a permanent redirect to the path without
+// it, keeping the query. Unlike middleware.RedirectSlashes, the redirect only carries the path, so that it isn't
+// affected by the Host header. Paths that would redirect to another host, e.g. //example.com/, are left to the router.
+func redirectTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		if path == r.URL.Path || path == "" || strings.HasPrefix(path, "//") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		location := (&url.URL{Path: path, RawQuery: r.URL.RawQuery}).String()
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	})
+}
+
+// methodNotAllowedHandler handles requests to known routes with a method the route does not support. OPTIONS requests
+// are answered with the methods the route supports, all other methods receive a 405. In both cases the supported
+// methods are listed in the Allow header. If an allowed origin is configured, the response also carries the matching
+// CORS headers, so that browsers can use the answer to an OPTIONS request as a preflight response.
+func (a *API) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	allowed := a.allowedMethods(r.URL.Path)
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if a.cfg.AllowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", a.cfg.AllowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+	}
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	errMethodNotAllowed.write(w)
+}
+
+// allowedMethods returns the methods registered for the route matching the path, followed by OPTIONS.
+func (a *API) allowedMethods(path string) []string {
+	var registered []string
+	_ = chi.Walk(a.router, func(method string, _ string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !slices.Contains(registered, method) {
+			registered = append(registered, method)
+		}
+		return nil
+	})
+	slices.Sort(registered)
+
+	var allowed []string
+	for _, method := range registered {
+		if method != http.MethodOptions && a.router.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return append(allowed, http.MethodOptions)
+}
+
+// newZstdEncoder creates a zstd encoder writing to w, at the zstd level closest to the given compression level.
+func newZstdEncoder(w io.Writer, level int) io.Writer {
+	encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil
+	}
+
+	return encoder
+}
+
 func isHash(s string) bool {
 	if len(s) != 66 || !strings.HasPrefix(s, "0x") {
 		return false
@@ -128,79 +443,369 @@ func isKnownIdentifier(id string) bool {
 	return slices.Contains([]string{"genesis", "finalized", "head"}, id)
 }
 
+// normalizeBlockId lower-cases named block identifiers, which are matched case-insensitively, e.g. HEAD is head. Other
+// identifiers are returned as they are.
+func normalizeBlockId(id string) string {
+	if lower := strings.ToLower(id); isKnownIdentifier(lower) {
+		return lower
+	}
+	return id
+}
+
 // toBeaconBlockHash converts a string that can be a slot, hash or identifier to a beacon block hash.
 func (a *API) toBeaconBlockHash(id string) (common.Hash, *httpError) {
+	hash, _, err := a.resolveBlockId(id)
+	return hash, err
+}
+
+// resolveBlockId converts a string that can be a slot, hash or identifier to a beacon block hash, and returns the
+// Cache-Control header value of responses for the identifier, see cacheControl.
+func (a *API) resolveBlockId(id string) (common.Hash, string, *httpError) {
+	id = normalizeBlockId(id)
 	if isHash(id) {
 		a.metrics.RecordBlockIdType(m.BlockIdTypeHash)
-		return common.HexToHash(id), nil
+		return common.HexToHash(id), cacheControl(a.cfg.CacheControl.Hash), nil
 	} else if isSlot(id) || isKnownIdentifier(id) {
 		a.metrics.RecordBlockIdType(m.BlockIdTypeBeacon)
+		if id == "finalized" {
+			if root, ok := a.finalizedCache.get(a.clock.Now()); ok {
+				return root, a.identifierCacheControl(id, true), nil
+			}
+		}
+
 		result, err := a.beaconClient.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{
 			Common: api.CommonOpts{},
 			Block:  id,
 		})
 
 		if err != nil {
+			if isSlot(id) {
+				hash, found, httpErr := a.slotIndexLookup(id)
+				if httpErr != nil {
+					return common.Hash{}, "", httpErr
+				}
+
+				if found {
+					// Slots missing from the beacon node are old enough to be finalized
+					return hash, cacheControl(a.cfg.CacheControl.Hash), nil
+				}
+			}
+
 			var apiErr *api.Error
 			if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
-				return common.Hash{}, errUnknownBlock
+				return common.Hash{}, "", errUnknownBlock
 			}
 
-			return common.Hash{}, errServerError
+			return common.Hash{}, "", errServerError
+		}
+
+		if id == "head" {
+			if httpErr := a.checkHeadAge(result.Data); httpErr != nil {
+				return common.Hash{}, "", httpErr
+			}
 		}
 
-		return common.Hash(result.Data.Root), nil
+		if id == "finalized" {
+			a.finalizedCache.set(common.Hash(result.Data.Root), a.clock.Now())
+		}
+
+		finalized, _ := result.Metadata["finalized"].(bool)
+		return common.Hash(result.Data.Root), a.identifierCacheControl(id, finalized), nil
 	} else {
 		a.metrics.RecordBlockIdType(m.BlockIdTypeInvalid)
-		return common.Hash{}, newBlockIdError(id)
+		return common.Hash{}, "", newBlockIdError(id)
 	}
 }
 
+// identifierCacheControl returns the Cache-Control header value of responses for a slot or named identifier, depending
+// on whether the block it resolved to is finalized.
+func (a *API) identifierCacheControl(id string, finalized bool) string {
+	switch id {
+	case "head":
+		return cacheControl(a.cfg.CacheControl.Head)
+	case "finalized":
+		return cacheControl(a.cfg.CacheControl.Finalized)
+	case "genesis":
+		return cacheControl(a.cfg.CacheControl.Hash)
+	}
+
+	if finalized {
+		return cacheControl(a.cfg.CacheControl.Hash)
+	}
+
+	return cacheControl(a.cfg.CacheControl.Slot)
+}
+
+// cacheControl returns the Cache-Control header value allowing responses to be cached for maxAge, or marking them as
+// not cacheable if it is 0.
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
+}
+
+// checkHeadAge checks that the head resolved by the beacon node is no older than the configured maximum age, as an old
+// head indicates that the beacon node is stalled. Depending on the configured action, a stale head is either rejected
+// with errStaleHead or only logged.
+func (a *API) checkHeadAge(head *v1.BeaconBlockHeader) *httpError {
+	if a.cfg.HeadMaxAge == 0 {
+		return nil
+	}
+
+	clock, err := a.getSlotClock(context.Background())
+	if err != nil {
+		a.logger.Info("unexpected error fetching the slot clock", "err", err)
+		return errServerError
+	}
+
+	age := clock.SlotAge(head.Header.Message.Slot)
+	if age <= a.cfg.HeadMaxAge {
+		return nil
+	}
+
+	a.logger.Warn("head is stale, the beacon node may be stalled", "slot", head.Header.Message.Slot, "age", age)
+	if a.cfg.StaleHeadAction == flags.StaleHeadActionWarn {
+		return nil
+	}
+
+	return errStaleHead
+}
+
+// initSlotClock fetches the slot clock of the chain, retrying while the beacon node may not be ready yet. If it can't be
+// fetched, it is fetched on first use instead, see getSlotClock.
+func (a *API) initSlotClock(ctx context.Context) {
+	clock, err := beacon.FetchSlotClock(ctx, a.beaconClient, a.clock, slotClockMaximumRetries)
+	if err != nil {
+		a.logger.Warn("failed to fetch the slot clock, fetching it on first use", "err", err)
+		return
+	}
+
+	a.slotClockMu.Lock()
+	defer a.slotClockMu.Unlock()
+	if a.slotClock == nil {
+		a.slotClock = &clock
+	}
+}
+
+// getSlotClock returns the slot clock of the chain, fetching it from the beacon node if it wasn't fetched yet.
+func (a *API) getSlotClock(ctx context.Context) (beacon.SlotClock, error) {
+	a.slotClockMu.Lock()
+	defer a.slotClockMu.Unlock()
+
+	if a.slotClock == nil {
+		clock, err := beacon.NewSlotClock(ctx, a.beaconClient, a.clock)
+		if err != nil {
+			return beacon.SlotClock{}, err
+		}
+		a.slotClock = &clock
+	}
+
+	return *a.slotClock, nil
+}
+
+// slotIndexLookup resolves a slot through the slot index written by the archiver. It is used when the beacon node
+// can't resolve the slot, e.g. because it was checkpoint synced and doesn't have the header.
+func (a *API) slotIndexLookup(id string) (common.Hash, bool, *httpError) {
+	slot, _ := strconv.ParseUint(id, 10, 64)
+
+	release, err := a.readLimiter.acquire(context.Background())
+	if err != nil {
+		return common.Hash{}, false, errServiceUnavailable
+	}
+	defer release()
+
+	hash, err := a.dataStoreClient.ReadSlotIndex(context.Background(), slot)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			a.logger.Info("unexpected error reading slot index", "err", err, "slot", slot)
+		}
+		return common.Hash{}, false, nil
+	}
+
+	return hash, true, nil
+}
+
+// readBlobs reads the blobs of a block from storage, once the storage read limit allows it, merged with its partial blob
+// data if partials are assembled. If the read is shed, errReadsOverloaded is returned. If the blob data can't be decoded
+// or fails validation, see validateBlobData, errCorruptBlobData is returned rather than serving it.
+func (a *API) readBlobs(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, error) {
+	release, err := a.readLimiter.acquire(ctx)
+	if err != nil {
+		return storage.BlobData{}, err
+	}
+	defer release()
+
+	var data storage.BlobData
+	if a.cfg.AssemblePartials {
+		data, err = storage.AssembleBlobData(ctx, a.dataStoreClient, beaconBlockHash)
+	} else {
+		data, err = a.dataStoreClient.Read(ctx, beaconBlockHash)
+	}
+
+	reason := corruptReasonDecode
+	if err == nil {
+		err = validateBlobData(beaconBlockHash, data)
+		reason = corruptReasonInvalid
+	} else if errors.Is(err, storage.ErrMarshaling) {
+		err = fmt.Errorf("%w: %w", errCorruptBlobData, err)
+	}
+
+	if errors.Is(err, errCorruptBlobData) {
+		a.logger.Error("stored blob data is corrupt", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		a.metrics.RecordCorruptRead(reason)
+		return storage.BlobData{}, err
+	}
+
+	return data, err
+}
+
 // blobSidecarHandler implements the /eth/v1/beacon/blob_sidecars/{id} endpoint, using the underlying DataStoreReader
-// to fetch blobs instead of the beacon node. This allows clients to fetch expired blobs.
+// to fetch blobs instead of the beacon node. This allows clients to fetch expired blobs. The time taken to resolve the
+// block id, read the sidecars and serialize them is recorded for successful requests, see m.RequestPhase.
 func (a *API) blobSidecarHandler(w http.ResponseWriter, r *http.Request) {
 	param := chi.URLParam(r, "id")
-	beaconBlockHash, err := a.toBeaconBlockHash(param)
+	started := time.Now()
+	beaconBlockHash, cacheHeader, err := a.resolveBlockId(param)
 	if err != nil {
 		err.write(w)
 		return
 	}
+	a.metrics.RecordRequestPhaseDuration(r.Context(), m.RequestPhaseResolve, time.Since(started))
+
+	w.Header().Set("Cache-Control", cacheHeader)
+
+	readStarted := time.Now()
+	if cached, ok := a.sidecarCache.get(beaconBlockHash); ok {
+		a.metrics.RecordRequestPhaseDuration(r.Context(), m.RequestPhaseRead, time.Since(readStarted))
+		// Identifiers other than hashes are resolved by the beacon node
+		a.sidecarCache.recordResponse(isHash(param))
+		a.setPreloadLink(w, beaconBlockHash)
+		a.serializeSidecars(r.Context(), func() { a.writeCachedSidecars(w, r, cached) })
+		return
+	}
+
+	// notFound is the response if the block can't be found, which lazy backfill may refine
+	notFound := errUnknownBlock
+	result, storageErr := a.readBlobs(r.Context(), beaconBlockHash)
+	if errors.Is(storageErr, storage.ErrNotFound) && a.cfg.LazyBackfill {
+		result, err = a.lazyBackfill(r.Context(), beaconBlockHash)
+		if err != nil && (err.Code != http.StatusNotFound || len(a.peers) == 0) {
+			err.write(w)
+			return
+		}
+		if err != nil {
+			notFound = err
+		} else {
+			storageErr = nil
+		}
+	}
+
+	if errors.Is(storageErr, storage.ErrNotFound) && len(a.peers) > 0 {
+		result, err = a.peerLookup(r.Context(), beaconBlockHash)
+		if err != nil {
+			if err == errUnknownBlock {
+				if notFound == errUnknownBlock {
+					a.wanted.recordMiss(r.Context(), beaconBlockHash)
+				}
+				err = notFound
+			}
+			err.write(w)
+			return
+		}
+		storageErr = nil
+	}
 
-	result, storageErr := a.dataStoreClient.Read(r.Context(), beaconBlockHash)
 	if storageErr != nil {
 		if errors.Is(storageErr, storage.ErrNotFound) {
-			errUnknownBlock.write(w)
+			// Blocks lazy backfill didn't find are unknown to the beacon node, so the archiver couldn't fetch them either
+			if notFound == errUnknownBlock {
+				a.wanted.recordMiss(r.Context(), beaconBlockHash)
+			}
+			notFound.write(w)
 		} else {
-			a.logger.Info("unexpected error fetching blobs", "err", storageErr, "beaconBlockHash", beaconBlockHash.String(), "param", param)
-			errServerError.write(w)
+			httpErr := storageHTTPError(storageErr)
+			if httpErr == errServerError {
+				a.logger.Info("unexpected error fetching blobs", "err", storageErr, "beaconBlockHash", beaconBlockHash.String(), "param", param)
+			}
+			httpErr.write(w)
 		}
 		return
 	}
+	a.metrics.RecordRequestPhaseDuration(r.Context(), m.RequestPhaseRead, time.Since(readStarted))
+
+	a.sidecarCache.recordResponse(false)
+	a.setPreloadLink(w, beaconBlockHash)
+	// Blocks known to be incomplete may still be re-archived with all their sidecars, so they aren't cached
+	if result.Header.Incomplete(len(result.BlobSidecars.Data)) {
+		a.serializeSidecars(r.Context(), func() { a.writeSidecars(w, r, result.Header, result.BlobSidecars) })
+		return
+	}
+
+	if cached := a.sidecarCache.add(beaconBlockHash, result.BlobSidecars.Data); cached != nil {
+		a.serializeSidecars(r.Context(), func() { a.writeCachedSidecars(w, r, cached) })
+		return
+	}
+
+	a.serializeSidecars(r.Context(), func() { a.writeSidecars(w, r, result.Header, result.BlobSidecars) })
+}
+
+// setPreloadLink sets the Link header of a blob sidecars response to preload the route configured by PreloadLink for
+// the block, unless it is disabled. The block is linked by its hash, so that the link is cacheable.
+func (a *API) setPreloadLink(w http.ResponseWriter, beaconBlockHash common.Hash) {
+	if a.cfg.PreloadLink == "" {
+		return
+	}
 
-	blobSidecars := result.BlobSidecars
+	target := fmt.Sprintf("%s/eth/v1/archiver/%s/%s", a.cfg.PathPrefix, a.cfg.PreloadLink, beaconBlockHash.String())
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=preload; as=fetch", target))
+}
+
+// serializeSidecars writes a blob sidecars response of the request in the context with the given function, recording
+// the time it takes.
+func (a *API) serializeSidecars(ctx context.Context, write func()) {
+	started := time.Now()
+	write()
+	a.metrics.RecordRequestPhaseDuration(ctx, m.RequestPhaseSerialize, time.Since(started))
+}
 
-	filteredBlobSidecars, err := filterBlobs(blobSidecars.Data, r.URL.Query().Get("indices"))
+// writeSidecars writes the response of the blob sidecars endpoint in the requested format, for the block of the header.
+func (a *API) writeSidecars(w http.ResponseWriter, r *http.Request, header storage.Header, blobSidecars storage.BlobSidecars) {
+	blobCount := blockBlobCount(header, blobSidecars.Data)
+	filteredBlobSidecars, err := filterBlobs(blobSidecars.Data, blobCount, r.URL.Query().Get("indices"), a.cfg.RequestLimits.MaxIndices)
 	if err != nil {
 		err.write(w)
 		return
 	}
 
 	blobSidecars.Data = filteredBlobSidecars
-	responseType := r.Header.Get("Accept")
+	responseType := a.contentTypes.responseType(r)
 
 	if responseType == sszAcceptType {
 		w.Header().Set("Content-Type", sszAcceptType)
-		res, err := blobSidecars.MarshalSSZ()
+		// Sidecars are marshaled as they are written, so memory is bounded by a single sidecar, not the response
+		start := time.Now()
+		written, err := blobSidecars.WriteSSZ(w)
+		a.metrics.RecordSSZDuration(storage.SSZMarshal, time.Since(start))
+		if err != nil {
+			a.logger.Error("unable to write ssz response", "err", err, "written", written)
+			if written == 0 {
+				errServerError.write(w)
+			}
+			return
+		}
+	} else if responseType == cborAcceptType {
+		w.Header().Set("Content-Type", cborAcceptType)
+		res, err := cbor.Marshal(blobSidecars)
 		if err != nil {
-			a.logger.Error("unable to marshal blob sidecars to SSZ", "err", err)
+			a.logger.Error("unable to marshal blob sidecars to CBOR", "err", err)
 			errServerError.write(w)
 			return
 		}
 
-		_, err = w.Write(res)
-
-		if err != nil {
-			a.logger.Error("unable to write ssz response", "err", err)
+		if _, err := w.Write(res); err != nil {
+			a.logger.Error("unable to write cbor response", "err", err)
 			errServerError.write(w)
 			return
 		}
@@ -215,39 +820,497 @@ func (a *API) blobSidecarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// filterBlobs filters the blobs based on the indices query provided.
+type latestBlock struct {
+	Root common.Hash `json:"root"`
+	Slot uint64      `json:"slot,string"`
+}
+
+type latestResponse struct {
+	Data latestBlock `json:"data"`
+}
+
+// latestHandler implements the /eth/v1/archiver/latest endpoint, returning the most recently archived block according
+// to the latest pointer. The pointer is overwritten as blocks are archived, so responses must not be cached.
+func (a *API) latestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonAcceptType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	release, err := a.readLimiter.acquire(r.Context())
+	if err != nil {
+		errServiceUnavailable.write(w)
+		return
+	}
+	defer release()
+
+	header, err := a.dataStoreClient.ReadLatest(r.Context())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			errUnknownBlock.write(w)
+		} else {
+			a.logger.Info("unexpected error fetching latest pointer", "err", err)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(latestResponse{
+		Data: latestBlock{
+			Root: header.BeaconBlockHash,
+			Slot: header.Slot,
+		},
+	})
+	if err != nil {
+		a.logger.Error("unable to encode latest pointer to JSON", "err", err)
+	}
+}
+
+type blobAvailability struct {
+	Root common.Hash `json:"root"`
+	// Indices are encoded as strings, like other integers of the beacon API.
+	Indices []string `json:"indices"`
+}
+
+type blobAvailabilityResponse struct {
+	Data blobAvailability `json:"data"`
+}
+
+// blobAvailabilityHandler implements the /eth/v1/archiver/blob_availability/{id} endpoint, returning the indices of
+// the blob sidecars archived for a block without the blobs themselves, so that clients know which indices to fetch from
+// another source. Blocks that are not archived are not backfilled, even with lazy backfill enabled.
+func (a *API) blobAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	beaconBlockHash, httpErr := a.toBeaconBlockHash(chi.URLParam(r, "id"))
+	if httpErr != nil {
+		httpErr.write(w)
+		return
+	}
+
+	var sidecars []*deneb.BlobSidecar
+	if cached, ok := a.sidecarCache.get(beaconBlockHash); ok {
+		sidecars = cached.sidecars
+	} else {
+		result, err := a.readBlobs(r.Context(), beaconBlockHash)
+		if err != nil {
+			httpErr := storageHTTPError(err)
+			if httpErr == errServerError {
+				a.logger.Info("unexpected error fetching blobs", "err", err, "beaconBlockHash", beaconBlockHash.String())
+			}
+			httpErr.write(w)
+			return
+		}
+		sidecars = result.BlobSidecars.Data
+	}
+
+	present := make([]uint64, 0, len(sidecars))
+	for _, sidecar := range sidecars {
+		present = append(present, uint64(sidecar.Index))
+	}
+	slices.Sort(present)
+
+	indices := make([]string, 0, len(present))
+	for _, index := range present {
+		indices = append(indices, strconv.FormatUint(index, 10))
+	}
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	err := json.NewEncoder(w).Encode(blobAvailabilityResponse{
+		Data: blobAvailability{
+			Root:    beaconBlockHash,
+			Indices: indices,
+		},
+	})
+	if err != nil {
+		a.logger.Error("unable to encode blob availability to JSON", "err", err)
+	}
+}
+
+type storedCommitment struct {
+	Index         uint64              `json:"index,string"`
+	KZGCommitment deneb.KZGCommitment `json:"kzg_commitment"`
+}
+
+type storedHeader struct {
+	Root       common.Hash `json:"root"`
+	Slot       uint64      `json:"slot,string"`
+	Optimistic bool        `json:"optimistic"`
+	// ExecutionBlockNumber is omitted for blocks archived without recording it.
+	ExecutionBlockNumber uint64 `json:"execution_block_number,string,omitempty"`
+	// Commitments are those of the stored blob sidecars, ordered by index, so they are incomplete if the block was
+	// archived with fewer sidecars than it has commitments.
+	Commitments []storedCommitment `json:"kzg_commitments"`
+}
+
+type storedHeaderResponse struct {
+	Data storedHeader `json:"data"`
+}
+
+// headerHandler implements the /eth/v1/archiver/header/{id} endpoint, returning the stored header of a block and the
+// KZG commitments of its stored blob sidecars, without the blobs. It is served from storage only: block roots are not
+// resolved through the beacon node, and blocks that are not archived are not backfilled, even with lazy backfill enabled.
+func (a *API) headerHandler(w http.ResponseWriter, r *http.Request) {
+	beaconBlockHash, cacheHeader, httpErr := a.resolveBlockId(chi.URLParam(r, "id"))
+	if httpErr != nil {
+		httpErr.write(w)
+		return
+	}
+
+	result, err := a.readBlobs(r.Context(), beaconBlockHash)
+	if err != nil {
+		httpErr := storageHTTPError(err)
+		if httpErr == errServerError {
+			a.logger.Info("unexpected error fetching blobs", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		}
+		httpErr.write(w)
+		return
+	}
+
+	header := storedHeader{
+		Root:                 beaconBlockHash,
+		Slot:                 result.Header.Slot,
+		Optimistic:           result.Header.Optimistic,
+		ExecutionBlockNumber: result.Header.ExecutionBlockNumber,
+		Commitments:          make([]storedCommitment, 0, len(result.BlobSidecars.Data)),
+	}
+	for _, sidecar := range result.BlobSidecars.Data {
+		header.Commitments = append(header.Commitments, storedCommitment{
+			Index:         uint64(sidecar.Index),
+			KZGCommitment: sidecar.KZGCommitment,
+		})
+
+		// Blob data written before slots were recorded only carries the slot in the headers of its sidecars
+		if header.Slot == 0 && sidecar.SignedBlockHeader != nil && sidecar.SignedBlockHeader.Message != nil {
+			header.Slot = uint64(sidecar.SignedBlockHeader.Message.Slot)
+		}
+	}
+	slices.SortFunc(header.Commitments, func(x, y storedCommitment) int {
+		return cmp.Compare(x.Index, y.Index)
+	})
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	w.Header().Set("Cache-Control", cacheHeader)
+	err = json.NewEncoder(w).Encode(storedHeaderResponse{Data: header})
+	if err != nil {
+		a.logger.Error("unable to encode stored header to JSON", "err", err)
+	}
+}
+
+// executionBlockHandler implements the /eth/v1/archiver/execution_block/{number}/blob_sidecars endpoint, returning the
+// blob sidecars of the block whose execution payload has the given block number, like the blob sidecars endpoint. The
+// block is looked up in the execution block number index written by the archiver, so only blocks archived with the
+// index enabled are found. It is served from storage only, and blocks that are not archived return a 404.
+func (a *API) executionBlockHandler(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "number")
+	number, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		newExecutionBlockNumberError(param).write(w)
+		return
+	}
+
+	release, err := a.readLimiter.acquire(r.Context())
+	if err != nil {
+		errServiceUnavailable.write(w)
+		return
+	}
+	beaconBlockHash, err := a.dataStoreClient.ReadExecutionIndex(r.Context(), number)
+	release()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			errUnknownBlock.write(w)
+		} else {
+			a.logger.Info("unexpected error reading execution index", "err", err, "number", number)
+			errServerError.write(w)
+		}
+		return
+	}
+
+	result, err := a.readBlobs(r.Context(), beaconBlockHash)
+	if err != nil {
+		httpErr := storageHTTPError(err)
+		if httpErr == errServerError {
+			a.logger.Info("unexpected error fetching blobs", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		}
+		httpErr.write(w)
+		return
+	}
+
+	// The index entry of an execution block number is overwritten if the block it points at is reorged out
+	w.Header().Set("Cache-Control", "no-cache")
+	a.writeSidecars(w, r, result.Header, result.BlobSidecars)
+}
+
+type dataColumnSidecarsResponse struct {
+	Data []*storage.DataColumnSidecar `json:"data"`
+}
+
+// dataColumnSidecarsHandler implements the /eth/v1/archiver/data_column_sidecars/{id} endpoint, returning the data
+// column sidecars stored for a block as JSON, or SSZ if requested. Like the stored headers endpoint, it is served from
+// storage only. Blocks that are not archived, or were archived without data column sidecars, return a 404.
+func (a *API) dataColumnSidecarsHandler(w http.ResponseWriter, r *http.Request) {
+	beaconBlockHash, cacheHeader, httpErr := a.resolveBlockId(chi.URLParam(r, "id"))
+	if httpErr != nil {
+		httpErr.write(w)
+		return
+	}
+
+	result, err := a.readBlobs(r.Context(), beaconBlockHash)
+	if err != nil {
+		httpErr := storageHTTPError(err)
+		if httpErr == errServerError {
+			a.logger.Info("unexpected error fetching blobs", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		}
+		httpErr.write(w)
+		return
+	}
+
+	if len(result.DataColumnSidecars) == 0 {
+		errNoDataColumns.write(w)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cacheHeader)
+	if a.contentTypes.responseType(r) == sszAcceptType {
+		res, err := storage.MarshalDataColumnSidecarsSSZ(result.DataColumnSidecars)
+		if err != nil {
+			a.logger.Error("unable to marshal data column sidecars to SSZ", "err", err)
+			errServerError.write(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", sszAcceptType)
+		if _, err := w.Write(res); err != nil {
+			a.logger.Error("unable to write ssz data column sidecars", "err", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonAcceptType)
+	err = json.NewEncoder(w).Encode(dataColumnSidecarsResponse{Data: result.DataColumnSidecars})
+	if err != nil {
+		a.logger.Error("unable to encode data column sidecars to JSON", "err", err)
+	}
+}
+
+// writeCachedSidecars writes the response of the blob sidecars endpoint from the serialized sidecars of the cache.
+func (a *API) writeCachedSidecars(w http.ResponseWriter, r *http.Request, cached *cachedSidecars) {
+	// Only complete blocks are cached, see sidecarCache
+	blobCount := blockBlobCount(storage.Header{}, cached.sidecars)
+	positions, err := filterBlobPositions(cached.sidecars, blobCount, r.URL.Query().Get("indices"), a.cfg.RequestLimits.MaxIndices)
+	if err != nil {
+		err.write(w)
+		return
+	}
+
+	var res []byte
+	var encodeErr error
+	switch a.contentTypes.responseType(r) {
+	case sszAcceptType:
+		w.Header().Set("Content-Type", sszAcceptType)
+		start := time.Now()
+		written, err := cached.writeSSZ(w, positions)
+		a.metrics.RecordSSZDuration(storage.SSZMarshal, time.Since(start))
+		if err != nil {
+			a.logger.Error("unable to write cached blob sidecars", "err", err, "written", written)
+			if written == 0 {
+				errServerError.write(w)
+			}
+		}
+		return
+	case cborAcceptType:
+		w.Header().Set("Content-Type", cborAcceptType)
+		res, encodeErr = cached.encodeCBOR(positions)
+	default:
+		w.Header().Set("Content-Type", jsonAcceptType)
+		res, encodeErr = cached.encodeJSON(positions)
+	}
+
+	if encodeErr != nil {
+		a.logger.Error("unable to encode cached blob sidecars", "err", encodeErr)
+		errServerError.write(w)
+		return
+	}
+
+	if _, err := w.Write(res); err != nil {
+		a.logger.Error("unable to write cached blob sidecars", "err", err)
+	}
+}
+
+// lazyBackfill fetches the blobs for a block that is missing from storage from the beacon node, and stores them so
+// subsequent requests are served from storage. Before fetching the sidecars it checks that the block is still within
+// the availability window, as the beacon node will not serve blobs for blocks older than that.
+func (a *API) lazyBackfill(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, *httpError) {
+	header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: beaconBlockHash.String(),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return storage.BlobData{}, errUnknownBlock
+		}
+
+		a.logger.Info("unexpected error fetching header for lazy backfill", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		return storage.BlobData{}, errServerError
+	}
+
+	slot := uint64(header.Data.Header.Message.Slot)
+	if httpErr := a.checkAvailabilityWindow(ctx, slot); httpErr != nil {
+		return storage.BlobData{}, httpErr
+	}
+
+	sidecars, err := a.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: beaconBlockHash.String(),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return storage.BlobData{}, errUnknownBlock
+		}
+
+		a.logger.Info("unexpected error fetching blobs for lazy backfill", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		return storage.BlobData{}, errServerError
+	}
+
+	// A reorged or faulty beacon node mustn't store the sidecars of another block under the requested root
+	if header.Data.Root != phase0.Root(beaconBlockHash) {
+		a.logger.Warn("lazily backfilled header is not the requested block", "root", header.Data.Root, "beaconBlockHash", beaconBlockHash.String())
+		return storage.BlobData{}, errServerError
+	}
+	if err := beacon.CheckSidecarHeaders(sidecars.Data, header.Data); err != nil {
+		a.logger.Warn("lazily backfilled blobs do not belong to the requested block", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		return storage.BlobData{}, errServerError
+	}
+
+	data := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: beaconBlockHash,
+			Slot:            slot,
+		},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars.Data},
+	}
+
+	// The API only writes if it was given a writable data store. Failing to store the blobs shouldn't fail the request,
+	// the blobs will be fetched again on the next miss. The archiver may be storing the same block concurrently.
+	if writer, ok := a.dataStoreClient.(storage.DataStoreWriter); ok {
+		if err := writer.WriteIfNotExists(ctx, data); err != nil && !errors.Is(err, storage.ErrWriteDeduped) {
+			a.logger.Warn("failed to store lazily backfilled blobs", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		}
+	}
+
+	return data, nil
+}
+
+// checkAvailabilityWindow returns errOutsideAvailabilityWindow if the given slot is further behind the current slot
+// than the configured availability window. The current slot is computed by the slot clock, so that misses outside the
+// window are answered without another request to the beacon node.
+func (a *API) checkAvailabilityWindow(ctx context.Context, slot uint64) *httpError {
+	if a.cfg.AvailabilityWindow == 0 {
+		return nil
+	}
+
+	clock, err := a.getSlotClock(ctx)
+	if err != nil {
+		a.logger.Info("unexpected error fetching slot clock for availability check", "err", err)
+		return errServerError
+	}
+
+	current := uint64(clock.CurrentSlot())
+	if current > slot && current-slot > a.cfg.AvailabilityWindow {
+		return errOutsideAvailabilityWindow
+	}
+
+	return nil
+}
+
+// filterBlobs filters the blobs based on the indices query provided, see filterBlobPositions.
 // If no indices are provided, all blobs are returned. If invalid indices are provided, an error is returned.
-func filterBlobs(blobs []*deneb.BlobSidecar, indices string) ([]*deneb.BlobSidecar, *httpError) {
-	if indices == "" {
-		return blobs, nil
+func filterBlobs(blobs []*deneb.BlobSidecar, blobCount uint64, indices string, maxIndices int) ([]*deneb.BlobSidecar, *httpError) {
+	positions, err := filterBlobPositions(blobs, blobCount, indices, maxIndices)
+	if err != nil {
+		return nil, err
 	}
 
-	splits := strings.Split(indices, ",")
-	if len(splits) == 0 {
+	if len(positions) == len(blobs) && slices.IsSorted(positions) {
 		return blobs, nil
 	}
 
-	indicesMap := map[deneb.BlobIndex]struct{}{}
-	for _, index := range splits {
+	filteredBlobs := make([]*deneb.BlobSidecar, 0, len(positions))
+	for _, position := range positions {
+		filteredBlobs = append(filteredBlobs, blobs[position])
+	}
+
+	return filteredBlobs, nil
+}
+
+// parseIndices parses the given comma separated indices, and removes the duplicates among them, keeping the first
+// occurrence of every index. If maxIndices is positive, more than that many indices are refused before any of them is
+// parsed, counting duplicates, so that the work of a request is bounded by the limit rather than by its URL.
+func parseIndices(indices string, maxIndices int) ([]deneb.BlobIndex, *httpError) {
+	count := strings.Count(indices, ",") + 1
+	if maxIndices > 0 && count > maxIndices {
+		return nil, newTooManyIndicesError(count, maxIndices)
+	}
+
+	parsed := make([]deneb.BlobIndex, 0, count)
+	seen := make(map[deneb.BlobIndex]struct{}, count)
+	for _, index := range strings.Split(indices, ",") {
 		parsedInt, err := strconv.ParseUint(index, 10, 64)
 		if err != nil {
 			return nil, newIndicesError(index)
 		}
 
-		if parsedInt >= uint64(len(blobs)) {
-			return nil, newOutOfRangeError(parsedInt, len(blobs))
-		}
-
 		blobIndex := deneb.BlobIndex(parsedInt)
-		indicesMap[blobIndex] = struct{}{}
+		if _, ok := seen[blobIndex]; ok {
+			continue
+		}
+		seen[blobIndex] = struct{}{}
+		parsed = append(parsed, blobIndex)
 	}
 
-	filteredBlobs := make([]*deneb.BlobSidecar, 0)
+	return parsed, nil
+}
+
+// blockBlobCount returns the number of blobs of the block whose blob sidecars are stored, which requested indices are
+// bounded by. Blocks assembled from partial blob data may lack the sidecars of some indices, so it is the number of
+// commitments of the block if it is known, and otherwise past the highest index stored.
+func blockBlobCount(header storage.Header, blobs []*deneb.BlobSidecar) uint64 {
+	count := max(header.Commitments, uint64(len(blobs)))
 	for _, blob := range blobs {
-		if _, ok := indicesMap[blob.Index]; ok {
-			filteredBlobs = append(filteredBlobs, blob)
+		count = max(count, uint64(blob.Index)+1)
+	}
+
+	return count
+}
+
+// filterBlobPositions returns the positions in blobs of the blob sidecars with the given comma separated indices, in
+// the order the indices are given, once they were deduplicated by parseIndices. Indices below blobCount, see
+// blockBlobCount, that are not stored are omitted. All positions are returned, in the order of blobs, if no indices are
+// given.
+func filterBlobPositions(blobs []*deneb.BlobSidecar, blobCount uint64, indices string, maxIndices int) ([]int, *httpError) {
+	positions := make([]int, 0, len(blobs))
+	if indices == "" {
+		for i := range blobs {
+			positions = append(positions, i)
 		}
+		return positions, nil
 	}
 
-	return filteredBlobs, nil
+	requested, err := parseIndices(indices, maxIndices)
+	if err != nil {
+		return nil, err
+	}
+
+	blobPositions := make(map[deneb.BlobIndex]int, len(blobs))
+	for i, blob := range blobs {
+		blobPositions[blob.Index] = i
+	}
+
+	for _, index := range requested {
+		if uint64(index) >= blobCount {
+			return nil, newOutOfRangeError(uint64(index), blobCount)
+		}
+
+		if position, ok := blobPositions[index]; ok {
+			positions = append(positions, position)
+		}
+	}
+
+	return positions, nil
 }
@@ -6,21 +6,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/flags"
 	"github.com/base-org/blob-archiver/api/metrics"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
 	"github.com/base-org/blob-archiver/common/blobtest"
 	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 )
 
@@ -60,7 +68,7 @@ func setup(t *testing.T) (*API, *storage.FileStorage, *beacontest.StubBeaconClie
 	fs := storage.NewFileStorage(tempDir, logger)
 	beacon := beacontest.NewEmptyStubBeaconClient()
 	m := metrics.NewMetrics()
-	a := NewAPI(fs, beacon, m, logger)
+	a := NewAPI(fs, beacon, flags.APIConfig{TrailingSlash: flags.TrailingSlashAccept}, m, logger)
 	return a, fs, beacon, func() {
 		require.NoError(t, os.RemoveAll(tempDir))
 	}
@@ -152,6 +160,30 @@ func TestAPIService(t *testing.T) {
 			status:   200,
 			expected: &blockTwo.BlobSidecars,
 		},
+		{
+			name:     "fetch uppercase head",
+			path:     "/eth/v1/beacon/blob_sidecars/HEAD",
+			status:   200,
+			expected: &blockTwo.BlobSidecars,
+		},
+		{
+			name:     "fetch mixed case finalized",
+			path:     "/eth/v1/beacon/blob_sidecars/Finalized",
+			status:   200,
+			expected: &blockOne.BlobSidecars,
+		},
+		{
+			name:     "fetch head with trailing slash",
+			path:     "/eth/v1/beacon/blob_sidecars/head/",
+			status:   200,
+			expected: &blockTwo.BlobSidecars,
+		},
+		{
+			name:     "fetch slot with trailing slash and indices",
+			path:     "/eth/v1/beacon/blob_sidecars/1234/?indices=1",
+			status:   200,
+			expected: &storage.BlobSidecars{Data: []*deneb.BlobSidecar{blockTwo.BlobSidecars.Data[1]}},
+		},
 		{
 			name:   "indices only returns requested indices",
 			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1",
@@ -172,6 +204,28 @@ func TestAPIService(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "returns indices in requested order",
+			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1,0",
+			status: 200,
+			expected: &storage.BlobSidecars{
+				Data: []*deneb.BlobSidecar{
+					blockTwo.BlobSidecars.Data[1],
+					blockTwo.BlobSidecars.Data[0],
+				},
+			},
+		},
+		{
+			name:   "deduplicates indices keeping their first occurrence",
+			path:   "/eth/v1/beacon/blob_sidecars/1234?indices=1,0,1,0",
+			status: 200,
+			expected: &storage.BlobSidecars{
+				Data: []*deneb.BlobSidecar{
+					blockTwo.BlobSidecars.Data[1],
+					blockTwo.BlobSidecars.Data[0],
+				},
+			},
+		},
 		{
 			name:       "only index out of bounds returns empty array",
 			path:       "/eth/v1/beacon/blob_sidecars/1234?indices=3",
@@ -287,6 +341,41 @@ func TestAPIService(t *testing.T) {
 	}
 }
 
+func TestSlotLookupFallsBackToSlotIndex(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	root := common.Hash{1, 2, 3}
+	data := storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: root,
+			Slot:            1234,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: blobtest.NewBlobSidecars(t, 2),
+		},
+	}
+	require.NoError(t, storage.WriteWithSlotIndex(context.Background(), fs, data))
+
+	// The beacon node doesn't know the slot, but the slot index does
+	request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/1234", nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+
+	var sidecars storage.BlobSidecars
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &sidecars))
+	require.Equal(t, data.BlobSidecars, sidecars)
+
+	// Slots unknown to both are still a 404
+	request = httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/1235", nil)
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 404, response.Code)
+}
+
 func TestHealthHandler(t *testing.T) {
 	a, _, _, cleanup := setup(t)
 	defer cleanup()
@@ -298,3 +387,1872 @@ func TestHealthHandler(t *testing.T) {
 
 	require.Equal(t, 200, response.Code)
 }
+
+func TestLatestHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	get := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/eth/v1/archiver/latest", nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	// No block has been archived yet
+	response := get()
+	require.Equal(t, 404, response.Code)
+
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.WriteLatest(context.Background(), storage.Header{BeaconBlockHash: root, Slot: 1234}))
+
+	response = get()
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "no-cache", response.Header().Get("Cache-Control"))
+	require.JSONEq(t, `{"data":{"root":"`+root.String()+`","slot":"1234"}}`, response.Body.String())
+
+	// The pointer is overwritten by later writes
+	require.NoError(t, fs.WriteLatest(context.Background(), storage.Header{BeaconBlockHash: root, Slot: 1235}))
+
+	response = get()
+	require.Equal(t, 200, response.Code)
+	require.JSONEq(t, `{"data":{"root":"`+root.String()+`","slot":"1235"}}`, response.Body.String())
+}
+
+func TestBlobAvailabilityHandler(t *testing.T) {
+	a, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+
+	full := common.Hash{1}
+	partial := common.Hash{2}
+	empty := common.Hash{3}
+
+	sidecars := blobtest.NewBlobSidecars(t, 4)
+	write := func(hash common.Hash, sidecars []*deneb.BlobSidecar) {
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash},
+			BlobSidecars: storage.BlobSidecars{Data: sidecars},
+		}))
+	}
+	write(full, sidecars)
+	write(partial, []*deneb.BlobSidecar{sidecars[3], sidecars[1]})
+	write(empty, []*deneb.BlobSidecar{})
+
+	beaconClient.Headers["head"] = &v1.BeaconBlockHeader{Root: phase0.Root(partial)}
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+		body   string
+	}{
+		{"full block", full.String(), 200, `{"data":{"root":"` + full.String() + `","indices":["0","1","2","3"]}}`},
+		{"partial block", partial.String(), 200, `{"data":{"root":"` + partial.String() + `","indices":["1","3"]}}`},
+		{"block without blobs", empty.String(), 200, `{"data":{"root":"` + empty.String() + `","indices":[]}}`},
+		{"named identifier", "head", 200, `{"data":{"root":"` + partial.String() + `","indices":["1","3"]}}`},
+		{"missing block", common.Hash{4}.String(), 404, ""},
+		{"invalid identifier", "unknown", 400, ""},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/eth/v1/archiver/blob_availability/"+test.id, nil)
+			response := httptest.NewRecorder()
+
+			a.router.ServeHTTP(response, request)
+
+			require.Equal(t, test.status, response.Code)
+			if test.body != "" {
+				require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+				require.JSONEq(t, test.body, response.Body.String())
+			}
+		})
+	}
+}
+
+// setupLazyBackfillWindow sets up an API lazily backfilling misses within 64 slots of the current slot, which is slot
+// 1000 according to its slot clock.
+func setupLazyBackfillWindow(t *testing.T) (*API, *storage.FileStorage, *beacontest.StubBeaconClient, func()) {
+	a, fs, beaconClient, cleanup := setup(t)
+
+	a.cfg.LazyBackfill = true
+	a.cfg.AvailabilityWindow = 64
+
+	beaconClient.GenesisTime = time.Unix(1606824023, 0)
+	a.clock = beacontest.NewFakeClock(beaconClient.GenesisTime.Add(1000 * 12 * time.Second))
+	a.initSlotClock(context.Background())
+
+	return a, fs, beaconClient, cleanup
+}
+
+// addLazyBackfillBlock adds a block with two blobs at the slot to the beacon node.
+func addLazyBackfillBlock(t *testing.T, beaconClient *beacontest.StubBeaconClient, root common.Hash, slot uint64) {
+	header := &v1.BeaconBlockHeader{
+		Root: phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{
+				Slot: phase0.Slot(slot),
+			},
+		},
+	}
+	beaconClient.Headers[root.String()] = header
+	beaconClient.Blobs[root.String()] = blobtest.NewBlobSidecarsForBlock(t, header.Header, 2)
+}
+
+func TestLazyBackfillRecentMiss(t *testing.T) {
+	a, fs, beaconClient, cleanup := setupLazyBackfillWindow(t)
+	defer cleanup()
+
+	recent := common.Hash{1}
+	addLazyBackfillBlock(t, beaconClient, recent, 990)
+
+	request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", recent), nil)
+	response := httptest.NewRecorder()
+
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+
+	var sidecars storage.BlobSidecars
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &sidecars))
+	require.Equal(t, beaconClient.Blobs[recent.String()], sidecars.Data)
+
+	stored, err := fs.Read(context.Background(), recent)
+	require.NoError(t, err)
+	require.Equal(t, uint64(990), stored.Header.Slot)
+	require.Equal(t, beaconClient.Blobs[recent.String()], stored.BlobSidecars.Data)
+	require.Contains(t, beaconClient.BlobSidecarsRequests, recent.String())
+}
+
+func TestLazyBackfillAncientMiss(t *testing.T) {
+	a, fs, beaconClient, cleanup := setupLazyBackfillWindow(t)
+	defer cleanup()
+
+	ancient := common.Hash{2}
+	addLazyBackfillBlock(t, beaconClient, ancient, 100)
+
+	request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", ancient), nil)
+	response := httptest.NewRecorder()
+
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 404, response.Code)
+
+	var e httpError
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+	require.Equal(t, errOutsideAvailabilityWindow.Message, e.Message)
+
+	exists, err := fs.Exists(context.Background(), ancient)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Only the header of the miss was requested, to learn its slot
+	require.Equal(t, []string{ancient.String()}, beaconClient.HeaderRequests)
+	require.Empty(t, beaconClient.BlobSidecarsRequests)
+}
+
+func TestLazyBackfillRejectsSidecarsOfOtherBlock(t *testing.T) {
+	a, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+
+	a.cfg.LazyBackfill = true
+
+	makeHeader := func(slot uint64, root common.Hash) *v1.BeaconBlockHeader {
+		return &v1.BeaconBlockHeader{
+			Root:   phase0.Root(root),
+			Header: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot)}},
+		}
+	}
+
+	reorged := common.Hash{1}
+	misreported := common.Hash{2}
+
+	// The node serves the sidecars of the block that replaced the requested one
+	beaconClient.Headers[reorged.String()] = makeHeader(990, reorged)
+	beaconClient.Blobs[reorged.String()] = blobtest.NewBlobSidecarsForBlock(t, makeHeader(991, common.Hash{3}).Header, 2)
+
+	// The node serves another block's header and sidecars for the requested root
+	other := makeHeader(992, common.Hash{4})
+	beaconClient.Headers[misreported.String()] = other
+	beaconClient.Blobs[misreported.String()] = blobtest.NewBlobSidecarsForBlock(t, other.Header, 2)
+
+	for _, hash := range []common.Hash{reorged, misreported} {
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+hash.String(), nil))
+		require.Equal(t, 500, response.Code)
+
+		exists, err := fs.Exists(context.Background(), hash)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	a, _, _, cleanup := setup(t)
+	defer cleanup()
+
+	t.Run("unsupported method on known route", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/eth/v1/beacon/blob_sidecars/head", nil)
+		response := httptest.NewRecorder()
+
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 405, response.Code)
+		require.Equal(t, "GET, OPTIONS", response.Header().Get("Allow"))
+
+		var e httpError
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+		require.Equal(t, 405, e.Code)
+	})
+
+	t.Run("options on known route", func(t *testing.T) {
+		request := httptest.NewRequest("OPTIONS", "/eth/v1/beacon/blob_sidecars/head", nil)
+		response := httptest.NewRecorder()
+
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 204, response.Code)
+		require.Equal(t, "GET, OPTIONS", response.Header().Get("Allow"))
+		require.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+		require.Empty(t, response.Body.Bytes())
+	})
+
+	t.Run("options with allowed origin", func(t *testing.T) {
+		a.cfg.AllowOrigin = "*"
+		defer func() { a.cfg.AllowOrigin = "" }()
+
+		request := httptest.NewRequest("OPTIONS", "/eth/v1/beacon/blob_sidecars/head", nil)
+		response := httptest.NewRecorder()
+
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 204, response.Code)
+		require.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "GET, OPTIONS", response.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/eth/v1/unknown", nil)
+		response := httptest.NewRecorder()
+
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 404, response.Code)
+	})
+}
+
+func TestHeaderHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	archived := common.Hash{1}
+	sidecars := blobtest.NewBlobSidecars(t, 3)
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: archived, Slot: 42, Optimistic: true},
+		BlobSidecars: storage.BlobSidecars{Data: []*deneb.BlobSidecar{sidecars[2], sidecars[0]}},
+	}))
+
+	request := httptest.NewRequest("GET", "/eth/v1/archiver/header/"+archived.String(), nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	require.JSONEq(t, fmt.Sprintf(`{"data":{"root":"%s","slot":"42","optimistic":true,"kzg_commitments":[`+
+		`{"index":"0","kzg_commitment":"%s"},{"index":"2","kzg_commitment":"%s"}]}}`,
+		archived, sidecars[0].KZGCommitment, sidecars[2].KZGCommitment), response.Body.String())
+
+	request = httptest.NewRequest("GET", "/eth/v1/archiver/header/"+common.Hash{2}.String(), nil)
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 404, response.Code)
+}
+
+func TestExecutionBlockHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	archived := common.Hash{1}
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: archived, Slot: 42, ExecutionBlockNumber: 19426587},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+	require.NoError(t, fs.WriteExecutionIndex(context.Background(), 19426587, archived))
+	// An index entry of a block that is no longer stored
+	require.NoError(t, fs.WriteExecutionIndex(context.Background(), 19426588, common.Hash{2}))
+
+	request := httptest.NewRequest("GET", "/eth/v1/archiver/execution_block/19426587/blob_sidecars", nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "no-cache", response.Header().Get("Cache-Control"))
+	var res storage.BlobSidecars
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+	require.Equal(t, data.BlobSidecars, res)
+
+	request = httptest.NewRequest("GET", "/eth/v1/archiver/execution_block/19426587/blob_sidecars?indices=1", nil)
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+	require.Equal(t, data.BlobSidecars.Data[1:], res.Data)
+
+	// The stored header carries the execution block number
+	request = httptest.NewRequest("GET", "/eth/v1/archiver/header/"+archived.String(), nil)
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	require.Contains(t, response.Body.String(), `"execution_block_number":"19426587"`)
+
+	for path, code := range map[string]int{
+		"/eth/v1/archiver/execution_block/19426589/blob_sidecars":  404,
+		"/eth/v1/archiver/execution_block/19426588/blob_sidecars":  404,
+		"/eth/v1/archiver/execution_block/0x1286c1b/blob_sidecars": 400,
+		"/eth/v1/archiver/execution_block/-1/blob_sidecars":        400,
+	} {
+		response = httptest.NewRecorder()
+		a.router.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, code, response.Code, path)
+	}
+}
+
+func TestDataColumnSidecarsHandler(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	column := &storage.DataColumnSidecar{
+		Index:             5,
+		Column:            []hexutil.Bytes{make(hexutil.Bytes, 2048)},
+		KZGCommitments:    []deneb.KZGCommitment{{1}},
+		KZGProofs:         []deneb.KZGProof{{2}},
+		SignedBlockHeader: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: 42}},
+	}
+	withColumns := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:             storage.Header{BeaconBlockHash: withColumns, Slot: 42},
+		BlobSidecars:       storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+		DataColumnSidecars: []*storage.DataColumnSidecar{column},
+	}))
+	withoutColumns := common.Hash{2}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: withoutColumns, Slot: 43},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+
+	request := httptest.NewRequest("GET", "/eth/v1/archiver/data_column_sidecars/"+withColumns.String(), nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	var res struct {
+		Data []*storage.DataColumnSidecar `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+	require.Equal(t, []*storage.DataColumnSidecar{column}, res.Data)
+
+	request = httptest.NewRequest("GET", "/eth/v1/archiver/data_column_sidecars/"+withColumns.String(), nil)
+	request.Header.Set("Accept", "application/octet-stream")
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+
+	require.Equal(t, 200, response.Code)
+	expected, err := storage.MarshalDataColumnSidecarsSSZ([]*storage.DataColumnSidecar{column})
+	require.NoError(t, err)
+	require.Equal(t, expected, response.Body.Bytes())
+
+	// Blocks archived without columns, and blocks that aren't archived, are not found
+	for _, hash := range []common.Hash{withoutColumns, {3}} {
+		request = httptest.NewRequest("GET", "/eth/v1/archiver/data_column_sidecars/"+hash.String(), nil)
+		response = httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 404, response.Code)
+	}
+}
+
+func TestDisabledRoutes(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root, Slot: 5},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+	require.NoError(t, fs.WriteLatest(context.Background(), storage.Header{BeaconBlockHash: root, Slot: 5}))
+
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	for _, id := range []string{"head", "5"} {
+		beacon.Headers[id] = &v1.BeaconBlockHeader{
+			Root:   phase0.Root(root),
+			Header: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: 5}},
+		}
+	}
+
+	paths := map[string]string{
+		"hash":         "/eth/v1/beacon/blob_sidecars/" + root.String(),
+		"slot":         "/eth/v1/beacon/blob_sidecars/5",
+		"named":        "/eth/v1/beacon/blob_sidecars/head",
+		"invalid":      "/eth/v1/beacon/blob_sidecars/foo",
+		"latest":       "/eth/v1/archiver/latest",
+		"availability": "/eth/v1/archiver/blob_availability/" + root.String(),
+		"header":       "/eth/v1/archiver/header/" + root.String(),
+		"health":       "/healthz",
+	}
+
+	for _, test := range []struct {
+		name     string
+		disabled []string
+		expected map[string]int
+	}{
+		{
+			name:     "all enabled",
+			expected: map[string]int{"hash": 200, "slot": 200, "named": 200, "invalid": 400, "latest": 200, "availability": 200, "header": 200, "health": 200},
+		},
+		{
+			name:     "hash lookups only",
+			disabled: []string{flags.RouteBlobSidecarsSlot, flags.RouteBlobSidecarsNamed, flags.RouteLatest, flags.RouteBlobAvailability, flags.RouteHeader},
+			expected: map[string]int{"hash": 200, "slot": 404, "named": 404, "invalid": 404, "latest": 404, "availability": 404, "header": 404, "health": 200},
+		},
+		{
+			name:     "sidecars disabled",
+			disabled: []string{flags.RouteBlobSidecarsHash, flags.RouteBlobSidecarsSlot, flags.RouteBlobSidecarsNamed},
+			expected: map[string]int{"hash": 404, "slot": 404, "named": 404, "invalid": 404, "latest": 200, "availability": 200, "header": 200, "health": 200},
+		},
+		{
+			name:     "slot lookups disabled",
+			disabled: []string{flags.RouteBlobSidecarsSlot},
+			expected: map[string]int{"hash": 200, "slot": 404, "named": 200, "invalid": 404, "latest": 200, "availability": 200, "header": 200, "health": 200},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := flags.APIConfig{DisabledRoutes: test.disabled}
+			a := NewAPI(fs, beacon, cfg, metrics.NewMetrics(), logger)
+
+			for name, path := range paths {
+				response := httptest.NewRecorder()
+				a.router.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+				require.Equal(t, test.expected[name], response.Code, name)
+			}
+		})
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	beacon.Headers["head"] = &v1.BeaconBlockHeader{Root: phase0.Root(root)}
+
+	for _, test := range []struct {
+		action   flags.TrailingSlashAction
+		status   int
+		location string
+	}{
+		{action: flags.TrailingSlashReject, status: 404},
+		{action: flags.TrailingSlashAccept, status: 200},
+		{action: flags.TrailingSlashRedirect, status: 301, location: "/blobs/eth/v1/beacon/blob_sidecars/head?indices=1"},
+	} {
+		t.Run(string(test.action), func(t *testing.T) {
+			// Only named identifiers are routed, so that they are matched by the route pattern
+			cfg := flags.APIConfig{
+				PathPrefix:     "/blobs",
+				TrailingSlash:  test.action,
+				DisabledRoutes: []string{flags.RouteBlobSidecarsHash, flags.RouteBlobSidecarsSlot},
+			}
+			a := NewAPI(fs, beacon, cfg, metrics.NewMetrics(), logger)
+
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, httptest.NewRequest("GET", "/blobs/eth/v1/beacon/blob_sidecars/head/?indices=1", nil))
+			require.Equal(t, test.status, response.Code)
+			require.Equal(t, test.location, response.Header().Get("Location"))
+
+			// Named identifiers are matched regardless of case
+			response = httptest.NewRecorder()
+			a.router.ServeHTTP(response, httptest.NewRequest("GET", "/blobs/eth/v1/beacon/blob_sidecars/Head", nil))
+			require.Equal(t, 200, response.Code)
+
+			// Paths that would redirect to another host are unknown
+			response = httptest.NewRecorder()
+			a.router.ServeHTTP(response, httptest.NewRequest("GET", "//example.com/", nil))
+			require.Equal(t, 404, response.Code)
+		})
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+
+	serve := func(a *API, method, path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	cfg := flags.APIConfig{PathPrefix: "/blobs", AllowOrigin: "*"}
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	t.Run("routes under the prefix", func(t *testing.T) {
+		require.Equal(t, 200, serve(a, "GET", "/blobs/eth/v1/beacon/blob_sidecars/"+root.String()).Code)
+		require.Equal(t, 404, serve(a, "GET", "/eth/v1/beacon/blob_sidecars/"+root.String()).Code)
+		require.Equal(t, 404, serve(a, "GET", "/blobs/eth/v1/archiver/latest").Code)
+	})
+
+	t.Run("method not allowed under the prefix", func(t *testing.T) {
+		response := serve(a, "POST", "/blobs/eth/v1/beacon/blob_sidecars/head")
+		require.Equal(t, 405, response.Code)
+		require.Equal(t, "GET, OPTIONS", response.Header().Get("Allow"))
+
+		response = serve(a, "OPTIONS", "/blobs/eth/v1/beacon/blob_sidecars/head")
+		require.Equal(t, 204, response.Code)
+		require.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "GET, OPTIONS", response.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("health at the root by default", func(t *testing.T) {
+		require.Equal(t, 200, serve(a, "GET", "/healthz").Code)
+		require.Equal(t, 404, serve(a, "GET", "/blobs/healthz").Code)
+	})
+
+	t.Run("health under the prefix", func(t *testing.T) {
+		cfg.PrefixHealth = true
+		a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+		require.Equal(t, 200, serve(a, "GET", "/blobs/healthz").Code)
+		require.Equal(t, 404, serve(a, "GET", "/healthz").Code)
+	})
+}
+
+func TestPreloadLink(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+
+	beaconClient := beacontest.NewEmptyStubBeaconClient()
+	beaconClient.Headers["1234"] = &v1.BeaconBlockHeader{Root: phase0.Root(root)}
+
+	serve := func(a *API, path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+
+	tests := []struct {
+		name     string
+		route    string
+		expected string
+	}{
+		{name: "disabled"},
+		{name: "header", route: flags.RouteHeader, expected: "/blobs/eth/v1/archiver/header/" + root.String()},
+		{name: "blob availability", route: flags.RouteBlobAvailability, expected: "/blobs/eth/v1/archiver/blob_availability/" + root.String()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := flags.APIConfig{PathPrefix: "/blobs", PreloadLink: test.route, SidecarCacheSize: 1}
+			a := NewAPI(fs, beaconClient, cfg, metrics.NewMetrics(), logger)
+
+			// Blocks requested by slot are linked by hash, also when served from the cache
+			for _, id := range []string{root.String(), "1234", root.String()} {
+				response := serve(a, "/blobs/eth/v1/beacon/blob_sidecars/"+id)
+				require.Equal(t, 200, response.Code)
+
+				if test.expected == "" {
+					require.Empty(t, response.Header().Get("Link"))
+					continue
+				}
+				require.Equal(t, "<"+test.expected+">; rel=preload; as=fetch", response.Header().Get("Link"))
+				require.Equal(t, 200, serve(a, test.expected).Code)
+			}
+
+			// Blocks that aren't found aren't linked
+			response := serve(a, "/blobs/eth/v1/beacon/blob_sidecars/"+common.Hash{1}.String())
+			require.Equal(t, 404, response.Code)
+			require.Empty(t, response.Header().Get("Link"))
+		})
+	}
+}
+
+// blockingStorage blocks every read until unblock is closed, reporting each read as it starts.
+type blockingStorage struct {
+	storage.DataStoreReader
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (s *blockingStorage) Read(ctx context.Context, hash common.Hash) (storage.BlobData, error) {
+	s.started <- struct{}{}
+	<-s.unblock
+	return s.DataStoreReader.Read(ctx, hash)
+}
+
+func TestStorageReadConcurrencyLimit(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	store := &blockingStorage{DataStoreReader: fs, started: make(chan struct{}, 3), unblock: make(chan struct{})}
+	m := metrics.NewMetrics()
+	a := NewAPI(store, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{
+		StorageRead: flags.StorageReadConfig{
+			Concurrency:  1,
+			QueueSize:    1,
+			QueueTimeout: time.Minute,
+		},
+	}, m, logger)
+
+	root := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+
+	get := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 2)
+	for i := range responses {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = get()
+		}()
+	}
+
+	// One read is in flight, the other request waits in the queue
+	<-store.started
+	require.Eventually(t, func() bool {
+		return metricValue(t, m, "blob_api_storage_reads_queued") == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_api_storage_reads_in_flight"))
+
+	// The queue is full, so further requests are shed
+	shed := get()
+	require.Equal(t, 503, shed.Code)
+	require.Equal(t, "1", shed.Header().Get("Retry-After"))
+	require.Equal(t, float64(1), metricValue(t, m, "blob_api_storage_reads_shed"))
+
+	close(store.unblock)
+	wg.Wait()
+
+	for _, response := range responses {
+		require.Equal(t, 200, response.Code)
+	}
+	require.Len(t, store.started, 1)
+	require.Equal(t, float64(0), metricValue(t, m, "blob_api_storage_reads_in_flight"))
+	require.Equal(t, float64(0), metricValue(t, m, "blob_api_storage_reads_queued"))
+}
+
+func TestStorageReadQueueTimeout(t *testing.T) {
+	limiter := newReadLimiter(1, 1, 20*time.Millisecond, metrics.NewMetrics())
+
+	release, err := limiter.acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = limiter.acquire(context.Background())
+	require.ErrorIs(t, err, errReadsOverloaded)
+
+	release()
+	release, err = limiter.acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func metricValue(t *testing.T, m metrics.Metricer, name string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		total := float64(0)
+		for _, metric := range family.GetMetric() {
+			total += metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+		}
+		return total
+	}
+
+	return 0
+}
+
+func TestResponseEncoding(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	root := common.Hash{1}
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+
+	for _, accept := range []string{jsonAcceptType, sszAcceptType, cborAcceptType} {
+		get := func(acceptEncoding string) *httptest.ResponseRecorder {
+			request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), nil)
+			request.Header.Set("Accept", accept)
+			request.Header.Set("Accept-Encoding", acceptEncoding)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, 200, response.Code)
+			return response
+		}
+
+		plain := get("")
+		require.Empty(t, plain.Header().Get("Content-Encoding"))
+
+		t.Run(accept+"-zstd accepted", func(t *testing.T) {
+			for _, acceptEncoding := range []string{"zstd", "gzip, zstd"} {
+				response := get(acceptEncoding)
+				require.Equal(t, "zstd", response.Header().Get("Content-Encoding"))
+
+				reader, err := zstd.NewReader(response.Body)
+				require.NoError(t, err)
+				decoded, err := io.ReadAll(reader)
+				reader.Close()
+				require.NoError(t, err)
+				require.Equal(t, plain.Body.Bytes(), decoded)
+			}
+		})
+
+		t.Run(accept+"-zstd not accepted", func(t *testing.T) {
+			response := get("gzip")
+			require.Equal(t, "gzip", response.Header().Get("Content-Encoding"))
+
+			reader, err := gzip.NewReader(response.Body)
+			require.NoError(t, err)
+			decoded, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, plain.Body.Bytes(), decoded)
+		})
+	}
+}
+
+func TestCBORResponse(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	root := common.Hash{1}
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 3)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+
+	for _, test := range []struct {
+		indices  string
+		expected []*deneb.BlobSidecar
+	}{
+		{indices: "", expected: data.BlobSidecars.Data},
+		{indices: "2,0", expected: []*deneb.BlobSidecar{data.BlobSidecars.Data[2], data.BlobSidecars.Data[0]}},
+	} {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=%s", root, test.indices), nil)
+		request.Header.Set("Accept", cborAcceptType)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 200, response.Code)
+		require.Equal(t, cborAcceptType, response.Header().Get("Content-Type"))
+
+		var decoded storage.BlobSidecars
+		require.NoError(t, cbor.Unmarshal(response.Body.Bytes(), &decoded))
+		require.Equal(t, test.expected, decoded.Data)
+	}
+}
+
+func TestDefaultContentType(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root, overridden := common.Hash{1}, common.Hash{2}
+	for _, hash := range []common.Hash{root, overridden} {
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+		}))
+	}
+
+	// Both the responses encoded from storage and those of the sidecar cache negotiate the content type
+	for _, cacheSize := range []int{0, 10} {
+		a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{
+			ContentType: flags.ContentTypeConfig{
+				Default: flags.ContentTypeJSON,
+				Overrides: []string{
+					"key:binary-client=ssz",
+					fmt.Sprintf("path:/eth/v1/beacon/blob_sidecars/%s=ssz", overridden),
+					"key:json-client=json",
+				},
+				KeyHeader: "X-Api-Key",
+			},
+			PathPrefix:       "/blobs",
+			SidecarCacheSize: cacheSize,
+		}, metrics.NewMetrics(), logger)
+
+		get := func(hash common.Hash, accept string, apiKey string) string {
+			request := httptest.NewRequest("GET", fmt.Sprintf("/blobs/eth/v1/beacon/blob_sidecars/%s", hash), nil)
+			if accept != "" {
+				request.Header.Set("Accept", accept)
+			}
+			if apiKey != "" {
+				request.Header.Set("X-Api-Key", apiKey)
+			}
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, 200, response.Code)
+			return response.Header().Get("Content-Type")
+		}
+
+		// Requests without an Accept header, or accepting any type, get the default content type
+		require.Equal(t, jsonAcceptType, get(root, "", ""))
+		require.Equal(t, jsonAcceptType, get(root, "*/*", ""))
+
+		// Unless an override applies, by path under the path prefix, or by API key, which takes precedence
+		require.Equal(t, sszAcceptType, get(overridden, "", ""))
+		require.Equal(t, sszAcceptType, get(overridden, "*/*", ""))
+		require.Equal(t, jsonAcceptType, get(overridden, "", "json-client"))
+		require.Equal(t, sszAcceptType, get(root, "*/*", "binary-client"))
+		require.Equal(t, jsonAcceptType, get(root, "", "other-client"))
+
+		// Requests accepting a type get it regardless of the overrides
+		require.Equal(t, jsonAcceptType, get(overridden, jsonAcceptType, "binary-client"))
+		require.Equal(t, cborAcceptType, get(overridden, cborAcceptType, ""))
+	}
+}
+
+func TestDefaultContentTypeSSZ(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.Hash{1}
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{
+		ContentType: flags.ContentTypeConfig{Default: flags.ContentTypeSSZ},
+	}, metrics.NewMetrics(), logger)
+
+	for _, accept := range []string{"", "*/*"} {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), nil)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+
+		require.Equal(t, 200, response.Code)
+		require.Equal(t, sszAcceptType, response.Header().Get("Content-Type"))
+
+		var decoded api.BlobSidecars
+		require.NoError(t, decoded.UnmarshalSSZ(response.Body.Bytes()))
+		require.Equal(t, data.BlobSidecars.Data, decoded.Sidecars)
+	}
+}
+
+func TestContentTypeConfig(t *testing.T) {
+	for _, test := range []struct {
+		override string
+		valid    bool
+	}{
+		{override: "path:/eth/v1/beacon/blob_sidecars=ssz", valid: true},
+		{override: "key:abc=json", valid: true},
+		{override: "path:eth/v1=ssz", valid: false},
+		{override: "key:abc=cbor", valid: false},
+		{override: "key:=ssz", valid: false},
+		{override: "user:abc=ssz", valid: false},
+		{override: "path:/eth/v1", valid: false},
+	} {
+		cfg := flags.ContentTypeConfig{Default: flags.ContentTypeJSON, Overrides: []string{test.override}, KeyHeader: "X-Api-Key"}
+		if test.valid {
+			require.NoError(t, cfg.Check(), test.override)
+		} else {
+			require.Error(t, cfg.Check(), test.override)
+		}
+	}
+
+	require.Error(t, flags.ContentTypeConfig{Default: "xml"}.Check())
+	require.Error(t, flags.ContentTypeConfig{Default: flags.ContentTypeSSZ, Overrides: []string{"key:abc=json"}}.Check())
+}
+
+func TestHeadMaxAge(t *testing.T) {
+	a, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+
+	a.cfg.HeadMaxAge = time.Minute
+	a.cfg.StaleHeadAction = flags.StaleHeadActionReject
+
+	root := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+
+	header := &v1.BeaconBlockHeader{
+		Root: phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: 100},
+		},
+	}
+	beaconClient.Headers["head"] = header
+	beaconClient.Headers["finalized"] = header
+
+	get := func(id string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+id, nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	// With 12 second slots, slot 100 started 20 minutes after genesis
+	beaconClient.GenesisTime = time.Unix(1606824023, 0)
+	clock := beacontest.NewFakeClock(beaconClient.GenesisTime)
+	a.clock = clock
+	a.initSlotClock(context.Background())
+	setHeadAge := func(age time.Duration) {
+		clock.Set(beaconClient.GenesisTime.Add(100*12*time.Second + age))
+	}
+
+	t.Run("fresh head", func(t *testing.T) {
+		setHeadAge(10 * time.Second)
+		require.Equal(t, 200, get("head").Code)
+	})
+
+	t.Run("stale head is rejected", func(t *testing.T) {
+		setHeadAge(10 * time.Minute)
+
+		response := get("head")
+		require.Equal(t, 503, response.Code)
+
+		var e httpError
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &e))
+		require.Equal(t, errStaleHead.Message, e.Message)
+	})
+
+	t.Run("finalized is not checked", func(t *testing.T) {
+		setHeadAge(10 * time.Minute)
+		require.Equal(t, 200, get("finalized").Code)
+	})
+
+	t.Run("stale head is served with warn action", func(t *testing.T) {
+		setHeadAge(10 * time.Minute)
+		a.cfg.StaleHeadAction = flags.StaleHeadActionWarn
+		defer func() { a.cfg.StaleHeadAction = flags.StaleHeadActionReject }()
+
+		require.Equal(t, 200, get("head").Code)
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	a, fs, beaconClient, cleanup := setup(t)
+	defer cleanup()
+
+	a.cfg.CacheControl = flags.CacheControlConfig{
+		Hash:      24 * time.Hour,
+		Finalized: time.Minute,
+		Slot:      12 * time.Second,
+	}
+
+	root := common.Hash{1}
+	require.NoError(t, storage.WriteWithSlotIndex(context.Background(), fs, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root, Slot: 100},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+
+	header := &v1.BeaconBlockHeader{
+		Root: phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{Slot: 100},
+		},
+	}
+	beaconClient.Headers["head"] = header
+	beaconClient.Headers["finalized"] = header
+	beaconClient.Headers["genesis"] = header
+	beaconClient.Headers["200"] = header
+
+	tests := []struct {
+		name         string
+		id           string
+		code         int
+		cacheControl string
+	}{
+		{
+			name:         "hash",
+			id:           root.String(),
+			code:         200,
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "genesis",
+			id:           "genesis",
+			code:         200,
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "finalized",
+			id:           "finalized",
+			code:         200,
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "slot that is not finalized",
+			id:           "200",
+			code:         200,
+			cacheControl: "public, max-age=12",
+		},
+		{
+			name:         "slot resolved through the slot index",
+			id:           "100",
+			code:         200,
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "head",
+			id:           "head",
+			code:         200,
+			cacheControl: "no-cache",
+		},
+		{
+			name:         "unknown block",
+			id:           common.Hash{2}.String(),
+			code:         404,
+			cacheControl: "no-cache",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The second request is served from the sidecar cache
+			a.sidecarCache = newSidecarCache(1, a.metrics)
+			for i := 0; i < 2; i++ {
+				request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+test.id, nil)
+				response := httptest.NewRecorder()
+				a.router.ServeHTTP(response, request)
+
+				require.Equal(t, test.code, response.Code)
+				require.Equal(t, test.cacheControl, response.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestSidecarCacheSkipsIncompleteBlocks(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: 1}, metrics.NewMetrics(), logger)
+
+	root := common.Hash{1}
+	sidecars := blobtest.NewBlobSidecars(t, 3)
+	write := func(sidecars []*deneb.BlobSidecar) {
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root, Commitments: 3},
+			BlobSidecars: storage.BlobSidecars{Data: sidecars},
+		}))
+	}
+	get := func() storage.BlobSidecars {
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+root.String(), nil))
+		require.Equal(t, 200, response.Code)
+
+		var served storage.BlobSidecars
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &served))
+		return served
+	}
+
+	// The block is archived without its last sidecar, and later re-archived with all of them
+	write(sidecars[:2])
+	require.Len(t, get().Data, 2)
+
+	write(sidecars)
+	require.Equal(t, sidecars, get().Data)
+
+	// Once complete, the block is cached
+	require.NoError(t, fs.Delete(context.Background(), root))
+	require.Equal(t, sidecars, get().Data)
+}
+
+func TestSidecarCache(t *testing.T) {
+	uncached, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	m := metrics.NewMetrics()
+	cached := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: 1}, m, testlog.Logger(t, log.LvlInfo))
+
+	blocks := []storage.BlobData{
+		{Header: storage.Header{BeaconBlockHash: common.Hash{1}}, BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 4)}},
+		{Header: storage.Header{BeaconBlockHash: common.Hash{2}}, BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 0)}},
+	}
+	for _, block := range blocks {
+		require.NoError(t, fs.Write(context.Background(), block))
+	}
+
+	get := func(a *API, root common.Hash, indices string, accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=%s", root, indices), nil)
+		request.Header.Set("Accept", accept)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	for _, block := range blocks {
+		root := block.Header.BeaconBlockHash
+		for _, accept := range []string{jsonAcceptType, sszAcceptType, cborAcceptType} {
+			for _, indices := range []string{"", "0", "3", "1,2", "2,1,2", "3,0,2,1", "0,1,2,3", "4", "x"} {
+				expected := get(uncached, root, indices, accept)
+				actual := get(cached, root, indices, accept)
+
+				require.Equal(t, expected.Code, actual.Code, "indices %s", indices)
+				require.Equal(t, expected.Header().Get("Content-Type"), actual.Header().Get("Content-Type"))
+				require.Equal(t, expected.Body.Bytes(), actual.Body.Bytes(), "indices %s", indices)
+			}
+		}
+	}
+
+	// Only the first request for each block missed the cache
+	require.Equal(t, float64(2*9*3), metricValue(t, m, "blob_api_sidecar_cache_requests"))
+	hits := float64(0)
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "blob_api_sidecar_cache_requests" {
+			for _, metric := range family.GetMetric() {
+				if metric.GetLabel()[0].GetValue() == "hit" {
+					hits += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	require.Equal(t, float64(2*9*3-2), hits)
+
+	// The cached block is served without reading storage, the evicted one is not
+	require.NoError(t, fs.Delete(context.Background(), common.Hash{1}))
+	require.NoError(t, fs.Delete(context.Background(), common.Hash{2}))
+	require.Equal(t, 200, get(cached, common.Hash{2}, "", jsonAcceptType).Code)
+	require.Equal(t, 404, get(cached, common.Hash{1}, "", jsonAcceptType).Code)
+}
+
+// labeledMetricValue returns the value of the metric with the given label value.
+func labeledMetricValue(t *testing.T, m metrics.Metricer, name string, value string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == value {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestSidecarCacheEffectiveness(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	m := metrics.NewMetrics()
+	a := NewAPI(fs, beacon, flags.APIConfig{SidecarCacheSize: 1}, m, logger)
+
+	one, two := common.Hash{1}, common.Hash{2}
+	for _, root := range []common.Hash{one, two} {
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+		}))
+	}
+	beacon.Headers["head"] = &v1.BeaconBlockHeader{
+		Root:   phase0.Root(one),
+		Header: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{}},
+	}
+
+	type counts struct {
+		hits, misses, evictions float64
+		cached, backend         float64
+		ratio                   float64
+	}
+	for i, step := range []struct {
+		id       string
+		expected counts
+	}{
+		{id: one.String(), expected: counts{misses: 1, backend: 1}},
+		{id: one.String(), expected: counts{hits: 1, misses: 1, cached: 1, backend: 1, ratio: 0.5}},
+		// The cached block is resolved by the beacon node, so the response isn't served from the cache alone
+		{id: "head", expected: counts{hits: 2, misses: 1, cached: 1, backend: 2, ratio: 2.0 / 3}},
+		{id: two.String(), expected: counts{hits: 2, misses: 2, evictions: 1, cached: 1, backend: 3, ratio: 0.5}},
+		{id: one.String(), expected: counts{hits: 2, misses: 3, evictions: 2, cached: 1, backend: 4, ratio: 0.4}},
+		{id: one.String(), expected: counts{hits: 3, misses: 3, evictions: 2, cached: 2, backend: 4, ratio: 0.5}},
+	} {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+step.id, nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		require.Equal(t, 200, response.Code)
+
+		actual := counts{
+			hits:      labeledMetricValue(t, m, "blob_api_sidecar_cache_requests", "hit"),
+			misses:    labeledMetricValue(t, m, "blob_api_sidecar_cache_requests", "miss"),
+			evictions: metricValue(t, m, "blob_api_sidecar_cache_evictions"),
+			cached:    labeledMetricValue(t, m, "blob_api_sidecar_responses", "cache"),
+			backend:   labeledMetricValue(t, m, "blob_api_sidecar_responses", "backend"),
+			ratio:     metricValue(t, m, "blob_api_sidecar_cache_hit_ratio"),
+		}
+		require.InDelta(t, step.expected.ratio, actual.ratio, 1e-9, "step %d", i)
+		actual.ratio = step.expected.ratio
+		require.Equal(t, step.expected, actual, "step %d", i)
+	}
+
+	stats, ratio := a.sidecarCache.snapshot()
+	require.Equal(t, sidecarCacheStats{Hits: 3, Misses: 3, Evictions: 2, Responses: 6, Cached: 2}, stats)
+	require.Equal(t, 0.5, ratio)
+}
+
+func BenchmarkFilteredSidecars(b *testing.B) {
+	for _, cacheSize := range []int{0, 1} {
+		b.Run(fmt.Sprintf("cache size %d", cacheSize), func(b *testing.B) {
+			logger := testlog.Logger(b, log.LvlError)
+			fs := storage.NewFileStorage(b.TempDir(), logger)
+			a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: cacheSize}, metrics.NewMetrics(), logger)
+
+			root := common.Hash{1}
+			sidecars := make([]*deneb.BlobSidecar, 0, 9)
+			for i := 0; i < 9; i++ {
+				sidecars = append(sidecars, &deneb.BlobSidecar{
+					Index:             deneb.BlobIndex(i),
+					SignedBlockHeader: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{}},
+				})
+			}
+			require.NoError(b, fs.Write(context.Background(), storage.BlobData{
+				Header:       storage.Header{BeaconBlockHash: root},
+				BlobSidecars: storage.BlobSidecars{Data: sidecars},
+			}))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=%d", root, i%9), nil)
+				response := httptest.NewRecorder()
+				a.router.ServeHTTP(response, request)
+				if response.Code != 200 {
+					b.Fatalf("unexpected status %d", response.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.APIConfig{RequestLimits: flags.RequestLimitsConfig{MaxBodyBytes: 1024}}
+	a := NewAPI(storage.NewFileStorage(t.TempDir(), logger), beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	tests := []struct {
+		name string
+		size int
+		code int
+	}{
+		{name: "within limit", size: 1024, code: 405},
+		{name: "too large", size: 1025, code: 413},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := strings.NewReader(strings.Repeat("a", test.size))
+			request := httptest.NewRequest("POST", "/eth/v1/beacon/blob_sidecars/head", body)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, test.code, response.Code)
+		})
+	}
+
+	// Bodies of unknown length can't be read beyond the limit
+	handler := limitRequestBody(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		require.ErrorAs(t, err, &maxBytesErr)
+	}))
+	request := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader(strings.Repeat("a", 2048))))
+	request.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func TestRequestURLLimit(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.APIConfig{RequestLimits: flags.RequestLimitsConfig{MaxURLBytes: 100}}
+	a := NewAPI(storage.NewFileStorage(t.TempDir(), logger), beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	path := "/eth/v1/beacon/blob_sidecars/head?indices="
+	tests := []struct {
+		name string
+		url  string
+		code int
+	}{
+		{name: "within limit", url: path + strings.Repeat("0,", (100-len(path))/2), code: 404},
+		{name: "too long", url: path + strings.Repeat("0,", (100-len(path))/2+1), code: 414},
+		{name: "long path", url: "/" + strings.Repeat("a", 100), code: 414},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.url, nil)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, test.code, response.Code)
+		})
+	}
+}
+
+func TestRequestIndicesLimit(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+
+	root := common.Hash{1}
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 4)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+
+	tests := []struct {
+		name       string
+		indices    string
+		code       int
+		expected   []*deneb.BlobSidecar
+		errMessage string
+	}{
+		{name: "within limit", indices: "3,1,2", code: 200, expected: []*deneb.BlobSidecar{data.BlobSidecars.Data[3], data.BlobSidecars.Data[1], data.BlobSidecars.Data[2]}},
+		{name: "exceeds limit", indices: "0,1,2,3", code: 400, errMessage: "too many indices: 4 given, at most 3 accepted"},
+		{name: "duplicates count against limit", indices: "1,1,1,1", code: 400, errMessage: "too many indices: 4 given, at most 3 accepted"},
+		{name: "duplicates are removed", indices: "2,0,2", code: 200, expected: []*deneb.BlobSidecar{data.BlobSidecars.Data[2], data.BlobSidecars.Data[0]}},
+		{name: "invalid values beyond limit are not parsed", indices: "0,1,2,x", code: 400, errMessage: "too many indices: 4 given, at most 3 accepted"},
+	}
+
+	// The cache filters the sidecars separately
+	for _, cacheSize := range []int{0, 10} {
+		cfg := flags.APIConfig{
+			RequestLimits:    flags.RequestLimitsConfig{MaxIndices: 3},
+			SidecarCacheSize: cacheSize,
+		}
+		a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s-cache-%d", test.name, cacheSize), func(t *testing.T) {
+				request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=%s", root, test.indices), nil)
+				response := httptest.NewRecorder()
+				a.router.ServeHTTP(response, request)
+				require.Equal(t, test.code, response.Code)
+
+				if test.code != 200 {
+					var apiErr httpError
+					require.NoError(t, json.Unmarshal(response.Body.Bytes(), &apiErr))
+					require.Equal(t, test.errMessage, apiErr.Message)
+					return
+				}
+
+				var res storage.BlobSidecars
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+				require.Equal(t, test.expected, res.Data)
+			})
+		}
+	}
+}
+
+func TestRequestHeaderLimit(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.APIConfig{
+		ListenAddr:    "127.0.0.1:0",
+		RequestLimits: flags.RequestLimitsConfig{MaxHeaderBytes: 1024},
+	}
+	a := NewAPI(storage.NewFileStorage(t.TempDir(), logger), beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+	svc := NewService(logger, a, cfg, nil)
+	require.NoError(t, svc.Start(context.Background()))
+	defer func() {
+		require.NoError(t, svc.Stop(context.Background()))
+	}()
+
+	get := func(header string) int {
+		request, err := http.NewRequest("GET", "http://"+svc.apiAddr.String()+"/healthz", nil)
+		require.NoError(t, err)
+		request.Header.Set("X-Padding", header)
+
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		return response.StatusCode
+	}
+
+	require.Equal(t, 200, get("small"))
+	// net/http allows some slack beyond the configured limit
+	require.Equal(t, 431, get(strings.Repeat("a", 64<<10)))
+}
+
+func TestSSZMarshalMetrics(t *testing.T) {
+	for _, cacheSize := range []int{0, 1} {
+		logger := testlog.Logger(t, log.LvlInfo)
+		fs := storage.NewFileStorage(t.TempDir(), logger)
+		m := metrics.NewMetrics()
+		a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: cacheSize}, m, logger)
+
+		root := common.Hash{1}
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+		}))
+
+		marshals := func() uint64 {
+			families, err := m.Registry().Gather()
+			require.NoError(t, err)
+
+			for _, family := range families {
+				if family.GetName() != "blob_api_ssz_duration_seconds" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					if metric.GetLabel()[0].GetValue() == string(storage.SSZMarshal) {
+						return metric.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+			return 0
+		}
+
+		// JSON responses aren't marshaled to SSZ, and requests after the first are served from the cache, if there is one
+		for i, accept := range []string{sszAcceptType, jsonAcceptType, sszAcceptType} {
+			request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+root.String(), nil)
+			request.Header.Set("Accept", accept)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, 200, response.Code)
+			require.Equal(t, uint64(1+i/2), marshals(), "cache size %d, request %d", cacheSize, i)
+		}
+	}
+}
+
+func TestFinalizedResolutionTTL(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	a := NewAPI(fs, beacon, flags.APIConfig{FinalizedResolutionTTL: 36 * time.Second}, metrics.NewMetrics(), logger)
+	clock := beacontest.NewFakeClock(time.Unix(1606824023, 0))
+	a.clock = clock
+
+	headers := map[int]*v1.BeaconBlockHeader{}
+	for _, blobs := range []int{1, 2} {
+		root := common.Hash{byte(blobs)}
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, uint(blobs))},
+		}))
+		headers[blobs] = &v1.BeaconBlockHeader{
+			Root:   phase0.Root(root),
+			Header: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{}},
+		}
+	}
+
+	// finalizedBlobs returns the number of blobs of the block finalized resolves to
+	finalizedBlobs := func() int {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/finalized", nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		require.Equal(t, 200, response.Code)
+
+		var body struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		return len(body.Data)
+	}
+
+	beacon.Headers["finalized"] = headers[1]
+	require.Equal(t, 1, finalizedBlobs())
+
+	// Finality advanced, but the previous resolution is reused until the TTL elapsed
+	beacon.Headers["finalized"] = headers[2]
+	clock.Advance(35 * time.Second)
+	require.Equal(t, 1, finalizedBlobs())
+
+	clock.Advance(time.Second)
+	require.Equal(t, 2, finalizedBlobs())
+
+	// Without a TTL, finalized is resolved on every request
+	a.finalizedCache = newFinalizedCache(0)
+	beacon.Headers["finalized"] = headers[1]
+	require.Equal(t, 1, finalizedBlobs())
+}
+
+func TestAssemblePartials(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+
+	root := common.Hash{1}
+	header := storage.Header{BeaconBlockHash: root}
+	sidecars := blobtest.NewBlobSidecars(t, 3)
+	for _, partial := range [][]*deneb.BlobSidecar{sidecars[:2], sidecars[1:]} {
+		require.NoError(t, fs.WritePartial(context.Background(), storage.BlobData{
+			Header:       header,
+			BlobSidecars: storage.BlobSidecars{Data: partial},
+		}))
+	}
+
+	fetch := func(a *API) (int, storage.BlobSidecars) {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", root), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+
+		var body storage.BlobSidecars
+		if response.Code == 200 {
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		}
+		return response.Code, body
+	}
+
+	// Partial blob data is only served when partials are assembled
+	code, _ := fetch(NewAPI(fs, beacon, flags.APIConfig{}, metrics.NewMetrics(), logger))
+	require.Equal(t, 404, code)
+
+	code, body := fetch(NewAPI(fs, beacon, flags.APIConfig{AssemblePartials: true}, metrics.NewMetrics(), logger))
+	require.Equal(t, 200, code)
+	require.Equal(t, storage.BlobSidecars{Data: sidecars}, body)
+}
+
+func TestAssemblePartialsWithGaps(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{AssemblePartials: true}, metrics.NewMetrics(), logger)
+
+	// Only the sidecars 0 and 3 of the blocks are stored, of 6 commitments if they are known
+	sidecars := blobtest.NewBlobSidecars(t, 4)
+	gapped := []*deneb.BlobSidecar{sidecars[0], sidecars[3]}
+	withCommitments, withoutCommitments := common.Hash{1}, common.Hash{2}
+	for _, header := range []storage.Header{{BeaconBlockHash: withCommitments, Commitments: 6}, {BeaconBlockHash: withoutCommitments}} {
+		for _, sidecar := range gapped {
+			require.NoError(t, fs.WritePartial(context.Background(), storage.BlobData{
+				Header:       header,
+				BlobSidecars: storage.BlobSidecars{Data: []*deneb.BlobSidecar{sidecar}},
+			}))
+		}
+	}
+
+	fetch := func(root common.Hash, indices string) (int, []*deneb.BlobSidecar) {
+		request := httptest.NewRequest("GET", fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s?indices=%s", root, indices), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+
+		var body storage.BlobSidecars
+		if response.Code == 200 {
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		}
+		return response.Code, body.Data
+	}
+
+	tests := []struct {
+		root     common.Hash
+		indices  string
+		code     int
+		expected []*deneb.BlobSidecar
+	}{
+		{root: withCommitments, indices: "3", code: 200, expected: []*deneb.BlobSidecar{sidecars[3]}},
+		{root: withCommitments, indices: "3,1,0", code: 200, expected: []*deneb.BlobSidecar{sidecars[3], sidecars[0]}},
+		{root: withCommitments, indices: "5", code: 200, expected: []*deneb.BlobSidecar{}},
+		{root: withCommitments, indices: "6", code: 400},
+		{root: withoutCommitments, indices: "3", code: 200, expected: []*deneb.BlobSidecar{sidecars[3]}},
+		{root: withoutCommitments, indices: "2", code: 200, expected: []*deneb.BlobSidecar{}},
+		{root: withoutCommitments, indices: "4", code: 400},
+	}
+
+	for _, test := range tests {
+		code, data := fetch(test.root, test.indices)
+		require.Equal(t, test.code, code, "%s %s", test.root, test.indices)
+		require.Equal(t, test.expected, data, "%s %s", test.root, test.indices)
+	}
+}
+
+// largestWriteRecorder records the size of the largest single write of the response body.
+type largestWriteRecorder struct {
+	*httptest.ResponseRecorder
+	largest int
+}
+
+func (r *largestWriteRecorder) Write(b []byte) (int, error) {
+	r.largest = max(r.largest, len(b))
+	return r.ResponseRecorder.Write(b)
+}
+
+func TestStreamingSSZResponse(t *testing.T) {
+	const count = 32
+
+	for _, cacheSize := range []int{0, 1} {
+		logger := testlog.Logger(t, log.LvlInfo)
+		fs := storage.NewFileStorage(t.TempDir(), logger)
+		a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: cacheSize}, metrics.NewMetrics(), logger)
+
+		root := common.Hash{1}
+		sidecars := storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, count)}
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: root},
+			BlobSidecars: sidecars,
+		}))
+
+		sidecarSize := sidecars.SizeSSZ() / count
+
+		// Responses served from storage and from the cache are both streamed
+		for i := 0; i < 2; i++ {
+			request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+root.String(), nil)
+			request.Header.Set("Accept", sszAcceptType)
+			response := &largestWriteRecorder{ResponseRecorder: httptest.NewRecorder()}
+			a.router.ServeHTTP(response, request)
+			require.Equal(t, 200, response.Code)
+
+			// The payload is written no more than a sidecar at a time
+			require.LessOrEqual(t, response.largest, sidecarSize, "cache size %d, request %d", cacheSize, i)
+			require.Equal(t, sidecars.SizeSSZ(), response.Body.Len())
+
+			// Each sidecar can be decoded as it is received, without reading the rest of the response
+			for _, expected := range sidecars.Data {
+				encoded, err := io.ReadAll(io.LimitReader(response.Body, int64(sidecarSize)))
+				require.NoError(t, err)
+
+				var sidecar deneb.BlobSidecar
+				require.NoError(t, sidecar.UnmarshalSSZ(encoded))
+				require.Equal(t, expected, &sidecar)
+			}
+			require.Zero(t, response.Body.Len())
+		}
+	}
+}
+
+func TestRequestPhaseMetrics(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	m := metrics.NewMetrics()
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{SidecarCacheSize: 1}, m, logger)
+
+	root := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+
+	samples := func() map[string]uint64 {
+		families, err := m.Registry().Gather()
+		require.NoError(t, err)
+
+		counts := make(map[string]uint64)
+		for _, family := range families {
+			if family.GetName() != "blob_api_request_phase_duration_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				counts[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+		return counts
+	}
+
+	get := func(id string) int {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+id, nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	require.Equal(t, 200, get(root.String()))
+	require.Equal(t, map[string]uint64{"resolve": 1, "read": 1, "serialize": 1}, samples())
+
+	// Responses served from the sidecar cache are timed too
+	require.Equal(t, 200, get(root.String()))
+	require.Equal(t, map[string]uint64{"resolve": 2, "read": 2, "serialize": 2}, samples())
+
+	// Only the phases a failed request completed are recorded
+	require.Equal(t, 404, get(common.Hash{2}.String()))
+	require.Equal(t, map[string]uint64{"resolve": 3, "read": 2, "serialize": 2}, samples())
+}
+
+func TestRateLimits(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	root := common.HexToHash("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root, Slot: 5},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+	require.NoError(t, fs.WriteLatest(context.Background(), storage.Header{BeaconBlockHash: root, Slot: 5}))
+
+	beacon := beacontest.NewEmptyStubBeaconClient()
+	beacon.Headers["5"] = &v1.BeaconBlockHeader{
+		Root:   phase0.Root(root),
+		Header: &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: 5}},
+	}
+
+	m := metrics.NewMetrics()
+	a := NewAPI(fs, beacon, flags.APIConfig{
+		RateLimits: flags.RateLimitsConfig{
+			Rules: []string{
+				"blob_sidecars_hash+blob_sidecars_slot=1:2:ip",
+				"header=1:1:api-key",
+				"*=1000:1000",
+			},
+			KeyHeader:  "X-Api-Key",
+			MaxClients: 10,
+		},
+	}, m, logger)
+	clock := beacontest.NewFakeClock(time.Unix(1606824023, 0))
+	a.clock = clock
+
+	get := func(path string, ip string, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			request.Header.Set("X-Api-Key", apiKey)
+		}
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	hashPath := "/eth/v1/beacon/blob_sidecars/" + root.String()
+	slotPath := "/eth/v1/beacon/blob_sidecars/5"
+
+	// Lookups by hash and by slot share a bucket of 2 requests per client IP
+	require.Equal(t, 200, get(hashPath, "10.0.0.1", "").Code)
+	require.Equal(t, 200, get(slotPath, "10.0.0.1", "").Code)
+	limited := get(hashPath, "10.0.0.1", "")
+	require.Equal(t, 429, limited.Code)
+	require.Equal(t, "1", limited.Header().Get("Retry-After"))
+	require.Equal(t, "no-cache", limited.Header().Get("Cache-Control"))
+	require.Equal(t, 429, get(slotPath, "10.0.0.1", "").Code)
+
+	// Other clients, and routes without their own limit, aren't affected
+	require.Equal(t, 200, get(hashPath, "10.0.0.2", "").Code)
+	require.Equal(t, 200, get("/eth/v1/archiver/latest", "10.0.0.1", "").Code)
+	require.Equal(t, 200, get("/eth/v1/archiver/blob_availability/"+root.String(), "10.0.0.1", "").Code)
+
+	// The bucket refills at the rate of the limit
+	clock.Advance(time.Second)
+	require.Equal(t, 200, get(hashPath, "10.0.0.1", "").Code)
+	require.Equal(t, 429, get(hashPath, "10.0.0.1", "").Code)
+
+	// Limits keyed by API key count the requests of each key, and of clients without one by IP
+	headerPath := "/eth/v1/archiver/header/" + root.String()
+	require.Equal(t, 200, get(headerPath, "10.0.0.1", "a").Code)
+	require.Equal(t, 429, get(headerPath, "10.0.0.2", "a").Code)
+	require.Equal(t, 200, get(headerPath, "10.0.0.1", "b").Code)
+	require.Equal(t, 200, get(headerPath, "10.0.0.1", "").Code)
+	require.Equal(t, 429, get(headerPath, "10.0.0.1", "").Code)
+
+	require.Equal(t, float64(5), metricValue(t, m, "blob_api_rate_limited_requests"))
+}
+
+func TestRateLimitGlobal(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+	a := NewAPI(storage.NewFileStorage(t.TempDir(), logger), beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{
+		RateLimits: flags.RateLimitsConfig{Rules: []string{"*=0.5:1"}},
+	}, m, logger)
+	clock := beacontest.NewFakeClock(time.Unix(1606824023, 0))
+	a.clock = clock
+
+	get := func(path string, ip string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = ip + ":1234"
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	// All clients and routes share the bucket, including blob sidecars requests of invalid block ids
+	require.Equal(t, 400, get("/eth/v1/beacon/blob_sidecars/foo", "10.0.0.1").Code)
+	limited := get("/eth/v1/archiver/latest", "10.0.0.2")
+	require.Equal(t, 429, limited.Code)
+	require.Equal(t, "2", limited.Header().Get("Retry-After"))
+	require.Equal(t, 429, get("/eth/v1/beacon/blob_sidecars/foo", "10.0.0.3").Code)
+
+	// The health endpoint is never limited
+	require.Equal(t, 200, get("/healthz", "10.0.0.1").Code)
+
+	clock.Advance(2 * time.Second)
+	require.Equal(t, 404, get("/eth/v1/archiver/latest", "10.0.0.2").Code)
+	require.Equal(t, float64(2), metricValue(t, m, "blob_api_rate_limited_requests"))
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	for _, test := range []struct {
+		rule  string
+		valid bool
+	}{
+		{rule: "*=10:20", valid: true},
+		{rule: "blob_sidecars_slot+blob_sidecars_named=0.5:1:ip", valid: true},
+		{rule: "latest=1:1:api-key", valid: true},
+		{rule: "latest=1", valid: false},
+		{rule: "latest=0:1", valid: false},
+		{rule: "latest=1:0", valid: false},
+		{rule: "latest=1:1:user", valid: false},
+		{rule: "unknown=1:1", valid: false},
+		{rule: "1:1", valid: false},
+	} {
+		cfg := flags.RateLimitsConfig{Rules: []string{test.rule}, KeyHeader: "X-Api-Key", MaxClients: 1}
+		if test.valid {
+			require.NoError(t, cfg.Check(), test.rule)
+		} else {
+			require.Error(t, cfg.Check(), test.rule)
+		}
+	}
+
+	// Limits keyed by client need clients to be tracked
+	require.Error(t, flags.RateLimitsConfig{Rules: []string{"*=1:1:ip"}}.Check())
+	require.NoError(t, flags.RateLimitsConfig{Rules: []string{"*=1:1"}}.Check())
+}
+
+func TestRateLimitMaxClients(t *testing.T) {
+	limiter := newRateLimiter([]flags.RateLimit{{Rate: 1, Burst: 1, Key: flags.RateLimitKeyIP}}, "", 2, metrics.NewMetrics())
+	now := time.Unix(1606824023, 0)
+	request := func(ip string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		return r
+	}
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		_, ok := limiter.allow(flags.RouteLatest, request(ip), now)
+		require.True(t, ok)
+	}
+	_, ok := limiter.allow(flags.RouteLatest, request("10.0.0.1"), now)
+	require.False(t, ok)
+
+	// A third client forgets the least recently seen one, whose bucket starts full again
+	_, ok = limiter.allow(flags.RouteLatest, request("10.0.0.3"), now)
+	require.True(t, ok)
+	_, ok = limiter.allow(flags.RouteLatest, request("10.0.0.2"), now)
+	require.True(t, ok)
+	_, ok = limiter.allow(flags.RouteLatest, request("10.0.0.3"), now)
+	require.False(t, ok)
+}
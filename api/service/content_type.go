@@ -0,0 +1,69 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/base-org/blob-archiver/api/flags"
+)
+
+// contentNegotiator chooses the content type of responses. Requests get the type they accept, or the default content
+// type, or that of an override applying to them, if they don't send an Accept header or accept any type.
+type contentNegotiator struct {
+	defaultType string
+	pathPrefix  string
+	keyHeader   string
+	keys        map[string]string
+	paths       []flags.ContentTypeOverride
+}
+
+func newContentNegotiator(cfg flags.ContentTypeConfig, pathPrefix string, overrides []flags.ContentTypeOverride) *contentNegotiator {
+	result := &contentNegotiator{
+		defaultType: acceptType(cfg.Default),
+		pathPrefix:  pathPrefix,
+		keyHeader:   cfg.KeyHeader,
+		keys:        make(map[string]string),
+	}
+
+	for _, override := range overrides {
+		if override.APIKey == "" {
+			result.paths = append(result.paths, override)
+		} else if _, found := result.keys[override.APIKey]; !found {
+			result.keys[override.APIKey] = acceptType(override.Type)
+		}
+	}
+
+	return result
+}
+
+// acceptType returns the media type of a content type, application/json unless it is SSZ.
+func acceptType(contentType flags.ContentType) string {
+	if contentType == flags.ContentTypeSSZ {
+		return sszAcceptType
+	}
+	return jsonAcceptType
+}
+
+// responseType returns the media type the response to the request is written in. Types other than those of SSZ and
+// CBOR are answered with JSON.
+func (n *contentNegotiator) responseType(r *http.Request) string {
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept != "" && accept != "*/*" {
+		return accept
+	}
+
+	if n.keyHeader != "" {
+		if contentType, found := n.keys[r.Header.Get(n.keyHeader)]; found {
+			return contentType
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, n.pathPrefix)
+	for _, override := range n.paths {
+		if strings.HasPrefix(path, override.Path) {
+			return acceptType(override.Type)
+		}
+	}
+
+	return n.defaultType
+}
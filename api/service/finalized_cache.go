@@ -0,0 +1,57 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// finalizedCache holds the block "finalized" last resolved to for up to ttl. Finality only advances once an epoch, so
+// resolving it with the beacon node for every request mostly returns the same block, while reusing it for too long
+// would serve stale finality. A nil cache holds nothing.
+type finalizedCache struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	root       common.Hash
+	resolvedAt time.Time
+	resolved   bool
+}
+
+// newFinalizedCache creates a cache holding the resolution for ttl, or returns nil if ttl is 0.
+func newFinalizedCache(ttl time.Duration) *finalizedCache {
+	if ttl == 0 {
+		return nil
+	}
+
+	return &finalizedCache{ttl: ttl}
+}
+
+// get returns the block "finalized" resolved to, if it was resolved less than ttl before now.
+func (c *finalizedCache) get(now time.Time) (common.Hash, bool) {
+	if c == nil {
+		return common.Hash{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.resolved || now.Sub(c.resolvedAt) >= c.ttl {
+		return common.Hash{}, false
+	}
+
+	return c.root, true
+}
+
+// set records that "finalized" resolved to the given block at now.
+func (c *finalizedCache) set(root common.Hash, now time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.root = root
+	c.resolvedAt = now
+	c.resolved = true
+}
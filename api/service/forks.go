@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// forkScheduleMaximumRetries is the number of attempts at fetching the fork schedule at startup.
+const forkScheduleMaximumRetries = 5
+
+type forkInfo struct {
+	// Name is empty if the spec of the beacon node doesn't name the version of the fork.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Epoch and StartSlot are encoded as strings, like other integers of the beacon API.
+	Epoch     string `json:"epoch"`
+	StartSlot string `json:"start_slot"`
+}
+
+type forksResponse struct {
+	Data []forkInfo `json:"data"`
+}
+
+// initForkSchedule fetches the fork schedule of the chain at startup, retrying while the beacon node may not be ready
+// yet. If it can't be fetched, it is fetched once it is first needed instead, see getForkSchedule.
+func (a *API) initForkSchedule(ctx context.Context) {
+	forks, err := beacon.FetchForkSchedule(ctx, a.beaconClient, forkScheduleMaximumRetries)
+	if err != nil {
+		a.logger.Warn("failed to fetch the fork schedule, fetching it on first use", "err", err)
+		return
+	}
+
+	a.forksMu.Lock()
+	defer a.forksMu.Unlock()
+	if a.forks == nil {
+		a.setForkSchedule(forks)
+	}
+}
+
+// getForkSchedule returns the fork schedule of the chain, fetching it from the beacon node if it wasn't fetched yet.
+func (a *API) getForkSchedule(ctx context.Context) ([]beacon.Fork, error) {
+	a.forksMu.Lock()
+	defer a.forksMu.Unlock()
+
+	if a.forks == nil {
+		forks, err := beacon.NewForkSchedule(ctx, a.beaconClient)
+		if err != nil {
+			return nil, err
+		}
+		a.setForkSchedule(forks)
+	}
+
+	return a.forks, nil
+}
+
+// setForkSchedule caches the fork schedule, and logs and records it so that operators can check it against the
+// network. forksMu must be held.
+func (a *API) setForkSchedule(forks []beacon.Fork) {
+	a.forks = forks
+
+	for _, fork := range forks {
+		version := hexutil.Encode(fork.Version[:])
+		a.logger.Info("fork scheduled", "fork", fork.Name, "version", version, "epoch", fork.Epoch, "slot", fork.StartSlot)
+		a.metrics.SetForkStartSlot(fork.Name, version, uint64(fork.StartSlot))
+	}
+}
+
+// forksHandler implements the /eth/v1/archiver/forks endpoint, returning the fork schedule of the chain as seen by the
+// service, in order of activation.
+func (a *API) forksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonAcceptType)
+
+	forks, err := a.getForkSchedule(r.Context())
+	if err != nil {
+		a.logger.Info("unexpected error fetching fork schedule", "err", err)
+		errServerError.write(w)
+		return
+	}
+
+	response := forksResponse{Data: make([]forkInfo, 0, len(forks))}
+	for _, fork := range forks {
+		response.Data = append(response.Data, forkInfo{
+			Name:      fork.Name,
+			Version:   hexutil.Encode(fork.Version[:]),
+			Epoch:     strconv.FormatUint(uint64(fork.Epoch), 10),
+			StartSlot: strconv.FormatUint(uint64(fork.StartSlot), 10),
+		})
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.logger.Error("unable to encode fork schedule to JSON", "err", err)
+	}
+}
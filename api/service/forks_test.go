@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForksEndpoint(t *testing.T) {
+	a, _, stub, cleanup := setup(t)
+	defer cleanup()
+
+	stub.Forks = []*phase0.Fork{
+		{PreviousVersion: phase0.Version{4}, CurrentVersion: phase0.Version{5}, Epoch: 364032},
+		{PreviousVersion: phase0.Version{3}, CurrentVersion: phase0.Version{4}, Epoch: 269568},
+	}
+	a.initForkSchedule(context.Background())
+
+	// The schedule is cached, so that later changes of the beacon node aren't reflected
+	stub.Forks = nil
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/archiver/forks", nil))
+
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, jsonAcceptType, response.Header().Get("Content-Type"))
+
+	var forks forksResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &forks))
+	require.Equal(t, []forkInfo{
+		{Name: "deneb", Version: "0x04000000", Epoch: "269568", StartSlot: "8626176"},
+		{Name: "electra", Version: "0x05000000", Epoch: "364032", StartSlot: "11649024"},
+	}, forks.Data)
+
+	require.Equal(t, float64(8626176+11649024), metricValue(t, a.metrics, "blob_api_fork_start_slot"))
+}
+
+func TestForksEndpointFetchesOnFirstUse(t *testing.T) {
+	a, _, stub, cleanup := setup(t)
+	defer cleanup()
+
+	// The fork schedule wasn't fetched at startup, and can't be fetched yet
+	stub.Forks = nil
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/archiver/forks", nil))
+	require.Equal(t, 500, response.Code)
+
+	stub.Forks = []*phase0.Fork{{PreviousVersion: phase0.Version{4}, CurrentVersion: phase0.Version{4}}}
+
+	response = httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/archiver/forks", nil))
+	require.Equal(t, 200, response.Code)
+
+	var forks forksResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &forks))
+	require.Equal(t, []forkInfo{{Name: "deneb", Version: "0x04000000", Epoch: "0", StartSlot: "0"}}, forks.Data)
+}
+
+func TestForksEndpointDisabled(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	cfg := flags.APIConfig{DisabledRoutes: []string{flags.RouteForks}}
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, httptest.NewRequest("GET", "/eth/v1/archiver/forks", nil))
+	require.Equal(t, 404, response.Code)
+}
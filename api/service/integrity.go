@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Reasons blob data read from storage is corrupt, see readBlobs.
+const (
+	corruptReasonDecode  = "decode"
+	corruptReasonInvalid = "invalid"
+)
+
+// errCorruptBlobData is returned when the blob data read from storage can't be decoded or fails validation.
+var errCorruptBlobData = errors.New("stored blob data is corrupt")
+
+// validateBlobData checks the structure of the blob data read from storage for the block with the given hash, so that
+// corrupt objects aren't served. It is cheap compared to reading the blobs: the blobs and their proofs aren't verified,
+// only that the data is stored under the hash of its block, and that its sidecars are complete, embed the same block
+// header and have unique indices. errCorruptBlobData is returned if the data is invalid.
+func validateBlobData(hash common.Hash, data storage.BlobData) error {
+	// Blob data written before headers were stored has no hash
+	if stored := data.Header.BeaconBlockHash; stored != (common.Hash{}) && stored != hash {
+		return fmt.Errorf("%w: stored for block %s", errCorruptBlobData, stored)
+	}
+
+	var header *phase0.BeaconBlockHeader
+	seen := make(map[deneb.BlobIndex]struct{}, len(data.BlobSidecars.Data))
+	for i, sidecar := range data.BlobSidecars.Data {
+		if sidecar == nil || sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+			return fmt.Errorf("%w: sidecar %d is incomplete", errCorruptBlobData, i)
+		}
+
+		if header == nil {
+			header = sidecar.SignedBlockHeader.Message
+		} else if *sidecar.SignedBlockHeader.Message != *header {
+			return fmt.Errorf("%w: sidecar %d embeds a different block header", errCorruptBlobData, i)
+		}
+
+		if _, ok := seen[sidecar.Index]; ok {
+			return fmt.Errorf("%w: index %d is stored more than once", errCorruptBlobData, sidecar.Index)
+		}
+		seen[sidecar.Index] = struct{}{}
+	}
+
+	return nil
+}
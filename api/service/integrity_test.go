@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlobData(t *testing.T) {
+	hash := common.Hash{1}
+	header := &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: 5}}
+	valid := func() storage.BlobData {
+		return storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecarsForBlock(t, header, 3)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(data *storage.BlobData)
+		valid   bool
+	}{
+		{name: "valid", corrupt: func(data *storage.BlobData) {}, valid: true},
+		{name: "without sidecars", corrupt: func(data *storage.BlobData) { data.BlobSidecars.Data = nil }, valid: true},
+		{name: "without stored hash", corrupt: func(data *storage.BlobData) { data.Header.BeaconBlockHash = common.Hash{} }, valid: true},
+		{name: "stored for another block", corrupt: func(data *storage.BlobData) { data.Header.BeaconBlockHash = common.Hash{2} }},
+		{name: "missing sidecar", corrupt: func(data *storage.BlobData) { data.BlobSidecars.Data[1] = nil }},
+		{name: "missing block header", corrupt: func(data *storage.BlobData) { data.BlobSidecars.Data[2].SignedBlockHeader = nil }},
+		{name: "duplicate index", corrupt: func(data *storage.BlobData) { data.BlobSidecars.Data[2].Index = 0 }},
+		{name: "different block header", corrupt: func(data *storage.BlobData) {
+			data.BlobSidecars.Data[1].SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: &phase0.BeaconBlockHeader{Slot: 6}}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := valid()
+			test.corrupt(&data)
+
+			err := validateBlobData(hash, data)
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, errCorruptBlobData)
+			}
+		})
+	}
+}
+
+func TestCorruptStoredBlobData(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(dir, logger)
+	m := metrics.NewMetrics()
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{}, m, logger)
+
+	truncated := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: truncated},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}))
+	stored, err := os.ReadFile(path.Join(dir, truncated.String()))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, truncated.String()), stored[:len(stored)/2], 0644))
+
+	duplicated := common.Hash{2}
+	sidecars := blobtest.NewBlobSidecars(t, 2)
+	sidecars[1].Index = 0
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: duplicated},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	}))
+
+	tests := []struct {
+		name   string
+		hash   common.Hash
+		reason string
+	}{
+		{name: "undecodable", hash: truncated, reason: corruptReasonDecode},
+		{name: "invalid", hash: duplicated, reason: corruptReasonInvalid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, route := range []string{"/eth/v1/beacon/blob_sidecars/", "/eth/v1/archiver/blob_availability/"} {
+				before := corruptReadCount(t, m, test.reason)
+
+				response := httptest.NewRecorder()
+				a.router.ServeHTTP(response, httptest.NewRequest("GET", route+test.hash.String(), nil))
+
+				require.Equal(t, 500, response.Code)
+				var apiErr httpError
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &apiErr))
+				require.Equal(t, errCorruptData.Message, apiErr.Message)
+				require.Equal(t, before+1, corruptReadCount(t, m, test.reason))
+			}
+		})
+	}
+}
+
+func corruptReadCount(t *testing.T, m metrics.Metricer, reason string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "blob_api_corrupt_reads" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == reason {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	peerLookupHit         = "hit"
+	peerLookupMiss        = "miss"
+	peerLookupUnreachable = "unreachable"
+)
+
+var errPeersUnreachable = &httpError{
+	Code:    http.StatusBadGateway,
+	Message: "Block not found: peers are unreachable",
+}
+
+// newPeerSources creates a source for every configured peer. Peers are only asked for blob sidecars, so the sources are
+// created without a beacon client.
+func newPeerSources(cfg flags.PeersConfig) []*beacon.BlobArchiverSource {
+	sources := make([]*beacon.BlobArchiverSource, 0, len(cfg.URLs))
+	for _, url := range cfg.URLs {
+		sources = append(sources, beacon.NewBlobArchiverSource(nil, url, cfg.Timeout))
+	}
+	return sources
+}
+
+// peerLookup fetches the blobs of a block that is missing locally from the configured peers, trying them in order until
+// one has the block. If none of the peers tried has it, errUnknownBlock is returned, unless a peer failed, in which case
+// the block may exist and errPeersUnreachable is returned instead. Blobs found on a peer are stored if caching is
+// enabled, so subsequent requests are served from storage.
+func (a *API) peerLookup(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, *httpError) {
+	tried := min(len(a.peers), a.cfg.Peers.MaxTried)
+	unreachable := false
+
+	for _, peer := range a.peers[:tried] {
+		data, err := fetchFromPeer(ctx, peer, beaconBlockHash)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			a.logger.Warn("failed to fetch blobs from peer", "err", err, "beaconBlockHash", beaconBlockHash.String())
+			unreachable = true
+			continue
+		}
+
+		a.metrics.RecordPeerLookup(peerLookupHit)
+		if a.cfg.Peers.Cache {
+			if writer, ok := a.dataStoreClient.(storage.DataStoreWriter); ok {
+				if err := writer.WriteIfNotExists(ctx, data); err != nil && !errors.Is(err, storage.ErrWriteDeduped) {
+					a.logger.Warn("failed to store blobs fetched from peer", "err", err, "beaconBlockHash", beaconBlockHash.String())
+				}
+			}
+		}
+		return data, nil
+	}
+
+	if unreachable {
+		a.metrics.RecordPeerLookup(peerLookupUnreachable)
+		return storage.BlobData{}, errPeersUnreachable
+	}
+
+	a.metrics.RecordPeerLookup(peerLookupMiss)
+	return storage.BlobData{}, errUnknownBlock
+}
+
+// fetchFromPeer fetches the blob sidecars of a block from a peer, returning storage.ErrNotFound if the peer doesn't have
+// it. The sidecars must belong to the requested block, so that a faulty peer can't serve the blobs of another block.
+func fetchFromPeer(ctx context.Context, peer *beacon.BlobArchiverSource, beaconBlockHash common.Hash) (storage.BlobData, error) {
+	sidecars, err := peer.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: beaconBlockHash.String(),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return storage.BlobData{}, storage.ErrNotFound
+		}
+		return storage.BlobData{}, err
+	}
+
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: beaconBlockHash},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars.Data},
+	}
+
+	for _, sidecar := range sidecars.Data {
+		if sidecar.SignedBlockHeader == nil || sidecar.SignedBlockHeader.Message == nil {
+			return storage.BlobData{}, fmt.Errorf("blob sidecar %d has no block header", sidecar.Index)
+		}
+
+		root, err := sidecar.SignedBlockHeader.Message.HashTreeRoot()
+		if err != nil {
+			return storage.BlobData{}, fmt.Errorf("failed to hash block header: %w", err)
+		}
+		if common.Hash(root) != beaconBlockHash {
+			return storage.BlobData{}, fmt.Errorf("blob sidecar %d belongs to block %s", sidecar.Index, common.Hash(root))
+		}
+
+		data.Header.Slot = uint64(sidecar.SignedBlockHeader.Message.Slot)
+	}
+
+	return data, nil
+}
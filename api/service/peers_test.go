@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	commonflags "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func peerLookupCount(t *testing.T, m metrics.Metricer, result string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "blob_api_peer_lookups" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == result {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+// newPeer starts the API of another blob-archiver, serving the given blocks.
+func newPeer(t *testing.T, blocks ...storage.BlobData) *httptest.Server {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	for _, data := range blocks {
+		require.NoError(t, fs.Write(context.Background(), data))
+	}
+
+	peer := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), flags.APIConfig{}, metrics.NewMetrics(), logger)
+	server := httptest.NewServer(peer.router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFailingPeer starts a server that fails every request.
+func newFailingPeer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errServerError.write(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newPeerBlock(t *testing.T, slot phase0.Slot) storage.BlobData {
+	header := &phase0.SignedBeaconBlockHeader{
+		Message: &phase0.BeaconBlockHeader{
+			Slot:       slot,
+			ParentRoot: phase0.Root{1},
+			StateRoot:  phase0.Root{2},
+			BodyRoot:   phase0.Root{3},
+		},
+	}
+	root, err := header.Message.HashTreeRoot()
+	require.NoError(t, err)
+
+	return storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: root, Slot: uint64(slot)},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecarsForBlock(t, header, 2)},
+	}
+}
+
+func TestPeerLookup(t *testing.T) {
+	block := newPeerBlock(t, 10)
+	missing := newPeerBlock(t, 11)
+
+	tests := []struct {
+		name    string
+		peers   func(t *testing.T) []*httptest.Server
+		hash    common.Hash
+		code    int
+		message string
+		result  string
+	}{
+		{
+			name: "hit",
+			peers: func(t *testing.T) []*httptest.Server {
+				return []*httptest.Server{newPeer(t), newPeer(t, block)}
+			},
+			hash:   block.Header.BeaconBlockHash,
+			code:   200,
+			result: peerLookupHit,
+		},
+		{
+			name: "hit after failing peer",
+			peers: func(t *testing.T) []*httptest.Server {
+				return []*httptest.Server{newFailingPeer(t), newPeer(t, block)}
+			},
+			hash:   block.Header.BeaconBlockHash,
+			code:   200,
+			result: peerLookupHit,
+		},
+		{
+			name: "miss",
+			peers: func(t *testing.T) []*httptest.Server {
+				return []*httptest.Server{newPeer(t), newPeer(t, block)}
+			},
+			hash:    missing.Header.BeaconBlockHash,
+			code:    404,
+			message: errUnknownBlock.Message,
+			result:  peerLookupMiss,
+		},
+		{
+			name: "unreachable",
+			peers: func(t *testing.T) []*httptest.Server {
+				return []*httptest.Server{newPeer(t), newFailingPeer(t)}
+			},
+			hash:    missing.Header.BeaconBlockHash,
+			code:    502,
+			message: errPeersUnreachable.Message,
+			result:  peerLookupUnreachable,
+		},
+		{
+			name: "beyond max tried",
+			peers: func(t *testing.T) []*httptest.Server {
+				return []*httptest.Server{newPeer(t), newPeer(t), newPeer(t), newPeer(t, block)}
+			},
+			hash:    block.Header.BeaconBlockHash,
+			code:    404,
+			message: errUnknownBlock.Message,
+			result:  peerLookupMiss,
+		},
+		{
+			name: "sidecars of another block",
+			peers: func(t *testing.T) []*httptest.Server {
+				// The peer stores the sidecars of the block under the hash of another block
+				wrong := block
+				wrong.Header.BeaconBlockHash = missing.Header.BeaconBlockHash
+				return []*httptest.Server{newPeer(t, wrong)}
+			},
+			hash:    missing.Header.BeaconBlockHash,
+			code:    502,
+			message: errPeersUnreachable.Message,
+			result:  peerLookupUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := testlog.Logger(t, log.LvlInfo)
+			fs := storage.NewFileStorage(t.TempDir(), logger)
+			m := metrics.NewMetrics()
+
+			cfg := flags.APIConfig{Peers: flags.PeersConfig{Timeout: time.Second, MaxTried: 3}}
+			for _, peer := range test.peers(t) {
+				cfg.Peers.URLs = append(cfg.Peers.URLs, peer.URL)
+			}
+			a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, m, logger)
+
+			request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+test.hash.String(), nil)
+			response := httptest.NewRecorder()
+			a.router.ServeHTTP(response, request)
+
+			require.Equal(t, test.code, response.Code)
+			require.Equal(t, float64(1), peerLookupCount(t, m, test.result))
+
+			if test.code != 200 {
+				var httpErr httpError
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &httpErr))
+				require.Equal(t, test.message, httpErr.Message)
+				return
+			}
+
+			var res storage.BlobSidecars
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &res))
+			require.Equal(t, block.BlobSidecars.Data, res.Data)
+
+			// Caching is disabled, so the blobs are not stored
+			exists, err := fs.Exists(context.Background(), test.hash)
+			require.NoError(t, err)
+			require.False(t, exists)
+		})
+	}
+}
+
+func TestPeerLookup_Cache(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	block := newPeerBlock(t, 10)
+	peer := newPeer(t, block)
+
+	cfg := flags.APIConfig{Peers: flags.PeersConfig{URLs: []string{peer.URL}, Timeout: time.Second, MaxTried: 1, Cache: true}}
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+block.Header.BeaconBlockHash.String(), nil)
+	response := httptest.NewRecorder()
+	a.router.ServeHTTP(response, request)
+	require.Equal(t, 200, response.Code)
+
+	stored, err := fs.Read(context.Background(), block.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	block.Header.Format = commonflags.StorageFormatJSON
+	require.Equal(t, block.Header, stored.Header)
+	require.Equal(t, block.BlobSidecars.Data, stored.BlobSidecars.Data)
+}
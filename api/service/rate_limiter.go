@@ -0,0 +1,196 @@
+package service
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	m "github.com/base-org/blob-archiver/api/metrics"
+	"github.com/go-chi/chi/v5"
+)
+
+// routeOther is the route requests that don't belong to a named route, e.g. blob sidecars of an invalid block id, are
+// recorded under when they are rate limited.
+const routeOther = "other"
+
+var errRateLimited = &httpError{
+	Code:    http.StatusTooManyRequests,
+	Message: "Too many requests: rate limit exceeded",
+}
+
+// rateLimiter applies token bucket rate limits to the requests to the routes of the API. A request is rejected if any of
+// the limits applying to its route has no tokens left, in which case the limits checked before it keep the tokens it
+// took. A nil rateLimiter doesn't limit requests.
+type rateLimiter struct {
+	limits    []*rateLimit
+	keyHeader string
+	metrics   m.Metricer
+}
+
+// rateLimit holds the token buckets of a limit, a single one if the limit is global, or one per client, of which the
+// maxClients most recently seen are kept.
+type rateLimit struct {
+	flags.RateLimit
+	mu         sync.Mutex
+	maxClients int
+	buckets    map[string]*list.Element
+	// order lists the clients from most to least recently seen.
+	order *list.List
+}
+
+type tokenBucket struct {
+	client  string
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter creates a limiter applying the given limits, or returns nil if there are none.
+func newRateLimiter(limits []flags.RateLimit, keyHeader string, maxClients int, metrics m.Metricer) *rateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	result := &rateLimiter{keyHeader: keyHeader, metrics: metrics}
+	for _, limit := range limits {
+		result.limits = append(result.limits, &rateLimit{
+			RateLimit:  limit,
+			maxClients: max(maxClients, 1),
+			buckets:    make(map[string]*list.Element),
+			order:      list.New(),
+		})
+	}
+
+	return result
+}
+
+// allow takes a token for the request from every limit applying to the route, and returns whether the request may be
+// served. If not, it also returns how long until the limit that rejected it has a token again. Requests outside named
+// routes are only subject to limits applying to all routes.
+func (l *rateLimiter) allow(route string, r *http.Request, now time.Time) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+
+	for _, limit := range l.limits {
+		if route == "" && len(limit.Routes) > 0 || !limit.AppliesTo(route) {
+			continue
+		}
+
+		if wait, ok := limit.take(l.client(limit.Key, r), now); !ok {
+			if route == "" {
+				route = routeOther
+			}
+			l.metrics.RecordRateLimited(route, string(limit.Key))
+			return wait, false
+		}
+	}
+
+	return 0, true
+}
+
+// client returns the client the requests counted against a limit with the given key are grouped by.
+func (l *rateLimiter) client(key flags.RateLimitKey, r *http.Request) string {
+	switch key {
+	case flags.RateLimitKeyGlobal:
+		return ""
+	case flags.RateLimitKeyAPIKey:
+		if apiKey := r.Header.Get(l.keyHeader); apiKey != "" {
+			return "key:" + apiKey
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// take refills the bucket of the client for the time passed since it was last used, and takes a token from it. If the
+// bucket is empty, it returns how long until it holds a token again.
+func (l *rateLimit) take(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.bucket(client, now)
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = min(float64(l.Burst), bucket.tokens+elapsed.Seconds()*l.Rate)
+		bucket.updated = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+
+	return time.Duration((1 - bucket.tokens) / l.Rate * float64(time.Second)), false
+}
+
+// bucket returns the bucket of the client, creating a full one if the client is new. The bucket of the least recently
+// seen client is dropped if maxClients are tracked already.
+func (l *rateLimit) bucket(client string, now time.Time) *tokenBucket {
+	if element, ok := l.buckets[client]; ok {
+		l.order.MoveToFront(element)
+		return element.Value.(*tokenBucket)
+	}
+
+	if l.order.Len() >= l.maxClients {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*tokenBucket).client)
+	}
+
+	bucket := &tokenBucket{client: client, tokens: float64(l.Burst), updated: now}
+	l.buckets[client] = l.order.PushFront(bucket)
+	return bucket
+}
+
+// rateLimit rejects requests to the route with the given name that exceed a rate limit with a 429, whose Retry-After
+// header is the number of seconds until the request would be allowed.
+func (a *API) rateLimit(route string) func(http.Handler) http.Handler {
+	return a.rateLimitBy(func(*http.Request) string {
+		return route
+	})
+}
+
+// rateLimitBlobSidecars rate limits requests to the blob sidecars endpoint by the route of the kind of block identifier
+// requested, see blockIdPatterns.
+func (a *API) rateLimitBlobSidecars() func(http.Handler) http.Handler {
+	return a.rateLimitBy(func(r *http.Request) string {
+		id := normalizeBlockId(chi.URLParam(r, "id"))
+		switch {
+		case isHash(id):
+			return flags.RouteBlobSidecarsHash
+		case isSlot(id):
+			return flags.RouteBlobSidecarsSlot
+		case isKnownIdentifier(id):
+			return flags.RouteBlobSidecarsNamed
+		default:
+			return ""
+		}
+	})
+}
+
+func (a *API) rateLimitBy(route func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a.rateLimiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait, ok := a.rateLimiter.allow(route(r), r, a.clock.Now()); !ok {
+				w.Header().Set("Content-Type", jsonAcceptType)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				errRateLimited.write(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
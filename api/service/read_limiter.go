@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	m "github.com/base-org/blob-archiver/api/metrics"
+)
+
+// errReadsOverloaded is returned when a storage read is shed, because the queue is full or the read waited too long.
+var errReadsOverloaded = errors.New("too many concurrent storage reads")
+
+// readLimiter caps the number of storage reads in flight. Reads beyond the cap wait in a bounded queue for up to the
+// queue timeout, and are shed once the queue is full or the timeout expires. A nil readLimiter doesn't limit reads.
+type readLimiter struct {
+	slots        chan struct{}
+	queued       atomic.Int64
+	queueSize    int64
+	queueTimeout time.Duration
+	metrics      m.Metricer
+}
+
+// newReadLimiter creates a limiter for up to concurrency reads in flight, or returns nil if concurrency is 0.
+func newReadLimiter(concurrency int, queueSize int, queueTimeout time.Duration, metrics m.Metricer) *readLimiter {
+	if concurrency == 0 {
+		return nil
+	}
+
+	return &readLimiter{
+		slots:        make(chan struct{}, concurrency),
+		queueSize:    int64(queueSize),
+		queueTimeout: queueTimeout,
+		metrics:      metrics,
+	}
+}
+
+// acquire waits for a read slot. On success, the returned function must be called once the read completed.
+func (l *readLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	default:
+	}
+
+	queued := l.queued.Add(1)
+	defer func() {
+		l.metrics.SetStorageReadsQueued(int(l.queued.Add(-1)))
+	}()
+
+	if queued > l.queueSize {
+		l.metrics.RecordStorageReadShed()
+		return nil, errReadsOverloaded
+	}
+	l.metrics.SetStorageReadsQueued(int(queued))
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	case <-timer.C:
+		l.metrics.RecordStorageReadShed()
+		return nil, errReadsOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *readLimiter) acquired() func() {
+	l.metrics.SetStorageReadsInFlight(len(l.slots))
+
+	return func() {
+		<-l.slots
+		l.metrics.SetStorageReadsInFlight(len(l.slots))
+	}
+}
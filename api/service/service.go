@@ -2,13 +2,16 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"sync/atomic"
 
 	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/common/tracing"
 	"github.com/ethereum-optimism/optimism/op-service/httputil"
-	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -21,6 +24,7 @@ func NewService(l log.Logger, api *API, cfg flags.APIConfig, registry *prometheu
 		cfg:      cfg,
 		registry: registry,
 		api:      api,
+		stopCh:   make(chan struct{}),
 	}
 }
 
@@ -30,14 +34,18 @@ type APIService struct {
 	cfg           flags.APIConfig
 	registry      *prometheus.Registry
 	metricsServer *httputil.HTTPServer
-	apiServer     *httputil.HTTPServer
-	api           *API
+	// apiServer serves the API, over HTTPS if TLS is configured, in which case redirectServer may redirect plain HTTP.
+	apiServer      *http.Server
+	apiAddr        net.Addr
+	redirectServer *http.Server
+	api            *API
+	stopCh         chan struct{}
 }
 
 func (a *APIService) Start(ctx context.Context) error {
 	if a.cfg.MetricsConfig.Enabled {
 		a.log.Info("starting metrics server", "addr", a.cfg.MetricsConfig.ListenAddr, "port", a.cfg.MetricsConfig.ListenPort)
-		srv, err := opmetrics.StartServer(a.registry, a.cfg.MetricsConfig.ListenAddr, a.cfg.MetricsConfig.ListenPort)
+		srv, err := tracing.StartMetricsServer(a.registry, a.cfg.MetricsConfig.ListenAddr, a.cfg.MetricsConfig.ListenPort)
 		if err != nil {
 			return err
 		}
@@ -46,24 +54,103 @@ func (a *APIService) Start(ctx context.Context) error {
 		a.metricsServer = srv
 	}
 
-	a.log.Debug("starting API server", "address", a.cfg.ListenAddr)
+	a.api.initForkSchedule(ctx)
 
-	srv, err := httputil.StartHTTPServer(a.cfg.ListenAddr, a.api.router)
+	// Only checking the age of the head and the availability window of lazy backfill need the slot clock so far
+	if a.cfg.HeadMaxAge > 0 || (a.cfg.LazyBackfill && a.cfg.AvailabilityWindow > 0) {
+		a.api.initSlotClock(ctx)
+	}
+
+	if a.cfg.SidecarCacheStatsInterval > 0 && a.api.sidecarCache != nil {
+		go a.api.sidecarCache.logStats(a.log, a.cfg.SidecarCacheStatsInterval, a.stopCh)
+	}
+
+	a.log.Debug("starting API server", "address", a.cfg.ListenAddr, "tls", a.cfg.TLS.Enabled())
+
+	var tlsConfig *tls.Config
+	if a.cfg.TLS.Enabled() {
+		loader, err := newCertificateLoader(a.cfg.TLS, a.log)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig = &tls.Config{
+			GetCertificate: loader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	srv, addr, err := a.startServer(a.cfg.ListenAddr, a.api.router, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to start API server: %w", err)
 	}
 
-	a.log.Info("API server started", "address", srv.Addr().String())
+	a.log.Info("API server started", "address", addr.String())
 	a.apiServer = srv
+	a.apiAddr = addr
+
+	if a.cfg.TLS.RedirectAddr != "" {
+		_, port, _ := net.SplitHostPort(addr.String())
+		srv, redirectAddr, err := a.startServer(a.cfg.TLS.RedirectAddr, httpsRedirectHandler(port), nil)
+		if err != nil {
+			return fmt.Errorf("failed to start HTTPS redirect server: %w", err)
+		}
+
+		a.log.Info("HTTPS redirect server started", "address", redirectAddr.String())
+		a.redirectServer = srv
+	}
+
 	return nil
 }
 
+// startServer serves the handler on the address until the server is shut down, over HTTPS if tlsConfig is not nil.
+// It returns the address the server is listening on.
+func (a *APIService) startServer(addr string, handler http.Handler, tlsConfig *tls.Config) (*http.Server, net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to bind to address %q: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       httputil.DefaultTimeouts.ReadTimeout,
+		ReadHeaderTimeout: httputil.DefaultTimeouts.ReadHeaderTimeout,
+		WriteTimeout:      httputil.DefaultTimeouts.WriteTimeout,
+		IdleTimeout:       httputil.DefaultTimeouts.IdleTimeout,
+		MaxHeaderBytes:    a.cfg.RequestLimits.MaxHeaderBytes,
+	}
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// The certificate is provided by the TLS config
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			a.log.Error("server stopped unexpectedly", "address", addr, "err", err)
+		}
+	}()
+
+	return srv, listener.Addr(), nil
+}
+
 func (a *APIService) Stop(ctx context.Context) error {
 	if a.stopped.Load() {
 		return ErrAlreadyStopped
 	}
 	a.log.Info("Stopping API")
 	a.stopped.Store(true)
+	close(a.stopCh)
+
+	if a.redirectServer != nil {
+		if err := a.redirectServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 
 	if a.apiServer != nil {
 		if err := a.apiServer.Shutdown(ctx); err != nil {
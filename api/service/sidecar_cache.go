@@ -0,0 +1,299 @@
+package service
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	m "github.com/base-org/blob-archiver/api/metrics"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// sidecarCacheWindow is the number of most recent lookups the hit ratio of the sidecar cache is computed over.
+const sidecarCacheWindow = 1000
+
+// sidecarCache keeps the blob sidecars of the most recently requested blocks, along with each sidecar serialized on its
+// own. The sidecars stored for a beacon block hash never change, so cached blocks are served without reading storage,
+// and filtered responses are assembled from the serialized sidecars without re-marshaling them.
+type sidecarCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[common.Hash]*list.Element
+	// order lists the cached blocks from most to least recently used.
+	order   *list.List
+	metrics m.Metricer
+
+	// window records whether each of the most recent lookups was a hit, next being the position of the next lookup.
+	window     []bool
+	next       int
+	windowHits int
+	stats      sidecarCacheStats
+}
+
+// sidecarCacheStats summarizes the effectiveness of the sidecar cache.
+type sidecarCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Responses counts the blob sidecars responses, and Cached those served from the cache without calling storage or
+	// the beacon node.
+	Responses uint64
+	Cached    uint64
+}
+
+// newSidecarCache creates a cache of up to size blocks. A size of 0 disables the cache, in which case nil is returned.
+func newSidecarCache(size int, metrics m.Metricer) *sidecarCache {
+	if size == 0 {
+		return nil
+	}
+
+	return &sidecarCache{
+		size:    size,
+		entries: make(map[common.Hash]*list.Element),
+		order:   list.New(),
+		metrics: metrics,
+	}
+}
+
+// get returns the cached sidecars of the block, if any.
+func (c *sidecarCache) get(hash common.Hash) (*cachedSidecars, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[hash]
+	c.recordLookup(ok)
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedSidecars), true
+}
+
+// add caches the sidecars of the block, evicting the least recently used block if the cache is full.
+func (c *sidecarCache) add(hash common.Hash, sidecars []*deneb.BlobSidecar) *cachedSidecars {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[hash]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*cachedSidecars)
+	}
+
+	entry := &cachedSidecars{hash: hash, sidecars: sidecars}
+	c.entries[hash] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedSidecars).hash)
+		c.stats.Evictions++
+		c.metrics.RecordSidecarCacheEviction()
+	}
+
+	return entry
+}
+
+// recordLookup records the result of a lookup, updating the hit ratio of the most recent lookups. It must be called
+// with the lock held.
+func (c *sidecarCache) recordLookup(hit bool) {
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.metrics.RecordSidecarCacheRequest(hit)
+
+	if len(c.window) < sidecarCacheWindow {
+		c.window = append(c.window, hit)
+	} else {
+		if c.window[c.next] {
+			c.windowHits--
+		}
+		c.window[c.next] = hit
+		c.next = (c.next + 1) % sidecarCacheWindow
+	}
+	if hit {
+		c.windowHits++
+	}
+
+	c.metrics.SetSidecarCacheHitRatio(c.hitRatio())
+}
+
+// hitRatio returns the hit ratio of the most recent lookups. It must be called with the lock held.
+func (c *sidecarCache) hitRatio() float64 {
+	if len(c.window) == 0 {
+		return 0
+	}
+	return float64(c.windowHits) / float64(len(c.window))
+}
+
+// recordResponse records a blob sidecars response, which was served from the cache alone if cached is set.
+func (c *sidecarCache) recordResponse(cached bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Responses++
+	if cached {
+		c.stats.Cached++
+	}
+	c.metrics.RecordSidecarResponse(cached)
+}
+
+// snapshot returns the statistics of the cache and the hit ratio of the most recent lookups.
+func (c *sidecarCache) snapshot() (sidecarCacheStats, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats, c.hitRatio()
+}
+
+// logStats logs the effectiveness of the cache every interval until stop is closed: the lookups and evictions since the
+// previous log, the hit ratio of the most recent lookups, and the fraction of responses served from the cache alone.
+func (c *sidecarCache) logStats(logger log.Logger, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var previous sidecarCacheStats
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			stats, ratio := c.snapshot()
+			responses := stats.Responses - previous.Responses
+			cached := 0.0
+			if responses > 0 {
+				cached = float64(stats.Cached-previous.Cached) / float64(responses)
+			}
+
+			logger.Info("sidecar cache stats",
+				"hits", stats.Hits-previous.Hits,
+				"misses", stats.Misses-previous.Misses,
+				"evictions", stats.Evictions-previous.Evictions,
+				"hitRatio", ratio,
+				"responses", responses,
+				"servedFromCache", cached)
+			previous = stats
+		}
+	}
+}
+
+// cachedSidecars are the sidecars of a block. Each sidecar is serialized once per format, the first time it is needed.
+type cachedSidecars struct {
+	hash     common.Hash
+	sidecars []*deneb.BlobSidecar
+
+	jsonOnce    sync.Once
+	jsonEncoded [][]byte
+	jsonErr     error
+
+	sszOnce    sync.Once
+	sszEncoded [][]byte
+	sszErr     error
+
+	cborOnce    sync.Once
+	cborEncoded [][]byte
+	cborErr     error
+}
+
+// encodeJSON returns the same bytes as encoding the sidecars at the given positions as BlobSidecars with a json.Encoder.
+func (c *cachedSidecars) encodeJSON(positions []int) ([]byte, error) {
+	c.jsonOnce.Do(func() {
+		c.jsonEncoded, c.jsonErr = encodeEach(c.sidecars, func(sidecar *deneb.BlobSidecar) ([]byte, error) {
+			return json.Marshal(sidecar)
+		})
+	})
+	if c.jsonErr != nil {
+		return nil, c.jsonErr
+	}
+
+	var result bytes.Buffer
+	result.WriteString(`{"data":[`)
+	for i, position := range positions {
+		if i > 0 {
+			result.WriteByte(',')
+		}
+		result.Write(c.jsonEncoded[position])
+	}
+	result.WriteString("]}\n")
+
+	return result.Bytes(), nil
+}
+
+// writeSSZ writes the same bytes as BlobSidecars.WriteSSZ for the sidecars at the given positions, one sidecar at a
+// time rather than concatenating them first. It returns the number of bytes written.
+func (c *cachedSidecars) writeSSZ(w io.Writer, positions []int) (int64, error) {
+	c.sszOnce.Do(func() {
+		c.sszEncoded, c.sszErr = encodeEach(c.sidecars, func(sidecar *deneb.BlobSidecar) ([]byte, error) {
+			return sidecar.MarshalSSZ()
+		})
+	})
+	if c.sszErr != nil {
+		return 0, c.sszErr
+	}
+
+	var written int64
+	for _, position := range positions {
+		n, err := w.Write(c.sszEncoded[position])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// encodeCBOR returns the same bytes as encoding the sidecars at the given positions as BlobSidecars with cbor.Marshal.
+func (c *cachedSidecars) encodeCBOR(positions []int) ([]byte, error) {
+	c.cborOnce.Do(func() {
+		c.cborEncoded, c.cborErr = encodeEach(c.sidecars, func(sidecar *deneb.BlobSidecar) ([]byte, error) {
+			return cbor.Marshal(sidecar)
+		})
+	})
+	if c.cborErr != nil {
+		return nil, c.cborErr
+	}
+
+	// Raw messages are embedded as is, and the key matches the json tag of BlobSidecars.Data
+	response := struct {
+		Data []cbor.RawMessage `cbor:"data"`
+	}{Data: make([]cbor.RawMessage, 0, len(positions))}
+	for _, position := range positions {
+		response.Data = append(response.Data, c.cborEncoded[position])
+	}
+
+	return cbor.Marshal(response)
+}
+
+func encodeEach(sidecars []*deneb.BlobSidecar, encode func(*deneb.BlobSidecar) ([]byte, error)) ([][]byte, error) {
+	result := make([][]byte, len(sidecars))
+	for i, sidecar := range sidecars {
+		encoded, err := encode(sidecar)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = encoded
+	}
+
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// certificateLoader serves the TLS certificate of the API. With reloading enabled, the modification times of the
+// certificate and key files are checked on every handshake, and the certificate is reloaded if either changed, so that
+// renewed certificates are picked up without a restart.
+type certificateLoader struct {
+	cfg flags.TLSConfig
+	log log.Logger
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// newCertificateLoader loads the configured certificate, failing if it can't be loaded.
+func newCertificateLoader(cfg flags.TLSConfig, l log.Logger) (*certificateLoader, error) {
+	loader := &certificateLoader{cfg: cfg, log: l}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	return loader, nil
+}
+
+func (c *certificateLoader) load() error {
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	c.certificate = &certificate
+	c.certModTime = certModTime
+	c.keyModTime = keyModTime
+	return nil
+}
+
+func (c *certificateLoader) modTimes() (time.Time, time.Time, error) {
+	cert, err := os.Stat(c.cfg.CertFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read tls certificate: %w", err)
+	}
+
+	key, err := os.Stat(c.cfg.KeyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read tls key: %w", err)
+	}
+
+	return cert.ModTime(), key.ModTime(), nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. If reloading the certificate fails, e.g. because only one of its
+// files has been replaced yet, the previous certificate is served.
+func (c *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.cfg.Reload {
+		return c.certificate, nil
+	}
+
+	certModTime, keyModTime, err := c.modTimes()
+	if err == nil && certModTime.Equal(c.certModTime) && keyModTime.Equal(c.keyModTime) {
+		return c.certificate, nil
+	}
+
+	if err == nil {
+		err = c.load()
+	}
+
+	if err != nil {
+		c.log.Warn("failed to reload tls certificate, serving the previous one", "err", err)
+	} else {
+		c.log.Info("reloaded tls certificate")
+	}
+
+	return c.certificate, nil
+}
+
+// httpsRedirectHandler redirects every request to the same URL over HTTPS, on the port the API is served on.
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCertificate writes a self-signed certificate for 127.0.0.1 with the given serial number to the files,
+// and returns it.
+func writeSelfSignedCertificate(t *testing.T, certFile, keyFile string, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "blob-archiver"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := writeSelfSignedCertificate(t, certFile, keyFile, 1)
+
+	logger := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.APIConfig{
+		ListenAddr: "127.0.0.1:0",
+		TLS:        flags.TLSConfig{CertFile: certFile, KeyFile: keyFile, Reload: true},
+	}
+	api := NewAPI(storage.NewFileStorage(dir, logger), beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+	svc := NewService(logger, api, cfg, nil)
+	require.NoError(t, svc.Start(context.Background()))
+	defer func() {
+		require.NoError(t, svc.Stop(context.Background()))
+	}()
+
+	// get requests the health endpoint over a new connection trusting the certificate, and returns the certificate
+	// the server presented
+	get := func(trusted *x509.Certificate) (*x509.Certificate, error) {
+		pool := x509.NewCertPool()
+		pool.AddCert(trusted)
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool},
+			DisableKeepAlives: true,
+		}}
+
+		resp, err := client.Get("https://" + svc.apiAddr.String() + "/healthz")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		require.Equal(t, 200, resp.StatusCode)
+		return resp.TLS.PeerCertificates[0], nil
+	}
+
+	served, err := get(first)
+	require.NoError(t, err)
+	require.Equal(t, first.SerialNumber, served.SerialNumber)
+
+	// Plain HTTP is not served
+	resp, err := http.Get("http://" + svc.apiAddr.String() + "/healthz")
+	require.NoError(t, err)
+	require.Equal(t, 400, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	// A renewed certificate is served to new connections
+	second := writeSelfSignedCertificate(t, certFile, keyFile, 2)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+
+	served, err = get(second)
+	require.NoError(t, err)
+	require.Equal(t, second.SerialNumber, served.SerialNumber)
+
+	_, err = get(first)
+	require.Error(t, err)
+}
+
+func TestServeTLSInvalidCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0600))
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+
+	logger := testlog.Logger(t, log.LvlInfo)
+	cfg := flags.APIConfig{
+		ListenAddr: "127.0.0.1:0",
+		TLS:        flags.TLSConfig{CertFile: certFile, KeyFile: keyFile},
+	}
+	api := NewAPI(storage.NewFileStorage(dir, logger), beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+	require.Error(t, NewService(logger, api, cfg, nil).Start(context.Background()))
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		port     string
+		host     string
+		expected string
+	}{
+		{"8443", "example.com", "https://example.com:8443/eth/v1/beacon/blob_sidecars/head?indices=1"},
+		{"8443", "example.com:80", "https://example.com:8443/eth/v1/beacon/blob_sidecars/head?indices=1"},
+		{"443", "example.com:8080", "https://example.com/eth/v1/beacon/blob_sidecars/head?indices=1"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/head?indices=1", nil)
+		request.Host = test.host
+		response := httptest.NewRecorder()
+
+		httpsRedirectHandler(test.port).ServeHTTP(response, request)
+
+		require.Equal(t, http.StatusPermanentRedirect, response.Code)
+		require.Equal(t, test.expected, response.Header().Get("Location"))
+	}
+}
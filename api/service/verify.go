@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/api/flags"
+	m "github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
+	commonflags "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	verificationAgree      = "agree"
+	verificationDisagree   = "disagree"
+	verificationUnverified = "unverified"
+)
+
+// errVerificationFailed is returned when the blobs read from storage differ from those of the verification source.
+var errVerificationFailed = errors.New("blob sidecars differ from the verification source")
+
+// blobReader is a source blobs are read from by the hash of their block, returning storage.ErrNotFound if it doesn't
+// have the block.
+type blobReader interface {
+	Read(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, error)
+}
+
+// beaconBlobReader reads blobs from the beacon node, which has them for blocks within its retention period.
+type beaconBlobReader struct {
+	client beacon.Client
+}
+
+func (r beaconBlobReader) Read(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, error) {
+	sidecars, err := r.client.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: beaconBlockHash.String(),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return storage.BlobData{}, storage.ErrNotFound
+		}
+		return storage.BlobData{}, err
+	}
+
+	return storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: beaconBlockHash},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars.Data},
+	}, nil
+}
+
+// VerifyingStorage compares the blobs read from the data store with those of a second source before returning them, to
+// detect corrupted or tampered objects. Blobs that differ are not returned, errVerificationFailed is returned instead.
+// Only one in sampleRate reads is verified. When the second source fails, or doesn't have the block, e.g. as the beacon
+// node pruned its blobs, the blobs of the data store are returned unverified.
+type VerifyingStorage struct {
+	storage.DataStore
+	secondary  blobReader
+	sampleRate uint64
+	reads      atomic.Uint64
+	metrics    m.Metricer
+	log        log.Logger
+}
+
+func NewVerifyingStorage(primary storage.DataStore, secondary blobReader, sampleRate uint64, metrics m.Metricer, l log.Logger) *VerifyingStorage {
+	return &VerifyingStorage{
+		DataStore:  primary,
+		secondary:  secondary,
+		sampleRate: sampleRate,
+		metrics:    metrics,
+		log:        l,
+	}
+}
+
+// NewVerifyingStorageFromConfig wraps the data store to verify reads against the source of the config, see
+// flags.VerifyConfig. The data store is returned as is if verification is disabled.
+func NewVerifyingStorageFromConfig(primary storage.DataStore, cfg flags.APIConfig, beaconClient beacon.Client, metrics m.Metricer, l log.Logger) (storage.DataStore, error) {
+	if !cfg.Verify.Enabled() {
+		return primary, nil
+	}
+
+	if cfg.Verify.Source == flags.VerifySourceBeacon {
+		return NewVerifyingStorage(primary, beaconBlobReader{client: beaconClient}, cfg.Verify.SampleRate, metrics, l), nil
+	}
+
+	storageCfg, err := commonflags.ParseStorageURL(cfg.Verify.Source, cfg.StorageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	secondary, err := storage.NewStorage(storageCfg, metrics, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize verify source: %w", err)
+	}
+
+	return NewVerifyingStorage(primary, secondary, cfg.Verify.SampleRate, metrics, l), nil
+}
+
+func (s *VerifyingStorage) Read(ctx context.Context, beaconBlockHash common.Hash) (storage.BlobData, error) {
+	data, err := s.DataStore.Read(ctx, beaconBlockHash)
+	if err != nil {
+		return data, err
+	}
+
+	if s.reads.Add(1)%s.sampleRate != 0 {
+		return data, nil
+	}
+
+	expected, err := s.secondary.Read(ctx, beaconBlockHash)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.log.Warn("failed to read blobs from verify source", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		}
+		s.metrics.RecordVerification(verificationUnverified)
+		return data, nil
+	}
+
+	equal, err := equalSidecars(data.BlobSidecars, expected.BlobSidecars)
+	if err != nil {
+		s.log.Warn("failed to compare blobs with verify source", "err", err, "beaconBlockHash", beaconBlockHash.String())
+		s.metrics.RecordVerification(verificationUnverified)
+		return data, nil
+	}
+
+	if !equal {
+		s.log.Error("blobs differ from verify source", "beaconBlockHash", beaconBlockHash.String())
+		s.metrics.RecordVerification(verificationDisagree)
+		return storage.BlobData{}, errVerificationFailed
+	}
+
+	s.metrics.RecordVerification(verificationAgree)
+	return data, nil
+}
+
+// equalSidecars compares the SSZ encoding of the sidecars, covering every field of every sidecar.
+func equalSidecars(a, b storage.BlobSidecars) (bool, error) {
+	encodedA, err := a.MarshalSSZ()
+	if err != nil {
+		return false, err
+	}
+
+	encodedB, err := b.MarshalSSZ()
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(encodedA, encodedB), nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func verificationCount(t *testing.T, m metrics.Metricer, result string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "blob_api_verifications" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == result {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestVerifyingStorage(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+
+	agreeing := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: common.Hash{1}},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	disagreeing := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: common.Hash{2}},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	pruned := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: common.Hash{3}},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}
+	for _, data := range []storage.BlobData{agreeing, disagreeing, pruned} {
+		require.NoError(t, fs.Write(context.Background(), data))
+	}
+
+	beacon.Blobs[agreeing.Header.BeaconBlockHash.String()] = agreeing.BlobSidecars.Data
+	beacon.Blobs[disagreeing.Header.BeaconBlockHash.String()] = blobtest.NewBlobSidecars(t, 2)
+
+	get := func(a *API, root common.Hash) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+root.String(), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response
+	}
+
+	m := metrics.NewMetrics()
+	cfg := flags.APIConfig{Verify: flags.VerifyConfig{Source: flags.VerifySourceBeacon, SampleRate: 1}}
+	store, err := NewVerifyingStorageFromConfig(fs, cfg, beacon, m, logger)
+	require.NoError(t, err)
+	a := NewAPI(store, beacon, cfg, m, logger)
+
+	require.Equal(t, 200, get(a, agreeing.Header.BeaconBlockHash).Code)
+	require.Equal(t, float64(1), verificationCount(t, m, verificationAgree))
+
+	response := get(a, disagreeing.Header.BeaconBlockHash)
+	require.Equal(t, 500, response.Code)
+	require.Contains(t, response.Body.String(), errFailedVerification.Message)
+	require.Equal(t, float64(1), verificationCount(t, m, verificationDisagree))
+
+	// Blocks the beacon node no longer has are served unverified
+	require.Equal(t, 200, get(a, pruned.Header.BeaconBlockHash).Code)
+	require.Equal(t, float64(1), verificationCount(t, m, verificationUnverified))
+
+	// Blocks missing from storage are not verified
+	require.Equal(t, 404, get(a, common.Hash{4}).Code)
+	require.Equal(t, float64(3), metricValue(t, m, "blob_api_verifications"))
+}
+
+func TestVerifyingStorage_DataStoreSource(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	primary := storage.NewFileStorage(t.TempDir(), logger)
+	secondaryDir := t.TempDir()
+	secondary := storage.NewFileStorage(secondaryDir, logger)
+
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: common.Hash{1}},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	require.NoError(t, primary.Write(context.Background(), data))
+	require.NoError(t, secondary.Write(context.Background(), data))
+
+	m := metrics.NewMetrics()
+	cfg := flags.APIConfig{Verify: flags.VerifyConfig{Source: "file://" + secondaryDir, SampleRate: 1}}
+	store, err := NewVerifyingStorageFromConfig(primary, cfg, beacontest.NewEmptyStubBeaconClient(), m, logger)
+	require.NoError(t, err)
+
+	read, err := store.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	require.Equal(t, data.BlobSidecars.Data, read.BlobSidecars.Data)
+	require.Equal(t, float64(1), verificationCount(t, m, verificationAgree))
+
+	// The object in the primary data store is corrupted
+	corrupted := data
+	corrupted.BlobSidecars = storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)}
+	require.NoError(t, primary.Write(context.Background(), corrupted))
+
+	_, err = store.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.ErrorIs(t, err, errVerificationFailed)
+	require.Equal(t, float64(1), verificationCount(t, m, verificationDisagree))
+}
+
+func TestVerifyingStorage_SampleRate(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+
+	data := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: common.Hash{1}},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}
+	require.NoError(t, fs.Write(context.Background(), data))
+	beacon.Blobs[data.Header.BeaconBlockHash.String()] = data.BlobSidecars.Data
+
+	m := metrics.NewMetrics()
+	store := NewVerifyingStorage(fs, beaconBlobReader{client: beacon}, 4, m, logger)
+
+	for i := 0; i < 12; i++ {
+		_, err := store.Read(context.Background(), data.Header.BeaconBlockHash)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, float64(3), verificationCount(t, m, verificationAgree))
+	require.Len(t, beacon.SidecarRequests(), 3)
+}
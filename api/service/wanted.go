@@ -0,0 +1,122 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// wantedTracked is the number of missed blocks whose misses are counted. Once more blocks are missed, the least recently
+// missed one is forgotten.
+const wantedTracked = 1024
+
+// errWantedQueueFull stops listing the wanted queue once it is known to be full.
+var errWantedQueueFull = errors.New("wanted queue full")
+
+// wantedRecorder records blocks that were requested but not found in the wanted queue of the data store, so that the
+// archiver fetches them. Blocks are only recorded once they were missed repeatedly, as one-off misses are often blocks
+// that don't exist, and the queue is bounded in size, so that clients requesting arbitrary hashes can't grow it.
+type wantedRecorder struct {
+	mu    sync.Mutex
+	cfg   flags.WantedConfig
+	store storage.WantedStore
+	log   log.Logger
+	// misses counts the misses of the tracked blocks, and order lists them from most to least recently missed.
+	misses map[common.Hash]*list.Element
+	order  *list.List
+}
+
+type wantedMisses struct {
+	hash  common.Hash
+	count int
+}
+
+// newWantedRecorder creates a recorder, or returns nil if recording is disabled or the data store doesn't hold a wanted
+// queue.
+func newWantedRecorder(cfg flags.WantedConfig, store storage.DataStoreReader, l log.Logger) *wantedRecorder {
+	if cfg.Size == 0 {
+		return nil
+	}
+
+	wanted, ok := store.(storage.WantedStore)
+	if !ok {
+		l.Warn("data store doesn't hold a wanted queue, not recording wanted blocks")
+		return nil
+	}
+
+	return &wantedRecorder{
+		cfg:    cfg,
+		store:  wanted,
+		log:    l,
+		misses: make(map[common.Hash]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// recordMiss counts a request for a block that wasn't found, and adds the block to the wanted queue once it was missed
+// cfg.Threshold times, unless the queue is full. Failing to add it is only logged, as the request failed regardless.
+func (w *wantedRecorder) recordMiss(ctx context.Context, hash common.Hash) {
+	if w == nil || !w.missed(hash) {
+		return
+	}
+
+	queued := 0
+	err := w.store.ListWanted(ctx, func(common.Hash) error {
+		queued++
+		if queued >= w.cfg.Size {
+			return errWantedQueueFull
+		}
+		return nil
+	})
+	if errors.Is(err, errWantedQueueFull) {
+		w.log.Debug("wanted queue full, not recording block", "hash", hash.String())
+		return
+	}
+	if err != nil {
+		w.log.Warn("failed to list wanted blocks", "err", err)
+		return
+	}
+
+	if err := w.store.WriteWanted(ctx, hash); err != nil {
+		w.log.Warn("failed to record wanted block", "err", err, "hash", hash.String())
+		return
+	}
+
+	w.log.Info("recorded wanted block", "hash", hash.String())
+}
+
+// missed counts a miss of the block, returning true once it reached the threshold, in which case the block's count is
+// reset.
+func (w *wantedRecorder) missed(hash common.Hash) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	element, ok := w.misses[hash]
+	if !ok {
+		element = w.order.PushFront(&wantedMisses{hash: hash})
+		w.misses[hash] = element
+		if w.order.Len() > wantedTracked {
+			oldest := w.order.Back()
+			w.order.Remove(oldest)
+			delete(w.misses, oldest.Value.(*wantedMisses).hash)
+		}
+	} else {
+		w.order.MoveToFront(element)
+	}
+
+	entry := element.Value.(*wantedMisses)
+	entry.count++
+	if entry.count < w.cfg.Threshold {
+		return false
+	}
+
+	w.order.Remove(element)
+	delete(w.misses, hash)
+	return true
+}
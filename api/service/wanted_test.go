@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/base-org/blob-archiver/api/flags"
+	"github.com/base-org/blob-archiver/api/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantedQueue(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), logger)
+	cfg := flags.APIConfig{Wanted: flags.WantedConfig{Size: 2, Threshold: 2}}
+	a := NewAPI(fs, beacontest.NewEmptyStubBeaconClient(), cfg, metrics.NewMetrics(), logger)
+
+	stored := common.Hash{9}
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: stored},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}))
+
+	get := func(hash common.Hash) int {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+hash.String(), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	wanted := func() []common.Hash {
+		var result []common.Hash
+		require.NoError(t, fs.ListWanted(context.Background(), func(hash common.Hash) error {
+			result = append(result, hash)
+			return nil
+		}))
+		return result
+	}
+
+	one, two, three := common.Hash{1}, common.Hash{2}, common.Hash{3}
+
+	// A block is only recorded once it was missed as often as the threshold
+	require.Equal(t, 404, get(one))
+	require.Empty(t, wanted())
+	require.Equal(t, 404, get(one))
+	require.Equal(t, []common.Hash{one}, wanted())
+
+	// Stored blocks are never recorded
+	require.Equal(t, 200, get(stored))
+	require.Equal(t, 200, get(stored))
+
+	// Blocks aren't recorded once the queue is full
+	for _, hash := range []common.Hash{two, three, two, three} {
+		require.Equal(t, 404, get(hash))
+	}
+	require.ElementsMatch(t, []common.Hash{one, two}, wanted())
+
+	// Once the archiver removed a block, there is room for another
+	require.NoError(t, fs.DeleteWanted(context.Background(), one))
+	require.Equal(t, 404, get(three))
+	require.Equal(t, 404, get(three))
+	require.ElementsMatch(t, []common.Hash{two, three}, wanted())
+}
+
+func TestWantedQueueDisabled(t *testing.T) {
+	a, fs, _, cleanup := setup(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		request := httptest.NewRequest("GET", "/eth/v1/beacon/blob_sidecars/"+common.Hash{1}.String(), nil)
+		response := httptest.NewRecorder()
+		a.router.ServeHTTP(response, request)
+		require.Equal(t, 404, response.Code)
+	}
+
+	require.NoError(t, fs.ListWanted(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected wanted block %s", hash)
+		return nil
+	}))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/base-org/blob-archiver/archiver/service"
+	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	blobCountsFromFlag = &cli.Uint64Flag{
+		Name:     "from",
+		Usage:    "The first slot of the range to export",
+		Required: true,
+	}
+	blobCountsToFlag = &cli.Uint64Flag{
+		Name:     "to",
+		Usage:    "The last slot of the range to export",
+		Required: true,
+	}
+	blobCountsOutputFlag = &cli.StringFlag{
+		Name:  "output",
+		Usage: "The path of the CSV file to write, stdout if empty",
+	}
+)
+
+// BlobCountsCommand exports the blob count of every archived block in a slot range as CSV. It uses the storage settings
+// of the archiver.
+func BlobCountsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "blob-counts",
+		Usage: "Export the blob count of every archived block in a slot range as CSV",
+		Flags: []cli.Flag{blobCountsFromFlag, blobCountsToFlag, blobCountsOutputFlag},
+		Action: func(cliCtx *cli.Context) error {
+			storageConfig := common.NewStorageConfig(cliCtx)
+			if err := storageConfig.Check(); err != nil {
+				return err
+			}
+
+			// Logs go to stderr, so that the CSV stays machine-parseable when written to stdout
+			l := oplog.NewLogger(os.Stderr, oplog.ReadCLIConfig(cliCtx))
+
+			store, err := storage.NewStorage(storageConfig, nil, l)
+			if err != nil {
+				return err
+			}
+
+			out := os.Stdout
+			if path := cliCtx.String(blobCountsOutputFlag.Name); path != "" {
+				out, err = os.Create(path)
+				if err != nil {
+					return fmt.Errorf("failed to create output: %w", err)
+				}
+				defer out.Close()
+			}
+
+			rows, err := service.ExportBlobCounts(cliCtx.Context, l, store,
+				cliCtx.Uint64(blobCountsFromFlag.Name), cliCtx.Uint64(blobCountsToFlag.Name), out)
+			if err != nil {
+				return err
+			}
+
+			l.Info("exported blob counts", "rows", rows)
+			if out != os.Stdout {
+				return out.Close()
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/base-org/blob-archiver/archiver/service"
+	"github.com/base-org/blob-archiver/common/beacon"
+	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	completenessFromFlag = &cli.Uint64Flag{
+		Name:     "from",
+		Usage:    "The first slot of the range to check",
+		Required: true,
+	}
+	completenessToFlag = &cli.Uint64Flag{
+		Name:     "to",
+		Usage:    "The last slot of the range to check",
+		Required: true,
+	}
+	completenessFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "The output format, options are [text, json, csv]. The csv output only lists the missing blocks",
+		Value: "text",
+	}
+	completenessConcurrencyFlag = &cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "The maximum number of slots checked concurrently",
+		Value: 8,
+	}
+)
+
+// CompletenessCommand reports the share of canonical blocks in a slot range that are present in the archive. It uses
+// the beacon and storage settings of the archiver.
+func CompletenessCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "completeness",
+		Usage: "Report the share of canonical blocks in a slot range that are archived",
+		Flags: []cli.Flag{completenessFromFlag, completenessToFlag, completenessFormatFlag, completenessConcurrencyFlag},
+		Action: func(cliCtx *cli.Context) error {
+			beaconConfig := common.NewBeaconConfig(cliCtx)
+			if err := beaconConfig.Check(); err != nil {
+				return err
+			}
+
+			storageConfig := common.NewStorageConfig(cliCtx)
+			if err := storageConfig.Check(); err != nil {
+				return err
+			}
+
+			format := cliCtx.String(completenessFormatFlag.Name)
+			if format != "text" && format != "json" && format != "csv" {
+				return fmt.Errorf("invalid format: \"%s\"", format)
+			}
+
+			// Logs go to stderr, so that the report on stdout stays machine-parseable
+			l := oplog.NewLogger(os.Stderr, oplog.ReadCLIConfig(cliCtx))
+
+			beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, beaconConfig)
+			if err != nil {
+				return err
+			}
+
+			store, err := storage.NewStorage(storageConfig, nil, l)
+			if err != nil {
+				return err
+			}
+
+			report, err := service.CheckCompleteness(cliCtx.Context, l, beaconClient, store,
+				cliCtx.Uint64(completenessFromFlag.Name), cliCtx.Uint64(completenessToFlag.Name), cliCtx.Int(completenessConcurrencyFlag.Name))
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "json":
+				return report.WriteJSON(os.Stdout)
+			case "csv":
+				return report.WriteCSV(os.Stdout)
+			default:
+				return report.WriteText(os.Stdout)
+			}
+		},
+	}
+}
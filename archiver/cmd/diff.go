@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/base-org/blob-archiver/archiver/service"
+	common "github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	geth "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	diffAFlag = &cli.StringFlag{
+		Name:  "a",
+		Usage: "The first data-store, as a URL: s3://<bucket> (using the s3 settings of the archiver) or file://<directory>. Defaults to the data-store of the archiver",
+	}
+	diffBFlag = &cli.StringFlag{
+		Name:     "b",
+		Usage:    "The second data-store, as a URL like --a",
+		Required: true,
+	}
+	diffSampleRateFlag = &cli.Float64Flag{
+		Name:  "sample-rate",
+		Usage: "The share of blobs present in both data-stores whose content is compared, from 0 (none) to 1 (all)",
+	}
+	diffFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "The output format, options are [text, json]. json writes one object per line, the summary last",
+		Value: "text",
+	}
+	diffConcurrencyFlag = &cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "The maximum number of blobs checked concurrently",
+		Value: 8,
+	}
+)
+
+// DiffCommand compares the blobs in two data-stores, e.g. to validate a migration. Differences are written to stdout as
+// they are found, followed by a summary.
+func DiffCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "diff",
+		Usage: "Report the blobs that differ between two data-stores",
+		Flags: []cli.Flag{diffAFlag, diffBFlag, diffSampleRateFlag, diffFormatFlag, diffConcurrencyFlag},
+		Action: func(cliCtx *cli.Context) error {
+			base := common.NewStorageConfig(cliCtx)
+
+			sampleRate := cliCtx.Float64(diffSampleRateFlag.Name)
+			if sampleRate < 0 || sampleRate > 1 {
+				return fmt.Errorf("invalid sample rate: %v", sampleRate)
+			}
+
+			format := cliCtx.String(diffFormatFlag.Name)
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format: \"%s\"", format)
+			}
+
+			// Logs go to stderr, so that the differences on stdout stay machine-parseable
+			l := oplog.NewLogger(os.Stderr, oplog.ReadCLIConfig(cliCtx))
+
+			a, err := openDiffStore(cliCtx.String(diffAFlag.Name), base, l)
+			if err != nil {
+				return fmt.Errorf("invalid data-store a: %w", err)
+			}
+
+			b, err := openDiffStore(cliCtx.String(diffBFlag.Name), base, l)
+			if err != nil {
+				return fmt.Errorf("invalid data-store b: %w", err)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			report, err := service.DiffDataStores(cliCtx.Context, l, a, b, sampleRate, cliCtx.Int(diffConcurrencyFlag.Name), func(category service.DiffCategory, hash geth.Hash) {
+				if format == "json" {
+					_ = enc.Encode(struct {
+						Category service.DiffCategory `json:"category"`
+						Hash     geth.Hash            `json:"hash"`
+					}{category, hash})
+				} else {
+					fmt.Printf("%s %s\n", category, hash)
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				return enc.Encode(struct {
+					Summary service.DiffReport `json:"summary"`
+				}{report})
+			}
+
+			_, err = fmt.Printf("in both: %d, only in a: %d, only in b: %d, compared: %d, different: %d\n",
+				report.InBoth, report.OnlyInA, report.OnlyInB, report.Compared, report.Different)
+			return err
+		},
+	}
+}
+
+// openDiffStore opens the data-store at the URL, or the data-store of the archiver if the URL is empty.
+func openDiffStore(raw string, base common.StorageConfig, l log.Logger) (storage.DataStore, error) {
+	cfg := base
+	if raw != "" {
+		var err error
+		cfg, err = common.ParseStorageURL(raw, base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+
+	return storage.NewStorage(cfg, nil, l)
+}
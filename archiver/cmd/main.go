@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/base-org/blob-archiver/archiver/events"
 	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/ipfs"
 	"github.com/base-org/blob-archiver/archiver/metrics"
 	"github.com/base-org/blob-archiver/archiver/service"
 	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/logging"
 	"github.com/base-org/blob-archiver/common/storage"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
 	"github.com/ethereum-optimism/optimism/op-service/cliapp"
@@ -34,6 +37,7 @@ func main() {
 	app.Usage = "Archiver service for Ethereum blobs"
 	app.Description = "Service for fetching blobs and archiving them to a datastore"
 	app.Action = cliapp.LifecycleCmd(Main())
+	app.Commands = []*cli.Command{CompletenessCommand(), DiffCommand(), BlobCountsCommand(), ReconcileCommand()}
 
 	err := app.Run(os.Args)
 	if err != nil {
@@ -51,7 +55,16 @@ func Main() cliapp.LifecycleAction {
 			return nil, fmt.Errorf("invalid CLI flags: %w", err)
 		}
 
-		l := oplog.NewLogger(oplog.AppOut(cliCtx), cfg.LogConfig)
+		loggers, err := logging.NewLoggers(oplog.AppOut(cliCtx), cfg.LogConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.StorageConfig.InstanceID != "" {
+			loggers = loggers.With("instance", cfg.StorageConfig.InstanceID)
+		}
+
+		l := loggers.Root()
 		oplog.SetGlobalLogHandler(l.GetHandler())
 		opservice.ValidateEnvVars(flags.EnvVarPrefix, flags.Flags, l)
 
@@ -62,13 +75,26 @@ func Main() cliapp.LifecycleAction {
 			return nil, err
 		}
 
-		storageClient, err := storage.NewStorage(cfg.StorageConfig, l)
+		if cfg.PeerURL != "" {
+			beaconClient = beacon.NewBlobArchiverSource(beaconClient, cfg.PeerURL, cfg.BeaconConfig.BeaconClientTimeout)
+		}
+
+		if cfg.Backfill.Strategy == flags.BackfillStrategySlotRange {
+			beaconClient = beacon.NewSlotRangeClient(beaconClient, cfg.Backfill.RangeConcurrency)
+		}
+
+		storageClient, err := newStorage(cfg, m, loggers.Subsystem(logging.Storage))
+		if err != nil {
+			return nil, err
+		}
+
+		emitter, err := newEmitter(cfg.EventsConfig, m, l)
 		if err != nil {
 			return nil, err
 		}
 
 		l.Info("Initializing Archiver Service")
-		archiver, err := service.NewArchiver(l, cfg, storageClient, beaconClient, m)
+		archiver, err := service.NewArchiver(loggers.Subsystem(logging.Archiver), cfg, storageClient, beaconClient, m, emitter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize archiver: %w", err)
 		}
@@ -78,3 +104,75 @@ func Main() cliapp.LifecycleAction {
 		return service.NewService(l, cfg, api, archiver, m)
 	}
 }
+
+// newStorage creates the data-store of the archiver, mirroring writes to the configured mirror backends if any, and
+// pinning blobs to IPFS if configured.
+func newStorage(cfg flags.ArchiverConfig, m metrics.Metricer, l log.Logger) (storage.DataStore, error) {
+	store, err := newMirrorStorage(cfg, m, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IPFSConfig.URL == "" {
+		return store, nil
+	}
+
+	pinner := ipfs.NewKuboPinner(cfg.IPFSConfig.URL)
+	return ipfs.NewSinkStorage(store, pinner, cfg.IPFSConfig.BufferSize, cfg.IPFSConfig.Timeout, m, l), nil
+}
+
+// newMirrorStorage creates the primary data-store of the archiver, mirroring writes to the configured mirror backends
+// if any.
+func newMirrorStorage(cfg flags.ArchiverConfig, m metrics.Metricer, l log.Logger) (storage.DataStore, error) {
+	primary, err := storage.NewStorage(cfg.StorageConfig, m, l)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.MirrorConfig.Backends) == 0 {
+		return primary, nil
+	}
+
+	backends, err := cfg.MirrorConfig.Parse(cfg.StorageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	mirrors := make([]storage.MirrorBackend, 0, len(backends))
+	for _, backend := range backends {
+		store, err := storage.NewStorage(backend.StorageConfig, m, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mirror %s: %w", backend.Name, err)
+		}
+
+		mirrors = append(mirrors, storage.MirrorBackend{
+			Name:     backend.Name,
+			Store:    store,
+			Required: backend.Required,
+		})
+	}
+
+	store := storage.NewMirrorStorage(primary, mirrors, cfg.MirrorConfig.Concurrency, m, l)
+	if cfg.MirrorConfig.TwoPhaseCommit {
+		if err := store.EnableTwoPhaseCommit(); err != nil {
+			return nil, fmt.Errorf("failed to enable two-phase commit: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+// newEmitter creates the emitter for archived-block events, or returns nil if events are disabled.
+func newEmitter(cfg flags.EventsConfig, m metrics.Metricer, l log.Logger) (*events.Emitter, error) {
+	switch cfg.Backend {
+	case flags.EventsBackendNATS:
+		producer, err := events.NewNATSProducer(cfg.URL, cfg.Topic, l)
+		if err != nil {
+			return nil, err
+		}
+
+		return events.NewEmitter(producer, cfg.BufferSize, cfg.Retry, m, l)
+	default:
+		return nil, nil
+	}
+}
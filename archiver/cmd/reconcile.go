@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/archiver/service"
+	"github.com/base-org/blob-archiver/common/beacon"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	reconcileRootsFlag = &cli.StringFlag{
+		Name:     "roots",
+		Usage:    "The path of the file listing the block roots to reconcile, one hex encoded root per line, - for stdin",
+		Required: true,
+	}
+	reconcileFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "The output format, options are [text, json]. json writes one object per line, the summary last",
+		Value: "text",
+	}
+	reconcileConcurrencyFlag = &cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "The maximum number of roots reconciled concurrently",
+		Value: 8,
+	}
+)
+
+// ReconcileCommand checks that the blobs of a list of block roots, e.g. canonical roots from a trusted source, are
+// archived, and archives the missing ones from the beacon node. It uses the settings of the archiver. The outcome of
+// every root that wasn't already archived (of every root with --format json) is written to stdout, followed by a
+// summary, and the command fails if the blobs of any root couldn't be archived.
+func ReconcileCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "reconcile",
+		Usage: "Archive the blobs of the block roots listed in a file that are missing from the archive",
+		Flags: []cli.Flag{reconcileRootsFlag, reconcileFormatFlag, reconcileConcurrencyFlag},
+		Action: func(cliCtx *cli.Context) error {
+			cfg := flags.ReadConfig(cliCtx)
+			if err := cfg.Check(); err != nil {
+				return fmt.Errorf("invalid CLI flags: %w", err)
+			}
+
+			// The write-ahead log belongs to the archiver service, which may be running alongside
+			cfg.WALPath = ""
+
+			format := cliCtx.String(reconcileFormatFlag.Name)
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format: \"%s\"", format)
+			}
+
+			var in io.Reader = os.Stdin
+			if path := cliCtx.String(reconcileRootsFlag.Name); path != "-" {
+				f, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("failed to open roots: %w", err)
+				}
+				defer f.Close()
+				in = f
+			}
+
+			roots, err := service.ReadRoots(in)
+			if err != nil {
+				return err
+			}
+
+			// Logs go to stderr, so that the results on stdout stay machine-parseable
+			l := oplog.NewLogger(os.Stderr, oplog.ReadCLIConfig(cliCtx))
+			m := metrics.NewMetrics()
+
+			beaconClient, err := beacon.NewBeaconClient(cliCtx.Context, cfg.BeaconConfig)
+			if err != nil {
+				return err
+			}
+
+			store, err := newStorage(cfg, m, l)
+			if err != nil {
+				return err
+			}
+
+			archiver, err := service.NewArchiver(l, cfg, store, beaconClient, m, nil)
+			if err != nil {
+				return fmt.Errorf("failed to initialize archiver: %w", err)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			report, err := archiver.ReconcileRoots(cliCtx.Context, roots, cliCtx.Int(reconcileConcurrencyFlag.Name), func(result service.ReconcileResult) {
+				if format == "json" {
+					_ = enc.Encode(result)
+				} else if result.Status != service.ReconcilePresent {
+					fmt.Printf("%s %s\n", result.Status, result.Root)
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				err = enc.Encode(struct {
+					Summary service.ReconcileReport `json:"summary"`
+				}{report})
+			} else {
+				_, err = fmt.Printf("roots: %d, present: %d, fetched: %d, unknown: %d, skipped: %d, failed: %d\n",
+					report.Roots, report.Present, report.Fetched, report.Unknown, report.Skipped, report.Failed)
+			}
+			if err != nil {
+				return err
+			}
+
+			if !report.Complete() {
+				return fmt.Errorf("%d roots could not be archived", report.Unknown+report.Failed)
+			}
+			return nil
+		},
+	}
+}
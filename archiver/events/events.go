@@ -0,0 +1,215 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// ResultPublished is recorded for events that were handed to the producer.
+	ResultPublished = "published"
+	// ResultDropped is recorded for events that were dropped because the buffer or the retry queue was full.
+	ResultDropped = "dropped"
+	// ResultFailed is recorded for events that were dropped because the producer failed to publish them, after all their
+	// retries if they are retried.
+	ResultFailed = "failed"
+	// ResultRetried is recorded for every failed attempt at publishing an event that is followed by a retry.
+	ResultRetried = "retried"
+
+	publishTimeout = 5 * time.Second
+)
+
+// BlockArchived is published after the blobs of a block were written by the live loop.
+type BlockArchived struct {
+	Root      common.Hash `json:"root"`
+	Slot      uint64      `json:"slot"`
+	Sidecars  int         `json:"sidecars"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Producer publishes encoded events to a message bus.
+type Producer interface {
+	Publish(ctx context.Context, payload []byte) error
+	Close() error
+}
+
+// Metricer records the outcome of every emitted event, see ResultPublished, ResultDropped and ResultFailed, and its
+// retries, see ResultRetried.
+type Metricer interface {
+	RecordArchiveEvent(result string)
+}
+
+// Emitter publishes events in the background through a bounded buffer. Emitting never blocks: if the buffer is full,
+// because the bus is slow or unavailable, the event is dropped and recorded as such. Events that fail to publish are
+// retried with a backoff from a bounded retry queue if retries are configured, see RetryConfig. A nil Emitter drops
+// all events silently, so that callers don't have to check whether events are enabled.
+type Emitter struct {
+	producer Producer
+	queue    chan BlockArchived
+	retries  *retryQueue
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	metrics  Metricer
+	log      log.Logger
+}
+
+// NewEmitter creates an emitter, reading the events left to retry by the previous emitter if the retry queue is
+// persisted.
+func NewEmitter(p Producer, bufferSize int, retries RetryConfig, m Metricer, l log.Logger) (*Emitter, error) {
+	retryQueue, err := openRetryQueue(retries)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Emitter{
+		producer: p,
+		queue:    make(chan BlockArchived, bufferSize),
+		retries:  retryQueue,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+		metrics:  m,
+		log:      l,
+	}
+
+	go e.run()
+
+	return e, nil
+}
+
+// Emit queues the event for publishing, or drops it if the buffer is full.
+func (e *Emitter) Emit(event BlockArchived) {
+	if e == nil {
+		return
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		e.log.Warn("dropping archive event, buffer is full", "hash", event.Root)
+		e.metrics.RecordArchiveEvent(ResultDropped)
+	}
+}
+
+// Close stops publishing and closes the producer. Events still in the buffer are discarded, those waiting to be retried
+// are only kept if the retry queue is persisted.
+func (e *Emitter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+
+	close(e.stopCh)
+
+	select {
+	case <-e.doneCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return e.producer.Close()
+}
+
+func (e *Emitter) run() {
+	defer close(e.doneCh)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		var retryCh <-chan time.Time
+		if i, ok := e.retries.next(); ok {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(e.retries.entries[i].Due))
+			retryCh = timer.C
+		}
+
+		select {
+		case <-e.stopCh:
+			return
+		case event := <-e.queue:
+			e.publishNew(event)
+		case <-retryCh:
+			e.retry()
+		}
+	}
+}
+
+// publishNew publishes an emitted event, queueing it to be retried if that fails and retries are enabled.
+func (e *Emitter) publishNew(event BlockArchived) {
+	err := e.publish(event)
+	if err == nil {
+		e.metrics.RecordArchiveEvent(ResultPublished)
+		return
+	}
+
+	if errors.Is(err, errEncoding) {
+		e.metrics.RecordArchiveEvent(ResultFailed)
+		return
+	}
+
+	if e.retries == nil {
+		e.log.Warn("failed to publish archive event", "err", err, "hash", event.Root)
+		e.metrics.RecordArchiveEvent(ResultFailed)
+		return
+	}
+
+	e.log.Warn("failed to publish archive event, retrying", "err", err, "hash", event.Root)
+	e.metrics.RecordArchiveEvent(ResultRetried)
+	for _, dropped := range e.retries.push(event) {
+		e.log.Warn("dropping archive event, retry queue is full", "hash", dropped.Root)
+		e.metrics.RecordArchiveEvent(ResultDropped)
+	}
+	e.saveRetries()
+}
+
+// retry publishes the event of the retry queue that is due first, dropping it once it has no retries left.
+func (e *Emitter) retry() {
+	i, _ := e.retries.next()
+	entry := e.retries.entries[i]
+
+	if err := e.publish(entry.Event); err == nil {
+		e.metrics.RecordArchiveEvent(ResultPublished)
+		e.retries.remove(i)
+	} else if e.retries.failed(i) {
+		e.log.Warn("failed to retry archive event", "err", err, "hash", entry.Event.Root, "attempts", entry.Attempts+1)
+		e.metrics.RecordArchiveEvent(ResultRetried)
+	} else {
+		e.log.Warn("dropping archive event, out of retries", "err", err, "hash", entry.Event.Root)
+		e.metrics.RecordArchiveEvent(ResultFailed)
+	}
+
+	e.saveRetries()
+}
+
+// saveRetries persists the retry queue. Failing to do so only loses the events to retry after a restart, so it is only
+// logged.
+func (e *Emitter) saveRetries() {
+	if err := e.retries.save(); err != nil {
+		e.log.Warn("failed to persist archive event retries", "err", err)
+	}
+}
+
+// errEncoding is returned by publish for events that can't be encoded, which are never retried.
+var errEncoding = errors.New("failed to encode archive event")
+
+func (e *Emitter) publish(event BlockArchived) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		e.log.Error("failed to encode archive event", "err", err, "hash", event.Root)
+		return errEncoding
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	return e.producer.Publish(ctx, payload)
+}
@@ -0,0 +1,242 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProducer struct {
+	mu        sync.Mutex
+	published [][]byte
+	err       error
+	// block, if set, blocks every publish until it is closed
+	block  chan struct{}
+	closed bool
+}
+
+func (p *fakeProducer) Publish(ctx context.Context, payload []byte) error {
+	if p.block != nil {
+		<-p.block
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.published = append(p.published, payload)
+	return nil
+}
+
+func (p *fakeProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	return nil
+}
+
+func (p *fakeProducer) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.published)
+}
+
+type fakeMetrics struct {
+	mu      sync.Mutex
+	results map[string]int
+}
+
+func (m *fakeMetrics) RecordArchiveEvent(result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.results == nil {
+		m.results = make(map[string]int)
+	}
+	m.results[result]++
+}
+
+func (m *fakeMetrics) get(result string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.results[result]
+}
+
+func blockArchived(slot uint64) BlockArchived {
+	return BlockArchived{
+		Root:      common.BigToHash(common.Big1),
+		Slot:      slot,
+		Sidecars:  2,
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+	}
+}
+
+func TestEmitter_Publishes(t *testing.T) {
+	p := &fakeProducer{}
+	m := &fakeMetrics{}
+	e, err := NewEmitter(p, 4, RetryConfig{}, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	e.Emit(blockArchived(10))
+
+	require.Eventually(t, func() bool { return p.count() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, m.get(ResultPublished))
+
+	var decoded BlockArchived
+	require.NoError(t, json.Unmarshal(p.published[0], &decoded))
+	require.Equal(t, blockArchived(10), decoded)
+
+	require.NoError(t, e.Close(context.Background()))
+	require.True(t, p.closed)
+}
+
+func TestEmitter_DropsWhenBufferIsFull(t *testing.T) {
+	p := &fakeProducer{block: make(chan struct{})}
+	m := &fakeMetrics{}
+	e, err := NewEmitter(p, 2, RetryConfig{}, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	// The first event is taken off the buffer and blocks in the producer, the next two fill the buffer
+	e.Emit(blockArchived(10))
+	require.Eventually(t, func() bool { return len(e.queue) == 0 }, time.Second, 10*time.Millisecond)
+	e.Emit(blockArchived(11))
+	e.Emit(blockArchived(12))
+
+	done := make(chan struct{})
+	go func() {
+		e.Emit(blockArchived(13))
+		e.Emit(blockArchived(14))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("emitting blocked on a full buffer")
+	}
+
+	require.Equal(t, 2, m.get(ResultDropped))
+
+	close(p.block)
+	require.Eventually(t, func() bool { return p.count() == 3 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 3, m.get(ResultPublished))
+}
+
+func TestEmitter_RecordsFailures(t *testing.T) {
+	p := &fakeProducer{err: errors.New("bus unavailable")}
+	m := &fakeMetrics{}
+	e, err := NewEmitter(p, 4, RetryConfig{}, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	e.Emit(blockArchived(10))
+	e.Emit(blockArchived(11))
+
+	require.Eventually(t, func() bool { return m.get(ResultFailed) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 0, m.get(ResultPublished))
+}
+
+func TestEmitter_Nil(t *testing.T) {
+	var e *Emitter
+	e.Emit(blockArchived(10))
+	require.NoError(t, e.Close(context.Background()))
+}
+
+// recoveringProducer fails the first publishes, as a receiver that is down and then recovers would.
+type recoveringProducer struct {
+	fakeProducer
+	failures int
+}
+
+func (p *recoveringProducer) Publish(ctx context.Context, payload []byte) error {
+	p.mu.Lock()
+	if p.failures > 0 {
+		p.failures--
+		p.mu.Unlock()
+		return errors.New("bus unavailable")
+	}
+	p.mu.Unlock()
+
+	return p.fakeProducer.Publish(ctx, payload)
+}
+
+func TestEmitter_RetriesUntilDelivered(t *testing.T) {
+	p := &recoveringProducer{failures: 3}
+	m := &fakeMetrics{}
+	e, err := NewEmitter(p, 4, RetryConfig{MaxRetries: 5, Backoff: 10 * time.Millisecond, QueueSize: 4}, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	e.Emit(blockArchived(10))
+
+	require.Eventually(t, func() bool { return p.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return m.get(ResultPublished) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 3, m.get(ResultRetried))
+	require.Equal(t, 0, m.get(ResultFailed))
+	require.NoError(t, e.Close(context.Background()))
+}
+
+func TestEmitter_DropsAfterRetries(t *testing.T) {
+	p := &fakeProducer{err: errors.New("bus unavailable")}
+	m := &fakeMetrics{}
+	e, err := NewEmitter(p, 4, RetryConfig{MaxRetries: 2, Backoff: time.Millisecond, QueueSize: 4}, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	e.Emit(blockArchived(10))
+
+	require.Eventually(t, func() bool { return m.get(ResultFailed) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 2, m.get(ResultRetried))
+	require.NoError(t, e.Close(context.Background()))
+}
+
+func TestEmitter_RetryQueueDropsOldest(t *testing.T) {
+	p := &fakeProducer{err: errors.New("bus unavailable")}
+	m := &fakeMetrics{}
+	path := filepath.Join(t.TempDir(), "retries.json")
+	retries := RetryConfig{MaxRetries: 5, Backoff: time.Hour, QueueSize: 2, Path: path}
+	e, err := NewEmitter(p, 4, retries, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	for slot := uint64(10); slot < 13; slot++ {
+		e.Emit(blockArchived(slot))
+	}
+
+	require.Eventually(t, func() bool { return m.get(ResultRetried) == 3 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, m.get(ResultDropped))
+	require.NoError(t, e.Close(context.Background()))
+
+	// The events left to retry are persisted, and retried right away by the next emitter
+	p = &fakeProducer{}
+	m = &fakeMetrics{}
+	e, err = NewEmitter(p, 4, retries, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return p.count() == 2 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, e.Close(context.Background()))
+
+	var slots []uint64
+	for _, payload := range p.published {
+		var decoded BlockArchived
+		require.NoError(t, json.Unmarshal(payload, &decoded))
+		slots = append(slots, decoded.Slot)
+	}
+	require.ElementsMatch(t, []uint64{11, 12}, slots)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, "[]", string(data))
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSServer accepts a single connection and performs the server side of the handshake, reporting the CONNECT
+// options and every published message.
+func fakeNATSServer(t *testing.T, info string) (string, chan string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	connects := make(chan string, 1)
+	messages := make(chan string, 10)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "INFO %s\r\n", info)
+
+		connect, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		connects <- strings.TrimSpace(connect)
+
+		if ping, err := r.ReadString('\n'); err != nil || strings.TrimSpace(ping) != "PING" {
+			return
+		}
+		fmt.Fprint(conn, "PONG\r\n")
+
+		// Pings from the server must be answered
+		fmt.Fprint(conn, "PING\r\n")
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			var subject string
+			var size int
+			if _, err := fmt.Sscanf(line, "PUB %s %d", &subject, &size); err != nil {
+				messages <- strings.TrimSpace(line)
+				continue
+			}
+
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			messages <- subject + " " + string(payload[:size])
+		}
+	}()
+
+	return "nats://" + l.Addr().String(), connects, messages
+}
+
+func TestNATSProducer_Publish(t *testing.T) {
+	url, connects, messages := fakeNATSServer(t, `{"server_id":"test"}`)
+	url = strings.Replace(url, "nats://", "nats://archiver:secret@", 1)
+
+	p, err := NewNATSProducer(url, "blobs.archived", testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	defer p.Close()
+
+	require.NoError(t, p.Publish(context.Background(), []byte(`{"slot":10}`)))
+	require.Contains(t, <-connects, `"pass":"secret","pedantic":false,"user":"archiver"`)
+	// The pong is written by the read loop, so it may arrive before or after the message
+	require.ElementsMatch(t, []string{"PONG", `blobs.archived {"slot":10}`}, []string{<-messages, <-messages})
+
+	require.NoError(t, p.Publish(context.Background(), []byte(`{"slot":11}`)))
+	require.Equal(t, `blobs.archived {"slot":11}`, <-messages)
+}
+
+func TestNATSProducer_RejectsTLS(t *testing.T) {
+	url, _, _ := fakeNATSServer(t, `{"tls_required":true}`)
+
+	p, err := NewNATSProducer(url, "blobs.archived", testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	require.ErrorContains(t, p.Publish(context.Background(), []byte(`{}`)), "TLS")
+}
+
+func TestNewNATSProducer_Invalid(t *testing.T) {
+	_, err := NewNATSProducer("kafka://localhost", "blobs", testlog.Logger(t, log.LvlInfo))
+	require.Error(t, err)
+
+	_, err = NewNATSProducer("nats://localhost", "blobs archived", testlog.Logger(t, log.LvlInfo))
+	require.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxRetryBackoff bounds the wait before retrying an event, which doubles with every failed attempt.
+const maxRetryBackoff = time.Hour
+
+// RetryConfig configures the retries of events that failed to publish. Retries are disabled if MaxRetries is 0, in
+// which case events that fail to publish are dropped.
+type RetryConfig struct {
+	// MaxRetries is the number of times an event is published again after the first attempt failed.
+	MaxRetries int
+	// Backoff is the wait before the first retry of an event, which doubles with every further retry.
+	Backoff time.Duration
+	// QueueSize bounds the events waiting to be retried. The oldest events are dropped when it is exceeded.
+	QueueSize int
+	// Path is the file the events waiting to be retried are persisted to, so that they are retried after a restart. The
+	// queue is only kept in memory if it is empty.
+	Path string
+}
+
+// retryEntry is an event waiting to be retried.
+type retryEntry struct {
+	Event    BlockArchived `json:"event"`
+	Attempts int           `json:"attempts"`
+	// Due is when the event is retried next.
+	Due time.Time `json:"due"`
+}
+
+// retryQueue holds the events waiting to be retried, in the order they first failed to publish, and persists them to
+// its file after every change. A nil queue holds nothing.
+type retryQueue struct {
+	cfg     RetryConfig
+	entries []retryEntry
+}
+
+// openRetryQueue creates the retry queue, reading the events left to retry from its file if it is persisted. The events
+// read are due right away.
+func openRetryQueue(cfg RetryConfig) (*retryQueue, error) {
+	if cfg.MaxRetries <= 0 {
+		return nil, nil
+	}
+
+	q := &retryQueue{cfg: cfg}
+	if cfg.Path == "" {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event retry queue: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &q.entries); err != nil {
+		return nil, fmt.Errorf("failed to decode event retry queue: %w", err)
+	}
+
+	now := time.Now()
+	for i := range q.entries {
+		q.entries[i].Due = now
+	}
+
+	return q, nil
+}
+
+// backoff returns the wait before the retry following the given number of attempts.
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	backoff := q.cfg.Backoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxRetryBackoff)
+}
+
+// push queues an event whose first attempt failed, returning the events dropped to make room for it.
+func (q *retryQueue) push(event BlockArchived) []BlockArchived {
+	var dropped []BlockArchived
+	for len(q.entries) >= q.cfg.QueueSize {
+		dropped = append(dropped, q.entries[0].Event)
+		q.entries = q.entries[1:]
+	}
+
+	q.entries = append(q.entries, retryEntry{Event: event, Attempts: 1, Due: time.Now().Add(q.backoff(1))})
+	return dropped
+}
+
+// next returns the index of the entry that is due first, or false if the queue is empty.
+func (q *retryQueue) next() (int, bool) {
+	if q == nil || len(q.entries) == 0 {
+		return 0, false
+	}
+
+	next := 0
+	for i, entry := range q.entries {
+		if entry.Due.Before(q.entries[next].Due) {
+			next = i
+		}
+	}
+
+	return next, true
+}
+
+// failed records another failed attempt of the entry, returning false and removing it if it has no retries left.
+func (q *retryQueue) failed(i int) bool {
+	entry := &q.entries[i]
+	entry.Attempts++
+	if entry.Attempts > q.cfg.MaxRetries {
+		q.remove(i)
+		return false
+	}
+
+	entry.Due = time.Now().Add(q.backoff(entry.Attempts))
+	return true
+}
+
+func (q *retryQueue) remove(i int) {
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+}
+
+// save persists the queue to its file, if it has one. The file is written to a temporary file and renamed into place,
+// so that a crash while saving leaves either version intact.
+func (q *retryQueue) save() error {
+	if q.cfg.Path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(q.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(q.cfg.Path), "."+filepath.Base(q.cfg.Path)+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("failed to save event retry queue: %w", err)
+	}
+
+	if err := os.Rename(tmp, q.cfg.Path); err != nil {
+		return fmt.Errorf("failed to save event retry queue: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileSync writes the data to the file and syncs it to disk.
+func writeFileSync(name string, data []byte) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
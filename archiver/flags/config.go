@@ -2,26 +2,499 @@ package flags
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/base-org/blob-archiver/archiver/events"
 	common "github.com/base-org/blob-archiver/common/flags"
-	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/base-org/blob-archiver/common/logging"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	geth "github.com/ethereum/go-ethereum/common"
 	"github.com/urfave/cli/v2"
 )
 
 type ArchiverConfig struct {
-	LogConfig     oplog.CLIConfig
+	LogConfig     logging.Config
 	MetricsConfig opmetrics.CLIConfig
 	BeaconConfig  common.BeaconConfig
 	StorageConfig common.StorageConfig
 	PollInterval  time.Duration
 	OriginBlock   geth.Hash
 	ListenAddr    string
+	// AdminToken authenticates requests to the admin endpoints, which are disabled if it is empty.
+	AdminToken string
+	SlotIndex  bool
+	// ArchiveBlocks also stores the full signed beacon block of every block whose blobs are stored.
+	ArchiveBlocks bool
+	// CompleteBlocks records the number of blob commitments of every block whose blobs are stored, and fetches stored
+	// blocks with fewer blob sidecars than commitments again instead of skipping them.
+	CompleteBlocks bool
+	// ExecutionIndex records the execution payload block number of every block whose blobs are stored in their header,
+	// and maintains an execution block number index entry for it, written after the blob itself.
+	ExecutionIndex bool
+	// SkipExistsCheck writes blocks conditionally without checking whether they are stored first, treating blocks the
+	// conditional write finds already stored as if the check had found them.
+	SkipExistsCheck bool
+	// VerifySignatures only archives blocks whose header is signed by their proposer, caching the public keys of up to
+	// ValidatorCacheSize validators.
+	VerifySignatures   bool
+	ValidatorCacheSize int
+	// KZGVerification configures verifying the KZG proofs of the blobs of every block archived.
+	KZGVerification KZGVerificationConfig
+	// MaxBlobsPerBlock overrides the maximum number of blobs per block of every fork, which is otherwise detected from
+	// the spec of the beacon node at startup. 0 if it is detected.
+	MaxBlobsPerBlock uint64
+	PruneConfig      PruneConfig
+	SlotFilter       SlotFilterConfig
+	Backfill         BackfillConfig
+	MirrorConfig     MirrorConfig
+	EventsConfig     EventsConfig
+	IPFSConfig       IPFSConfig
+	Dictionary       DictionaryConfig
+	// MaxPendingWrites bounds the blocks being fetched or written at once, 0 for no bound.
+	MaxPendingWrites int
+	// MaxPendingBytes bounds the size of the blob sidecars fetched but not yet written, 0 for no bound.
+	MaxPendingBytes  int
+	OptimisticBlocks OptimisticBlocksAction
+	// LivePrefetchDepth is the number of slots below the head whose headers are fetched concurrently when the live loop
+	// refreshes, 0 to fetch headers one at a time while walking back from the head.
+	LivePrefetchDepth int
+	// HeadDelay is the number of slots a block must be behind the head before the live loop archives it, 0 to archive
+	// the head right away.
+	HeadDelay uint64
+	// LiveMaxHops bounds the blocks the live loop walks back through in a single refresh, 0 for no bound. The blocks
+	// below where a refresh stops are archived by the following refreshes.
+	LiveMaxHops int
+	// WantedInterval is the interval at which the blocks of the wanted queue are fetched, see
+	// storage.WantedStore.WriteWanted, 0 to ignore the queue.
+	WantedInterval time.Duration
+	// WantedConcurrency is the maximum number of blocks of the wanted queue that are fetched at once.
+	WantedConcurrency int
+	// WALPath is the path of the write-ahead log of the blocks being written, disabled if empty.
+	WALPath string
+	// FreshnessSLA is the target for how far behind the head the archived blocks may be.
+	FreshnessSLA FreshnessSLAConfig
+	// CaughtUpLag is the number of slots the newest block archived by the live loop may be behind the current slot for
+	// the archiver to be caught up, rather than catching up.
+	CaughtUpLag uint64
+	// PeerURL is the URL of another blob-archiver's API that blob sidecars are fetched from instead of the beacon node,
+	// if set.
+	PeerURL string
+	// Lease configures the lease of the data store that only lets one of several archivers archive at a time.
+	Lease LeaseConfig
+}
+
+// LeaseConfig configures the lease an archiver must hold in the data store to archive, so that of several archivers
+// sharing a data store for high availability only one archives, and another takes over once its lease expires.
+type LeaseConfig struct {
+	// TTL is how long the lease is held without being renewed, the lease is disabled if it is 0.
+	TTL time.Duration
+	// Holder identifies the archiver holding the lease, it must be unique among the archivers sharing the data store.
+	Holder string
+}
+
+func (c LeaseConfig) Check() error {
+	if c.TTL < 0 {
+		return fmt.Errorf("lease ttl must not be negative")
+	}
+
+	if c.TTL > 0 && c.Holder == "" {
+		return fmt.Errorf("lease holder must be set")
+	}
+
+	return nil
+}
+
+// OptimisticBlocksAction is what the archiver does with blocks the beacon node has only optimistically imported.
+type OptimisticBlocksAction string
+
+const (
+	// OptimisticBlocksTag archives optimistic blocks, marking them as optimistic in their header.
+	OptimisticBlocksTag OptimisticBlocksAction = "tag"
+	// OptimisticBlocksRefuse doesn't archive optimistic blocks, retrying them until they are finalized or verified.
+	OptimisticBlocksRefuse OptimisticBlocksAction = "refuse"
+)
+
+type EventsBackend string
+
+const (
+	EventsBackendNone EventsBackend = ""
+	EventsBackendNATS EventsBackend = "nats"
+)
+
+// EventsConfig configures the message bus that archived-block events are published to.
+type EventsConfig struct {
+	Backend    EventsBackend
+	URL        string
+	Topic      string
+	BufferSize int
+	// Retry configures the retries of events that failed to publish.
+	Retry events.RetryConfig
+}
+
+func (c EventsConfig) Check() error {
+	switch c.Backend {
+	case EventsBackendNone:
+		return nil
+	case EventsBackendNATS:
+	default:
+		return fmt.Errorf("invalid events backend: \"%s\"", c.Backend)
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("events url must be set")
+	}
+
+	if c.Topic == "" {
+		return fmt.Errorf("events topic must be set")
+	}
+
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("events buffer size must be positive")
+	}
+
+	if c.Retry.MaxRetries < 0 {
+		return fmt.Errorf("events retries must not be negative")
+	}
+
+	if c.Retry.MaxRetries > 0 && c.Retry.Backoff <= 0 {
+		return fmt.Errorf("events retry backoff must be positive")
+	}
+
+	if c.Retry.MaxRetries > 0 && c.Retry.QueueSize <= 0 {
+		return fmt.Errorf("events retry queue size must be positive")
+	}
+
+	return nil
+}
+
+// FreshnessSLAConfig is a target for how many slots the newest block archived by the live loop may be behind the current
+// slot. The SLA is breached once the lag has exceeded MaxLag for BreachPeriod, and restored once it has been within
+// MaxLag for BreachPeriod again.
+type FreshnessSLAConfig struct {
+	// MaxLag is the maximum number of slots, the SLA is disabled if it is 0.
+	MaxLag       uint64
+	BreachPeriod time.Duration
+}
+
+func (c FreshnessSLAConfig) Check() error {
+	if c.BreachPeriod < 0 {
+		return fmt.Errorf("sla breach period must not be negative")
+	}
+
+	return nil
+}
+
+// IPFSConfig configures the IPFS node that blobs are pinned to as a secondary sink.
+type IPFSConfig struct {
+	// URL is the URL of the RPC API of the IPFS node, pinning is disabled if it is empty.
+	URL        string
+	BufferSize int
+	Timeout    time.Duration
+}
+
+func (c IPFSConfig) Check() error {
+	if c.URL == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid ipfs url: \"%s\"", c.URL)
+	}
+
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("ipfs buffer size must be positive")
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("ipfs timeout must be positive")
+	}
+
+	return nil
+}
+
+// MirrorConfig contains the secondary data-stores that writes are mirrored to, as URLs (see ParseMirrorBackend). If
+// TwoPhaseCommit is set, blobs are staged in the primary and every required mirror before they are committed, see
+// storage.MirrorStorage.
+type MirrorConfig struct {
+	Backends       []string
+	Concurrency    int
+	TwoPhaseCommit bool
+}
+
+// MirrorBackendConfig is a parsed mirror backend.
+type MirrorBackendConfig struct {
+	Name          string
+	StorageConfig common.StorageConfig
+	Required      bool
+}
+
+func (c MirrorConfig) Check(primary common.StorageConfig) error {
+	if len(c.Backends) == 0 {
+		return nil
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("mirror concurrency must be positive")
+	}
+
+	backends, err := c.Parse(primary)
+	if err != nil {
+		return err
+	}
+
+	for _, backend := range backends {
+		if err := backend.StorageConfig.Check(); err != nil {
+			return fmt.Errorf("invalid mirror %s: %w", backend.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Parse parses the mirror backends. S3 mirrors share the endpoint and credentials of the primary data-store.
+func (c MirrorConfig) Parse(primary common.StorageConfig) ([]MirrorBackendConfig, error) {
+	result := make([]MirrorBackendConfig, 0, len(c.Backends))
+	for _, backend := range c.Backends {
+		parsed, err := ParseMirrorBackend(backend, primary)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+
+	return result, nil
+}
+
+// ParseMirrorBackend parses a mirror backend URL (see common.ParseStorageURL), optionally followed by ?required=true.
+func ParseMirrorBackend(backend string, primary common.StorageConfig) (MirrorBackendConfig, error) {
+	u, err := url.Parse(backend)
+	if err != nil {
+		return MirrorBackendConfig{}, fmt.Errorf("invalid mirror \"%s\": %w", backend, err)
+	}
+
+	required := false
+	if value := u.Query().Get("required"); value != "" {
+		required, err = strconv.ParseBool(value)
+		if err != nil {
+			return MirrorBackendConfig{}, fmt.Errorf("invalid mirror \"%s\": invalid required value", backend)
+		}
+	}
+
+	storageConfig, err := common.ParseStorageURL(backend, primary)
+	if err != nil {
+		return MirrorBackendConfig{}, fmt.Errorf("invalid mirror \"%s\": %w", backend, err)
+	}
+
+	return MirrorBackendConfig{
+		Name:          u.Scheme + "://" + u.Host + u.Path,
+		StorageConfig: storageConfig,
+		Required:      required,
+	}, nil
+}
+
+type BackfillStrategy string
+
+const (
+	// BackfillStrategyParentWalk fetches blocks one at a time, following parent roots.
+	BackfillStrategyParentWalk BackfillStrategy = "parent-walk"
+	// BackfillStrategySlotRange fetches contiguous ranges of slots in a single request.
+	BackfillStrategySlotRange BackfillStrategy = "slot-range"
+)
+
+// BackfillOrder is the direction blocks are backfilled in.
+type BackfillOrder string
+
+const (
+	// BackfillOrderNewestFirst walks from the head down to the first stored block, or the origin block.
+	BackfillOrderNewestFirst BackfillOrder = "newest-first"
+	// BackfillOrderOldestFirst walks slot by slot from the origin block up to the head, so the oldest blocks are stored
+	// first.
+	BackfillOrderOldestFirst BackfillOrder = "oldest-first"
+)
+
+type BackfillConfig struct {
+	Order            BackfillOrder
+	Strategy         BackfillStrategy
+	RangeSize        uint64
+	RangeConcurrency int
+	// NotFoundRetries is the number of times a parent block the beacon node responds to with a 404 is looked up again,
+	// waiting NotFoundRetryInterval in between, before it's accepted as absent. If 0, a 404 is retried like any other
+	// error.
+	NotFoundRetries       int
+	NotFoundRetryInterval time.Duration
+	// Deadline is the wall-clock duration after which backfilling stops, regardless of its progress. Live archiving
+	// continues. 0 for no deadline.
+	Deadline time.Duration
+	// Verify compares the number of blocks in the slot index of each completed backfill's slot range with the number of
+	// canonical blocks the beacon node has in it. It requires the slot index.
+	Verify bool
+	// ChunkSize divides the slots of an oldest-first backfill into chunks of this many slots, aligned to multiples of
+	// it, of which ChunkConcurrency are backfilled at once and checkpointed separately. 0 disables chunking.
+	ChunkSize        uint64
+	ChunkConcurrency int
+	// OriginSlot is the slot of the origin block. A backfill that walks down to it, or below, without reaching the
+	// origin block stops, as the origin block isn't on the canonical chain. If 0, it's looked up from the beacon node.
+	OriginSlot uint64
+	// MaxBlocks is the maximum number of blocks a backfill stores without reaching the origin block before it stops.
+	// 0 for no maximum.
+	MaxBlocks uint64
+	// AvailabilityWindow stops backfills at the first slot of the blob availability window, which is looked up from the
+	// spec of the beacon node when the archiver starts, so that the origin block isn't needed to archive every block
+	// the network guarantees to serve the blobs of.
+	AvailabilityWindow bool
+}
+
+func (c BackfillConfig) Check() error {
+	if c.NotFoundRetries < 0 {
+		return fmt.Errorf("backfill not found retries must not be negative")
+	}
+
+	if c.NotFoundRetries > 0 && c.NotFoundRetryInterval <= 0 {
+		return fmt.Errorf("backfill not found retry interval must be positive")
+	}
+
+	if c.Deadline < 0 {
+		return fmt.Errorf("backfill deadline must not be negative")
+	}
+
+	if c.ChunkSize > 0 {
+		if c.Order != BackfillOrderOldestFirst {
+			return fmt.Errorf("chunked backfill requires the \"%s\" order", BackfillOrderOldestFirst)
+		}
+
+		if c.ChunkConcurrency <= 0 {
+			return fmt.Errorf("backfill chunk concurrency must be positive")
+		}
+	}
+
+	switch c.Order {
+	case BackfillOrderNewestFirst:
+	case BackfillOrderOldestFirst:
+		if c.Strategy != BackfillStrategyParentWalk {
+			return fmt.Errorf("oldest-first backfill walks slots one at a time, it can't use the \"%s\" strategy", c.Strategy)
+		}
+	default:
+		return fmt.Errorf("invalid backfill order: \"%s\"", c.Order)
+	}
+
+	switch c.Strategy {
+	case BackfillStrategyParentWalk:
+		return nil
+	case BackfillStrategySlotRange:
+		if c.RangeSize == 0 {
+			return fmt.Errorf("backfill range size must be positive")
+		}
+
+		if c.RangeConcurrency <= 0 {
+			return fmt.Errorf("backfill range concurrency must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid backfill strategy: \"%s\"", c.Strategy)
+	}
+}
+
+// DictionaryConfig configures the training of the zstd dictionaries compressed blobs are written with.
+type DictionaryConfig struct {
+	// TrainInterval is the interval at which a new dictionary is trained, training is disabled if it is 0.
+	TrainInterval time.Duration
+	// SampleSize is the number of recently written blocks a dictionary is trained from.
+	SampleSize int
+}
+
+func (c DictionaryConfig) Check(storage common.StorageConfig) error {
+	if c.TrainInterval == 0 {
+		return nil
+	}
+
+	if storage.Compression != common.StorageCompressionZstd {
+		return fmt.Errorf("dictionary training requires zstd storage compression")
+	}
+
+	if c.SampleSize <= 0 {
+		return fmt.Errorf("dictionary sample size must be positive")
+	}
+
+	return nil
+}
+
+// KZGVerificationMode is when the KZG proofs of the blobs of a block are verified.
+type KZGVerificationMode string
+
+const (
+	// KZGVerificationOff doesn't verify KZG proofs, trusting the beacon node.
+	KZGVerificationOff KZGVerificationMode = "off"
+	// KZGVerificationSync verifies the KZG proofs of a block before writing it, rejecting blocks with invalid proofs.
+	KZGVerificationSync KZGVerificationMode = "sync"
+	// KZGVerificationAsync writes blocks right away, and verifies their KZG proofs in the background, flagging blocks
+	// with invalid proofs after they were written.
+	KZGVerificationAsync KZGVerificationMode = "async"
+)
+
+type KZGVerificationConfig struct {
+	Mode KZGVerificationMode
+	// QueueSize bounds the blocks waiting for asynchronous verification. Blocks written while the queue is full are not
+	// verified.
+	QueueSize int
+	// Concurrency is the number of blocks verified asynchronously at once.
+	Concurrency int
+	// QuarantineDir is the directory of a file data store that blocks failing asynchronous verification are moved to,
+	// out of the data store, so that they are no longer served. Blocks are only flagged if it is empty.
+	QuarantineDir string
+}
+
+func (c KZGVerificationConfig) Check() error {
+	switch c.Mode {
+	case KZGVerificationOff, KZGVerificationSync:
+		return nil
+	case KZGVerificationAsync:
+	default:
+		return fmt.Errorf("invalid kzg verification mode: \"%s\"", c.Mode)
+	}
+
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("kzg verification queue size must be positive")
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("kzg verification concurrency must be positive")
+	}
+
+	return nil
+}
+
+type PruneConfig struct {
+	Retention   uint64
+	Interval    time.Duration
+	Concurrency int
+	DryRun      bool
+}
+
+func (c PruneConfig) Check() error {
+	if c.Retention == 0 {
+		return nil
+	}
+
+	if c.Interval == 0 {
+		return fmt.Errorf("prune interval must be set")
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("prune concurrency must be positive")
+	}
+
+	return nil
 }
 
 func (c ArchiverConfig) Check() error {
+	if err := c.LogConfig.Check(); err != nil {
+		return err
+	}
+
 	if err := c.StorageConfig.Check(); err != nil {
 		return err
 	}
@@ -34,26 +507,371 @@ func (c ArchiverConfig) Check() error {
 		return fmt.Errorf("archiver poll interval must be set")
 	}
 
-	if c.OriginBlock == (geth.Hash{}) {
+	if c.OriginBlock == (geth.Hash{}) && !c.Backfill.AvailabilityWindow {
 		return fmt.Errorf("invalid origin block")
 	}
 
+	if c.OriginBlock == (geth.Hash{}) && c.Backfill.Order == BackfillOrderOldestFirst {
+		return fmt.Errorf("the \"%s\" backfill order requires the origin block", BackfillOrderOldestFirst)
+	}
+
 	if c.ListenAddr == "" {
 		return fmt.Errorf("archiver listen address must be set")
 	}
 
+	if err := c.PruneConfig.Check(); err != nil {
+		return err
+	}
+
+	if err := c.KZGVerification.Check(); err != nil {
+		return err
+	}
+
+	if err := c.Backfill.Check(); err != nil {
+		return err
+	}
+
+	if err := c.SlotFilter.Check(); err != nil {
+		return err
+	}
+
+	if c.Backfill.Verify && !c.SlotIndex {
+		return fmt.Errorf("backfill verification requires the slot index")
+	}
+
+	if c.SkipExistsCheck && c.CompleteBlocks {
+		return fmt.Errorf("the exists check can't be skipped when checking the completeness of stored blocks")
+	}
+
+	if c.VerifySignatures && c.ValidatorCacheSize <= 0 {
+		return fmt.Errorf("validator cache size must be positive when verifying signatures")
+	}
+
+	if err := c.MirrorConfig.Check(c.StorageConfig); err != nil {
+		return err
+	}
+
+	if err := c.EventsConfig.Check(); err != nil {
+		return err
+	}
+
+	if err := c.IPFSConfig.Check(); err != nil {
+		return err
+	}
+
+	if err := c.FreshnessSLA.Check(); err != nil {
+		return err
+	}
+
+	if err := c.Lease.Check(); err != nil {
+		return err
+	}
+
+	if err := c.Dictionary.Check(c.StorageConfig); err != nil {
+		return err
+	}
+
+	if c.MaxPendingWrites < 0 {
+		return fmt.Errorf("max pending writes must not be negative")
+	}
+
+	if c.MaxPendingBytes < 0 {
+		return fmt.Errorf("max pending bytes must not be negative")
+	}
+
+	if c.WantedInterval < 0 {
+		return fmt.Errorf("wanted interval must not be negative")
+	}
+
+	if c.WantedInterval > 0 && c.WantedConcurrency <= 0 {
+		return fmt.Errorf("wanted concurrency must be positive")
+	}
+
+	if c.LivePrefetchDepth < 0 {
+		return fmt.Errorf("live prefetch depth must not be negative")
+	}
+
+	if c.LiveMaxHops < 0 {
+		return fmt.Errorf("live max hops must not be negative")
+	}
+
+	if c.PeerURL != "" {
+		if u, err := url.Parse(c.PeerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid peer url: \"%s\"", c.PeerURL)
+		}
+	}
+
+	if c.OptimisticBlocks != OptimisticBlocksTag && c.OptimisticBlocks != OptimisticBlocksRefuse {
+		return fmt.Errorf("invalid optimistic blocks action: \"%s\"", c.OptimisticBlocks)
+	}
+
+	return nil
+}
+
+// SlotFilterConfig contains the raw allowlist and denylist of slot ranges. Each list is either a comma or newline
+// separated list of slots and inclusive slot ranges (e.g. "100-200,305"), or a path to a file containing such a list
+// when prefixed with "@". As the lists may have to be read from files, they are parsed and validated once, when the
+// archiver is created, rather than in Check.
+type SlotFilterConfig struct {
+	Allowlist string
+	Denylist  string
+	// MinSlot is the lowest slot archived, 0 to archive from genesis.
+	MinSlot uint64
+	// MinFork is the name of the fork from whose first slot on blocks are archived, e.g. "electra", empty to archive
+	// blocks of all forks. Its epoch is looked up in the spec of the beacon node when the archiver starts, see
+	// SlotFilter.MinSlot.
+	MinFork string
+	// ProposerAllowlist is a list of validator indices and inclusive ranges of them in the format of the slot lists,
+	// only the blocks proposed by which are archived if it isn't empty.
+	ProposerAllowlist string
+}
+
+// Check validates the name of the minimum fork. The lists are validated when they are parsed, see Parse.
+func (c SlotFilterConfig) Check() error {
+	if c.MinFork != "" && strings.Trim(c.MinFork, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return fmt.Errorf("invalid min fork: \"%s\"", c.MinFork)
+	}
+
 	return nil
 }
 
+// SlotRange is an inclusive range of slots.
+type SlotRange struct {
+	From uint64
+	To   uint64
+}
+
+// SlotFilter decides which slots, and the blocks of which proposers, are archived. An empty allowlist allows all slots,
+// and an empty proposer allowlist all proposers.
+type SlotFilter struct {
+	Allow []SlotRange
+	Deny  []SlotRange
+	// MinSlot is the lowest slot archived, the greater of the configured minimum slot and the first slot of the
+	// configured minimum fork once the archiver has looked that up.
+	MinSlot uint64
+	// Proposers are the ranges of validator indices whose blocks are archived.
+	Proposers []SlotRange
+}
+
+// Allows returns true if blobs for the given slot should be archived.
+func (f SlotFilter) Allows(slot uint64) bool {
+	if slot < f.MinSlot {
+		return false
+	}
+
+	if len(f.Allow) > 0 && !containsSlot(f.Allow, slot) {
+		return false
+	}
+
+	return !containsSlot(f.Deny, slot)
+}
+
+// AllowsProposer returns true if blobs of the blocks proposed by the validator with the given index should be archived.
+func (f SlotFilter) AllowsProposer(index uint64) bool {
+	return len(f.Proposers) == 0 || containsSlot(f.Proposers, index)
+}
+
+// AllowsBelow returns true if any slot below the given slot may be archived.
+func (f SlotFilter) AllowsBelow(slot uint64) bool {
+	if slot <= f.MinSlot {
+		return false
+	}
+
+	if len(f.Allow) == 0 {
+		return slot > 0
+	}
+
+	for _, r := range f.Allow {
+		if r.From < slot {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsSlot(ranges []SlotRange, slot uint64) bool {
+	for _, r := range ranges {
+		if slot >= r.From && slot <= r.To {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c SlotFilterConfig) Parse() (SlotFilter, error) {
+	allow, err := parseSlotRanges(c.Allowlist)
+	if err != nil {
+		return SlotFilter{}, fmt.Errorf("invalid slot allowlist: %w", err)
+	}
+
+	deny, err := parseSlotRanges(c.Denylist)
+	if err != nil {
+		return SlotFilter{}, fmt.Errorf("invalid slot denylist: %w", err)
+	}
+
+	proposers, err := parseSlotRanges(c.ProposerAllowlist)
+	if err != nil {
+		return SlotFilter{}, fmt.Errorf("invalid proposer allowlist: %w", err)
+	}
+
+	return SlotFilter{Allow: allow, Deny: deny, MinSlot: c.MinSlot, Proposers: proposers}, nil
+}
+
+func parseSlotRanges(input string) ([]SlotRange, error) {
+	if strings.HasPrefix(input, "@") {
+		contents, err := os.ReadFile(strings.TrimPrefix(input, "@"))
+		if err != nil {
+			return nil, err
+		}
+		input = string(contents)
+	}
+
+	var result []SlotRange
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == '\n' }) {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(field, "-")
+		start, err := strconv.ParseUint(strings.TrimSpace(from), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot: \"%s\"", field)
+		}
+
+		end := start
+		if isRange {
+			end, err = strconv.ParseUint(strings.TrimSpace(to), 10, 64)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid slot range: \"%s\"", field)
+			}
+		}
+
+		result = append(result, SlotRange{From: start, To: end})
+	}
+
+	return result, nil
+}
+
 func ReadConfig(cliCtx *cli.Context) ArchiverConfig {
 	pollInterval, _ := time.ParseDuration(cliCtx.String(ArchiverPollIntervalFlag.Name))
+	pruneInterval, _ := time.ParseDuration(cliCtx.String(ArchiverPruneIntervalFlag.Name))
+	notFoundRetryInterval, _ := time.ParseDuration(cliCtx.String(ArchiverBackfillNotFoundRetryIntervalFlag.Name))
+	backfillDeadline, _ := time.ParseDuration(cliCtx.String(ArchiverBackfillDeadlineFlag.Name))
+	ipfsTimeout, _ := time.ParseDuration(cliCtx.String(ArchiverIPFSTimeoutFlag.Name))
+	dictionaryTrainInterval, _ := time.ParseDuration(cliCtx.String(ArchiverDictionaryTrainIntervalFlag.Name))
+	wantedInterval, _ := time.ParseDuration(cliCtx.String(ArchiverWantedIntervalFlag.Name))
+	slaBreachPeriod, _ := time.ParseDuration(cliCtx.String(ArchiverSLABreachPeriodFlag.Name))
+	eventsRetryBackoff, _ := time.ParseDuration(cliCtx.String(ArchiverEventsRetryBackoffFlag.Name))
+	leaseTTL, _ := time.ParseDuration(cliCtx.String(ArchiverLeaseTTLFlag.Name))
+	leaseHolder := cliCtx.String(ArchiverLeaseHolderFlag.Name)
+	if leaseHolder == "" {
+		leaseHolder, _ = os.Hostname()
+	}
 	return ArchiverConfig{
-		LogConfig:     oplog.ReadCLIConfig(cliCtx),
-		MetricsConfig: opmetrics.ReadCLIConfig(cliCtx),
-		BeaconConfig:  common.NewBeaconConfig(cliCtx),
-		StorageConfig: common.NewStorageConfig(cliCtx),
-		PollInterval:  pollInterval,
-		OriginBlock:   geth.HexToHash(cliCtx.String(ArchiverOriginBlock.Name)),
-		ListenAddr:    cliCtx.String(ArchiverListenAddrFlag.Name),
+		LogConfig:          logging.ReadConfig(cliCtx),
+		MetricsConfig:      opmetrics.ReadCLIConfig(cliCtx),
+		BeaconConfig:       common.NewBeaconConfig(cliCtx),
+		StorageConfig:      common.NewStorageConfig(cliCtx),
+		PollInterval:       pollInterval,
+		OriginBlock:        geth.HexToHash(cliCtx.String(ArchiverOriginBlock.Name)),
+		ListenAddr:         cliCtx.String(ArchiverListenAddrFlag.Name),
+		AdminToken:         cliCtx.String(ArchiverAdminTokenFlag.Name),
+		SlotIndex:          cliCtx.Bool(ArchiverSlotIndexFlag.Name),
+		ArchiveBlocks:      cliCtx.Bool(ArchiverArchiveBlocksFlag.Name),
+		CompleteBlocks:     cliCtx.Bool(ArchiverCompleteBlocksFlag.Name),
+		ExecutionIndex:     cliCtx.Bool(ArchiverExecutionIndexFlag.Name),
+		SkipExistsCheck:    cliCtx.Bool(ArchiverSkipExistsCheckFlag.Name),
+		VerifySignatures:   cliCtx.Bool(ArchiverVerifySignaturesFlag.Name),
+		ValidatorCacheSize: cliCtx.Int(ArchiverValidatorCacheSizeFlag.Name),
+		KZGVerification: KZGVerificationConfig{
+			Mode:          KZGVerificationMode(cliCtx.String(ArchiverKZGVerificationFlag.Name)),
+			QueueSize:     cliCtx.Int(ArchiverKZGVerificationQueueSizeFlag.Name),
+			Concurrency:   cliCtx.Int(ArchiverKZGVerificationConcurrencyFlag.Name),
+			QuarantineDir: cliCtx.String(ArchiverKZGQuarantineDirFlag.Name),
+		},
+		MaxBlobsPerBlock: cliCtx.Uint64(ArchiverMaxBlobsPerBlockFlag.Name),
+		PruneConfig: PruneConfig{
+			Retention:   cliCtx.Uint64(ArchiverPruneRetentionFlag.Name),
+			Interval:    pruneInterval,
+			Concurrency: cliCtx.Int(ArchiverPruneConcurrencyFlag.Name),
+			DryRun:      cliCtx.Bool(ArchiverPruneDryRunFlag.Name),
+		},
+		SlotFilter: SlotFilterConfig{
+			Allowlist: cliCtx.String(ArchiverSlotAllowlistFlag.Name),
+			Denylist:  cliCtx.String(ArchiverSlotDenylistFlag.Name),
+
+			MinSlot:           cliCtx.Uint64(ArchiverMinSlotFlag.Name),
+			MinFork:           cliCtx.String(ArchiverMinForkFlag.Name),
+			ProposerAllowlist: cliCtx.String(ArchiverProposerAllowlistFlag.Name),
+		},
+		Backfill: BackfillConfig{
+			Order:            BackfillOrder(cliCtx.String(ArchiverBackfillOrderFlag.Name)),
+			Strategy:         BackfillStrategy(cliCtx.String(ArchiverBackfillStrategyFlag.Name)),
+			RangeSize:        cliCtx.Uint64(ArchiverBackfillRangeSizeFlag.Name),
+			RangeConcurrency: cliCtx.Int(ArchiverBackfillRangeConcurrencyFlag.Name),
+
+			NotFoundRetries:       cliCtx.Int(ArchiverBackfillNotFoundRetriesFlag.Name),
+			NotFoundRetryInterval: notFoundRetryInterval,
+
+			Deadline: backfillDeadline,
+			Verify:   cliCtx.Bool(ArchiverBackfillVerifyFlag.Name),
+
+			ChunkSize:        cliCtx.Uint64(ArchiverBackfillChunkSizeFlag.Name),
+			ChunkConcurrency: cliCtx.Int(ArchiverBackfillChunkConcurrencyFlag.Name),
+
+			OriginSlot: cliCtx.Uint64(ArchiverBackfillOriginSlotFlag.Name),
+			MaxBlocks:  cliCtx.Uint64(ArchiverBackfillMaxBlocksFlag.Name),
+
+			AvailabilityWindow: cliCtx.Bool(ArchiverBackfillAvailabilityWindowFlag.Name),
+		},
+		MirrorConfig: MirrorConfig{
+			Backends:       cliCtx.StringSlice(ArchiverMirrorBackendsFlag.Name),
+			Concurrency:    cliCtx.Int(ArchiverMirrorConcurrencyFlag.Name),
+			TwoPhaseCommit: cliCtx.Bool(ArchiverMirrorTwoPhaseCommitFlag.Name),
+		},
+		EventsConfig: EventsConfig{
+			Backend:    EventsBackend(cliCtx.String(ArchiverEventsBackendFlag.Name)),
+			URL:        cliCtx.String(ArchiverEventsURLFlag.Name),
+			Topic:      cliCtx.String(ArchiverEventsTopicFlag.Name),
+			BufferSize: cliCtx.Int(ArchiverEventsBufferSizeFlag.Name),
+			Retry: events.RetryConfig{
+				MaxRetries: cliCtx.Int(ArchiverEventsRetriesFlag.Name),
+				Backoff:    eventsRetryBackoff,
+				QueueSize:  cliCtx.Int(ArchiverEventsRetryQueueSizeFlag.Name),
+				Path:       cliCtx.String(ArchiverEventsRetryPathFlag.Name),
+			},
+		},
+		IPFSConfig: IPFSConfig{
+			URL:        cliCtx.String(ArchiverIPFSURLFlag.Name),
+			BufferSize: cliCtx.Int(ArchiverIPFSBufferSizeFlag.Name),
+			Timeout:    ipfsTimeout,
+		},
+		Dictionary: DictionaryConfig{
+			TrainInterval: dictionaryTrainInterval,
+			SampleSize:    cliCtx.Int(ArchiverDictionarySampleSizeFlag.Name),
+		},
+		MaxPendingWrites: cliCtx.Int(ArchiverMaxPendingWritesFlag.Name),
+		MaxPendingBytes:  cliCtx.Int(ArchiverMaxPendingBytesFlag.Name),
+		OptimisticBlocks: OptimisticBlocksAction(cliCtx.String(ArchiverOptimisticBlocksFlag.Name)),
+		PeerURL:          cliCtx.String(ArchiverPeerURLFlag.Name),
+		WALPath:          cliCtx.String(ArchiverWALPathFlag.Name),
+		FreshnessSLA: FreshnessSLAConfig{
+			MaxLag:       cliCtx.Uint64(ArchiverSLAMaxLagFlag.Name),
+			BreachPeriod: slaBreachPeriod,
+		},
+		CaughtUpLag: cliCtx.Uint64(ArchiverCaughtUpLagFlag.Name),
+
+		LivePrefetchDepth: cliCtx.Int(ArchiverLivePrefetchDepthFlag.Name),
+		HeadDelay:         cliCtx.Uint64(ArchiverHeadDelayFlag.Name),
+		LiveMaxHops:       cliCtx.Int(ArchiverLiveMaxHopsFlag.Name),
+		WantedInterval:    wantedInterval,
+		WantedConcurrency: cliCtx.Int(ArchiverWantedConcurrencyFlag.Name),
+		Lease: LeaseConfig{
+			TTL:    leaseTTL,
+			Holder: leaseHolder,
+		},
 	}
 }
@@ -0,0 +1,32 @@
+package ipfs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+)
+
+const (
+	// cidVersion1, rawCodec and sha256Code are the multiformats codes of a CIDv1 of raw content hashed with sha2-256.
+	// Each fits in a single varint byte.
+	cidVersion1 = 0x01
+	rawCodec    = 0x55
+	sha256Code  = 0x12
+	// base32Prefix is the multibase prefix of lowercase, unpadded base32, the default encoding of CIDv1.
+	base32Prefix = "b"
+)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CID returns the CIDv1 of the content stored as a single raw block, e.g. "bafkrei...". This is the CID IPFS assigns to
+// content added with raw leaves that fits in a single chunk, which is the case for every blob, so it can be computed
+// without the IPFS node and used to verify the node stored the content as expected.
+func CID(data []byte) string {
+	digest := sha256.Sum256(data)
+
+	b := make([]byte, 0, 4+len(digest))
+	b = append(b, cidVersion1, rawCodec, sha256Code, byte(len(digest)))
+	b = append(b, digest[:]...)
+
+	return base32Prefix + strings.ToLower(base32Encoding.EncodeToString(b))
+}
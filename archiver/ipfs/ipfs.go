@@ -0,0 +1,160 @@
+package ipfs
+
+import (
+	"context"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// ResultPinned is recorded for blocks whose blobs were all pinned and indexed.
+	ResultPinned = "pinned"
+	// ResultDropped is recorded for blocks that were not pinned because the buffer was full.
+	ResultDropped = "dropped"
+	// ResultFailed is recorded for blocks that were not pinned or indexed because the pinning service or the data store
+	// failed.
+	ResultFailed = "failed"
+)
+
+// Pinner stores and pins content in a content-addressed store under its CID, see CID.
+type Pinner interface {
+	Pin(ctx context.Context, cid string, data []byte) error
+}
+
+// Metricer records the outcome of pinning every written block, see ResultPinned, ResultDropped and ResultFailed.
+type Metricer interface {
+	RecordIPFSPin(result string)
+}
+
+// SinkStorage is a storage.DataStore that pins the blobs of every block written to it to IPFS, as a secondary sink to
+// the data store it wraps. Writes succeed once the wrapped data store is written; the blobs are then pinned in the
+// background through a bounded buffer, and dropped if it is full, so that a slow or unavailable pinning service never
+// blocks archiving. Once every blob of a block is pinned, the CIDs are recorded in the CID index of the wrapped data
+// store, see storage.DataStoreReader.ReadCIDIndex. Failures are only logged and recorded.
+type SinkStorage struct {
+	storage.DataStore
+	pinner  Pinner
+	timeout time.Duration
+	queue   chan storage.BlobData
+	ctx     context.Context
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+	metrics Metricer
+	log     log.Logger
+}
+
+// NewSinkStorage creates a sink pinning blobs with p, waiting at most timeout for every pin and index write.
+func NewSinkStorage(primary storage.DataStore, p Pinner, bufferSize int, timeout time.Duration, m Metricer, l log.Logger) *SinkStorage {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &SinkStorage{
+		DataStore: primary,
+		pinner:    p,
+		timeout:   timeout,
+		queue:     make(chan storage.BlobData, bufferSize),
+		ctx:       ctx,
+		cancel:    cancel,
+		doneCh:    make(chan struct{}),
+		metrics:   m,
+		log:       l,
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Write writes the blob data to the wrapped data store, and queues its blobs for pinning if that succeeded. Blocks
+// without blobs are not pinned or indexed.
+func (s *SinkStorage) Write(ctx context.Context, data storage.BlobData) error {
+	if err := s.DataStore.Write(ctx, data); err != nil {
+		return err
+	}
+
+	s.enqueue(data)
+	return nil
+}
+
+// WriteIfNotExists is Write for conditional writes. Blobs that were already stored are not pinned again, as they were
+// queued for pinning by the write that stored them.
+func (s *SinkStorage) WriteIfNotExists(ctx context.Context, data storage.BlobData) error {
+	if err := s.DataStore.WriteIfNotExists(ctx, data); err != nil {
+		return err
+	}
+
+	s.enqueue(data)
+	return nil
+}
+
+// enqueue queues the blobs of a block for pinning, unless the buffer is full.
+func (s *SinkStorage) enqueue(data storage.BlobData) {
+	if len(data.BlobSidecars.Data) == 0 {
+		return
+	}
+
+	select {
+	case s.queue <- data:
+	default:
+		s.log.Warn("not pinning blobs to ipfs, buffer is full", "hash", data.Header.BeaconBlockHash)
+		s.metrics.RecordIPFSPin(ResultDropped)
+	}
+}
+
+// Close stops pinning, interrupting the pin in progress. Blocks still in the buffer are not pinned.
+func (s *SinkStorage) Close(ctx context.Context) error {
+	s.cancel()
+
+	select {
+	case <-s.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *SinkStorage) run() {
+	defer close(s.doneCh)
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case data := <-s.queue:
+			s.pin(data)
+		}
+	}
+}
+
+func (s *SinkStorage) pin(data storage.BlobData) {
+	hash := data.Header.BeaconBlockHash
+	cids := make([]string, 0, len(data.BlobSidecars.Data))
+
+	for _, sidecar := range data.BlobSidecars.Data {
+		cid := CID(sidecar.Blob[:])
+
+		ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+		err := s.pinner.Pin(ctx, cid, sidecar.Blob[:])
+		cancel()
+
+		if err != nil {
+			s.log.Warn("failed to pin blob to ipfs", "err", err, "hash", hash, "index", sidecar.Index)
+			s.metrics.RecordIPFSPin(ResultFailed)
+			return
+		}
+
+		cids = append(cids, cid)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+
+	if err := s.DataStore.WriteCIDIndex(ctx, hash, cids); err != nil {
+		s.log.Warn("failed to write cid index", "err", err, "hash", hash)
+		s.metrics.RecordIPFSPin(ResultFailed)
+		return
+	}
+
+	s.log.Debug("pinned blobs to ipfs", "hash", hash, "blobs", len(cids))
+	s.metrics.RecordIPFSPin(ResultPinned)
+}
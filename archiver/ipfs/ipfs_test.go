@@ -0,0 +1,210 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinner struct {
+	mu     sync.Mutex
+	pinned map[string][]byte
+	err    error
+	// block, if set, blocks every pin until it is closed
+	block chan struct{}
+}
+
+func (p *fakePinner) Pin(ctx context.Context, cid string, data []byte) error {
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.pinned == nil {
+		p.pinned = make(map[string][]byte)
+	}
+	p.pinned[cid] = data
+	return nil
+}
+
+func (p *fakePinner) get(cid string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pinned[cid]
+}
+
+type fakeMetrics struct {
+	mu      sync.Mutex
+	results map[string]int
+}
+
+func (m *fakeMetrics) RecordIPFSPin(result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.results == nil {
+		m.results = make(map[string]int)
+	}
+	m.results[result]++
+}
+
+func (m *fakeMetrics) get(result string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.results[result]
+}
+
+func setup(t *testing.T, p Pinner, bufferSize int) (*SinkStorage, *storage.FileStorage, *fakeMetrics) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), l)
+	m := &fakeMetrics{}
+
+	s := NewSinkStorage(fs, p, bufferSize, time.Second, m, l)
+	t.Cleanup(func() {
+		require.NoError(t, s.Close(context.Background()))
+	})
+
+	return s, fs, m
+}
+
+func blobData(t *testing.T, hash common.Hash, blobs uint) storage.BlobData {
+	return storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: hash},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, blobs)},
+	}
+}
+
+func TestCID(t *testing.T) {
+	// The CIDs ipfs assigns with `ipfs add --cid-version=1 --raw-leaves`
+	require.Equal(t, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", CID(nil))
+	require.Equal(t, "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e", CID([]byte("hello world")))
+}
+
+func TestSinkStorage_PinsAndIndexes(t *testing.T) {
+	p := &fakePinner{}
+	s, fs, m := setup(t, p, 4)
+
+	data := blobData(t, blobtest.OriginBlock, 3)
+	require.NoError(t, s.Write(context.Background(), data))
+
+	// The primary is written before pinning
+	stored, err := fs.Read(context.Background(), blobtest.OriginBlock)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatJSON
+	require.Equal(t, data, stored)
+
+	require.Eventually(t, func() bool { return m.get(ResultPinned) == 1 }, time.Second, 10*time.Millisecond)
+
+	cids, err := fs.ReadCIDIndex(context.Background(), blobtest.OriginBlock)
+	require.NoError(t, err)
+	require.Len(t, cids, 3)
+	for i, sidecar := range data.BlobSidecars.Data {
+		require.Equal(t, CID(sidecar.Blob[:]), cids[i])
+		require.Equal(t, sidecar.Blob[:], p.get(cids[i]))
+	}
+}
+
+func TestSinkStorage_SkipsBlocksWithoutBlobs(t *testing.T) {
+	s, fs, m := setup(t, &fakePinner{}, 4)
+
+	require.NoError(t, s.Write(context.Background(), blobData(t, blobtest.OriginBlock, 0)))
+
+	exists, err := fs.Exists(context.Background(), blobtest.OriginBlock)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.Empty(t, s.queue)
+	require.Zero(t, m.get(ResultPinned)+m.get(ResultDropped)+m.get(ResultFailed))
+}
+
+func TestSinkStorage_NeverBlocksPrimary(t *testing.T) {
+	p := &fakePinner{block: make(chan struct{})}
+	s, fs, m := setup(t, p, 1)
+
+	// The first block is taken off the buffer and blocks in the pinner, the second fills the buffer
+	require.NoError(t, s.Write(context.Background(), blobData(t, common.Hash{1}, 1)))
+	require.Eventually(t, func() bool { return len(s.queue) == 0 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, s.Write(context.Background(), blobData(t, common.Hash{2}, 1)))
+
+	done := make(chan struct{})
+	go func() {
+		require.NoError(t, s.Write(context.Background(), blobData(t, common.Hash{3}, 1)))
+		require.NoError(t, s.Write(context.Background(), blobData(t, common.Hash{4}, 1)))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writing blocked on a full buffer")
+	}
+
+	require.Equal(t, 2, m.get(ResultDropped))
+	for i := byte(1); i <= 4; i++ {
+		exists, err := fs.Exists(context.Background(), common.Hash{i})
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+
+	close(p.block)
+	require.Eventually(t, func() bool { return m.get(ResultPinned) == 2 }, time.Second, 10*time.Millisecond)
+
+	_, err := fs.ReadCIDIndex(context.Background(), common.Hash{3})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestSinkStorage_RecordsFailures(t *testing.T) {
+	s, fs, m := setup(t, &fakePinner{err: errors.New("pinning service unavailable")}, 4)
+
+	require.NoError(t, s.Write(context.Background(), blobData(t, blobtest.OriginBlock, 2)))
+	require.Eventually(t, func() bool { return m.get(ResultFailed) == 1 }, time.Second, 10*time.Millisecond)
+
+	exists, err := fs.Exists(context.Background(), blobtest.OriginBlock)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// A block is only indexed once all its blobs are pinned
+	_, err = fs.ReadCIDIndex(context.Background(), blobtest.OriginBlock)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+type failingStorage struct {
+	storage.DataStore
+}
+
+func (s *failingStorage) Write(context.Context, storage.BlobData) error {
+	return storage.ErrStorage
+}
+
+func TestSinkStorage_PrimaryFailure(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	s := NewSinkStorage(&failingStorage{storage.NewFileStorage(t.TempDir(), l)}, &fakePinner{}, 4, time.Second, &fakeMetrics{}, l)
+	defer func() {
+		require.NoError(t, s.Close(context.Background()))
+	}()
+
+	require.ErrorIs(t, s.Write(context.Background(), blobData(t, blobtest.OriginBlock, 1)), storage.ErrStorage)
+	require.Empty(t, s.queue)
+}
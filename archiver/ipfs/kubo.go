@@ -0,0 +1,74 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// KuboPinner adds and pins content through the RPC API of an IPFS node, e.g. Kubo (http://localhost:5001), or a
+// pinning service exposing the same /api/v0/add endpoint.
+type KuboPinner struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewKuboPinner(url string) *KuboPinner {
+	return &KuboPinner{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{},
+	}
+}
+
+// Pin adds the content as a single raw block and pins it. It fails if the node assigned the content a different CID,
+// e.g. because it is configured with a different hash function, so that the CID index never points at missing content.
+func (p *KuboPinner) Pin(ctx context.Context, cid string, data []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", cid)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	endpoint := p.url + "/api/v0/add?cid-version=1&raw-leaves=true&hash=sha2-256&pin=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to add content to ipfs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to add content to ipfs: status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return fmt.Errorf("failed to decode ipfs response: %w", err)
+	}
+
+	if added.Hash != cid {
+		return fmt.Errorf("ipfs stored content under %s, expected %s", added.Hash, cid)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package ipfs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newKubo starts a server emulating the add endpoint of the RPC API of an IPFS node, storing content under the CID
+// returned by cid.
+func newKubo(t *testing.T, cid func([]byte) string) (*httptest.Server, map[string][]byte) {
+	added := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/api/v0/add", r.URL.Path)
+		require.Equal(t, "1", r.URL.Query().Get("cid-version"))
+		require.Equal(t, "true", r.URL.Query().Get("raw-leaves"))
+		require.Equal(t, "true", r.URL.Query().Get("pin"))
+
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+
+		hash := cid(data)
+		added[hash] = data
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"Name": hash, "Hash": hash, "Size": "0"}))
+	}))
+	t.Cleanup(server.Close)
+	return server, added
+}
+
+func TestKuboPinner(t *testing.T) {
+	server, added := newKubo(t, CID)
+	p := NewKuboPinner(server.URL + "/")
+
+	data := []byte("blob")
+	require.NoError(t, p.Pin(context.Background(), CID(data), data))
+	require.Equal(t, data, added[CID(data)])
+}
+
+func TestKuboPinner_CIDMismatch(t *testing.T) {
+	server, _ := newKubo(t, func([]byte) string { return "bafkreiother" })
+	p := NewKuboPinner(server.URL)
+
+	data := []byte("blob")
+	require.ErrorContains(t, p.Pin(context.Background(), CID(data), data), "expected "+CID(data))
+}
+
+func TestKuboPinner_ErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"Message":"pinning disabled"}`, http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewKuboPinner(server.URL).Pin(context.Background(), CID(nil), nil)
+	require.ErrorContains(t, err, "status 500")
+	require.ErrorContains(t, err, "pinning disabled")
+}
@@ -1,6 +1,11 @@
 package metrics
 
 import (
+	"context"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/tracing"
 	"github.com/ethereum-optimism/optimism/op-service/metrics"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
 	"github.com/prometheus/client_golang/prometheus"
@@ -8,23 +13,143 @@ import (
 
 type BlockSource string
 
+// PersistStage is a part of persisting the blobs of a block that is timed separately.
+type PersistStage string
+
+// PersistOutcome is whether persisting the blobs of a block wrote them, or found them already stored.
+type PersistOutcome string
+
+// IncompleteBlockStage is where a block with fewer blob sidecars than commitments was found.
+type IncompleteBlockStage string
+
+// WantedResult is the outcome of fetching a block of the wanted queue.
+type WantedResult string
+
+// KZGVerificationResult is the outcome of verifying the KZG proofs of the blobs of a block.
+type KZGVerificationResult string
+
+// FilterReason is why the blobs of a block were not archived because of the slot filter.
+type FilterReason string
+
 var (
 	MetricsNamespace = "blob_archiver"
 
 	BlockSourceBackfill  BlockSource = "backfill"
 	BlockSourceLive      BlockSource = "live"
 	BlockSourceRearchive BlockSource = "rearchive"
+	BlockSourceReconcile BlockSource = "reconcile"
+	BlockSourceSeed      BlockSource = "seed"
+	BlockSourceWanted    BlockSource = "wanted"
+
+	PersistStageFetch PersistStage = "fetch"
+	PersistStageWrite PersistStage = "write"
+
+	// PersistOutcomeExists is a block whose blobs were found stored, so no write was needed.
+	PersistOutcomeExists PersistOutcome = "exists"
+	// PersistOutcomeWritten is a block whose blobs were written.
+	PersistOutcomeWritten PersistOutcome = "written"
+
+	// IncompleteBlockFetched is a block the beacon node returned fewer sidecars for, which is stored anyway.
+	IncompleteBlockFetched IncompleteBlockStage = "fetched"
+	// IncompleteBlockStored is a stored block that is fetched again.
+	IncompleteBlockStored IncompleteBlockStage = "stored"
+
+	// FilterReasonSlots is a block in a slot outside the slot allowlist, or in the denylist.
+	FilterReasonSlots FilterReason = "slots"
+	// FilterReasonMinSlot is a block below the minimum slot, or the first slot of the minimum fork.
+	FilterReasonMinSlot FilterReason = "min_slot"
+	// FilterReasonProposer is a block proposed by a validator outside the proposer allowlist.
+	FilterReasonProposer FilterReason = "proposer"
+
+	// WantedResultFetched is a wanted block that was stored at its first attempt.
+	WantedResultFetched WantedResult = "fetched"
+	// WantedResultRecovered is a wanted block that was stored after earlier attempts failed.
+	WantedResultRecovered WantedResult = "recovered"
+	// WantedResultExists is a wanted block that was found stored, e.g. by a backfill.
+	WantedResultExists WantedResult = "exists"
+	// WantedResultUnknown is a wanted block the beacon node doesn't know, which is removed from the queue.
+	WantedResultUnknown WantedResult = "unknown"
+	// WantedResultFailed is a wanted block that failed to be fetched, and stays queued.
+	WantedResultFailed WantedResult = "failed"
+
+	// KZGVerificationValid is a block whose KZG proofs all verified.
+	KZGVerificationValid KZGVerificationResult = "valid"
+	// KZGVerificationInvalid is a block with a KZG proof that failed to verify, which is rejected or flagged.
+	KZGVerificationInvalid KZGVerificationResult = "invalid"
+	// KZGVerificationDropped is a written block that was not verified, as the asynchronous verification queue was full.
+	KZGVerificationDropped KZGVerificationResult = "dropped"
+	// KZGVerificationFailed is a written block that could not be read back to be verified asynchronously.
+	KZGVerificationFailed KZGVerificationResult = "failed"
 )
 
+// persistDurationBuckets range from 10ms to about 40s, as blocks with many blobs can take seconds to fetch and store.
+var persistDurationBuckets = prometheus.ExponentialBuckets(0.01, 2, 13)
+
 type Metricer interface {
+	storage.Metricer
 	Registry() *prometheus.Registry
 	RecordProcessedBlock(source BlockSource)
+	// RecordBlockPersistDuration and RecordBlockPersistStageDuration attach an exemplar linking to the trace of the
+	// context if it is traced, see tracing.Observe.
+	RecordBlockPersistDuration(ctx context.Context, source BlockSource, duration time.Duration)
+	RecordBlockPersistStageDuration(ctx context.Context, source BlockSource, stage PersistStage, duration time.Duration)
+	RecordBlockPersistOutcome(source BlockSource, outcome PersistOutcome)
 	RecordStoredBlobs(count int)
+	RecordSlotIndexReconciled()
+	RecordPrunedBlobs(count int)
+	RecordMirrorWrite(backend string, success bool)
+	RecordArchiveEvent(result string)
+	SetWriteQueueDepth(depth int)
+	SetWriteQueueBytes(bytes int)
+	RecordExcessBlobs()
+	RecordInvalidSignature()
+	RecordOptimisticBlock(refused bool)
+	RecordIPFSPin(result string)
+	SetBackfillDiscrepancy(discrepancy int)
+	SetDictionaryVersion(version uint32)
+	SetInstanceID(id string)
+	RecordIncompleteBlock(stage IncompleteBlockStage)
+	SetSLABreached(breached bool)
+	SetCaughtUp(caughtUp bool)
+	RecordFilteredBlock(reason FilterReason)
+	RecordWantedBlock(result WantedResult)
+	RecordKZGVerification(result KZGVerificationResult)
+	RecordKZGQuarantine()
+	RecordOriginUnreachable()
+	SetLeaseHeld(held bool)
+	RecordLeaseAcquired()
 }
 
 type metricsRecorder struct {
+	storage.Metricer
 	blockProcessedCounter *prometheus.CounterVec
+	blockPersistDuration  *prometheus.HistogramVec
+	blockPersistStages    *prometheus.HistogramVec
+	blockPersistOutcomes  *prometheus.CounterVec
 	blobsStored           prometheus.Counter
+	slotIndexReconciled   prometheus.Counter
+	blobsPruned           prometheus.Counter
+	mirrorWrites          *prometheus.CounterVec
+	archiveEvents         *prometheus.CounterVec
+	writeQueueDepth       prometheus.Gauge
+	writeQueueBytes       prometheus.Gauge
+	excessBlobs           prometheus.Counter
+	invalidSignatures     prometheus.Counter
+	optimisticBlocks      *prometheus.CounterVec
+	ipfsPins              *prometheus.CounterVec
+	backfillDiscrepancy   prometheus.Gauge
+	dictionaryVersion     prometheus.Gauge
+	instanceInfo          *prometheus.GaugeVec
+	incompleteBlocks      *prometheus.CounterVec
+	slaBreached           prometheus.Gauge
+	caughtUp              prometheus.Gauge
+	filteredBlocks        *prometheus.CounterVec
+	wantedBlocks          *prometheus.CounterVec
+	kzgVerifications      *prometheus.CounterVec
+	kzgQuarantined        prometheus.Counter
+	originUnreachable     prometheus.Counter
+	leaseHeld             prometheus.Gauge
+	leaseAcquisitions     prometheus.Counter
 	registry              *prometheus.Registry
 }
 
@@ -32,17 +157,150 @@ func NewMetrics() Metricer {
 	registry := opmetrics.NewRegistry()
 	factory := metrics.With(registry)
 	return &metricsRecorder{
+		Metricer: storage.NewMetrics(factory, MetricsNamespace),
 		registry: registry,
 		blockProcessedCounter: factory.NewCounterVec(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "blocks_processed",
 			Help:      "number of times processing loop has run",
 		}, []string{"source"}),
+		blockPersistDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "block_persist_duration_seconds",
+			Help:      "time taken to fetch and store the blobs of a block, from fetching its header to the completed write",
+			Buckets:   persistDurationBuckets,
+		}, []string{"source"}),
+		blockPersistStages: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "block_persist_stage_duration_seconds",
+			Help:      "time taken to fetch the blob sidecars of a block from the beacon node, and to write them to storage",
+			Buckets:   persistDurationBuckets,
+		}, []string{"source", "stage"}),
+		blockPersistOutcomes: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "block_persist_outcomes",
+			Help:      "number of blocks persisted, by source and whether their blobs were written or found already stored",
+		}, []string{"source", "outcome"}),
 		blobsStored: factory.NewCounter(prometheus.CounterOpts{
 			Namespace: MetricsNamespace,
 			Name:      "blobs_stored",
 			Help:      "number of blobs stored",
 		}),
+		slotIndexReconciled: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "slot_index_reconciled",
+			Help:      "number of slot index entries that were missing or stale and had to be rewritten",
+		}),
+		blobsPruned: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "blobs_pruned",
+			Help:      "number of blocks whose blobs were deleted for falling out of the retention window",
+		}),
+		mirrorWrites: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "mirror_writes",
+			Help:      "number of writes to each mirrored data-store backend, by result",
+		}, []string{"backend", "result"}),
+		archiveEvents: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "archive_events",
+			Help:      "number of archived-block events emitted to the message bus, by result",
+		}, []string{"result"}),
+		writeQueueDepth: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "write_queue_depth",
+			Help:      "number of blocks whose blobs are being fetched or written",
+		}),
+		writeQueueBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "write_queue_bytes",
+			Help:      "size of the blob sidecars that were fetched but not yet written",
+		}),
+		excessBlobs: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "excess_blob_responses",
+			Help:      "number of blocks rejected because the beacon node returned more blobs than their fork allows",
+		}),
+		invalidSignatures: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "invalid_signatures",
+			Help:      "number of blocks rejected because their header is not signed by their proposer",
+		}),
+		optimisticBlocks: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "optimistic_blocks",
+			Help:      "number of optimistically imported blocks encountered, by whether they were tagged or refused",
+		}, []string{"action"}),
+		ipfsPins: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "ipfs_pins",
+			Help:      "number of blocks whose blobs were pinned to ipfs, by result",
+		}, []string{"result"}),
+		backfillDiscrepancy: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "backfill_discrepancy",
+			Help:      "number of canonical blocks minus the number of stored blocks in the slot range of the last verified backfill",
+		}),
+		dictionaryVersion: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "dictionary_version",
+			Help:      "version of the last trained compression dictionary",
+		}),
+		instanceInfo: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "instance_info",
+			Help:      "always 1, labeled with the id of the instance that the archiver tags the objects it writes with",
+		}, []string{"instance_id"}),
+		incompleteBlocks: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "incomplete_blocks",
+			Help:      "number of blocks with fewer blob sidecars than commitments, by whether they were fetched or found stored",
+		}, []string{"stage"}),
+		slaBreached: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "sla_breached",
+			Help:      "1 while the newest block archived by the live loop is further behind the current slot than the freshness SLA allows",
+		}),
+		caughtUp: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "caught_up",
+			Help:      "1 while the newest block archived by the live loop is within the caught up lag of the current slot, 0 while catching up",
+		}),
+		filteredBlocks: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "blocks_filtered",
+			Help:      "number of blocks whose blobs were not archived because of the slot or proposer filters, by reason",
+		}, []string{"reason"}),
+		wantedBlocks: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "wanted_blocks",
+			Help:      "number of attempts to fetch blocks of the wanted queue, by result",
+		}, []string{"result"}),
+		kzgVerifications: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "kzg_verifications",
+			Help:      "number of blocks whose blob KZG proofs were verified, or were to be verified asynchronously, by result",
+		}, []string{"result"}),
+		kzgQuarantined: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "kzg_quarantined_blocks",
+			Help:      "number of blocks moved out of the data store after failing asynchronous KZG verification",
+		}),
+		originUnreachable: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "backfill_origin_unreachable",
+			Help:      "number of backfills stopped because the origin block can't be reached from the blocks they walked",
+		}),
+		leaseHeld: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "lease_held",
+			Help:      "1 while the archiver holds the lease of the data store and archives, 0 while it waits to take it over",
+		}),
+		leaseAcquisitions: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "lease_acquisitions",
+			Help:      "number of times the archiver acquired the lease of the data store",
+		}),
 	}
 }
 
@@ -57,3 +315,128 @@ func (m *metricsRecorder) RecordStoredBlobs(count int) {
 func (m *metricsRecorder) RecordProcessedBlock(source BlockSource) {
 	m.blockProcessedCounter.WithLabelValues(string(source)).Inc()
 }
+
+func (m *metricsRecorder) RecordBlockPersistDuration(ctx context.Context, source BlockSource, duration time.Duration) {
+	tracing.Observe(ctx, m.blockPersistDuration.WithLabelValues(string(source)), duration.Seconds())
+}
+
+func (m *metricsRecorder) RecordBlockPersistStageDuration(ctx context.Context, source BlockSource, stage PersistStage, duration time.Duration) {
+	tracing.Observe(ctx, m.blockPersistStages.WithLabelValues(string(source), string(stage)), duration.Seconds())
+}
+
+func (m *metricsRecorder) RecordBlockPersistOutcome(source BlockSource, outcome PersistOutcome) {
+	m.blockPersistOutcomes.WithLabelValues(string(source), string(outcome)).Inc()
+}
+
+func (m *metricsRecorder) RecordSlotIndexReconciled() {
+	m.slotIndexReconciled.Inc()
+}
+
+func (m *metricsRecorder) RecordPrunedBlobs(count int) {
+	m.blobsPruned.Add(float64(count))
+}
+
+func (m *metricsRecorder) RecordMirrorWrite(backend string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+
+	m.mirrorWrites.WithLabelValues(backend, result).Inc()
+}
+
+func (m *metricsRecorder) RecordArchiveEvent(result string) {
+	m.archiveEvents.WithLabelValues(result).Inc()
+}
+
+func (m *metricsRecorder) SetWriteQueueDepth(depth int) {
+	m.writeQueueDepth.Set(float64(depth))
+}
+
+func (m *metricsRecorder) SetWriteQueueBytes(bytes int) {
+	m.writeQueueBytes.Set(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordExcessBlobs() {
+	m.excessBlobs.Inc()
+}
+
+func (m *metricsRecorder) RecordInvalidSignature() {
+	m.invalidSignatures.Inc()
+}
+
+func (m *metricsRecorder) RecordOptimisticBlock(refused bool) {
+	action := "tagged"
+	if refused {
+		action = "refused"
+	}
+	m.optimisticBlocks.WithLabelValues(action).Inc()
+}
+
+func (m *metricsRecorder) RecordIPFSPin(result string) {
+	m.ipfsPins.WithLabelValues(result).Inc()
+}
+
+func (m *metricsRecorder) SetBackfillDiscrepancy(discrepancy int) {
+	m.backfillDiscrepancy.Set(float64(discrepancy))
+}
+
+func (m *metricsRecorder) SetDictionaryVersion(version uint32) {
+	m.dictionaryVersion.Set(float64(version))
+}
+
+func (m *metricsRecorder) SetInstanceID(id string) {
+	m.instanceInfo.WithLabelValues(id).Set(1)
+}
+
+func (m *metricsRecorder) RecordIncompleteBlock(stage IncompleteBlockStage) {
+	m.incompleteBlocks.WithLabelValues(string(stage)).Inc()
+}
+
+func (m *metricsRecorder) SetSLABreached(breached bool) {
+	if breached {
+		m.slaBreached.Set(1)
+	} else {
+		m.slaBreached.Set(0)
+	}
+}
+
+func (m *metricsRecorder) SetCaughtUp(caughtUp bool) {
+	if caughtUp {
+		m.caughtUp.Set(1)
+	} else {
+		m.caughtUp.Set(0)
+	}
+}
+
+func (m *metricsRecorder) RecordFilteredBlock(reason FilterReason) {
+	m.filteredBlocks.WithLabelValues(string(reason)).Inc()
+}
+
+func (m *metricsRecorder) RecordWantedBlock(result WantedResult) {
+	m.wantedBlocks.WithLabelValues(string(result)).Inc()
+}
+
+func (m *metricsRecorder) RecordKZGVerification(result KZGVerificationResult) {
+	m.kzgVerifications.WithLabelValues(string(result)).Inc()
+}
+
+func (m *metricsRecorder) RecordKZGQuarantine() {
+	m.kzgQuarantined.Inc()
+}
+
+func (m *metricsRecorder) RecordOriginUnreachable() {
+	m.originUnreachable.Inc()
+}
+
+func (m *metricsRecorder) SetLeaseHeld(held bool) {
+	if held {
+		m.leaseHeld.Set(1)
+	} else {
+		m.leaseHeld.Set(0)
+	}
+}
+
+func (m *metricsRecorder) RecordLeaseAcquired() {
+	m.leaseAcquisitions.Inc()
+}
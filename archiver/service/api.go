@@ -1,6 +1,7 @@
 package service
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -47,10 +48,61 @@ func NewAPI(metrics m.Metricer, logger log.Logger, archiver *Archiver) *API {
 
 	r.Get("/", http.NotFound)
 	r.Post("/rearchive", result.rearchiveBlocks)
+	r.Get("/status", result.syncStatus)
+
+	if token := archiver.cfg.AdminToken; token != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(requireBearerToken(token))
+			r.Post("/selftest", result.selfTest)
+		})
+	}
 
 	return result
 }
 
+// requireBearerToken rejects requests that are not authenticated with the given bearer token.
+func requireBearerToken(token string) func(http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// selfTest runs the self-test of the archiver, see Archiver.selfTest. The report is returned with a 200 if the self-test
+// passed, and a 500 otherwise.
+func (a *API) selfTest(w http.ResponseWriter, r *http.Request) {
+	report := a.archiver.selfTest(r.Context())
+	a.logger.Info("Self-test complete", "result", report.Result, "slot", report.Slot)
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Result == selfTestPass {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		a.logger.Error("Failed to write response", "err", err)
+	}
+}
+
+// syncStatus returns whether the archiver is caught up to the head or catching up, with the lag it was determined from,
+// see Archiver.checkLag.
+func (a *API) syncStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.archiver.getSyncStatus()); err != nil {
+		a.logger.Error("Failed to write response", "err", err)
+	}
+}
+
 type rearchiveResponse struct {
 	Error      string `json:"error,omitempty"`
 	BlockStart uint64 `json:"blockStart"`
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http/httptest"
 	"testing"
@@ -8,8 +9,12 @@ import (
 
 	"github.com/base-org/blob-archiver/archiver/flags"
 	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/base-org/blob-archiver/common/storage/storagetest"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/stretchr/testify/require"
 )
@@ -20,7 +25,7 @@ func setupAPI(t *testing.T) (*API, *storagetest.TestFileStorage) {
 	fs := storagetest.NewTestFileStorage(t, logger)
 	archiver, err := NewArchiver(logger, flags.ArchiverConfig{
 		PollInterval: 10 * time.Second,
-	}, fs, nil, m)
+	}, fs, nil, m, nil)
 	require.NoError(t, err)
 	return NewAPI(m, logger, archiver), fs
 }
@@ -103,3 +108,87 @@ func TestRearchiveHandler(t *testing.T) {
 		})
 	}
 }
+
+func setupSelfTestAPI(t *testing.T) (*API, *storagetest.TestFileStorage) {
+	logger := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+	fs := storagetest.NewTestFileStorage(t, logger)
+	archiver, err := NewArchiver(logger, flags.ArchiverConfig{
+		PollInterval: 10 * time.Second,
+		AdminToken:   "secret",
+	}, fs, beacontest.NewDefaultStubBeaconClient(t), m, nil)
+	require.NoError(t, err)
+	return NewAPI(m, logger, archiver), fs
+}
+
+func runSelfTest(t *testing.T, a *API, token string) (*httptest.ResponseRecorder, SelfTestReport) {
+	request := httptest.NewRequest("POST", "/admin/selftest", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+
+	a.router.ServeHTTP(response, request)
+
+	var report SelfTestReport
+	if response.Code != 401 && response.Code != 404 {
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&report))
+	}
+	return response, report
+}
+
+func stepNames(report SelfTestReport) []string {
+	var names []string
+	for _, step := range report.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestSelfTestPass(t *testing.T) {
+	a, fs := setupSelfTestAPI(t)
+
+	response, report := runSelfTest(t, a, "secret")
+
+	require.Equal(t, 200, response.Code)
+	require.Equal(t, selfTestPass, report.Result)
+	require.Equal(t, blobtest.EndSlot, report.Slot)
+	require.Equal(t, []string{"fetch", "write", "read", "compare", "delete"}, stepNames(report))
+	for _, step := range report.Steps {
+		require.Empty(t, step.Error)
+	}
+
+	// The temporary object is deleted again
+	require.NoError(t, fs.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("temporary object %s was not deleted", hash)
+		return nil
+	}))
+}
+
+func TestSelfTestStorageFailure(t *testing.T) {
+	a, fs := setupSelfTestAPI(t)
+	fs.WritesFailTimes(1)
+
+	response, report := runSelfTest(t, a, "secret")
+
+	require.Equal(t, 500, response.Code)
+	require.Equal(t, selfTestFail, report.Result)
+	require.Equal(t, []string{"fetch", "write"}, stepNames(report))
+	require.Empty(t, report.Steps[0].Error)
+	require.Equal(t, storage.ErrStorage.Error(), report.Steps[1].Error)
+}
+
+func TestSelfTestRequiresToken(t *testing.T) {
+	a, _ := setupSelfTestAPI(t)
+
+	response, _ := runSelfTest(t, a, "")
+	require.Equal(t, 401, response.Code)
+
+	response, _ = runSelfTest(t, a, "wrong")
+	require.Equal(t, 401, response.Code)
+
+	// Without a token the admin endpoints are disabled
+	a, _ = setupAPI(t)
+	response, _ = runSelfTest(t, a, "")
+	require.Equal(t, 404, response.Code)
+}
@@ -3,14 +3,22 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	client "github.com/attestantio/go-eth2-client"
 	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/events"
 	"github.com/base-org/blob-archiver/archiver/flags"
 	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
 	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/ethereum-optimism/optimism/op-service/retry"
 	"github.com/ethereum/go-ethereum/common"
@@ -24,19 +32,105 @@ const (
 	backfillErrorRetryInterval     = 5 * time.Second
 )
 
+// errSidecarBlockMismatch is returned when the blob sidecars that were fetched belong to a different block than the
+// header they were fetched for, see beacon.CheckSidecarHeaders.
+var errSidecarBlockMismatch = beacon.ErrSidecarBlockMismatch
+
+// errBeaconBlockMismatch is returned when the full beacon block that was fetched is not the block of the header it was
+// fetched for.
+var errBeaconBlockMismatch = errors.New("beacon block does not match header")
+
+// errParentNotFound is returned when the beacon node kept responding to the lookup of a parent block during backfill
+// with a 404, after retrying it Backfill.NotFoundRetries times.
+var errParentNotFound = errors.New("parent block not found")
+
+// errOptimisticBlock is returned when an optimistic block is refused, see flags.OptimisticBlocksRefuse.
+var errOptimisticBlock = errors.New("block is optimistic")
+
+// errTooManyBlobs is returned when the beacon node returned more blob sidecars for a block than its fork allows.
+var errTooManyBlobs = errors.New("more blob sidecars than the fork allows")
+
 type BeaconClient interface {
 	client.BlobSidecarsProvider
 	client.BeaconBlockHeadersProvider
+	client.SignedBeaconBlockProvider
+	client.SpecProvider
+	beacon.SignatureProvider
 }
 
-func NewArchiver(l log.Logger, cfg flags.ArchiverConfig, dataStoreClient storage.DataStore, client BeaconClient, m metrics.Metricer) (*Archiver, error) {
+// NewArchiver creates an archiver. If emitter is not nil, an event is emitted for every block archived by the live loop.
+func NewArchiver(l log.Logger, cfg flags.ArchiverConfig, dataStoreClient storage.DataStore, client BeaconClient, m metrics.Metricer, emitter *events.Emitter) (*Archiver, error) {
+	slotFilter, err := cfg.SlotFilter.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var wal *writeAheadLog
+	if cfg.WALPath != "" {
+		wal, err = openWriteAheadLog(cfg.WALPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.StorageConfig.InstanceID != "" {
+		m.SetInstanceID(cfg.StorageConfig.InstanceID)
+	}
+
+	leases, _ := dataStoreClient.(storage.LeaseStore)
+	if cfg.Lease.TTL > 0 && leases == nil {
+		return nil, fmt.Errorf("lease enabled, but the data store doesn't hold leases")
+	}
+
+	dictionaries, _ := dataStoreClient.(storage.DictionaryStore)
+	if cfg.Dictionary.TrainInterval > 0 && dictionaries == nil {
+		return nil, fmt.Errorf("dictionary training enabled, but the data store doesn't hold dictionaries")
+	}
+
+	wanted, _ := dataStoreClient.(storage.WantedStore)
+	if cfg.WantedInterval > 0 && wanted == nil {
+		return nil, fmt.Errorf("wanted queue enabled, but the data store doesn't hold a wanted queue")
+	}
+
+	var samples *dictionarySamples
+	if cfg.Dictionary.TrainInterval > 0 {
+		samples = newDictionarySamples(cfg.Dictionary.SampleSize)
+	}
+
+	var freshness *freshnessSLA
+	if cfg.FreshnessSLA.MaxLag > 0 {
+		freshness = &freshnessSLA{maxLag: cfg.FreshnessSLA.MaxLag, period: cfg.FreshnessSLA.BreachPeriod}
+	}
+
+	var kzgQueue chan common.Hash
+	if cfg.KZGVerification.Mode == flags.KZGVerificationAsync {
+		kzgQueue = make(chan common.Hash, cfg.KZGVerification.QueueSize)
+	}
+
+	var quarantine storage.DataStore
+	if cfg.KZGVerification.QuarantineDir != "" {
+		quarantine = storage.NewFileStorage(cfg.KZGVerification.QuarantineDir, l)
+	}
+
 	return &Archiver{
-		log:             l,
-		cfg:             cfg,
-		dataStoreClient: dataStoreClient,
-		metrics:         m,
-		beaconClient:    client,
-		stopCh:          make(chan struct{}),
+		log:               l,
+		cfg:               cfg,
+		dataStoreClient:   dataStoreClient,
+		leases:            leases,
+		dictionaries:      dictionaries,
+		wanted:            wanted,
+		metrics:           m,
+		beaconClient:      client,
+		slotFilter:        slotFilter,
+		events:            emitter,
+		writeQueue:        newWriteQueue(cfg.MaxPendingWrites, cfg.MaxPendingBytes, m),
+		wal:               wal,
+		dictionarySamples: samples,
+		freshness:         freshness,
+		kzgQueue:          kzgQueue,
+		quarantine:        quarantine,
+		clock:             beacon.SystemClock{},
+		stopCh:            make(chan struct{}),
 	}, nil
 }
 
@@ -44,130 +138,969 @@ type Archiver struct {
 	log             log.Logger
 	cfg             flags.ArchiverConfig
 	dataStoreClient storage.DataStore
-	beaconClient    BeaconClient
-	metrics         metrics.Metricer
-	stopCh          chan struct{}
+	// leases, dictionaries and wanted are the optional interfaces of the data store, nil if it doesn't implement them.
+	leases       storage.LeaseStore
+	dictionaries storage.DictionaryStore
+	wanted       storage.WantedStore
+	beaconClient BeaconClient
+	metrics      metrics.Metricer
+	slotFilter   flags.SlotFilter
+	// minForkSlot is the first slot of the configured minimum fork once it was looked up at startup, see filter.
+	minForkSlot atomic.Uint64
+	// availabilitySlot is the first slot of the blob availability window once it was looked up at startup, if backfills
+	// stop at it, see filter.
+	availabilitySlot atomic.Uint64
+	events           *events.Emitter
+	writeQueue       *writeQueue
+	wal              *writeAheadLog
+	// dictionarySamples are the blocks compression dictionaries are trained from, nil if training is disabled.
+	dictionarySamples *dictionarySamples
+	// liveTip is the head the live loop last walked back from, so later walks don't have to go past it.
+	liveTip     phase0.Root
+	liveTipSlot uint64
+	// liveGaps are the blocks live refreshes stopped at after LiveMaxHops blocks, whose parents are yet to be walked,
+	// newest last. See walkLiveGaps.
+	liveGaps []*v1.BeaconBlockHeader
+	// liveSlot is the slot of the newest block the live loop found archived, whose lag behind the current slot is
+	// checked against the freshness SLA, which is nil if it is disabled. See checkLag.
+	liveSlot  uint64
+	freshness *freshnessSLA
+	// kzgQueue holds the written blocks waiting for asynchronous KZG verification, nil unless KZG proofs are verified
+	// asynchronously. Blocks failing it are moved to quarantine, unless it is nil. See verifyStored.
+	kzgQueue   chan common.Hash
+	quarantine storage.DataStore
+	clock      beacon.Clock
+	stopCh     chan struct{}
+	// workers are the goroutines started by run, which runWithLease waits for once it lost or released the lease.
+	workers sync.WaitGroup
+
+	// wantedFailures counts the failed attempts to fetch the blocks of the wanted queue, see fetchWanted.
+	wantedFailures wantedFailures
+
+	// status is the sync status as of the last check of the lag, see checkLag.
+	statusMu      sync.Mutex
+	status        syncStatus
+	statusChecked bool
+
+	// slotClock is fetched from the beacon node once it is first needed, see getSlotClock.
+	slotClockMu sync.Mutex
+	slotClock   *beacon.SlotClock
+
+	// blobLimits is fetched from the beacon node once it is first needed, see getBlobLimits.
+	blobLimitsMu sync.Mutex
+	blobLimits   *beacon.BlobLimits
+
+	// proposerVerifier is created once it is first needed if signatures are verified, see checkSignature.
+	proposerVerifierMu sync.Mutex
+	proposerVerifier   *beacon.ProposerVerifier
 }
 
 // Start starts archiving blobs. It begins polling the beacon node for the latest blocks and persisting blobs for
 // them. Concurrently it'll also begin a backfill process (see backfillBlobs) to store all blobs from the current head
 // to the previously stored blocks. This ensures that during restarts or outages of an archiver, any gaps will be
-// filled in.
+// filled in. If the lease is enabled, it only archives while it holds the lease of the data store, see runWithLease.
 func (a *Archiver) Start(ctx context.Context) error {
+	if err := a.detectBlobLimits(ctx); err != nil {
+		return err
+	}
+
+	if err := a.detectMinFork(ctx); err != nil {
+		return err
+	}
+
+	if err := a.detectAvailabilityWindow(ctx); err != nil {
+		return err
+	}
+
+	if a.cfg.Lease.TTL > 0 {
+		return a.runWithLease(ctx)
+	}
+
+	return a.run(ctx)
+}
+
+// run archives blobs until the archiver is stopped or the context is cancelled, see Start.
+func (a *Archiver) run(ctx context.Context) error {
+	interrupted := a.replayWriteAheadLog(ctx)
+
+	attemptCtx := withPersistAttempt(withBlockSource(ctx, metrics.BlockSourceSeed))
 	currentBlock, _, err := retry.Do2(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
-		return a.persistBlobsForBlockToS3(ctx, "head", false)
+		head, err := a.liveHead(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		return a.persistBlobsForBlockToS3(attemptCtx, head, false)
 	})
 
 	if err != nil {
 		a.log.Error("failed to seed archiver with initial block", "err", err)
 		return err
 	}
+	a.liveSlot = uint64(currentBlock.Header.Message.Slot)
+
+	// The blocks below an interrupted write may not have been written either, and the backfill from the head stops at
+	// the first stored block, so a backfill is resumed from every completed write
+	starts := append([]*v1.BeaconBlockHeader{currentBlock}, interrupted...)
+	a.spawn(func() { a.runBackfills(ctx, starts) })
+
+	if a.cfg.PruneConfig.Retention > 0 {
+		a.spawn(func() { a.pruneLoop(ctx) })
+	}
+
+	if a.cfg.Dictionary.TrainInterval > 0 {
+		a.spawn(func() { a.dictionaryLoop(ctx) })
+	}
+
+	if a.cfg.WantedInterval > 0 {
+		a.spawn(func() { a.wantedLoop(ctx) })
+	}
 
-	go a.backfillBlobs(ctx, currentBlock)
+	if a.kzgQueue != nil {
+		for i := 0; i < a.cfg.KZGVerification.Concurrency; i++ {
+			a.spawn(func() { a.kzgVerifyLoop(ctx) })
+		}
+	}
 
 	return a.trackLatestBlocks(ctx)
 }
 
-// Stops the archiver service.
+// spawn runs f in a goroutine that is waited for by workers, see runWithLease.
+func (a *Archiver) spawn(f func()) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		f()
+	}()
+}
+
+// Stops the archiver service. The data store is closed too if it runs in the background, e.g. to pin blobs to IPFS.
 func (a *Archiver) Stop(ctx context.Context) error {
 	close(a.stopCh)
-	return nil
+
+	if closer, ok := a.dataStoreClient.(interface{ Close(context.Context) error }); ok {
+		if err := closer.Close(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := a.wal.close(); err != nil {
+		return err
+	}
+
+	return a.events.Close(ctx)
 }
 
 // persistBlobsForBlockToS3 fetches the blobs for a given block and persists them to S3. It returns the block header
 // and a boolean indicating whether the blobs already existed in S3 and any errors that occur.
-// If the blobs are already stored, it will not overwrite the data. Currently, the archiver does not
-// perform any validation of the blobs, it assumes a trusted beacon node. See:
-// https://github.com/base-org/blob-archiver/issues/4.
+// If the blobs are already stored, it will not overwrite the data. Unless KZG or signature verification is enabled, the
+// archiver does not perform any validation of the blobs, it assumes a trusted beacon node. See:
+// https://github.com/base-org/blob-archiver/issues/4. Retries sharing a persist attempt through their context, see
+// withPersistAttempt, reuse what earlier tries fetched from the beacon node, so that e.g. retrying a failed write only
+// writes again.
 func (a *Archiver) persistBlobsForBlockToS3(ctx context.Context, blockIdentifier string, overwrite bool) (*v1.BeaconBlockHeader, bool, error) {
-	currentHeader, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
-		Block: blockIdentifier,
-	})
+	result, err := a.persistBlock(ctx, blockIdentifier, overwrite)
+	return result.header, result.exists, err
+}
+
+type blockSourceKey struct{}
+
+// withBlockSource returns a context recording the given source in the metrics of the blocks persisted with it. Blocks
+// persisted with a context without a source are recorded as live.
+func withBlockSource(ctx context.Context, source metrics.BlockSource) context.Context {
+	return context.WithValue(ctx, blockSourceKey{}, source)
+}
+
+func blockSourceOf(ctx context.Context) metrics.BlockSource {
+	if source, ok := ctx.Value(blockSourceKey{}).(metrics.BlockSource); ok {
+		return source
+	}
+	return metrics.BlockSourceLive
+}
+
+// persistResult is the outcome of persisting the blobs of a block.
+type persistResult struct {
+	header *v1.BeaconBlockHeader
+	// exists is true if the blobs already existed in storage.
+	exists bool
+	// written is true if the blobs were written, with sidecars the number of sidecars.
+	written  bool
+	sidecars int
+}
+
+// persistBlock is persistBlobsForBlockToS3, but also reports whether the blobs were written. Retries sharing the
+// persist attempt of the context reuse the header fetched by an earlier try, see withPersistAttempt.
+func (a *Archiver) persistBlock(ctx context.Context, blockIdentifier string, overwrite bool) (persistResult, error) {
+	started := time.Now()
+	attempt := persistAttemptOf(ctx)
+	currentHeader, ok := attempt.header(blockIdentifier)
+	if !ok {
+		var err error
+		currentHeader, err = a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+			Block: blockIdentifier,
+		})
+
+		if err != nil {
+			a.log.Error("failed to fetch latest beacon block header", "err", err)
+			return persistResult{}, err
+		}
 
+		attempt.setHeader(blockIdentifier, currentHeader)
+	}
+
+	result, err := a.persistHeader(ctx, currentHeader, overwrite, started)
+	if errors.Is(err, errSidecarBlockMismatch) {
+		// The identifier resolves to another block by now, so the retry fetches its header again
+		attempt.forgetHeader(blockIdentifier)
+	}
+
+	return result, err
+}
+
+// persistHeader is persistBlock for a block whose header has already been fetched, which started at the given time.
+// The time taken to persist blocks that are written, and to fetch and write their blobs, is recorded by the source of
+// the context, see withBlockSource, as is whether the blobs were written or found already stored.
+func (a *Archiver) persistHeader(ctx context.Context, currentHeader *api.Response[*v1.BeaconBlockHeader], overwrite bool, started time.Time) (persistResult, error) {
+	skip, exists, err := a.skipBlock(ctx, currentHeader.Data, overwrite)
+	if err != nil {
+		return persistResult{}, err
+	}
+
+	source := blockSourceOf(ctx)
+	if skip {
+		if exists {
+			a.metrics.RecordBlockPersistOutcome(source, metrics.PersistOutcomeExists)
+		}
+		return persistResult{header: currentHeader.Data, exists: exists}, nil
+	}
+
+	// Stored blobs that aren't skipped are incomplete, so they are replaced
+	overwrite = overwrite || exists
+
+	if err := a.writeQueue.acquire(ctx, 1); err != nil {
+		return persistResult{}, err
+	}
+	defer a.writeQueue.release(1)
+
+	fetchStarted := time.Now()
+	blobSidecars, err := a.fetchBlobSidecars(ctx, currentHeader.Data)
+	if err != nil {
+		a.log.Error("failed to fetch blob sidecars", "err", err)
+		return persistResult{}, err
+	}
+	a.metrics.RecordBlockPersistStageDuration(ctx, source, metrics.PersistStageFetch, time.Since(fetchStarted))
+
+	a.log.Debug("fetched blob sidecars", "count", len(blobSidecars.Data))
+
+	size := (&storage.BlobSidecars{Data: blobSidecars.Data}).SizeSSZ()
+	a.writeQueue.addBytes(size)
+	defer a.writeQueue.releaseBytes(size)
+
+	optimistic := beacon.IsOptimistic(currentHeader.Metadata) || beacon.IsOptimistic(blobSidecars.Metadata)
+	writeStarted := time.Now()
+	stored, err := a.writeBlobSidecars(ctx, currentHeader.Data, blobSidecars.Data, optimistic, overwrite)
 	if err != nil {
-		a.log.Error("failed to fetch latest beacon block header", "err", err)
-		return nil, false, err
+		return persistResult{}, err
+	}
+
+	if stored {
+		a.metrics.RecordBlockPersistOutcome(source, metrics.PersistOutcomeExists)
+		return persistResult{header: currentHeader.Data, exists: true}, nil
+	}
+	a.metrics.RecordBlockPersistStageDuration(ctx, source, metrics.PersistStageWrite, time.Since(writeStarted))
+	a.metrics.RecordBlockPersistDuration(ctx, source, time.Since(started))
+	a.metrics.RecordBlockPersistOutcome(source, metrics.PersistOutcomeWritten)
+
+	return persistResult{
+		header:   currentHeader.Data,
+		exists:   exists,
+		written:  true,
+		sidecars: len(blobSidecars.Data),
+	}, nil
+}
+
+// skipBlock returns true if the blobs for the given block should not be written, and whether they already exist in
+// storage. Blocks outside the slot filter, or not proposed by an allowed proposer, are never stored, but are still
+// reported as processed so the walk continues. If the completeness of blocks is checked, stored blocks with fewer blob
+// sidecars than commitments are not skipped.
+func (a *Archiver) skipBlock(ctx context.Context, header *v1.BeaconBlockHeader, overwrite bool) (bool, bool, error) {
+	filter := a.filter()
+	if slot := uint64(header.Header.Message.Slot); !filter.Allows(slot) {
+		a.log.Debug("skipping block outside slot filter", "hash", header.Root, "slot", slot)
+		if slot < filter.MinSlot {
+			a.metrics.RecordFilteredBlock(metrics.FilterReasonMinSlot)
+		} else {
+			a.metrics.RecordFilteredBlock(metrics.FilterReasonSlots)
+		}
+		return true, false, nil
+	}
+
+	if proposer := uint64(header.Header.Message.ProposerIndex); !filter.AllowsProposer(proposer) {
+		a.log.Debug("skipping block of proposer outside allowlist", "hash", header.Root, "proposer", proposer)
+		a.metrics.RecordFilteredBlock(metrics.FilterReasonProposer)
+		return true, false, nil
+	}
+
+	// Without the exists check, stored blocks are found by the conditional write instead, see writeBlobSidecars
+	if a.cfg.SkipExistsCheck && !overwrite {
+		return false, false, nil
 	}
 
-	exists, err := a.dataStoreClient.Exists(ctx, common.Hash(currentHeader.Data.Root))
+	exists, err := a.dataStoreClient.Exists(ctx, common.Hash(header.Root))
 	if err != nil {
 		a.log.Error("failed to check if blob exists", "err", err)
-		return nil, false, err
+		return false, false, err
+	}
+
+	if exists && !overwrite && a.cfg.CompleteBlocks {
+		incomplete, err := a.storedIncomplete(ctx, header)
+		if err != nil {
+			return false, false, err
+		}
+
+		if incomplete {
+			return false, true, nil
+		}
 	}
 
 	if exists && !overwrite {
-		a.log.Debug("blob already exists", "hash", currentHeader.Data.Root)
-		return currentHeader.Data, true, nil
+		a.log.Debug("blob already exists", "hash", header.Root)
+
+		if a.cfg.SlotIndex {
+			if err := a.reconcileSlotIndex(ctx, header); err != nil {
+				return false, false, err
+			}
+		}
+
+		return true, true, nil
 	}
 
-	blobSidecars, err := a.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
-		Block: currentHeader.Data.Root.String(),
-	})
+	return false, exists, nil
+}
 
+// storedIncomplete returns true if the stored blobs of the block are fewer than the blob commitments recorded with them.
+func (a *Archiver) storedIncomplete(ctx context.Context, header *v1.BeaconBlockHeader) (bool, error) {
+	stored, err := a.dataStoreClient.Read(ctx, common.Hash(header.Root))
 	if err != nil {
-		a.log.Error("failed to fetch blob sidecars", "err", err)
-		return nil, false, err
+		a.log.Error("failed to read stored blob", "err", err, "hash", header.Root)
+		return false, err
 	}
 
-	a.log.Debug("fetched blob sidecars", "count", len(blobSidecars.Data))
+	if !stored.Header.Incomplete(len(stored.BlobSidecars.Data)) {
+		return false, nil
+	}
+
+	a.log.Warn("stored block is incomplete, fetching it again", "hash", header.Root, "slot", stored.Header.Slot,
+		"sidecars", len(stored.BlobSidecars.Data), "commitments", stored.Header.Commitments)
+	a.metrics.RecordIncompleteBlock(metrics.IncompleteBlockStored)
+	return true, nil
+}
+
+// writeBlobSidecars writes the blob sidecars of the given block to storage. Blocks with more sidecars than their fork
+// allows are rejected with errTooManyBlobs, as they indicate a faulty or tampered beacon node, and so are blocks whose
+// header isn't signed by their proposer with beacon.ErrInvalidSignature, if signatures are verified. Optimistic blocks
+// are either tagged in their header or refused with errOptimisticBlock, depending on the configuration. Unless
+// overwrite is set, the blobs are written conditionally, so that archivers writing the same block concurrently never
+// overwrite each other; finding the same blobs already stored counts as a successful write. If the exists check is
+// skipped, blobs the conditional write finds already stored are kept, even if they differ, as the check would have
+// skipped them, and true is returned, so that walks stop at them. Depending on the configuration, blocks with invalid
+// KZG proofs are rejected with errInvalidKZGProof, or written blocks are queued to have their proofs verified
+// asynchronously.
+func (a *Archiver) writeBlobSidecars(ctx context.Context, header *v1.BeaconBlockHeader, sidecars []*deneb.BlobSidecar, optimistic bool, overwrite bool) (bool, error) {
+	if err := a.checkBlobCount(ctx, header, len(sidecars)); err != nil {
+		return false, err
+	}
+
+	if err := a.checkSignature(ctx, header); err != nil {
+		return false, err
+	}
+
+	if err := a.checkKZGProofs(common.Hash(header.Root), sidecars); err != nil {
+		return false, err
+	}
+
+	if optimistic {
+		refuse := a.cfg.OptimisticBlocks == flags.OptimisticBlocksRefuse
+		a.metrics.RecordOptimisticBlock(refuse)
+		if refuse {
+			a.log.Warn("refusing to archive optimistic block", "hash", header.Root, "slot", header.Header.Message.Slot)
+			return false, fmt.Errorf("%w: %s", errOptimisticBlock, header.Root)
+		}
+	}
 
 	blobData := storage.BlobData{
 		Header: storage.Header{
-			BeaconBlockHash: common.Hash(currentHeader.Data.Root),
+			BeaconBlockHash: common.Hash(header.Root),
+			Slot:            uint64(header.Header.Message.Slot),
+			Optimistic:      optimistic,
 		},
-		BlobSidecars: storage.BlobSidecars{Data: blobSidecars.Data},
+		BlobSidecars: storage.BlobSidecars{Data: sidecars},
+	}
+
+	if a.cfg.ArchiveBlocks || a.cfg.CompleteBlocks || a.cfg.ExecutionIndex {
+		block, err := a.fetchBlock(ctx, header)
+		if err != nil {
+			return false, err
+		}
+
+		if a.cfg.CompleteBlocks {
+			if err := a.recordCommitments(&blobData.Header, block, len(sidecars)); err != nil {
+				return false, err
+			}
+		}
+
+		if a.cfg.ExecutionIndex {
+			number, err := block.ExecutionBlockNumber()
+			if err != nil {
+				return false, fmt.Errorf("failed to read execution block number of block %s: %w", header.Root, err)
+			}
+			blobData.Header.ExecutionBlockNumber = number
+		}
+
+		// The block is written before its blobs, so that blocks whose blobs are stored always have their block stored too
+		if a.cfg.ArchiveBlocks {
+			if err := a.dataStoreClient.WriteBlock(ctx, common.Hash(header.Root), block); err != nil {
+				a.log.Error("failed to write beacon block", "err", err, "hash", header.Root)
+				return false, err
+			}
+		}
+	}
+
+	if err := a.wal.begin(blobData.Header.BeaconBlockHash, blobData.Header.Slot); err != nil {
+		a.log.Error("failed to record write in write-ahead log", "err", err, "hash", header.Root)
+		return false, err
 	}
 
-	// The blob that is being written has not been validated. It is assumed that the beacon node is trusted.
-	err = a.dataStoreClient.Write(ctx, blobData)
+	// Unless KZG proofs are verified synchronously, the blob that is being written has not been validated. It is
+	// assumed that the beacon node is trusted.
+	var err error
+	switch {
+	case a.cfg.SlotIndex && overwrite:
+		err = storage.WriteWithSlotIndex(ctx, a.dataStoreClient, blobData)
+	case a.cfg.SlotIndex:
+		err = storage.WriteIfNotExistsWithSlotIndex(ctx, a.dataStoreClient, blobData)
+	case overwrite:
+		err = a.dataStoreClient.Write(ctx, blobData)
+	default:
+		err = a.dataStoreClient.WriteIfNotExists(ctx, blobData)
+	}
+
+	skippedExists := a.cfg.SkipExistsCheck && !overwrite
+	deduped := errors.Is(err, storage.ErrWriteDeduped)
+	stored := skippedExists && (deduped || errors.Is(err, storage.ErrWriteConflict))
+	if stored {
+		a.log.Debug("blob already exists", "hash", header.Root)
+		err = nil
+		// The slot index entry of deduped writes has been written already
+		if a.cfg.SlotIndex && !deduped {
+			err = a.reconcileSlotIndex(ctx, header)
+		}
+	} else if deduped {
+		a.log.Debug("blob was already written by a concurrent writer", "hash", header.Root)
+		err = nil
+	}
+
+	if errors.Is(err, storage.ErrPartialWrite) {
+		// The blob is stored, the next attempt will find it and reconcile the slot index.
+		a.log.Warn("blob written without slot index, will reconcile", "err", err, "hash", header.Root)
+		return false, err
+	}
 
 	if err != nil {
 		a.log.Error("failed to write blob", "err", err)
-		return nil, false, err
+		return false, err
+	}
+
+	a.writeExecutionIndex(ctx, blobData.Header)
+
+	if err := a.wal.commit(blobData.Header.BeaconBlockHash); err != nil {
+		a.log.Warn("failed to record completed write in write-ahead log", "err", err, "hash", header.Root)
+	}
+
+	if !deduped && !stored {
+		a.metrics.RecordStoredBlobs(len(sidecars))
+		a.dictionarySamples.add(blobData.Header.BeaconBlockHash)
+		a.enqueueKZGVerification(blobData.Header.BeaconBlockHash)
+	}
+
+	return stored, nil
+}
+
+// fetchBlock fetches the full signed beacon block of the given header from the beacon node. The block is only accepted
+// if its root is that of the header, as with the sidecars in fetchBlobSidecars. A block fetched earlier by the persist
+// attempt of the context is reused.
+func (a *Archiver) fetchBlock(ctx context.Context, header *v1.BeaconBlockHeader) (*spec.VersionedSignedBeaconBlock, error) {
+	attempt := persistAttemptOf(ctx)
+	if block, ok := attempt.block(header.Root); ok {
+		return block, nil
+	}
+
+	block, err := a.beaconClient.SignedBeaconBlock(ctx, &api.SignedBeaconBlockOpts{
+		Block: header.Root.String(),
+	})
+	if err != nil {
+		a.log.Error("failed to fetch beacon block", "err", err, "hash", header.Root)
+		return nil, err
+	}
+
+	expected, err := header.Header.Message.HashTreeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute block root: %w", err)
+	}
+
+	root, err := block.Data.Root()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute root of beacon block: %w", err)
+	}
+
+	if root != expected {
+		return nil, fmt.Errorf("%w: block %s, expected %s", errBeaconBlockMismatch, phase0.Root(root), header.Root)
+	}
+
+	attempt.setBlock(header.Root, block.Data)
+	return block.Data, nil
+}
+
+// writeExecutionIndex writes the execution block number index entry of a written block, if the index is maintained. The
+// entry is only needed by lookups by execution block number, so failing to write it doesn't fail the write of the blobs.
+func (a *Archiver) writeExecutionIndex(ctx context.Context, header storage.Header) {
+	if !a.cfg.ExecutionIndex {
+		return
+	}
+
+	if err := a.dataStoreClient.WriteExecutionIndex(ctx, header.ExecutionBlockNumber, header.BeaconBlockHash); err != nil {
+		a.log.Warn("failed to write execution index", "err", err, "hash", header.BeaconBlockHash, "number", header.ExecutionBlockNumber)
+	}
+}
+
+// recordCommitments records the number of blob commitments of the block in the header its blobs are stored with, so
+// that a block the beacon node returned fewer sidecars for is fetched again when it's next encountered, see skipBlock.
+func (a *Archiver) recordCommitments(header *storage.Header, block *spec.VersionedSignedBeaconBlock, sidecars int) error {
+	commitments, err := block.BlobKZGCommitments()
+	if err != nil {
+		return fmt.Errorf("failed to read blob commitments of block %s: %w", header.BeaconBlockHash, err)
+	}
+
+	header.Commitments = uint64(len(commitments))
+	if header.Incomplete(sidecars) {
+		a.log.Warn("beacon node returned fewer blob sidecars than the block has commitments, storing incomplete block",
+			"hash", header.BeaconBlockHash, "slot", header.Slot, "sidecars", sidecars, "commitments", len(commitments))
+		a.metrics.RecordIncompleteBlock(metrics.IncompleteBlockFetched)
+	}
+
+	return nil
+}
+
+// checkBlobCount returns errTooManyBlobs if the block carries more blobs than the fork of its slot allows.
+func (a *Archiver) checkBlobCount(ctx context.Context, header *v1.BeaconBlockHeader, count int) error {
+	limits, err := a.getBlobLimits(ctx)
+	if err != nil {
+		return err
+	}
+
+	slot := header.Header.Message.Slot
+	if limit := limits.MaxBlobs(slot); uint64(count) > limit {
+		a.log.Error("beacon node returned more blob sidecars than the fork allows, rejecting block",
+			"hash", header.Root, "slot", slot, "count", count, "max", limit)
+		a.metrics.RecordExcessBlobs()
+		return fmt.Errorf("%w: block %s at slot %d has %d blob sidecars, at most %d allowed", errTooManyBlobs, header.Root, slot, count, limit)
+	}
+
+	return nil
+}
+
+// checkSignature returns beacon.ErrInvalidSignature if signatures are verified and the header of the block is not
+// signed by its proposer. The sidecars of a block carry its header, see checkSidecarHeaders, so this ties them to the chain too.
+func (a *Archiver) checkSignature(ctx context.Context, header *v1.BeaconBlockHeader) error {
+	if !a.cfg.VerifySignatures {
+		return nil
+	}
+
+	verifier, err := a.getProposerVerifier(ctx)
+	if err != nil {
+		return err
 	}
 
-	a.metrics.RecordStoredBlobs(len(blobSidecars.Data))
+	err = verifier.Verify(ctx, header)
+	if errors.Is(err, beacon.ErrInvalidSignature) {
+		a.log.Error("block is not signed by its proposer, rejecting block", "err", err, "hash", header.Root)
+		a.metrics.RecordInvalidSignature()
+	}
 
-	return currentHeader.Data, exists, nil
+	return err
+}
+
+// getProposerVerifier returns the verifier of proposer signatures, creating it on first use.
+func (a *Archiver) getProposerVerifier(ctx context.Context) (*beacon.ProposerVerifier, error) {
+	a.proposerVerifierMu.Lock()
+	defer a.proposerVerifierMu.Unlock()
+
+	if a.proposerVerifier == nil {
+		verifier, err := beacon.NewProposerVerifier(ctx, a.beaconClient, a.cfg.ValidatorCacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create proposer signature verifier: %w", err)
+		}
+		a.proposerVerifier = verifier
+	}
+
+	return a.proposerVerifier, nil
+}
+
+// filter returns the slot filter, raised to the first slot of the minimum fork and of the blob availability window once
+// those were looked up.
+func (a *Archiver) filter() flags.SlotFilter {
+	filter := a.slotFilter
+	filter.MinSlot = max(filter.MinSlot, a.minForkSlot.Load(), a.availabilitySlot.Load())
+	return filter
+}
+
+// detectMinFork looks up the first slot of the configured minimum fork in the spec of the beacon node at startup, so
+// that blocks of earlier forks aren't archived, see flags.SlotFilterConfig.MinFork.
+func (a *Archiver) detectMinFork(ctx context.Context) error {
+	if a.cfg.SlotFilter.MinFork == "" {
+		return nil
+	}
+
+	var incompatible error
+	slot, err := retry.Do(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (phase0.Slot, error) {
+		slot, err := beacon.ForkStartSlot(ctx, a.beaconClient, a.cfg.SlotFilter.MinFork)
+		if errors.Is(err, beacon.ErrIncompatibleSpec) {
+			// Retrying won't change the spec
+			incompatible = err
+			return slot, nil
+		}
+		return slot, err
+	})
+
+	if incompatible != nil {
+		err = incompatible
+	}
+	if err != nil {
+		a.log.Error("failed to look up the first slot of the minimum fork", "err", err, "fork", a.cfg.SlotFilter.MinFork)
+		return err
+	}
+
+	a.log.Info("archiving from the minimum fork", "fork", a.cfg.SlotFilter.MinFork, "slot", slot)
+	a.minForkSlot.Store(uint64(slot))
+	return nil
+}
+
+// detectAvailabilityWindow looks up the first slot of the blob availability window as of the current slot in the spec of
+// the beacon node at startup, if backfills stop at it, see flags.BackfillConfig.AvailabilityWindow. Blocks below it
+// aren't archived, like blocks outside the slot filter, so that backfills stop at it.
+func (a *Archiver) detectAvailabilityWindow(ctx context.Context) error {
+	if !a.cfg.Backfill.AvailabilityWindow {
+		return nil
+	}
+
+	var incompatible error
+	slot, err := retry.Do(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (phase0.Slot, error) {
+		slotClock, err := a.getSlotClock(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		slot, err := beacon.BlobAvailabilityStartSlot(ctx, a.beaconClient, slotClock.CurrentSlot())
+		if errors.Is(err, beacon.ErrIncompatibleSpec) {
+			// Retrying won't change the spec
+			incompatible = err
+			return slot, nil
+		}
+		return slot, err
+	})
+
+	if incompatible != nil {
+		err = incompatible
+	}
+	if err != nil {
+		a.log.Error("failed to look up the first slot of the blob availability window", "err", err)
+		return err
+	}
+
+	a.log.Info("archiving the blob availability window", "slot", slot)
+	a.availabilitySlot.Store(uint64(slot))
+	return nil
+}
+
+// detectBlobLimits fetches the blob limits of the chain from the spec of the beacon node at startup, so that a beacon
+// node the archiver is incompatible with is reported before anything is archived. Limits configured with
+// MaxBlobsPerBlock are used as they are.
+func (a *Archiver) detectBlobLimits(ctx context.Context) error {
+	var incompatible error
+	limits, err := retry.Do(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (beacon.BlobLimits, error) {
+		limits, err := a.getBlobLimits(ctx)
+		if errors.Is(err, beacon.ErrIncompatibleSpec) {
+			// Retrying won't change the spec
+			incompatible = err
+			return limits, nil
+		}
+		return limits, err
+	})
+
+	if incompatible != nil {
+		err = incompatible
+	}
+	if err != nil {
+		a.log.Error("failed to detect blob limits from the beacon node spec", "err", err)
+		return err
+	}
+
+	a.log.Info("using blob limits", "configured", a.cfg.MaxBlobsPerBlock > 0, "deneb", limits.Deneb,
+		"electra", limits.Electra, "electraForkEpoch", limits.ElectraForkEpoch)
+	return nil
+}
+
+// getBlobLimits returns the blob limits of the chain, fetching them from the beacon node on first use unless they are
+// configured, see flags.ArchiverConfig.MaxBlobsPerBlock.
+func (a *Archiver) getBlobLimits(ctx context.Context) (beacon.BlobLimits, error) {
+	a.blobLimitsMu.Lock()
+	defer a.blobLimitsMu.Unlock()
+
+	if a.blobLimits == nil && a.cfg.MaxBlobsPerBlock > 0 {
+		limits := beacon.FixedBlobLimits(a.cfg.MaxBlobsPerBlock)
+		a.blobLimits = &limits
+	}
+
+	if a.blobLimits == nil {
+		limits, err := beacon.NewBlobLimits(ctx, a.beaconClient)
+		if err != nil {
+			return beacon.BlobLimits{}, fmt.Errorf("failed to fetch blob limits: %w", err)
+		}
+		a.blobLimits = &limits
+	}
+
+	return *a.blobLimits, nil
+}
+
+// fetchBlobSidecars fetches the blob sidecars for the given block by its root. Some beacon nodes occasionally fail to
+// find sidecars by root even though the header resolved, so if the request fails with a client error the sidecars are
+// fetched by slot instead. Either way, the sidecars are only accepted if they belong to the expected block, as the
+// block an identifier such as head resolves to can change between fetching the header and the sidecars. On a mismatch
+// errSidecarBlockMismatch is returned, so that the caller retries from the header. Sidecars fetched earlier by the
+// persist attempt of the context are reused.
+func (a *Archiver) fetchBlobSidecars(ctx context.Context, header *v1.BeaconBlockHeader) (*api.Response[[]*deneb.BlobSidecar], error) {
+	attempt := persistAttemptOf(ctx)
+	if blobSidecars, ok := attempt.blobSidecars(header.Root); ok {
+		return blobSidecars, nil
+	}
+
+	blobSidecars, err := a.fetchBlobSidecarsFromBeacon(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.setBlobSidecars(header.Root, blobSidecars)
+	return blobSidecars, nil
+}
+
+// fetchBlobSidecarsFromBeacon is fetchBlobSidecars without the sidecars cached by the persist attempt of the context.
+func (a *Archiver) fetchBlobSidecarsFromBeacon(ctx context.Context, header *v1.BeaconBlockHeader) (*api.Response[[]*deneb.BlobSidecar], error) {
+	blobSidecars, err := a.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: header.Root.String(),
+	})
+
+	if err == nil {
+		// An empty set of sidecars carries no header to check, but sidecars fetched by root can only be for that root
+		if err := beacon.CheckSidecarHeaders(blobSidecars.Data, header); err != nil {
+			return nil, err
+		}
+
+		return blobSidecars, nil
+	}
+
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 {
+		return nil, err
+	}
+
+	slot := strconv.FormatUint(uint64(header.Header.Message.Slot), 10)
+	a.log.Warn("failed to fetch blob sidecars by root, falling back to slot", "err", err, "hash", header.Root, "slot", slot)
+
+	blobSidecars, err = a.beaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{
+		Block: slot,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blob sidecars by slot: %w", err)
+	}
+
+	if err := a.checkSidecarsBelongToBlock(ctx, blobSidecars.Data, header, slot); err != nil {
+		return nil, err
+	}
+
+	return blobSidecars, nil
+}
+
+// checkSidecarsBelongToBlock returns an error if the sidecars were not produced for the given block. An empty set of
+// sidecars carries no header, so in that case the block at the slot is checked instead.
+func (a *Archiver) checkSidecarsBelongToBlock(ctx context.Context, sidecars []*deneb.BlobSidecar, header *v1.BeaconBlockHeader, slot string) error {
+	if len(sidecars) == 0 {
+		slotHeader, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+			Block: slot,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch header by slot: %w", err)
+		}
+
+		if slotHeader.Data.Root != header.Root {
+			return fmt.Errorf("%w: block at slot %s is %s, expected %s", errSidecarBlockMismatch, slot, slotHeader.Data.Root, header.Root)
+		}
+
+		return nil
+	}
+
+	return beacon.CheckSidecarHeaders(sidecars, header)
+}
+
+// reconcileSlotIndex repairs the slot index entry for an already stored block, if it is missing or stale.
+func (a *Archiver) reconcileSlotIndex(ctx context.Context, header *v1.BeaconBlockHeader) error {
+	repaired, err := storage.ReconcileSlotIndex(ctx, a.dataStoreClient, uint64(header.Header.Message.Slot), common.Hash(header.Root))
+	if err != nil {
+		a.log.Error("failed to reconcile slot index", "err", err, "hash", header.Root)
+		return err
+	}
+
+	if repaired {
+		a.log.Info("reconciled slot index", "hash", header.Root, "slot", header.Header.Message.Slot)
+		a.metrics.RecordSlotIndexReconciled()
+	}
+
+	return nil
 }
 
 // backfillBlobs will persist all blobs from the provided beacon block header, to either the last block that was persisted
 // to the archivers storage or the origin block in the configuration. This is used to ensure that any gaps can be filled.
-// If an error is encountered persisting a block, it will retry after waiting for a period of time.
-func (a *Archiver) backfillBlobs(ctx context.Context, latest *v1.BeaconBlockHeader) {
+// If an error is encountered persisting a block, it will retry after waiting for a period of time. With the slot-range
+// strategy, ranges of slots are fetched in bulk where the beacon client supports it (see backfillBlobsByRange), and the
+// backfill continues by walking parent roots from wherever that stops. Backfilling stops once the context is done. It
+// returns the last block whose blobs are stored, from which a stopped backfill can be resumed. Walking parent roots also
+// stops once the origin block can't be reached anymore, see originGuard, rather than continuing to genesis.
+func (a *Archiver) backfillBlobs(ctx context.Context, latest *v1.BeaconBlockHeader) *v1.BeaconBlockHeader {
+	ctx = withBlockSource(ctx, metrics.BlockSourceBackfill)
 	current, alreadyExists, err := latest, false, error(nil)
 
 	defer func() {
 		a.log.Info("backfill complete", "endHash", current.Root.String(), "startHash", latest.Root.String())
 	}()
 
+	if a.cfg.Backfill.Strategy == flags.BackfillStrategySlotRange {
+		rangeClient, ok := a.beaconClient.(beacon.BlobSidecarsRangeProvider)
+		if !ok {
+			a.log.Warn("beacon client does not support fetching slot ranges, falling back to parent walk")
+		} else {
+			var done bool
+			current, done = a.backfillBlobsByRange(ctx, rangeClient, latest)
+			if done || ctx.Err() != nil {
+				return current
+			}
+
+			a.log.Warn("slot range backfill stopped, continuing with parent walk", "hash", current.Root.String())
+		}
+	}
+
+	boundary, pruning := a.retentionBoundary(uint64(latest.Header.Message.Slot))
+	guard := a.newOriginGuard(ctx)
+
+	// A parent that failed to persist is retried with what was fetched for it
+	attemptCtx := withPersistAttempt(ctx)
 	for !alreadyExists {
 		previous := current
 
+		if ctx.Err() != nil {
+			a.log.Info("backfill stopped", "hash", current.Root.String(), "slot", current.Header.Message.Slot, "err", ctx.Err())
+			return current
+		}
+
 		if common.Hash(current.Root) == a.cfg.OriginBlock {
 			a.log.Info("reached origin block", "hash", current.Root.String())
-			return
+			return current
+		}
+
+		if !a.filter().AllowsBelow(uint64(current.Header.Message.Slot)) {
+			a.log.Info("no older slots are archived", "hash", current.Root.String())
+			return current
+		}
+
+		// Older blocks would be pruned, so walking further would only re-download them on every restart
+		if pruning && uint64(current.Header.Message.Slot) <= boundary {
+			a.log.Info("reached retention boundary", "hash", current.Root.String(), "boundary", boundary)
+			return current
+		}
+
+		current, alreadyExists, err = a.persistParent(attemptCtx, previous.Header.Message.ParentRoot)
+		if errors.Is(err, errParentNotFound) {
+			a.log.Error("parent block is not available from the beacon node, stopping backfill", "err", err, "hash", previous.Header.Message.ParentRoot.String())
+			current = previous
+			return current
 		}
 
-		current, alreadyExists, err = a.persistBlobsForBlockToS3(ctx, previous.Header.Message.ParentRoot.String(), false)
 		if err != nil {
 			a.log.Error("failed to persist blobs for block, will retry", "err", err, "hash", previous.Header.Message.ParentRoot.String())
 			// Revert back to block we failed to fetch
 			current = previous
-			time.Sleep(backfillErrorRetryInterval)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(backfillErrorRetryInterval):
+			}
+			continue
+		}
+
+		attemptCtx = withPersistAttempt(ctx)
+		if alreadyExists {
 			continue
 		}
 
-		if !alreadyExists {
-			a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+		a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+
+		if err := guard.check(current); err != nil {
+			a.log.Error("origin block can't be reached, stopping backfill", "err", err, "hash", current.Root.String(),
+				"slot", current.Header.Message.Slot, "origin", a.cfg.OriginBlock, "originSlot", guard.slot, "walked", guard.walked)
+			a.metrics.RecordOriginUnreachable()
+			return current
+		}
+	}
+
+	return current
+}
+
+// persistParent persists the blobs of a parent block during backfill. Beacon nodes can briefly respond with a 404 for
+// blocks they have, e.g. after a restart, so if Backfill.NotFoundRetries is set, a 404 is retried that many times before
+// the block is accepted as absent and errParentNotFound is returned.
+func (a *Archiver) persistParent(ctx context.Context, root phase0.Root) (*v1.BeaconBlockHeader, bool, error) {
+	header, exists, err := a.persistBlobsForBlockToS3(ctx, root.String(), false)
+	if a.cfg.Backfill.NotFoundRetries == 0 {
+		return header, exists, err
+	}
+
+	for i := 0; i < a.cfg.Backfill.NotFoundRetries && isNotFound(err); i++ {
+		a.log.Warn("parent block not found, retrying", "hash", root.String(), "attempt", i+1)
+
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-time.After(a.cfg.Backfill.NotFoundRetryInterval):
 		}
+
+		header, exists, err = a.persistBlobsForBlockToS3(ctx, root.String(), false)
+	}
+
+	if isNotFound(err) {
+		return nil, false, fmt.Errorf("%w: %w", errParentNotFound, err)
 	}
+
+	return header, exists, err
+}
+
+// isNotFound returns true if the error is the beacon node responding with a 404.
+func isNotFound(err error) bool {
+	var apiErr *api.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == 404
 }
 
 // trackLatestBlocks will poll the beacon node for the latest blocks and persist blobs for them.
 func (a *Archiver) trackLatestBlocks(ctx context.Context) error {
 	t := time.NewTicker(a.cfg.PollInterval)
 	defer t.Stop()
+	defer a.checkpointLiveGaps(ctx)
 
 	for {
 		select {
@@ -177,22 +1110,47 @@ func (a *Archiver) trackLatestBlocks(ctx context.Context) error {
 			return nil
 		case <-t.C:
 			a.processBlocksUntilKnownBlock(ctx)
+			a.checkLag(ctx)
 		}
 	}
 }
 
 // processBlocksUntilKnownBlock will fetch and persist blobs for blocks until it finds a block that has been stored before.
 // In the case of a reorg, it will fetch the new head and then walk back the chain, storing all blobs until it finds a
-// known block -- that already exists in the archivers' storage.
+// known block -- that already exists in the archivers' storage. As blocks outside the slot filter are never stored, the
+// walk also stops at the head of the previous refresh, and once no older slot can be archived. If LiveMaxHops is set,
+// the walk stops after that many blocks too, and the hops left over are spent continuing earlier walks that stopped
+// like that, see walkLiveGaps.
 func (a *Archiver) processBlocksUntilKnownBlock(ctx context.Context) {
 	a.log.Debug("refreshing live data")
 
-	var start *v1.BeaconBlockHeader
-	currentBlockId := "head"
+	var start, latest *v1.BeaconBlockHeader
+	var prefetched map[phase0.Root]*api.Response[*v1.BeaconBlockHeader]
+	var parentRoot phase0.Root
+	var hops int
+	currentBlockId, err := retry.Do(ctx, liveFetchBlobMaximumRetries, retry.Exponential(), func() (string, error) {
+		return a.liveHead(ctx)
+	})
+	if err != nil {
+		a.log.Error("failed to look up the head to archive from", "err", err)
+		return
+	}
+
+	// The walk goes from newest to oldest, so the first block written is the latest
+	defer func() {
+		if latest != nil {
+			a.writeLatest(ctx, latest)
+		}
+	}()
 
 	for {
-		current, alreadyExisted, err := retry.Do2(ctx, liveFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
-			return a.persistBlobsForBlockToS3(ctx, currentBlockId, false)
+		header, isPrefetched := prefetched[parentRoot]
+		attemptCtx := withPersistAttempt(ctx)
+		result, err := retry.Do(ctx, liveFetchBlobMaximumRetries, retry.Exponential(), func() (persistResult, error) {
+			if isPrefetched {
+				return a.persistHeader(attemptCtx, header, false, time.Now())
+			}
+			return a.persistBlock(attemptCtx, currentBlockId, false)
 		})
 
 		if err != nil {
@@ -200,8 +1158,29 @@ func (a *Archiver) processBlocksUntilKnownBlock(ctx context.Context) {
 			return
 		}
 
+		hops++
+		current, alreadyExisted := result.header, result.exists
+		if result.written {
+			if latest == nil {
+				latest = current
+			}
+			a.events.Emit(events.BlockArchived{
+				Root:      common.Hash(current.Root),
+				Slot:      uint64(current.Header.Message.Slot),
+				Sidecars:  result.sidecars,
+				Timestamp: time.Now(),
+			})
+		}
+
 		if start == nil {
 			start = current
+			prefetched = a.prefetchParentHeaders(ctx, current)
+		}
+
+		if current.Root == a.liveTip {
+			// Every block from here back was walked by a previous refresh, stored or not
+			a.log.Debug("reached previous head", "hash", current.Root.String())
+			break
 		}
 
 		if !alreadyExisted {
@@ -211,16 +1190,218 @@ func (a *Archiver) processBlocksUntilKnownBlock(ctx context.Context) {
 			break
 		}
 
-		currentBlockId = current.Header.Message.ParentRoot.String()
+		if common.Hash(current.Root) == a.cfg.OriginBlock {
+			a.log.Debug("reached origin block", "hash", current.Root.String())
+			break
+		}
+
+		if !a.filter().AllowsBelow(uint64(current.Header.Message.Slot)) {
+			a.log.Debug("no older slots are archived", "hash", current.Root.String())
+			break
+		}
+
+		if a.cfg.LiveMaxHops > 0 && hops >= a.cfg.LiveMaxHops {
+			a.log.Info("reached maximum live hops, continuing at the next refresh", "hash", current.Root.String(), "slot", current.Header.Message.Slot)
+			a.liveGaps = append(a.liveGaps, current)
+			break
+		}
+
+		parentRoot = current.Header.Message.ParentRoot
+		currentBlockId = parentRoot.String()
 	}
 
+	a.liveTip = start.Root
+	a.liveTipSlot = uint64(start.Header.Message.Slot)
+	a.liveSlot = max(a.liveSlot, a.liveTipSlot)
 	a.log.Info("live data refreshed", "startHash", start.Root.String(), "endHash", currentBlockId)
+
+	if a.cfg.LiveMaxHops > 0 {
+		a.walkLiveGaps(ctx, a.cfg.LiveMaxHops-hops)
+	}
 }
 
-// rearchiveRange will rearchive all blocks in the range from the given start to end. It returns the start and end of the
-// range that was successfully rearchived. On any persistent errors, it will halt archiving and return the range of blocks
-// that were rearchived and the error that halted the process.
+// walkLiveGaps continues the walks of previous refreshes that stopped after LiveMaxHops blocks, newest first, walking
+// back through at most the given number of blocks in total. A walk ends like that of a refresh, at the first stored
+// block, the origin block or once no older slot can be archived, and one that stops again, or fails, is continued by
+// the next refresh. A walk whose next block the beacon node doesn't have is abandoned.
+func (a *Archiver) walkLiveGaps(ctx context.Context, hops int) {
+	for hops > 0 && len(a.liveGaps) > 0 {
+		gap := a.liveGaps[len(a.liveGaps)-1]
+		a.liveGaps = a.liveGaps[:len(a.liveGaps)-1]
+
+		current := gap
+		for {
+			if hops == 0 {
+				a.liveGaps = append(a.liveGaps, current)
+				return
+			}
+
+			parent := current.Header.Message.ParentRoot.String()
+			attemptCtx := withPersistAttempt(ctx)
+			result, err := retry.Do(ctx, liveFetchBlobMaximumRetries, retry.Exponential(), func() (persistResult, error) {
+				return a.persistBlock(attemptCtx, parent, false)
+			})
+
+			if isNotFound(err) {
+				a.log.Error("parent block is not available from the beacon node, abandoning live gap", "err", err, "hash", parent)
+				break
+			}
+
+			if err != nil {
+				a.log.Error("failed to update live blobs for block", "err", err, "blockId", parent)
+				a.liveGaps = append(a.liveGaps, current)
+				return
+			}
+
+			hops--
+			current = result.header
+			if result.written {
+				a.events.Emit(events.BlockArchived{
+					Root:      common.Hash(current.Root),
+					Slot:      uint64(current.Header.Message.Slot),
+					Sidecars:  result.sidecars,
+					Timestamp: time.Now(),
+				})
+			}
+
+			if result.exists {
+				break
+			}
+			a.metrics.RecordProcessedBlock(metrics.BlockSourceLive)
+
+			if common.Hash(current.Root) == a.cfg.OriginBlock || !a.filter().AllowsBelow(uint64(current.Header.Message.Slot)) {
+				break
+			}
+		}
+
+		a.log.Info("live gap filled", "startHash", gap.Root.String(), "endHash", current.Root.String())
+	}
+}
+
+// checkpointLiveGaps adds the blocks the live loop has yet to continue walking back from, see walkLiveGaps, to the
+// backfill checkpoint, so that the blocks below them are backfilled at the next start.
+func (a *Archiver) checkpointLiveGaps(ctx context.Context) {
+	if len(a.liveGaps) == 0 {
+		return
+	}
+
+	// The live loop usually stops as the context is canceled
+	ctx = context.WithoutCancel(ctx)
+	checkpoint, err := a.dataStoreClient.ReadBackfillCheckpoint(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		a.log.Error("failed to read backfill checkpoint, live gaps will not be backfilled", "err", err, "gaps", len(a.liveGaps))
+		return
+	}
+
+	a.log.Info("adding live gaps to backfill checkpoint", "gaps", len(a.liveGaps))
+	a.writeBackfillCheckpoint(ctx, a.liveGaps, checkpoint)
+}
+
+// liveHead returns the identifier of the block the live loop archives from. That is the head, unless HeadDelay is set,
+// in which case it is the newest block that is at least HeadDelay slots older than the head, found by walking back from
+// the head. Its descendants are archived by a later refresh, once the head is far enough ahead of them.
+func (a *Archiver) liveHead(ctx context.Context) (string, error) {
+	if a.cfg.HeadDelay == 0 {
+		return "head", nil
+	}
+
+	header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: "head"})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch head: %w", err)
+	}
+
+	headSlot := uint64(header.Data.Header.Message.Slot)
+	target := headSlot - min(a.cfg.HeadDelay, headSlot)
+	for uint64(header.Data.Header.Message.Slot) > target && common.Hash(header.Data.Root) != a.cfg.OriginBlock {
+		parent := header.Data.Header.Message.ParentRoot.String()
+		header, err = a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: parent})
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch header %s: %w", parent, err)
+		}
+	}
+
+	a.log.Debug("delaying head", "head", headSlot, "slot", header.Data.Header.Message.Slot)
+	return header.Data.Root.String(), nil
+}
+
+// prefetchParentHeaders concurrently fetches the headers of up to LivePrefetchDepth slots below the head, so that the
+// live walk finds the headers of the head's ancestors without a round trip to the beacon node each. Slots at or below
+// the head of the previous refresh are not fetched, as the walk stops there. The headers are keyed by root, so a header
+// is only used if it is the parent the walk would have fetched anyway; headers of other forks, and slots that failed to
+// be fetched, make the walk fall back to fetching the header by root.
+func (a *Archiver) prefetchParentHeaders(ctx context.Context, head *v1.BeaconBlockHeader) map[phase0.Root]*api.Response[*v1.BeaconBlockHeader] {
+	headSlot := uint64(head.Header.Message.Slot)
+	lowest := headSlot - min(uint64(a.cfg.LivePrefetchDepth), headSlot)
+	if a.liveTip != (phase0.Root{}) && lowest <= a.liveTipSlot {
+		lowest = a.liveTipSlot + 1
+	}
+
+	if lowest >= headSlot {
+		return nil
+	}
+
+	var mu sync.Mutex
+	headers := make(map[phase0.Root]*api.Response[*v1.BeaconBlockHeader], headSlot-lowest)
+
+	var wg sync.WaitGroup
+	for slot := lowest; slot < headSlot; slot++ {
+		slot := slot
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+				Block: strconv.FormatUint(slot, 10),
+			})
+			if err != nil {
+				// Missed slots are expected, and the walk fetches the header again if it needs it
+				if !isNotFound(err) {
+					a.log.Debug("failed to prefetch header", "err", err, "slot", slot)
+				}
+				return
+			}
+
+			mu.Lock()
+			headers[header.Data.Root] = header
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return headers
+}
+
+// writeLatest points the latest pointer at the given block. The pointer is a convenience for consumers, so failing to
+// write it is only logged.
+func (a *Archiver) writeLatest(ctx context.Context, header *v1.BeaconBlockHeader) {
+	err := a.dataStoreClient.WriteLatest(ctx, storage.Header{
+		BeaconBlockHash: common.Hash(header.Root),
+		Slot:            uint64(header.Header.Message.Slot),
+	})
+	if err != nil {
+		a.log.Warn("failed to write latest pointer", "err", err, "hash", header.Root.String())
+	}
+}
+
+// rearchiveRange will rearchive all blocks in the range from the given start to end. If pruning is enabled, the range
+// must be within the retention window. It returns the start and end of the range that was successfully rearchived. On
+// any persistent errors, it will halt archiving and return the range of blocks that were rearchived and the error that
+// halted the process.
 func (a *Archiver) rearchiveRange(from uint64, to uint64) (uint64, uint64, error) {
+	// Blocks below the retention boundary are being pruned, rewriting them would race with the pruner
+	if a.cfg.PruneConfig.Retention > 0 {
+		head, err := a.beaconClient.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{
+			Block: "head",
+		})
+		if err != nil {
+			return from, from, err
+		}
+
+		if boundary, _ := a.retentionBoundary(uint64(head.Data.Header.Message.Slot)); from < boundary {
+			return from, from, fmt.Errorf("slot %d is outside the retention window, which starts at slot %d", from, boundary)
+		}
+	}
+
 	for i := from; i <= to; i++ {
 		id := strconv.FormatUint(i, 10)
 
@@ -228,8 +1409,9 @@ func (a *Archiver) rearchiveRange(from uint64, to uint64) (uint64, uint64, error
 
 		l.Info("rearchiving block")
 
+		attemptCtx := withPersistAttempt(withBlockSource(context.Background(), metrics.BlockSourceRearchive))
 		rewritten, err := retry.Do(context.Background(), rearchiveMaximumRetries, retry.Exponential(), func() (bool, error) {
-			_, _, e := a.persistBlobsForBlockToS3(context.Background(), id, true)
+			_, _, e := a.persistBlobsForBlockToS3(attemptCtx, id, true)
 
 			// If the block is not found, we can assume that the slot has been skipped
 			if e != nil {
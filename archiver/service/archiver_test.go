@@ -2,15 +2,33 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/events"
 	"github.com/base-org/blob-archiver/archiver/flags"
 	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
 	"github.com/base-org/blob-archiver/common/blobtest"
+	commonflags "github.com/base-org/blob-archiver/common/flags"
 	"github.com/base-org/blob-archiver/common/storage"
 	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -25,11 +43,145 @@ func setup(t *testing.T, beacon *beacontest.StubBeaconClient) (*Archiver, *stora
 	svc, err := NewArchiver(l, flags.ArchiverConfig{
 		PollInterval: 5 * time.Second,
 		OriginBlock:  blobtest.OriginBlock,
-	}, fs, beacon, m)
+	}, fs, beacon, m, nil)
 	require.NoError(t, err)
 	return svc, fs
 }
 
+func metricValue(t *testing.T, m metrics.Metricer, name string) float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	total := float64(0)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if metric.GetCounter() != nil {
+				total += metric.GetCounter().GetValue()
+			}
+			if metric.GetGauge() != nil {
+				total += metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return total
+}
+
+// histogramCounts returns the number of observations of the histogram by the values of their labels, joined by commas.
+func histogramCounts(t *testing.T, m metrics.Metricer, name string) map[string]uint64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			values := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				values = append(values, label.GetValue())
+			}
+			counts[strings.Join(values, ",")] += metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return counts
+}
+
+func TestArchiver_RecordsPersistDurations(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.OriginBlock.String(), false)
+	require.NoError(t, err)
+
+	// Blocks that are already stored are not timed
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.OriginBlock.String(), false)
+	require.NoError(t, err)
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	require.Equal(t, map[string]uint64{"live": 1, "backfill": 4}, histogramCounts(t, m, "blob_archiver_block_persist_duration_seconds"))
+	require.Equal(t, map[string]uint64{
+		"live,fetch":     1,
+		"live,write":     1,
+		"backfill,fetch": 4,
+		"backfill,write": 4,
+	}, histogramCounts(t, m, "blob_archiver_block_persist_stage_duration_seconds"))
+}
+
+// counterValues returns the values of the counter by the values of their labels, joined by commas in the order of the
+// label names.
+func counterValues(t *testing.T, m metrics.Metricer, name string) map[string]float64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetValue())
+			}
+			values[strings.Join(labels, ",")] += metric.GetCounter().GetValue()
+		}
+	}
+
+	return values
+}
+
+func TestArchiver_RecordsPersistOutcomes(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	m := metrics.NewMetrics()
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+	}, storagetest.NewTestFileStorage(t, l), beacon, m, nil)
+	require.NoError(t, err)
+
+	seedCtx := withBlockSource(context.Background(), metrics.BlockSourceSeed)
+	_, exists, err := svc.persistBlobsForBlockToS3(seedCtx, blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, map[string]float64{"written,seed": 1}, counterValues(t, m, "blob_archiver_block_persist_outcomes"))
+
+	// The blocks of every source short-circuit once they are stored
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	backfillCtx := withBlockSource(context.Background(), metrics.BlockSourceBackfill)
+	_, exists, err = svc.persistBlobsForBlockToS3(backfillCtx, blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.Equal(t, map[string]float64{
+		"written,seed":    1,
+		"exists,live":     1,
+		"exists,backfill": 1,
+	}, counterValues(t, m, "blob_archiver_block_persist_outcomes"))
+}
+
 func TestArchiver_FetchAndPersist(t *testing.T) {
 	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
 
@@ -52,115 +204,1127 @@ func TestArchiver_FetchAndPersist(t *testing.T) {
 	fs.CheckExistsOrFail(t, blobtest.OriginBlock)
 }
 
-func TestArchiver_FetchAndPersistOverwriting(t *testing.T) {
-	beacon := beacontest.NewDefaultStubBeaconClient(t)
-	svc, fs := setup(t, beacon)
+// addSidecars adds count sidecars to the blobs the stub returns for the block.
+func addSidecars(t *testing.T, beacon *beacontest.StubBeaconClient, hash common.Hash, count uint) {
+	sidecars := blobtest.NewBlobSidecars(t, count)
+	for _, sidecar := range sidecars {
+		sidecar.SignedBlockHeader = beacon.Headers[hash.String()].Header
+	}
+	beacon.Blobs[hash.String()] = append(beacon.Blobs[hash.String()], sidecars...)
+}
+
+func TestArchiver_RejectsExcessBlobsForDeneb(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// Five carries the maximum of 6 blobs
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+
+	// Four carries 5 + 2 = 7 blobs
+	addSidecars(t, beacon, blobtest.Four, 2)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.ErrorIs(t, err, errTooManyBlobs)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_excess_blob_responses"))
+}
+
+func TestArchiver_RejectsExcessBlobsForElectra(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	// Four is the last slot of deneb at slot 14, Five the first slot of electra at slot 15
+	beacon.SpecValues["SLOTS_PER_EPOCH"] = uint64(5)
+	beacon.SpecValues["ELECTRA_FORK_EPOCH"] = uint64(3)
+	svc, fs := setup(t, beacon)
+
+	// Five carries 6 + 3 = 9 blobs, the maximum for electra
+	addSidecars(t, beacon, blobtest.Five, 3)
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+
+	// Four carries 5 + 2 = 7 blobs, which electra would allow but deneb doesn't
+	addSidecars(t, beacon, blobtest.Four, 2)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.ErrorIs(t, err, errTooManyBlobs)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_excess_blob_responses"))
+
+	// A tenth blob exceeds the maximum for electra too
+	addSidecars(t, beacon, blobtest.Five, 1)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), true)
+	require.ErrorIs(t, err, errTooManyBlobs)
+	require.Equal(t, float64(2), metricValue(t, svc.metrics, "blob_archiver_excess_blob_responses"))
+}
+
+func TestArchiver_DetectsBlobLimits(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	stub.SpecValues["MAX_BLOBS_PER_BLOCK"] = uint64(4)
+	svc, fs := setup(t, stub)
+
+	require.NoError(t, svc.detectBlobLimits(context.Background()))
+	require.Equal(t, uint64(4), svc.blobLimits.Deneb)
+
+	// Three carries 4 blobs, the detected maximum, and Five carries 6
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.ErrorIs(t, err, errTooManyBlobs)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+}
+
+func TestArchiver_FailsToStartWithIncompatibleSpec(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	delete(stub.SpecValues, "MAX_BLOBS_PER_BLOCK")
+	svc, fs := setup(t, stub)
+
+	err := svc.Start(context.Background())
+	require.ErrorIs(t, err, beacon.ErrIncompatibleSpec)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+}
+
+func TestArchiver_ConfiguredBlobLimits(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	delete(stub.SpecValues, "MAX_BLOBS_PER_BLOCK")
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:     5 * time.Second,
+		OriginBlock:      blobtest.OriginBlock,
+		MaxBlobsPerBlock: 7,
+	}, fs, stub, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	// The spec isn't needed with configured limits
+	require.NoError(t, svc.detectBlobLimits(context.Background()))
+
+	// Four carries 5 + 2 = 7 blobs, more than deneb allows on mainnet
+	addSidecars(t, stub, blobtest.Four, 2)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Four)
+
+	addSidecars(t, stub, blobtest.Four, 1)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
+	require.ErrorIs(t, err, errTooManyBlobs)
+}
+
+func TestArchiver_TagsOptimisticBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.False(t, fs.ReadOrFail(t, blobtest.Four).Header.Optimistic)
+
+	beacon.Optimistic = true
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+
+	data := fs.ReadOrFail(t, blobtest.Five)
+	require.True(t, data.Header.Optimistic)
+	require.Equal(t, beacon.Blobs[blobtest.Five.String()], data.BlobSidecars.Data)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_optimistic_blocks"))
+}
+
+func TestArchiver_RefusesOptimisticBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.OptimisticBlocks = flags.OptimisticBlocksRefuse
+
+	beacon.Optimistic = true
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.ErrorIs(t, err, errOptimisticBlock)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_optimistic_blocks"))
+
+	// Once the beacon node has verified the block, it is archived untagged
+	beacon.Optimistic = false
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.False(t, fs.ReadOrFail(t, blobtest.Five).Header.Optimistic)
+}
+
+func TestArchiver_ArchivesBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.ArchiveBlocks = true
+
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Five} {
+		header := beacon.Headers[hash.String()].Header.Message
+		beacon.Blocks[hash.String()] = blobtest.NewSignedBeaconBlock(t, header, beacon.Blobs[hash.String()])
+	}
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Five)
+
+	block, err := fs.ReadBlock(context.Background(), blobtest.Five)
+	require.NoError(t, err)
+	require.Equal(t, beacon.Blocks[blobtest.Five.String()], block)
+
+	// A block that doesn't match the header is rejected, and the blobs aren't written without their block
+	beacon.Blocks[blobtest.Four.String()] = beacon.Blocks[blobtest.Five.String()]
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.ErrorIs(t, err, errBeaconBlockMismatch)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+
+	delete(beacon.Blocks, blobtest.Four.String())
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.True(t, isNotFound(err))
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+}
+
+func TestArchiver_RefetchesIncompleteBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.CompleteBlocks = true
+
+	id := blobtest.Five.String()
+	sidecars := beacon.Blobs[id]
+	beacon.Blocks[id] = blobtest.NewSignedBeaconBlock(t, beacon.Headers[id].Header.Message, sidecars)
+
+	// The beacon node hasn't got all sidecars of the block yet, it's stored with the ones it has
+	beacon.Blobs[id] = sidecars[:2]
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), id, false)
+	require.NoError(t, err)
+
+	stored := fs.ReadOrFail(t, blobtest.Five)
+	require.Len(t, stored.BlobSidecars.Data, 2)
+	require.Equal(t, uint64(len(sidecars)), stored.Header.Commitments)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_incomplete_blocks"))
+
+	// Once it has them, the stored block is fetched again rather than skipped
+	beacon.Blobs[id] = sidecars
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), id, false)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	stored = fs.ReadOrFail(t, blobtest.Five)
+	require.Equal(t, sidecars, stored.BlobSidecars.Data)
+	require.Equal(t, float64(2), metricValue(t, svc.metrics, "blob_archiver_incomplete_blocks"))
+
+	// The complete block is skipped
+	beacon.Blobs[id] = sidecars[:2]
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), id, false)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, sidecars, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+	require.Equal(t, float64(2), metricValue(t, svc.metrics, "blob_archiver_incomplete_blocks"))
+}
+
+func TestArchiver_IndexesExecutionBlockNumbers(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.ExecutionIndex = true
+
+	id := blobtest.Five.String()
+	block := blobtest.NewSignedBeaconBlock(t, beacon.Headers[id].Header.Message, beacon.Blobs[id])
+	block.Deneb.Message.Body.ExecutionPayload.BlockNumber = 19426587
+	header := beacon.Headers[id].Header.Message
+	bodyRoot, err := block.Deneb.Message.Body.HashTreeRoot()
+	require.NoError(t, err)
+	header.BodyRoot = bodyRoot
+	beacon.Blocks[id] = block
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), id, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(19426587), fs.ReadOrFail(t, blobtest.Five).Header.ExecutionBlockNumber)
+
+	hash, err := fs.ReadExecutionIndex(context.Background(), 19426587)
+	require.NoError(t, err)
+	require.Equal(t, blobtest.Five, hash)
+
+	_, err = fs.ReadExecutionIndex(context.Background(), 19426588)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestArchiver_FetchAndPersistFromPeer(t *testing.T) {
+	peerStub := beacontest.NewDefaultStubBeaconClient(t)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sidecars, found := peerStub.Blobs[strings.TrimPrefix(r.URL.Path, "/eth/v1/beacon/blob_sidecars/")]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(storage.BlobSidecars{Data: sidecars}))
+	}))
+	defer peer.Close()
+
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	stub.Blobs = map[string][]*deneb.BlobSidecar{}
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+	}, fs, beacon.NewBlobArchiverSource(stub, peer.URL, time.Second), metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, peerStub.Blobs[blobtest.Five.String()], fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+	require.Empty(t, stub.SidecarRequests())
+}
+
+func TestArchiver_FetchAndPersistOverwriting(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// Blob 5 already exists
+	fs.WriteOrFail(t, storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.Five,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.Five.String()],
+		},
+	})
+
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+
+	// change the blob data -- this isn't possible w/out changing the hash. But it allows us to test the overwrite
+	beacon.Blobs[blobtest.Five.String()] = blobtest.NewBlobSidecarsForBlock(t, beacon.Headers[blobtest.Five.String()].Header, 6)
+
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), true)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// It should have overwritten the blob data
+	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+
+	// Overwriting a non-existent blob should return exists=false
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+// racingStorage never reports blobs as existing, as happens when another archiver writes a block between the check
+// and the write.
+type racingStorage struct {
+	storage.DataStore
+}
+
+func (s *racingStorage) Exists(context.Context, common.Hash) (bool, error) {
+	return false, nil
+}
+
+func TestArchiver_FetchAndPersistDedupsConcurrentWrite(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+	}, &racingStorage{storage.NewMetricsStorage(fs, "file://test", m)}, beacon, m, nil)
+	require.NoError(t, err)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.Zero(t, metricValue(t, m, "blob_archiver_storage_writes_deduped"))
+
+	// The second write finds the identical blobs already stored, which is not an error
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_storage_writes_deduped"))
+	require.Zero(t, metricValue(t, m, "blob_archiver_storage_operation_errors"))
+	require.Equal(t, beacon.Blobs[blobtest.Five.String()], fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+}
+
+// existsCountingStorage counts the exists checks made against the data store.
+type existsCountingStorage struct {
+	storage.DataStore
+	checks int
+}
+
+func (s *existsCountingStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	s.checks++
+	return s.DataStore.Exists(ctx, hash)
+}
+
+func setupSkipExists(t *testing.T, client beacon.Client, backfill flags.BackfillConfig) (*Archiver, *storagetest.TestFileStorage, *existsCountingStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	store := &existsCountingStorage{DataStore: fs}
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:    5 * time.Second,
+		OriginBlock:     blobtest.OriginBlock,
+		SkipExistsCheck: true,
+		SlotIndex:       true,
+		Backfill:        backfill,
+	}, store, client, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+	return svc, fs, store
+}
+
+func TestArchiver_SkipExistsCheckPersist(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs, store := setupSkipExists(t, beacon, flags.BackfillConfig{})
+	sidecars := float64(len(beacon.Blobs[blobtest.Five.String()]))
+
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, sidecars, metricValue(t, svc.metrics, "blob_archiver_blobs_stored"))
+
+	// The conditional write finds the block stored, which counts as an existing block rather than a stored one
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, sidecars, metricValue(t, svc.metrics, "blob_archiver_blobs_stored"))
+
+	// Different blob data stored for the block is kept, as the exists check would have, and its slot index reconciled
+	stored := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Four, Slot: 14},
+		BlobSidecars: storage.BlobSidecars{Data: beacon.Blobs[blobtest.Three.String()]},
+	}
+	fs.WriteOrFail(t, stored)
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+	stored.Header.Format = commonflags.StorageFormatJSON
+	require.Equal(t, stored, fs.ReadOrFail(t, blobtest.Four))
+
+	hash, err := fs.ReadSlotIndex(context.Background(), 14)
+	require.NoError(t, err)
+	require.Equal(t, blobtest.Four, hash)
+	require.Zero(t, store.checks)
+
+	// Overwrites still check whether the block existed, and replace stored blob data
+	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, beacon.Blobs[blobtest.Four.String()], fs.ReadOrFail(t, blobtest.Four).BlobSidecars.Data)
+}
+
+func TestArchiver_SkipExistsCheckBackfillToExistingBlock(t *testing.T) {
+	for _, backfill := range []flags.BackfillConfig{
+		{},
+		{Strategy: flags.BackfillStrategySlotRange, RangeSize: 10},
+	} {
+		t.Run(string(backfill.Strategy), func(t *testing.T) {
+			beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+			svc, fs, store := setupSkipExists(t, beacon, backfill)
+
+			fs.WriteOrFail(t, storage.BlobData{
+				Header:       storage.Header{BeaconBlockHash: blobtest.One},
+				BlobSidecars: storage.BlobSidecars{Data: beacon.Blobs[blobtest.One.String()]},
+			})
+
+			svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+			for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two} {
+				require.Equal(t, beacon.Blobs[blob.String()], fs.ReadOrFail(t, blob).BlobSidecars.Data)
+			}
+			// The walk stops at the block the conditional write found stored
+			fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+			require.Zero(t, store.checks)
+		})
+	}
+}
+
+func TestArchiver_FetchAndPersistReconcilesSlotIndex(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.SlotIndex = true
+
+	slot := uint64(beacon.Headers[blobtest.OriginBlock.String()].Header.Message.Slot)
+
+	// The blob is written but the slot index write fails, this should be reported
+	fs.SlotIndexWritesFailTimes(1)
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.OriginBlock.String(), false)
+	require.ErrorIs(t, err, storage.ErrPartialWrite)
+
+	fs.CheckExistsOrFail(t, blobtest.OriginBlock)
+	_, err = fs.ReadSlotIndex(context.Background(), slot)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.Equal(t, float64(0), metricValue(t, svc.metrics, "blob_archiver_slot_index_reconciled"))
+
+	// The retry finds the blob and repairs the index
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.OriginBlock.String(), false)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	hash, err := fs.ReadSlotIndex(context.Background(), slot)
+	require.NoError(t, err)
+	require.Equal(t, blobtest.OriginBlock, hash)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_slot_index_reconciled"))
+
+	// Nothing left to reconcile
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.OriginBlock.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_slot_index_reconciled"))
+}
+
+func TestArchiver_RearchiveProducesIdenticalObject(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), false)
+	require.NoError(t, err)
+	original := fs.ReadRawOrFail(t, blobtest.Three)
+
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Three.String(), true)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.Equal(t, original, fs.ReadRawOrFail(t, blobtest.Three))
+}
+
+// addSlotOnlyBlock adds a block to the stub beacon client whose sidecars can only be fetched by slot. The sidecars
+// carry the header of the block given by sidecarHeader.
+func addSlotOnlyBlock(t *testing.T, beacon *beacontest.StubBeaconClient, slot uint64, sidecarHeader *phase0.BeaconBlockHeader) (common.Hash, []*deneb.BlobSidecar) {
+	message := &phase0.BeaconBlockHeader{
+		Slot:          phase0.Slot(slot),
+		ProposerIndex: 1,
+		ParentRoot:    phase0.Root(blobtest.Five),
+	}
+	root, err := message.HashTreeRoot()
+	require.NoError(t, err)
+
+	if sidecarHeader == nil {
+		sidecarHeader = message
+	}
+
+	sidecars := blobtest.NewBlobSidecars(t, 2)
+	for _, sidecar := range sidecars {
+		sidecar.SignedBlockHeader = &phase0.SignedBeaconBlockHeader{Message: sidecarHeader}
+	}
+
+	header := &v1.BeaconBlockHeader{
+		Root:   root,
+		Header: &phase0.SignedBeaconBlockHeader{Message: message},
+	}
+	beacon.Headers[common.Hash(root).String()] = header
+	beacon.Headers[strconv.FormatUint(slot, 10)] = header
+	beacon.Blobs[strconv.FormatUint(slot, 10)] = sidecars
+
+	return common.Hash(root), sidecars
+}
+
+func TestArchiver_FetchSidecarsFallsBackToSlot(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	root, sidecars := addSlotOnlyBlock(t, beacon, 20, nil)
+
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), root.String(), false)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.Equal(t, sidecars, fs.ReadOrFail(t, root).BlobSidecars.Data)
+}
+
+func TestArchiver_FetchSidecarsBySlotRejectsOtherBlock(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// The sidecars served for the slot belong to a different block
+	root, _ := addSlotOnlyBlock(t, beacon, 20, &phase0.BeaconBlockHeader{Slot: 20, ProposerIndex: 2})
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), root.String(), false)
+	require.ErrorContains(t, err, "expected "+root.String())
+
+	fs.CheckNotExistsOrFail(t, root)
+}
+
+// headChangingBeaconClient simulates the head changing from block four to block five between fetching the head header
+// and its sidecars, with the beacon node serving the sidecars of the new head for the first sidecar request.
+type headChangingBeaconClient struct {
+	*beacontest.StubBeaconClient
+	moved         bool
+	servedNewHead bool
+}
+
+func (c *headChangingBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == "head" && !c.moved {
+		c.moved = true
+		return c.StubBeaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{Block: blobtest.Four.String()})
+	}
+
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func (c *headChangingBeaconClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	if c.moved && !c.servedNewHead {
+		c.servedNewHead = true
+		return c.StubBeaconClient.BlobSidecars(ctx, &api.BlobSidecarsOpts{Block: "head"})
+	}
+
+	return c.StubBeaconClient.BlobSidecars(ctx, opts)
+}
+
+func TestArchiver_PersistRejectsSidecarsOfChangedHead(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	beacon := &headChangingBeaconClient{StubBeaconClient: stub}
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	// The sidecars of block five are never stored for block four
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), "head", false)
+	require.ErrorIs(t, err, errSidecarBlockMismatch)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+
+	// Retrying resolves the new head, and stores it consistently
+	header, exists, err := retry.Do2(context.Background(), 2, retry.Fixed(0), func() (*v1.BeaconBlockHeader, bool, error) {
+		return svc.persistBlobsForBlockToS3(context.Background(), "head", false)
+	})
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, phase0.Root(blobtest.Five), header.Root)
+	require.Equal(t, stub.Blobs[blobtest.Five.String()], fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+}
+
+func TestArchiver_BackfillToOrigin(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// We have the current head, which is block 5 written to storage
+	err := fs.Write(context.Background(), storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.Five,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.Five.String()],
+		},
+	})
+	require.NoError(t, err)
+	// We expect to backfill all blocks to the origin
+	expectedBlobs := []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock}
+
+	for _, blob := range expectedBlobs {
+		fs.CheckNotExistsOrFail(t, blob)
+	}
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, blob := range expectedBlobs {
+		fs.CheckExistsOrFail(t, blob)
+		data := fs.ReadOrFail(t, blob)
+		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+	}
+}
+
+// flakyHeaderBeaconClient responds to the first header lookups of a block with a 404, as a beacon node may briefly do
+// after a restart, and counts the header lookups of every block.
+type flakyHeaderBeaconClient struct {
+	*beacontest.StubBeaconClient
+	notFound map[string]int
+	lookups  map[string]int
+}
+
+func (c *flakyHeaderBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	c.lookups[opts.Block]++
+	if c.notFound[opts.Block] > 0 {
+		c.notFound[opts.Block]--
+		return nil, &api.Error{StatusCode: 404, Data: []byte("block not found")}
+	}
+
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func setupFlaky(t *testing.T, beacon *flakyHeaderBeaconClient, retries int) (*Archiver, *storagetest.TestFileStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Strategy:              flags.BackfillStrategyParentWalk,
+			NotFoundRetries:       retries,
+			NotFoundRetryInterval: time.Millisecond,
+		},
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+	return svc, fs
+}
+
+func TestArchiver_PersistRetryReusesFetchedBlock(t *testing.T) {
+	beacon := &flakyHeaderBeaconClient{
+		StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t),
+		notFound:         map[string]int{},
+		lookups:          map[string]int{},
+	}
+	svc, fs := setupFlaky(t, beacon, 0)
+
+	// The retry of a failed write sharing the attempt only writes again
+	ctx := withPersistAttempt(context.Background())
+	fs.WritesFailTimes(1)
+	_, _, err := svc.persistBlobsForBlockToS3(ctx, blobtest.Five.String(), false)
+	require.ErrorIs(t, err, storage.ErrStorage)
+
+	_, exists, err := svc.persistBlobsForBlockToS3(ctx, blobtest.Five.String(), false)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, beacon.Blobs[blobtest.Five.String()], fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data)
+	require.Equal(t, 1, beacon.lookups[blobtest.Five.String()])
+	require.Equal(t, []string{blobtest.Five.String()}, beacon.SidecarRequests())
+
+	// Persists without a shared attempt fetch the block again
+	fs.WritesFailTimes(1)
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.ErrorIs(t, err, storage.ErrStorage)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, 2, beacon.lookups[blobtest.Four.String()])
+	require.Len(t, beacon.SidecarRequests(), 3)
+}
+
+func TestArchiver_BackfillRetriesParentNotFound(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	beacon := &flakyHeaderBeaconClient{
+		StubBeaconClient: stub,
+		notFound:         map[string]int{blobtest.Three.String(): 2},
+		lookups:          map[string]int{},
+	}
+	svc, fs := setupFlaky(t, beacon, 3)
+
+	svc.backfillBlobs(context.Background(), stub.Headers[blobtest.Five.String()])
+
+	// The transient 404s don't stop the backfill from reaching the origin
+	require.Equal(t, 3, beacon.lookups[blobtest.Three.String()])
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+}
+
+func TestArchiver_BackfillStopsAtAbsentParent(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	delete(stub.Headers, blobtest.Three.String())
+	beacon := &flakyHeaderBeaconClient{
+		StubBeaconClient: stub,
+		notFound:         map[string]int{},
+		lookups:          map[string]int{},
+	}
+	svc, fs := setupFlaky(t, beacon, 2)
+
+	svc.backfillBlobs(context.Background(), stub.Headers[blobtest.Five.String()])
+
+	// The lookup is retried twice, after which the block is accepted as absent and the backfill returns
+	require.Equal(t, 3, beacon.lookups[blobtest.Three.String()])
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckNotExistsOrFail(t, blobtest.Three)
+	fs.CheckNotExistsOrFail(t, blobtest.Two)
+}
+
+func TestArchiver_BackfillToExistingBlock(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	// We have the current head, which is block 5 written to storage
+	err := fs.Write(context.Background(), storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.Five,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.Five.String()],
+		},
+	})
+	require.NoError(t, err)
+
+	// We also have block 1 written to storage
+	err = fs.Write(context.Background(), storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.One,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.One.String()],
+		},
+	})
+	require.NoError(t, err)
+
+	// We expect to backfill all blobs between 5 and 1
+	expectedBlobs := []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two}
+
+	for _, blob := range expectedBlobs {
+		exists, err := fs.Exists(context.Background(), blob)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, blob := range expectedBlobs {
+		exists, err := fs.Exists(context.Background(), blob)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		data, err := fs.Read(context.Background(), blob)
+		require.NoError(t, err)
+		require.NotNil(t, data)
+		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+	}
+}
+
+func setupRange(t *testing.T, beacon *beacontest.StubRangeBeaconClient, rangeSize uint64) (*Archiver, *storagetest.TestFileStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Strategy:  flags.BackfillStrategySlotRange,
+			RangeSize: rangeSize,
+		},
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+	return svc, fs
+}
+
+func TestArchiver_BackfillByRangeToOrigin(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	svc, fs := setupRange(t, beacon, 2)
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		data := fs.ReadOrFail(t, blob)
+		require.Equal(t, beacon.Blobs[blob.String()], data.BlobSidecars.Data)
+	}
+
+	// Slots 13-14, 11-12 and 9-10, stopping once the origin is reached
+	require.Equal(t, 3, beacon.RangeRequests)
+	require.Equal(t, float64(5), metricValue(t, svc.metrics, "blob_archiver_blocks_processed"))
+}
+
+func TestArchiver_BackfillByRangeToExistingBlock(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	svc, fs := setupRange(t, beacon, 10)
+
+	fs.WriteOrFail(t, storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.One,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.One.String()],
+		},
+	})
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+	require.Equal(t, 1, beacon.RangeRequests)
+}
+
+func TestArchiver_BackfillByRangeFallsBackToParentWalk(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t), Unsupported: true}
+	svc, fs := setupRange(t, beacon, 2)
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, blob)
+	}
+	require.Equal(t, 1, beacon.RangeRequests)
+}
+
+func TestArchiver_BackfillByRangeIgnoresBlocksOffChain(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	svc, fs := setupRange(t, beacon, 10)
+
+	// The block at slot 12 in the range is not the parent of block 3, e.g. because of a reorg
+	orphan := common.Hash{0xde, 0xad}
+	slot := strconv.FormatUint(blobtest.StartSlot+2, 10)
+	beacon.Headers[slot] = &v1.BeaconBlockHeader{
+		Root: phase0.Root(orphan),
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{
+				Slot:       phase0.Slot(blobtest.StartSlot + 2),
+				ParentRoot: phase0.Root(blobtest.One),
+			},
+		},
+	}
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	fs.CheckNotExistsOrFail(t, orphan)
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, blob)
+	}
+}
+
+func TestArchiver_BackfillBySlotRangeClient(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Strategy:  flags.BackfillStrategySlotRange,
+			RangeSize: 4,
+		},
+	}, fs, beacon.NewSlotRangeClient(stub, 2), metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	svc.backfillBlobs(context.Background(), stub.Headers[blobtest.Five.String()])
+
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		require.Equal(t, stub.Blobs[blob.String()], fs.ReadOrFail(t, blob).BlobSidecars.Data)
+	}
+}
+
+func TestArchiver_BackfillByRangeRejectsSidecarsOfOtherBlock(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	svc, fs := setupRange(t, beacon, 10)
+
+	// The range serves sidecars for slot 13 that don't belong to block three
+	beacon.Blobs[strconv.FormatUint(blobtest.StartSlot+3, 10)] = blobtest.NewBlobSidecars(t, 4)
+
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	// The parent walk takes over from block four, fetching block three's own sidecars
+	for _, blob := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		require.Equal(t, beacon.Blobs[blob.String()], fs.ReadOrFail(t, blob).BlobSidecars.Data)
+	}
+}
+
+func TestArchiver_BackfillSkipsSlotsOutsideAllowlist(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	filter, err := flags.SlotFilterConfig{
+		Allowlist: fmt.Sprintf("%d-%d", blobtest.StartSlot+2, blobtest.StartSlot+3),
+	}.Parse()
+	require.NoError(t, err)
+	svc.slotFilter = filter
+
+	fs.WriteOrFail(t, storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.Five,
+		},
+		BlobSidecars: storage.BlobSidecars{
+			Data: beacon.Blobs[blobtest.Five.String()],
+		},
+	})
+
+	// The walk terminates below the allowlist, only storing blocks in the allowlist
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+}
+
+func TestArchiver_LatestSkipsSlotsInDenylist(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		SlotFilter: flags.SlotFilterConfig{
+			Denylist: fmt.Sprintf("%d,%d", blobtest.StartSlot, blobtest.StartSlot+4),
+		},
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	// The origin is denied and never stored, the walk still stops there
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	fs.CheckExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+}
+
+func TestArchiver_LatestWalkIsBoundedByAllowlist(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		SlotFilter: flags.SlotFilterConfig{
+			Allowlist: fmt.Sprintf("%d", blobtest.StartSlot+1),
+		},
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+
+	// The walk stops at the lowest allowed slot, rather than the origin
+	svc.processBlocksUntilKnownBlock(context.Background())
 
-	// Blob 5 already exists
-	fs.WriteOrFail(t, storage.BlobData{
-		Header: storage.Header{
-			BeaconBlockHash: blobtest.Five,
-		},
-		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
-		},
-	})
+	fs.CheckExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+	require.NotContains(t, beacon.BlobSidecarsRequests, blobtest.OriginBlock.String())
+	require.Equal(t, float64(5), metricValue(t, m, "blob_archiver_blocks_processed"))
 
-	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	// Nothing in the walked range is stored, but it isn't walked again while the head is unchanged
+	svc.processBlocksUntilKnownBlock(context.Background())
+	require.Equal(t, float64(5), metricValue(t, m, "blob_archiver_blocks_processed"))
 
-	// change the blob data -- this isn't possible w/out changing the hash. But it allows us to test the overwrite
-	beacon.Blobs[blobtest.Five.String()] = blobtest.NewBlobSidecars(t, 6)
+	// A new head is only walked back to the previous head
+	addSlotOnlyBlock(t, beacon, blobtest.EndSlot+1, nil)
+	beacon.Headers["head"] = beacon.Headers[strconv.FormatUint(blobtest.EndSlot+1, 10)]
+	svc.processBlocksUntilKnownBlock(context.Background())
+	require.Equal(t, float64(6), metricValue(t, m, "blob_archiver_blocks_processed"))
+}
 
-	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), true)
+func TestArchiver_MinForkFilter(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	stub.SpecValues["SLOTS_PER_EPOCH"] = uint64(4)
+	stub.SpecValues["ELECTRA_FORK_EPOCH"] = uint64(3)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		SlotFilter:   flags.SlotFilterConfig{MinFork: "electra"},
+	}, fs, stub, m, nil)
 	require.NoError(t, err)
-	require.True(t, exists)
+	require.NoError(t, svc.detectMinFork(context.Background()))
 
-	// It should have overwritten the blob data
-	require.Equal(t, fs.ReadOrFail(t, blobtest.Five).BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
+	// Electra starts at slot 12, the walk stops there rather than at the origin
+	svc.processBlocksUntilKnownBlock(context.Background())
 
-	// Overwriting a non-existent blob should return exists=false
-	_, exists, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), true)
+	for _, hash := range []common.Hash{blobtest.Five, blobtest.Four, blobtest.Three, blobtest.Two} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+	require.NotContains(t, stub.BlobSidecarsRequests, blobtest.One.String())
+
+	// Blocks of earlier forks are skipped, wherever they are archived from
+	_, exists, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.One.String(), false)
 	require.NoError(t, err)
 	require.False(t, exists)
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	require.Equal(t, map[string]float64{"min_slot": 1}, counterValues(t, m, "blob_archiver_blocks_filtered"))
+
+	// A fork that isn't scheduled fails the startup
+	svc.cfg.SlotFilter.MinFork = "fulu"
+	require.ErrorIs(t, svc.detectMinFork(context.Background()), beacon.ErrIncompatibleSpec)
+	stub.SpecValues["FULU_FORK_EPOCH"] = uint64(math.MaxUint64)
+	require.ErrorIs(t, svc.detectMinFork(context.Background()), beacon.ErrIncompatibleSpec)
 }
 
-func TestArchiver_BackfillToOrigin(t *testing.T) {
-	beacon := beacontest.NewDefaultStubBeaconClient(t)
-	svc, fs := setup(t, beacon)
+func TestArchiver_AvailabilityWindowBackfill(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	stub.SpecValues["SLOTS_PER_EPOCH"] = uint64(2)
+	stub.SpecValues["DENEB_FORK_EPOCH"] = uint64(0)
+	stub.SpecValues["MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS"] = uint64(2)
+	stub.GenesisTime = time.Unix(1606824023, 0)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
 
-	// We have the current head, which is block 5 written to storage
-	err := fs.Write(context.Background(), storage.BlobData{
-		Header: storage.Header{
-			BeaconBlockHash: blobtest.Five,
-		},
-		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
-		},
-	})
+	// Without an origin block
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		Backfill:     flags.BackfillConfig{AvailabilityWindow: true},
+	}, fs, stub, metrics.NewMetrics(), nil)
 	require.NoError(t, err)
-	// We expect to backfill all blocks to the origin
-	expectedBlobs := []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock}
 
-	for _, blob := range expectedBlobs {
-		fs.CheckNotExistsOrFail(t, blob)
-	}
+	// At slot 17, in epoch 8, blobs are available from epoch 6 on, which starts at slot 12
+	svc.clock = beacontest.NewFakeClock(stub.GenesisTime.Add(17 * 12 * time.Second))
+	require.NoError(t, svc.detectAvailabilityWindow(context.Background()))
+	require.Equal(t, uint64(12), svc.availabilitySlot.Load())
 
-	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+	svc.backfillBlobs(context.Background(), stub.Headers[blobtest.Five.String()])
 
-	for _, blob := range expectedBlobs {
-		fs.CheckExistsOrFail(t, blob)
-		data := fs.ReadOrFail(t, blob)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two} {
+		fs.CheckExistsOrFail(t, hash)
 	}
+	fs.CheckNotExistsOrFail(t, blobtest.One)
+	fs.CheckNotExistsOrFail(t, blobtest.OriginBlock)
+	require.NotContains(t, stub.BlobSidecarsRequests, blobtest.One.String())
+
+	// A spec without the window fails the startup
+	delete(stub.SpecValues, "MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS")
+	require.ErrorIs(t, svc.detectAvailabilityWindow(context.Background()), beacon.ErrIncompatibleSpec)
 }
 
-func TestArchiver_BackfillToExistingBlock(t *testing.T) {
+func TestArchiver_ProposerAllowlist(t *testing.T) {
 	beacon := beacontest.NewDefaultStubBeaconClient(t)
-	svc, fs := setup(t, beacon)
+	for _, header := range beacon.Headers {
+		if root := common.Hash(header.Root); root == blobtest.Four || root == blobtest.Two {
+			header.Header.Message.ProposerIndex = 7
+		}
+	}
 
-	// We have the current head, which is block 5 written to storage
-	err := fs.Write(context.Background(), storage.BlobData{
-		Header: storage.Header{
-			BeaconBlockHash: blobtest.Five,
-		},
-		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.Five.String()],
-		},
-	})
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		SlotFilter:   flags.SlotFilterConfig{ProposerAllowlist: "5-7,9"},
+	}, fs, beacon, m, nil)
 	require.NoError(t, err)
 
-	// We also have block 1 written to storage
-	err = fs.Write(context.Background(), storage.BlobData{
-		Header: storage.Header{
-			BeaconBlockHash: blobtest.One,
-		},
-		BlobSidecars: storage.BlobSidecars{
-			Data: beacon.Blobs[blobtest.One.String()],
-		},
-	})
+	// Blocks of other proposers are walked through, but not stored
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Two)
+	for _, hash := range []common.Hash{blobtest.Five, blobtest.Three, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+	require.Equal(t, map[string]float64{"proposer": 4}, counterValues(t, m, "blob_archiver_blocks_filtered"))
+}
+
+func TestArchiver_LatestDelaysHead(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		HeadDelay:    1,
+	}, fs, beacon, metrics.NewMetrics(), nil)
 	require.NoError(t, err)
 
-	// We expect to backfill all blobs between 5 and 1
-	expectedBlobs := []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two}
+	// The head is within the delay, the walk starts from its parent
+	svc.processBlocksUntilKnownBlock(context.Background())
 
-	for _, blob := range expectedBlobs {
-		exists, err := fs.Exists(context.Background(), blob)
-		require.NoError(t, err)
-		require.False(t, exists)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckExistsOrFail(t, hash)
 	}
 
-	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+	latest, err := fs.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, blobtest.Four, latest.BeaconBlockHash)
 
-	for _, blob := range expectedBlobs {
-		exists, err := fs.Exists(context.Background(), blob)
-		require.NoError(t, err)
-		require.True(t, exists)
+	// Once the head has moved past the delay, the previous head is archived
+	next, _ := addSlotOnlyBlock(t, beacon, blobtest.EndSlot+1, nil)
+	beacon.Headers["head"] = beacon.Headers[next.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
 
-		data, err := fs.Read(context.Background(), blob)
-		require.NoError(t, err)
-		require.NotNil(t, data)
-		require.Equal(t, data.BlobSidecars.Data, beacon.Blobs[blob.String()])
-	}
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckNotExistsOrFail(t, next)
+}
+
+func TestArchiver_InvalidSlotFilter(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	_, err := NewArchiver(l, flags.ArchiverConfig{
+		SlotFilter: flags.SlotFilterConfig{
+			Allowlist: "20-10",
+		},
+	}, nil, nil, metrics.NewMetrics(), nil)
+	require.ErrorContains(t, err, "invalid slot allowlist")
 }
 
 func TestArchiver_LatestStopsAtExistingBlock(t *testing.T) {
@@ -199,6 +1363,60 @@ func TestArchiver_LatestStopsAtExistingBlock(t *testing.T) {
 	require.Equal(t, five.BlobSidecars.Data, beacon.Blobs[blobtest.Five.String()])
 }
 
+// recordingProducer records the events published to it.
+type recordingProducer struct {
+	published chan events.BlockArchived
+}
+
+func (p *recordingProducer) Publish(_ context.Context, payload []byte) error {
+	var event events.BlockArchived
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return err
+	}
+
+	p.published <- event
+	return nil
+}
+
+func (p *recordingProducer) Close() error {
+	return nil
+}
+
+func TestArchiver_LatestEmitsEventsForWrittenBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	producer := &recordingProducer{published: make(chan events.BlockArchived, 10)}
+	emitter, err := events.NewEmitter(producer, 10, events.RetryConfig{}, m, l)
+	require.NoError(t, err)
+
+	// Four is denied, so only five is written before the walk stops at three
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		SlotFilter:   flags.SlotFilterConfig{Denylist: strconv.FormatUint(blobtest.StartSlot+4, 10)},
+	}, fs, beacon, m, emitter)
+	require.NoError(t, err)
+
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Three}})
+
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	select {
+	case event := <-producer.published:
+		require.Equal(t, blobtest.Five, event.Root)
+		require.Equal(t, blobtest.StartSlot+5, event.Slot)
+		require.Equal(t, len(beacon.Blobs[blobtest.Five.String()]), event.Sidecars)
+	case <-time.After(time.Second):
+		t.Fatal("no event published")
+	}
+
+	require.NoError(t, svc.Stop(context.Background()))
+	require.Empty(t, producer.published)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_archive_events"))
+}
+
 func TestArchiver_LatestNoNewData(t *testing.T) {
 	beacon := beacontest.NewDefaultStubBeaconClient(t)
 	svc, fs := setup(t, beacon)
@@ -253,6 +1471,187 @@ func TestArchiver_LatestConsumesNewBlocks(t *testing.T) {
 	fs.CheckNotExistsOrFail(t, blobtest.Three)
 }
 
+func TestArchiver_LatestBoundsHopsPerRefresh(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		LiveMaxHops:  2,
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	checkStored := func(stored []common.Hash, missing []common.Hash) {
+		for _, hash := range stored {
+			fs.CheckExistsOrFail(t, hash)
+		}
+		for _, hash := range missing {
+			fs.CheckNotExistsOrFail(t, hash)
+		}
+	}
+
+	// The walk from the head stops after two blocks
+	svc.processBlocksUntilKnownBlock(context.Background())
+	checkStored([]common.Hash{blobtest.Five, blobtest.Four}, []common.Hash{blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock})
+
+	// The head is walked first, and the hop left over continues the gap
+	svc.processBlocksUntilKnownBlock(context.Background())
+	checkStored([]common.Hash{blobtest.Three}, []common.Hash{blobtest.Two})
+
+	// New blocks take up the hops before the gap does
+	next, _ := addSlotOnlyBlock(t, beacon, blobtest.EndSlot+1, nil)
+	beacon.Headers["head"] = beacon.Headers[next.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+	checkStored([]common.Hash{next}, []common.Hash{blobtest.Two})
+
+	for i := 0; i < 3; i++ {
+		svc.processBlocksUntilKnownBlock(context.Background())
+	}
+	checkStored([]common.Hash{blobtest.Two, blobtest.One, blobtest.OriginBlock}, nil)
+	require.Empty(t, svc.liveGaps)
+}
+
+func TestArchiver_LatestCheckpointsLiveGaps(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		LiveMaxHops:  2,
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	// The gap is left to the backfill of the next start
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.checkpointLiveGaps(ctx)
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{
+		BeaconBlockHash: blobtest.Four,
+		Slot:            uint64(beacon.Headers[blobtest.Four.String()].Header.Message.Slot),
+	}}, checkpoint)
+}
+
+// recordingHeaderBeaconClient records the block identifier of every header request, which may be made concurrently.
+type recordingHeaderBeaconClient struct {
+	*beacontest.StubBeaconClient
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *recordingHeaderBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, opts.Block)
+	c.mu.Unlock()
+
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func (c *recordingHeaderBeaconClient) takeRequests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	requests := c.requests
+	c.requests = nil
+	return requests
+}
+
+func setupPrefetch(t *testing.T, depth int) (*Archiver, *storagetest.TestFileStorage, *recordingHeaderBeaconClient) {
+	beacon := &recordingHeaderBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:      5 * time.Second,
+		OriginBlock:       blobtest.OriginBlock,
+		LivePrefetchDepth: depth,
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+	return svc, fs, beacon
+}
+
+func TestArchiver_LatestPrefetchMatchesSerial(t *testing.T) {
+	for _, depth := range []int{0, 1, 3, 100} {
+		depth := depth
+		t.Run(fmt.Sprintf("depth %d", depth), func(t *testing.T) {
+			svc, fs, beacon := setupPrefetch(t, depth)
+			fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Two}})
+
+			svc.processBlocksUntilKnownBlock(context.Background())
+
+			// The same blocks are written as by the serial walk, which stops at two
+			for _, hash := range []common.Hash{blobtest.Five, blobtest.Four, blobtest.Three} {
+				require.Equal(t, beacon.Blobs[hash.String()], fs.ReadOrFail(t, hash).BlobSidecars.Data)
+			}
+			fs.CheckNotExistsOrFail(t, blobtest.One)
+			require.Equal(t, float64(3), metricValue(t, svc.metrics, "blob_archiver_blocks_processed"))
+
+			latest, err := fs.ReadLatest(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, blobtest.Five, latest.BeaconBlockHash)
+
+			// Parents within the prefetch depth are not fetched by root
+			requests := beacon.takeRequests()
+			require.Equal(t, depth < 1, slices.Contains(requests, blobtest.Four.String()))
+			require.Equal(t, depth < 2, slices.Contains(requests, blobtest.Three.String()))
+		})
+	}
+}
+
+func TestArchiver_LatestPrefetchStopsAtPreviousHead(t *testing.T) {
+	svc, fs, beacon := setupPrefetch(t, 100)
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Two}})
+
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	beacon.takeRequests()
+
+	// Four is the head of the previous refresh, so only the slot of five is above it and nothing is prefetched
+	beacon.Headers["head"] = beacon.Headers[blobtest.Five.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	require.Equal(t, []string{"head", blobtest.Four.String()}, beacon.takeRequests())
+}
+
+func TestArchiver_LatestPointerTracksLiveWrites(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Three}})
+	_, err := fs.ReadLatest(context.Background())
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// The walk from four writes four, then stops at three
+	beacon.Headers["head"] = beacon.Headers[blobtest.Four.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	latest, err := fs.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.Header{BeaconBlockHash: blobtest.Four, Slot: blobtest.StartSlot + 4}, latest)
+
+	beacon.Headers["head"] = beacon.Headers[blobtest.Five.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	latest, err = fs.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.Header{BeaconBlockHash: blobtest.Five, Slot: blobtest.StartSlot + 5}, latest)
+
+	// Blocks that already existed are not written, so the pointer is left untouched
+	fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Two}})
+	require.NoError(t, fs.WriteLatest(context.Background(), storage.Header{BeaconBlockHash: blobtest.Two}))
+	svc.processBlocksUntilKnownBlock(context.Background())
+
+	latest, err = fs.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, blobtest.Two, latest.BeaconBlockHash)
+}
+
 func TestArchiver_LatestStopsAtOrigin(t *testing.T) {
 	beacon := beacontest.NewDefaultStubBeaconClient(t)
 	svc, fs := setup(t, beacon)
@@ -357,7 +1756,7 @@ func TestArchiver_RearchiveRange(t *testing.T) {
 	fs.CheckNotExistsOrFail(t, blobtest.Four)
 
 	// this modifies the blobs at 3, purely to test the blob is rearchived
-	beacon.Blobs[blobtest.Three.String()] = blobtest.NewBlobSidecars(t, 6)
+	beacon.Blobs[blobtest.Three.String()] = blobtest.NewBlobSidecarsForBlock(t, beacon.Headers[blobtest.Three.String()].Header, 6)
 
 	from, to := blobtest.StartSlot+1, blobtest.StartSlot+4
 
@@ -376,3 +1775,55 @@ func TestArchiver_RearchiveRange(t *testing.T) {
 	// Should have overwritten any existing blobs
 	require.Equal(t, fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data, beacon.Blobs[blobtest.Three.String()])
 }
+
+func TestArchiver_VerifySignatures(t *testing.T) {
+	stub := beacontest.NewEmptyStubBeaconClient()
+	alice, bob := big.NewInt(0xa11ce), big.NewInt(0xb0b)
+	stub.AddValidator(1, alice)
+	stub.AddValidator(2, bob)
+
+	// signedBlock adds a block proposed by validator 1 to the stub, signed with the secret key
+	signedBlock := func(slot uint64, secretKey *big.Int) common.Hash {
+		header := &v1.BeaconBlockHeader{
+			Header: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot), ProposerIndex: 1},
+			},
+		}
+		stub.SignHeader(t, header, secretKey)
+
+		sidecars := blobtest.NewBlobSidecars(t, 2)
+		for _, sidecar := range sidecars {
+			sidecar.SignedBlockHeader = header.Header
+		}
+
+		stub.Headers[header.Root.String()] = header
+		stub.Blobs[header.Root.String()] = sidecars
+		return common.Hash(header.Root)
+	}
+
+	valid := signedBlock(10, alice)
+	forged := signedBlock(11, bob)
+
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:       5 * time.Second,
+		OriginBlock:        blobtest.OriginBlock,
+		VerifySignatures:   true,
+		ValidatorCacheSize: 10,
+	}, fs, stub, m, nil)
+	require.NoError(t, err)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), valid.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, stub.Blobs[valid.String()], fs.ReadOrFail(t, valid).BlobSidecars.Data)
+
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), forged.String(), false)
+	require.ErrorIs(t, err, beacon.ErrInvalidSignature)
+	fs.CheckNotExistsOrFail(t, forged)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_invalid_signatures"))
+
+	// The public key of the proposer was fetched once
+	require.Equal(t, 1, stub.ValidatorsRequests)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runBackfills backfills from each of the given blocks in turn, followed by the blocks of the backfill checkpoint left
+// by a previous run. If Backfill.Deadline is set, backfilling stops once it has passed, and the blocks it stopped at
+// and those it didn't get to are written to the checkpoint, so that the next start resumes from them. Otherwise, the
+// checkpoint is cleared once every backfill has completed. Live archiving is unaffected by the deadline. Completed
+// backfills are verified if Backfill.Verify is set, see verifyBackfill. With the oldest-first order, see
+// runForwardBackfill and runChunkedBackfill, only the first of the given blocks is backfilled up to.
+func (a *Archiver) runBackfills(ctx context.Context, starts []*v1.BeaconBlockHeader) {
+	if a.cfg.Backfill.Order == flags.BackfillOrderOldestFirst {
+		// The other blocks are those below interrupted writes, which walking forward up to the head passes anyway
+		if a.cfg.Backfill.ChunkSize > 0 {
+			a.runChunkedBackfill(ctx, starts[0])
+		} else {
+			a.runForwardBackfill(ctx, starts[0])
+		}
+		return
+	}
+
+	resumed, unresolved, found := a.readBackfillCheckpoint(ctx)
+	starts = append(starts, resumed...)
+
+	backfillCtx := ctx
+	if a.cfg.Backfill.Deadline > 0 {
+		var cancel context.CancelFunc
+		backfillCtx, cancel = context.WithTimeout(ctx, a.cfg.Backfill.Deadline)
+		defer cancel()
+	}
+
+	for i, start := range starts {
+		stopped := a.backfillBlobs(backfillCtx, start)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if backfillCtx.Err() != nil {
+			remaining := append([]*v1.BeaconBlockHeader{stopped}, starts[i+1:]...)
+			a.log.Warn("backfill deadline reached, stopping backfill", "deadline", a.cfg.Backfill.Deadline,
+				"startHash", start.Root.String(), "startSlot", start.Header.Message.Slot,
+				"endHash", stopped.Root.String(), "endSlot", stopped.Header.Message.Slot, "remaining", len(remaining))
+			a.writeBackfillCheckpoint(ctx, remaining, unresolved)
+			return
+		}
+
+		if a.cfg.Backfill.Verify {
+			if _, err := a.verifyBackfill(ctx, stopped, start); err != nil {
+				a.log.Error("failed to verify backfill", "err", err, "startHash", start.Root.String(), "endHash", stopped.Root.String())
+			}
+		}
+	}
+
+	if found {
+		a.writeBackfillCheckpoint(ctx, nil, unresolved)
+	}
+}
+
+// readBackfillCheckpoint reads the blocks of the backfill checkpoint and fetches their headers. Blocks the beacon node
+// no longer has are discarded, and those whose header can't be fetched are returned separately, to be kept in the
+// checkpoint. It also returns whether the checkpoint had any blocks.
+func (a *Archiver) readBackfillCheckpoint(ctx context.Context) ([]*v1.BeaconBlockHeader, []storage.Header, bool) {
+	checkpoint, err := a.dataStoreClient.ReadBackfillCheckpoint(ctx)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			a.log.Error("failed to read backfill checkpoint", "err", err)
+		}
+		return nil, nil, false
+	}
+
+	var resumed []*v1.BeaconBlockHeader
+	var unresolved []storage.Header
+	for _, entry := range checkpoint {
+		header, err := retry.Do(ctx, startupFetchBlobMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, error) {
+			result, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+				Block: entry.BeaconBlockHash.String(),
+			})
+			if isNotFound(err) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return result.Data, nil
+		})
+
+		if err != nil {
+			a.log.Error("failed to fetch checkpointed backfill block, keeping it for the next start", "err", err, "hash", entry.BeaconBlockHash, "slot", entry.Slot)
+			unresolved = append(unresolved, entry)
+			continue
+		}
+
+		if header == nil {
+			a.log.Warn("discarding checkpointed backfill block unknown to the beacon node", "hash", entry.BeaconBlockHash, "slot", entry.Slot)
+			continue
+		}
+
+		a.log.Info("resuming backfill from checkpoint", "hash", entry.BeaconBlockHash, "slot", entry.Slot)
+		resumed = append(resumed, header)
+	}
+
+	return resumed, unresolved, len(checkpoint) > 0
+}
+
+// writeBackfillCheckpoint replaces the backfill checkpoint with the given blocks. Failing to write it only causes the
+// remaining backfill to be skipped, so it is logged rather than returned.
+func (a *Archiver) writeBackfillCheckpoint(ctx context.Context, headers []*v1.BeaconBlockHeader, unresolved []storage.Header) {
+	checkpoint := make([]storage.Header, 0, len(headers)+len(unresolved))
+	for _, header := range headers {
+		checkpoint = append(checkpoint, storage.Header{
+			BeaconBlockHash: common.Hash(header.Root),
+			Slot:            uint64(header.Header.Message.Slot),
+		})
+	}
+	checkpoint = append(checkpoint, unresolved...)
+
+	if err := a.dataStoreClient.WriteBackfillCheckpoint(ctx, checkpoint); err != nil {
+		a.log.Error("failed to write backfill checkpoint", "err", err)
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// stallingBeaconClient stalls header lookups of a block until their context is done, as a slow beacon node would.
+type stallingBeaconClient struct {
+	*beacontest.StubBeaconClient
+	stallAt common.Hash
+}
+
+func (c *stallingBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == c.stallAt.String() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func TestArchiver_BackfillHaltsAtDeadline(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	cfg := flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Strategy: flags.BackfillStrategyParentWalk,
+			Deadline: 100 * time.Millisecond,
+		},
+	}
+
+	require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Five},
+		BlobSidecars: storage.BlobSidecars{Data: stub.Blobs[blobtest.Five.String()]},
+	}))
+
+	svc, err := NewArchiver(l, cfg, fs, &stallingBeaconClient{StubBeaconClient: stub, stallAt: blobtest.Two}, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backfill did not halt at the deadline")
+	}
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	for _, hash := range []common.Hash{blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+
+	// The block the backfill halted at is checkpointed
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{BeaconBlockHash: blobtest.Three, Slot: 13}}, checkpoint)
+
+	// On the next start, the backfill from the new head stops at the stored blocks, and is then resumed from the
+	// checkpoint, which is cleared once the backfill completes
+	svc, err = NewArchiver(l, cfg, fs, stub, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	for _, hash := range []common.Hash{blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		data := fs.ReadOrFail(t, hash)
+		require.Equal(t, stub.Blobs[hash.String()], data.BlobSidecars.Data)
+	}
+
+	checkpoint, err = fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, checkpoint)
+}
+
+func TestArchiver_BackfillCheckpointDiscardsUnknownBlocks(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, stub)
+
+	require.NoError(t, fs.WriteBackfillCheckpoint(context.Background(), []storage.Header{{BeaconBlockHash: common.Hash{0xff}, Slot: 16}}))
+
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, checkpoint)
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// backfillChunk is a range of slots of a chunked backfill, see runChunkedBackfill. Next is the first slot of the chunk
+// that isn't backfilled yet, and last the last block stored in it, if any.
+type backfillChunk struct {
+	next uint64
+	end  uint64
+	last common.Hash
+}
+
+func (c *backfillChunk) done() bool {
+	return c.next >= c.end
+}
+
+// chunkEnd returns the first slot after the chunk the slot belongs to. Chunks are aligned to multiples of their size, so
+// that backfills resumed from a checkpoint divide slots along the same boundaries, and never overlap.
+func chunkEnd(slot, size uint64) uint64 {
+	return (slot/size + 1) * size
+}
+
+// splitChunks divides the slots from from up to, but excluding, to into chunks of the given size.
+func splitChunks(from, to, size uint64) []*backfillChunk {
+	var chunks []*backfillChunk
+	for from < to {
+		end := min(chunkEnd(from, size), to)
+		chunks = append(chunks, &backfillChunk{next: from, end: end})
+		from = end
+	}
+	return chunks
+}
+
+// runChunkedBackfill backfills oldest-first like runForwardBackfill, but divides the slots up to the given head into
+// chunks of Backfill.ChunkSize slots, of which Backfill.ChunkConcurrency are backfilled at once. Every time a chunk
+// completes, and once Backfill.Deadline has passed, the backfill checkpoint is replaced with the next slot of each
+// incomplete chunk, followed by the head, so that the next start resumes every chunk from where it got to, and
+// continues from the head up to its own. The checkpoint of an unchunked oldest-first backfill, a single block, resumes
+// from that block.
+func (a *Archiver) runChunkedBackfill(ctx context.Context, head *v1.BeaconBlockHeader) {
+	backfillCtx := ctx
+	if a.cfg.Backfill.Deadline > 0 {
+		var cancel context.CancelFunc
+		backfillCtx, cancel = context.WithTimeout(ctx, a.cfg.Backfill.Deadline)
+		defer cancel()
+	}
+
+	chunks, ok := a.readChunkCheckpoint(backfillCtx, uint64(head.Header.Message.Slot))
+	if !ok {
+		return
+	}
+
+	if len(chunks) == 0 {
+		a.log.Info("backfill complete, no slots to backfill", "headSlot", head.Header.Message.Slot)
+		return
+	}
+
+	from, to := chunks[0].next, chunks[len(chunks)-1].end
+	a.log.Info("starting chunked backfill", "from", from, "to", to, "chunks", len(chunks),
+		"chunkSize", a.cfg.Backfill.ChunkSize, "concurrency", a.cfg.Backfill.ChunkConcurrency)
+
+	var mu sync.Mutex
+	checkpoint := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		a.writeChunkCheckpoint(ctx, chunks, head)
+	}
+
+	work := make(chan *backfillChunk)
+	var wg sync.WaitGroup
+	for i := 0; i < a.cfg.Backfill.ChunkConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range work {
+				next, last := a.backfillSlots(withBlockSource(backfillCtx, metrics.BlockSourceBackfill), chunk.next, chunk.end)
+
+				mu.Lock()
+				chunk.next = next
+				if last != nil {
+					chunk.last = common.Hash(last.Root)
+				}
+				mu.Unlock()
+
+				if chunk.done() && ctx.Err() == nil {
+					a.log.Info("backfilled chunk", "end", chunk.end)
+					checkpoint()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, chunk := range chunks {
+		select {
+		case work <- chunk:
+		case <-backfillCtx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if backfillCtx.Err() != nil {
+		remaining := 0
+		for _, chunk := range chunks {
+			if !chunk.done() {
+				remaining++
+			}
+		}
+		a.log.Warn("backfill deadline reached, stopping backfill", "deadline", a.cfg.Backfill.Deadline, "remaining", remaining)
+		checkpoint()
+		return
+	}
+
+	a.log.Info("backfill complete", "from", from, "to", to, "chunks", len(chunks))
+	if a.cfg.Backfill.Verify {
+		if _, err := a.verifyBackfillSlots(ctx, from, to); err != nil {
+			a.log.Error("failed to verify backfill", "err", err, "from", from, "to", to)
+		}
+	}
+	checkpoint()
+}
+
+// readChunkCheckpoint returns the chunks left to backfill up to the given head slot. Every block of the checkpoint but
+// the last is the next slot of an incomplete chunk, and the last is the head the backfill that wrote it went up to,
+// after which the remaining slots are divided into new chunks. Without a checkpoint, the chunks start after the origin
+// block, which is persisted first. It returns false if the backfill can't start.
+func (a *Archiver) readChunkCheckpoint(ctx context.Context, headSlot uint64) ([]*backfillChunk, bool) {
+	checkpoint, err := a.dataStoreClient.ReadBackfillCheckpoint(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		a.log.Error("failed to read backfill checkpoint, skipping backfill until the next start", "err", err)
+		return nil, false
+	}
+
+	size := a.cfg.Backfill.ChunkSize
+	var chunks []*backfillChunk
+	var from uint64
+	if len(checkpoint) == 0 {
+		origin := a.persistOrigin(ctx)
+		if origin == nil {
+			return nil, false
+		}
+		from = uint64(origin.Header.Message.Slot) + 1
+	} else {
+		slices.SortFunc(checkpoint, func(x, y storage.Header) int {
+			return cmp.Compare(x.Slot, y.Slot)
+		})
+
+		top := checkpoint[len(checkpoint)-1]
+		for _, entry := range checkpoint[:len(checkpoint)-1] {
+			a.log.Info("resuming backfill chunk from checkpoint", "slot", entry.Slot)
+			chunks = append(chunks, &backfillChunk{
+				next: entry.Slot,
+				end:  min(chunkEnd(entry.Slot, size), top.Slot),
+				last: entry.BeaconBlockHash,
+			})
+		}
+		from = top.Slot + 1
+	}
+	chunks = append(chunks, splitChunks(from, headSlot, size)...)
+
+	// Slots below the retention boundary are skipped, as their blocks would be pruned
+	if boundary, pruning := a.retentionBoundary(headSlot); pruning {
+		chunks = slices.DeleteFunc(chunks, func(chunk *backfillChunk) bool {
+			return chunk.end <= boundary
+		})
+		for _, chunk := range chunks {
+			chunk.next = max(chunk.next, boundary)
+		}
+	}
+
+	return chunks, true
+}
+
+// writeChunkCheckpoint replaces the backfill checkpoint with the next slot of every incomplete chunk, and the head the
+// chunks end at, see readChunkCheckpoint. Chunks that haven't stored a block yet are written without a hash.
+func (a *Archiver) writeChunkCheckpoint(ctx context.Context, chunks []*backfillChunk, head *v1.BeaconBlockHeader) {
+	checkpoint := make([]storage.Header, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		if !chunk.done() {
+			checkpoint = append(checkpoint, storage.Header{
+				BeaconBlockHash: chunk.last,
+				Slot:            chunk.next,
+			})
+		}
+	}
+	checkpoint = append(checkpoint, storage.Header{
+		BeaconBlockHash: common.Hash(head.Root),
+		Slot:            uint64(head.Header.Message.Slot),
+	})
+
+	if err := a.dataStoreClient.WriteBackfillCheckpoint(ctx, checkpoint); err != nil {
+		a.log.Error("failed to write backfill checkpoint", "err", err)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// failingSlotBeaconClient fails every header request for a slot, as a beacon node that can't serve it would.
+type failingSlotBeaconClient struct {
+	*beacontest.StubBeaconClient
+	slot string
+}
+
+func (c *failingSlotBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	if opts.Block == c.slot {
+		return nil, errors.New("internal server error")
+	}
+	return c.StubBeaconClient.BeaconBlockHeader(ctx, opts)
+}
+
+func TestSplitChunks(t *testing.T) {
+	chunks := splitChunks(11, 25, 5)
+	require.Equal(t, []*backfillChunk{{next: 11, end: 15}, {next: 15, end: 20}, {next: 20, end: 25}}, chunks)
+
+	require.Empty(t, splitChunks(15, 15, 5))
+}
+
+func TestArchiver_BackfillChunked(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	// Slot 12 is missed
+	delete(stub.Headers, "12")
+
+	svc, fs := setupForwardBackfill(t, stub, blobtest.Five)
+	svc.cfg.Backfill.ChunkSize = 2
+	svc.cfg.Backfill.ChunkConcurrency = 2
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Three, blobtest.Four, blobtest.Five} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+	fs.CheckNotExistsOrFail(t, blobtest.Two)
+
+	// Every chunk is complete, so the next start resumes from the head
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{BeaconBlockHash: blobtest.Five, Slot: 15}}, checkpoint)
+}
+
+func TestArchiver_BackfillChunkedCheckpointsIncompleteChunks(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	client := &failingSlotBeaconClient{StubBeaconClient: stub, slot: "14"}
+
+	svc, fs := setupForwardBackfill(t, stub, blobtest.Five)
+	svc.beaconClient = client
+	svc.cfg.Backfill.ChunkSize = 2
+	svc.cfg.Backfill.ChunkConcurrency = 2
+	svc.cfg.Backfill.Deadline = 2 * time.Second
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+	fs.CheckNotExistsOrFail(t, blobtest.Four)
+
+	// The chunks of slots 11 and 12-13 completed, the chunk of slot 14 resumes from it
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{Slot: 14}, {BeaconBlockHash: blobtest.Five, Slot: 15}}, checkpoint)
+}
+
+func TestArchiver_BackfillChunkedResumesFromCheckpoint(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+
+	svc, fs := setupForwardBackfill(t, stub, blobtest.Five)
+	svc.cfg.Backfill.ChunkSize = 2
+	svc.cfg.Backfill.ChunkConcurrency = 2
+	// A previous backfill up to slot 13 left the chunk of slot 11 incomplete, and the live loop archived slot 15 since
+	require.NoError(t, fs.WriteBackfillCheckpoint(context.Background(), []storage.Header{
+		{Slot: 11},
+		{BeaconBlockHash: blobtest.Three, Slot: 13},
+	}))
+
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	// The incomplete chunk is resumed, and the slots between the previous and the current head are backfilled
+	for _, hash := range []common.Hash{blobtest.One, blobtest.Four} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+	// Completed chunks and the previous head are not walked again
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.Two, blobtest.Three} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{BeaconBlockHash: blobtest.Five, Slot: 15}}, checkpoint)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+)
+
+// runForwardBackfill backfills oldest-first, see flags.BackfillOrderOldestFirst. The canonical blocks are walked slot by
+// slot from the block the previous oldest-first backfill got to, recorded in the backfill checkpoint, or from the origin
+// block if there is no checkpoint, up to the given head, which is already stored. Blocks found stored along the way, e.g.
+// archived by the live loop of a previous run, are skipped. Once the walk reaches the head, or Backfill.Deadline has
+// passed, the block it got to is written to the checkpoint, so that the next start resumes from it. Completed backfills
+// are verified if Backfill.Verify is set, see verifyBackfill.
+func (a *Archiver) runForwardBackfill(ctx context.Context, head *v1.BeaconBlockHeader) {
+	resumed, unresolved, _ := a.readBackfillCheckpoint(ctx)
+	if len(unresolved) > 0 {
+		a.log.Error("failed to resolve the block to resume the oldest-first backfill from, skipping backfill until the next start")
+		return
+	}
+
+	backfillCtx := ctx
+	if a.cfg.Backfill.Deadline > 0 {
+		var cancel context.CancelFunc
+		backfillCtx, cancel = context.WithTimeout(ctx, a.cfg.Backfill.Deadline)
+		defer cancel()
+	}
+
+	// A checkpoint left by a newest-first backfill is resumed from its oldest block
+	var start *v1.BeaconBlockHeader
+	for _, header := range resumed {
+		if start == nil || header.Header.Message.Slot < start.Header.Message.Slot {
+			start = header
+		}
+	}
+
+	if start == nil {
+		start = a.persistOrigin(backfillCtx)
+		if start == nil {
+			return
+		}
+	}
+
+	stopped := a.backfillForward(backfillCtx, start, head)
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if backfillCtx.Err() != nil {
+		a.log.Warn("backfill deadline reached, stopping backfill", "deadline", a.cfg.Backfill.Deadline,
+			"startHash", start.Root.String(), "startSlot", start.Header.Message.Slot,
+			"endHash", stopped.Root.String(), "endSlot", stopped.Header.Message.Slot)
+	} else if a.cfg.Backfill.Verify {
+		if _, err := a.verifyBackfill(ctx, start, stopped); err != nil {
+			a.log.Error("failed to verify backfill", "err", err, "startHash", start.Root.String(), "endHash", stopped.Root.String())
+		}
+	}
+
+	a.writeBackfillCheckpoint(ctx, []*v1.BeaconBlockHeader{stopped}, nil)
+}
+
+// persistOrigin persists the blobs of the origin block, the first block of an oldest-first backfill, retrying until the
+// context is done. It returns nil if the origin block couldn't be persisted.
+func (a *Archiver) persistOrigin(ctx context.Context) *v1.BeaconBlockHeader {
+	ctx = withBlockSource(ctx, metrics.BlockSourceBackfill)
+	attemptCtx := withPersistAttempt(ctx)
+
+	for {
+		header, exists, err := a.persistBlobsForBlockToS3(attemptCtx, a.cfg.OriginBlock.String(), false)
+		if err == nil {
+			if !exists {
+				a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+			}
+			return header
+		}
+
+		if isNotFound(err) {
+			a.log.Error("origin block is not available from the beacon node, stopping backfill", "hash", a.cfg.OriginBlock.String())
+			return nil
+		}
+
+		a.log.Error("failed to persist blobs for origin block, will retry", "err", err, "hash", a.cfg.OriginBlock.String())
+		select {
+		case <-ctx.Done():
+			a.log.Info("backfill stopped", "err", ctx.Err())
+			return nil
+		case <-time.After(backfillErrorRetryInterval):
+		}
+	}
+}
+
+// backfillForward persists the canonical blocks of the slots after start, one slot at a time, until it reaches the slot
+// of head, which is already stored. Slots below the retention boundary are skipped, as their blocks would be pruned. See
+// backfillSlots. It returns the last block it stored or found stored, from which a stopped backfill can be resumed.
+func (a *Archiver) backfillForward(ctx context.Context, start, head *v1.BeaconBlockHeader) *v1.BeaconBlockHeader {
+	ctx = withBlockSource(ctx, metrics.BlockSourceBackfill)
+	current := start
+	slot := uint64(start.Header.Message.Slot) + 1
+	end := uint64(head.Header.Message.Slot)
+
+	if boundary, pruning := a.retentionBoundary(end); pruning && slot < boundary {
+		a.log.Info("skipping slots below the retention boundary", "from", slot, "boundary", boundary)
+		slot = boundary
+	}
+
+	defer func() {
+		a.log.Info("backfill complete", "startHash", start.Root.String(), "endHash", current.Root.String())
+	}()
+
+	next, last := a.backfillSlots(ctx, slot, end)
+	if last != nil {
+		current = last
+	}
+
+	if next < end {
+		a.log.Info("backfill stopped", "hash", current.Root.String(), "slot", current.Header.Message.Slot, "err", ctx.Err())
+		return current
+	}
+
+	current = head
+	return current
+}
+
+// backfillSlots persists the canonical blocks of the slots from from up to, but excluding, to, one slot at a time.
+// Slots the beacon node has no block for are missed slots, and are skipped. If an error is encountered persisting a
+// block, it will retry after waiting for a period of time. Backfilling stops once the context is done. It returns the
+// first slot that wasn't backfilled, to if every slot was, and the last block it stored or found stored, nil if none.
+func (a *Archiver) backfillSlots(ctx context.Context, from, to uint64) (uint64, *v1.BeaconBlockHeader) {
+	var last *v1.BeaconBlockHeader
+	slot := from
+
+	// A block that failed to persist is retried with what was fetched for it
+	attemptCtx := withPersistAttempt(ctx)
+	for slot < to {
+		if ctx.Err() != nil {
+			return slot, last
+		}
+
+		header, exists, err := a.persistBlobsForBlockToS3(attemptCtx, strconv.FormatUint(slot, 10), false)
+		if isNotFound(err) {
+			a.log.Debug("skipping missed slot", "slot", slot)
+			slot++
+			attemptCtx = withPersistAttempt(ctx)
+			continue
+		}
+
+		if err != nil {
+			a.log.Error("failed to persist blobs for block, will retry", "err", err, "slot", slot)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(backfillErrorRetryInterval):
+			}
+			continue
+		}
+
+		attemptCtx = withPersistAttempt(ctx)
+		last = header
+		slot++
+		if !exists {
+			a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+		}
+	}
+
+	return slot, last
+}
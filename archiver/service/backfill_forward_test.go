@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func setupForwardBackfill(t *testing.T, stub *beacontest.StubBeaconClient, stored ...common.Hash) (*Archiver, *storagetest.TestFileStorage) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	cfg := flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Order:    flags.BackfillOrderOldestFirst,
+			Strategy: flags.BackfillStrategyParentWalk,
+		},
+	}
+
+	for _, hash := range stored {
+		require.NoError(t, fs.Write(context.Background(), storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash},
+			BlobSidecars: storage.BlobSidecars{Data: stub.Blobs[hash.String()]},
+		}))
+	}
+
+	svc, err := NewArchiver(l, cfg, fs, stub, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+	return svc, fs
+}
+
+func TestArchiver_BackfillOldestFirst(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+	// Slot 12 is missed
+	delete(stub.Headers, "12")
+
+	svc, fs := setupForwardBackfill(t, stub, blobtest.Five, blobtest.Three)
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Three, blobtest.Four, blobtest.Five} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+	fs.CheckNotExistsOrFail(t, blobtest.Two)
+
+	// The next start resumes from the head the backfill got to
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{BeaconBlockHash: blobtest.Five, Slot: 15}}, checkpoint)
+}
+
+func TestArchiver_BackfillOldestFirstResumesFromCheckpoint(t *testing.T) {
+	stub := beacontest.NewDefaultStubBeaconClient(t)
+
+	svc, fs := setupForwardBackfill(t, stub, blobtest.Five)
+	require.NoError(t, fs.WriteBackfillCheckpoint(context.Background(), []storage.Header{{BeaconBlockHash: blobtest.Three, Slot: 13}}))
+
+	svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+
+	checkpoint, err := fs.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []storage.Header{{BeaconBlockHash: blobtest.Five, Slot: 15}}, checkpoint)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// errOriginUnreachable is returned when a backfill walked down to the slot of the origin block, or stored the maximum
+// number of blocks, without reaching the origin block, which is then most likely not on the canonical chain.
+var errOriginUnreachable = errors.New("origin block is not reachable")
+
+// originGuard stops a backfill that can't reach the origin block, rather than letting it walk to genesis. The origin
+// is known to be unreachable once the walk reaches its slot or a lower one without finding it, if its slot is known, or
+// once the walk stored the configured maximum of blocks.
+type originGuard struct {
+	origin    common.Hash
+	slot      uint64
+	slotKnown bool
+	maxBlocks uint64
+	walked    uint64
+}
+
+// newOriginGuard creates the guard of a backfill. Without an origin block, backfills walk to genesis by design, so
+// nothing is guarded. The slot of the origin block is taken from the configuration, or otherwise looked up from the
+// beacon node, which may not know the origin block if it's misconfigured, in which case only the maximum number of
+// blocks applies.
+func (a *Archiver) newOriginGuard(ctx context.Context) *originGuard {
+	if a.cfg.OriginBlock == (common.Hash{}) {
+		return &originGuard{}
+	}
+
+	guard := &originGuard{origin: a.cfg.OriginBlock, maxBlocks: a.cfg.Backfill.MaxBlocks}
+
+	if a.cfg.Backfill.OriginSlot > 0 {
+		guard.slot, guard.slotKnown = a.cfg.Backfill.OriginSlot, true
+		return guard
+	}
+
+	header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: a.cfg.OriginBlock.String(),
+	})
+	if err != nil {
+		a.log.Debug("slot of origin block is unknown", "err", err, "hash", a.cfg.OriginBlock)
+		return guard
+	}
+
+	guard.slot, guard.slotKnown = uint64(header.Data.Header.Message.Slot), true
+	return guard
+}
+
+// check returns errOriginUnreachable if the walk stored the given block without having reached the origin block, and
+// can't reach it anymore. It counts the block as walked.
+func (g *originGuard) check(current *v1.BeaconBlockHeader) error {
+	if common.Hash(current.Root) == g.origin {
+		return nil
+	}
+
+	g.walked++
+
+	if g.slotKnown && uint64(current.Header.Message.Slot) <= g.slot {
+		return errOriginUnreachable
+	}
+
+	if g.maxBlocks > 0 && g.walked >= g.maxBlocks {
+		return errOriginUnreachable
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver_BackfillStopsWhenOriginUnreachable(t *testing.T) {
+	// A block of a fork, which the canonical chain never reaches
+	unreachable := common.Hash{0xde, 0xad}
+
+	tests := []struct {
+		name     string
+		backfill flags.BackfillConfig
+		// known adds the unreachable origin block to the beacon node
+		known    bool
+		stored   []common.Hash
+		unstored []common.Hash
+	}{
+		{
+			name:     "origin slot from beacon node",
+			known:    true,
+			stored:   []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two},
+			unstored: []common.Hash{blobtest.One, blobtest.OriginBlock},
+		},
+		{
+			name:     "configured origin slot",
+			backfill: flags.BackfillConfig{OriginSlot: blobtest.StartSlot + 3},
+			stored:   []common.Hash{blobtest.Four, blobtest.Three},
+			unstored: []common.Hash{blobtest.Two, blobtest.One},
+		},
+		{
+			name:     "max blocks",
+			backfill: flags.BackfillConfig{MaxBlocks: 1},
+			stored:   []common.Hash{blobtest.Four},
+			unstored: []common.Hash{blobtest.Three, blobtest.Two},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			beacon := beacontest.NewDefaultStubBeaconClient(t)
+			if test.known {
+				beacon.Headers[unreachable.String()] = &v1.BeaconBlockHeader{
+					Root: phase0.Root(unreachable),
+					Header: &phase0.SignedBeaconBlockHeader{
+						Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(blobtest.StartSlot + 2)},
+					},
+				}
+			}
+
+			l := testlog.Logger(t, log.LvlInfo)
+			fs := storagetest.NewTestFileStorage(t, l)
+			m := metrics.NewMetrics()
+			svc, err := NewArchiver(l, flags.ArchiverConfig{
+				PollInterval: 5 * time.Second,
+				OriginBlock:  unreachable,
+				Backfill:     test.backfill,
+			}, fs, beacon, m, nil)
+			require.NoError(t, err)
+
+			stopped := svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+			require.Equal(t, phase0.Root(test.stored[len(test.stored)-1]), stopped.Root)
+			for _, hash := range test.stored {
+				fs.CheckExistsOrFail(t, hash)
+			}
+			for _, hash := range test.unstored {
+				fs.CheckNotExistsOrFail(t, hash)
+			}
+			require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_backfill_origin_unreachable"))
+		})
+	}
+}
+
+func TestArchiver_BackfillGuardAllowsReachableOrigin(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill:     flags.BackfillConfig{MaxBlocks: 5},
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+
+	// The origin block is the fifth block stored, which doesn't count towards the maximum
+	stopped := svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	require.Equal(t, phase0.Root(blobtest.OriginBlock), stopped.Root)
+	fs.CheckExistsOrFail(t, blobtest.OriginBlock)
+	require.Zero(t, metricValue(t, m, "blob_archiver_backfill_origin_unreachable"))
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// backfillBlobsByRange backfills blobs from the provided header by fetching ranges of slots below it, newest first.
+// Each block must be the parent of the previously processed block, so only ancestors of the latest header are stored.
+// It returns the last block that was processed and whether the backfill is done, i.e. it reached the origin block or a
+// block that was already stored. If a range can't be fetched, or doesn't link up with the chain walked so far, it
+// returns early so that the caller can continue from the returned block by walking parent roots. Every slot of a range
+// takes a place in the write queue until the range is processed, and the blob sidecars of the range count towards its
+// buffered bytes.
+func (a *Archiver) backfillBlobsByRange(ctx context.Context, rangeClient beacon.BlobSidecarsRangeProvider, latest *v1.BeaconBlockHeader) (*v1.BeaconBlockHeader, bool) {
+	current := latest
+
+	if common.Hash(current.Root) == a.cfg.OriginBlock {
+		a.log.Info("reached origin block", "hash", current.Root.String())
+		return current, true
+	}
+
+	boundary, pruning := a.retentionBoundary(uint64(latest.Header.Message.Slot))
+
+	queued, queuedBytes := 0, 0
+	defer func() {
+		a.writeQueue.release(queued)
+		a.writeQueue.releaseBytes(queuedBytes)
+	}()
+
+	for end := uint64(current.Header.Message.Slot); end > 0; {
+		if pruning && end <= boundary {
+			a.log.Info("reached retention boundary", "hash", current.Root.String(), "boundary", boundary)
+			return current, true
+		}
+
+		start := end - min(a.cfg.Backfill.RangeSize, end)
+
+		if err := a.writeQueue.acquire(ctx, int(end-start)); err != nil {
+			return current, false
+		}
+		queued = int(end - start)
+
+		blocks, err := rangeClient.BlobSidecarsRange(ctx, phase0.Slot(start), end-start)
+		if err != nil {
+			a.log.Warn("failed to fetch slot range", "err", err, "start", start, "end", end)
+			return current, false
+		}
+
+		for _, block := range blocks {
+			queuedBytes += (&storage.BlobSidecars{Data: block.Sidecars}).SizeSSZ()
+		}
+		a.writeQueue.addBytes(queuedBytes)
+
+		sort.Slice(blocks, func(i, j int) bool {
+			return blocks[i].Header.Header.Message.Slot > blocks[j].Header.Header.Message.Slot
+		})
+
+		for _, block := range blocks {
+			if block.Header.Header.Message.Slot >= current.Header.Message.Slot {
+				continue
+			}
+
+			if pruning && uint64(block.Header.Header.Message.Slot) < boundary {
+				a.log.Info("reached retention boundary", "hash", current.Root.String(), "boundary", boundary)
+				return current, true
+			}
+
+			if block.Header.Root != current.Header.Message.ParentRoot {
+				a.log.Warn("slot range does not link to parent", "hash", block.Header.Root, "parent", current.Header.Message.ParentRoot)
+				return current, false
+			}
+
+			if err := beacon.CheckSidecarHeaders(block.Sidecars, block.Header); err != nil {
+				a.log.Warn("slot range returned sidecars of another block", "err", err, "hash", block.Header.Root)
+				return current, false
+			}
+
+			skip, exists, err := a.skipBlock(ctx, block.Header, false)
+			if err != nil {
+				return current, false
+			}
+
+			if !skip {
+				// The sidecars of the range were fetched together, so only the write is timed
+				writeStarted := time.Now()
+				stored, err := a.writeBlobSidecars(ctx, block.Header, block.Sidecars, block.Optimistic, false)
+				if err != nil {
+					return current, false
+				}
+				if !stored {
+					a.metrics.RecordBlockPersistStageDuration(ctx, metrics.BlockSourceBackfill, metrics.PersistStageWrite, time.Since(writeStarted))
+				}
+				exists = exists || stored
+			}
+
+			current = block.Header
+
+			if exists {
+				return current, true
+			}
+
+			a.metrics.RecordProcessedBlock(metrics.BlockSourceBackfill)
+
+			if common.Hash(current.Root) == a.cfg.OriginBlock {
+				a.log.Info("reached origin block", "hash", current.Root.String())
+				return current, true
+			}
+		}
+
+		a.writeQueue.release(queued)
+		a.writeQueue.releaseBytes(queuedBytes)
+		queued, queuedBytes = 0, 0
+		end = start
+	}
+
+	return current, true
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// backfillVerifyConcurrency is the number of slots whose canonical block is looked up at once when verifying a backfill.
+const backfillVerifyConcurrency = 8
+
+// verifyBackfill compares the number of blocks in the slot index between the blocks a backfill stopped and started at
+// with the number of canonical blocks the beacon node has in that range, which are equal if the backfill archived every
+// block. The difference is logged, with the canonical blocks missing from storage, and recorded by the
+// backfill_discrepancy metric. It returns the number of canonical blocks minus the number of stored blocks.
+func (a *Archiver) verifyBackfill(ctx context.Context, stopped, start *v1.BeaconBlockHeader) (int, error) {
+	return a.verifyBackfillSlots(ctx, uint64(stopped.Header.Message.Slot), uint64(start.Header.Message.Slot))
+}
+
+// verifyBackfillSlots verifies the backfill of the slots from from to to, see verifyBackfill.
+func (a *Archiver) verifyBackfillSlots(ctx context.Context, from, to uint64) (int, error) {
+	stored := 0
+	err := a.dataStoreClient.ListSlotIndex(ctx, from, to, func(slot uint64, hash common.Hash) error {
+		stored++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored blocks: %w", err)
+	}
+
+	report, err := CheckCompleteness(ctx, a.log, a.beaconClient, a.dataStoreClient, from, to, backfillVerifyConcurrency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count canonical blocks: %w", err)
+	}
+
+	discrepancy := report.Canonical - stored
+	a.metrics.SetBackfillDiscrepancy(discrepancy)
+
+	if discrepancy != 0 || len(report.Missing) > 0 {
+		for _, missing := range report.Missing {
+			a.log.Warn("canonical block missing after backfill", "slot", missing.Slot, "hash", missing.Root)
+		}
+		a.log.Error("backfill is incomplete", "from", from, "to", to, "canonical", report.Canonical, "stored", stored,
+			"missing", len(report.Missing), "missedSlots", len(report.MissedSlots))
+		return discrepancy, nil
+	}
+
+	a.log.Info("verified backfill", "from", from, "to", to, "canonical", report.Canonical, "stored", stored,
+		"missedSlots", len(report.MissedSlots))
+	return discrepancy, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver_VerifiesBackfill(t *testing.T) {
+	tests := []struct {
+		name        string
+		denylist    string
+		discrepancy int
+	}{
+		{
+			name: "complete",
+		},
+		{
+			// The block at slot 12 is walked through, but not stored
+			name:        "missing block",
+			denylist:    "12",
+			discrepancy: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := beacontest.NewDefaultStubBeaconClient(t)
+			l := testlog.Logger(t, log.LvlInfo)
+			fs := storagetest.NewTestFileStorage(t, l)
+			m := metrics.NewMetrics()
+
+			svc, err := NewArchiver(l, flags.ArchiverConfig{
+				PollInterval: 5 * time.Second,
+				OriginBlock:  blobtest.OriginBlock,
+				SlotIndex:    true,
+				SlotFilter:   flags.SlotFilterConfig{Denylist: test.denylist},
+				Backfill: flags.BackfillConfig{
+					Strategy: flags.BackfillStrategyParentWalk,
+					Verify:   true,
+				},
+			}, fs, stub, m, nil)
+			require.NoError(t, err)
+
+			require.NoError(t, storage.WriteWithSlotIndex(context.Background(), fs, storage.BlobData{
+				Header:       storage.Header{BeaconBlockHash: blobtest.Five, Slot: blobtest.StartSlot + 5},
+				BlobSidecars: storage.BlobSidecars{Data: stub.Blobs[blobtest.Five.String()]},
+			}))
+
+			svc.runBackfills(context.Background(), []*v1.BeaconBlockHeader{stub.Headers[blobtest.Five.String()]})
+
+			require.Equal(t, float64(test.discrepancy), metricValue(t, m, "blob_archiver_backfill_discrepancy"))
+
+			discrepancy, err := svc.verifyBackfill(context.Background(), stub.Headers[blobtest.OriginBlock.String()], stub.Headers[blobtest.Five.String()])
+			require.NoError(t, err)
+			require.Equal(t, test.discrepancy, discrepancy)
+		})
+	}
+}
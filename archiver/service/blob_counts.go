@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// blobCountsProgressInterval is how often the progress of a blob count export is logged.
+const blobCountsProgressInterval = 10 * time.Second
+
+// ExportBlobCounts writes the blob count of every archived block in the inclusive slot range as CSV, with a header row
+// of slot,root,blob_count. Blocks are enumerated in ascending slot order through the slot index, so blocks archived
+// without an index entry are not exported. Each row is written once its block is read, so memory use doesn't grow with
+// the range. Index entries whose block is missing, or stored for a different slot, e.g. as the slot was reorged, are
+// skipped. It returns the number of rows written.
+func ExportBlobCounts(ctx context.Context, l log.Logger, store storage.DataStoreReader, from, to uint64, w io.Writer) (int, error) {
+	if to < from {
+		return 0, fmt.Errorf("invalid range: from %d to %d", from, to)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"slot", "root", "blob_count"}); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	lastLog := time.Now()
+	err := store.ListSlotIndex(ctx, from, to, func(slot uint64, hash common.Hash) error {
+		data, err := store.Read(ctx, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			l.Warn("skipping slot index entry of missing block", "slot", slot, "hash", hash)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read block %s at slot %d: %w", hash, slot, err)
+		}
+
+		if data.Header.Slot != 0 && data.Header.Slot != slot {
+			l.Warn("skipping slot index entry of block stored for another slot", "slot", slot, "hash", hash, "storedSlot", data.Header.Slot)
+			return nil
+		}
+
+		if err := cw.Write([]string{strconv.FormatUint(slot, 10), hash.String(), strconv.Itoa(len(data.BlobSidecars.Data))}); err != nil {
+			return err
+		}
+		rows++
+
+		if time.Since(lastLog) >= blobCountsProgressInterval {
+			cw.Flush()
+			l.Info("exporting blob counts", "slot", slot, "rows", rows)
+			lastLog = time.Now()
+		}
+
+		return cw.Error()
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	cw.Flush()
+	return rows, cw.Error()
+}
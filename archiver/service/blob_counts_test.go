@@ -0,0 +1,60 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportBlobCounts(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	for _, block := range []struct {
+		hash  common.Hash
+		slot  uint64
+		blobs uint
+	}{
+		{blobtest.OriginBlock, 10, 1},
+		{blobtest.One, 11, 2},
+		{blobtest.Two, 12, 0},
+		{blobtest.Three, 13, 4},
+		{blobtest.Five, 15, 6},
+	} {
+		require.NoError(t, storage.WriteWithSlotIndex(context.Background(), fs, storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: block.hash, Slot: block.slot},
+			BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, block.blobs)},
+		}))
+	}
+
+	// A stale index entry of a block that is no longer stored, and one of a block stored for another slot
+	require.NoError(t, fs.WriteSlotIndex(context.Background(), 14, blobtest.Four))
+	require.NoError(t, fs.WriteSlotIndex(context.Background(), 16, blobtest.Three))
+
+	var out bytes.Buffer
+	rows, err := ExportBlobCounts(context.Background(), l, fs, 11, 16, &out)
+	require.NoError(t, err)
+	require.Equal(t, 4, rows)
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"slot", "root", "blob_count"},
+		{"11", blobtest.One.String(), "2"},
+		{"12", blobtest.Two.String(), "0"},
+		{"13", blobtest.Three.String(), "4"},
+		{"15", blobtest.Five.String(), "6"},
+	}, records)
+
+	_, err = ExportBlobCounts(context.Background(), l, fs, 16, 11, &out)
+	require.Error(t, err)
+}
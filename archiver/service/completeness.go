@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// completenessProgressInterval is how often the progress of a completeness check is logged.
+const completenessProgressInterval = 10 * time.Second
+
+// MissingBlock is a canonical block whose blobs are not in the archive.
+type MissingBlock struct {
+	Slot uint64      `json:"slot"`
+	Root common.Hash `json:"root"`
+}
+
+// CompletenessReport summarizes which canonical blocks in an inclusive slot range are present in the archive. Missed
+// slots, which have no canonical block, are listed separately and are not gaps in the archive.
+type CompletenessReport struct {
+	From         uint64         `json:"from"`
+	To           uint64         `json:"to"`
+	Canonical    int            `json:"canonical"`
+	Present      int            `json:"present"`
+	Completeness float64        `json:"completeness"`
+	Missing      []MissingBlock `json:"missing"`
+	MissedSlots  []uint64       `json:"missed_slots"`
+}
+
+// CheckCompleteness resolves the canonical block of every slot in the inclusive range with the beacon client, and
+// checks whether it is in the archive, with up to concurrency slots checked at once. A slot the beacon node has no
+// block for is a missed slot if it is at or below the beacon node's head; slots after the head haven't happened yet, so
+// the range is cut off at the head.
+func CheckCompleteness(ctx context.Context, l log.Logger, beaconClient client.BeaconBlockHeadersProvider, store storage.DataStoreReader, from, to uint64, concurrency int) (CompletenessReport, error) {
+	report := CompletenessReport{From: from, To: to, Missing: []MissingBlock{}, MissedSlots: []uint64{}}
+	if to < from {
+		return report, fmt.Errorf("invalid range: from %d to %d", from, to)
+	}
+
+	head, err := beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: "head",
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch head: %w", err)
+	}
+
+	if headSlot := uint64(head.Data.Header.Message.Slot); to > headSlot {
+		if from > headSlot {
+			return report, fmt.Errorf("invalid range: from %d is after the head at slot %d", from, headSlot)
+		}
+
+		l.Warn("range ends after the head, checking up to the head", "to", to, "head", headSlot)
+		to = headSlot
+		report.To = to
+	}
+
+	var (
+		mu        sync.Mutex
+		checked   atomic.Uint64
+		total     = to - from + 1
+		lastLog   = time.Now()
+		logMu     sync.Mutex
+		canonical int
+	)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(concurrency, 1))
+
+	for slot := from; slot <= to; slot++ {
+		slot := slot
+		g.Go(func() error {
+			present, missing, err := checkSlotArchived(gctx, beaconClient, store, slot)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			if present || missing != nil {
+				canonical++
+			} else {
+				report.MissedSlots = append(report.MissedSlots, slot)
+			}
+			if present {
+				report.Present++
+			}
+			if missing != nil {
+				report.Missing = append(report.Missing, *missing)
+			}
+			mu.Unlock()
+
+			done := checked.Add(1)
+			logMu.Lock()
+			if time.Since(lastLog) >= completenessProgressInterval || done == total {
+				l.Info("checking completeness", "checked", done, "total", total)
+				lastLog = time.Now()
+			}
+			logMu.Unlock()
+
+			return nil
+		})
+
+		if gctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		return report, err
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool {
+		return report.Missing[i].Slot < report.Missing[j].Slot
+	})
+	slices.Sort(report.MissedSlots)
+
+	report.Canonical = canonical
+	report.Completeness = 100
+	if canonical > 0 {
+		report.Completeness = float64(report.Present) * 100 / float64(canonical)
+	}
+
+	return report, nil
+}
+
+// checkSlotArchived returns whether the canonical block at the slot is archived, or the missing block if it isn't. Both
+// are empty if there is no canonical block at the slot.
+func checkSlotArchived(ctx context.Context, beaconClient client.BeaconBlockHeadersProvider, store storage.DataStoreReader, slot uint64) (bool, *MissingBlock, error) {
+	header, err := beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: strconv.FormatUint(slot, 10),
+	})
+	if err != nil {
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			// Missed slot
+			return false, nil, nil
+		}
+
+		return false, nil, fmt.Errorf("failed to fetch header for slot %d: %w", slot, err)
+	}
+
+	root := common.Hash(header.Data.Root)
+	exists, err := store.Exists(ctx, root)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to check blob for slot %d: %w", slot, err)
+	}
+
+	if exists {
+		return true, nil, nil
+	}
+
+	return false, &MissingBlock{Slot: slot, Root: root}, nil
+}
+
+// WriteJSON writes the report as a single JSON object.
+func (r CompletenessReport) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// WriteCSV writes the missing blocks as CSV, with a header row of slot,root.
+func (r CompletenessReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"slot", "root"}); err != nil {
+		return err
+	}
+
+	for _, missing := range r.Missing {
+		if err := cw.Write([]string{strconv.FormatUint(missing.Slot, 10), missing.Root.String()}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes a human-readable summary, followed by one missing block per line.
+func (r CompletenessReport) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "slots %d-%d: %d/%d canonical blocks archived (%.2f%%), %d missed slots\n", r.From, r.To, r.Present, r.Canonical, r.Completeness, len(r.MissedSlots))
+	if err != nil {
+		return err
+	}
+
+	for _, missing := range r.Missing {
+		if _, err := fmt.Fprintf(w, "missing %d %s\n", missing.Slot, missing.Root); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
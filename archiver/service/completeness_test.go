@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCompleteness(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+
+	for _, hash := range []common.Hash{blobtest.One, blobtest.Three, blobtest.Five} {
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: hash}})
+	}
+
+	// Slot 16 is after the head, so the range is cut off at slot 15
+	report, err := CheckCompleteness(context.Background(), l, beacon, fs, blobtest.StartSlot, blobtest.EndSlot+1, 3)
+	require.NoError(t, err)
+
+	require.Equal(t, blobtest.EndSlot, report.To)
+	require.Empty(t, report.MissedSlots)
+	require.Equal(t, 6, report.Canonical)
+	require.Equal(t, 3, report.Present)
+	require.Equal(t, float64(50), report.Completeness)
+	require.Equal(t, []MissingBlock{
+		{Slot: blobtest.StartSlot, Root: blobtest.OriginBlock},
+		{Slot: blobtest.StartSlot + 2, Root: blobtest.Two},
+		{Slot: blobtest.StartSlot + 4, Root: blobtest.Four},
+	}, report.Missing)
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteJSON(&out))
+	var decoded CompletenessReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Equal(t, report, decoded)
+
+	out.Reset()
+	require.NoError(t, report.WriteCSV(&out))
+	require.Equal(t, "slot,root\n"+
+		"10,"+blobtest.OriginBlock.String()+"\n"+
+		"12,"+blobtest.Two.String()+"\n"+
+		"14,"+blobtest.Four.String()+"\n", out.String())
+}
+
+func TestCheckCompletenessSkipsMissedSlots(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	beacon := beacontest.NewEmptyStubBeaconClient()
+
+	header := func(slot uint64, root, parent common.Hash) *v1.BeaconBlockHeader {
+		return &v1.BeaconBlockHeader{
+			Root: phase0.Root(root),
+			Header: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: phase0.Slot(slot), ParentRoot: phase0.Root(parent)},
+			},
+		}
+	}
+
+	// Slot 12 was missed, the block at slot 13 builds on the one at slot 11
+	beacon.Headers["10"] = header(10, blobtest.OriginBlock, common.Hash{})
+	beacon.Headers["11"] = header(11, blobtest.One, blobtest.OriginBlock)
+	beacon.Headers["13"] = header(13, blobtest.Three, blobtest.One)
+	beacon.Headers["14"] = header(14, blobtest.Four, blobtest.Three)
+	beacon.Headers["head"] = beacon.Headers["14"]
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Three} {
+		fs.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: hash}})
+	}
+
+	report, err := CheckCompleteness(context.Background(), l, beacon, fs, 10, 14, 2)
+	require.NoError(t, err)
+
+	// The missed slot is not a gap in the archive, the block at slot 14 is
+	require.Equal(t, 4, report.Canonical)
+	require.Equal(t, 3, report.Present)
+	require.Equal(t, []uint64{12}, report.MissedSlots)
+	require.Equal(t, []MissingBlock{{Slot: 14, Root: blobtest.Four}}, report.Missing)
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteText(&out))
+	require.Contains(t, out.String(), "3/4 canonical blocks archived (75.00%), 1 missed slots")
+}
+
+func TestCheckCompletenessRejectsRangeAfterHead(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+
+	_, err := CheckCompleteness(context.Background(), l, beacon, storagetest.NewTestFileStorage(t, l), blobtest.EndSlot+1, blobtest.EndSlot+5, 2)
+	require.ErrorContains(t, err, "after the head")
+}
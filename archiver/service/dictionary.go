@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// dictionarySamples holds the hashes of the most recently written blocks, which dictionaries are trained from. The blob
+// data is read back from the data store when training, so that only the hashes are kept in memory.
+type dictionarySamples struct {
+	mu     sync.Mutex
+	hashes []common.Hash
+	next   int
+	full   bool
+}
+
+func newDictionarySamples(size int) *dictionarySamples {
+	return &dictionarySamples{hashes: make([]common.Hash, size)}
+}
+
+// add records a written block, replacing the oldest one once there are as many as the sample size.
+func (s *dictionarySamples) add(hash common.Hash) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[s.next] = hash
+	s.next = (s.next + 1) % len(s.hashes)
+	s.full = s.full || s.next == 0
+}
+
+func (s *dictionarySamples) list() []common.Hash {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full {
+		return append([]common.Hash{}, s.hashes...)
+	}
+	return append([]common.Hash{}, s.hashes[:s.next]...)
+}
+
+func (a *Archiver) dictionaryLoop(ctx context.Context) {
+	t := time.NewTicker(a.cfg.Dictionary.TrainInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.stopCh:
+			return
+		case <-t.C:
+			if _, err := a.trainDictionary(ctx); err != nil {
+				a.log.Error("failed to train compression dictionary", "err", err)
+			}
+		}
+	}
+}
+
+// trainDictionary trains a dictionary from the blob data of the most recently written blocks and stores it as the next
+// version, which the data store compresses subsequent writes with. Objects written before keep the version of the
+// dictionary they were compressed with, so they remain readable. It returns the version of the new dictionary.
+func (a *Archiver) trainDictionary(ctx context.Context) (uint32, error) {
+	hashes := a.dictionarySamples.list()
+	if len(hashes) == 0 {
+		return 0, errors.New("no blocks written to train the dictionary with")
+	}
+
+	samples := make([][]byte, 0, len(hashes))
+	for _, hash := range hashes {
+		data, err := a.dataStoreClient.Read(ctx, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			// The block may have been pruned since
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read sample %s: %w", hash, err)
+		}
+
+		sample, err := storage.EncodeBlobDataFormat(data, a.cfg.StorageConfig.Format)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode sample %s: %w", hash, err)
+		}
+		samples = append(samples, sample)
+	}
+
+	latest, err := a.dictionaries.LatestDictionaryVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up the latest dictionary: %w", err)
+	}
+
+	version := latest + 1
+	dict, err := storage.TrainDictionary(version, samples)
+	if err != nil {
+		return 0, fmt.Errorf("failed to train dictionary %d: %w", version, err)
+	}
+
+	if err := a.dictionaries.WriteDictionary(ctx, version, dict); err != nil {
+		return 0, fmt.Errorf("failed to write dictionary %d: %w", version, err)
+	}
+
+	a.metrics.SetDictionaryVersion(version)
+	a.log.Info("trained compression dictionary", "version", version, "samples", len(samples), "size", len(dict))
+	return version, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictionarySamples(t *testing.T) {
+	samples := newDictionarySamples(3)
+	require.Empty(t, samples.list())
+
+	samples.add(common.Hash{1})
+	samples.add(common.Hash{2})
+	require.Equal(t, []common.Hash{{1}, {2}}, samples.list())
+
+	// The oldest blocks are replaced once the sample size is reached
+	samples.add(common.Hash{3})
+	samples.add(common.Hash{4})
+	require.ElementsMatch(t, []common.Hash{{2}, {3}, {4}}, samples.list())
+
+	// Recording blocks is a no-op while training is disabled
+	var disabled *dictionarySamples
+	disabled.add(common.Hash{1})
+}
+
+func TestArchiver_TrainDictionaryWithoutSamples(t *testing.T) {
+	svc, fs := setup(t, beacontest.NewDefaultStubBeaconClient(t))
+	svc.dictionarySamples = newDictionarySamples(10)
+
+	_, err := svc.trainDictionary(context.Background())
+	require.Error(t, err)
+
+	latest, err := fs.LatestDictionaryVersion(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), latest)
+}
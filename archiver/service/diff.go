@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// diffProgressInterval is how often the progress of a diff is logged.
+const diffProgressInterval = 10 * time.Second
+
+// DiffCategory is the kind of difference found for a blob when comparing two data stores.
+type DiffCategory string
+
+const (
+	DiffOnlyInA           DiffCategory = "only-in-a"
+	DiffOnlyInB           DiffCategory = "only-in-b"
+	DiffContentDiffers    DiffCategory = "content-differs"
+	DiffContentUnreadable DiffCategory = "content-unreadable"
+)
+
+// DiffReport counts the blobs of two data stores by category.
+type DiffReport struct {
+	InBoth   int `json:"in_both"`
+	OnlyInA  int `json:"only_in_a"`
+	OnlyInB  int `json:"only_in_b"`
+	Compared int `json:"compared"`
+	// Different counts the compared blobs whose content differs, or couldn't be read from either data store.
+	Different int `json:"different"`
+}
+
+// DiffDataStores compares the blobs stored in a and b. Each data store is listed once and the other is checked for
+// every listed blob, so memory use doesn't grow with the number of blobs. The content of blobs present in both is
+// compared for a sample of the blobs: sampleRate is the share of blobs compared, from 0 to 1. Sampling is deterministic
+// on the beacon block hash, so repeated runs compare the same blobs. Every difference is reported to fn as it is found,
+// from one goroutine at a time.
+func DiffDataStores(ctx context.Context, l log.Logger, a, b storage.DataStoreReader, sampleRate float64, concurrency int, fn func(category DiffCategory, hash common.Hash)) (DiffReport, error) {
+	var (
+		report  DiffReport
+		mu      sync.Mutex
+		listed  int
+		lastLog = time.Now()
+	)
+
+	record := func(update func(r *DiffReport), category DiffCategory, hash common.Hash) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		update(&report)
+		if category != "" {
+			fn(category, hash)
+		}
+
+		listed++
+		if time.Since(lastLog) >= diffProgressInterval {
+			l.Info("comparing data stores", "listed", listed)
+			lastLog = time.Now()
+		}
+	}
+
+	// Blobs in a are either missing from b, or compared with b
+	err := diffListing(ctx, a, concurrency, func(ctx context.Context, hash common.Hash) error {
+		exists, err := b.Exists(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to check %s in b: %w", hash, err)
+		}
+
+		if !exists {
+			record(func(r *DiffReport) { r.OnlyInA++ }, DiffOnlyInA, hash)
+			return nil
+		}
+
+		if !sampled(hash, sampleRate) {
+			record(func(r *DiffReport) { r.InBoth++ }, "", hash)
+			return nil
+		}
+
+		category := compareBlobs(ctx, l, a, b, hash)
+		record(func(r *DiffReport) {
+			r.InBoth++
+			r.Compared++
+			if category != "" {
+				r.Different++
+			}
+		}, category, hash)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// Blobs in b only need to be checked for existence in a, the others were covered above
+	err = diffListing(ctx, b, concurrency, func(ctx context.Context, hash common.Hash) error {
+		exists, err := a.Exists(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to check %s in a: %w", hash, err)
+		}
+
+		if !exists {
+			record(func(r *DiffReport) { r.OnlyInB++ }, DiffOnlyInB, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	l.Info("compared data stores", "listed", listed)
+	return report, nil
+}
+
+// diffListing calls check for every blob listed in the data store, with up to concurrency checks at once. The listing
+// waits for a free slot, so at most concurrency blobs are held at a time.
+func diffListing(ctx context.Context, store storage.DataStoreReader, concurrency int, check func(ctx context.Context, hash common.Hash) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(concurrency, 1))
+
+	err := store.List(gctx, func(hash common.Hash) error {
+		if err := gctx.Err(); err != nil {
+			return err
+		}
+
+		g.Go(func() error {
+			return check(gctx, hash)
+		})
+		return nil
+	})
+
+	if waitErr := g.Wait(); waitErr != nil {
+		return waitErr
+	}
+
+	return err
+}
+
+// compareBlobs compares the encoded blob data stored for the hash in both data stores. It returns the category of the
+// difference, or an empty category if the content is identical.
+func compareBlobs(ctx context.Context, l log.Logger, a, b storage.DataStoreReader, hash common.Hash) DiffCategory {
+	encoded := make([][]byte, 2)
+	for i, store := range []storage.DataStoreReader{a, b} {
+		data, err := store.Read(ctx, hash)
+		if err == nil {
+			encoded[i], err = storage.EncodeBlobData(data)
+		}
+
+		if err != nil {
+			l.Warn("failed to read blob for comparison", "err", err, "hash", hash)
+			return DiffContentUnreadable
+		}
+	}
+
+	if !bytes.Equal(encoded[0], encoded[1]) {
+		return DiffContentDiffers
+	}
+
+	return ""
+}
+
+// sampled returns true if the hash is part of a sample of the given rate. The first 8 bytes of a beacon block hash are
+// uniformly distributed, so they are used to pick the sample.
+func sampled(hash common.Hash, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	return float64(binary.BigEndian.Uint64(hash[:8])) < rate*math.MaxUint64
+}
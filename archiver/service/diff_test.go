@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffDataStores(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	a := storagetest.NewTestFileStorage(t, l)
+	b := storagetest.NewTestFileStorage(t, l)
+
+	identical := storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.One, Slot: 11},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	a.WriteOrFail(t, identical)
+	b.WriteOrFail(t, identical)
+
+	a.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Two, Slot: 12},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	})
+	b.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Two, Slot: 12},
+		BlobSidecars: storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	})
+
+	a.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Three}})
+	b.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Four}})
+	b.WriteOrFail(t, storage.BlobData{Header: storage.Header{BeaconBlockHash: blobtest.Five}})
+
+	// Slot index entries are not blobs, and must not be reported
+	require.NoError(t, a.WriteSlotIndex(context.Background(), 11, blobtest.One))
+
+	t.Run("full comparison", func(t *testing.T) {
+		differences := map[common.Hash]DiffCategory{}
+		report, err := DiffDataStores(context.Background(), l, a, b, 1, 2, func(category DiffCategory, hash common.Hash) {
+			differences[hash] = category
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, DiffReport{InBoth: 2, OnlyInA: 1, OnlyInB: 2, Compared: 2, Different: 1}, report)
+		require.Equal(t, map[common.Hash]DiffCategory{
+			blobtest.Two:   DiffContentDiffers,
+			blobtest.Three: DiffOnlyInA,
+			blobtest.Four:  DiffOnlyInB,
+			blobtest.Five:  DiffOnlyInB,
+		}, differences)
+	})
+
+	t.Run("existence only", func(t *testing.T) {
+		report, err := DiffDataStores(context.Background(), l, a, b, 0, 2, func(DiffCategory, common.Hash) {})
+		require.NoError(t, err)
+
+		require.Equal(t, DiffReport{InBoth: 2, OnlyInA: 1, OnlyInB: 2}, report)
+	})
+}
+
+func TestSampled(t *testing.T) {
+	low := common.Hash{0x10}
+	high := common.Hash{0xf0}
+
+	require.True(t, sampled(low, 0.5))
+	require.False(t, sampled(high, 0.5))
+	require.False(t, sampled(low, 0))
+	require.True(t, sampled(high, 1))
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/beacon"
+)
+
+// freshnessSLA detects sustained breaches of the freshness SLA, see flags.FreshnessSLAConfig.
+type freshnessSLA struct {
+	maxLag uint64
+	period time.Duration
+	// breached is whether the SLA is currently breached.
+	breached bool
+	// changing is when the lag was first observed on the other side of maxLag than breached is, zero if the last lag
+	// observed wasn't.
+	changing time.Time
+}
+
+// observe records the lag observed at the given time, and returns whether that breached or restored the SLA. The SLA
+// only changes once the lag has been on the other side of maxLag for the whole period, so that a lag around maxLag
+// doesn't flap.
+func (f *freshnessSLA) observe(lag uint64, now time.Time) bool {
+	if (lag > f.maxLag) == f.breached {
+		f.changing = time.Time{}
+		return false
+	}
+
+	if f.changing.IsZero() {
+		f.changing = now
+	}
+
+	if now.Sub(f.changing) < f.period {
+		return false
+	}
+
+	f.breached = !f.breached
+	f.changing = time.Time{}
+	return true
+}
+
+// syncStatus is whether the archiver is caught up to the head, as of the last check of the lag, see checkLag.
+type syncStatus struct {
+	// CaughtUp is true if the lag is within flags.ArchiverConfig.CaughtUpLag, false while catching up, e.g. after
+	// downtime, or before the lag was first checked.
+	CaughtUp bool `json:"caughtUp"`
+	// Lag is the number of slots ArchivedSlot is behind CurrentSlot.
+	Lag          uint64 `json:"lag"`
+	ArchivedSlot uint64 `json:"archivedSlot"`
+	CurrentSlot  uint64 `json:"currentSlot"`
+}
+
+// checkLag measures how many slots the newest block the live loop archived is behind the current slot, which updates
+// the sync status and is checked against the freshness SLA.
+func (a *Archiver) checkLag(ctx context.Context) {
+	clock, err := a.getSlotClock(ctx)
+	if err != nil {
+		a.log.Warn("failed to fetch the slot clock, skipping the lag check", "err", err)
+		return
+	}
+
+	current := uint64(clock.CurrentSlot())
+	lag := current - min(a.liveSlot, current)
+	a.updateSyncStatus(lag, current)
+	a.checkFreshness(lag)
+}
+
+// updateSyncStatus records the lag, setting the caught_up metric, and logs if the archiver caught up or fell behind.
+func (a *Archiver) updateSyncStatus(lag uint64, current uint64) {
+	status := syncStatus{
+		CaughtUp:     lag <= a.cfg.CaughtUpLag,
+		Lag:          lag,
+		ArchivedSlot: a.liveSlot,
+		CurrentSlot:  current,
+	}
+
+	a.statusMu.Lock()
+	changed := !a.statusChecked || a.status.CaughtUp != status.CaughtUp
+	a.status = status
+	a.statusChecked = true
+	a.statusMu.Unlock()
+
+	a.metrics.SetCaughtUp(status.CaughtUp)
+	if !changed {
+		return
+	}
+
+	if status.CaughtUp {
+		a.log.Info("caught up to head", "lag", lag, "maxLag", a.cfg.CaughtUpLag, "slot", a.liveSlot)
+	} else {
+		a.log.Info("catching up to head", "lag", lag, "maxLag", a.cfg.CaughtUpLag, "slot", a.liveSlot)
+	}
+}
+
+// getSyncStatus returns the sync status as of the last check of the lag.
+func (a *Archiver) getSyncStatus() syncStatus {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	return a.status
+}
+
+// checkFreshness flips the sla_breached metric and logs if the lag breached or restored the freshness SLA.
+func (a *Archiver) checkFreshness(lag uint64) {
+	if a.freshness == nil {
+		return
+	}
+
+	if !a.freshness.observe(lag, a.clock.Now()) {
+		return
+	}
+
+	a.metrics.SetSLABreached(a.freshness.breached)
+	if a.freshness.breached {
+		a.log.Warn("freshness SLA breached", "lag", lag, "maxLag", a.freshness.maxLag, "period", a.freshness.period, "slot", a.liveSlot)
+	} else {
+		a.log.Info("freshness SLA restored", "lag", lag, "maxLag", a.freshness.maxLag, "slot", a.liveSlot)
+	}
+}
+
+// getSlotClock returns the slot clock of the chain, fetching it from the beacon node if it wasn't fetched yet.
+func (a *Archiver) getSlotClock(ctx context.Context) (beacon.SlotClock, error) {
+	a.slotClockMu.Lock()
+	defer a.slotClockMu.Unlock()
+
+	if a.slotClock == nil {
+		clock, err := beacon.NewSlotClock(ctx, a.beaconClient, a.clock)
+		if err != nil {
+			return beacon.SlotClock{}, err
+		}
+		a.slotClock = &clock
+	}
+
+	return *a.slotClock, nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreshnessSLA_Debounced(t *testing.T) {
+	f := &freshnessSLA{maxLag: 4, period: 30 * time.Second}
+	start := time.Unix(1000, 0)
+
+	require.False(t, f.observe(4, start))
+	require.False(t, f.breached)
+
+	// A lag over the maximum that recovers within the period doesn't breach the SLA
+	require.False(t, f.observe(5, start.Add(time.Second)))
+	require.False(t, f.observe(9, start.Add(20*time.Second)))
+	require.False(t, f.observe(0, start.Add(40*time.Second)))
+	require.False(t, f.observe(5, start.Add(50*time.Second)))
+	require.False(t, f.breached)
+
+	require.True(t, f.observe(6, start.Add(80*time.Second)))
+	require.True(t, f.breached)
+	require.False(t, f.observe(7, start.Add(90*time.Second)))
+
+	// Nor does a lag within the maximum restore it until it has lasted the period
+	require.False(t, f.observe(1, start.Add(100*time.Second)))
+	require.False(t, f.observe(8, start.Add(110*time.Second)))
+	require.False(t, f.observe(2, start.Add(120*time.Second)))
+	require.True(t, f.breached)
+
+	require.True(t, f.observe(3, start.Add(150*time.Second)))
+	require.False(t, f.breached)
+}
+
+func TestFreshnessSLA_NoPeriod(t *testing.T) {
+	f := &freshnessSLA{maxLag: 2}
+	now := time.Unix(1000, 0)
+
+	require.True(t, f.observe(3, now))
+	require.True(t, f.breached)
+	require.True(t, f.observe(2, now))
+	require.False(t, f.breached)
+}
+
+func TestArchiver_FreshnessSLA(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.GenesisTime = time.Unix(1_700_000_000, 0)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		FreshnessSLA: flags.FreshnessSLAConfig{MaxLag: 4, BreachPeriod: 30 * time.Second},
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+
+	slotTime := func(slot uint64) time.Time {
+		return beacon.GenesisTime.Add(time.Duration(slot) * 12 * time.Second)
+	}
+	clock := beacontest.NewFakeClock(slotTime(blobtest.EndSlot))
+	svc.clock = clock
+	breached := func() bool {
+		return metricValue(t, m, "blob_archiver_sla_breached") == 1
+	}
+
+	svc.processBlocksUntilKnownBlock(context.Background())
+	svc.checkLag(context.Background())
+	require.False(t, breached())
+
+	// The head stops moving, so the lag grows past the maximum, but a new head arrives within the breach period
+	clock.Set(slotTime(blobtest.EndSlot + 5))
+	svc.checkLag(context.Background())
+	require.False(t, breached())
+
+	next, _ := addSlotOnlyBlock(t, beacon, blobtest.EndSlot+6, nil)
+	beacon.Headers["head"] = beacon.Headers[next.String()]
+	clock.Set(slotTime(blobtest.EndSlot + 6))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	svc.checkLag(context.Background())
+	require.False(t, breached())
+
+	// A lag past the maximum for the whole breach period breaches the SLA
+	clock.Set(slotTime(blobtest.EndSlot + 11))
+	svc.checkLag(context.Background())
+	require.False(t, breached())
+
+	clock.Advance(30 * time.Second)
+	svc.checkLag(context.Background())
+	require.True(t, breached())
+
+	// Catching up only restores it once the lag has been within the maximum for the breach period
+	head := blobtest.EndSlot + 14
+	next, _ = addSlotOnlyBlock(t, beacon, head, nil)
+	beacon.Headers["head"] = beacon.Headers[next.String()]
+	clock.Set(slotTime(head))
+	svc.processBlocksUntilKnownBlock(context.Background())
+	svc.checkLag(context.Background())
+	require.True(t, breached())
+
+	clock.Advance(30 * time.Second)
+	svc.checkLag(context.Background())
+	require.False(t, breached())
+}
+
+func TestArchiver_CaughtUp(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	beacon.GenesisTime = time.Unix(1_700_000_000, 0)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		CaughtUpLag:  2,
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+	api := NewAPI(m, l, svc)
+
+	slotTime := func(slot uint64) time.Time {
+		return beacon.GenesisTime.Add(time.Duration(slot) * 12 * time.Second)
+	}
+	clock := beacontest.NewFakeClock(slotTime(blobtest.EndSlot + 1))
+	svc.clock = clock
+	status := func() syncStatus {
+		response := httptest.NewRecorder()
+		api.router.ServeHTTP(response, httptest.NewRequest("GET", "/status", nil))
+		require.Equal(t, 200, response.Code)
+
+		var status syncStatus
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &status))
+		require.Equal(t, status.CaughtUp, metricValue(t, m, "blob_archiver_caught_up") == 1)
+		return status
+	}
+
+	// Until the lag is checked, the archiver is catching up
+	require.False(t, status().CaughtUp)
+
+	svc.processBlocksUntilKnownBlock(context.Background())
+	svc.checkLag(context.Background())
+	require.Equal(t, syncStatus{CaughtUp: true, Lag: 1, ArchivedSlot: blobtest.EndSlot, CurrentSlot: blobtest.EndSlot + 1}, status())
+
+	// The head stops moving, e.g. during downtime of the beacon node, so the lag grows past the maximum
+	clock.Set(slotTime(blobtest.EndSlot + 3))
+	svc.checkLag(context.Background())
+	require.Equal(t, syncStatus{CaughtUp: false, Lag: 3, ArchivedSlot: blobtest.EndSlot, CurrentSlot: blobtest.EndSlot + 3}, status())
+
+	// Archiving the current head catches up again
+	next, _ := addSlotOnlyBlock(t, beacon, blobtest.EndSlot+3, nil)
+	beacon.Headers["head"] = beacon.Headers[next.String()]
+	svc.processBlocksUntilKnownBlock(context.Background())
+	svc.checkLag(context.Background())
+	require.Equal(t, syncStatus{CaughtUp: true, Lag: 0, ArchivedSlot: blobtest.EndSlot + 3, CurrentSlot: blobtest.EndSlot + 3}, status())
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+)
+
+// errInvalidKZGProof is returned when the KZG proof of a blob doesn't verify against the blob and its commitment.
+var errInvalidKZGProof = errors.New("invalid blob kzg proof")
+
+// verifyKZGProofs returns errInvalidKZGProof if the KZG proof of any of the blob sidecars doesn't verify.
+func verifyKZGProofs(sidecars []*deneb.BlobSidecar) error {
+	for _, sidecar := range sidecars {
+		err := kzg4844.VerifyBlobProof(kzg4844.Blob(sidecar.Blob), kzg4844.Commitment(sidecar.KZGCommitment), kzg4844.Proof(sidecar.KZGProof))
+		if err != nil {
+			return fmt.Errorf("%w: blob %d: %w", errInvalidKZGProof, sidecar.Index, err)
+		}
+	}
+
+	return nil
+}
+
+// checkKZGProofs returns errInvalidKZGProof if KZG proofs are verified synchronously and any of the blob sidecars has an
+// invalid proof, so that the block is rejected before it is written.
+func (a *Archiver) checkKZGProofs(header common.Hash, sidecars []*deneb.BlobSidecar) error {
+	if a.cfg.KZGVerification.Mode != flags.KZGVerificationSync {
+		return nil
+	}
+
+	if err := verifyKZGProofs(sidecars); err != nil {
+		a.log.Error("blob kzg proof is invalid, rejecting block", "err", err, "hash", header)
+		a.metrics.RecordKZGVerification(metrics.KZGVerificationInvalid)
+		return err
+	}
+
+	a.metrics.RecordKZGVerification(metrics.KZGVerificationValid)
+	return nil
+}
+
+// enqueueKZGVerification queues a written block for asynchronous KZG verification, if KZG proofs are verified
+// asynchronously. Blocks are dropped unverified while the queue is full, so that verification never holds up writes.
+func (a *Archiver) enqueueKZGVerification(hash common.Hash) {
+	if a.kzgQueue == nil {
+		return
+	}
+
+	select {
+	case a.kzgQueue <- hash:
+	default:
+		a.log.Warn("kzg verification queue is full, block is not verified", "hash", hash)
+		a.metrics.RecordKZGVerification(metrics.KZGVerificationDropped)
+	}
+}
+
+// kzgVerifyLoop verifies the KZG proofs of the queued blocks until the archiver is stopped.
+func (a *Archiver) kzgVerifyLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.stopCh:
+			return
+		case hash := <-a.kzgQueue:
+			a.verifyStored(ctx, hash)
+		}
+	}
+}
+
+// verifyStored reads the blob data of a written block back from the data store and verifies its KZG proofs. Blocks with
+// an invalid proof are flagged, and moved to the quarantine data store if there is one, so that they are no longer
+// served. They are not fetched again, as the beacon node that served them can't be trusted to serve them correctly.
+func (a *Archiver) verifyStored(ctx context.Context, hash common.Hash) {
+	data, err := a.dataStoreClient.Read(ctx, hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The block may have been pruned since
+		return
+	}
+	if err != nil {
+		a.log.Warn("failed to read block for kzg verification", "err", err, "hash", hash)
+		a.metrics.RecordKZGVerification(metrics.KZGVerificationFailed)
+		return
+	}
+
+	err = verifyKZGProofs(data.BlobSidecars.Data)
+	if err == nil {
+		a.metrics.RecordKZGVerification(metrics.KZGVerificationValid)
+		return
+	}
+
+	a.log.Error("stored blob kzg proof is invalid", "err", err, "hash", hash, "slot", data.Header.Slot)
+	a.metrics.RecordKZGVerification(metrics.KZGVerificationInvalid)
+
+	if a.quarantine == nil {
+		return
+	}
+
+	if err := a.quarantineBlock(ctx, data); err != nil {
+		a.log.Error("failed to quarantine block with invalid kzg proof", "err", err, "hash", hash)
+		return
+	}
+
+	a.log.Warn("quarantined block with invalid kzg proof", "hash", hash, "dir", a.cfg.KZGVerification.QuarantineDir)
+	a.metrics.RecordKZGQuarantine()
+}
+
+// quarantineBlock moves the blob data out of the data store into the quarantine data store. It is written there before
+// it is deleted, so that it is never lost.
+func (a *Archiver) quarantineBlock(ctx context.Context, data storage.BlobData) error {
+	if err := a.quarantine.Write(ctx, data); err != nil {
+		return fmt.Errorf("failed to write to quarantine: %w", err)
+	}
+
+	err := storage.DeleteWithSlotIndex(ctx, a.dataStoreClient, data.Header)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete from data store: %w", err)
+	}
+
+	return nil
+}
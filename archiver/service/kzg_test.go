@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// setValidKZGProofs replaces the blobs of the sidecars with blobs of canonical field elements, and sets the commitments
+// and proofs of those blobs, so that they verify.
+func setValidKZGProofs(t *testing.T, sidecars []*deneb.BlobSidecar) {
+	for _, sidecar := range sidecars {
+		var blob kzg4844.Blob
+		for i := 0; i < len(blob); i += 32 {
+			// The first byte of every field element is left empty, so that it is below the modulus
+			copy(blob[i+1:i+32], blobtest.RandBytes(t, 31))
+		}
+
+		commitment, err := kzg4844.BlobToCommitment(blob)
+		require.NoError(t, err)
+		proof, err := kzg4844.ComputeBlobProof(blob, commitment)
+		require.NoError(t, err)
+
+		sidecar.Blob = deneb.Blob(blob)
+		sidecar.KZGCommitment = deneb.KZGCommitment(commitment)
+		sidecar.KZGProof = deneb.KZGProof(proof)
+	}
+}
+
+func setupKZG(t *testing.T, beacon *beacontest.StubBeaconClient, cfg flags.KZGVerificationConfig) (*Archiver, *storagetest.TestFileStorage, metrics.Metricer) {
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:    5 * time.Second,
+		OriginBlock:     blobtest.OriginBlock,
+		KZGVerification: cfg,
+	}, fs, beacon, m, nil)
+	require.NoError(t, err)
+	return svc, fs, m
+}
+
+func TestArchiver_KZGVerificationSyncRejectsInvalidProofs(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs, m := setupKZG(t, beacon, flags.KZGVerificationConfig{Mode: flags.KZGVerificationSync})
+
+	// The blobs of the stub have random commitments and proofs
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.ErrorIs(t, err, errInvalidKZGProof)
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+
+	setValidKZGProofs(t, beacon.Blobs[blobtest.Four.String()])
+	_, _, err = svc.persistBlobsForBlockToS3(context.Background(), blobtest.Four.String(), false)
+	require.NoError(t, err)
+	fs.CheckExistsOrFail(t, blobtest.Four)
+
+	require.Equal(t, map[string]float64{"invalid": 1, "valid": 1}, counterValues(t, m, "blob_archiver_kzg_verifications"))
+}
+
+func TestArchiver_KZGVerificationAsyncFlagsInvalidProofsAfterWrite(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	setValidKZGProofs(t, beacon.Blobs[blobtest.Four.String()])
+	svc, fs, m := setupKZG(t, beacon, flags.KZGVerificationConfig{
+		Mode:        flags.KZGVerificationAsync,
+		QueueSize:   10,
+		Concurrency: 1,
+	})
+
+	// Blocks are written without being verified, whether their proofs are valid or not
+	for _, hash := range []string{blobtest.Five.String(), blobtest.Four.String()} {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), hash, false)
+		require.NoError(t, err)
+	}
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	require.Empty(t, counterValues(t, m, "blob_archiver_kzg_verifications"))
+	require.Len(t, svc.kzgQueue, 2)
+
+	svc.verifyStored(context.Background(), <-svc.kzgQueue)
+	svc.verifyStored(context.Background(), <-svc.kzgQueue)
+
+	// Without a quarantine, the invalid block is flagged but still served
+	require.Equal(t, map[string]float64{"invalid": 1, "valid": 1}, counterValues(t, m, "blob_archiver_kzg_verifications"))
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckExistsOrFail(t, blobtest.Four)
+}
+
+func TestArchiver_KZGVerificationAsyncQuarantinesInvalidBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	dir := t.TempDir()
+	svc, fs, m := setupKZG(t, beacon, flags.KZGVerificationConfig{
+		Mode:          flags.KZGVerificationAsync,
+		QueueSize:     10,
+		Concurrency:   1,
+		QuarantineDir: dir,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.kzgVerifyLoop(ctx)
+
+	_, _, err := svc.persistBlobsForBlockToS3(context.Background(), blobtest.Five.String(), false)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return metricValue(t, m, "blob_archiver_kzg_quarantined_blocks") == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, map[string]float64{"invalid": 1}, counterValues(t, m, "blob_archiver_kzg_verifications"))
+
+	// The block is moved out of the data store, into the quarantine
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+	quarantined, err := storage.NewFileStorage(dir, svc.log).Read(context.Background(), blobtest.Five)
+	require.NoError(t, err)
+	require.Equal(t, beacon.Blobs[blobtest.Five.String()], quarantined.BlobSidecars.Data)
+}
+
+func TestArchiver_KZGVerificationAsyncDropsBlocksWhileQueueIsFull(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs, m := setupKZG(t, beacon, flags.KZGVerificationConfig{
+		Mode:        flags.KZGVerificationAsync,
+		QueueSize:   1,
+		Concurrency: 1,
+	})
+
+	for _, hash := range []string{blobtest.Five.String(), blobtest.Four.String()} {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), hash, false)
+		require.NoError(t, err)
+	}
+
+	fs.CheckExistsOrFail(t, blobtest.Four)
+	require.Equal(t, map[string]float64{"dropped": 1}, counterValues(t, m, "blob_archiver_kzg_verifications"))
+	require.Equal(t, blobtest.Five, <-svc.kzgQueue)
+}
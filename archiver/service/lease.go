@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/storage"
+)
+
+// errLeaseHeld is returned when the lease of the data store is held by another archiver, or was just taken by one.
+var errLeaseHeld = errors.New("lease is held by another archiver")
+
+// runWithLease runs the archiver only while it holds the lease of the data store, so that of several archivers sharing
+// a data store only one archives at a time. It waits for the lease, runs the archiver once it acquired it, and renews
+// the lease every third of its TTL while it runs. If the lease is lost, because it couldn't be renewed before it
+// expired or another archiver took it over, the archiver is stopped and waits for the lease again. Once the archiver
+// is stopped, the lease is released, so that another archiver can take it over without waiting for it to expire.
+func (a *Archiver) runWithLease(ctx context.Context) error {
+	for {
+		lease, ok := a.waitForLease(ctx)
+		if !ok {
+			return nil
+		}
+
+		a.log.Info("acquired lease, archiving", "term", lease.Term, "expires", lease.Expires)
+		a.metrics.SetLeaseHeld(true)
+		a.metrics.RecordLeaseAcquired()
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		var lost bool
+		go func() {
+			defer close(done)
+			lease, lost = a.holdLease(runCtx, lease)
+			if lost {
+				cancel()
+			}
+		}()
+
+		err := a.run(runCtx)
+		// None of the goroutines of the run may write once another archiver can take over the lease
+		cancel()
+		a.workers.Wait()
+		<-done
+		a.metrics.SetLeaseHeld(false)
+
+		if !lost {
+			a.releaseLease(context.WithoutCancel(ctx), lease)
+			return err
+		}
+
+		a.log.Warn("lost lease, waiting to take it over again", "term", lease.Term)
+	}
+}
+
+// waitForLease tries to acquire the lease every third of its TTL until it acquires it, which it returns, or until the
+// archiver is stopped, in which case it returns false.
+func (a *Archiver) waitForLease(ctx context.Context) (storage.Lease, bool) {
+	t := time.NewTicker(a.cfg.Lease.TTL / 3)
+	defer t.Stop()
+
+	for {
+		lease, err := a.tryAcquireLease(ctx)
+		if err == nil {
+			return lease, true
+		}
+
+		if errors.Is(err, errLeaseHeld) {
+			a.log.Debug("waiting for lease", "err", err)
+		} else {
+			a.log.Warn("failed to acquire lease", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return storage.Lease{}, false
+		case <-a.stopCh:
+			return storage.Lease{}, false
+		case <-t.C:
+		}
+	}
+}
+
+// tryAcquireLease acquires the lease by writing its next term, unless the current term is held by another archiver
+// and hasn't expired yet. It returns errLeaseHeld if it is held, or if another archiver wrote the next term first.
+func (a *Archiver) tryAcquireLease(ctx context.Context) (storage.Lease, error) {
+	current, err := a.leases.ReadLease(ctx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return storage.Lease{}, err
+	}
+
+	now := a.clock.Now()
+	if current.Holder != a.cfg.Lease.Holder && now.Before(current.Expires) {
+		return storage.Lease{}, fmt.Errorf("%w: held by %s until %s", errLeaseHeld, current.Holder, current.Expires)
+	}
+
+	next := storage.Lease{Term: current.Term + 1, Holder: a.cfg.Lease.Holder, Expires: now.Add(a.cfg.Lease.TTL)}
+	err = a.leases.WriteLease(ctx, next)
+	if errors.Is(err, storage.ErrLeaseTaken) {
+		return storage.Lease{}, errLeaseHeld
+	}
+	if err != nil {
+		return storage.Lease{}, err
+	}
+
+	return next, nil
+}
+
+// holdLease renews the held lease every third of its TTL, by writing its next term, until the context is cancelled, and
+// returns the lease held last. It returns true if the lease was lost, because another archiver wrote the next term
+// first, or because it couldn't be renewed before it expired.
+func (a *Archiver) holdLease(ctx context.Context, lease storage.Lease) (storage.Lease, bool) {
+	t := time.NewTicker(a.cfg.Lease.TTL / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return lease, false
+		case <-t.C:
+		}
+
+		now := a.clock.Now()
+		next := storage.Lease{Term: lease.Term + 1, Holder: a.cfg.Lease.Holder, Expires: now.Add(a.cfg.Lease.TTL)}
+		err := a.leases.WriteLease(ctx, next)
+		if err == nil {
+			lease = next
+			continue
+		}
+
+		if errors.Is(err, storage.ErrLeaseTaken) {
+			a.log.Error("lease was taken over by another archiver", "term", next.Term)
+			return lease, true
+		}
+
+		a.log.Warn("failed to renew lease", "err", err, "term", next.Term, "expires", lease.Expires)
+		if !now.Before(lease.Expires) {
+			a.log.Error("lease expired before it could be renewed", "term", lease.Term)
+			return lease, true
+		}
+	}
+}
+
+// releaseLease writes the next term of the held lease as already expired, so that another archiver can take it over
+// right away.
+func (a *Archiver) releaseLease(ctx context.Context, lease storage.Lease) {
+	released := storage.Lease{Term: lease.Term + 1, Holder: a.cfg.Lease.Holder, Expires: a.clock.Now()}
+	if err := a.leases.WriteLease(ctx, released); err != nil {
+		a.log.Warn("failed to release lease", "err", err, "term", released.Term)
+		return
+	}
+
+	a.log.Info("released lease", "term", released.Term)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+const testLeaseTTL = 60 * time.Millisecond
+
+// setupLease creates an archiver holding the lease as the given holder, sharing the data store and clock with the
+// other archivers of the test.
+func setupLease(t *testing.T, holder string, fs *storagetest.TestFileStorage, clock *beacontest.FakeClock) (*Archiver, metrics.Metricer) {
+	m := metrics.NewMetrics()
+	svc, err := NewArchiver(testlog.Logger(t, log.LvlInfo), flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Lease:        flags.LeaseConfig{TTL: testLeaseTTL, Holder: holder},
+	}, fs, beacontest.NewDefaultStubBeaconClient(t), m, nil)
+	require.NoError(t, err)
+	svc.clock = clock
+	return svc, m
+}
+
+func readLease(t *testing.T, fs storage.LeaseStore) storage.Lease {
+	lease, err := fs.ReadLease(context.Background())
+	require.NoError(t, err)
+	return lease
+}
+
+func TestArchiver_LeaseAcquisition(t *testing.T) {
+	fs := storagetest.NewTestFileStorage(t, testlog.Logger(t, log.LvlInfo))
+	clock := beacontest.NewFakeClock(time.Unix(1000, 0))
+	a, _ := setupLease(t, "a", fs, clock)
+	b, _ := setupLease(t, "b", fs, clock)
+
+	lease, err := a.tryAcquireLease(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, storage.Lease{Term: 1, Holder: "a", Expires: clock.Now().Add(testLeaseTTL)}, lease)
+	require.Equal(t, lease.Term, readLease(t, fs).Term)
+
+	// The lease can't be acquired by another archiver until it expires
+	_, err = b.tryAcquireLease(context.Background())
+	require.ErrorIs(t, err, errLeaseHeld)
+
+	clock.Advance(testLeaseTTL - time.Millisecond)
+	_, err = b.tryAcquireLease(context.Background())
+	require.ErrorIs(t, err, errLeaseHeld)
+
+	// The holder can acquire it again, e.g. after a restart
+	lease, err = a.tryAcquireLease(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lease.Term)
+}
+
+func TestArchiver_LeaseRenewal(t *testing.T) {
+	fs := storagetest.NewTestFileStorage(t, testlog.Logger(t, log.LvlInfo))
+	clock := beacontest.NewFakeClock(time.Unix(1000, 0))
+	a, _ := setupLease(t, "a", fs, clock)
+	b, _ := setupLease(t, "b", fs, clock)
+
+	lease, err := a.tryAcquireLease(context.Background())
+	require.NoError(t, err)
+
+	type result struct {
+		lease storage.Lease
+		lost  bool
+	}
+	done := make(chan result, 1)
+	go func() {
+		lease, lost := a.holdLease(context.Background(), lease)
+		done <- result{lease, lost}
+	}()
+
+	// Renewals write later terms that expire a TTL after they were written
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		renewed := readLease(t, fs)
+		return renewed.Term > lease.Term && renewed.Expires.Equal(clock.Now().Add(testLeaseTTL))
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// As the lease was renewed, it didn't expire, and can't be acquired by another archiver
+	_, err = b.tryAcquireLease(context.Background())
+	require.ErrorIs(t, err, errLeaseHeld)
+
+	// Once another archiver takes over the next term, the lease is lost
+	current := readLease(t, fs)
+	require.NoError(t, fs.WriteLease(context.Background(), storage.Lease{Term: current.Term + 1, Holder: "b", Expires: clock.Now()}))
+
+	select {
+	case res := <-done:
+		require.True(t, res.lost)
+		require.Equal(t, "a", res.lease.Holder)
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease was not lost")
+	}
+}
+
+func TestArchiver_LeaseFailover(t *testing.T) {
+	fs := storagetest.NewTestFileStorage(t, testlog.Logger(t, log.LvlInfo))
+	clock := beacontest.NewFakeClock(time.Unix(1000, 0))
+	crashed, _ := setupLease(t, "a", fs, clock)
+	standby, m := setupLease(t, "b", fs, clock)
+
+	// The leader acquires the lease and crashes without renewing or releasing it
+	_, err := crashed.tryAcquireLease(context.Background())
+	require.NoError(t, err)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- standby.Start(context.Background())
+	}()
+
+	// The standby doesn't archive while the lease hasn't expired
+	time.Sleep(5 * testLeaseTTL)
+	require.Equal(t, "a", readLease(t, fs).Holder)
+	require.Equal(t, float64(0), metricValue(t, m, "blob_archiver_lease_held"))
+	fs.CheckNotExistsOrFail(t, blobtest.Five)
+
+	// Once it expired, the standby takes it over and archives
+	clock.Advance(testLeaseTTL)
+	require.Eventually(t, func() bool {
+		return metricValue(t, m, "blob_archiver_lease_held") == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	require.Equal(t, "b", readLease(t, fs).Holder)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_lease_acquisitions"))
+	require.Eventually(t, func() bool {
+		exists, err := fs.Exists(context.Background(), blobtest.Five)
+		return err == nil && exists
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Once stopped, it releases the lease so that it can be taken over right away
+	require.NoError(t, standby.Stop(context.Background()))
+	select {
+	case err := <-started:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("archiver did not stop")
+	}
+
+	released := readLease(t, fs)
+	require.Equal(t, "b", released.Holder)
+	require.False(t, clock.Now().Before(released.Expires))
+	_, err = crashed.tryAcquireLease(context.Background())
+	require.NoError(t, err)
+}
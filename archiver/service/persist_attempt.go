@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+type persistAttemptKey struct{}
+
+// persistAttempt caches what was fetched from the beacon node while persisting a block, so that retrying the persist
+// after a later step failed, e.g. the storage write, resumes from that step instead of fetching everything again. The
+// retries of a persist share an attempt through their context, see withPersistAttempt. Only successful fetches are
+// cached, and a header is forgotten once its block identifier is found to resolve to another block.
+type persistAttempt struct {
+	mu       sync.Mutex
+	headers  map[string]*api.Response[*v1.BeaconBlockHeader]
+	sidecars map[phase0.Root]*api.Response[[]*deneb.BlobSidecar]
+	blocks   map[phase0.Root]*spec.VersionedSignedBeaconBlock
+}
+
+// withPersistAttempt returns a context for the retries of persisting a block, which share what they fetched.
+func withPersistAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, persistAttemptKey{}, &persistAttempt{
+		headers:  make(map[string]*api.Response[*v1.BeaconBlockHeader]),
+		sidecars: make(map[phase0.Root]*api.Response[[]*deneb.BlobSidecar]),
+		blocks:   make(map[phase0.Root]*spec.VersionedSignedBeaconBlock),
+	})
+}
+
+// persistAttemptOf returns the attempt of the context, or nil if it has none, in which case nothing is cached.
+func persistAttemptOf(ctx context.Context) *persistAttempt {
+	attempt, _ := ctx.Value(persistAttemptKey{}).(*persistAttempt)
+	return attempt
+}
+
+func (p *persistAttempt) header(blockIdentifier string) (*api.Response[*v1.BeaconBlockHeader], bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	header, ok := p.headers[blockIdentifier]
+	return header, ok
+}
+
+func (p *persistAttempt) setHeader(blockIdentifier string, header *api.Response[*v1.BeaconBlockHeader]) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.headers[blockIdentifier] = header
+}
+
+// forgetHeader drops the cached header of the block identifier, e.g. once the block it resolves to changed.
+func (p *persistAttempt) forgetHeader(blockIdentifier string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.headers, blockIdentifier)
+}
+
+func (p *persistAttempt) blobSidecars(root phase0.Root) (*api.Response[[]*deneb.BlobSidecar], bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sidecars, ok := p.sidecars[root]
+	return sidecars, ok
+}
+
+func (p *persistAttempt) setBlobSidecars(root phase0.Root, sidecars *api.Response[[]*deneb.BlobSidecar]) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sidecars[root] = sidecars
+}
+
+func (p *persistAttempt) block(root phase0.Root) (*spec.VersionedSignedBeaconBlock, bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	block, ok := p.blocks[root]
+	return block, ok
+}
+
+func (p *persistAttempt) setBlock(root phase0.Root, block *spec.VersionedSignedBeaconBlock) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocks[root] = block
+}
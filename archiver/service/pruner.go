@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/errgroup"
+)
+
+// pruneLoop periodically prunes blobs that have fallen out of the configured retention window.
+func (a *Archiver) pruneLoop(ctx context.Context) {
+	t := time.NewTicker(a.cfg.PruneConfig.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.stopCh:
+			return
+		case <-t.C:
+			if _, err := a.prune(ctx); err != nil {
+				a.log.Error("failed to prune blobs", "err", err)
+			}
+		}
+	}
+}
+
+// retentionBoundary returns the lowest slot that is retained given the head slot, and whether pruning is enabled at all.
+// Blobs for slots below the boundary are pruned, so there is no point in writing them.
+func (a *Archiver) retentionBoundary(headSlot uint64) (uint64, bool) {
+	if a.cfg.PruneConfig.Retention == 0 {
+		return 0, false
+	}
+
+	if headSlot <= a.cfg.PruneConfig.Retention {
+		return 0, true
+	}
+
+	return headSlot - a.cfg.PruneConfig.Retention, true
+}
+
+// prune deletes all blobs whose slot is more than the configured retention behind the current head. Eligibility is
+// determined per object from its stored slot, so objects concurrently written are never deleted: the live loop writes
+// near head, and backfill and rearchiving never write below the retention boundary. Objects without a recorded slot are
+// never deleted. In dry-run mode, eligible objects are only logged. It returns the number of pruned blobs.
+func (a *Archiver) prune(ctx context.Context) (int, error) {
+	head, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+		Block: "head",
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	boundary, _ := a.retentionBoundary(uint64(head.Data.Header.Message.Slot))
+	if boundary == 0 {
+		return 0, nil
+	}
+
+	l := a.log.New("boundary", boundary, "dryRun", a.cfg.PruneConfig.DryRun)
+	l.Info("pruning blobs")
+
+	var pruned atomic.Int64
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(a.cfg.PruneConfig.Concurrency)
+
+	err = a.dataStoreClient.List(gctx, func(hash common.Hash) error {
+		g.Go(func() error {
+			header, err := a.dataStoreClient.Stat(gctx, hash)
+			if errors.Is(err, storage.ErrNotFound) {
+				// Deleted in the meantime, nothing to do
+				return nil
+			} else if errors.Is(err, storage.ErrMarshaling) {
+				// The slot can't be determined, so it's never safe to delete
+				l.Warn("unable to determine slot of blob, skipping", "hash", hash)
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if header.Slot == 0 || header.Slot >= boundary {
+				return nil
+			}
+
+			if a.cfg.PruneConfig.DryRun {
+				l.Info("would prune blob", "hash", hash, "slot", header.Slot)
+				pruned.Add(1)
+				return nil
+			}
+
+			err = storage.DeleteWithSlotIndex(gctx, a.dataStoreClient, header)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+
+			pruned.Add(1)
+			return nil
+		})
+
+		return gctx.Err()
+	})
+
+	if waitErr := g.Wait(); waitErr != nil {
+		err = waitErr
+	}
+
+	if !a.cfg.PruneConfig.DryRun {
+		a.metrics.RecordPrunedBlobs(int(pruned.Load()))
+	}
+
+	l.Info("pruning complete", "pruned", pruned.Load(), "err", err)
+	return int(pruned.Load()), err
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDefaultBlocks writes all blocks of the default stub beacon client to storage, with their slots.
+func writeDefaultBlocks(t *testing.T, beacon *beacontest.StubBeaconClient, fs *storagetest.TestFileStorage) {
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three, blobtest.Four, blobtest.Five} {
+		fs.WriteOrFail(t, storage.BlobData{
+			Header: storage.Header{
+				BeaconBlockHash: hash,
+				Slot:            uint64(beacon.Headers[hash.String()].Header.Message.Slot),
+			},
+			BlobSidecars: storage.BlobSidecars{
+				Data: beacon.Blobs[hash.String()],
+			},
+		})
+	}
+}
+
+func TestArchiver_PruneDeletesOnlyEligibleBlobs(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   2,
+		Concurrency: 3,
+	}
+
+	writeDefaultBlocks(t, beacon, fs)
+
+	// Blocks written concurrently near head must never be pruned
+	var wg sync.WaitGroup
+	var concurrent []common.Hash
+	for i := 0; i < 10; i++ {
+		hash := common.Hash{0xff, byte(i)}
+		concurrent = append(concurrent, hash)
+		wg.Add(1)
+		go func(hash common.Hash, slot uint64) {
+			defer wg.Done()
+			fs.WriteOrFail(t, storage.BlobData{
+				Header: storage.Header{
+					BeaconBlockHash: hash,
+					Slot:            slot,
+				},
+			})
+		}(hash, blobtest.EndSlot+uint64(i))
+	}
+
+	// Head is at EndSlot, so everything below EndSlot-2 is eligible
+	pruned, err := svc.prune(context.Background())
+	wg.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+
+	for _, hash := range append([]common.Hash{blobtest.Three, blobtest.Four, blobtest.Five}, concurrent...) {
+		fs.CheckExistsOrFail(t, hash)
+	}
+
+	require.Equal(t, float64(3), metricValue(t, svc.metrics, "blob_archiver_blobs_pruned"))
+}
+
+func TestArchiver_PruneSkipsBlobsWithoutSlot(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   2,
+		Concurrency: 1,
+	}
+
+	// Written before slots were recorded
+	fs.WriteOrFail(t, storage.BlobData{
+		Header: storage.Header{
+			BeaconBlockHash: blobtest.OriginBlock,
+		},
+	})
+
+	pruned, err := svc.prune(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, pruned)
+	fs.CheckExistsOrFail(t, blobtest.OriginBlock)
+}
+
+func TestArchiver_PruneDryRun(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   2,
+		Concurrency: 2,
+		DryRun:      true,
+	}
+
+	writeDefaultBlocks(t, beacon, fs)
+
+	pruned, err := svc.prune(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three, blobtest.Four, blobtest.Five} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+
+	require.Equal(t, float64(0), metricValue(t, svc.metrics, "blob_archiver_blobs_pruned"))
+}
+
+func TestArchiver_PruneDeletesSlotIndex(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   2,
+		Concurrency: 2,
+	}
+
+	writeDefaultBlocks(t, beacon, fs)
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.Three} {
+		require.NoError(t, fs.WriteSlotIndex(context.Background(), uint64(beacon.Headers[hash.String()].Header.Message.Slot), hash))
+	}
+
+	_, err := svc.prune(context.Background())
+	require.NoError(t, err)
+
+	_, err = fs.ReadSlotIndex(context.Background(), blobtest.StartSlot)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	indexed, err := fs.ReadSlotIndex(context.Background(), blobtest.StartSlot+3)
+	require.NoError(t, err)
+	require.Equal(t, blobtest.Three, indexed)
+}
+
+func TestArchiver_PruneConcurrentWithRearchive(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   2,
+		Concurrency: 2,
+	}
+
+	writeDefaultBlocks(t, beacon, fs)
+
+	// Old blocks are never rewritten while they are being pruned, blocks in the retention window are
+	var wg sync.WaitGroup
+	var oldErr, recentErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _, oldErr = svc.rearchiveRange(blobtest.StartSlot, blobtest.StartSlot+1)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _, recentErr = svc.rearchiveRange(blobtest.StartSlot+3, blobtest.EndSlot)
+	}()
+
+	_, err := svc.prune(context.Background())
+	wg.Wait()
+	require.NoError(t, err)
+	require.ErrorContains(t, oldErr, "outside the retention window")
+	require.NoError(t, recentErr)
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+
+	for _, hash := range []common.Hash{blobtest.Three, blobtest.Four, blobtest.Five} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+}
+
+func TestArchiver_BackfillStopsAtRetentionBoundary(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.PruneConfig = flags.PruneConfig{
+		Retention:   3,
+		Concurrency: 1,
+	}
+
+	// The origin is older than the retention boundary at slot 12
+	svc.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two} {
+		fs.CheckExistsOrFail(t, hash)
+	}
+
+	for _, hash := range []common.Hash{blobtest.One, blobtest.OriginBlock} {
+		fs.CheckNotExistsOrFail(t, hash)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/sync/errgroup"
+)
+
+// reconcileMaximumRetries is how often fetching a missing root is tried before it is reported as failed.
+const reconcileMaximumRetries = 3
+
+// ReconcileStatus is the outcome of reconciling a root with the archive.
+type ReconcileStatus string
+
+const (
+	// ReconcilePresent is a root whose blobs were already archived.
+	ReconcilePresent ReconcileStatus = "present"
+	// ReconcileFetched is a root whose blobs were missing, and were fetched from the beacon node and archived.
+	ReconcileFetched ReconcileStatus = "fetched"
+	// ReconcileUnknown is a root whose blobs were missing, and which the beacon node doesn't know, or no longer has the
+	// blobs of.
+	ReconcileUnknown ReconcileStatus = "unknown"
+	// ReconcileSkipped is a root whose blobs were missing, and which the archiver is configured to skip, see
+	// flags.SlotFilter.
+	ReconcileSkipped ReconcileStatus = "skipped"
+	// ReconcileFailed is a root whose blobs were missing, and couldn't be archived.
+	ReconcileFailed ReconcileStatus = "failed"
+)
+
+// ReconcileResult is the outcome of reconciling a single root.
+type ReconcileResult struct {
+	Root   common.Hash     `json:"root"`
+	Status ReconcileStatus `json:"status"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// ReconcileReport counts the roots of a reconciliation by outcome.
+type ReconcileReport struct {
+	Roots   int `json:"roots"`
+	Present int `json:"present"`
+	Fetched int `json:"fetched"`
+	Unknown int `json:"unknown"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// Complete returns whether the blobs of every root are archived by the end of the reconciliation, other than those the
+// archiver is configured to skip.
+func (r ReconcileReport) Complete() bool {
+	return r.Unknown == 0 && r.Failed == 0
+}
+
+// ReadRoots reads a list of block roots, one hex encoded root per line. Blank lines and lines starting with # are
+// ignored, and so are repeated roots.
+func ReadRoots(r io.Reader) ([]common.Hash, error) {
+	var roots []common.Hash
+	seen := make(map[common.Hash]bool)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		b, err := hexutil.Decode(text)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid root on line %d: \"%s\"", line, text)
+		}
+
+		root := common.BytesToHash(b)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return roots, nil
+}
+
+// ReconcileRoots checks that the blobs of every root are archived, e.g. for a list of canonical roots from a trusted
+// source, and fetches the blobs of the missing roots from the beacon node, with up to concurrency roots reconciled at
+// once. A missing root is tried reconcileMaximumRetries times before it's reported as failed, and roots the beacon node
+// doesn't know are reported as unknown; neither stops the reconciliation. Every result is reported to fn as it is
+// known, from one goroutine at a time. Only errors checking whether blobs are archived are returned.
+func (a *Archiver) ReconcileRoots(ctx context.Context, roots []common.Hash, concurrency int, fn func(result ReconcileResult)) (ReconcileReport, error) {
+	report := ReconcileReport{Roots: len(roots)}
+	var mu sync.Mutex
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(concurrency, 1))
+
+	for _, root := range roots {
+		root := root
+		g.Go(func() error {
+			result, err := a.reconcileRoot(gctx, root)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch result.Status {
+			case ReconcilePresent:
+				report.Present++
+			case ReconcileFetched:
+				report.Fetched++
+			case ReconcileUnknown:
+				report.Unknown++
+			case ReconcileSkipped:
+				report.Skipped++
+			case ReconcileFailed:
+				report.Failed++
+			}
+			fn(result)
+
+			return nil
+		})
+
+		if gctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// reconcileRoot checks whether the blobs of the root are archived, and fetches them if they aren't.
+func (a *Archiver) reconcileRoot(ctx context.Context, root common.Hash) (ReconcileResult, error) {
+	exists, err := a.dataStoreClient.Exists(ctx, root)
+	if err != nil {
+		return ReconcileResult{}, fmt.Errorf("failed to check blob %s: %w", root, err)
+	}
+
+	if exists {
+		return ReconcileResult{Root: root, Status: ReconcilePresent}, nil
+	}
+
+	attemptCtx := withPersistAttempt(withBlockSource(ctx, metrics.BlockSourceReconcile))
+	result, err := retry.Do(ctx, reconcileMaximumRetries, retry.Exponential(), func() (persistResult, error) {
+		result, err := a.persistBlock(attemptCtx, root.String(), false)
+		if isNotFound(err) {
+			// Unknown roots aren't retried
+			return result, nil
+		}
+		return result, err
+	})
+
+	switch {
+	case err != nil:
+		a.log.Warn("failed to reconcile root", "root", root, "err", err)
+		return ReconcileResult{Root: root, Status: ReconcileFailed, Error: err.Error()}, nil
+	case result.header == nil:
+		return ReconcileResult{Root: root, Status: ReconcileUnknown}, nil
+	case result.exists:
+		// Archived by another writer since it was checked
+		return ReconcileResult{Root: root, Status: ReconcilePresent}, nil
+	case !result.written:
+		return ReconcileResult{Root: root, Status: ReconcileSkipped}, nil
+	default:
+		a.metrics.RecordProcessedBlock(metrics.BlockSourceReconcile)
+		return ReconcileResult{Root: root, Status: ReconcileFetched}, nil
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver_ReconcileRoots(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+
+	for _, hash := range []common.Hash{blobtest.One, blobtest.Three} {
+		fs.WriteOrFail(t, storage.BlobData{
+			Header:       storage.Header{BeaconBlockHash: hash},
+			BlobSidecars: storage.BlobSidecars{Data: beacon.Blobs[hash.String()]},
+		})
+	}
+
+	unknown := common.Hash{0xff}
+	path := filepath.Join(t.TempDir(), "roots.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{
+		"# canonical roots",
+		blobtest.OriginBlock.String(),
+		blobtest.One.String(),
+		"",
+		blobtest.Two.String(),
+		blobtest.Three.String(),
+		unknown.String(),
+		blobtest.Two.String(),
+	}, "\n")), 0o644))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	roots, err := ReadRoots(f)
+	require.NoError(t, err)
+	require.Equal(t, []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three, unknown}, roots)
+
+	// The first fetched block is written on the second try
+	fs.WritesFailTimes(1)
+
+	var results []ReconcileResult
+	report, err := svc.ReconcileRoots(context.Background(), roots, 1, func(result ReconcileResult) {
+		results = append(results, result)
+	})
+	require.NoError(t, err)
+	require.Equal(t, ReconcileReport{Roots: 5, Present: 2, Fetched: 2, Unknown: 1}, report)
+	require.False(t, report.Complete())
+	require.Equal(t, []ReconcileResult{
+		{Root: blobtest.OriginBlock, Status: ReconcileFetched},
+		{Root: blobtest.One, Status: ReconcilePresent},
+		{Root: blobtest.Two, Status: ReconcileFetched},
+		{Root: blobtest.Three, Status: ReconcilePresent},
+		{Root: unknown, Status: ReconcileUnknown},
+	}, results)
+
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.Two} {
+		data, err := fs.Read(context.Background(), hash)
+		require.NoError(t, err)
+		require.Equal(t, beacon.Blobs[hash.String()], data.BlobSidecars.Data)
+	}
+
+	// Reconciling again finds every known root archived
+	report, err = svc.ReconcileRoots(context.Background(), roots[:4], 2, func(ReconcileResult) {})
+	require.NoError(t, err)
+	require.Equal(t, ReconcileReport{Roots: 4, Present: 4}, report)
+	require.True(t, report.Complete())
+}
+
+func TestReadRootsInvalid(t *testing.T) {
+	_, err := ReadRoots(strings.NewReader(blobtest.One.String() + "\n0x1234\n"))
+	require.ErrorContains(t, err, "invalid root on line 2")
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+)
+
+// SelfTestStep is the outcome of a single step of the self-test.
+type SelfTestStep struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SelfTestReport is the outcome of the self-test. The steps are listed in the order they were run, up to and including
+// the first failed step, followed by the cleanup of the temporary object if it was written.
+type SelfTestReport struct {
+	Result string         `json:"result"`
+	Slot   uint64         `json:"slot"`
+	Blobs  int            `json:"blobs"`
+	Steps  []SelfTestStep `json:"steps"`
+}
+
+// selfTest exercises the full path blobs take through the archiver: it fetches the sidecars of the current head from the
+// beacon node, writes them to storage under a random temporary key, reads them back, checks they are unchanged, and
+// deletes the temporary object again. The temporary object has no slot index entry, and is recorded at slot 0, so
+// that the pruner removes it if deleting it failed.
+func (a *Archiver) selfTest(ctx context.Context) (report SelfTestReport) {
+	report = SelfTestReport{Result: selfTestPass}
+
+	step := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		result := SelfTestStep{
+			Name:       name,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+
+		if err != nil {
+			a.log.Warn("self-test step failed", "step", name, "err", err)
+			result.Error = err.Error()
+			report.Result = selfTestFail
+		}
+
+		report.Steps = append(report.Steps, result)
+		return err == nil
+	}
+
+	var expected storage.BlobData
+	ok := step("fetch", func() error {
+		header, err := a.beaconClient.BeaconBlockHeader(ctx, &api.BeaconBlockHeaderOpts{
+			Block: "head",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch head: %w", err)
+		}
+
+		sidecars, err := a.fetchBlobSidecars(ctx, header.Data)
+		if err != nil {
+			return fmt.Errorf("failed to fetch blob sidecars: %w", err)
+		}
+
+		report.Slot = uint64(header.Data.Header.Message.Slot)
+		report.Blobs = len(sidecars.Data)
+		expected.BlobSidecars = storage.BlobSidecars{Data: sidecars.Data}
+		return nil
+	})
+	if !ok {
+		return report
+	}
+
+	var key common.Hash
+	if _, err := rand.Read(key[:]); err != nil {
+		step("write", func() error {
+			return fmt.Errorf("failed to generate temporary key: %w", err)
+		})
+		return report
+	}
+	expected.Header = storage.Header{BeaconBlockHash: key}
+
+	if !step("write", func() error {
+		return a.dataStoreClient.Write(ctx, expected)
+	}) {
+		return report
+	}
+
+	defer step("delete", func() error {
+		err := a.dataStoreClient.Delete(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("temporary object %s was already deleted", key)
+		}
+		return err
+	})
+
+	var actual storage.BlobData
+	if !step("read", func() error {
+		var err error
+		actual, err = a.dataStoreClient.Read(ctx, key)
+		return err
+	}) {
+		return report
+	}
+
+	step("compare", func() error {
+		expectedBytes, err := storage.EncodeBlobData(expected)
+		if err != nil {
+			return err
+		}
+
+		actualBytes, err := storage.EncodeBlobData(actual)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(expectedBytes, actualBytes) {
+			return errors.New("blob data read back differs from the data written")
+		}
+
+		return nil
+	})
+
+	return report
+}
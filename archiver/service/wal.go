@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	walOpBegin  = "begin"
+	walOpCommit = "commit"
+	// walCompactThreshold is the number of entries appended to the write-ahead log after which it is rewritten with
+	// only the pending writes.
+	walCompactThreshold = 4096
+	// walReplayMaximumRetries is the number of attempts made to complete a pending write on startup.
+	walReplayMaximumRetries = 5
+)
+
+// walEntry is a line of the write-ahead log, recording that the blobs of a block are about to be written, or that
+// they were.
+type walEntry struct {
+	Op   string      `json:"op"`
+	Root common.Hash `json:"root"`
+	Slot uint64      `json:"slot,omitempty"`
+}
+
+// writeAheadLog records the blocks whose blobs are being written in a local file, so that writes interrupted by a crash
+// can be completed on the next start. A block is recorded, and the file synced, before its blobs are written, and is
+// marked as committed once they were. Commits aren't synced, as losing one only causes the block to be written again.
+// A nil log records nothing.
+type writeAheadLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	pending  map[common.Hash]walEntry
+	appended int
+}
+
+// openWriteAheadLog opens the write-ahead log at the path, creating it if it doesn't exist, and reads the writes that
+// are still pending from it. An incomplete last line, left by a crash while appending it, is ignored.
+func openWriteAheadLog(path string) (*writeAheadLog, error) {
+	w := &writeAheadLog{
+		path:    path,
+		pending: make(map[common.Hash]walEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry walEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		switch entry.Op {
+		case walOpBegin:
+			w.pending[entry.Root] = entry
+		case walOpCommit:
+			delete(w.pending, entry.Root)
+		}
+	}
+
+	if err := w.compact(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// pendingWrites returns the writes that were begun but not committed, newest first.
+func (w *writeAheadLog) pendingWrites() []walEntry {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries := make([]walEntry, 0, len(w.pending))
+	for _, entry := range w.pending {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Slot > entries[j].Slot
+	})
+	return entries
+}
+
+// begin records that the blobs of the block are about to be written, returning once the record is durable.
+func (w *writeAheadLog) begin(root common.Hash, slot uint64) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry := walEntry{Op: walOpBegin, Root: root, Slot: slot}
+	if err := w.append(entry); err != nil {
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+
+	w.pending[root] = entry
+	return nil
+}
+
+// commit records that the write of the block's blobs completed, or was discarded. Blocks that aren't pending are
+// ignored.
+func (w *writeAheadLog) commit(root common.Hash) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.pending[root]; !ok {
+		return nil
+	}
+
+	if err := w.append(walEntry{Op: walOpCommit, Root: root}); err != nil {
+		return err
+	}
+
+	delete(w.pending, root)
+
+	if w.appended >= walCompactThreshold {
+		return w.compact()
+	}
+
+	return nil
+}
+
+func (w *writeAheadLog) close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+func (w *writeAheadLog) append(entry walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to write-ahead log: %w", err)
+	}
+
+	w.appended++
+	return nil
+}
+
+// compact replaces the log with one containing only the pending writes, and reopens it for appending. The new log is
+// written to a temporary file and renamed into place, so that a crash while compacting leaves either log intact.
+func (w *writeAheadLog) compact() error {
+	var buf bytes.Buffer
+	for _, entry := range w.pending {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := filepath.Join(filepath.Dir(w.path), "."+filepath.Base(w.path)+".tmp")
+	if err := writeFileSync(tmp, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to compact write-ahead log: %w", err)
+	}
+
+	if err := os.Rename(tmp, w.path); err != nil {
+		return fmt.Errorf("failed to compact write-ahead log: %w", err)
+	}
+
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	w.file = file
+	w.appended = 0
+	return nil
+}
+
+// writeFileSync writes the data to the file and syncs it to disk.
+func writeFileSync(name string, data []byte) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// replayWriteAheadLog completes the writes that were pending when the archiver last stopped, by fetching the blobs of
+// every pending block from the beacon node again and overwriting whatever was stored for it, which may be a partially
+// written object. Blocks the beacon node no longer has are discarded. Writes that still fail are left pending for the
+// next start. It returns the headers of the completed blocks: as the archiver writes blocks from the newest down, the
+// blocks below them may be missing too, see Start.
+func (a *Archiver) replayWriteAheadLog(ctx context.Context) []*v1.BeaconBlockHeader {
+	pending := a.wal.pendingWrites()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	a.log.Info("completing writes interrupted by the last shutdown", "count", len(pending))
+
+	var completed []*v1.BeaconBlockHeader
+	for _, entry := range pending {
+		attemptCtx := withPersistAttempt(ctx)
+		header, _, err := retry.Do2(ctx, walReplayMaximumRetries, retry.Exponential(), func() (*v1.BeaconBlockHeader, bool, error) {
+			header, exists, err := a.persistBlobsForBlockToS3(attemptCtx, entry.Root.String(), true)
+			if isNotFound(err) {
+				// The block was reorged out or pruned by the beacon node, there is nothing to complete
+				return nil, false, nil
+			}
+			return header, exists, err
+		})
+
+		if err != nil {
+			a.log.Error("failed to complete interrupted write, will retry on next start", "err", err, "hash", entry.Root, "slot", entry.Slot)
+			continue
+		}
+
+		if header == nil {
+			a.log.Warn("discarding interrupted write of block unknown to the beacon node", "hash", entry.Root, "slot", entry.Slot)
+		} else {
+			a.log.Info("completed interrupted write", "hash", entry.Root, "slot", entry.Slot)
+			completed = append(completed, header)
+		}
+
+		// Blocks that were skipped, e.g. as they are now filtered out, were never written again
+		if err := a.wal.commit(entry.Root); err != nil {
+			a.log.Warn("failed to record completed write", "err", err, "hash", entry.Root)
+		}
+	}
+
+	return completed
+}
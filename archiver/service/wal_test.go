@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAheadLog_PendingWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	w, err := openWriteAheadLog(path)
+	require.NoError(t, err)
+	require.Empty(t, w.pendingWrites())
+
+	require.NoError(t, w.begin(common.Hash{1}, 1))
+	require.NoError(t, w.begin(common.Hash{2}, 2))
+	require.NoError(t, w.begin(common.Hash{3}, 3))
+	require.NoError(t, w.commit(common.Hash{2}))
+	require.NoError(t, w.commit(common.Hash{4}))
+
+	// A crash while appending leaves an incomplete line
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"commit","root":"0x01`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reopened, err := openWriteAheadLog(path)
+	require.NoError(t, err)
+	require.Equal(t, []walEntry{
+		{Op: walOpBegin, Root: common.Hash{3}, Slot: 3},
+		{Op: walOpBegin, Root: common.Hash{1}, Slot: 1},
+	}, reopened.pendingWrites())
+
+	// Reopening compacts the log to the pending writes
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "\n"))
+
+	require.NoError(t, reopened.commit(common.Hash{1}))
+	require.NoError(t, reopened.commit(common.Hash{3}))
+	require.NoError(t, reopened.close())
+
+	reopened, err = openWriteAheadLog(path)
+	require.NoError(t, err)
+	require.Empty(t, reopened.pendingWrites())
+}
+
+func TestWriteAheadLog_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	w, err := openWriteAheadLog(path)
+	require.NoError(t, err)
+	require.NoError(t, w.begin(common.Hash{1}, 1))
+
+	for i := 0; i < walCompactThreshold; i++ {
+		require.NoError(t, w.begin(common.Hash{2}, 2))
+		require.NoError(t, w.commit(common.Hash{2}))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Less(t, strings.Count(string(data), "\n"), walCompactThreshold)
+
+	reopened, err := openWriteAheadLog(path)
+	require.NoError(t, err)
+	require.Equal(t, []walEntry{{Op: walOpBegin, Root: common.Hash{1}, Slot: 1}}, reopened.pendingWrites())
+}
+
+var errCrash = errors.New("crash")
+
+// crashingStorage simulates the archiver crashing while writing the blobs of a block, leaving a partially written
+// object behind.
+type crashingStorage struct {
+	*storage.FileStorage
+	dir     string
+	crashAt common.Hash
+}
+
+func (s *crashingStorage) Write(ctx context.Context, data storage.BlobData) error {
+	if data.Header.BeaconBlockHash != s.crashAt {
+		return s.FileStorage.Write(ctx, data)
+	}
+
+	b, err := storage.EncodeBlobData(data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(s.dir, s.crashAt.String()), b[:len(b)/2], 0644); err != nil {
+		return err
+	}
+
+	panic(errCrash)
+}
+
+func (s *crashingStorage) WriteIfNotExists(ctx context.Context, data storage.BlobData) error {
+	if data.Header.BeaconBlockHash != s.crashAt {
+		return s.FileStorage.WriteIfNotExists(ctx, data)
+	}
+
+	return s.Write(ctx, data)
+}
+
+func TestArchiver_CompletesWritesInterruptedByCrash(t *testing.T) {
+	beacon := &beacontest.StubRangeBeaconClient{StubBeaconClient: beacontest.NewDefaultStubBeaconClient(t)}
+	l := testlog.Logger(t, log.LvlInfo)
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(dir, l)
+	cfg := flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		Backfill: flags.BackfillConfig{
+			Strategy:  flags.BackfillStrategySlotRange,
+			RangeSize: 4,
+		},
+		WALPath: filepath.Join(t.TempDir(), "wal"),
+	}
+
+	crashing, err := NewArchiver(l, cfg, &crashingStorage{FileStorage: fs, dir: dir, crashAt: blobtest.Three}, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	// The range of slots 11-14 is written newest first, and the archiver crashes while writing the block at slot 13
+	func() {
+		defer func() {
+			require.Equal(t, errCrash, recover())
+		}()
+		crashing.backfillBlobs(context.Background(), beacon.Headers[blobtest.Five.String()])
+	}()
+
+	_, err = fs.Read(context.Background(), blobtest.Four)
+	require.NoError(t, err)
+	_, err = fs.Read(context.Background(), blobtest.Three)
+	require.ErrorIs(t, err, storage.ErrMarshaling)
+	for _, hash := range []common.Hash{blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		exists, err := fs.Exists(context.Background(), hash)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+
+	// On restart, the interrupted write is completed, and the backfill resumed from it
+	svc, err := NewArchiver(l, cfg, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	interrupted := svc.replayWriteAheadLog(context.Background())
+	require.Len(t, interrupted, 1)
+	require.Equal(t, blobtest.Three, common.Hash(interrupted[0].Root))
+	require.Empty(t, svc.wal.pendingWrites())
+
+	for _, header := range interrupted {
+		svc.backfillBlobs(context.Background(), header)
+	}
+
+	for _, hash := range []common.Hash{blobtest.Four, blobtest.Three, blobtest.Two, blobtest.One, blobtest.OriginBlock} {
+		data, err := fs.Read(context.Background(), hash)
+		require.NoError(t, err)
+		require.Equal(t, beacon.Blobs[hash.String()], data.BlobSidecars.Data)
+	}
+
+	require.NoError(t, svc.Stop(context.Background()))
+
+	reopened, err := openWriteAheadLog(cfg.WALPath)
+	require.NoError(t, err)
+	require.Empty(t, reopened.pendingWrites())
+}
+
+func TestArchiver_DiscardsInterruptedWriteOfUnknownBlock(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storage.NewFileStorage(t.TempDir(), l)
+	cfg := flags.ArchiverConfig{
+		PollInterval: 5 * time.Second,
+		OriginBlock:  blobtest.OriginBlock,
+		WALPath:      filepath.Join(t.TempDir(), "wal"),
+	}
+
+	w, err := openWriteAheadLog(cfg.WALPath)
+	require.NoError(t, err)
+	require.NoError(t, w.begin(common.Hash{0xff}, 16))
+	require.NoError(t, w.close())
+
+	svc, err := NewArchiver(l, cfg, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	require.Empty(t, svc.replayWriteAheadLog(context.Background()))
+	require.Empty(t, svc.wal.pendingWrites())
+}
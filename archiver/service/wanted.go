@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// wantedFailures counts the failed attempts to fetch each block of the wanted queue, so that blocks stored after
+// failing before are recorded as recovered.
+type wantedFailures struct {
+	mu       sync.Mutex
+	attempts map[common.Hash]int
+}
+
+// retain forgets the blocks that are no longer queued.
+func (w *wantedFailures) retain(queued []common.Hash) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	attempts := make(map[common.Hash]int)
+	for _, hash := range queued {
+		if n, ok := w.attempts[hash]; ok {
+			attempts[hash] = n
+		}
+	}
+	w.attempts = attempts
+}
+
+// failed records a failed attempt, and returns the number of failed attempts so far.
+func (w *wantedFailures) failed(hash common.Hash) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.attempts[hash]++
+	return w.attempts[hash]
+}
+
+// remove forgets the block, and returns the number of failed attempts before it.
+func (w *wantedFailures) remove(hash common.Hash) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.attempts[hash]
+	delete(w.attempts, hash)
+	return n
+}
+
+func (a *Archiver) wantedLoop(ctx context.Context) {
+	t := time.NewTicker(a.cfg.WantedInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.stopCh:
+			return
+		case <-t.C:
+			a.fetchWanted(ctx)
+		}
+	}
+}
+
+// fetchWanted fetches the blocks of the wanted queue, which the API records blocks it couldn't find in, WantedConcurrency
+// at a time. Blocks are removed from the queue once they are stored, or if the beacon node doesn't know them, e.g. as
+// they were requested by the hash of a block that doesn't exist. Blocks that fail to be fetched otherwise stay queued,
+// and are retried at the next interval, so that e.g. blocks the beacon node hadn't caught up to yet are recovered once
+// it has. Every attempt is recorded by the wanted_blocks metric.
+func (a *Archiver) fetchWanted(ctx context.Context) {
+	var wanted []common.Hash
+	err := a.wanted.ListWanted(ctx, func(hash common.Hash) error {
+		wanted = append(wanted, hash)
+		return nil
+	})
+	if err != nil {
+		a.log.Error("failed to list wanted blocks", "err", err)
+		return
+	}
+	a.wantedFailures.retain(wanted)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, a.cfg.WantedConcurrency)
+	for _, hash := range wanted {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(hash common.Hash) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			a.fetchWantedBlock(ctx, hash)
+		}(hash)
+	}
+	wg.Wait()
+}
+
+// fetchWantedBlock fetches a block of the wanted queue, and removes it from the queue unless that failed.
+func (a *Archiver) fetchWantedBlock(ctx context.Context, hash common.Hash) {
+	result, err := a.persistBlock(withBlockSource(ctx, metrics.BlockSourceWanted), hash.String(), false)
+	if err != nil && !isNotFound(err) {
+		attempts := a.wantedFailures.failed(hash)
+		a.log.Warn("failed to fetch wanted block, will retry", "err", err, "hash", hash.String(), "attempts", attempts)
+		a.metrics.RecordWantedBlock(metrics.WantedResultFailed)
+		return
+	}
+
+	failed := a.wantedFailures.remove(hash)
+	if err != nil {
+		a.log.Debug("wanted block unknown to the beacon node", "hash", hash.String())
+		a.metrics.RecordWantedBlock(metrics.WantedResultUnknown)
+	} else if result.exists {
+		a.metrics.RecordWantedBlock(metrics.WantedResultExists)
+	} else if failed > 0 {
+		a.log.Info("recovered wanted block", "hash", hash.String(), "failedAttempts", failed)
+		a.metrics.RecordProcessedBlock(metrics.BlockSourceWanted)
+		a.metrics.RecordWantedBlock(metrics.WantedResultRecovered)
+	} else {
+		a.log.Info("fetched wanted block", "hash", hash.String())
+		a.metrics.RecordProcessedBlock(metrics.BlockSourceWanted)
+		a.metrics.RecordWantedBlock(metrics.WantedResultFetched)
+	}
+
+	if err := a.wanted.DeleteWanted(ctx, hash); err != nil {
+		a.log.Warn("failed to remove wanted block", "err", err, "hash", hash.String())
+	}
+}
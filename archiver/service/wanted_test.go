@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver_FetchesWantedBlocks(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	svc, fs := setup(t, beacon)
+	svc.cfg.WantedConcurrency = 2
+
+	// The API recorded a block the archiver has a gap at, one that already got stored and one that doesn't exist
+	unknown := common.Hash{0xff}
+	fs.WriteOrFail(t, storage.BlobData{
+		Header:       storage.Header{BeaconBlockHash: blobtest.Four},
+		BlobSidecars: storage.BlobSidecars{Data: beacon.Blobs[blobtest.Four.String()]},
+	})
+	for _, hash := range []common.Hash{blobtest.Three, blobtest.Four, unknown} {
+		require.NoError(t, fs.WriteWanted(context.Background(), hash))
+	}
+
+	svc.fetchWanted(context.Background())
+
+	require.Equal(t, beacon.Blobs[blobtest.Three.String()], fs.ReadOrFail(t, blobtest.Three).BlobSidecars.Data)
+	fs.CheckNotExistsOrFail(t, unknown)
+	require.Equal(t, float64(1), metricValue(t, svc.metrics, "blob_archiver_blocks_processed"))
+	require.Equal(t, map[string]float64{"fetched": 1, "exists": 1, "unknown": 1}, counterValues(t, svc.metrics, "blob_archiver_wanted_blocks"))
+
+	// Every block was removed from the queue
+	require.NoError(t, fs.ListWanted(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected wanted block %s", hash)
+		return nil
+	}))
+}
+
+func TestArchiver_WantedBlocksStayQueuedOnFailure(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		OriginBlock:       blobtest.OriginBlock,
+		OptimisticBlocks:  flags.OptimisticBlocksRefuse,
+		WantedConcurrency: 1,
+	}, fs, beacon, metrics.NewMetrics(), nil)
+	require.NoError(t, err)
+
+	// Optimistic blocks are refused until the beacon node verified them, so the block is retried at the next interval
+	beacon.Optimistic = true
+	require.NoError(t, fs.WriteWanted(context.Background(), blobtest.Three))
+	svc.fetchWanted(context.Background())
+	svc.fetchWanted(context.Background())
+
+	fs.CheckNotExistsOrFail(t, blobtest.Three)
+	var wanted []common.Hash
+	require.NoError(t, fs.ListWanted(context.Background(), func(hash common.Hash) error {
+		wanted = append(wanted, hash)
+		return nil
+	}))
+	require.Equal(t, []common.Hash{blobtest.Three}, wanted)
+
+	// Once the beacon node verified it, the block is recovered and removed from the queue
+	beacon.Optimistic = false
+	svc.fetchWanted(context.Background())
+	fs.CheckExistsOrFail(t, blobtest.Three)
+	require.Equal(t, map[string]float64{"failed": 2, "recovered": 1}, counterValues(t, svc.metrics, "blob_archiver_wanted_blocks"))
+	require.NoError(t, fs.ListWanted(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected wanted block %s", hash)
+		return nil
+	}))
+}
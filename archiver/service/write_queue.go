@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/base-org/blob-archiver/archiver/metrics"
+)
+
+// writeQueue bounds the number of blocks whose blobs are being fetched from the beacon node or written to storage, across
+// all archiving loops. A loop acquires a place in the queue before fetching blobs and releases it once they're written,
+// so when storage is slow the loops stop fetching instead of holding ever more blobs in memory. The queue can also be
+// bounded by the size of the blob sidecars that were fetched but not yet written, which loops add once they know it.
+type writeQueue struct {
+	mu       sync.Mutex
+	depth    int
+	max      int
+	bytes    int
+	maxBytes int
+	released chan struct{}
+	metrics  metrics.Metricer
+}
+
+// newWriteQueue creates a queue holding up to max blocks, and admitting blocks while less than maxBytes are buffered. A
+// max or maxBytes of 0 doesn't limit the queue by that measure.
+func newWriteQueue(max int, maxBytes int, m metrics.Metricer) *writeQueue {
+	return &writeQueue{
+		max:      max,
+		maxBytes: maxBytes,
+		released: make(chan struct{}),
+		metrics:  m,
+	}
+}
+
+// acquire waits until there is room for n blocks in the queue and adds them. A request for more blocks than the queue
+// holds is admitted once the queue is empty, so that it can't wait forever. As the size of the blocks isn't known
+// before they're fetched, they are admitted while the buffered bytes are below the limit, so the limit may be exceeded
+// by the blocks fetched at once.
+func (q *writeQueue) acquire(ctx context.Context, n int) error {
+	for {
+		q.mu.Lock()
+		hasRoom := q.max == 0 || q.depth == 0 || q.depth+n <= q.max
+		hasBytes := q.maxBytes == 0 || q.bytes < q.maxBytes
+		if hasRoom && hasBytes {
+			q.depth += n
+			q.metrics.SetWriteQueueDepth(q.depth)
+			q.mu.Unlock()
+			return nil
+		}
+		released := q.released
+		q.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release removes n blocks from the queue.
+func (q *writeQueue) release(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.depth -= n
+	q.metrics.SetWriteQueueDepth(q.depth)
+	q.signal()
+}
+
+// addBytes adds the size of fetched blob sidecars to the buffered bytes, until they are released with releaseBytes.
+func (q *writeQueue) addBytes(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.bytes += n
+	q.metrics.SetWriteQueueBytes(q.bytes)
+}
+
+// releaseBytes removes the size of written, or dropped, blob sidecars from the buffered bytes.
+func (q *writeQueue) releaseBytes(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.bytes -= n
+	q.metrics.SetWriteQueueBytes(q.bytes)
+	q.signal()
+}
+
+// signal wakes up every acquire waiting for room in the queue. It must be called with the lock held.
+func (q *writeQueue) signal() {
+	close(q.released)
+	q.released = make(chan struct{})
+}
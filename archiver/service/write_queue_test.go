@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/archiver/flags"
+	"github.com/base-org/blob-archiver/archiver/metrics"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/common/storage/storagetest"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// slowStorage blocks every write until unblock is closed, reporting each write as it starts.
+type slowStorage struct {
+	storage.DataStore
+	started chan common.Hash
+	unblock chan struct{}
+}
+
+func (s *slowStorage) Write(ctx context.Context, data storage.BlobData) error {
+	s.started <- data.Header.BeaconBlockHash
+	<-s.unblock
+	return s.DataStore.Write(ctx, data)
+}
+
+func (s *slowStorage) WriteIfNotExists(ctx context.Context, data storage.BlobData) error {
+	s.started <- data.Header.BeaconBlockHash
+	<-s.unblock
+	return s.DataStore.WriteIfNotExists(ctx, data)
+}
+
+func TestArchiver_FetchingPausesWhileWriteQueueIsFull(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	store := &slowStorage{DataStore: fs, started: make(chan common.Hash, 2), unblock: make(chan struct{})}
+
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:     5 * time.Second,
+		OriginBlock:      blobtest.OriginBlock,
+		MaxPendingWrites: 1,
+	}, store, beacon, m, nil)
+	require.NoError(t, err)
+
+	errs := make(chan error, 2)
+	for _, hash := range []common.Hash{blobtest.Five, blobtest.Four} {
+		hash := hash
+		go func() {
+			_, _, err := svc.persistBlobsForBlockToS3(context.Background(), hash.String(), false)
+			errs <- err
+		}()
+	}
+
+	<-store.started
+
+	// While the first block is being written, the second must not be fetched
+	select {
+	case <-store.started:
+		t.Fatal("second block was written while the write queue was full")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.Len(t, beacon.SidecarRequests(), 1)
+	require.Equal(t, float64(1), metricValue(t, m, "blob_archiver_write_queue_depth"))
+
+	close(store.unblock)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	require.Len(t, beacon.SidecarRequests(), 2)
+	require.Equal(t, float64(0), metricValue(t, m, "blob_archiver_write_queue_depth"))
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckExistsOrFail(t, blobtest.Four)
+}
+
+func TestWriteQueue_AdmitsOversizedRequestWhenEmpty(t *testing.T) {
+	q := newWriteQueue(2, 0, metrics.NewMetrics())
+
+	require.NoError(t, q.acquire(context.Background(), 5))
+
+	// The queue is over its limit, so further requests wait until it drained
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.acquire(ctx, 1), context.DeadlineExceeded)
+
+	q.release(5)
+	require.NoError(t, q.acquire(context.Background(), 2))
+}
+
+func TestArchiver_FetchingPausesWhileBufferedBytesAreAtLimit(t *testing.T) {
+	beacon := beacontest.NewDefaultStubBeaconClient(t)
+	l := testlog.Logger(t, log.LvlInfo)
+	fs := storagetest.NewTestFileStorage(t, l)
+	m := metrics.NewMetrics()
+	store := &slowStorage{DataStore: fs, started: make(chan common.Hash, 2), unblock: make(chan struct{})}
+
+	five := (&storage.BlobSidecars{Data: beacon.Blobs[blobtest.Five.String()]}).SizeSSZ()
+	svc, err := NewArchiver(l, flags.ArchiverConfig{
+		PollInterval:    5 * time.Second,
+		OriginBlock:     blobtest.OriginBlock,
+		MaxPendingBytes: five,
+	}, store, beacon, m, nil)
+	require.NoError(t, err)
+
+	errs := make(chan error, 2)
+	persist := func(hash common.Hash) {
+		_, _, err := svc.persistBlobsForBlockToS3(context.Background(), hash.String(), false)
+		errs <- err
+	}
+
+	go persist(blobtest.Five)
+	<-store.started
+	require.Equal(t, float64(five), metricValue(t, m, "blob_archiver_write_queue_bytes"))
+
+	// While the blobs of the first block are buffered, the second must not be fetched, although the number of blocks
+	// isn't limited
+	go persist(blobtest.Four)
+	select {
+	case <-store.started:
+		t.Fatal("second block was written while the buffered bytes were at the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.Len(t, beacon.SidecarRequests(), 1)
+
+	close(store.unblock)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	require.Len(t, beacon.SidecarRequests(), 2)
+	require.Equal(t, float64(0), metricValue(t, m, "blob_archiver_write_queue_bytes"))
+	fs.CheckExistsOrFail(t, blobtest.Five)
+	fs.CheckExistsOrFail(t, blobtest.Four)
+}
+
+func TestWriteQueue_PausesAtByteLimit(t *testing.T) {
+	q := newWriteQueue(0, 100, metrics.NewMetrics())
+
+	require.NoError(t, q.acquire(context.Background(), 1))
+	q.addBytes(60)
+
+	// Below the limit, further blocks are admitted, although they may exceed it once fetched
+	require.NoError(t, q.acquire(context.Background(), 1))
+	q.addBytes(60)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.acquire(ctx, 1), context.DeadlineExceeded)
+
+	q.releaseBytes(60)
+	q.release(1)
+	require.NoError(t, q.acquire(context.Background(), 1))
+}
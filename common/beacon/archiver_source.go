@@ -0,0 +1,76 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+)
+
+// BlobArchiverSource is a Client that fetches blob sidecars from the API of another blob-archiver, which serves them in
+// the same format as a beacon node, instead of the beacon node. This allows archivers to replicate from each other
+// without loading the beacon node with blob requests. Headers and the chain's parameters are still fetched from the
+// beacon node, as the blob-archiver API doesn't serve them, and blocks without blobs can't be walked by their sidecars.
+type BlobArchiverSource struct {
+	Client
+	url        string
+	httpClient *http.Client
+}
+
+func NewBlobArchiverSource(c Client, url string, timeout time.Duration) *BlobArchiverSource {
+	return &BlobArchiverSource{
+		Client:     c,
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// BlobSidecars fetches the blob sidecars of a block from the other blob-archiver. Error responses are returned as an
+// *api.Error, like the beacon client does, so that callers can handle a block the other blob-archiver doesn't have.
+func (s *BlobArchiverSource) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	endpoint := fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", opts.Block)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blob sidecars from blob-archiver: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob sidecars from blob-archiver: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &api.Error{
+			Method:     http.MethodGet,
+			Endpoint:   endpoint,
+			StatusCode: resp.StatusCode,
+			Data:       body,
+		}
+	}
+
+	var result struct {
+		Data []*deneb.BlobSidecar `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode blob sidecars from blob-archiver: %w", err)
+	}
+
+	return &api.Response[[]*deneb.BlobSidecar]{
+		Data:     result.Data,
+		Metadata: map[string]any{},
+	}, nil
+}
@@ -0,0 +1,81 @@
+package beacon_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newPeer starts a server serving the blob sidecars of the stub in the format of the blob-archiver API.
+func newPeer(t *testing.T, stub *beacontest.StubBeaconClient) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, found := strings.CutPrefix(r.URL.Path, "/eth/v1/beacon/blob_sidecars/")
+		sidecars, exists := stub.Blobs[id]
+		if !found || !exists {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"Block not found"}`))
+			return
+		}
+
+		require.Equal(t, "application/json", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(storage.BlobSidecars{Data: sidecars}))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBlobArchiverSource(t *testing.T) {
+	peerStub := beacontest.NewDefaultStubBeaconClient(t)
+	peer := newPeer(t, peerStub)
+
+	// The beacon node only serves headers, so all sidecars must come from the peer
+	beaconStub := beacontest.NewDefaultStubBeaconClient(t)
+	beaconStub.Blobs = nil
+	source := beacon.NewBlobArchiverSource(beaconStub, peer.URL+"/", time.Second)
+
+	t.Run("sidecars from the peer", func(t *testing.T) {
+		for _, id := range []string{blobtest.Five.String(), blobtest.Two.String(), "head"} {
+			resp, err := source.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: id})
+			require.NoError(t, err)
+			require.Equal(t, peerStub.Blobs[id], resp.Data)
+		}
+	})
+
+	t.Run("headers from the beacon node", func(t *testing.T) {
+		resp, err := source.BeaconBlockHeader(context.Background(), &api.BeaconBlockHeaderOpts{Block: "head"})
+		require.NoError(t, err)
+		require.Equal(t, beaconStub.Headers["head"], resp.Data)
+		require.Empty(t, beaconStub.SidecarRequests())
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		_, err := source.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: blobtest.OriginBlock.Hex() + "00"})
+
+		var apiErr *api.Error
+		require.True(t, errors.As(err, &apiErr))
+		require.Equal(t, 404, apiErr.StatusCode)
+		require.Equal(t, "/eth/v1/beacon/blob_sidecars/"+blobtest.OriginBlock.Hex()+"00", apiErr.Endpoint)
+	})
+
+	t.Run("unreachable peer", func(t *testing.T) {
+		unreachable := beacon.NewBlobArchiverSource(beaconStub, "http://127.0.0.1:0", time.Second)
+		_, err := unreachable.BlobSidecars(context.Background(), &api.BlobSidecarsOpts{Block: "head"})
+		require.Error(t, err)
+
+		var apiErr *api.Error
+		require.False(t, errors.As(err, &apiErr))
+	})
+}
@@ -0,0 +1,52 @@
+package beacontest
+
+import (
+	"math/big"
+	"testing"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/stretchr/testify/require"
+)
+
+// AddValidator adds a validator whose public key is that of the secret key to the validators of the stub.
+func (s *StubBeaconClient) AddValidator(index phase0.ValidatorIndex, secretKey *big.Int) {
+	var pubkey bls12381.G1Affine
+	pubkey.ScalarMultiplicationBase(secretKey)
+
+	s.ValidatorSet[index] = &v1.Validator{
+		Index:     index,
+		Validator: &phase0.Validator{PublicKey: phase0.BLSPubKey(pubkey.Bytes())},
+	}
+}
+
+// SignHeader sets the root of the header to that of its message, and signs it with the secret key as the proposer of
+// the block would, for the fork schedule and genesis validators root of the stub.
+func (s *StubBeaconClient) SignHeader(t *testing.T, header *v1.BeaconBlockHeader, secretKey *big.Int) {
+	root, err := header.Header.Message.HashTreeRoot()
+	require.NoError(t, err)
+	header.Root = root
+
+	epoch := phase0.Epoch(uint64(header.Header.Message.Slot) / s.SpecValues["SLOTS_PER_EPOCH"].(uint64))
+	fork := s.Forks[0]
+	for _, f := range s.Forks {
+		if f.Epoch <= epoch {
+			fork = f
+		}
+	}
+
+	domain, err := beacon.ComputeDomain(beacon.DomainBeaconProposer, fork.CurrentVersion, s.GenesisValidatorsRoot)
+	require.NoError(t, err)
+
+	signingRoot, err := (&phase0.SigningData{ObjectRoot: root, Domain: domain}).HashTreeRoot()
+	require.NoError(t, err)
+
+	hashed, err := bls12381.HashToG2(signingRoot[:], beacon.SignatureDST)
+	require.NoError(t, err)
+
+	var signature bls12381.G2Affine
+	signature.ScalarMultiplication(&hashed, secretKey)
+	header.Header.Signature = phase0.BLSSignature(signature.Bytes())
+}
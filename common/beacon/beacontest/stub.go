@@ -3,46 +3,174 @@ package beacontest
 import (
 	"context"
 	"fmt"
+	"math"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
 	"github.com/base-org/blob-archiver/common/blobtest"
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// notFound returns the error the beacon client returns when the beacon node responds with a 404.
+func notFound(endpoint string) error {
+	return &api.Error{
+		Method:     "GET",
+		Endpoint:   endpoint,
+		StatusCode: 404,
+		Data:       []byte("block not found"),
+	}
+}
+
 type StubBeaconClient struct {
 	Headers map[string]*v1.BeaconBlockHeader
 	Blobs   map[string][]*deneb.BlobSidecar
+	// Blocks are the full blocks returned by SignedBeaconBlock. The default stub has none.
+	Blocks map[string]*spec.VersionedSignedBeaconBlock
+	// HeaderRequests and BlobSidecarsRequests record the block identifier of every header and blob sidecars request.
+	HeaderRequests       []string
+	BlobSidecarsRequests []string
+	// GenesisTime and SpecValues are returned by Genesis and Spec.
+	GenesisTime time.Time
+	SpecValues  map[string]any
+	// GenesisValidatorsRoot is returned by Genesis, Forks by ForkSchedule and ValidatorSet by Validators, see AddValidator.
+	GenesisValidatorsRoot phase0.Root
+	Forks                 []*phase0.Fork
+	ValidatorSet          map[phase0.ValidatorIndex]*v1.Validator
+	// ValidatorsRequests counts the requests to Validators.
+	ValidatorsRequests int
+	// Optimistic marks every header and blob sidecars response as execution optimistic and not finalized.
+	Optimistic bool
+	mu         sync.Mutex
+}
+
+// metadata returns the metadata of a header or blob sidecars response.
+func (s *StubBeaconClient) metadata() map[string]any {
+	return map[string]any{
+		"execution_optimistic": s.Optimistic,
+		"finalized":            false,
+	}
 }
 
 func (s *StubBeaconClient) BeaconBlockHeader(ctx context.Context, opts *api.BeaconBlockHeaderOpts) (*api.Response[*v1.BeaconBlockHeader], error) {
+	s.mu.Lock()
+	s.HeaderRequests = append(s.HeaderRequests, opts.Block)
+	s.mu.Unlock()
+
 	header, found := s.Headers[opts.Block]
 	if !found {
-		return nil, fmt.Errorf("block not found")
+		return nil, notFound(fmt.Sprintf("/eth/v1/beacon/headers/%s", opts.Block))
 	}
 	return &api.Response[*v1.BeaconBlockHeader]{
-		Data: header,
+		Data:     header,
+		Metadata: s.metadata(),
 	}, nil
 }
 
 func (s *StubBeaconClient) BlobSidecars(ctx context.Context, opts *api.BlobSidecarsOpts) (*api.Response[[]*deneb.BlobSidecar], error) {
+	s.mu.Lock()
+	s.BlobSidecarsRequests = append(s.BlobSidecarsRequests, opts.Block)
+	s.mu.Unlock()
+
 	blobs, found := s.Blobs[opts.Block]
 	if !found {
-		return nil, fmt.Errorf("block not found")
+		return nil, notFound(fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%s", opts.Block))
 	}
 	return &api.Response[[]*deneb.BlobSidecar]{
-		Data: blobs,
+		Data:     blobs,
+		Metadata: s.metadata(),
+	}, nil
+}
+
+func (s *StubBeaconClient) SignedBeaconBlock(ctx context.Context, opts *api.SignedBeaconBlockOpts) (*api.Response[*spec.VersionedSignedBeaconBlock], error) {
+	block, found := s.Blocks[opts.Block]
+	if !found {
+		return nil, notFound(fmt.Sprintf("/eth/v2/beacon/blocks/%s", opts.Block))
+	}
+	return &api.Response[*spec.VersionedSignedBeaconBlock]{
+		Data:     block,
+		Metadata: s.metadata(),
+	}, nil
+}
+
+func (s *StubBeaconClient) Genesis(ctx context.Context, opts *api.GenesisOpts) (*api.Response[*v1.Genesis], error) {
+	return &api.Response[*v1.Genesis]{
+		Data: &v1.Genesis{GenesisTime: s.GenesisTime, GenesisValidatorsRoot: s.GenesisValidatorsRoot},
+	}, nil
+}
+
+func (s *StubBeaconClient) Spec(ctx context.Context, opts *api.SpecOpts) (*api.Response[map[string]any], error) {
+	return &api.Response[map[string]any]{
+		Data: s.SpecValues,
+	}, nil
+}
+
+func (s *StubBeaconClient) ForkSchedule(ctx context.Context, opts *api.ForkScheduleOpts) (*api.Response[[]*phase0.Fork], error) {
+	return &api.Response[[]*phase0.Fork]{
+		Data: s.Forks,
+	}, nil
+}
+
+func (s *StubBeaconClient) Validators(ctx context.Context, opts *api.ValidatorsOpts) (*api.Response[map[phase0.ValidatorIndex]*v1.Validator], error) {
+	s.mu.Lock()
+	s.ValidatorsRequests++
+	s.mu.Unlock()
+
+	validators := make(map[phase0.ValidatorIndex]*v1.Validator)
+	for _, index := range opts.Indices {
+		if validator, ok := s.ValidatorSet[index]; ok {
+			validators[index] = validator
+		}
+	}
+	return &api.Response[map[phase0.ValidatorIndex]*v1.Validator]{
+		Data: validators,
 	}, nil
 }
 
+// defaultForks returns the fork schedule of a stub, a single fork from genesis with the version of deneb.
+func defaultForks() []*phase0.Fork {
+	return []*phase0.Fork{{PreviousVersion: phase0.Version{4}, CurrentVersion: phase0.Version{4}}}
+}
+
+// defaultSpecValues returns the spec values of a stub, those of mainnet before electra was scheduled.
+func defaultSpecValues() map[string]any {
+	return map[string]any{
+		"SECONDS_PER_SLOT":            12 * time.Second,
+		"SLOTS_PER_EPOCH":             uint64(32),
+		"DENEB_FORK_EPOCH":            uint64(269568),
+		"DENEB_FORK_VERSION":          phase0.Version{4},
+		"MAX_BLOBS_PER_BLOCK":         uint64(6),
+		"ELECTRA_FORK_EPOCH":          uint64(math.MaxUint64),
+		"ELECTRA_FORK_VERSION":        phase0.Version{5},
+		"MAX_BLOBS_PER_BLOCK_ELECTRA": uint64(9),
+
+		"MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS": uint64(4096),
+	}
+}
+
+// SidecarRequests returns a copy of BlobSidecarsRequests, which is safe to call while requests are being made.
+func (s *StubBeaconClient) SidecarRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.BlobSidecarsRequests...)
+}
+
 func NewEmptyStubBeaconClient() *StubBeaconClient {
 	return &StubBeaconClient{
-		Headers: make(map[string]*v1.BeaconBlockHeader),
-		Blobs:   make(map[string][]*deneb.BlobSidecar),
+		Headers:      make(map[string]*v1.BeaconBlockHeader),
+		Blobs:        make(map[string][]*deneb.BlobSidecar),
+		Blocks:       make(map[string]*spec.VersionedSignedBeaconBlock),
+		SpecValues:   defaultSpecValues(),
+		Forks:        defaultForks(),
+		ValidatorSet: make(map[phase0.ValidatorIndex]*v1.Validator),
 	}
 }
 
@@ -68,7 +196,7 @@ func NewDefaultStubBeaconClient(t *testing.T) *StubBeaconClient {
 	fourBlobs := blobtest.NewBlobSidecars(t, 5)
 	fiveBlobs := blobtest.NewBlobSidecars(t, 6)
 
-	return &StubBeaconClient{
+	stub := &StubBeaconClient{
 		Headers: map[string]*v1.BeaconBlockHeader{
 			// Lookup by hash
 			blobtest.OriginBlock.String(): makeHeader(startSlot, blobtest.OriginBlock, common.Hash{9, 9, 9}),
@@ -111,5 +239,52 @@ func NewDefaultStubBeaconClient(t *testing.T) *StubBeaconClient {
 			strconv.FormatUint(startSlot+4, 10): fourBlobs,
 			strconv.FormatUint(startSlot+5, 10): fiveBlobs,
 		},
+		Blocks:       make(map[string]*spec.VersionedSignedBeaconBlock),
+		SpecValues:   defaultSpecValues(),
+		Forks:        defaultForks(),
+		ValidatorSet: make(map[phase0.ValidatorIndex]*v1.Validator),
+	}
+
+	// Sidecars embed the header of the block they belong to
+	for _, hash := range []common.Hash{blobtest.OriginBlock, blobtest.One, blobtest.Two, blobtest.Three, blobtest.Four, blobtest.Five} {
+		for _, sidecar := range stub.Blobs[hash.String()] {
+			sidecar.SignedBlockHeader = stub.Headers[hash.String()].Header
+		}
 	}
+
+	return stub
+}
+
+// StubRangeBeaconClient is a StubBeaconClient that can also serve ranges of slots, from the headers and blobs that are
+// looked up by slot. If Unsupported is set, range requests fail as they would against a beacon node without the
+// endpoint.
+type StubRangeBeaconClient struct {
+	*StubBeaconClient
+	Unsupported   bool
+	RangeRequests int
+}
+
+func (s *StubRangeBeaconClient) BlobSidecarsRange(ctx context.Context, startSlot phase0.Slot, count uint64) ([]*beacon.BlockBlobSidecars, error) {
+	s.RangeRequests++
+
+	if s.Unsupported {
+		return nil, notFound(fmt.Sprintf("/eth/v1/beacon/blob_sidecars?start_slot=%d&count=%d", startSlot, count))
+	}
+
+	var result []*beacon.BlockBlobSidecars
+	for slot := uint64(startSlot); slot < uint64(startSlot)+count; slot++ {
+		id := strconv.FormatUint(slot, 10)
+
+		header, found := s.Headers[id]
+		if !found {
+			continue
+		}
+
+		result = append(result, &beacon.BlockBlobSidecars{
+			Header:   header,
+			Sidecars: s.Blobs[id],
+		})
+	}
+
+	return result, nil
 }
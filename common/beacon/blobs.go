@@ -0,0 +1,105 @@
+package beacon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// farFutureEpoch is the epoch of forks that are not scheduled.
+const farFutureEpoch = math.MaxUint64
+
+// ErrIncompatibleSpec is returned when the spec of a beacon node lacks what the archiver needs, e.g. because the chain
+// or the node predates the deneb fork.
+var ErrIncompatibleSpec = errors.New("incompatible beacon node spec")
+
+// BlobLimits are the maximum number of blobs per block of each fork that carries blobs.
+type BlobLimits struct {
+	SlotsPerEpoch uint64
+	// Deneb is the maximum from the deneb fork onwards.
+	Deneb uint64
+	// Electra is the maximum from ElectraForkEpoch onwards.
+	Electra          uint64
+	ElectraForkEpoch uint64
+}
+
+// NewBlobLimits fetches the maximum number of blobs per block of each fork from the spec of the chain. Electra is
+// treated as not scheduled if the spec doesn't include it. ErrIncompatibleSpec is returned if the spec lacks the
+// constants of the deneb fork.
+func NewBlobLimits(ctx context.Context, c client.SpecProvider) (BlobLimits, error) {
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return BlobLimits{}, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	value := func(name string) (uint64, bool, error) {
+		raw, ok := spec.Data[name]
+		if !ok {
+			return 0, false, nil
+		}
+
+		v, ok := raw.(uint64)
+		if !ok {
+			return 0, false, fmt.Errorf("invalid %s in spec: %v", name, raw)
+		}
+
+		return v, true, nil
+	}
+
+	required := func(name string) (uint64, error) {
+		v, ok, err := value(name)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: %s is missing", ErrIncompatibleSpec, name)
+		} else if err == nil && v == 0 {
+			err = fmt.Errorf("invalid %s in spec: %v", name, spec.Data[name])
+		}
+		return v, err
+	}
+
+	limits := BlobLimits{ElectraForkEpoch: farFutureEpoch}
+
+	if limits.SlotsPerEpoch, err = required("SLOTS_PER_EPOCH"); err != nil {
+		return BlobLimits{}, err
+	}
+
+	if limits.Deneb, err = required("MAX_BLOBS_PER_BLOCK"); err != nil {
+		return BlobLimits{}, err
+	}
+
+	electraForkEpoch, scheduled, err := value("ELECTRA_FORK_EPOCH")
+	if err != nil {
+		return BlobLimits{}, err
+	}
+
+	if scheduled && electraForkEpoch != farFutureEpoch {
+		limits.ElectraForkEpoch = electraForkEpoch
+		if limits.Electra, err = required("MAX_BLOBS_PER_BLOCK_ELECTRA"); err != nil {
+			return BlobLimits{}, err
+		}
+	}
+
+	return limits, nil
+}
+
+// FixedBlobLimits returns limits allowing at most maxBlobs blobs per block regardless of the fork.
+func FixedBlobLimits(maxBlobs uint64) BlobLimits {
+	return BlobLimits{
+		SlotsPerEpoch:    1,
+		Deneb:            maxBlobs,
+		ElectraForkEpoch: farFutureEpoch,
+	}
+}
+
+// MaxBlobs returns the maximum number of blobs a block at the slot may carry.
+func (l BlobLimits) MaxBlobs(slot phase0.Slot) uint64 {
+	if uint64(slot)/l.SlotsPerEpoch >= l.ElectraForkEpoch {
+		return l.Electra
+	}
+
+	return l.Deneb
+}
@@ -0,0 +1,117 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+)
+
+// ChainProvider is implemented by clients that can provide the genesis and spec of the chain.
+type ChainProvider interface {
+	client.GenesisProvider
+	client.SpecProvider
+}
+
+// Clock is the source of the current time of slot-time computations, so that they can be tested with a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the system's wall-clock time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SlotClock computes the time of slots from the genesis time and slot duration of the chain, and the current slot from
+// its Clock. All slot-time computations should go through it. A nil Clock is the SystemClock.
+type SlotClock struct {
+	GenesisTime    time.Time
+	SecondsPerSlot time.Duration
+	SlotsPerEpoch  uint64
+	Clock          Clock
+}
+
+// NewSlotClock fetches the genesis time, slot duration and epoch length of the chain from the beacon node.
+func NewSlotClock(ctx context.Context, c ChainProvider, clock Clock) (SlotClock, error) {
+	genesis, err := c.Genesis(ctx, &api.GenesisOpts{})
+	if err != nil {
+		return SlotClock{}, fmt.Errorf("failed to fetch genesis: %w", err)
+	}
+
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return SlotClock{}, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	secondsPerSlot, ok := spec.Data["SECONDS_PER_SLOT"].(time.Duration)
+	if !ok || secondsPerSlot <= 0 {
+		return SlotClock{}, fmt.Errorf("invalid SECONDS_PER_SLOT in spec: %v", spec.Data["SECONDS_PER_SLOT"])
+	}
+
+	slotsPerEpoch, ok := spec.Data["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || slotsPerEpoch == 0 {
+		return SlotClock{}, fmt.Errorf("invalid SLOTS_PER_EPOCH in spec: %v", spec.Data["SLOTS_PER_EPOCH"])
+	}
+
+	return SlotClock{
+		GenesisTime:    genesis.Data.GenesisTime,
+		SecondsPerSlot: secondsPerSlot,
+		SlotsPerEpoch:  slotsPerEpoch,
+		Clock:          clock,
+	}, nil
+}
+
+// FetchSlotClock is NewSlotClock, retried with an exponential backoff up to maxAttempts times, for fetching the slot
+// clock at startup while the beacon node may not be ready yet.
+func FetchSlotClock(ctx context.Context, c ChainProvider, clock Clock, maxAttempts int) (SlotClock, error) {
+	return retry.Do(ctx, maxAttempts, retry.Exponential(), func() (SlotClock, error) {
+		return NewSlotClock(ctx, c, clock)
+	})
+}
+
+func (c SlotClock) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// SlotTime returns the start time of the slot.
+func (c SlotClock) SlotTime(slot phase0.Slot) time.Time {
+	return c.GenesisTime.Add(time.Duration(slot) * c.SecondsPerSlot)
+}
+
+// SlotAt returns the slot in progress at the given time, or slot 0 before genesis.
+func (c SlotClock) SlotAt(t time.Time) phase0.Slot {
+	if !t.After(c.GenesisTime) {
+		return 0
+	}
+	return phase0.Slot(t.Sub(c.GenesisTime) / c.SecondsPerSlot)
+}
+
+// CurrentSlot returns the slot in progress according to the Clock.
+func (c SlotClock) CurrentSlot() phase0.Slot {
+	return c.SlotAt(c.now())
+}
+
+// SlotAge returns how long ago the slot started according to the Clock, negative for future slots.
+func (c SlotClock) SlotAge(slot phase0.Slot) time.Duration {
+	return c.now().Sub(c.SlotTime(slot))
+}
+
+// EpochStartSlot returns the first slot of the epoch, e.g. the first slot of a fork scheduled for the epoch.
+func (c SlotClock) EpochStartSlot(epoch phase0.Epoch) phase0.Slot {
+	return phase0.Slot(uint64(epoch) * c.SlotsPerEpoch)
+}
+
+// EpochOf returns the epoch of the slot.
+func (c SlotClock) EpochOf(slot phase0.Slot) phase0.Epoch {
+	return phase0.Epoch(uint64(slot) / c.SlotsPerEpoch)
+}
@@ -0,0 +1,86 @@
+package beacon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotClock(t *testing.T) {
+	stub := beacontest.NewEmptyStubBeaconClient()
+	stub.GenesisTime = time.Unix(1606824023, 0)
+	clock := beacontest.NewFakeClock(stub.GenesisTime)
+
+	slotClock, err := beacon.NewSlotClock(context.Background(), stub, clock)
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Second, slotClock.SecondsPerSlot)
+	require.Equal(t, uint64(32), slotClock.SlotsPerEpoch)
+
+	// A fork scheduled for epoch 10 activates at slot 320
+	fork := slotClock.EpochStartSlot(10)
+	require.Equal(t, phase0.Slot(320), fork)
+	require.Equal(t, stub.GenesisTime.Add(320*12*time.Second), slotClock.SlotTime(fork))
+	require.Equal(t, phase0.Epoch(9), slotClock.EpochOf(fork-1))
+	require.Equal(t, phase0.Epoch(10), slotClock.EpochOf(fork))
+
+	tests := []struct {
+		name string
+		now  time.Time
+		slot phase0.Slot
+	}{
+		{name: "before genesis", now: stub.GenesisTime.Add(-time.Hour), slot: 0},
+		{name: "at genesis", now: stub.GenesisTime, slot: 0},
+		{name: "last instant before the fork", now: slotClock.SlotTime(fork).Add(-time.Nanosecond), slot: fork - 1},
+		{name: "start of the fork", now: slotClock.SlotTime(fork), slot: fork},
+		{name: "within the first slot of the fork", now: slotClock.SlotTime(fork).Add(11 * time.Second), slot: fork},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock.Set(test.now)
+			require.Equal(t, test.slot, slotClock.CurrentSlot())
+		})
+	}
+
+	clock.Set(slotClock.SlotTime(fork))
+	require.Equal(t, time.Duration(0), slotClock.SlotAge(fork))
+	require.Equal(t, 12*time.Second, slotClock.SlotAge(fork-1))
+
+	clock.Advance(time.Minute)
+	require.Equal(t, time.Minute, slotClock.SlotAge(fork))
+	require.Equal(t, -12*time.Second, slotClock.SlotAge(fork+6))
+}
+
+// failingChainProvider fails to provide the genesis a number of times before succeeding.
+type failingChainProvider struct {
+	*beacontest.StubBeaconClient
+	failures int
+}
+
+func (p *failingChainProvider) Genesis(ctx context.Context, opts *api.GenesisOpts) (*api.Response[*v1.Genesis], error) {
+	if p.failures > 0 {
+		p.failures--
+		return nil, errors.New("beacon node not ready")
+	}
+	return p.StubBeaconClient.Genesis(ctx, opts)
+}
+
+func TestFetchSlotClock(t *testing.T) {
+	stub := beacontest.NewEmptyStubBeaconClient()
+	stub.GenesisTime = time.Unix(1606824023, 0)
+
+	slotClock, err := beacon.FetchSlotClock(context.Background(), &failingChainProvider{StubBeaconClient: stub, failures: 2}, beacon.SystemClock{}, 3)
+	require.NoError(t, err)
+	require.Equal(t, stub.GenesisTime, slotClock.GenesisTime)
+
+	_, err = beacon.FetchSlotClock(context.Background(), &failingChainProvider{StubBeaconClient: stub, failures: 3}, beacon.SystemClock{}, 3)
+	require.Error(t, err)
+}
@@ -0,0 +1,163 @@
+package beacon
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum-optimism/optimism/op-service/retry"
+)
+
+// ForkProvider is implemented by clients that can provide the spec and fork schedule of the chain.
+type ForkProvider interface {
+	client.SpecProvider
+	client.ForkScheduleProvider
+}
+
+// Fork is a fork of the fork schedule of the chain, as seen by the beacon node.
+type Fork struct {
+	// Name is the lower case name of the fork, e.g. "deneb", or empty if the spec doesn't name its version.
+	Name      string
+	Version   phase0.Version
+	Epoch     phase0.Epoch
+	StartSlot phase0.Slot
+}
+
+// NewForkSchedule fetches the fork schedule of the chain, in order of activation. Forks are named by matching their
+// version against the <FORK>_FORK_VERSION constants of the spec, the version of the genesis fork being "phase0".
+func NewForkSchedule(ctx context.Context, c ForkProvider) ([]Fork, error) {
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	schedule, err := c.ForkSchedule(ctx, &api.ForkScheduleOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fork schedule: %w", err)
+	}
+
+	if len(schedule.Data) == 0 {
+		return nil, errors.New("empty fork schedule")
+	}
+
+	slotsPerEpoch, ok := spec.Data["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || slotsPerEpoch == 0 {
+		return nil, fmt.Errorf("invalid SLOTS_PER_EPOCH in spec: %v", spec.Data["SLOTS_PER_EPOCH"])
+	}
+
+	names := make(map[phase0.Version]string)
+	for key, value := range spec.Data {
+		version, ok := value.(phase0.Version)
+		if !ok || !strings.HasSuffix(key, "_FORK_VERSION") {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSuffix(key, "_FORK_VERSION"))
+		if name == "genesis" {
+			name = "phase0"
+		}
+		names[version] = name
+	}
+
+	forks := make([]Fork, 0, len(schedule.Data))
+	for _, fork := range schedule.Data {
+		forks = append(forks, Fork{
+			Name:      names[fork.CurrentVersion],
+			Version:   fork.CurrentVersion,
+			Epoch:     fork.Epoch,
+			StartSlot: phase0.Slot(uint64(fork.Epoch) * slotsPerEpoch),
+		})
+	}
+
+	slices.SortStableFunc(forks, func(a, b Fork) int {
+		return cmp.Compare(a.Epoch, b.Epoch)
+	})
+
+	return forks, nil
+}
+
+// FetchForkSchedule is NewForkSchedule, retried with an exponential backoff up to maxAttempts times, for fetching the
+// fork schedule at startup while the beacon node may not be ready yet.
+func FetchForkSchedule(ctx context.Context, c ForkProvider, maxAttempts int) ([]Fork, error) {
+	return retry.Do(ctx, maxAttempts, retry.Exponential(), func() ([]Fork, error) {
+		return NewForkSchedule(ctx, c)
+	})
+}
+
+// ForkStartSlot fetches the first slot of the fork with the given name, e.g. "electra", from the <FORK>_FORK_EPOCH
+// constant of the spec of the chain. ErrIncompatibleSpec is returned if the spec doesn't schedule the fork.
+func ForkStartSlot(ctx context.Context, c client.SpecProvider, fork string) (phase0.Slot, error) {
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	return forkStartSlot(spec.Data, fork)
+}
+
+// BlobAvailabilityStartSlot fetches the first slot of the blob availability window as of the given slot from the spec
+// of the chain. Beacon nodes must serve the blob sidecars of every block from the first slot of the epoch
+// MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS epochs before the epoch of the given slot on, or from the first slot of Deneb if
+// that's later. ErrIncompatibleSpec is returned if the spec doesn't define the window or doesn't schedule Deneb.
+func BlobAvailabilityStartSlot(ctx context.Context, c client.SpecProvider, current phase0.Slot) (phase0.Slot, error) {
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	deneb, err := forkStartSlot(spec.Data, "deneb")
+	if err != nil {
+		return 0, err
+	}
+
+	raw, ok := spec.Data["MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS"]
+	if !ok {
+		return 0, fmt.Errorf("%w: MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS is missing", ErrIncompatibleSpec)
+	}
+
+	minEpochs, ok := raw.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("invalid MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS in spec: %v", raw)
+	}
+
+	// Validated by forkStartSlot
+	slotsPerEpoch := spec.Data["SLOTS_PER_EPOCH"].(uint64)
+
+	epoch := uint64(current) / slotsPerEpoch
+	if epoch <= minEpochs {
+		return deneb, nil
+	}
+
+	return max(deneb, phase0.Slot((epoch-minEpochs)*slotsPerEpoch)), nil
+}
+
+// forkStartSlot returns the first slot of the fork with the given name from the values of the spec, see ForkStartSlot.
+func forkStartSlot(spec map[string]any, fork string) (phase0.Slot, error) {
+	name := strings.ToUpper(fork) + "_FORK_EPOCH"
+	raw, ok := spec[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s is missing", ErrIncompatibleSpec, name)
+	}
+
+	epoch, ok := raw.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("invalid %s in spec: %v", name, raw)
+	}
+
+	if epoch == farFutureEpoch {
+		return 0, fmt.Errorf("%w: the %s fork is not scheduled", ErrIncompatibleSpec, fork)
+	}
+
+	slotsPerEpoch, ok := spec["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || slotsPerEpoch == 0 {
+		return 0, fmt.Errorf("invalid SLOTS_PER_EPOCH in spec: %v", spec["SLOTS_PER_EPOCH"])
+	}
+
+	return phase0.Slot(epoch * slotsPerEpoch), nil
+}
@@ -0,0 +1,66 @@
+package beacon_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobAvailabilityStartSlot(t *testing.T) {
+	// The stub has the spec of mainnet, where Deneb starts at epoch 269568 and blobs are available for 4096 epochs
+	stub := beacontest.NewEmptyStubBeaconClient()
+
+	tests := []struct {
+		name    string
+		current phase0.Slot
+		start   phase0.Slot
+	}{
+		{name: "window after deneb", current: 300000*32 + 5, start: (300000 - 4096) * 32},
+		{name: "first slot of epoch", current: 300000 * 32, start: (300000 - 4096) * 32},
+		{name: "window reaching before deneb", current: 270000 * 32, start: 269568 * 32},
+		{name: "window reaching before genesis", current: 4096*32 - 1, start: 269568 * 32},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, err := beacon.BlobAvailabilityStartSlot(context.Background(), stub, test.current)
+			require.NoError(t, err)
+			require.Equal(t, test.start, start)
+		})
+	}
+
+	stub.SpecValues["DENEB_FORK_EPOCH"] = uint64(math.MaxUint64)
+	_, err := beacon.BlobAvailabilityStartSlot(context.Background(), stub, 300000*32)
+	require.ErrorIs(t, err, beacon.ErrIncompatibleSpec)
+
+	stub.SpecValues["DENEB_FORK_EPOCH"] = uint64(0)
+	delete(stub.SpecValues, "MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS")
+	_, err = beacon.BlobAvailabilityStartSlot(context.Background(), stub, 300000*32)
+	require.ErrorIs(t, err, beacon.ErrIncompatibleSpec)
+}
+
+func TestNewForkSchedule(t *testing.T) {
+	stub := beacontest.NewEmptyStubBeaconClient()
+	stub.Forks = []*phase0.Fork{
+		{PreviousVersion: phase0.Version{4}, CurrentVersion: phase0.Version{5}, Epoch: 364032},
+		{PreviousVersion: phase0.Version{3}, CurrentVersion: phase0.Version{4}, Epoch: 269568},
+		{PreviousVersion: phase0.Version{5}, CurrentVersion: phase0.Version{6}, Epoch: 400000},
+	}
+
+	forks, err := beacon.NewForkSchedule(context.Background(), stub)
+	require.NoError(t, err)
+	require.Equal(t, []beacon.Fork{
+		{Name: "deneb", Version: phase0.Version{4}, Epoch: 269568, StartSlot: 269568 * 32},
+		{Name: "electra", Version: phase0.Version{5}, Epoch: 364032, StartSlot: 364032 * 32},
+		{Version: phase0.Version{6}, Epoch: 400000, StartSlot: 400000 * 32},
+	}, forks)
+
+	stub.Forks = nil
+	_, err = beacon.NewForkSchedule(context.Background(), stub)
+	require.Error(t, err)
+}
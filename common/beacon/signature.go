@@ -0,0 +1,236 @@
+package beacon
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	client "github.com/attestantio/go-eth2-client"
+	"github.com/attestantio/go-eth2-client/api"
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+)
+
+// DomainBeaconProposer is the domain type of the signatures of block proposers.
+var DomainBeaconProposer = phase0.DomainType{0x00, 0x00, 0x00, 0x00}
+
+// SignatureDST is the domain separation tag messages are hashed to the curve with by the signature scheme of the beacon
+// chain, BLS with proofs of possession.
+var SignatureDST = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+// ErrInvalidSignature is returned when the signature of a block header is not that of the block's proposer.
+var ErrInvalidSignature = errors.New("invalid proposer signature")
+
+// SignatureProvider is implemented by clients that can provide what is needed to verify the signatures of block
+// proposers: the chain's genesis and spec, its fork schedule, and the validator set.
+type SignatureProvider interface {
+	ChainProvider
+	client.ForkScheduleProvider
+	client.ValidatorsProvider
+}
+
+// ProposerVerifier verifies that block headers are signed by their proposer, tying a block to the chain without
+// trusting the source it was fetched from beyond the validator set. The fork schedule and genesis are fetched once, and
+// the public keys of up to cacheSize validators are cached, as the public key of a validator index never changes.
+type ProposerVerifier struct {
+	c                     SignatureProvider
+	slotsPerEpoch         uint64
+	genesisValidatorsRoot phase0.Root
+	forks                 []*phase0.Fork
+
+	mu         sync.Mutex
+	cacheSize  int
+	pubkeys    map[phase0.ValidatorIndex]*list.Element
+	pubkeyList *list.List
+}
+
+// cachedPubkey is the decoded public key of a validator.
+type cachedPubkey struct {
+	index  phase0.ValidatorIndex
+	pubkey bls12381.G1Affine
+}
+
+// NewProposerVerifier fetches the genesis, spec and fork schedule of the chain, and creates a verifier caching the public
+// keys of up to cacheSize validators.
+func NewProposerVerifier(ctx context.Context, c SignatureProvider, cacheSize int) (*ProposerVerifier, error) {
+	genesis, err := c.Genesis(ctx, &api.GenesisOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch genesis: %w", err)
+	}
+
+	spec, err := c.Spec(ctx, &api.SpecOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+
+	slotsPerEpoch, ok := spec.Data["SLOTS_PER_EPOCH"].(uint64)
+	if !ok || slotsPerEpoch == 0 {
+		return nil, fmt.Errorf("invalid SLOTS_PER_EPOCH in spec: %v", spec.Data["SLOTS_PER_EPOCH"])
+	}
+
+	forks, err := c.ForkSchedule(ctx, &api.ForkScheduleOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fork schedule: %w", err)
+	}
+
+	if len(forks.Data) == 0 {
+		return nil, errors.New("empty fork schedule")
+	}
+
+	return &ProposerVerifier{
+		c:                     c,
+		slotsPerEpoch:         slotsPerEpoch,
+		genesisValidatorsRoot: genesis.Data.GenesisValidatorsRoot,
+		forks:                 forks.Data,
+		cacheSize:             max(cacheSize, 1),
+		pubkeys:               make(map[phase0.ValidatorIndex]*list.Element),
+		pubkeyList:            list.New(),
+	}, nil
+}
+
+// Verify returns ErrInvalidSignature if the header is not signed by the proposer of its block, or its root is not the
+// root of the block it describes.
+func (v *ProposerVerifier) Verify(ctx context.Context, header *v1.BeaconBlockHeader) error {
+	if header.Header == nil || header.Header.Message == nil {
+		return fmt.Errorf("%w: block %s has no header", ErrInvalidSignature, header.Root)
+	}
+	message := header.Header.Message
+
+	root, err := message.HashTreeRoot()
+	if err != nil {
+		return fmt.Errorf("failed to compute block root: %w", err)
+	}
+
+	if root != header.Root {
+		return fmt.Errorf("%w: header of block %s has root %s", ErrInvalidSignature, header.Root, phase0.Root(root))
+	}
+
+	pubkey, err := v.pubkey(ctx, message.ProposerIndex)
+	if err != nil {
+		return err
+	}
+
+	domain, err := v.domain(phase0.Epoch(uint64(message.Slot) / v.slotsPerEpoch))
+	if err != nil {
+		return err
+	}
+
+	signingRoot, err := (&phase0.SigningData{ObjectRoot: root, Domain: domain}).HashTreeRoot()
+	if err != nil {
+		return fmt.Errorf("failed to compute signing root: %w", err)
+	}
+
+	var signature bls12381.G2Affine
+	if _, err := signature.SetBytes(header.Header.Signature[:]); err != nil {
+		return fmt.Errorf("%w: block %s has a malformed signature: %v", ErrInvalidSignature, header.Root, err)
+	}
+
+	valid, err := verifySignature(pubkey, signingRoot[:], signature)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: block %s is not signed by its proposer %d", ErrInvalidSignature, header.Root, message.ProposerIndex)
+	}
+
+	return nil
+}
+
+// domain returns the proposer signature domain of the epoch, from the fork the epoch belongs to.
+func (v *ProposerVerifier) domain(epoch phase0.Epoch) (phase0.Domain, error) {
+	fork := v.forks[0]
+	for _, f := range v.forks {
+		if f.Epoch > epoch {
+			break
+		}
+		fork = f
+	}
+
+	version := fork.CurrentVersion
+	if epoch < fork.Epoch {
+		version = fork.PreviousVersion
+	}
+
+	return ComputeDomain(DomainBeaconProposer, version, v.genesisValidatorsRoot)
+}
+
+// ComputeDomain returns the signature domain of the domain type for the fork version of the chain with the genesis
+// validators root.
+func ComputeDomain(domainType phase0.DomainType, version phase0.Version, genesisValidatorsRoot phase0.Root) (phase0.Domain, error) {
+	forkData := &phase0.ForkData{
+		CurrentVersion:        version,
+		GenesisValidatorsRoot: genesisValidatorsRoot,
+	}
+
+	forkDataRoot, err := forkData.HashTreeRoot()
+	if err != nil {
+		return phase0.Domain{}, fmt.Errorf("failed to compute fork data root: %w", err)
+	}
+
+	var domain phase0.Domain
+	copy(domain[:], domainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+	return domain, nil
+}
+
+// pubkey returns the decoded public key of the validator, fetching it from the beacon node if it isn't cached.
+func (v *ProposerVerifier) pubkey(ctx context.Context, index phase0.ValidatorIndex) (bls12381.G1Affine, error) {
+	v.mu.Lock()
+	if element, ok := v.pubkeys[index]; ok {
+		v.pubkeyList.MoveToFront(element)
+		v.mu.Unlock()
+		return element.Value.(*cachedPubkey).pubkey, nil
+	}
+	v.mu.Unlock()
+
+	// The validator registry only grows, so every proposer of a past block is in the head state
+	validators, err := v.c.Validators(ctx, &api.ValidatorsOpts{
+		State:   "head",
+		Indices: []phase0.ValidatorIndex{index},
+	})
+	if err != nil {
+		return bls12381.G1Affine{}, fmt.Errorf("failed to fetch validator %d: %w", index, err)
+	}
+
+	validator, ok := validators.Data[index]
+	if !ok || validator.Validator == nil {
+		return bls12381.G1Affine{}, fmt.Errorf("%w: unknown proposer %d", ErrInvalidSignature, index)
+	}
+
+	var pubkey bls12381.G1Affine
+	if _, err := pubkey.SetBytes(validator.Validator.PublicKey[:]); err != nil || pubkey.IsInfinity() {
+		return bls12381.G1Affine{}, fmt.Errorf("invalid public key of validator %d: %v", index, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.pubkeys[index]; !ok {
+		v.pubkeys[index] = v.pubkeyList.PushFront(&cachedPubkey{index: index, pubkey: pubkey})
+		if v.pubkeyList.Len() > v.cacheSize {
+			oldest := v.pubkeyList.Back()
+			v.pubkeyList.Remove(oldest)
+			delete(v.pubkeys, oldest.Value.(*cachedPubkey).index)
+		}
+	}
+
+	return pubkey, nil
+}
+
+// verifySignature returns whether the signature is the signature of the message by the public key, i.e. whether
+// e(pubkey, H(message)) = e(g1, signature).
+func verifySignature(pubkey bls12381.G1Affine, message []byte, signature bls12381.G2Affine) (bool, error) {
+	hashed, err := bls12381.HashToG2(message, SignatureDST)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash message to curve: %w", err)
+	}
+
+	_, _, g1, _ := bls12381.Generators()
+	var negG1 bls12381.G1Affine
+	negG1.Neg(&g1)
+
+	return bls12381.PairingCheck([]bls12381.G1Affine{pubkey, negG1}, []bls12381.G2Affine{hashed, signature})
+}
@@ -0,0 +1,81 @@
+package beacon_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	v1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/beacon"
+	"github.com/base-org/blob-archiver/common/beacon/beacontest"
+	"github.com/stretchr/testify/require"
+)
+
+func newHeader(slot uint64, proposer phase0.ValidatorIndex) *v1.BeaconBlockHeader {
+	return &v1.BeaconBlockHeader{
+		Header: &phase0.SignedBeaconBlockHeader{
+			Message: &phase0.BeaconBlockHeader{
+				Slot:          phase0.Slot(slot),
+				ProposerIndex: proposer,
+				ParentRoot:    phase0.Root{1},
+				StateRoot:     phase0.Root{2},
+				BodyRoot:      phase0.Root{3},
+			},
+		},
+	}
+}
+
+func TestProposerVerifier(t *testing.T) {
+	stub := beacontest.NewEmptyStubBeaconClient()
+	stub.GenesisValidatorsRoot = phase0.Root{0x4b, 0x36, 0x3d, 0xb9}
+	// The second fork starts at epoch 2, i.e. slot 64
+	stub.Forks = append(stub.Forks, &phase0.Fork{PreviousVersion: phase0.Version{4}, CurrentVersion: phase0.Version{5}, Epoch: 2})
+
+	alice, bob := big.NewInt(0xa11ce), big.NewInt(0xb0b)
+	stub.AddValidator(1, alice)
+	stub.AddValidator(2, bob)
+
+	verifier, err := beacon.NewProposerVerifier(context.Background(), stub, 1)
+	require.NoError(t, err)
+
+	// Headers signed by their proposer are valid, before and after the fork
+	for _, slot := range []uint64{10, 70} {
+		header := newHeader(slot, 1)
+		stub.SignHeader(t, header, alice)
+		require.NoError(t, verifier.Verify(context.Background(), header))
+	}
+
+	// The public key of the proposer is cached
+	require.Equal(t, 1, stub.ValidatorsRequests)
+
+	// A header signed by another validator is invalid
+	forged := newHeader(11, 1)
+	stub.SignHeader(t, forged, bob)
+	require.ErrorIs(t, verifier.Verify(context.Background(), forged), beacon.ErrInvalidSignature)
+
+	// So is a header signed for another fork
+	stale := newHeader(70, 1)
+	stub.Forks = stub.Forks[:1]
+	stub.SignHeader(t, stale, alice)
+	require.ErrorIs(t, verifier.Verify(context.Background(), stale), beacon.ErrInvalidSignature)
+
+	// So is a validly signed header whose root is not that of its message
+	valid := newHeader(12, 2)
+	stub.SignHeader(t, valid, bob)
+	require.NoError(t, verifier.Verify(context.Background(), valid))
+	valid.Root = phase0.Root{9}
+	require.ErrorIs(t, verifier.Verify(context.Background(), valid), beacon.ErrInvalidSignature)
+
+	// And a header of an unknown proposer
+	unknown := newHeader(13, 3)
+	stub.SignHeader(t, unknown, alice)
+	require.ErrorIs(t, verifier.Verify(context.Background(), unknown), beacon.ErrInvalidSignature)
+
+	// Verifying the header of bob evicted alice from the cache of one validator
+	requests := stub.ValidatorsRequests
+	header := newHeader(14, 1)
+	stub.SignHeader(t, header, alice)
+	require.NoError(t, verifier.Verify(context.Background(), header))
+	require.Equal(t, requests+1, stub.ValidatorsRequests)
+}
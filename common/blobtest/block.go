@@ -0,0 +1,68 @@
+package blobtest
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// NewSignedBeaconBlock returns a deneb block with the slot, proposer, parent and state root of the header, committing
+// to the given blob sidecars. The body root of the header is set to that of the block, so that the header is the header
+// of the block, and the block's root is the hash tree root of the header.
+func NewSignedBeaconBlock(t *testing.T, header *phase0.BeaconBlockHeader, sidecars []*deneb.BlobSidecar) *spec.VersionedSignedBeaconBlock {
+	commitments := make([]deneb.KZGCommitment, len(sidecars))
+	for i, sidecar := range sidecars {
+		commitments[i] = sidecar.KZGCommitment
+	}
+
+	body := &deneb.BeaconBlockBody{
+		RANDAOReveal: phase0.BLSSignature(RandBytes(t, 96)),
+		ETH1Data: &phase0.ETH1Data{
+			DepositRoot: phase0.Root(RandBytes(t, 32)),
+			BlockHash:   RandBytes(t, 32),
+		},
+		ProposerSlashings: []*phase0.ProposerSlashing{},
+		AttesterSlashings: []*phase0.AttesterSlashing{},
+		Attestations:      []*phase0.Attestation{},
+		Deposits:          []*phase0.Deposit{},
+		VoluntaryExits:    []*phase0.SignedVoluntaryExit{},
+		SyncAggregate: &altair.SyncAggregate{
+			SyncCommitteeBits:      RandBytes(t, 64),
+			SyncCommitteeSignature: phase0.BLSSignature(RandBytes(t, 96)),
+		},
+		ExecutionPayload: &deneb.ExecutionPayload{
+			ParentHash:    phase0.Hash32(RandBytes(t, 32)),
+			BlockNumber:   uint64(header.Slot),
+			GasLimit:      30_000_000,
+			ExtraData:     []byte{},
+			BaseFeePerGas: uint256.NewInt(7),
+			BlockHash:     phase0.Hash32(RandBytes(t, 32)),
+			Transactions:  []bellatrix.Transaction{},
+		},
+		BlobKZGCommitments: commitments,
+	}
+
+	bodyRoot, err := body.HashTreeRoot()
+	require.NoError(t, err)
+	header.BodyRoot = bodyRoot
+
+	return &spec.VersionedSignedBeaconBlock{
+		Version: spec.DataVersionDeneb,
+		Deneb: &deneb.SignedBeaconBlock{
+			Message: &deneb.BeaconBlock{
+				Slot:          header.Slot,
+				ProposerIndex: header.ProposerIndex,
+				ParentRoot:    header.ParentRoot,
+				StateRoot:     header.StateRoot,
+				Body:          body,
+			},
+			Signature: phase0.BLSSignature(RandBytes(t, 96)),
+		},
+	}
+}
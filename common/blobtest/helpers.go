@@ -48,3 +48,12 @@ func NewBlobSidecars(t *testing.T, count uint) []*deneb.BlobSidecar {
 	}
 	return result
 }
+
+// NewBlobSidecarsForBlock returns sidecars that embed the given block header, as the sidecars of that block would.
+func NewBlobSidecarsForBlock(t *testing.T, header *phase0.SignedBeaconBlockHeader, count uint) []*deneb.BlobSidecar {
+	result := NewBlobSidecars(t, count)
+	for _, sidecar := range result {
+		sidecar.SignedBlockHeader = header
+	}
+	return result
+}
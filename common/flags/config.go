@@ -3,6 +3,7 @@ package flags
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -10,14 +11,34 @@ import (
 
 type DataStorage string
 type S3CredentialType string
+type StorageFormat string
+type StorageCompression string
+
+// KeyScheme is how stored blocks are named, see StorageConfig.KeyScheme.
+type KeyScheme string
 
 const (
 	DataStorageUnknown  DataStorage      = "unknown"
 	DataStorageS3       DataStorage      = "s3"
 	DataStorageFile     DataStorage      = "file"
+	DataStoragePebble   DataStorage      = "pebble"
 	S3CredentialUnknown S3CredentialType = "unknown"
 	S3CredentialStatic  S3CredentialType = "static"
 	S3CredentialIAM     S3CredentialType = "iam"
+	StorageFormatJSON   StorageFormat    = "json"
+	StorageFormatSSZ    StorageFormat    = "ssz"
+	// StorageFormatSnappySSZ is the SSZ format, compressed with snappy, which is faster but compresses less than zstd.
+	StorageFormatSnappySSZ StorageFormat = "snappy-ssz"
+
+	StorageCompressionNone StorageCompression = "none"
+	StorageCompressionZstd StorageCompression = "zstd"
+
+	// KeySchemeRoot names blocks by their root only. The slot index maps each slot to a root in an entry named by the
+	// zero-padded slot, which has to be read to learn the root, except on S3, where the root is part of its name.
+	KeySchemeRoot KeyScheme = "root"
+	// KeySchemeSlot additionally names blocks by their zero-padded slot and root, which replace the entries of the slot
+	// index. Keys sort in slot order, so a range of slots is listed in order, with the roots, by a single listing.
+	KeySchemeSlot KeyScheme = "slot"
 )
 
 type S3Config struct {
@@ -28,6 +49,12 @@ type S3Config struct {
 	S3CredentialType S3CredentialType
 	AccessKey        string
 	SecretAccessKey  string
+
+	// RangedReadThreshold is the size in bytes above which blob data is read with concurrent ranged GETs of
+	// RangedReadPartSize bytes, up to RangedReadConcurrency at once, instead of a single GET. 0 disables ranged reads.
+	RangedReadThreshold   int64
+	RangedReadPartSize    int64
+	RangedReadConcurrency int
 }
 
 func (c S3Config) check() error {
@@ -53,6 +80,20 @@ func (c S3Config) check() error {
 		return errors.New("s3 bucket must be set")
 	}
 
+	if c.RangedReadThreshold < 0 {
+		return errors.New("s3 ranged read threshold must not be negative")
+	}
+
+	if c.RangedReadThreshold > 0 {
+		if c.RangedReadPartSize <= 0 {
+			return errors.New("s3 ranged read part size must be positive")
+		}
+
+		if c.RangedReadConcurrency <= 0 {
+			return errors.New("s3 ranged read concurrency must be positive")
+		}
+	}
+
 	return nil
 }
 
@@ -65,6 +106,20 @@ type StorageConfig struct {
 	DataStorageType      DataStorage
 	S3Config             S3Config
 	FileStorageDirectory string
+	// PebbleDirectory is the directory of the embedded database of the pebble data-store.
+	PebbleDirectory string
+	// Format is the format blobs are written in. Blobs are read in either format, regardless of this setting.
+	Format StorageFormat
+	// Compression is the compression blobs are written with. Blobs are read with any compression, regardless of this
+	// setting.
+	Compression StorageCompression
+	// InstanceID identifies the instance writing to the data-store. It is recorded on every object written, so that the
+	// writers of a data-store shared by multiple instances can be told apart. Objects are not tagged if it is empty. The
+	// pebble data-store can't record it, as its values have no metadata, so it must be empty for pebble.
+	InstanceID string
+	// KeyScheme is how stored blocks are named. Blobs are always stored under their root, so lookups by root work the
+	// same with either scheme, and the scheme only changes how slot index entries are named.
+	KeyScheme KeyScheme
 }
 
 func NewBeaconConfig(cliCtx *cli.Context) BeaconConfig {
@@ -81,6 +136,11 @@ func NewStorageConfig(cliCtx *cli.Context) StorageConfig {
 		DataStorageType:      toDataStorage(cliCtx.String(DataStoreFlagName)),
 		S3Config:             readS3Config(cliCtx),
 		FileStorageDirectory: cliCtx.String(FileStorageDirectoryFlagName),
+		PebbleDirectory:      cliCtx.String(PebbleDirectoryFlagName),
+		Format:               StorageFormat(cliCtx.String(StorageFormatFlagName)),
+		Compression:          StorageCompression(cliCtx.String(StorageCompressionFlagName)),
+		InstanceID:           cliCtx.String(InstanceIDFlagName),
+		KeyScheme:            KeyScheme(cliCtx.String(KeySchemeFlagName)),
 	}
 }
 
@@ -93,6 +153,10 @@ func toDataStorage(s string) DataStorage {
 		return DataStorageFile
 	}
 
+	if s == string(DataStoragePebble) {
+		return DataStoragePebble
+	}
+
 	return DataStorageUnknown
 }
 
@@ -104,6 +168,10 @@ func readS3Config(ctx *cli.Context) S3Config {
 		UseHttps:         ctx.Bool(S3EndpointHttpsFlagName),
 		Bucket:           ctx.String(S3BucketFlagName),
 		S3CredentialType: toS3CredentialType(ctx.String(S3CredentialTypeFlagName)),
+
+		RangedReadThreshold:   ctx.Int64(S3RangedReadThresholdFlagName),
+		RangedReadPartSize:    ctx.Int64(S3RangedReadPartSizeFlagName),
+		RangedReadConcurrency: ctx.Int(S3RangedReadConcurrencyFlagName),
 	}
 }
 
@@ -128,6 +196,19 @@ func (c BeaconConfig) Check() error {
 	return nil
 }
 
+// URL returns the data-store as a URL, either s3://<bucket>, file://<directory> or pebble://<directory>.
+func (c StorageConfig) URL() string {
+	if c.DataStorageType == DataStorageS3 {
+		return "s3://" + c.S3Config.Bucket
+	}
+
+	if c.DataStorageType == DataStoragePebble {
+		return "pebble://" + c.PebbleDirectory
+	}
+
+	return "file://" + c.FileStorageDirectory
+}
+
 func (c StorageConfig) Check() error {
 	if c.DataStorageType == DataStorageUnknown {
 		return errors.New("unknown data-storage type")
@@ -139,7 +220,73 @@ func (c StorageConfig) Check() error {
 		}
 	} else if c.DataStorageType == DataStorageFile && c.FileStorageDirectory == "" {
 		return errors.New("file storage directory must be set")
+	} else if c.DataStorageType == DataStoragePebble && c.PebbleDirectory == "" {
+		return errors.New("pebble directory must be set")
+	}
+
+	if c.DataStorageType == DataStoragePebble && c.InstanceID != "" {
+		return errors.New("the pebble data-store can't record an instance id")
+	}
+
+	if c.Format != StorageFormatJSON && c.Format != StorageFormatSSZ && c.Format != StorageFormatSnappySSZ {
+		return fmt.Errorf("invalid storage format: \"%s\"", c.Format)
+	}
+
+	if c.Compression != StorageCompressionNone && c.Compression != StorageCompressionZstd {
+		return fmt.Errorf("invalid storage compression: \"%s\"", c.Compression)
+	}
+
+	if c.Format == StorageFormatSnappySSZ && c.Compression != StorageCompressionNone {
+		return fmt.Errorf("the \"%s\" storage format is already compressed", c.Format)
+	}
+
+	if c.KeyScheme != KeySchemeRoot && c.KeyScheme != KeySchemeSlot {
+		return fmt.Errorf("invalid storage key scheme: \"%s\"", c.KeyScheme)
 	}
 
 	return nil
 }
+
+// ParseStorageURL parses a data-store URL, either s3://<bucket>, file://<directory> or pebble://<directory>. S3 data-stores share the
+// endpoint and credentials of the given base data-store configuration, and all data-stores share its format,
+// compression, instance ID and key scheme. Query parameters are ignored.
+func ParseStorageURL(raw string, base StorageConfig) (StorageConfig, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return StorageConfig{}, err
+	}
+
+	switch DataStorage(u.Scheme) {
+	case DataStorageS3:
+		result := StorageConfig{
+			DataStorageType: DataStorageS3,
+			S3Config:        base.S3Config,
+			Format:          base.Format,
+			Compression:     base.Compression,
+			InstanceID:      base.InstanceID,
+			KeyScheme:       base.KeyScheme,
+		}
+		result.S3Config.Bucket = u.Host
+		return result, nil
+	case DataStorageFile:
+		return StorageConfig{
+			DataStorageType:      DataStorageFile,
+			FileStorageDirectory: u.Host + u.Path,
+			Format:               base.Format,
+			Compression:          base.Compression,
+			InstanceID:           base.InstanceID,
+			KeyScheme:            base.KeyScheme,
+		}, nil
+	case DataStoragePebble:
+		return StorageConfig{
+			DataStorageType: DataStoragePebble,
+			PebbleDirectory: u.Host + u.Path,
+			Format:          base.Format,
+			Compression:     base.Compression,
+			InstanceID:      base.InstanceID,
+			KeyScheme:       base.KeyScheme,
+		}, nil
+	default:
+		return StorageConfig{}, fmt.Errorf("unknown data-store type")
+	}
+}
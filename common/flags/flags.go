@@ -15,7 +15,15 @@ const (
 	S3AccessKeyFlagName             = "s3-access-key"
 	S3SecretAccessKeyFlagName       = "s3-secret-access-key"
 	S3BucketFlagName                = "s3-bucket"
+	S3RangedReadThresholdFlagName   = "s3-ranged-read-threshold"
+	S3RangedReadPartSizeFlagName    = "s3-ranged-read-part-size"
+	S3RangedReadConcurrencyFlagName = "s3-ranged-read-concurrency"
 	FileStorageDirectoryFlagName    = "file-directory"
+	PebbleDirectoryFlagName         = "pebble-directory"
+	StorageFormatFlagName           = "storage-format"
+	StorageCompressionFlagName      = "storage-compression"
+	InstanceIDFlagName              = "instance-id"
+	KeySchemeFlagName               = "storage-key-scheme"
 )
 
 func CLIFlags(envPrefix string) []cli.Flag {
@@ -29,7 +37,7 @@ func CLIFlags(envPrefix string) []cli.Flag {
 		},
 		&cli.StringFlag{
 			Name:     DataStoreFlagName,
-			Usage:    "The type of data-store, options are [s3, file]",
+			Usage:    "The type of data-store, options are [s3, file, pebble]",
 			Required: true,
 			EnvVars:  opservice.PrefixEnvVar(envPrefix, "DATA_STORE"),
 		},
@@ -69,12 +77,60 @@ func CLIFlags(envPrefix string) []cli.Flag {
 			Hidden:  true,
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_BUCKET"),
 		},
+		&cli.Int64Flag{
+			Name:    S3RangedReadThresholdFlagName,
+			Usage:   "The size in bytes above which blob data is read from S3 with concurrent ranged GETs instead of a single GET. 0 disables ranged reads",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_RANGED_READ_THRESHOLD"),
+		},
+		&cli.Int64Flag{
+			Name:    S3RangedReadPartSizeFlagName,
+			Usage:   "The size in bytes of the parts of ranged S3 reads",
+			Value:   1 << 20,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_RANGED_READ_PART_SIZE"),
+		},
+		&cli.IntFlag{
+			Name:    S3RangedReadConcurrencyFlagName,
+			Usage:   "The number of parts of a ranged S3 read fetched at once",
+			Value:   4,
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "S3_RANGED_READ_CONCURRENCY"),
+		},
 		// File Data Store Flags
 		&cli.StringFlag{
 			Name:    FileStorageDirectoryFlagName,
 			Usage:   "The path to the directory to use for storing blobs on the file system",
 			EnvVars: opservice.PrefixEnvVar(envPrefix, "FILE_DIRECTORY"),
 		},
+		// Pebble Data Store Flags
+		&cli.StringFlag{
+			Name:    PebbleDirectoryFlagName,
+			Usage:   "The path to the directory of the embedded Pebble database to store blobs in",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "PEBBLE_DIRECTORY"),
+		},
+		&cli.StringFlag{
+			Name:    StorageFormatFlagName,
+			Usage:   "The format blobs are written in, options are [json, ssz, snappy-ssz]. Blobs are read in any format",
+			Value:   string(StorageFormatJSON),
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STORAGE_FORMAT"),
+		},
+		&cli.StringFlag{
+			Name: StorageCompressionFlagName,
+			Usage: "The compression blobs are written with, options are [none, zstd]. Blobs are read with either " +
+				"compression. zstd uses the latest dictionary trained by the archiver, if any",
+			Value:   string(StorageCompressionNone),
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STORAGE_COMPRESSION"),
+		},
+		&cli.StringFlag{
+			Name:    InstanceIDFlagName,
+			Usage:   "An identifier of this instance, recorded on every object it writes and included in its logs. Objects are not tagged if empty",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "INSTANCE_ID"),
+		},
+		&cli.StringFlag{
+			Name: KeySchemeFlagName,
+			Usage: "How stored blocks are named, options are [root, slot]. slot also names them by zero-padded slot and " +
+				"root instead of writing slot index entries, so slot ranges are listed in order without reading entries",
+			Value:   string(KeySchemeRoot),
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "STORAGE_KEY_SCHEME"),
+		},
 		// Beacon Client Settings
 		&cli.StringFlag{
 			Name:    BeaconHttpClientTimeoutFlagName,
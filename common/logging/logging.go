@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	opservice "github.com/ethereum-optimism/optimism/op-service"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+const SubsystemLevelsFlagName = "log.subsystem-levels"
+
+// The subsystems that can be given their own log level.
+const (
+	Archiver = "archiver"
+	Storage  = "storage"
+	Beacon   = "beacon"
+	API      = "api"
+)
+
+var subsystems = []string{Archiver, Storage, Beacon, API}
+
+func CLIFlags(envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: SubsystemLevelsFlagName,
+			Usage: "The lowest log level that will be output per subsystem, overriding log.level, e.g. archiver=debug,storage=warn. " +
+				"Subsystems are [archiver, storage, beacon, api]",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "LOG_SUBSYSTEM_LEVELS"),
+		},
+		&cli.IntFlag{
+			Name:    MaxErrorLengthFlagName,
+			Usage:   "The maximum length in bytes of logged errors, longer errors are truncated. 0 doesn't truncate errors",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "LOG_MAX_ERROR_LENGTH"),
+			Value:   2048,
+		},
+		&cli.StringSliceFlag{
+			Name: RedactPatternsFlagName,
+			Usage: "Regular expressions whose matches are redacted from logged values, in addition to credentials in URLs, " +
+				"authorization headers and credential query parameters, which are always redacted",
+			EnvVars: opservice.PrefixEnvVar(envPrefix, "LOG_REDACT_PATTERNS"),
+		},
+	}
+}
+
+// Config layers log levels per subsystem, and the sanitization of logged values, on top of the op-service log
+// configuration.
+type Config struct {
+	oplog.CLIConfig
+	SubsystemLevels string
+	// MaxErrorLength and RedactPatterns configure the sanitization of logged values, see NewSanitizer.
+	MaxErrorLength int
+	RedactPatterns []string
+}
+
+func ReadConfig(cliCtx *cli.Context) Config {
+	return Config{
+		CLIConfig:       oplog.ReadCLIConfig(cliCtx),
+		SubsystemLevels: cliCtx.String(SubsystemLevelsFlagName),
+		MaxErrorLength:  cliCtx.Int(MaxErrorLengthFlagName),
+		RedactPatterns:  cliCtx.StringSlice(RedactPatternsFlagName),
+	}
+}
+
+func (c Config) Check() error {
+	if _, err := ParseSubsystemLevels(c.SubsystemLevels); err != nil {
+		return err
+	}
+
+	_, err := NewSanitizer(c.MaxErrorLength, c.RedactPatterns)
+	return err
+}
+
+// ParseSubsystemLevels parses a comma separated list of subsystem=level pairs.
+func ParseSubsystemLevels(input string) (map[string]log.Lvl, error) {
+	levels := make(map[string]log.Lvl)
+	for _, field := range strings.Split(input, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		subsystem, level, found := strings.Cut(field, "=")
+		subsystem = strings.ToLower(strings.TrimSpace(subsystem))
+		if !found || !slices.Contains(subsystems, subsystem) {
+			return nil, fmt.Errorf("invalid subsystem log level: \"%s\"", field)
+		}
+
+		lvl, err := log.LvlFromString(strings.ToLower(strings.TrimSpace(level)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid subsystem log level: \"%s\"", field)
+		}
+
+		levels[subsystem] = lvl
+	}
+
+	return levels, nil
+}
+
+// Loggers creates the loggers of the subsystems, which all write to the same output.
+type Loggers struct {
+	root    log.Logger
+	handler log.Handler
+	levels  map[string]log.Lvl
+	// ctx is the context added to every record, see With.
+	ctx []interface{}
+}
+
+// NewLoggers creates the root logger from the op-service configuration, and the loggers of subsystems with their own
+// level. All of them sanitize the values they log, see Sanitizer. The beacon client logs through zerolog rather than
+// through these loggers, so the level of the beacon subsystem is applied to zerolog's global level, but its logs aren't
+// sanitized.
+func NewLoggers(wr io.Writer, cfg Config) (*Loggers, error) {
+	levels, err := ParseSubsystemLevels(cfg.SubsystemLevels)
+	if err != nil {
+		return nil, err
+	}
+
+	sanitizer, err := NewSanitizer(cfg.MaxErrorLength, cfg.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same handler as oplog.NewLogHandler, before it is filtered by level
+	handler := sanitizer.Handler(log.SyncHandler(log.StreamHandler(wr, cfg.Format.Formatter(cfg.Color))))
+
+	root := log.New()
+	root.SetHandler(oplog.NewDynamicLogHandler(cfg.Level, handler))
+
+	if lvl, ok := levels[Beacon]; ok {
+		zerolog.SetGlobalLevel(zerologLevel(lvl))
+	}
+
+	return &Loggers{
+		root:    root,
+		handler: handler,
+		levels:  levels,
+	}, nil
+}
+
+func (l *Loggers) Root() log.Logger {
+	return l.root
+}
+
+// With returns loggers adding the given key/value pairs to every record of the root logger and of every subsystem, e.g.
+// the ID of the instance.
+func (l *Loggers) With(ctx ...interface{}) *Loggers {
+	return &Loggers{
+		root:    l.root.New(ctx...),
+		handler: l.handler,
+		levels:  l.levels,
+		ctx:     append(slices.Clone(l.ctx), ctx...),
+	}
+}
+
+// Subsystem returns the logger of the subsystem. Subsystems without their own level log through the root logger.
+func (l *Loggers) Subsystem(name string) log.Logger {
+	lvl, ok := l.levels[name]
+	if !ok {
+		return l.root
+	}
+
+	logger := log.New(append([]interface{}{"subsystem", name}, l.ctx...)...)
+	logger.SetHandler(log.LvlFilterHandler(lvl, l.handler))
+	return logger
+}
+
+func zerologLevel(lvl log.Lvl) zerolog.Level {
+	switch lvl {
+	case log.LvlCrit:
+		return zerolog.FatalLevel
+	case log.LvlError:
+		return zerolog.ErrorLevel
+	case log.LvlWarn:
+		return zerolog.WarnLevel
+	case log.LvlInfo:
+		return zerolog.InfoLevel
+	case log.LvlDebug:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// cellSize is the size of a cell of a column, FIELD_ELEMENTS_PER_CELL field elements of 32 bytes.
+	cellSize = 64 * 32
+	// maxColumnCells is the maximum number of cells, commitments and proofs of a column, MAX_BLOB_COMMITMENTS_PER_BLOCK.
+	maxColumnCells = 4096
+	// kzgCommitmentsInclusionProofDepth is the depth of the proof of the commitments list in the block body.
+	kzgCommitmentsInclusionProofDepth = 4
+	// dataColumnSidecarFixedSize is the size of the fixed part of the SSZ container of a data column sidecar: the index,
+	// the offsets of the column, commitments and proofs, the signed block header and the inclusion proof.
+	dataColumnSidecarFixedSize = 8 + 3*4 + 208 + kzgCommitmentsInclusionProofDepth*32
+)
+
+// DataColumnSidecar is a column of the extended blobs of a block, with the KZG proofs of its cells, as introduced by
+// EIP-7594 (PeerDAS). The consensus client library doesn't define columns yet, so they are defined following the
+// DataColumnSidecar container of the consensus specs, whose SSZ encoding they share.
+type DataColumnSidecar struct {
+	Index                        uint64                                         `json:"index,string"`
+	Column                       []hexutil.Bytes                                `json:"column"`
+	KZGCommitments               []deneb.KZGCommitment                          `json:"kzg_commitments"`
+	KZGProofs                    []deneb.KZGProof                               `json:"kzg_proofs"`
+	SignedBlockHeader            *phase0.SignedBeaconBlockHeader                `json:"signed_block_header"`
+	KZGCommitmentsInclusionProof [kzgCommitmentsInclusionProofDepth]common.Hash `json:"kzg_commitments_inclusion_proof"`
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the sidecar.
+func (c *DataColumnSidecar) SizeSSZ() int {
+	return dataColumnSidecarFixedSize + len(c.Column)*cellSize + (len(c.KZGCommitments)+len(c.KZGProofs))*48
+}
+
+// MarshalSSZTo appends the SSZ encoding of the sidecar to dst.
+func (c *DataColumnSidecar) MarshalSSZTo(dst []byte) ([]byte, error) {
+	if c.SignedBlockHeader == nil || c.SignedBlockHeader.Message == nil {
+		return nil, errors.New("data column sidecar has no block header")
+	}
+	if len(c.Column) > maxColumnCells || len(c.KZGCommitments) > maxColumnCells || len(c.KZGProofs) > maxColumnCells {
+		return nil, fmt.Errorf("data column sidecar %d has too many cells", c.Index)
+	}
+
+	dst = binary.LittleEndian.AppendUint64(dst, c.Index)
+	offset := dataColumnSidecarFixedSize
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(offset))
+	offset += len(c.Column) * cellSize
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(offset))
+	offset += len(c.KZGCommitments) * 48
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(offset))
+
+	dst, err := c.SignedBlockHeader.MarshalSSZTo(dst)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range c.KZGCommitmentsInclusionProof {
+		dst = append(dst, hash.Bytes()...)
+	}
+
+	for i, cell := range c.Column {
+		if len(cell) != cellSize {
+			return nil, fmt.Errorf("invalid size of cell %d of data column sidecar %d: %d", i, c.Index, len(cell))
+		}
+		dst = append(dst, cell...)
+	}
+	for _, commitment := range c.KZGCommitments {
+		dst = append(dst, commitment[:]...)
+	}
+	for _, proof := range c.KZGProofs {
+		dst = append(dst, proof[:]...)
+	}
+
+	return dst, nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of a sidecar.
+func (c *DataColumnSidecar) UnmarshalSSZ(b []byte) error {
+	if len(b) < dataColumnSidecarFixedSize {
+		return errors.New("ssz data column sidecar too short")
+	}
+
+	columnOffset := binary.LittleEndian.Uint32(b[8:12])
+	commitmentsOffset := binary.LittleEndian.Uint32(b[12:16])
+	proofsOffset := binary.LittleEndian.Uint32(b[16:20])
+	if columnOffset != dataColumnSidecarFixedSize || commitmentsOffset < columnOffset || proofsOffset < commitmentsOffset || int(proofsOffset) > len(b) {
+		return errors.New("invalid ssz data column sidecar offsets")
+	}
+
+	column := b[columnOffset:commitmentsOffset]
+	commitments := b[commitmentsOffset:proofsOffset]
+	proofs := b[proofsOffset:]
+	if len(column)%cellSize != 0 || len(commitments)%48 != 0 || len(proofs)%48 != 0 {
+		return errors.New("invalid ssz data column sidecar length")
+	}
+	if len(column)/cellSize > maxColumnCells || len(commitments)/48 > maxColumnCells || len(proofs)/48 > maxColumnCells {
+		return errors.New("ssz data column sidecar has too many cells")
+	}
+
+	header := new(phase0.SignedBeaconBlockHeader)
+	if err := header.UnmarshalSSZ(b[20:228]); err != nil {
+		return err
+	}
+
+	*c = DataColumnSidecar{
+		Index:             binary.LittleEndian.Uint64(b[:8]),
+		Column:            make([]hexutil.Bytes, len(column)/cellSize),
+		KZGCommitments:    make([]deneb.KZGCommitment, len(commitments)/48),
+		KZGProofs:         make([]deneb.KZGProof, len(proofs)/48),
+		SignedBlockHeader: header,
+	}
+	for i := range c.KZGCommitmentsInclusionProof {
+		c.KZGCommitmentsInclusionProof[i] = common.BytesToHash(b[228+i*32 : 228+(i+1)*32])
+	}
+	for i := range c.Column {
+		c.Column[i] = common.CopyBytes(column[i*cellSize : (i+1)*cellSize])
+	}
+	for i := range c.KZGCommitments {
+		copy(c.KZGCommitments[i][:], commitments[i*48:])
+	}
+	for i := range c.KZGProofs {
+		copy(c.KZGProofs[i][:], proofs[i*48:])
+	}
+
+	return nil
+}
+
+// MarshalDataColumnSidecarsSSZ marshals the sidecars into the SSZ encoding of a list of them. As the sidecars have a
+// variable size, the list starts with the offset of each of them.
+func MarshalDataColumnSidecarsSSZ(columns []*DataColumnSidecar) ([]byte, error) {
+	size := 4 * len(columns)
+	for _, column := range columns {
+		size += column.SizeSSZ()
+	}
+
+	result := make([]byte, 0, size)
+	offset := 4 * len(columns)
+	for _, column := range columns {
+		result = binary.LittleEndian.AppendUint32(result, uint32(offset))
+		offset += column.SizeSSZ()
+	}
+
+	for _, column := range columns {
+		var err error
+		if result, err = column.MarshalSSZTo(result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// unmarshalDataColumnSidecarsSSZ decodes the SSZ encoding of a list of sidecars, see MarshalDataColumnSidecarsSSZ. An
+// empty list decodes as nil.
+func unmarshalDataColumnSidecarsSSZ(b []byte) ([]*DataColumnSidecar, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 4 {
+		return nil, errors.New("ssz data column sidecars too short")
+	}
+
+	first := binary.LittleEndian.Uint32(b[:4])
+	if first == 0 || first%4 != 0 || int(first) > len(b) {
+		return nil, fmt.Errorf("invalid ssz data column sidecars offset: %d", first)
+	}
+
+	offsets := make([]int, first/4, first/4+1)
+	for i := range offsets {
+		offsets[i] = int(binary.LittleEndian.Uint32(b[i*4:]))
+		if offsets[i] > len(b) || (i > 0 && offsets[i] < offsets[i-1]) {
+			return nil, fmt.Errorf("invalid ssz data column sidecars offset: %d", offsets[i])
+		}
+	}
+	offsets = append(offsets, len(b))
+
+	result := make([]*DataColumnSidecar, len(offsets)-1)
+	for i := range result {
+		result[i] = new(DataColumnSidecar)
+		if err := result[i].UnmarshalSSZ(b[offsets[i]:offsets[i+1]]); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
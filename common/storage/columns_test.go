@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newDataColumnSidecars(count int, cells int) []*DataColumnSidecar {
+	result := make([]*DataColumnSidecar, count)
+	for i := range result {
+		column := &DataColumnSidecar{
+			Index:          uint64(i * 3),
+			Column:         make([]hexutil.Bytes, cells),
+			KZGCommitments: make([]deneb.KZGCommitment, cells),
+			KZGProofs:      make([]deneb.KZGProof, cells),
+			SignedBlockHeader: &phase0.SignedBeaconBlockHeader{
+				Message: &phase0.BeaconBlockHeader{Slot: 10, ProposerIndex: 7, ParentRoot: phase0.Root{1}},
+			},
+			KZGCommitmentsInclusionProof: [kzgCommitmentsInclusionProofDepth]common.Hash{{1}, {2}, {3}, {4}},
+		}
+		for j := range column.Column {
+			column.Column[j] = make(hexutil.Bytes, cellSize)
+			column.Column[j][0] = byte(i)
+			column.Column[j][1] = byte(j)
+			column.KZGCommitments[j][0] = byte(j)
+			column.KZGProofs[j][0] = byte(i)
+		}
+		result[i] = column
+	}
+	return result
+}
+
+func TestDataColumnSidecarsRoundtrip(t *testing.T) {
+	data := BlobData{
+		Header:             Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10, Commitments: 2},
+		BlobSidecars:       BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+		DataColumnSidecars: newDataColumnSidecars(3, 2),
+	}
+
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+		encoded, err := encodeBlobData(data, format)
+		require.NoError(t, err)
+
+		decoded, err := DecodeBlobData(encoded)
+		require.NoError(t, err)
+		expected := data
+		expected.Header.Format = format
+		require.Equal(t, expected, decoded)
+
+		reencoded, err := encodeBlobData(decoded, format)
+		require.NoError(t, err)
+		require.Equal(t, encoded, reencoded)
+	}
+
+	// The SSZ encoding stores the sidecars and columns as they are served
+	encoded, err := EncodeBlobDataSSZ(data)
+	require.NoError(t, err)
+	sidecars, err := data.BlobSidecars.MarshalSSZ()
+	require.NoError(t, err)
+	columns, err := MarshalDataColumnSidecarsSSZ(data.DataColumnSidecars)
+	require.NoError(t, err)
+	require.Equal(t, append(sidecars, columns...), encoded[len(sszPrefix)+sszColumnsFixedSize:])
+
+	// Blocks without blob sidecars or commitments may have columns too
+	columnsOnly := BlobData{
+		Header:             Header{BeaconBlockHash: common.Hash{4}, Slot: 11},
+		BlobSidecars:       BlobSidecars{Data: []*deneb.BlobSidecar{}},
+		DataColumnSidecars: newDataColumnSidecars(1, 0),
+	}
+	encoded, err = EncodeBlobDataSSZ(columnsOnly)
+	require.NoError(t, err)
+	decoded, err := DecodeBlobData(encoded)
+	require.NoError(t, err)
+	columnsOnly.Header.Format = flags.StorageFormatSSZ
+	require.Equal(t, columnsOnly, decoded)
+}
+
+func TestDecodeBlobDataWithoutColumns(t *testing.T) {
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	// Objects without columns are encoded as before columns were introduced
+	encoded, err := EncodeBlobData(data)
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(encoded, &fields))
+	require.NotContains(t, fields, "data_column_sidecars")
+
+	encoded, err = EncodeBlobDataSSZ(data)
+	require.NoError(t, err)
+	require.Equal(t, uint32(sszFixedSize), binary.LittleEndian.Uint32(encoded[len(sszPrefix)+40:]))
+
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+		encoded, err := encodeBlobData(data, format)
+		require.NoError(t, err)
+
+		decoded, err := DecodeBlobData(encoded)
+		require.NoError(t, err)
+		require.Nil(t, decoded.DataColumnSidecars)
+		expected := data
+		expected.Header.Format = format
+		require.Equal(t, expected, decoded)
+	}
+}
+
+func TestDecodeInvalidDataColumnSidecars(t *testing.T) {
+	data := BlobData{
+		Header:             Header{BeaconBlockHash: common.Hash{1}},
+		BlobSidecars:       BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+		DataColumnSidecars: newDataColumnSidecars(2, 1),
+	}
+	encoded, err := EncodeBlobDataSSZ(data)
+	require.NoError(t, err)
+
+	_, err = DecodeBlobData(encoded[:len(encoded)-1])
+	require.Error(t, err)
+
+	// The columns offset must be within the data, and after the blob sidecars
+	invalid := append([]byte{}, encoded...)
+	binary.LittleEndian.PutUint32(invalid[len(sszPrefix)+sszCommitmentsFixedSize:], uint32(len(encoded)))
+	_, err = DecodeBlobData(invalid)
+	require.Error(t, err)
+
+	binary.LittleEndian.PutUint32(invalid[len(sszPrefix)+sszCommitmentsFixedSize:], sszColumnsFixedSize-1)
+	_, err = DecodeBlobData(invalid)
+	require.Error(t, err)
+
+	// Cells must be complete
+	data.DataColumnSidecars[0].Column[0] = data.DataColumnSidecars[0].Column[0][:cellSize-1]
+	_, err = EncodeBlobDataSSZ(data)
+	require.Error(t, err)
+}
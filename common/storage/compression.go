@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdPrefix marks compressed blob data. It is followed by the version of the dictionary the blob data was compressed
+// with as a little-endian uint32, 0 if it was compressed without one, and the zstd frame of the blob data encoded in
+// either format. The dictionary version is recorded in every object, so that objects remain readable after newer
+// dictionaries are trained.
+var zstdPrefix = []byte{0x00, 'z', 's', 't'}
+
+const (
+	zstdHeaderSize = 4 + 4
+	// dictionaryPrefix is the key prefix under which compression dictionaries are stored by version.
+	dictionaryPrefix = "dict"
+	// dictionaryHistorySize is the size of the content of trained dictionaries, the default size of zstd's trainer.
+	dictionaryHistorySize = 112 << 10
+	// dictionaryBlockSize is the size of the blocks samples are split into for training, zstd's trainer takes samples of
+	// at most a block each.
+	dictionaryBlockSize = 64 << 10
+)
+
+// dictionaryStore is the data store the dictionaries of a blobCodec are stored in.
+type dictionaryStore interface {
+	ReadDictionary(ctx context.Context, version uint32) ([]byte, error)
+	LatestDictionaryVersion(ctx context.Context) (uint32, error)
+}
+
+// blobCodec encodes blob data in the format and with the compression blobs are written in, and decodes blob data
+// stored in any format and with any compression. Blob data is compressed with the latest dictionary of the data store,
+// looked up on the first write and replaced with useDictionary, and decompressed with the dictionary recorded in it,
+// which is loaded on first use.
+type blobCodec struct {
+	format      flags.StorageFormat
+	compression flags.StorageCompression
+	store       dictionaryStore
+	// metrics records the time taken to unmarshal blob data stored as SSZ, if it is not nil.
+	metrics Metricer
+
+	mu       sync.Mutex
+	version  uint32
+	encoder  *zstd.Encoder
+	decoders map[uint32]*zstd.Decoder
+}
+
+func newBlobCodec(format flags.StorageFormat, compression flags.StorageCompression, store dictionaryStore) *blobCodec {
+	return &blobCodec{
+		format:      format,
+		compression: compression,
+		store:       store,
+		decoders:    make(map[uint32]*zstd.Decoder),
+	}
+}
+
+// encode serializes the blob data into the format of the codec, compressing it if the codec compresses.
+func (c *blobCodec) encode(ctx context.Context, data BlobData) ([]byte, error) {
+	b, err := encodeBlobData(data, c.format)
+	if err != nil || c.compression != flags.StorageCompressionZstd {
+		return b, err
+	}
+
+	version, encoder, err := c.currentEncoder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, zstdHeaderSize+len(b)/2)
+	result = append(result, zstdPrefix...)
+	result = binary.LittleEndian.AppendUint32(result, version)
+	return encoder.EncodeAll(b, result), nil
+}
+
+// decode deserializes blob data stored in either format, decompressing it with its recorded dictionary if it is
+// compressed.
+func (c *blobCodec) decode(ctx context.Context, b []byte) (BlobData, error) {
+	if !bytes.HasPrefix(b, zstdPrefix) {
+		return c.unmarshal(b)
+	}
+
+	if len(b) < zstdHeaderSize {
+		return BlobData{}, errors.New("compressed blob data too short")
+	}
+
+	version := binary.LittleEndian.Uint32(b[len(zstdPrefix):zstdHeaderSize])
+	decoder, err := c.decoder(ctx, version)
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	decompressed, err := decoder.DecodeAll(b[zstdHeaderSize:], nil)
+	if err != nil {
+		return BlobData{}, fmt.Errorf("failed to decompress blob data: %w", err)
+	}
+
+	return c.unmarshal(decompressed)
+}
+
+// unmarshal deserializes uncompressed blob data stored in any format, recording the time taken if it is SSZ.
+func (c *blobCodec) unmarshal(b []byte) (BlobData, error) {
+	if format, _, err := storedFormat(b); c.metrics == nil || err != nil || format == flags.StorageFormatJSON {
+		return DecodeBlobData(b)
+	}
+
+	start := time.Now()
+	data, err := DecodeBlobData(b)
+	c.metrics.RecordSSZDuration(SSZUnmarshal, time.Since(start))
+	return data, err
+}
+
+// contentType returns the content type of the blob data written by the codec.
+func (c *blobCodec) contentType() string {
+	if c.compression == flags.StorageCompressionZstd {
+		return "application/zstd"
+	}
+
+	return contentType(c.format)
+}
+
+// useDictionary makes subsequent writes compress blob data with the given dictionary.
+func (c *blobCodec) useDictionary(version uint32, dict []byte) error {
+	encoder, err := newDictionaryEncoder(version, dict)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = version
+	c.encoder = encoder
+	return nil
+}
+
+// currentEncoder returns the encoder of the current dictionary, looking up the latest dictionary of the data store if
+// there is none yet.
+func (c *blobCodec) currentEncoder(ctx context.Context) (uint32, *zstd.Encoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.encoder != nil {
+		return c.version, c.encoder, nil
+	}
+
+	version, err := c.store.LatestDictionaryVersion(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to look up the latest dictionary: %w", err)
+	}
+
+	var dict []byte
+	if version != 0 {
+		if dict, err = c.store.ReadDictionary(ctx, version); err != nil {
+			return 0, nil, fmt.Errorf("failed to load dictionary %d: %w", version, err)
+		}
+	}
+
+	encoder, err := newDictionaryEncoder(version, dict)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	c.version = version
+	c.encoder = encoder
+	return version, encoder, nil
+}
+
+// newDictionaryEncoder creates an encoder compressing with the dictionary of the given version, or without a dictionary
+// for version 0.
+func newDictionaryEncoder(version uint32, dict []byte) (*zstd.Encoder, error) {
+	if version == 0 {
+		return zstd.NewWriter(nil)
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict))
+	if err != nil {
+		return nil, fmt.Errorf("invalid dictionary %d: %w", version, err)
+	}
+	return encoder, nil
+}
+
+func (c *blobCodec) decoder(ctx context.Context, version uint32) (*zstd.Decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if decoder, ok := c.decoders[version]; ok {
+		return decoder, nil
+	}
+
+	var opts []zstd.DOption
+	if version != 0 {
+		dict, err := c.store.ReadDictionary(ctx, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load dictionary %d: %w", version, err)
+		}
+		opts = append(opts, zstd.WithDecoderDicts(dict))
+	}
+
+	decoder, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dictionary %d: %w", version, err)
+	}
+
+	c.decoders[version] = decoder
+	return decoder, nil
+}
+
+// TrainDictionary trains a zstd dictionary of the given version from samples of blob data encoded in the storage format,
+// e.g. of recently archived blocks. Blob data shares its structure, e.g. the field names and headers of the sidecars,
+// so the content of the dictionary is taken from the start of every sample, in equal parts. Versions start at 1.
+func TrainDictionary(version uint32, samples [][]byte) (dict []byte, err error) {
+	if version == 0 {
+		return nil, errors.New("dictionary versions start at 1")
+	}
+
+	if len(samples) == 0 {
+		return nil, errors.New("no samples to train the dictionary with")
+	}
+
+	part := dictionaryHistorySize / len(samples)
+	history := make([]byte, 0, dictionaryHistorySize)
+	var contents [][]byte
+	for _, sample := range samples {
+		history = append(history, sample[:min(part, len(sample))]...)
+		for len(sample) > 0 {
+			n := min(dictionaryBlockSize, len(sample))
+			contents = append(contents, sample[:n])
+			sample = sample[n:]
+		}
+	}
+
+	// zstd's trainer panics on samples with too few repeated sequences, e.g. of random data
+	defer func() {
+		if r := recover(); r != nil {
+			dict, err = nil, fmt.Errorf("failed to train dictionary: %v", r)
+		}
+	}()
+
+	defaultOffsets := [3]int{1, 4, 8}
+	dict, err = zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       version,
+		Contents: contents,
+		History:  history,
+		Offsets:  defaultOffsets,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The trainer picks the most used repeat offsets of the samples, which may reach beyond the content of the
+	// dictionary, making decoders reject it. They are the last field before the content, and are reset to the defaults.
+	end := len(dict) - len(history)
+	if end < 12 || !bytes.Equal(dict[end:], history) {
+		return nil, errors.New("unexpected layout of trained dictionary")
+	}
+	offsets := dict[end-12 : end]
+	for i, offset := range defaultOffsets {
+		if binary.LittleEndian.Uint32(offsets[i*4:]) > uint32(len(history)) {
+			binary.LittleEndian.PutUint32(offsets[i*4:], uint32(offset))
+		}
+	}
+
+	if err := checkDictionary(dict, samples); err != nil {
+		return nil, fmt.Errorf("trained dictionary is unusable: %w", err)
+	}
+
+	return dict, nil
+}
+
+// checkDictionary makes sure that the dictionary loads, and that every sample compressed with it decompresses to the
+// sample again.
+func checkDictionary(dict []byte, samples [][]byte) error {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict))
+	if err != nil {
+		return err
+	}
+	defer encoder.Close()
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	for _, sample := range samples {
+		decoded, err := decoder.DecodeAll(encoder.EncodeAll(sample, nil), nil)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(decoded, sample) {
+			return errors.New("sample doesn't round-trip")
+		}
+	}
+
+	return nil
+}
+
+// EncodeBlobDataFormat serializes the blob data into the given format, uncompressed, e.g. to sample it for training a
+// dictionary.
+func EncodeBlobDataFormat(data BlobData, format flags.StorageFormat) ([]byte, error) {
+	return encodeBlobData(data, format)
+}
+
+func dictionaryKey(version uint32) string {
+	return path.Join(dictionaryPrefix, strconv.FormatUint(uint64(version), 10))
+}
+
+// parseDictionaryKey returns the version of the dictionary stored under the key, if it is a dictionary key.
+func parseDictionaryKey(key string) (uint32, bool) {
+	dir, name := path.Split(key)
+	if dir != dictionaryPrefix+"/" {
+		return 0, false
+	}
+
+	version, err := strconv.ParseUint(name, 10, 32)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+
+	return uint32(version), true
+}
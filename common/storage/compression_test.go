@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func newCompressedFileStorage(t *testing.T, dir string, format flags.StorageFormat) *FileStorage {
+	fs := NewFileStorage(dir, testlog.Logger(t, log.LvlInfo))
+	fs.codec = newBlobCodec(format, flags.StorageCompressionZstd, fs)
+	return fs
+}
+
+// newCompressionBlock returns a block whose blobs share structure, with half of every field element drawn from a small
+// set, so that a dictionary can be trained from them.
+func newCompressionBlock(t *testing.T, slot uint64) BlobData {
+	phrases := blobtest.RandBytes(t, 16*16)
+	sidecars := blobtest.NewBlobSidecars(t, 2)
+	for _, sidecar := range sidecars {
+		for i := 0; i < len(sidecar.Blob); i += 32 {
+			phrase := (i / 32 * 7) % 16
+			copy(sidecar.Blob[i:i+16], phrases[phrase*16:])
+		}
+	}
+
+	return BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{byte(slot)}, Slot: slot},
+		BlobSidecars: BlobSidecars{Data: sidecars},
+	}
+}
+
+// storedDictionaryVersion returns the dictionary version recorded in the stored object of the block.
+func storedDictionaryVersion(t *testing.T, fs *FileStorage, hash common.Hash) uint32 {
+	b, err := os.ReadFile(fs.fileName(hash))
+	require.NoError(t, err)
+	require.Equal(t, zstdPrefix, b[:len(zstdPrefix)])
+	return binary.LittleEndian.Uint32(b[len(zstdPrefix):zstdHeaderSize])
+}
+
+func trainTestDictionary(t *testing.T, fs *FileStorage, format flags.StorageFormat, version uint32, blocks ...BlobData) {
+	var samples [][]byte
+	for _, data := range blocks {
+		sample, err := EncodeBlobDataFormat(data, format)
+		require.NoError(t, err)
+		samples = append(samples, sample)
+	}
+
+	dict, err := TrainDictionary(version, samples)
+	require.NoError(t, err)
+	require.NoError(t, fs.WriteDictionary(context.Background(), version, dict))
+}
+
+func TestCompressionDictionaryVersions(t *testing.T) {
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			fs := newCompressedFileStorage(t, dir, format)
+
+			blocks := []BlobData{newCompressionBlock(t, 1), newCompressionBlock(t, 2), newCompressionBlock(t, 3)}
+
+			// Without a dictionary, blobs are compressed without one
+			require.NoError(t, fs.Write(ctx, blocks[0]))
+			require.Equal(t, uint32(0), storedDictionaryVersion(t, fs, blocks[0].Header.BeaconBlockHash))
+
+			trainTestDictionary(t, fs, format, 1, blocks[0])
+			require.NoError(t, fs.Write(ctx, blocks[1]))
+			require.Equal(t, uint32(1), storedDictionaryVersion(t, fs, blocks[1].Header.BeaconBlockHash))
+
+			trainTestDictionary(t, fs, format, 2, blocks[0], blocks[1])
+			require.NoError(t, fs.Write(ctx, blocks[2]))
+			require.Equal(t, uint32(2), storedDictionaryVersion(t, fs, blocks[2].Header.BeaconBlockHash))
+
+			latest, err := fs.LatestDictionaryVersion(ctx)
+			require.NoError(t, err)
+			require.Equal(t, uint32(2), latest)
+
+			// Every object remains readable with its recorded dictionary, including by a store that loads them on first
+			// use
+			for _, store := range []*FileStorage{fs, newCompressedFileStorage(t, dir, format)} {
+				for _, data := range blocks {
+					stored, err := store.Read(ctx, data.Header.BeaconBlockHash)
+					require.NoError(t, err)
+					data.Header.Format = format
+					require.Equal(t, data.Header, stored.Header)
+					require.Equal(t, data.BlobSidecars.Data, stored.BlobSidecars.Data)
+				}
+			}
+
+			// A store compresses with the latest dictionary of the data store from its first write
+			restarted := newCompressedFileStorage(t, dir, format)
+			next := newCompressionBlock(t, 4)
+			require.NoError(t, restarted.Write(ctx, next))
+			require.Equal(t, uint32(2), storedDictionaryVersion(t, restarted, next.Header.BeaconBlockHash))
+		})
+	}
+}
+
+func TestCompressedBlobsReadableUncompressed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	compressed := newCompressedFileStorage(t, dir, flags.StorageFormatJSON)
+
+	data := newCompressionBlock(t, 1)
+	require.NoError(t, compressed.Write(ctx, data))
+
+	// Reads decompress regardless of the compression the store writes with
+	uncompressed := NewFileStorage(dir, testlog.Logger(t, log.LvlInfo))
+	stored, err := uncompressed.Read(ctx, data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	require.Equal(t, data.BlobSidecars.Data, stored.BlobSidecars.Data)
+}
+
+func TestTrainDictionaryRandomSamples(t *testing.T) {
+	_, err := TrainDictionary(1, [][]byte{blobtest.RandBytes(t, 1<<16)})
+	require.Error(t, err)
+}
+
+func TestInvalidDictionary(t *testing.T) {
+	fs := newCompressedFileStorage(t, t.TempDir(), flags.StorageFormatJSON)
+
+	err := fs.WriteDictionary(context.Background(), 1, []byte("not a dictionary"))
+	require.ErrorIs(t, err, ErrMarshaling)
+
+	latest, err := fs.LatestDictionaryVersion(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), latest)
+}
+
+func TestTrainedDictionariesLoad(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs := newCompressedFileStorage(t, dir, flags.StorageFormatSSZ)
+
+	var blocks []BlobData
+	for i := 0; i < 20; i++ {
+		version := uint32(i + 1)
+		trainTestDictionary(t, fs, flags.StorageFormatSSZ, version, newCompressionBlock(t, uint64(i)))
+
+		data := newCompressionBlock(t, uint64(i+1))
+		require.NoError(t, fs.Write(ctx, data))
+		require.Equal(t, version, storedDictionaryVersion(t, fs, data.Header.BeaconBlockHash))
+		blocks = append(blocks, data)
+	}
+
+	// Every block decodes with the dictionary it was compressed with, also by a store that loads them on first use
+	for _, store := range []*FileStorage{fs, newCompressedFileStorage(t, dir, flags.StorageFormatSSZ)} {
+		for _, data := range blocks {
+			stored, err := store.Read(ctx, data.Header.BeaconBlockHash)
+			require.NoError(t, err)
+			require.Equal(t, data.BlobSidecars.Data, stored.BlobSidecars.Data)
+		}
+	}
+}
@@ -3,23 +3,41 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 )
 
+// instanceIDAttr is the extended attribute under which the ID of the instance that wrote a file is stored.
+const instanceIDAttr = "user.blob-archiver.instance-id"
+
 type FileStorage struct {
 	log       log.Logger
 	directory string
+	// codec encodes blobs in the format and with the compression they are written in, see NewStorage.
+	codec *blobCodec
+	// instanceID is recorded in an extended attribute of every file written, if it is not empty.
+	instanceID string
+	// keyScheme is how blocks are named, see NewStorage. Blocks are only named by slot with flags.KeySchemeSlot.
+	keyScheme flags.KeyScheme
 }
 
+// NewFileStorage creates a file storage writing blobs as uncompressed JSON. Use NewStorage to write blobs in another
+// format or compressed.
 func NewFileStorage(dir string, l log.Logger) *FileStorage {
-	return &FileStorage{
+	s := &FileStorage{
 		log:       l,
 		directory: dir,
 	}
+	s.codec = newBlobCodec(flags.StorageFormatJSON, flags.StorageCompressionNone, s)
+	return s
 }
 
 func (s *FileStorage) Exists(_ context.Context, hash common.Hash) (bool, error) {
@@ -33,7 +51,7 @@ func (s *FileStorage) Exists(_ context.Context, hash common.Hash) (bool, error)
 	return true, nil
 }
 
-func (s *FileStorage) Read(_ context.Context, hash common.Hash) (BlobData, error) {
+func (s *FileStorage) Read(ctx context.Context, hash common.Hash) (BlobData, error) {
 	data, err := os.ReadFile(s.fileName(hash))
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -42,8 +60,7 @@ func (s *FileStorage) Read(_ context.Context, hash common.Hash) (BlobData, error
 
 		return BlobData{}, err
 	}
-	var result BlobData
-	err = json.Unmarshal(data, &result)
+	result, err := s.codec.decode(ctx, data)
 	if err != nil {
 		s.log.Warn("error decoding blob", "err", err, "hash", hash.String())
 		return BlobData{}, ErrMarshaling
@@ -51,13 +68,13 @@ func (s *FileStorage) Read(_ context.Context, hash common.Hash) (BlobData, error
 	return result, nil
 }
 
-func (s *FileStorage) Write(_ context.Context, data BlobData) error {
-	b, err := json.Marshal(data)
+func (s *FileStorage) Write(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
 	if err != nil {
 		s.log.Warn("error encoding blob", "err", err)
 		return ErrMarshaling
 	}
-	err = os.WriteFile(s.fileName(data.Header.BeaconBlockHash), b, 0644)
+	err = s.writeFileAtomic(s.fileName(data.Header.BeaconBlockHash), b)
 	if err != nil {
 		s.log.Warn("error writing blob", "err", err)
 		return err
@@ -67,6 +84,854 @@ func (s *FileStorage) Write(_ context.Context, data BlobData) error {
 	return nil
 }
 
+// WriteIfNotExists writes the blob to a temporary file and hard links it into place, which fails if the blob exists.
+func (s *FileStorage) WriteIfNotExists(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	name := s.fileName(data.Header.BeaconBlockHash)
+	tmp, err := os.CreateTemp(s.directory, "."+path.Base(name)+".*.tmp")
+	if err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return err
+	}
+	s.tagInstance(tmp.Name())
+
+	err = os.Link(tmp.Name(), name)
+	if errors.Is(err, os.ErrExist) {
+		stored, err := os.ReadFile(name)
+		if err != nil {
+			s.log.Warn("error reading existing blob", "err", err)
+			return err
+		}
+
+		return compareStoredBlobData(ctx, s.codec, stored, data)
+	}
+
+	if err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *FileStorage) Stat(ctx context.Context, hash common.Hash) (Header, error) {
+	data, err := s.Read(ctx, hash)
+	if err != nil {
+		return Header{}, err
+	}
+
+	return data.Header, nil
+}
+
+func (s *FileStorage) List(_ context.Context, fn func(hash common.Hash) error) error {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		s.log.Warn("error listing blobs", "err", err)
+		return ErrStorage
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isBlobKey(entry.Name()) {
+			continue
+		}
+
+		if err := fn(common.HexToHash(entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStorage) Delete(_ context.Context, hash common.Hash) error {
+	err := os.Remove(s.fileName(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		s.log.Warn("error deleting blob", "err", err, "hash", hash.String())
+		return err
+	}
+
+	err = os.Remove(path.Join(s.directory, blockKey(hash)))
+	if err != nil && !os.IsNotExist(err) {
+		s.log.Warn("error deleting block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	err = os.RemoveAll(path.Join(s.directory, partialDir(hash)))
+	if err != nil {
+		s.log.Warn("error deleting partial blobs", "err", err, "hash", hash.String())
+		return err
+	}
+
+	s.log.Info("deleted blob", "hash", hash.String())
+	return nil
+}
+
+func (s *FileStorage) ReadSlotIndex(_ context.Context, slot uint64) (common.Hash, error) {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.readSlotKey(slot)
+	}
+
+	data, err := os.ReadFile(s.slotIndexFileName(slot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.Hash{}, ErrNotFound
+		}
+
+		return common.Hash{}, err
+	}
+
+	hash := common.HexToHash(string(data))
+	if hash == (common.Hash{}) {
+		s.log.Warn("invalid slot index entry", "slot", slot)
+		return common.Hash{}, ErrMarshaling
+	}
+
+	return hash, nil
+}
+
+func (s *FileStorage) ListSlotIndex(ctx context.Context, from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.listSlotKeys(from, to, fn)
+	}
+
+	entries, err := os.ReadDir(path.Join(s.directory, slotIndexPrefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		s.log.Warn("error listing slot index", "err", err)
+		return ErrStorage
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return listSlotIndex(ctx, s, names, from, to, fn)
+}
+
+func (s *FileStorage) WriteSlotIndex(_ context.Context, slot uint64, hash common.Hash) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.writeSlotKey(slot, hash)
+	}
+
+	err := os.MkdirAll(path.Join(s.directory, slotIndexPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating slot index directory", "err", err)
+		return err
+	}
+
+	err = s.writeFile(s.slotIndexFileName(slot), []byte(hash.String()))
+	if err != nil {
+		s.log.Warn("error writing slot index", "err", err, "slot", slot)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) DeleteSlotIndex(_ context.Context, slot uint64) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.deleteSlotKeys(slot)
+	}
+
+	err := os.Remove(s.slotIndexFileName(slot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		s.log.Warn("error deleting slot index", "err", err, "slot", slot)
+		return err
+	}
+
+	return nil
+}
+
+// readSlotKey is ReadSlotIndex with the slot key scheme, which finds the block of the slot in the slot's directory.
+func (s *FileStorage) readSlotKey(slot uint64) (common.Hash, error) {
+	hashes, err := s.slotKeyHashes(slot)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if len(hashes) == 0 {
+		return common.Hash{}, ErrNotFound
+	}
+
+	return hashes[0], nil
+}
+
+// listSlotKeys is ListSlotIndex with the slot key scheme. Slot directories are listed in the order of their names,
+// which is slot order, so only the directories within the range are read, and listing stops at the end of the range.
+func (s *FileStorage) listSlotKeys(from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	entries, err := os.ReadDir(path.Join(s.directory, slotKeyPrefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		s.log.Warn("error listing slot keys", "err", err)
+		return ErrStorage
+	}
+
+	for _, entry := range entries {
+		slot, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() || slot < from {
+			continue
+		}
+
+		if slot > to {
+			break
+		}
+
+		hashes, err := s.slotKeyHashes(slot)
+		if err != nil {
+			return err
+		}
+
+		if len(hashes) > 0 {
+			if err := fn(slot, hashes[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeSlotKey is WriteSlotIndex with the slot key scheme. Other blocks named by the slot are removed before the block
+// is named by it, so the slot is briefly without a block rather than with two.
+func (s *FileStorage) writeSlotKey(slot uint64, hash common.Hash) error {
+	dir := path.Join(s.directory, slotKeyDir(slot))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.log.Warn("error creating slot key directory", "err", err, "slot", slot)
+		return err
+	}
+
+	hashes, err := s.slotKeyHashes(slot)
+	if err != nil {
+		return err
+	}
+
+	named := false
+	for _, other := range hashes {
+		if other == hash {
+			named = true
+			continue
+		}
+
+		if err := os.Remove(path.Join(dir, other.String())); err != nil && !os.IsNotExist(err) {
+			s.log.Warn("error removing stale slot key", "err", err, "slot", slot, "hash", other.String())
+			return err
+		}
+	}
+
+	if named {
+		return nil
+	}
+
+	if err := s.writeFile(path.Join(s.directory, slotKey(slot, hash)), nil); err != nil {
+		s.log.Warn("error writing slot key", "err", err, "slot", slot)
+		return err
+	}
+
+	return nil
+}
+
+// deleteSlotKeys is DeleteSlotIndex with the slot key scheme, which removes the slot's directory.
+func (s *FileStorage) deleteSlotKeys(slot uint64) error {
+	hashes, err := s.slotKeyHashes(slot)
+	if err != nil {
+		return err
+	}
+
+	if len(hashes) == 0 {
+		return ErrNotFound
+	}
+
+	if err := os.RemoveAll(path.Join(s.directory, slotKeyDir(slot))); err != nil {
+		s.log.Warn("error deleting slot keys", "err", err, "slot", slot)
+		return err
+	}
+
+	return nil
+}
+
+// slotKeyHashes returns the hashes of the blocks named by the slot with the slot key scheme, in the order of their
+// names.
+func (s *FileStorage) slotKeyHashes(slot uint64) ([]common.Hash, error) {
+	entries, err := os.ReadDir(path.Join(s.directory, slotKeyDir(slot)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		s.log.Warn("error reading slot keys", "err", err, "slot", slot)
+		return nil, ErrStorage
+	}
+
+	var hashes []common.Hash
+	for _, entry := range entries {
+		if !entry.IsDir() && isBlobKey(entry.Name()) {
+			hashes = append(hashes, common.HexToHash(entry.Name()))
+		}
+	}
+
+	return hashes, nil
+}
+
+func (s *FileStorage) ReadLatest(_ context.Context) (Header, error) {
+	data, err := os.ReadFile(path.Join(s.directory, latestKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Header{}, ErrNotFound
+		}
+
+		return Header{}, err
+	}
+
+	var header Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		s.log.Warn("error decoding latest pointer", "err", err)
+		return Header{}, ErrMarshaling
+	}
+
+	return header, nil
+}
+
+// WriteLatest replaces the pointer atomically, so that readers observe either the previous or the new pointer.
+func (s *FileStorage) WriteLatest(_ context.Context, header Header) error {
+	b, err := json.Marshal(header)
+	if err != nil {
+		s.log.Warn("error encoding latest pointer", "err", err)
+		return ErrMarshaling
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, latestKey), b)
+	if err != nil {
+		s.log.Warn("error writing latest pointer", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadBackfillCheckpoint(_ context.Context) ([]Header, error) {
+	data, err := os.ReadFile(path.Join(s.directory, backfillCheckpointKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	var headers []Header
+	if err := json.Unmarshal(data, &headers); err != nil {
+		s.log.Warn("error decoding backfill checkpoint", "err", err)
+		return nil, ErrMarshaling
+	}
+
+	return headers, nil
+}
+
+// WriteBackfillCheckpoint replaces the checkpoint atomically, so that readers observe either the previous or the new
+// checkpoint.
+func (s *FileStorage) WriteBackfillCheckpoint(_ context.Context, headers []Header) error {
+	b, err := json.Marshal(headers)
+	if err != nil {
+		s.log.Warn("error encoding backfill checkpoint", "err", err)
+		return ErrMarshaling
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, backfillCheckpointKey), b)
+	if err != nil {
+		s.log.Warn("error writing backfill checkpoint", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadCIDIndex(_ context.Context, hash common.Hash) ([]string, error) {
+	data, err := os.ReadFile(path.Join(s.directory, cidIndexKey(hash)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	var cids []string
+	if err := json.Unmarshal(data, &cids); err != nil {
+		s.log.Warn("error decoding cid index", "err", err, "hash", hash.String())
+		return nil, ErrMarshaling
+	}
+
+	return cids, nil
+}
+
+func (s *FileStorage) WriteCIDIndex(_ context.Context, hash common.Hash, cids []string) error {
+	b, err := json.Marshal(cids)
+	if err != nil {
+		s.log.Warn("error encoding cid index", "err", err, "hash", hash.String())
+		return ErrMarshaling
+	}
+
+	err = os.MkdirAll(path.Join(s.directory, cidIndexPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating cid index directory", "err", err)
+		return err
+	}
+
+	err = s.writeFile(path.Join(s.directory, cidIndexKey(hash)), b)
+	if err != nil {
+		s.log.Warn("error writing cid index", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadExecutionIndex(_ context.Context, number uint64) (common.Hash, error) {
+	data, err := os.ReadFile(path.Join(s.directory, executionIndexKey(number)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.Hash{}, ErrNotFound
+		}
+
+		return common.Hash{}, err
+	}
+
+	hash := common.HexToHash(string(data))
+	if hash == (common.Hash{}) {
+		s.log.Warn("invalid execution index entry", "number", number)
+		return common.Hash{}, ErrMarshaling
+	}
+
+	return hash, nil
+}
+
+func (s *FileStorage) WriteExecutionIndex(_ context.Context, number uint64, hash common.Hash) error {
+	err := os.MkdirAll(path.Join(s.directory, executionIndexPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating execution index directory", "err", err)
+		return err
+	}
+
+	err = s.writeFile(path.Join(s.directory, executionIndexKey(number)), []byte(hash.String()))
+	if err != nil {
+		s.log.Warn("error writing execution index", "err", err, "number", number)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) StageWrite(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding staged blob", "err", err)
+		return ErrMarshaling
+	}
+
+	err = os.MkdirAll(path.Join(s.directory, stagedPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating staging directory", "err", err)
+		return err
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, stagedKey(data.Header.BeaconBlockHash)), b)
+	if err != nil {
+		s.log.Warn("error writing staged blob", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// CommitStaged renames the staged file into place, which is atomic as the staging directory is in the same directory.
+func (s *FileStorage) CommitStaged(_ context.Context, hash common.Hash) error {
+	err := os.Rename(path.Join(s.directory, stagedKey(hash)), s.fileName(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		s.log.Warn("error committing staged blob", "err", err, "hash", hash.String())
+		return err
+	}
+
+	s.log.Info("wrote blob", "hash", hash.String())
+	return nil
+}
+
+func (s *FileStorage) DiscardStaged(_ context.Context, hash common.Hash) error {
+	err := os.Remove(path.Join(s.directory, stagedKey(hash)))
+	if err != nil && !os.IsNotExist(err) {
+		s.log.Warn("error discarding staged blob", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadLease(_ context.Context) (Lease, error) {
+	entries, err := os.ReadDir(path.Join(s.directory, leasePrefix))
+	if err != nil && !os.IsNotExist(err) {
+		s.log.Warn("error listing lease", "err", err)
+		return Lease{}, ErrStorage
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	term, found := latestLeaseTerm(names)
+	if !found {
+		return Lease{}, ErrNotFound
+	}
+
+	data, err := os.ReadFile(path.Join(s.directory, leaseKey(term)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Deleted by the writer of the next term since it was listed
+			return Lease{}, ErrNotFound
+		}
+
+		s.log.Warn("error reading lease", "err", err)
+		return Lease{}, ErrStorage
+	}
+
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		s.log.Warn("error decoding lease", "err", err)
+		return Lease{}, ErrMarshaling
+	}
+
+	return lease, nil
+}
+
+// WriteLease writes the term to a temporary file and hard links it into place, which fails if the term exists.
+func (s *FileStorage) WriteLease(_ context.Context, lease Lease) error {
+	b, err := json.Marshal(lease)
+	if err != nil {
+		s.log.Warn("error encoding lease", "err", err)
+		return ErrMarshaling
+	}
+
+	dir := path.Join(s.directory, leasePrefix)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.log.Warn("error creating lease directory", "err", err)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".lease.*.tmp")
+	if err != nil {
+		s.log.Warn("error writing lease", "err", err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.log.Warn("error writing lease", "err", err)
+		return err
+	}
+
+	err = os.Link(tmp.Name(), path.Join(s.directory, leaseKey(lease.Term)))
+	if errors.Is(err, os.ErrExist) {
+		return ErrLeaseTaken
+	}
+	if err != nil {
+		s.log.Warn("error writing lease", "err", err)
+		return err
+	}
+
+	if lease.Term > 0 {
+		if err := os.Remove(path.Join(s.directory, leaseKey(lease.Term-1))); err != nil && !os.IsNotExist(err) {
+			s.log.Warn("error deleting previous lease term", "err", err, "term", lease.Term-1)
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadBlock(_ context.Context, hash common.Hash) (*spec.VersionedSignedBeaconBlock, error) {
+	data, err := os.ReadFile(path.Join(s.directory, blockKey(hash)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	block, err := decodeBlock(data)
+	if err != nil {
+		s.log.Warn("error decoding block", "err", err, "hash", hash.String())
+		return nil, ErrMarshaling
+	}
+
+	return block, nil
+}
+
+func (s *FileStorage) WriteBlock(_ context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error {
+	b, err := encodeBlock(block)
+	if err != nil {
+		s.log.Warn("error encoding block", "err", err, "hash", hash.String())
+		return ErrMarshaling
+	}
+
+	err = os.MkdirAll(path.Join(s.directory, blockPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating block directory", "err", err)
+		return err
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, blockKey(hash)), b)
+	if err != nil {
+		s.log.Warn("error writing block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ReadDictionary(_ context.Context, version uint32) ([]byte, error) {
+	dict, err := os.ReadFile(path.Join(s.directory, dictionaryKey(version)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return dict, nil
+}
+
+func (s *FileStorage) LatestDictionaryVersion(_ context.Context) (uint32, error) {
+	entries, err := os.ReadDir(path.Join(s.directory, dictionaryPrefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		s.log.Warn("error listing dictionaries", "err", err)
+		return 0, err
+	}
+
+	latest := uint32(0)
+	for _, entry := range entries {
+		if version, ok := parseDictionaryKey(path.Join(dictionaryPrefix, entry.Name())); ok {
+			latest = max(latest, version)
+		}
+	}
+
+	return latest, nil
+}
+
+func (s *FileStorage) WriteDictionary(_ context.Context, version uint32, dict []byte) error {
+	if err := s.codec.useDictionary(version, dict); err != nil {
+		s.log.Warn("error loading dictionary", "err", err, "version", version)
+		return ErrMarshaling
+	}
+
+	err := os.MkdirAll(path.Join(s.directory, dictionaryPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating dictionary directory", "err", err)
+		return err
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, dictionaryKey(version)), dict)
+	if err != nil {
+		s.log.Warn("error writing dictionary", "err", err, "version", version)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) ListWanted(_ context.Context, fn func(hash common.Hash) error) error {
+	entries, err := os.ReadDir(path.Join(s.directory, wantedPrefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		s.log.Warn("error listing wanted blocks", "err", err)
+		return ErrStorage
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isBlobKey(entry.Name()) {
+			continue
+		}
+
+		if err := fn(common.HexToHash(entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStorage) WriteWanted(_ context.Context, hash common.Hash) error {
+	err := os.MkdirAll(path.Join(s.directory, wantedPrefix), 0755)
+	if err != nil {
+		s.log.Warn("error creating wanted directory", "err", err)
+		return err
+	}
+
+	err = s.writeFile(path.Join(s.directory, wantedKey(hash)), nil)
+	if err != nil {
+		s.log.Warn("error writing wanted block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStorage) DeleteWanted(_ context.Context, hash common.Hash) error {
+	err := os.Remove(path.Join(s.directory, wantedKey(hash)))
+	if err != nil && !os.IsNotExist(err) {
+		s.log.Warn("error deleting wanted block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+// ReadPartials reads the files of the block's partial blob data directory, which are listed in the order of their names.
+func (s *FileStorage) ReadPartials(ctx context.Context, hash common.Hash) ([]BlobData, error) {
+	dir := path.Join(s.directory, partialDir(hash))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		s.log.Warn("error listing partial blobs", "err", err, "hash", hash.String())
+		return nil, ErrStorage
+	}
+
+	var partials []BlobData
+	for _, entry := range entries {
+		// Partial blob data being written is in a hidden temporary file until it is complete, see writeFileAtomic
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		b, err := os.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			s.log.Warn("error reading partial blob", "err", err, "hash", hash.String(), "name", entry.Name())
+			return nil, ErrStorage
+		}
+
+		data, err := s.codec.decode(ctx, b)
+		if err != nil {
+			s.log.Warn("error decoding partial blob", "err", err, "hash", hash.String(), "name", entry.Name())
+			return nil, ErrMarshaling
+		}
+
+		partials = append(partials, data)
+	}
+
+	return partials, nil
+}
+
+func (s *FileStorage) WritePartial(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding partial blob", "err", err)
+		return ErrMarshaling
+	}
+
+	err = os.MkdirAll(path.Join(s.directory, partialDir(data.Header.BeaconBlockHash)), 0755)
+	if err != nil {
+		s.log.Warn("error creating partial blob directory", "err", err)
+		return err
+	}
+
+	err = s.writeFileAtomic(path.Join(s.directory, partialKey(data)), b)
+	if err != nil {
+		s.log.Warn("error writing partial blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote partial blob", "hash", data.Header.BeaconBlockHash.String(), "sidecars", len(data.BlobSidecars.Data))
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file and renames it into place, so that concurrent readers never
+// observe a partially written file.
+func (s *FileStorage) writeFileAtomic(name string, data []byte) error {
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	s.tagInstance(tmp)
+	return os.Rename(tmp, name)
+}
+
+// writeFile writes the data to the file, tagged with the instance ID.
+func (s *FileStorage) writeFile(name string, data []byte) error {
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return err
+	}
+
+	s.tagInstance(name)
+	return nil
+}
+
+// tagInstance records the instance ID on the file, if it is set. Failing to tag a file doesn't fail the write, e.g. on
+// file systems without extended attributes.
+func (s *FileStorage) tagInstance(name string) {
+	if s.instanceID == "" {
+		return
+	}
+
+	if err := setInstanceIDAttr(name, s.instanceID); err != nil {
+		s.log.Debug("error tagging file with instance id", "err", err, "file", name)
+	}
+}
+
 func (s *FileStorage) fileName(hash common.Hash) string {
 	return path.Join(s.directory, hash.String())
 }
+
+func (s *FileStorage) slotIndexFileName(slot uint64) string {
+	return path.Join(s.directory, slotIndexKey(slot))
+}
@@ -3,9 +3,18 @@ package storage
 import (
 	"context"
 	"errors"
+	"math"
+	"math/big"
 	"os"
+	"path"
 	"testing"
+	"time"
 
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -76,6 +85,239 @@ func TestRead(t *testing.T) {
 	runTestRead(t, fs)
 }
 
+func runTestSlotIndex(t *testing.T, s DataStore) {
+	id := common.Hash{1, 2, 3}
+
+	_, err := s.ReadSlotIndex(context.Background(), 10)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	err = WriteWithSlotIndex(context.Background(), s, BlobData{
+		Header: Header{
+			BeaconBlockHash: id,
+			Slot:            10,
+		},
+		BlobSidecars: BlobSidecars{},
+	})
+	require.NoError(t, err)
+
+	hash, err := s.ReadSlotIndex(context.Background(), 10)
+	require.NoError(t, err)
+	require.Equal(t, id, hash)
+
+	data, err := s.Read(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), data.Header.Slot)
+}
+
+func TestSlotIndex(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestSlotIndex(t, fs)
+}
+
+func runTestListSlotIndex(t *testing.T, s DataStore) {
+	ctx := context.Background()
+	list := func(from, to uint64) []uint64 {
+		var slots []uint64
+		err := s.ListSlotIndex(ctx, from, to, func(slot uint64, hash common.Hash) error {
+			require.Equal(t, common.BigToHash(new(big.Int).SetUint64(slot)), hash)
+			slots = append(slots, slot)
+			return nil
+		})
+		require.NoError(t, err)
+		return slots
+	}
+
+	require.Empty(t, list(0, math.MaxUint64))
+
+	// Slots are written out of order, and don't sort lexicographically
+	for _, slot := range []uint64{1000, 11, 5, 100, 9, 10} {
+		require.NoError(t, WriteWithSlotIndex(ctx, s, BlobData{
+			Header: Header{BeaconBlockHash: common.BigToHash(new(big.Int).SetUint64(slot)), Slot: slot},
+		}))
+	}
+
+	// Blobs without a slot index entry aren't listed
+	require.NoError(t, s.Write(ctx, BlobData{Header: Header{BeaconBlockHash: common.Hash{1}, Slot: 50}}))
+
+	require.Equal(t, []uint64{5, 9, 10, 11, 100, 1000}, list(0, math.MaxUint64))
+	require.Equal(t, []uint64{9, 10, 11, 100}, list(9, 100))
+	require.Equal(t, []uint64{1000}, list(1000, 1000))
+	require.Empty(t, list(12, 99))
+
+	require.NoError(t, DeleteWithSlotIndex(ctx, s, Header{BeaconBlockHash: common.BigToHash(big.NewInt(10)), Slot: 10}))
+	require.Equal(t, []uint64{9, 11}, list(9, 11))
+
+	// Listing stops at the first error
+	stop := errors.New("stop")
+	var visited int
+	err := s.ListSlotIndex(ctx, 0, math.MaxUint64, func(uint64, common.Hash) error {
+		visited++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, visited)
+}
+
+func TestListSlotIndex(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestListSlotIndex(t, fs)
+}
+
+func runTestSlotKeys(t *testing.T, s DataStore) {
+	ctx := context.Background()
+
+	// Slots at the edges of the range are named in order too
+	for _, slot := range []uint64{math.MaxUint64, 0, 10} {
+		require.NoError(t, WriteWithSlotIndex(ctx, s, BlobData{
+			Header: Header{BeaconBlockHash: common.BigToHash(new(big.Int).SetUint64(slot + 1)), Slot: slot},
+		}))
+	}
+
+	// A reorged slot names its new block only
+	require.NoError(t, WriteWithSlotIndex(ctx, s, BlobData{Header: Header{BeaconBlockHash: common.Hash{1}, Slot: 10}}))
+	hash, err := s.ReadSlotIndex(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{1}, hash)
+
+	var slots []uint64
+	var hashes []common.Hash
+	require.NoError(t, s.ListSlotIndex(ctx, 0, math.MaxUint64, func(slot uint64, hash common.Hash) error {
+		slots = append(slots, slot)
+		hashes = append(hashes, hash)
+		return nil
+	}))
+	require.Equal(t, []uint64{0, 10, math.MaxUint64}, slots)
+	require.Equal(t, []common.Hash{common.BigToHash(big.NewInt(1)), {1}, {}}, hashes)
+
+	// Blocks are still stored, and listed, by root
+	var roots int
+	require.NoError(t, s.List(ctx, func(common.Hash) error {
+		roots++
+		return nil
+	}))
+	require.Equal(t, 4, roots)
+
+	require.NoError(t, s.DeleteSlotIndex(ctx, 10))
+	_, err = s.ReadSlotIndex(ctx, 10)
+	require.ErrorIs(t, err, ErrNotFound)
+	exists, err := s.Exists(ctx, common.Hash{1})
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestSlotKeys(t *testing.T) {
+	for _, run := range []func(t *testing.T, s DataStore){runTestSlotIndex, runTestListSlotIndex, runTestSlotKeys} {
+		fs, cleanup := setup(t)
+		fs.keyScheme = flags.KeySchemeSlot
+		run(t, fs)
+		cleanup()
+	}
+
+	// Blocks are named by zero-padded slot and root
+	fs, cleanup := setup(t)
+	defer cleanup()
+	fs.keyScheme = flags.KeySchemeSlot
+
+	require.NoError(t, fs.WriteSlotIndex(context.Background(), 1234, common.Hash{1}))
+	_, err := os.Stat(path.Join(fs.directory, "slots", "00000000000000001234", common.Hash{1}.String()))
+	require.NoError(t, err)
+}
+
+type failingSlotIndexStorage struct {
+	*FileStorage
+}
+
+func (s *failingSlotIndexStorage) WriteSlotIndex(context.Context, uint64, common.Hash) error {
+	return ErrStorage
+}
+
+func TestWriteWithSlotIndexPartialFailure(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	id := common.Hash{1, 2, 3}
+	data := BlobData{
+		Header: Header{
+			BeaconBlockHash: id,
+			Slot:            10,
+		},
+	}
+
+	// The blob is written first, so a failing index write leaves the blob in place and reports a partial write
+	err := WriteWithSlotIndex(context.Background(), &failingSlotIndexStorage{fs}, data)
+	require.ErrorIs(t, err, ErrPartialWrite)
+	require.ErrorIs(t, err, ErrStorage)
+
+	exists, err := fs.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	_, err = fs.ReadSlotIndex(context.Background(), 10)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Reconciling repairs the missing entry exactly once
+	repaired, err := ReconcileSlotIndex(context.Background(), fs, 10, id)
+	require.NoError(t, err)
+	require.True(t, repaired)
+
+	repaired, err = ReconcileSlotIndex(context.Background(), fs, 10, id)
+	require.NoError(t, err)
+	require.False(t, repaired)
+
+	hash, err := fs.ReadSlotIndex(context.Background(), 10)
+	require.NoError(t, err)
+	require.Equal(t, id, hash)
+}
+
+func runTestListAndDelete(t *testing.T, s DataStore) {
+	ids := []common.Hash{{1}, {2}, {3}}
+	for i, id := range ids {
+		err := WriteWithSlotIndex(context.Background(), s, BlobData{
+			Header: Header{
+				BeaconBlockHash: id,
+				Slot:            uint64(i + 10),
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	// Slot index entries are not listed as blobs
+	var listed []common.Hash
+	err := s.List(context.Background(), func(hash common.Hash) error {
+		listed = append(listed, hash)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, ids, listed)
+
+	header, err := s.Stat(context.Background(), ids[1])
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), header.Slot)
+
+	require.NoError(t, s.Delete(context.Background(), ids[1]))
+
+	exists, err := s.Exists(context.Background(), ids[1])
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = s.Stat(context.Background(), ids[1])
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a missing blob is reported by every data store
+	require.ErrorIs(t, s.Delete(context.Background(), ids[1]), ErrNotFound)
+}
+
+func TestListAndDelete(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestListAndDelete(t, fs)
+}
+
 func TestBrokenStorage(t *testing.T) {
 	fs, cleanup := setup(t)
 
@@ -113,3 +355,388 @@ func TestReadInvalidData(t *testing.T) {
 	require.Error(t, err)
 	require.True(t, errors.Is(err, ErrMarshaling))
 }
+
+func runTestLatest(t *testing.T, s DataStore) {
+	_, err := s.ReadLatest(context.Background())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	first := Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 1}
+	require.NoError(t, s.WriteLatest(context.Background(), first))
+
+	latest, err := s.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, first, latest)
+
+	second := Header{BeaconBlockHash: common.Hash{4, 5, 6}, Slot: 2}
+	require.NoError(t, s.WriteLatest(context.Background(), second))
+
+	latest, err = s.ReadLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, second, latest)
+
+	// The pointer is not listed as a blob
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestLatest(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestLatest(t, fs)
+}
+
+func runTestCIDIndex(t *testing.T, s DataStore) {
+	hash := common.Hash{1, 2, 3}
+	_, err := s.ReadCIDIndex(context.Background(), hash)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	cids := []string{"bafkreiaaaa", "bafkreibbbb"}
+	require.NoError(t, s.WriteCIDIndex(context.Background(), hash, cids))
+
+	indexed, err := s.ReadCIDIndex(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, cids, indexed)
+
+	// The index entry is not listed as a blob
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestCIDIndex(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestCIDIndex(t, fs)
+}
+
+func runTestExecutionIndex(t *testing.T, s DataStore) {
+	_, err := s.ReadExecutionIndex(context.Background(), 100)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.WriteExecutionIndex(context.Background(), 100, common.Hash{1, 2, 3}))
+	hash, err := s.ReadExecutionIndex(context.Background(), 100)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{1, 2, 3}, hash)
+
+	// A reorged block is overwritten by the block that replaced it
+	require.NoError(t, s.WriteExecutionIndex(context.Background(), 100, common.Hash{4, 5, 6}))
+	hash, err = s.ReadExecutionIndex(context.Background(), 100)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{4, 5, 6}, hash)
+
+	// Index entries are not listed as blobs
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestExecutionIndex(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestExecutionIndex(t, fs)
+}
+
+func runTestStagedWrites(t *testing.T, s DataStore) {
+	staging, ok := s.(StagingStore)
+	require.True(t, ok)
+
+	id := common.Hash{1, 2, 3}
+	data := BlobData{Header: Header{BeaconBlockHash: id, Slot: 5}}
+
+	require.ErrorIs(t, staging.CommitStaged(context.Background(), id), ErrNotFound)
+
+	// Staged blob data isn't visible until it is committed
+	require.NoError(t, staging.StageWrite(context.Background(), data))
+	exists, err := s.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+
+	require.NoError(t, staging.CommitStaged(context.Background(), id))
+	stored, err := s.Read(context.Background(), id)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatJSON
+	require.Equal(t, data.Header, stored.Header)
+	require.ErrorIs(t, staging.CommitStaged(context.Background(), id), ErrNotFound)
+
+	// Discarded blob data can't be committed, and doesn't affect the blob data stored
+	require.NoError(t, staging.StageWrite(context.Background(), BlobData{Header: Header{BeaconBlockHash: id, Slot: 6}}))
+	require.NoError(t, staging.DiscardStaged(context.Background(), id))
+	require.NoError(t, staging.DiscardStaged(context.Background(), id))
+	require.ErrorIs(t, staging.CommitStaged(context.Background(), id), ErrNotFound)
+
+	stored, err = s.Read(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, data.Header, stored.Header)
+}
+
+func TestStagedWrites(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestStagedWrites(t, fs)
+}
+
+func runTestLease(t *testing.T, s DataStore) {
+	leases, ok := s.(LeaseStore)
+	require.True(t, ok)
+
+	_, err := leases.ReadLease(context.Background())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	expires := time.Unix(1000, 0).UTC()
+	first := Lease{Term: 1, Holder: "a", Expires: expires}
+	require.NoError(t, leases.WriteLease(context.Background(), first))
+
+	lease, err := leases.ReadLease(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, first, lease)
+
+	// Only one writer gets a term
+	require.ErrorIs(t, leases.WriteLease(context.Background(), Lease{Term: 1, Holder: "b", Expires: expires}), ErrLeaseTaken)
+
+	// The latest term is read, also past the terms whose keys sort differently without padding
+	for term := uint64(2); term <= 10; term++ {
+		require.NoError(t, leases.WriteLease(context.Background(), Lease{Term: term, Holder: "a", Expires: expires.Add(time.Duration(term) * time.Second)}))
+	}
+
+	lease, err = leases.ReadLease(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Lease{Term: 10, Holder: "a", Expires: expires.Add(10 * time.Second)}, lease)
+	require.ErrorIs(t, leases.WriteLease(context.Background(), Lease{Term: 10, Holder: "b", Expires: expires}), ErrLeaseTaken)
+
+	// The lease is not listed as a blob
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestLease(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestLease(t, fs)
+}
+
+func runTestBackfillCheckpoint(t *testing.T, s DataStore) {
+	_, err := s.ReadBackfillCheckpoint(context.Background())
+	require.ErrorIs(t, err, ErrNotFound)
+
+	headers := []Header{
+		{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 2},
+		{BeaconBlockHash: common.Hash{4, 5, 6}, Slot: 1},
+	}
+	require.NoError(t, s.WriteBackfillCheckpoint(context.Background(), headers))
+
+	checkpoint, err := s.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, headers, checkpoint)
+
+	// Writing no headers clears the checkpoint
+	require.NoError(t, s.WriteBackfillCheckpoint(context.Background(), nil))
+
+	checkpoint, err = s.ReadBackfillCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, checkpoint)
+
+	// The checkpoint is not listed as a blob
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestBackfillCheckpoint(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestBackfillCheckpoint(t, fs)
+}
+
+func runTestWanted(t *testing.T, s DataStore) {
+	queue, ok := s.(WantedStore)
+	require.True(t, ok)
+
+	listWanted := func() []common.Hash {
+		var wanted []common.Hash
+		require.NoError(t, queue.ListWanted(context.Background(), func(hash common.Hash) error {
+			wanted = append(wanted, hash)
+			return nil
+		}))
+		return wanted
+	}
+	require.Empty(t, listWanted())
+
+	one, two := common.Hash{1}, common.Hash{2}
+	require.NoError(t, queue.WriteWanted(context.Background(), one))
+	require.NoError(t, queue.WriteWanted(context.Background(), two))
+	require.NoError(t, queue.WriteWanted(context.Background(), one))
+	require.ElementsMatch(t, []common.Hash{one, two}, listWanted())
+
+	// Deleting a block that isn't queued succeeds
+	require.NoError(t, queue.DeleteWanted(context.Background(), one))
+	require.NoError(t, queue.DeleteWanted(context.Background(), one))
+	require.Equal(t, []common.Hash{two}, listWanted())
+
+	// Wanted blocks are not listed as blobs
+	require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+		t.Fatalf("unexpected blob %s", hash)
+		return nil
+	}))
+}
+
+func TestWanted(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestWanted(t, fs)
+}
+
+func runTestPartials(t *testing.T, s DataStore) {
+	ctx := context.Background()
+	hash := common.Hash{1, 2, 3}
+	// Partial blob data is read with the format it was stored in
+	header := Header{BeaconBlockHash: hash, Slot: 10, Format: flags.StorageFormatJSON}
+	sidecars := blobtest.NewBlobSidecars(t, 3)
+	partial := func(header Header, sidecars ...*deneb.BlobSidecar) BlobData {
+		return BlobData{Header: header, BlobSidecars: BlobSidecars{Data: sidecars}}
+	}
+
+	partials, err := s.ReadPartials(ctx, hash)
+	require.NoError(t, err)
+	require.Empty(t, partials)
+	_, err = AssembleBlobData(ctx, s, hash)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Two partial objects sharing index 1 assemble into the complete set
+	require.NoError(t, s.WritePartial(ctx, partial(header, sidecars[2], sidecars[1])))
+	require.NoError(t, s.WritePartial(ctx, partial(header, sidecars[0], sidecars[1])))
+
+	partials, err = s.ReadPartials(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, []BlobData{
+		partial(header, sidecars[0], sidecars[1]),
+		partial(header, sidecars[2], sidecars[1]),
+	}, partials)
+
+	assembled, err := AssembleBlobData(ctx, s, hash)
+	require.NoError(t, err)
+	require.Equal(t, partial(header, sidecars...), assembled)
+
+	// Partial blob data isn't read as complete blob data
+	_, err = s.Read(ctx, hash)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Writing the same indices again replaces them, and the most complete blob data wins an index
+	other := blobtest.NewBlobSidecars(t, 2)
+	require.NoError(t, s.WritePartial(ctx, partial(header, sidecars[0], other[1])))
+	optimistic := Header{BeaconBlockHash: hash, Slot: 10, Optimistic: true}
+	require.NoError(t, s.WritePartial(ctx, partial(optimistic, sidecars[1])))
+
+	assembled, err = AssembleBlobData(ctx, s, hash)
+	require.NoError(t, err)
+	require.Equal(t, partial(header, sidecars[0], other[1], sidecars[2]), assembled)
+
+	// Complete blob data is preferred over partial blob data of the same size
+	require.NoError(t, s.Write(ctx, partial(header, sidecars[0], sidecars[1])))
+	assembled, err = AssembleBlobData(ctx, s, hash)
+	require.NoError(t, err)
+	require.Equal(t, partial(header, sidecars...), assembled)
+
+	require.NoError(t, s.Delete(ctx, hash))
+	partials, err = s.ReadPartials(ctx, hash)
+	require.NoError(t, err)
+	require.Empty(t, partials)
+}
+
+func TestPartials(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestPartials(t, fs)
+}
+
+func runTestBlock(t *testing.T, s DataStore) {
+	hash := common.Hash{1, 2, 3}
+	_, err := s.ReadBlock(context.Background(), hash)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	sidecars := blobtest.NewBlobSidecars(t, 2)
+	block := blobtest.NewSignedBeaconBlock(t, &phase0.BeaconBlockHeader{Slot: 12, ProposerIndex: 3}, sidecars)
+	require.NoError(t, s.WriteBlock(context.Background(), hash, block))
+
+	read, err := s.ReadBlock(context.Background(), hash)
+	require.NoError(t, err)
+	require.Equal(t, block, read)
+
+	// Only deneb blocks are supported
+	require.ErrorIs(t, s.WriteBlock(context.Background(), hash, &spec.VersionedSignedBeaconBlock{Version: spec.DataVersionCapella}), ErrMarshaling)
+
+	// The block is not listed as a blob, and is deleted with the blob data of its block
+	require.NoError(t, s.Write(context.Background(), BlobData{
+		Header:       Header{BeaconBlockHash: hash, Slot: 12},
+		BlobSidecars: BlobSidecars{Data: sidecars},
+	}))
+
+	listed := 0
+	require.NoError(t, s.List(context.Background(), func(common.Hash) error {
+		listed++
+		return nil
+	}))
+	require.Equal(t, 1, listed)
+
+	require.NoError(t, s.Delete(context.Background(), hash))
+	_, err = s.ReadBlock(context.Background(), hash)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBlock(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestBlock(t, fs)
+}
+
+func runTestWriteIfNotExists(t *testing.T, s DataStore) {
+	ctx := context.Background()
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	require.NoError(t, s.WriteIfNotExists(ctx, data))
+	require.ErrorIs(t, s.WriteIfNotExists(ctx, data), ErrWriteDeduped)
+
+	different := data
+	different.Header.Optimistic = true
+	require.ErrorIs(t, s.WriteIfNotExists(ctx, different), ErrWriteConflict)
+
+	// Neither write replaced the stored blob data
+	stored, err := s.Read(ctx, data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatJSON
+	require.Equal(t, data, stored)
+}
+
+func TestWriteIfNotExists(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	runTestWriteIfNotExists(t, fs)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(fs.directory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,12 @@
+//go:build linux || darwin
+
+package storage
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setInstanceIDAttr records the instance ID in an extended attribute of the file.
+func setInstanceIDAttr(name string, instanceID string) error {
+	return unix.Setxattr(name, instanceIDAttr, []byte(instanceID), 0)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package storage
+
+import "errors"
+
+// setInstanceIDAttr is not supported on platforms without extended attributes, so files are not tagged.
+func setInstanceIDAttr(string, string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,60 @@
+//go:build linux || darwin
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func readInstanceIDAttr(t *testing.T, name string) string {
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(name, instanceIDAttr, buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestFileInstanceID(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+	fs.instanceID = "archiver-1"
+
+	// Skip on file systems without extended attributes
+	if err := unix.Setxattr(fs.directory, instanceIDAttr, []byte("probe"), 0); errors.Is(err, unix.ENOTSUP) {
+		t.Skip("extended attributes are not supported")
+	}
+
+	ctx := context.Background()
+	written := BlobData{Header: Header{BeaconBlockHash: common.Hash{1}, Slot: 10}}
+	created := BlobData{Header: Header{BeaconBlockHash: common.Hash{2}, Slot: 11}}
+	require.NoError(t, fs.Write(ctx, written))
+	require.NoError(t, fs.WriteIfNotExists(ctx, created))
+	require.NoError(t, fs.WriteSlotIndex(ctx, 10, written.Header.BeaconBlockHash))
+	require.NoError(t, fs.WriteLatest(ctx, written.Header))
+
+	for _, name := range []string{
+		fs.fileName(written.Header.BeaconBlockHash),
+		fs.fileName(created.Header.BeaconBlockHash),
+		fs.slotIndexFileName(10),
+		path.Join(fs.directory, latestKey),
+	} {
+		require.Equal(t, "archiver-1", readInstanceIDAttr(t, name))
+	}
+}
+
+func TestFileWithoutInstanceID(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+
+	hash := common.Hash{1}
+	require.NoError(t, fs.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: hash}}))
+
+	_, err := unix.Getxattr(fs.fileName(hash), instanceIDAttr, make([]byte, 256))
+	require.Error(t, err)
+}
@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/base-org/blob-archiver/common/tracing"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metricer records the operations on data stores, labeled by the backend and operation.
+type Metricer interface {
+	// RecordStorageOperation records the duration of an operation, with an exemplar linking to the trace of the
+	// context if it is traced, see tracing.Observe.
+	RecordStorageOperation(ctx context.Context, backend string, operation string, duration time.Duration, err error)
+	// RecordStorageBytes records the size of the blob sidecars read or written, as they are encoded in SSZ.
+	RecordStorageBytes(backend string, operation string, bytes int)
+	// RecordStorageWriteDeduped records a conditional write that found identical blob data already stored.
+	RecordStorageWriteDeduped(backend string)
+	// RecordSSZDuration records the time taken to marshal blob sidecars into or unmarshal blob data from SSZ.
+	RecordSSZDuration(operation SSZOperation, duration time.Duration)
+}
+
+// SSZOperation is an SSZ serialization whose duration is recorded, see Metricer.RecordSSZDuration.
+type SSZOperation string
+
+const (
+	// SSZMarshal is the marshaling of blob sidecars served as SSZ, which are written to the client as they are marshaled.
+	SSZMarshal SSZOperation = "marshal"
+	// SSZUnmarshal is the unmarshaling of blob data read from a data store it is stored in as SSZ.
+	SSZUnmarshal SSZOperation = "unmarshal"
+)
+
+type metricsRecorder struct {
+	duration    *prometheus.HistogramVec
+	errors      *prometheus.CounterVec
+	bytes       *prometheus.CounterVec
+	deduped     *prometheus.CounterVec
+	sszDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates the data store metrics in the given namespace.
+func NewMetrics(factory metrics.Factory, namespace string) Metricer {
+	return &metricsRecorder{
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "duration of data store operations",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "operation"}),
+		errors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_errors",
+			Help:      "number of data store operations that failed, other than with ErrNotFound",
+		}, []string{"backend", "operation"}),
+		bytes: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_blob_bytes",
+			Help:      "size of the blob sidecars read from and written to data stores",
+		}, []string{"backend", "operation"}),
+		deduped: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_writes_deduped",
+			Help:      "number of conditional writes that found identical blob data already stored, e.g. written by a concurrent writer",
+		}, []string{"backend"}),
+		sszDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ssz_duration_seconds",
+			Help:      "duration of marshaling blob sidecars into and unmarshaling blob data from SSZ",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+		}, []string{"operation"}),
+	}
+}
+
+func (m *metricsRecorder) RecordStorageOperation(ctx context.Context, backend string, operation string, duration time.Duration, err error) {
+	tracing.Observe(ctx, m.duration.WithLabelValues(backend, operation), duration.Seconds())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		m.errors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+func (m *metricsRecorder) RecordStorageBytes(backend string, operation string, bytes int) {
+	m.bytes.WithLabelValues(backend, operation).Add(float64(bytes))
+}
+
+func (m *metricsRecorder) RecordStorageWriteDeduped(backend string) {
+	m.deduped.WithLabelValues(backend).Inc()
+}
+
+func (m *metricsRecorder) RecordSSZDuration(operation SSZOperation, duration time.Duration) {
+	m.sszDuration.WithLabelValues(string(operation)).Observe(duration.Seconds())
+}
+
+// MetricsStorage is a DataStore that records the duration, errors and size of every operation on the DataStore it
+// wraps, so that all backends are instrumented alike.
+type MetricsStorage struct {
+	store   DataStore
+	backend string
+	metrics Metricer
+}
+
+func NewMetricsStorage(store DataStore, backend string, m Metricer) *MetricsStorage {
+	return &MetricsStorage{
+		store:   store,
+		backend: backend,
+		metrics: m,
+	}
+}
+
+// record records the operation in the context, which started at start and failed with err if it is not nil.
+func (s *MetricsStorage) record(ctx context.Context, operation string, start time.Time, err error) {
+	s.metrics.RecordStorageOperation(ctx, s.backend, operation, time.Since(start), err)
+}
+
+// Close closes the data store if it needs to be, e.g. the database of PebbleStorage.
+func (s *MetricsStorage) Close(ctx context.Context) error {
+	if closer, ok := s.store.(interface{ Close(context.Context) error }); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+func (s *MetricsStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	start := time.Now()
+	exists, err := s.store.Exists(ctx, hash)
+	s.record(ctx, "exists", start, err)
+	return exists, err
+}
+
+func (s *MetricsStorage) Read(ctx context.Context, hash common.Hash) (BlobData, error) {
+	start := time.Now()
+	data, err := s.store.Read(ctx, hash)
+	s.record(ctx, "read", start, err)
+	if err == nil {
+		s.metrics.RecordStorageBytes(s.backend, "read", data.BlobSidecars.SizeSSZ())
+	}
+	return data, err
+}
+
+func (s *MetricsStorage) ReadSlotIndex(ctx context.Context, slot uint64) (common.Hash, error) {
+	start := time.Now()
+	hash, err := s.store.ReadSlotIndex(ctx, slot)
+	s.record(ctx, "read_slot_index", start, err)
+	return hash, err
+}
+
+// ListSlotIndex records the duration of the whole listing, including the time spent in fn.
+func (s *MetricsStorage) ListSlotIndex(ctx context.Context, from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	start := time.Now()
+	err := s.store.ListSlotIndex(ctx, from, to, fn)
+	s.record(ctx, "list_slot_index", start, err)
+	return err
+}
+
+func (s *MetricsStorage) Stat(ctx context.Context, hash common.Hash) (Header, error) {
+	start := time.Now()
+	header, err := s.store.Stat(ctx, hash)
+	s.record(ctx, "stat", start, err)
+	return header, err
+}
+
+// List records the duration of the whole listing, including the time spent in fn.
+func (s *MetricsStorage) List(ctx context.Context, fn func(hash common.Hash) error) error {
+	start := time.Now()
+	err := s.store.List(ctx, fn)
+	s.record(ctx, "list", start, err)
+	return err
+}
+
+func (s *MetricsStorage) ReadLatest(ctx context.Context) (Header, error) {
+	start := time.Now()
+	header, err := s.store.ReadLatest(ctx)
+	s.record(ctx, "read_latest", start, err)
+	return header, err
+}
+
+func (s *MetricsStorage) ReadCIDIndex(ctx context.Context, hash common.Hash) ([]string, error) {
+	start := time.Now()
+	cids, err := s.store.ReadCIDIndex(ctx, hash)
+	s.record(ctx, "read_cid_index", start, err)
+	return cids, err
+}
+
+func (s *MetricsStorage) ReadBlock(ctx context.Context, hash common.Hash) (*spec.VersionedSignedBeaconBlock, error) {
+	start := time.Now()
+	block, err := s.store.ReadBlock(ctx, hash)
+	s.record(ctx, "read_block", start, err)
+	return block, err
+}
+
+func (s *MetricsStorage) ReadDictionary(ctx context.Context, version uint32) ([]byte, error) {
+	dictionaries, ok := s.store.(DictionaryStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	start := time.Now()
+	dict, err := dictionaries.ReadDictionary(ctx, version)
+	s.record(ctx, "read_dictionary", start, err)
+	return dict, err
+}
+
+func (s *MetricsStorage) LatestDictionaryVersion(ctx context.Context) (uint32, error) {
+	dictionaries, ok := s.store.(DictionaryStore)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	start := time.Now()
+	version, err := dictionaries.LatestDictionaryVersion(ctx)
+	s.record(ctx, "latest_dictionary_version", start, err)
+	return version, err
+}
+
+func (s *MetricsStorage) ListWanted(ctx context.Context, fn func(hash common.Hash) error) error {
+	wanted, ok := s.store.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := wanted.ListWanted(ctx, fn)
+	s.record(ctx, "list_wanted", start, err)
+	return err
+}
+
+func (s *MetricsStorage) ReadBackfillCheckpoint(ctx context.Context) ([]Header, error) {
+	start := time.Now()
+	headers, err := s.store.ReadBackfillCheckpoint(ctx)
+	s.record(ctx, "read_backfill_checkpoint", start, err)
+	return headers, err
+}
+
+func (s *MetricsStorage) Write(ctx context.Context, data BlobData) error {
+	start := time.Now()
+	err := s.store.Write(ctx, data)
+	s.record(ctx, "write", start, err)
+	if err == nil {
+		s.metrics.RecordStorageBytes(s.backend, "write", data.BlobSidecars.SizeSSZ())
+	}
+	return err
+}
+
+// WriteIfNotExists records ErrWriteDeduped as a successful operation, as it is not an error for the caller.
+func (s *MetricsStorage) WriteIfNotExists(ctx context.Context, data BlobData) error {
+	start := time.Now()
+	err := s.store.WriteIfNotExists(ctx, data)
+	if errors.Is(err, ErrWriteDeduped) {
+		s.record(ctx, "write_if_not_exists", start, nil)
+		s.metrics.RecordStorageWriteDeduped(s.backend)
+		return err
+	}
+
+	s.record(ctx, "write_if_not_exists", start, err)
+	if err == nil {
+		s.metrics.RecordStorageBytes(s.backend, "write", data.BlobSidecars.SizeSSZ())
+	}
+	return err
+}
+
+func (s *MetricsStorage) WriteSlotIndex(ctx context.Context, slot uint64, hash common.Hash) error {
+	start := time.Now()
+	err := s.store.WriteSlotIndex(ctx, slot, hash)
+	s.record(ctx, "write_slot_index", start, err)
+	return err
+}
+
+func (s *MetricsStorage) Delete(ctx context.Context, hash common.Hash) error {
+	start := time.Now()
+	err := s.store.Delete(ctx, hash)
+	s.record(ctx, "delete", start, err)
+	return err
+}
+
+func (s *MetricsStorage) DeleteSlotIndex(ctx context.Context, slot uint64) error {
+	start := time.Now()
+	err := s.store.DeleteSlotIndex(ctx, slot)
+	s.record(ctx, "delete_slot_index", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteLatest(ctx context.Context, header Header) error {
+	start := time.Now()
+	err := s.store.WriteLatest(ctx, header)
+	s.record(ctx, "write_latest", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteBackfillCheckpoint(ctx context.Context, headers []Header) error {
+	start := time.Now()
+	err := s.store.WriteBackfillCheckpoint(ctx, headers)
+	s.record(ctx, "write_backfill_checkpoint", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteBlock(ctx context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error {
+	start := time.Now()
+	err := s.store.WriteBlock(ctx, hash, block)
+	s.record(ctx, "write_block", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteDictionary(ctx context.Context, version uint32, dict []byte) error {
+	dictionaries, ok := s.store.(DictionaryStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := dictionaries.WriteDictionary(ctx, version, dict)
+	s.record(ctx, "write_dictionary", start, err)
+	return err
+}
+
+func (s *MetricsStorage) ReadPartials(ctx context.Context, hash common.Hash) ([]BlobData, error) {
+	start := time.Now()
+	partials, err := s.store.ReadPartials(ctx, hash)
+	s.record(ctx, "read_partials", start, err)
+	return partials, err
+}
+
+func (s *MetricsStorage) WritePartial(ctx context.Context, data BlobData) error {
+	start := time.Now()
+	err := s.store.WritePartial(ctx, data)
+	s.record(ctx, "write_partial", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteWanted(ctx context.Context, hash common.Hash) error {
+	wanted, ok := s.store.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := wanted.WriteWanted(ctx, hash)
+	s.record(ctx, "write_wanted", start, err)
+	return err
+}
+
+func (s *MetricsStorage) DeleteWanted(ctx context.Context, hash common.Hash) error {
+	wanted, ok := s.store.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := wanted.DeleteWanted(ctx, hash)
+	s.record(ctx, "delete_wanted", start, err)
+	return err
+}
+
+func (s *MetricsStorage) WriteCIDIndex(ctx context.Context, hash common.Hash, cids []string) error {
+	start := time.Now()
+	err := s.store.WriteCIDIndex(ctx, hash, cids)
+	s.record(ctx, "write_cid_index", start, err)
+	return err
+}
+
+func (s *MetricsStorage) ReadExecutionIndex(ctx context.Context, number uint64) (common.Hash, error) {
+	start := time.Now()
+	hash, err := s.store.ReadExecutionIndex(ctx, number)
+	s.record(ctx, "read_execution_index", start, err)
+	return hash, err
+}
+
+func (s *MetricsStorage) WriteExecutionIndex(ctx context.Context, number uint64, hash common.Hash) error {
+	start := time.Now()
+	err := s.store.WriteExecutionIndex(ctx, number, hash)
+	s.record(ctx, "write_execution_index", start, err)
+	return err
+}
+
+func (s *MetricsStorage) StageWrite(ctx context.Context, data BlobData) error {
+	staging, ok := s.store.(StagingStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := staging.StageWrite(ctx, data)
+	s.record(ctx, "stage_write", start, err)
+	return err
+}
+
+func (s *MetricsStorage) CommitStaged(ctx context.Context, hash common.Hash) error {
+	staging, ok := s.store.(StagingStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := staging.CommitStaged(ctx, hash)
+	s.record(ctx, "commit_staged", start, err)
+	return err
+}
+
+func (s *MetricsStorage) DiscardStaged(ctx context.Context, hash common.Hash) error {
+	staging, ok := s.store.(StagingStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := staging.DiscardStaged(ctx, hash)
+	s.record(ctx, "discard_staged", start, err)
+	return err
+}
+
+func (s *MetricsStorage) ReadLease(ctx context.Context) (Lease, error) {
+	leases, ok := s.store.(LeaseStore)
+	if !ok {
+		return Lease{}, ErrUnsupported
+	}
+
+	start := time.Now()
+	lease, err := leases.ReadLease(ctx)
+	s.record(ctx, "read_lease", start, err)
+	return lease, err
+}
+
+func (s *MetricsStorage) WriteLease(ctx context.Context, lease Lease) error {
+	leases, ok := s.store.(LeaseStore)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	start := time.Now()
+	err := leases.WriteLease(ctx, lease)
+	s.record(ctx, "write_lease", start, err)
+	return err
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsStorage(t *testing.T) {
+	registry := metrics.NewRegistry()
+	fs, cleanup := setup(t)
+	defer cleanup()
+	m := NewMetrics(metrics.With(registry), "test")
+	s := NewMetricsStorage(fs, "file://test", m)
+
+	// observations returns the number of observations of the operation's duration, and the value of its error and byte
+	// counters.
+	observations := func(backend string, operation string) (uint64, float64, float64) {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+
+		var count uint64
+		var errs, bytes float64
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels["backend"] != backend || labels["operation"] != operation {
+					continue
+				}
+
+				switch family.GetName() {
+				case "test_storage_operation_duration_seconds":
+					count += metric.GetHistogram().GetSampleCount()
+				case "test_storage_operation_errors":
+					errs += metric.GetCounter().GetValue()
+				case "test_storage_blob_bytes":
+					bytes += metric.GetCounter().GetValue()
+				}
+			}
+		}
+
+		return count, errs, bytes
+	}
+
+	ctx := context.Background()
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	require.NoError(t, s.Write(ctx, data))
+	_, err := s.Exists(ctx, data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	_, err = s.Read(ctx, data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	require.NoError(t, s.List(ctx, func(common.Hash) error { return nil }))
+	require.NoError(t, s.Delete(ctx, data.Header.BeaconBlockHash))
+
+	for _, operation := range []string{"write", "exists", "read", "list", "delete"} {
+		count, errs, _ := observations("file://test", operation)
+		require.Equal(t, uint64(1), count, operation)
+		require.Zero(t, errs, operation)
+	}
+
+	_, _, written := observations("file://test", "write")
+	require.Equal(t, float64(2*blobSidecarSize), written)
+	_, _, read := observations("file://test", "read")
+	require.Equal(t, float64(2*blobSidecarSize), read)
+
+	// Missing blobs are not counted as errors
+	_, err = s.Read(ctx, data.Header.BeaconBlockHash)
+	require.ErrorIs(t, err, ErrNotFound)
+	count, errs, read := observations("file://test", "read")
+	require.Equal(t, uint64(2), count)
+	require.Zero(t, errs)
+	require.Equal(t, float64(2*blobSidecarSize), read)
+
+	// Failures are, without recording any bytes
+	broken := NewMetricsStorage(NewFileStorage(path.Join(t.TempDir(), "missing"), testlog.Logger(t, log.LvlInfo)), "file://broken", m)
+	require.Error(t, broken.Write(ctx, data))
+	count, errs, written = observations("file://broken", "write")
+	require.Equal(t, uint64(1), count)
+	require.Equal(t, float64(1), errs)
+	require.Zero(t, written)
+}
+
+func TestMetricsStorageDedupsConcurrentWrites(t *testing.T) {
+	registry := metrics.NewRegistry()
+	fs, cleanup := setup(t)
+	defer cleanup()
+	s := NewMetricsStorage(fs, "file://test", NewMetrics(metrics.With(registry), "test"))
+
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	const writers = 8
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.WriteIfNotExists(context.Background(), data)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	written := 0
+	for err := range errs {
+		if err == nil {
+			written++
+			continue
+		}
+		require.ErrorIs(t, err, ErrWriteDeduped)
+	}
+	require.Equal(t, 1, written)
+
+	stored, err := s.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatJSON
+	require.Equal(t, data, stored)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var deduped, failures float64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetName() {
+			case "test_storage_writes_deduped":
+				deduped += metric.GetCounter().GetValue()
+			case "test_storage_operation_errors":
+				failures += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	require.Equal(t, float64(writers-1), deduped)
+	require.Zero(t, failures)
+}
+
+func TestSSZUnmarshalMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	dir := t.TempDir()
+	s, err := NewStorage(flags.StorageConfig{
+		DataStorageType:      flags.DataStorageFile,
+		FileStorageDirectory: dir,
+		Format:               flags.StorageFormatSSZ,
+	}, NewMetrics(metrics.With(registry), "test"), testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	unmarshals := func() uint64 {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+
+		for _, family := range families {
+			if family.GetName() != "test_ssz_duration_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				if metric.GetLabel()[0].GetValue() == string(SSZUnmarshal) {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		return 0
+	}
+
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	require.NoError(t, s.Write(context.Background(), data))
+	require.Zero(t, unmarshals())
+
+	_, err = s.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), unmarshals())
+
+	// Blob data stored as JSON isn't unmarshaled from SSZ
+	other := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{4, 5, 6}, Slot: 11},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}
+	raw, err := EncodeBlobData(other)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, other.Header.BeaconBlockHash.String()), raw, 0644))
+
+	_, err = s.Read(context.Background(), other.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), unmarshals())
+}
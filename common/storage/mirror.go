@@ -0,0 +1,504 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// primaryBackendName is the name the primary backend of a MirrorStorage is reported under.
+const primaryBackendName = "primary"
+
+// MirrorBackend is a secondary DataStore that writes are mirrored to.
+type MirrorBackend struct {
+	Name  string
+	Store DataStore
+	// Required backends must be written successfully for a write to succeed. Failures writing to other backends are
+	// logged and recorded, but otherwise ignored.
+	Required bool
+}
+
+// MirrorMetricer records the outcome of writes to each backend of a MirrorStorage.
+type MirrorMetricer interface {
+	RecordMirrorWrite(backend string, success bool)
+}
+
+// MirrorStorage is a DataStore that reads from a primary DataStore, except for Exists, and mirrors all writes to a set
+// of secondary backends. The primary is always written first and is always required. The secondaries are then written to with up
+// to concurrency writes in flight, in the order they are configured; with a concurrency of 1, writing stops at the
+// first required backend that fails. The wanted queue is only kept in the primary, as it is only read from there. With
+// a two-phase commit, see EnableTwoPhaseCommit, writes of blob data are staged in the primary and every required mirror
+// before they are committed in any of them, the primary last.
+type MirrorStorage struct {
+	DataStore
+	mirrors     []MirrorBackend
+	concurrency int
+	twoPhase    bool
+	metrics     MirrorMetricer
+	log         log.Logger
+}
+
+func NewMirrorStorage(primary DataStore, mirrors []MirrorBackend, concurrency int, m MirrorMetricer, l log.Logger) *MirrorStorage {
+	return &MirrorStorage{
+		DataStore:   primary,
+		mirrors:     mirrors,
+		concurrency: max(concurrency, 1),
+		metrics:     m,
+		log:         l,
+	}
+}
+
+// EnableTwoPhaseCommit makes writes of blob data two-phase commits, see writeTwoPhase, so that the primary and the
+// required mirrors either all store a block or none of them does. It returns ErrUnsupported if one of them can't stage
+// writes.
+func (s *MirrorStorage) EnableTwoPhaseCommit() error {
+	if _, err := stagingStore(s.DataStore); err != nil {
+		return fmt.Errorf("primary: %w", err)
+	}
+
+	for _, backend := range s.mirrors {
+		if !backend.Required {
+			continue
+		}
+
+		if _, err := stagingStore(backend.Store); err != nil {
+			return fmt.Errorf("mirror %s: %w", backend.Name, err)
+		}
+	}
+
+	s.twoPhase = true
+	return nil
+}
+
+// Exists only reports blobs as existing if they exist in the primary and every required mirror, so that a write which
+// failed for a required mirror is retried rather than skipped.
+func (s *MirrorStorage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
+	exists, err := s.DataStore.Exists(ctx, hash)
+	if err != nil || !exists {
+		return exists, err
+	}
+
+	for _, backend := range s.mirrors {
+		if !backend.Required {
+			continue
+		}
+
+		exists, err := backend.Store.Exists(ctx, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to check mirror %s: %w", backend.Name, err)
+		}
+
+		if !exists {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (s *MirrorStorage) Write(ctx context.Context, data BlobData) error {
+	if s.twoPhase {
+		return s.writeTwoPhase(ctx, data)
+	}
+
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.Write(ctx, data)
+	})
+}
+
+// WriteIfNotExists returns ErrWriteDeduped if the primary already stored the same blob data, but still writes the blob
+// data to the mirrors, which may not have it yet. With a two-phase commit, blob data the primary doesn't store yet is
+// written like Write does; as staging can't be conditional, only the primary is checked for it beforehand, so concurrent
+// writers of a block aren't deduped.
+func (s *MirrorStorage) WriteIfNotExists(ctx context.Context, data BlobData) error {
+	if s.twoPhase {
+		exists, err := s.DataStore.Exists(ctx, data.Header.BeaconBlockHash)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return s.writeTwoPhase(ctx, data)
+		}
+	}
+
+	deduped := false
+	err := s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		err := store.WriteIfNotExists(ctx, data)
+		if errors.Is(err, ErrWriteDeduped) {
+			// Only the primary is written to before the mirrors are written to concurrently
+			if store == s.DataStore {
+				deduped = true
+			}
+			return nil
+		}
+		return err
+	})
+
+	if err == nil && deduped {
+		return ErrWriteDeduped
+	}
+
+	return err
+}
+
+func (s *MirrorStorage) WriteSlotIndex(ctx context.Context, slot uint64, hash common.Hash) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteSlotIndex(ctx, slot, hash)
+	})
+}
+
+func (s *MirrorStorage) WriteLatest(ctx context.Context, header Header) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteLatest(ctx, header)
+	})
+}
+
+func (s *MirrorStorage) WriteBackfillCheckpoint(ctx context.Context, headers []Header) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteBackfillCheckpoint(ctx, headers)
+	})
+}
+
+func (s *MirrorStorage) WriteBlock(ctx context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteBlock(ctx, hash, block)
+	})
+}
+
+func (s *MirrorStorage) WriteDictionary(ctx context.Context, version uint32, dict []byte) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		dictionaries, ok := store.(DictionaryStore)
+		if !ok {
+			return ErrUnsupported
+		}
+		return dictionaries.WriteDictionary(ctx, version, dict)
+	})
+}
+
+func (s *MirrorStorage) WriteCIDIndex(ctx context.Context, hash common.Hash, cids []string) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteCIDIndex(ctx, hash, cids)
+	})
+}
+
+func (s *MirrorStorage) WriteExecutionIndex(ctx context.Context, number uint64, hash common.Hash) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WriteExecutionIndex(ctx, number, hash)
+	})
+}
+
+func (s *MirrorStorage) WritePartial(ctx context.Context, data BlobData) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.WritePartial(ctx, data)
+	})
+}
+
+func (s *MirrorStorage) StageWrite(ctx context.Context, data BlobData) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		staging, err := stagingStore(store)
+		if err != nil {
+			return err
+		}
+		return staging.StageWrite(ctx, data)
+	})
+}
+
+func (s *MirrorStorage) CommitStaged(ctx context.Context, hash common.Hash) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		staging, err := stagingStore(store)
+		if err != nil {
+			return err
+		}
+		return staging.CommitStaged(ctx, hash)
+	})
+}
+
+func (s *MirrorStorage) DiscardStaged(ctx context.Context, hash common.Hash) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		staging, err := stagingStore(store)
+		if err != nil {
+			return err
+		}
+		return staging.DiscardStaged(ctx, hash)
+	})
+}
+
+// The lease, the dictionaries and the wanted queue are only read from the primary. Leases and the wanted queue are also
+// only written to the primary, as they are only read from there.
+
+func (s *MirrorStorage) ReadLease(ctx context.Context) (Lease, error) {
+	leases, ok := s.DataStore.(LeaseStore)
+	if !ok {
+		return Lease{}, ErrUnsupported
+	}
+	return leases.ReadLease(ctx)
+}
+
+func (s *MirrorStorage) WriteLease(ctx context.Context, lease Lease) error {
+	leases, ok := s.DataStore.(LeaseStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	return leases.WriteLease(ctx, lease)
+}
+
+func (s *MirrorStorage) ReadDictionary(ctx context.Context, version uint32) ([]byte, error) {
+	dictionaries, ok := s.DataStore.(DictionaryStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return dictionaries.ReadDictionary(ctx, version)
+}
+
+func (s *MirrorStorage) LatestDictionaryVersion(ctx context.Context) (uint32, error) {
+	dictionaries, ok := s.DataStore.(DictionaryStore)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return dictionaries.LatestDictionaryVersion(ctx)
+}
+
+func (s *MirrorStorage) WriteWanted(ctx context.Context, hash common.Hash) error {
+	wanted, ok := s.DataStore.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	return wanted.WriteWanted(ctx, hash)
+}
+
+func (s *MirrorStorage) DeleteWanted(ctx context.Context, hash common.Hash) error {
+	wanted, ok := s.DataStore.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	return wanted.DeleteWanted(ctx, hash)
+}
+
+func (s *MirrorStorage) ListWanted(ctx context.Context, fn func(hash common.Hash) error) error {
+	wanted, ok := s.DataStore.(WantedStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	return wanted.ListWanted(ctx, fn)
+}
+
+func (s *MirrorStorage) Delete(ctx context.Context, hash common.Hash) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.Delete(ctx, hash)
+	})
+}
+
+func (s *MirrorStorage) DeleteSlotIndex(ctx context.Context, slot uint64) error {
+	return s.mirror(ctx, func(ctx context.Context, store DataStore) error {
+		return store.DeleteSlotIndex(ctx, slot)
+	})
+}
+
+// stagingStore returns the store as a StagingStore, or ErrUnsupported if it can't stage writes.
+func stagingStore(store DataStore) (StagingStore, error) {
+	staging, ok := store.(StagingStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return staging, nil
+}
+
+// mirror applies the write to the primary and then to every mirror. It returns an error only if a required backend
+// failed. ErrNotFound, returned by deletes, counts as a success for every backend, so that objects missing from the
+// primary are still deleted from the mirrors; it is returned if the primary returned it.
+func (s *MirrorStorage) mirror(ctx context.Context, write func(context.Context, DataStore) error) error {
+	primaryErr := write(ctx, s.DataStore)
+	s.metrics.RecordMirrorWrite(primaryBackendName, primaryErr == nil || errors.Is(primaryErr, ErrNotFound))
+	if primaryErr != nil && !errors.Is(primaryErr, ErrNotFound) {
+		return primaryErr
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.concurrency)
+
+	for _, backend := range s.mirrors {
+		backend := backend
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				// A required backend already failed
+				return err
+			}
+
+			err := write(gctx, backend.Store)
+			if errors.Is(err, ErrNotFound) {
+				err = nil
+			}
+			s.metrics.RecordMirrorWrite(backend.Name, err == nil)
+
+			if err == nil {
+				return nil
+			}
+
+			if !backend.Required {
+				s.log.Warn("failed to write to optional mirror", "backend", backend.Name, "err", err)
+				return nil
+			}
+
+			s.log.Error("failed to write to required mirror", "backend", backend.Name, "err", err)
+			return fmt.Errorf("failed to write to mirror %s: %w", backend.Name, err)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	return primaryErr
+}
+
+// writeTwoPhase writes the blob data to the primary and the required mirrors with a two-phase commit: it is staged in
+// all of them, and only committed once every stage succeeded, so that a failing backend never leaves the block stored
+// in some of them but not the others. If a stage fails, the blob data staged in the other backends is discarded. The
+// staged blob data is then committed one backend at a time, the required mirrors first and the primary last, so that
+// readers of the primary never find a block the required mirrors lack. If a commit fails, the blob data already
+// committed is deleted again from the backends that didn't store the block before, and the rest is discarded. Backends
+// that did, e.g. as the write overwrites the block, keep it, so that a primary still holding its copy doesn't hold a
+// block the required mirrors lack; the write is retried either way. Optional mirrors are written to once the blob data
+// is committed.
+func (s *MirrorStorage) writeTwoPhase(ctx context.Context, data BlobData) error {
+	hash := data.Header.BeaconBlockHash
+	primary := MirrorBackend{Name: primaryBackendName, Store: s.DataStore, Required: true}
+	var requiredMirrors []MirrorBackend
+	for _, backend := range s.mirrors {
+		if backend.Required {
+			requiredMirrors = append(requiredMirrors, backend)
+		}
+	}
+
+	// existed are the names of the backends that stored the block before it was staged, see deleteCommitted
+	var mu sync.Mutex
+	existed := make(map[string]bool)
+
+	required := append([]MirrorBackend{primary}, requiredMirrors...)
+	staged, err := s.phase(ctx, required, func(ctx context.Context, backend MirrorBackend) error {
+		exists, err := backend.Store.Exists(ctx, hash)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		existed[backend.Name] = exists
+		mu.Unlock()
+
+		staging, err := stagingStore(backend.Store)
+		if err != nil {
+			return err
+		}
+		return staging.StageWrite(ctx, data)
+	})
+	if err != nil {
+		s.log.Error("failed to stage blob in required backend, rolling back", "hash", hash, "err", err)
+		s.discardStaged(ctx, staged, hash)
+		return err
+	}
+
+	// Every required backend staged the blob data, commit it in the mirrors before the primary
+	commitOrder := append(requiredMirrors, primary)
+	for i, backend := range commitOrder {
+		staging, err := stagingStore(backend.Store)
+		if err == nil {
+			err = staging.CommitStaged(ctx, hash)
+		}
+		if err != nil {
+			s.metrics.RecordMirrorWrite(backend.Name, false)
+			s.log.Error("failed to commit staged blob in required backend, rolling back", "backend", backend.Name, "hash", hash, "err", err, "committed", i)
+			s.deleteCommitted(ctx, commitOrder[:i], existed, hash)
+			s.discardStaged(ctx, commitOrder[i:], hash)
+			return fmt.Errorf("failed to write to %s: %w", backend.Name, err)
+		}
+	}
+
+	for _, backend := range required {
+		s.metrics.RecordMirrorWrite(backend.Name, true)
+	}
+
+	for _, backend := range s.mirrors {
+		if backend.Required {
+			continue
+		}
+
+		err := backend.Store.Write(ctx, data)
+		s.metrics.RecordMirrorWrite(backend.Name, err == nil)
+		if err != nil {
+			s.log.Warn("failed to write to optional mirror", "backend", backend.Name, "err", err)
+		}
+	}
+
+	return nil
+}
+
+// phase applies the stage phase of a two-phase commit to the given backends, with up to concurrency of them in flight.
+// It stops at the first backend that fails, whose failure is recorded and returned, and returns the backends it
+// succeeded for.
+func (s *MirrorStorage) phase(ctx context.Context, backends []MirrorBackend, apply func(context.Context, MirrorBackend) error) ([]MirrorBackend, error) {
+	var mu sync.Mutex
+	var succeeded []MirrorBackend
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.concurrency)
+
+	for _, backend := range backends {
+		backend := backend
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				// Another backend already failed
+				return err
+			}
+
+			if err := apply(gctx, backend); err != nil {
+				s.metrics.RecordMirrorWrite(backend.Name, false)
+				return fmt.Errorf("failed to write to %s: %w", backend.Name, err)
+			}
+
+			mu.Lock()
+			succeeded = append(succeeded, backend)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	return succeeded, err
+}
+
+// deleteCommitted deletes the blob data committed to the given backends by a two-phase commit that failed, except from
+// the backends that existed reports as storing the block before it was staged, whose committed blob data replaced a
+// copy of the same block. Failures are only logged, as the block is rewritten once the write is retried.
+func (s *MirrorStorage) deleteCommitted(ctx context.Context, backends []MirrorBackend, existed map[string]bool, hash common.Hash) {
+	for _, backend := range backends {
+		if existed[backend.Name] {
+			s.log.Warn("keeping committed blob that was stored before", "backend", backend.Name, "hash", hash)
+			continue
+		}
+
+		if err := backend.Store.Delete(ctx, hash); err != nil && !errors.Is(err, ErrNotFound) {
+			s.log.Warn("failed to delete committed blob", "backend", backend.Name, "hash", hash, "err", err)
+		}
+	}
+}
+
+// discardStaged discards the blob data staged in the given backends. Blob data that was committed is no longer staged,
+// so discarding it has no effect. Failures are only logged, as the staged blob data is never read, and is replaced by
+// the next stage of the block.
+func (s *MirrorStorage) discardStaged(ctx context.Context, backends []MirrorBackend, hash common.Hash) {
+	for _, backend := range backends {
+		staging, err := stagingStore(backend.Store)
+		if err == nil {
+			err = staging.DiscardStaged(ctx, hash)
+		}
+		if err != nil {
+			s.log.Warn("failed to discard staged blob", "backend", backend.Name, "hash", hash, "err", err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type mirrorWrite struct {
+	backend string
+	success bool
+}
+
+type recordingMirrorMetrics struct {
+	mu     sync.Mutex
+	writes []mirrorWrite
+}
+
+func (m *recordingMirrorMetrics) RecordMirrorWrite(backend string, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes = append(m.writes, mirrorWrite{backend, success})
+}
+
+type failingWriteStorage struct {
+	*FileStorage
+}
+
+func (s *failingWriteStorage) Write(context.Context, BlobData) error {
+	return ErrStorage
+}
+
+type failingStageStorage struct {
+	*FileStorage
+}
+
+func (s *failingStageStorage) StageWrite(context.Context, BlobData) error {
+	return ErrStorage
+}
+
+type failingCommitStorage struct {
+	*FileStorage
+}
+
+func (s *failingCommitStorage) CommitStaged(context.Context, common.Hash) error {
+	return ErrStorage
+}
+
+func requireStaged(t *testing.T, s *FileStorage, id common.Hash, expected bool) {
+	_, err := os.Stat(path.Join(s.directory, stagedKey(id)))
+	require.Equal(t, expected, err == nil)
+}
+
+func newMirrorBackend(t *testing.T, name string, required bool) (MirrorBackend, *FileStorage) {
+	fs := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	return MirrorBackend{Name: name, Store: fs, Required: required}, fs
+}
+
+func newFailingMirrorBackend(t *testing.T, name string, required bool) MirrorBackend {
+	fs := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	return MirrorBackend{Name: name, Store: &failingWriteStorage{fs}, Required: required}
+}
+
+func requireStored(t *testing.T, s DataStore, id common.Hash, expected bool) {
+	exists, err := s.Exists(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, expected, exists)
+}
+
+func TestMirrorParallelWritesToAllBackends(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", true)
+	b, bStore := newMirrorBackend(t, "b", false)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{a, b}, 2, m, testlog.Logger(t, log.LvlInfo))
+
+	id := common.Hash{1, 2, 3}
+	require.NoError(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}))
+
+	requireStored(t, primary, id, true)
+	requireStored(t, aStore, id, true)
+	requireStored(t, bStore, id, true)
+	require.ElementsMatch(t, []mirrorWrite{{"primary", true}, {"a", true}, {"b", true}}, m.writes)
+
+	// Reads are served by the primary
+	require.NoError(t, primary.Delete(context.Background(), id))
+	requireStored(t, s, id, false)
+}
+
+func TestMirrorSequentialStopsAtRequiredFailure(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", false)
+	failing := newFailingMirrorBackend(t, "failing", true)
+	c, cStore := newMirrorBackend(t, "c", true)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{a, failing, c}, 1, m, testlog.Logger(t, log.LvlInfo))
+
+	id := common.Hash{1, 2, 3}
+	err := s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}})
+	require.ErrorIs(t, err, ErrStorage)
+
+	requireStored(t, primary, id, true)
+	requireStored(t, aStore, id, true)
+	requireStored(t, cStore, id, false)
+	require.Equal(t, []mirrorWrite{{"primary", true}, {"a", true}, {"failing", false}}, m.writes)
+}
+
+func TestMirrorParallelFailsOnRequiredFailure(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	failing := newFailingMirrorBackend(t, "failing", true)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{failing}, 4, m, testlog.Logger(t, log.LvlInfo))
+
+	err := s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: common.Hash{1, 2, 3}}})
+	require.ErrorIs(t, err, ErrStorage)
+	require.Contains(t, m.writes, mirrorWrite{"failing", false})
+}
+
+func TestMirrorIgnoresFailingOptionalBackend(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+		failing := newFailingMirrorBackend(t, "failing", false)
+		b, bStore := newMirrorBackend(t, "b", true)
+		m := &recordingMirrorMetrics{}
+
+		s := NewMirrorStorage(primary, []MirrorBackend{failing, b}, concurrency, m, testlog.Logger(t, log.LvlInfo))
+
+		id := common.Hash{1, 2, 3}
+		require.NoError(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}))
+
+		requireStored(t, primary, id, true)
+		requireStored(t, bStore, id, true)
+		require.ElementsMatch(t, []mirrorWrite{{"primary", true}, {"failing", false}, {"b", true}}, m.writes)
+	}
+}
+
+func TestMirrorPrimaryFailure(t *testing.T) {
+	primary := &failingWriteStorage{NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))}
+	a, aStore := newMirrorBackend(t, "a", false)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{a}, 1, m, testlog.Logger(t, log.LvlInfo))
+
+	id := common.Hash{1, 2, 3}
+	require.ErrorIs(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}), ErrStorage)
+	requireStored(t, aStore, id, false)
+	require.Equal(t, []mirrorWrite{{"primary", false}}, m.writes)
+}
+
+type flakyWriteStorage struct {
+	*FileStorage
+	failures int
+}
+
+func (s *flakyWriteStorage) Write(ctx context.Context, data BlobData) error {
+	if s.failures > 0 {
+		s.failures--
+		return ErrStorage
+	}
+
+	return s.FileStorage.Write(ctx, data)
+}
+
+func TestMirrorRetryRepairsRequiredMirror(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	flaky := &flakyWriteStorage{FileStorage: NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo)), failures: 1}
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{{Name: "flaky", Store: flaky, Required: true}}, 1, m, testlog.Logger(t, log.LvlInfo))
+
+	id := common.Hash{1, 2, 3}
+	data := BlobData{Header: Header{BeaconBlockHash: id}}
+	require.ErrorIs(t, s.Write(context.Background(), data), ErrStorage)
+
+	// The primary has the blob, but it isn't reported as existing until the required mirror has it too
+	requireStored(t, primary, id, true)
+	requireStored(t, s, id, false)
+
+	require.NoError(t, s.Write(context.Background(), data))
+	requireStored(t, flaky, id, true)
+	requireStored(t, s, id, true)
+}
+
+func TestMirrorDeleteMissingFromPrimary(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", true)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{a}, 1, m, testlog.Logger(t, log.LvlInfo))
+
+	id := common.Hash{1, 2, 3}
+	require.NoError(t, aStore.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}))
+
+	require.ErrorIs(t, s.Delete(context.Background(), id), ErrNotFound)
+	requireStored(t, aStore, id, false)
+}
+
+func TestMirrorTwoPhaseCommitRequiresStaging(t *testing.T) {
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", true)
+	b, bStore := newMirrorBackend(t, "b", false)
+
+	// Optional mirrors aren't staged in, so they don't need to stage writes
+	b.Store = struct{ DataStore }{bStore}
+	s := NewMirrorStorage(primary, []MirrorBackend{a, b}, 1, &recordingMirrorMetrics{}, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, s.EnableTwoPhaseCommit())
+
+	a.Store = struct{ DataStore }{aStore}
+	s = NewMirrorStorage(primary, []MirrorBackend{a, b}, 1, &recordingMirrorMetrics{}, testlog.Logger(t, log.LvlInfo))
+	require.ErrorIs(t, s.EnableTwoPhaseCommit(), ErrUnsupported)
+
+	s = NewMirrorStorage(struct{ DataStore }{primary}, nil, 1, &recordingMirrorMetrics{}, testlog.Logger(t, log.LvlInfo))
+	require.ErrorIs(t, s.EnableTwoPhaseCommit(), ErrUnsupported)
+}
+
+func TestMirrorTwoPhaseCommit(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+		a, aStore := newMirrorBackend(t, "a", true)
+		b, bStore := newMirrorBackend(t, "b", false)
+		m := &recordingMirrorMetrics{}
+
+		s := NewMirrorStorage(primary, []MirrorBackend{a, b}, concurrency, m, testlog.Logger(t, log.LvlInfo))
+		require.NoError(t, s.EnableTwoPhaseCommit())
+
+		id := common.Hash{1, 2, 3}
+		require.NoError(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}))
+
+		for _, store := range []*FileStorage{primary, aStore, bStore} {
+			requireStored(t, store, id, true)
+			requireStaged(t, store, id, false)
+		}
+		requireStored(t, s, id, true)
+		require.ElementsMatch(t, []mirrorWrite{{"primary", true}, {"a", true}, {"b", true}}, m.writes)
+
+		// The conditional write of a block the primary stores isn't staged
+		require.ErrorIs(t, s.WriteIfNotExists(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}), ErrWriteDeduped)
+	}
+}
+
+func TestMirrorTwoPhaseCommitRollsBackFailedStage(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+		a, aStore := newMirrorBackend(t, "a", true)
+		failing := MirrorBackend{
+			Name:     "failing",
+			Store:    &failingStageStorage{NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))},
+			Required: true,
+		}
+		b, bStore := newMirrorBackend(t, "b", false)
+		m := &recordingMirrorMetrics{}
+
+		s := NewMirrorStorage(primary, []MirrorBackend{a, failing, b}, concurrency, m, testlog.Logger(t, log.LvlInfo))
+		require.NoError(t, s.EnableTwoPhaseCommit())
+
+		id := common.Hash{1, 2, 3}
+		for _, write := range []func(context.Context, BlobData) error{s.Write, s.WriteIfNotExists} {
+			err := write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}})
+			require.ErrorIs(t, err, ErrStorage)
+
+			// No backend stores the block, and nothing is left staged
+			for _, store := range []*FileStorage{primary, aStore, bStore} {
+				requireStored(t, store, id, false)
+				requireStaged(t, store, id, false)
+			}
+		}
+		require.Contains(t, m.writes, mirrorWrite{"failing", false})
+		require.NotContains(t, m.writes, mirrorWrite{"primary", true})
+	}
+}
+
+func TestMirrorTwoPhaseCommitRollsBackFailedCommit(t *testing.T) {
+	id := common.Hash{1, 2, 3}
+
+	// A required mirror fails to commit after the other required mirror committed the block
+	primary := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", true)
+	failingStore := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	failing := MirrorBackend{Name: "failing", Store: &failingCommitStorage{failingStore}, Required: true}
+	b, bStore := newMirrorBackend(t, "b", false)
+	m := &recordingMirrorMetrics{}
+
+	s := NewMirrorStorage(primary, []MirrorBackend{a, failing, b}, 2, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, s.EnableTwoPhaseCommit())
+
+	require.ErrorIs(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}), ErrStorage)
+
+	// The block committed to the first mirror is deleted again, and the primary, committed last, never stored it
+	for _, store := range []*FileStorage{primary, aStore, failingStore, bStore} {
+		requireStored(t, store, id, false)
+		requireStaged(t, store, id, false)
+	}
+	require.Contains(t, m.writes, mirrorWrite{"failing", false})
+	require.NotContains(t, m.writes, mirrorWrite{"primary", true})
+
+	// The primary fails to commit after every required mirror committed the block
+	primaryStore := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore = newMirrorBackend(t, "a", true)
+	m = &recordingMirrorMetrics{}
+
+	s = NewMirrorStorage(&failingCommitStorage{primaryStore}, []MirrorBackend{a}, 1, m, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, s.EnableTwoPhaseCommit())
+
+	require.ErrorIs(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id}}), ErrStorage)
+	for _, store := range []*FileStorage{primaryStore, aStore} {
+		requireStored(t, store, id, false)
+		requireStaged(t, store, id, false)
+	}
+	require.Equal(t, []mirrorWrite{{"primary", false}}, m.writes)
+}
+
+func TestMirrorTwoPhaseCommitRollbackKeepsMirroredBlock(t *testing.T) {
+	id := common.Hash{1, 2, 3}
+
+	// The block is already stored in the primary and the first mirror, but not yet in the second one
+	primaryStore := NewFileStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	a, aStore := newMirrorBackend(t, "a", true)
+	b, bStore := newMirrorBackend(t, "b", true)
+	for _, store := range []*FileStorage{primaryStore, aStore} {
+		require.NoError(t, store.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id, Slot: 5}}))
+	}
+
+	// Rewriting it fails to commit in the primary, after both mirrors committed it
+	s := NewMirrorStorage(&failingCommitStorage{primaryStore}, []MirrorBackend{a, b}, 1, &recordingMirrorMetrics{}, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, s.EnableTwoPhaseCommit())
+	require.ErrorIs(t, s.Write(context.Background(), BlobData{Header: Header{BeaconBlockHash: id, Slot: 5}}), ErrStorage)
+
+	// The mirror that stored the block before keeps it, so that the primary, which still stores it, doesn't store a
+	// block the required mirrors lack, while the copy committed to the other mirror is deleted
+	requireStored(t, primaryStore, id, true)
+	requireStored(t, aStore, id, true)
+	requireStored(t, bStore, id, false)
+	for _, store := range []*FileStorage{primaryStore, aStore, bStore} {
+		requireStaged(t, store, id, false)
+	}
+}
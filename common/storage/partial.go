@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// partialPrefix is the key prefix under which partial blob data is stored, for blocks whose sidecars are archived
+// incrementally. Partial blob data is keyed by the block and the indices of its sidecars, e.g.
+// partial/<beacon block hash>/0-2-3, so writing sidecars of the same indices again replaces them.
+const partialPrefix = "partial"
+
+// partialDir returns the key prefix of the partial blob data of the block, without a trailing slash.
+func partialDir(hash common.Hash) string {
+	return path.Join(partialPrefix, hash.String())
+}
+
+// partialKey returns the key of the partial blob data, from the sorted indices of its sidecars. Blob data without
+// sidecars is keyed as "none".
+func partialKey(data BlobData) string {
+	indices := make([]uint64, 0, len(data.BlobSidecars.Data))
+	for _, sidecar := range data.BlobSidecars.Data {
+		indices = append(indices, uint64(sidecar.Index))
+	}
+	slices.Sort(indices)
+
+	name := "none"
+	if len(indices) > 0 {
+		parts := make([]string, len(indices))
+		for i, index := range indices {
+			parts[i] = strconv.FormatUint(index, 10)
+		}
+		name = strings.Join(parts, "-")
+	}
+
+	return path.Join(partialDir(data.Header.BeaconBlockHash), name)
+}
+
+// AssembleBlobData reads the blob data of a block whose sidecars may have been archived incrementally, merging the blob
+// data written for it with DataStoreWriter.Write, if any, and all its partial blob data, see
+// DataStoreWriter.WritePartial. Each index is taken from the most complete blob data holding it, i.e. the one with the
+// most sidecars, preferring the blob data written with Write over partial blob data, and otherwise the partial blob
+// data whose key sorts first. The header is taken from the most complete blob data, and the sidecars are returned in
+// order of their index. Data column sidecars are merged the same way. It returns the errors of DataStoreReader.Read and
+// DataStoreReader.ReadPartials, and ErrNotFound if the block has neither.
+func AssembleBlobData(ctx context.Context, s DataStoreReader, hash common.Hash) (BlobData, error) {
+	complete, err := s.Read(ctx, hash)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return BlobData{}, err
+	}
+	found := err == nil
+
+	partials, err := s.ReadPartials(ctx, hash)
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	if len(partials) == 0 {
+		if !found {
+			return BlobData{}, ErrNotFound
+		}
+		return complete, nil
+	}
+
+	sources := partials
+	if found {
+		sources = append([]BlobData{complete}, partials...)
+	}
+	slices.SortStableFunc(sources, func(a, b BlobData) int {
+		return len(b.BlobSidecars.Data) - len(a.BlobSidecars.Data)
+	})
+
+	result := BlobData{Header: sources[0].Header}
+	seen := make(map[deneb.BlobIndex]bool)
+	for _, source := range sources {
+		for _, sidecar := range source.BlobSidecars.Data {
+			if seen[sidecar.Index] {
+				continue
+			}
+			seen[sidecar.Index] = true
+			result.BlobSidecars.Data = append(result.BlobSidecars.Data, sidecar)
+		}
+	}
+
+	slices.SortFunc(result.BlobSidecars.Data, func(a, b *deneb.BlobSidecar) int {
+		return int(a.Index) - int(b.Index)
+	})
+
+	seenColumns := make(map[uint64]bool)
+	for _, source := range sources {
+		for _, column := range source.DataColumnSidecars {
+			if seenColumns[column.Index] {
+				continue
+			}
+			seenColumns[column.Index] = true
+			result.DataColumnSidecars = append(result.DataColumnSidecars, column)
+		}
+	}
+
+	slices.SortFunc(result.DataColumnSidecars, func(a, b *DataColumnSidecar) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,724 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/cockroachdb/pebble"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// PebbleStorage stores blobs in an embedded Pebble database, for single-node deployments that have neither S3 nor a
+// file system suited to a file per object. Keys are the same as the names of the objects of the other data stores, so
+// that e.g. blobs are listed by iterating the keys starting with 0x, and every write is synced before it returns. The
+// database is locked by the process that opens it.
+type PebbleStorage struct {
+	log log.Logger
+	db  *pebble.DB
+	// codec encodes blobs in the format and with the compression they are written in, see NewStorage.
+	codec *blobCodec
+	// keyScheme is how blocks are named, see NewStorage. Blocks are only named by slot with flags.KeySchemeSlot.
+	keyScheme flags.KeyScheme
+	// writeMu makes checking for stored data and writing it atomic, e.g. for WriteIfNotExists.
+	writeMu sync.Mutex
+}
+
+// NewPebbleStorage opens the Pebble database in the directory, creating it if it doesn't exist, and stores blobs in it
+// as uncompressed JSON. Use NewStorage to write blobs in another format or compressed.
+func NewPebbleStorage(dir string, l log.Logger) (*PebbleStorage, error) {
+	db, err := pebble.Open(dir, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PebbleStorage{
+		log: l,
+		db:  db,
+	}
+	s.codec = newBlobCodec(flags.StorageFormatJSON, flags.StorageCompressionNone, s)
+	return s, nil
+}
+
+// Close closes the database.
+func (s *PebbleStorage) Close(_ context.Context) error {
+	return s.db.Close()
+}
+
+func (s *PebbleStorage) Exists(_ context.Context, hash common.Hash) (bool, error) {
+	_, err := s.get(hash.String())
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *PebbleStorage) Read(ctx context.Context, hash common.Hash) (BlobData, error) {
+	data, err := s.get(hash.String())
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	result, err := s.codec.decode(ctx, data)
+	if err != nil {
+		s.log.Warn("error decoding blob", "err", err, "hash", hash.String())
+		return BlobData{}, ErrMarshaling
+	}
+	return result, nil
+}
+
+func (s *PebbleStorage) Write(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.set(data.Header.BeaconBlockHash.String(), b); err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *PebbleStorage) WriteIfNotExists(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	key := data.Header.BeaconBlockHash.String()
+	stored, err := s.get(key)
+	if err == nil {
+		return compareStoredBlobData(ctx, s.codec, stored, data)
+	}
+
+	if !errors.Is(err, ErrNotFound) {
+		s.log.Warn("error reading existing blob", "err", err)
+		return err
+	}
+
+	if err := s.set(key, b); err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+func (s *PebbleStorage) Stat(ctx context.Context, hash common.Hash) (Header, error) {
+	data, err := s.Read(ctx, hash)
+	if err != nil {
+		return Header{}, err
+	}
+
+	return data.Header, nil
+}
+
+func (s *PebbleStorage) List(_ context.Context, fn func(hash common.Hash) error) error {
+	return s.iterate("0x", "0x", func(key string, _ []byte) error {
+		if !isBlobKey(key) {
+			return nil
+		}
+
+		return fn(common.HexToHash(key))
+	})
+}
+
+// Delete deletes the blob, the block and the partial blob data of the block in a single batch.
+func (s *PebbleStorage) Delete(_ context.Context, hash common.Hash) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.get(hash.String()); err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	partials := partialDir(hash) + "/"
+	_ = batch.Delete([]byte(hash.String()), nil)
+	_ = batch.Delete([]byte(blockKey(hash)), nil)
+	_ = batch.DeleteRange([]byte(partials), prefixUpperBound(partials), nil)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		s.log.Warn("error deleting blob", "err", err, "hash", hash.String())
+		return ErrStorage
+	}
+
+	s.log.Info("deleted blob", "hash", hash.String())
+	return nil
+}
+
+func (s *PebbleStorage) ReadSlotIndex(_ context.Context, slot uint64) (common.Hash, error) {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.readSlotKey(slot)
+	}
+
+	data, err := s.get(slotIndexKey(slot))
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	hash := common.HexToHash(string(data))
+	if hash == (common.Hash{}) {
+		s.log.Warn("invalid slot index entry", "slot", slot)
+		return common.Hash{}, ErrMarshaling
+	}
+
+	return hash, nil
+}
+
+func (s *PebbleStorage) ListSlotIndex(ctx context.Context, from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.listSlotKeys(from, to, fn)
+	}
+
+	prefix := slotIndexPrefix + "/"
+	var names []string
+	err := s.iterate(prefix, prefix, func(key string, _ []byte) error {
+		names = append(names, strings.TrimPrefix(key, prefix))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return listSlotIndex(ctx, s, names, from, to, fn)
+}
+
+func (s *PebbleStorage) WriteSlotIndex(_ context.Context, slot uint64, hash common.Hash) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.writeSlotKey(slot, hash)
+	}
+
+	if err := s.set(slotIndexKey(slot), []byte(hash.String())); err != nil {
+		s.log.Warn("error writing slot index", "err", err, "slot", slot)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) DeleteSlotIndex(_ context.Context, slot uint64) error {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return s.deleteSlotKeys(slot)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.get(slotIndexKey(slot)); err != nil {
+		return err
+	}
+
+	if err := s.db.Delete([]byte(slotIndexKey(slot)), pebble.Sync); err != nil {
+		s.log.Warn("error deleting slot index", "err", err, "slot", slot)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// readSlotKey is ReadSlotIndex with the slot key scheme, which finds the first key of the slot.
+func (s *PebbleStorage) readSlotKey(slot uint64) (common.Hash, error) {
+	var hash common.Hash
+	found := false
+	err := s.listSlotKeys(slot, slot, func(_ uint64, h common.Hash) error {
+		hash, found = h, true
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if !found {
+		return common.Hash{}, ErrNotFound
+	}
+
+	return hash, nil
+}
+
+// listSlotKeys is ListSlotIndex with the slot key scheme. Keys are iterated in order, which is slot order, from the
+// first slot of the range to the last.
+func (s *PebbleStorage) listSlotKeys(from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	prefix := slotKeyPrefix + "/"
+	listed, first := uint64(0), true
+	return s.iterate(slotKeyDir(from)+"/", slotKeyDir(to)+"/", func(key string, _ []byte) error {
+		slot, hash, ok := parseSlotKey(strings.TrimPrefix(key, prefix))
+		if !ok || (!first && slot == listed) {
+			return nil
+		}
+
+		listed, first = slot, false
+		return fn(slot, hash)
+	})
+}
+
+// writeSlotKey is WriteSlotIndex with the slot key scheme. Other blocks named by the slot are removed in the same batch
+// the block is named by it in.
+func (s *PebbleStorage) writeSlotKey(slot uint64, hash common.Hash) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	dir := slotKeyDir(slot) + "/"
+	_ = batch.DeleteRange([]byte(dir), prefixUpperBound(dir), nil)
+	_ = batch.Set([]byte(slotKey(slot, hash)), nil, nil)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		s.log.Warn("error writing slot key", "err", err, "slot", slot)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// deleteSlotKeys is DeleteSlotIndex with the slot key scheme, which removes all keys of the slot.
+func (s *PebbleStorage) deleteSlotKeys(slot uint64) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.readSlotKey(slot); err != nil {
+		return err
+	}
+
+	dir := slotKeyDir(slot) + "/"
+	if err := s.db.DeleteRange([]byte(dir), prefixUpperBound(dir), pebble.Sync); err != nil {
+		s.log.Warn("error deleting slot keys", "err", err, "slot", slot)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadLatest(_ context.Context) (Header, error) {
+	data, err := s.get(latestKey)
+	if err != nil {
+		return Header{}, err
+	}
+
+	var header Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		s.log.Warn("error decoding latest pointer", "err", err)
+		return Header{}, ErrMarshaling
+	}
+
+	return header, nil
+}
+
+func (s *PebbleStorage) WriteLatest(_ context.Context, header Header) error {
+	b, err := json.Marshal(header)
+	if err != nil {
+		s.log.Warn("error encoding latest pointer", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.set(latestKey, b); err != nil {
+		s.log.Warn("error writing latest pointer", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadBackfillCheckpoint(_ context.Context) ([]Header, error) {
+	data, err := s.get(backfillCheckpointKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []Header
+	if err := json.Unmarshal(data, &headers); err != nil {
+		s.log.Warn("error decoding backfill checkpoint", "err", err)
+		return nil, ErrMarshaling
+	}
+
+	return headers, nil
+}
+
+func (s *PebbleStorage) WriteBackfillCheckpoint(_ context.Context, headers []Header) error {
+	b, err := json.Marshal(headers)
+	if err != nil {
+		s.log.Warn("error encoding backfill checkpoint", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.set(backfillCheckpointKey, b); err != nil {
+		s.log.Warn("error writing backfill checkpoint", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadCIDIndex(_ context.Context, hash common.Hash) ([]string, error) {
+	data, err := s.get(cidIndexKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	var cids []string
+	if err := json.Unmarshal(data, &cids); err != nil {
+		s.log.Warn("error decoding cid index", "err", err, "hash", hash.String())
+		return nil, ErrMarshaling
+	}
+
+	return cids, nil
+}
+
+func (s *PebbleStorage) WriteCIDIndex(_ context.Context, hash common.Hash, cids []string) error {
+	b, err := json.Marshal(cids)
+	if err != nil {
+		s.log.Warn("error encoding cid index", "err", err, "hash", hash.String())
+		return ErrMarshaling
+	}
+
+	if err := s.set(cidIndexKey(hash), b); err != nil {
+		s.log.Warn("error writing cid index", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadExecutionIndex(_ context.Context, number uint64) (common.Hash, error) {
+	data, err := s.get(executionIndexKey(number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	hash := common.HexToHash(string(data))
+	if hash == (common.Hash{}) {
+		s.log.Warn("invalid execution index entry", "number", number)
+		return common.Hash{}, ErrMarshaling
+	}
+
+	return hash, nil
+}
+
+func (s *PebbleStorage) WriteExecutionIndex(_ context.Context, number uint64, hash common.Hash) error {
+	if err := s.set(executionIndexKey(number), []byte(hash.String())); err != nil {
+		s.log.Warn("error writing execution index", "err", err, "number", number)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) StageWrite(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding staged blob", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.set(stagedKey(data.Header.BeaconBlockHash), b); err != nil {
+		s.log.Warn("error writing staged blob", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// CommitStaged writes the staged blob data into place and deletes it from the staging area in a single batch.
+func (s *PebbleStorage) CommitStaged(_ context.Context, hash common.Hash) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	b, err := s.get(stagedKey(hash))
+	if err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	_ = batch.Set([]byte(hash.String()), b, nil)
+	_ = batch.Delete([]byte(stagedKey(hash)), nil)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		s.log.Warn("error committing staged blob", "err", err, "hash", hash.String())
+		return ErrStorage
+	}
+
+	s.log.Info("wrote blob", "hash", hash.String())
+	return nil
+}
+
+func (s *PebbleStorage) DiscardStaged(_ context.Context, hash common.Hash) error {
+	if err := s.db.Delete([]byte(stagedKey(hash)), pebble.Sync); err != nil {
+		s.log.Warn("error discarding staged blob", "err", err, "hash", hash.String())
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadLease(_ context.Context) (Lease, error) {
+	var data []byte
+	prefix := leasePrefix + "/"
+	err := s.iterate(prefix, prefix, func(_ string, value []byte) error {
+		// Terms are iterated in order, so the last one is the latest
+		data = slices.Clone(value)
+		return nil
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	if data == nil {
+		return Lease{}, ErrNotFound
+	}
+
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		s.log.Warn("error decoding lease", "err", err)
+		return Lease{}, ErrMarshaling
+	}
+
+	return lease, nil
+}
+
+// WriteLease checks for the term and writes it, and deletes the term before it, in a single batch under the write lock.
+func (s *PebbleStorage) WriteLease(_ context.Context, lease Lease) error {
+	b, err := json.Marshal(lease)
+	if err != nil {
+		s.log.Warn("error encoding lease", "err", err)
+		return ErrMarshaling
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err = s.get(leaseKey(lease.Term))
+	if err == nil {
+		return ErrLeaseTaken
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	_ = batch.Set([]byte(leaseKey(lease.Term)), b, nil)
+	if lease.Term > 0 {
+		_ = batch.Delete([]byte(leaseKey(lease.Term-1)), nil)
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		s.log.Warn("error writing lease", "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadBlock(_ context.Context, hash common.Hash) (*spec.VersionedSignedBeaconBlock, error) {
+	data, err := s.get(blockKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := decodeBlock(data)
+	if err != nil {
+		s.log.Warn("error decoding block", "err", err, "hash", hash.String())
+		return nil, ErrMarshaling
+	}
+
+	return block, nil
+}
+
+func (s *PebbleStorage) WriteBlock(_ context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error {
+	b, err := encodeBlock(block)
+	if err != nil {
+		s.log.Warn("error encoding block", "err", err, "hash", hash.String())
+		return ErrMarshaling
+	}
+
+	if err := s.set(blockKey(hash), b); err != nil {
+		s.log.Warn("error writing block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ReadDictionary(_ context.Context, version uint32) ([]byte, error) {
+	return s.get(dictionaryKey(version))
+}
+
+func (s *PebbleStorage) LatestDictionaryVersion(_ context.Context) (uint32, error) {
+	prefix := dictionaryPrefix + "/"
+	latest := uint32(0)
+	err := s.iterate(prefix, prefix, func(key string, _ []byte) error {
+		if version, ok := parseDictionaryKey(key); ok {
+			latest = max(latest, version)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return latest, nil
+}
+
+func (s *PebbleStorage) WriteDictionary(_ context.Context, version uint32, dict []byte) error {
+	if err := s.codec.useDictionary(version, dict); err != nil {
+		s.log.Warn("error loading dictionary", "err", err, "version", version)
+		return ErrMarshaling
+	}
+
+	if err := s.set(dictionaryKey(version), dict); err != nil {
+		s.log.Warn("error writing dictionary", "err", err, "version", version)
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) ListWanted(_ context.Context, fn func(hash common.Hash) error) error {
+	prefix := wantedPrefix + "/"
+	return s.iterate(prefix, prefix, func(key string, _ []byte) error {
+		name := strings.TrimPrefix(key, prefix)
+		if !isBlobKey(name) {
+			return nil
+		}
+
+		return fn(common.HexToHash(name))
+	})
+}
+
+func (s *PebbleStorage) WriteWanted(_ context.Context, hash common.Hash) error {
+	if err := s.set(wantedKey(hash), nil); err != nil {
+		s.log.Warn("error writing wanted block", "err", err, "hash", hash.String())
+		return err
+	}
+
+	return nil
+}
+
+func (s *PebbleStorage) DeleteWanted(_ context.Context, hash common.Hash) error {
+	if err := s.db.Delete([]byte(wantedKey(hash)), pebble.Sync); err != nil {
+		s.log.Warn("error deleting wanted block", "err", err, "hash", hash.String())
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// ReadPartials iterates the keys of the block's partial blob data, which are in the order of their names.
+func (s *PebbleStorage) ReadPartials(ctx context.Context, hash common.Hash) ([]BlobData, error) {
+	prefix := partialDir(hash) + "/"
+	var partials []BlobData
+	err := s.iterate(prefix, prefix, func(key string, value []byte) error {
+		data, err := s.codec.decode(ctx, value)
+		if err != nil {
+			s.log.Warn("error decoding partial blob", "err", err, "hash", hash.String(), "name", strings.TrimPrefix(key, prefix))
+			return ErrMarshaling
+		}
+
+		partials = append(partials, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partials, nil
+}
+
+func (s *PebbleStorage) WritePartial(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding partial blob", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.set(partialKey(data), b); err != nil {
+		s.log.Warn("error writing partial blob", "err", err)
+		return err
+	}
+
+	s.log.Info("wrote partial blob", "hash", data.Header.BeaconBlockHash.String(), "sidecars", len(data.BlobSidecars.Data))
+	return nil
+}
+
+// get returns a copy of the value stored under the key, or ErrNotFound if there is none.
+func (s *PebbleStorage) get(key string) ([]byte, error) {
+	value, closer, err := s.db.Get([]byte(key))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		s.log.Warn("error reading key", "err", err, "key", key)
+		return nil, ErrStorage
+	}
+	defer closer.Close()
+
+	return slices.Clone(value), nil
+}
+
+// set stores the value under the key, synced to disk before it returns.
+func (s *PebbleStorage) set(key string, value []byte) error {
+	if err := s.db.Set([]byte(key), value, pebble.Sync); err != nil {
+		s.log.Warn("error writing key", "err", err, "key", key)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// iterate calls fn with every key from the first key starting with the lower prefix, through the last key starting
+// with the upper prefix, and its value, in ascending order. The value is only valid until fn returns. Iteration stops
+// at the first error returned by fn, which is then returned.
+func (s *PebbleStorage) iterate(lower, upper string, fn func(key string, value []byte) error) error {
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(lower),
+		UpperBound: prefixUpperBound(upper),
+	})
+	if err != nil {
+		s.log.Warn("error iterating keys", "err", err, "prefix", lower)
+		return ErrStorage
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := fn(string(iter.Key()), iter.Value()); err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		s.log.Warn("error iterating keys", "err", err, "prefix", lower)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// prefixUpperBound returns the smallest key greater than every key starting with the prefix.
+func prefixUpperBound(prefix string) []byte {
+	bound := []byte(prefix)
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] < 0xff {
+			bound[i]++
+			return bound[:i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPebble(t *testing.T) *PebbleStorage {
+	s, err := NewPebbleStorage(t.TempDir(), testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.Close(context.Background()))
+	})
+	return s
+}
+
+func TestPebbleExists(t *testing.T) {
+	runTestExists(t, setupPebble(t))
+}
+
+func TestPebbleRead(t *testing.T) {
+	runTestRead(t, setupPebble(t))
+}
+
+func TestPebbleSlotIndex(t *testing.T) {
+	runTestSlotIndex(t, setupPebble(t))
+}
+
+func TestPebbleListSlotIndex(t *testing.T) {
+	runTestListSlotIndex(t, setupPebble(t))
+}
+
+func TestPebbleSlotKeys(t *testing.T) {
+	for _, run := range []func(t *testing.T, s DataStore){runTestSlotIndex, runTestListSlotIndex, runTestSlotKeys} {
+		s := setupPebble(t)
+		s.keyScheme = flags.KeySchemeSlot
+		run(t, s)
+	}
+}
+
+func TestPebbleListAndDelete(t *testing.T) {
+	runTestListAndDelete(t, setupPebble(t))
+}
+
+func TestPebbleLatest(t *testing.T) {
+	runTestLatest(t, setupPebble(t))
+}
+
+func TestPebbleCIDIndex(t *testing.T) {
+	runTestCIDIndex(t, setupPebble(t))
+}
+
+func TestPebbleExecutionIndex(t *testing.T) {
+	runTestExecutionIndex(t, setupPebble(t))
+}
+
+func TestPebbleStagedWrites(t *testing.T) {
+	runTestStagedWrites(t, setupPebble(t))
+}
+
+func TestPebbleLease(t *testing.T) {
+	runTestLease(t, setupPebble(t))
+}
+
+func TestPebbleBackfillCheckpoint(t *testing.T) {
+	runTestBackfillCheckpoint(t, setupPebble(t))
+}
+
+func TestPebbleWanted(t *testing.T) {
+	runTestWanted(t, setupPebble(t))
+}
+
+func TestPebblePartials(t *testing.T) {
+	runTestPartials(t, setupPebble(t))
+}
+
+func TestPebbleBlock(t *testing.T) {
+	runTestBlock(t, setupPebble(t))
+}
+
+func TestPebbleWriteIfNotExists(t *testing.T) {
+	runTestWriteIfNotExists(t, setupPebble(t))
+}
+
+func TestPebbleMatchesFileStorage(t *testing.T) {
+	fs, cleanup := setup(t)
+	defer cleanup()
+	ps := setupPebble(t)
+
+	listed := func(s DataStore) []common.Hash {
+		var hashes []common.Hash
+		require.NoError(t, s.List(context.Background(), func(hash common.Hash) error {
+			hashes = append(hashes, hash)
+			return nil
+		}))
+		sort.Slice(hashes, func(i, j int) bool { return hashes[i].Cmp(hashes[j]) < 0 })
+		return hashes
+	}
+
+	var hashes []common.Hash
+	for i := 0; i < 10; i++ {
+		data := BlobData{
+			Header:       Header{BeaconBlockHash: common.Hash{byte(i + 1)}, Slot: uint64(i)},
+			BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, uint(i%3))},
+		}
+		hashes = append(hashes, data.Header.BeaconBlockHash)
+
+		for _, s := range []DataStore{fs, ps} {
+			require.NoError(t, WriteWithSlotIndex(context.Background(), s, data))
+		}
+	}
+
+	// Partial blob data and other keys are deleted or listed with their block, not as blobs
+	for _, s := range []DataStore{fs, ps} {
+		require.NoError(t, s.WritePartial(context.Background(), BlobData{Header: Header{BeaconBlockHash: hashes[2]}}))
+		require.NoError(t, s.(WantedStore).WriteWanted(context.Background(), common.Hash{0xff}))
+		require.NoError(t, s.WriteLatest(context.Background(), Header{BeaconBlockHash: hashes[9], Slot: 9}))
+
+		for _, hash := range hashes[:5] {
+			require.NoError(t, DeleteWithSlotIndex(context.Background(), s, Header{BeaconBlockHash: hash, Slot: uint64(hash[0] - 1)}))
+		}
+		require.ErrorIs(t, s.Delete(context.Background(), hashes[0]), ErrNotFound)
+	}
+
+	require.Equal(t, listed(fs), listed(ps))
+	require.Equal(t, hashes[5:], listed(ps))
+
+	for _, hash := range hashes {
+		expected, expectedErr := fs.Read(context.Background(), hash)
+		actual, err := ps.Read(context.Background(), hash)
+		require.Equal(t, expectedErr, err)
+		require.Equal(t, expected, actual)
+
+		expectedSlot, expectedErr := fs.ReadSlotIndex(context.Background(), uint64(hash[0]-1))
+		slot, err := ps.ReadSlotIndex(context.Background(), uint64(hash[0]-1))
+		require.Equal(t, expectedErr, err)
+		require.Equal(t, expectedSlot, slot)
+	}
+
+	partials, err := ps.ReadPartials(context.Background(), hashes[2])
+	require.NoError(t, err)
+	require.Empty(t, partials)
+}
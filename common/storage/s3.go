@@ -4,7 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
+	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -12,12 +18,29 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// slotMetadataKey is the user metadata key under which the slot of a blob is stored, so it can be read without fetching
+// the whole object.
+const slotMetadataKey = "Slot"
+
+// instanceIDMetadataKey is the user metadata key under which the ID of the instance that wrote an object is stored.
+const instanceIDMetadataKey = "Instance-Id"
+
 type S3Storage struct {
 	s3     *minio.Client
 	bucket string
 	log    log.Logger
+	// codec encodes blobs in the format and with the compression they are written in, see NewStorage.
+	codec *blobCodec
+	// instanceID is recorded in the metadata of every object written, if it is not empty.
+	instanceID string
+	// keyScheme is how blocks are named, see NewStorage. Blocks are only named by slot with flags.KeySchemeSlot.
+	keyScheme flags.KeyScheme
+	// rangedRead configures reading large blob data with concurrent ranged GETs, see readObject.
+	rangedRead rangedReadConfig
 }
 
+// NewS3Storage creates an S3 storage writing blobs as uncompressed JSON. Use NewStorage to write blobs in another format
+// or compressed.
 func NewS3Storage(cfg flags.S3Config, l log.Logger) (*S3Storage, error) {
 	var c *credentials.Credentials
 	if cfg.S3CredentialType == flags.S3CredentialStatic {
@@ -26,20 +49,33 @@ func NewS3Storage(cfg flags.S3Config, l log.Logger) (*S3Storage, error) {
 		c = credentials.NewIAM("")
 	}
 
+	transport, err := minio.DefaultTransport(cfg.UseHttps)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:  c,
-		Secure: cfg.UseHttps,
+		Creds:     c,
+		Secure:    cfg.UseHttps,
+		Transport: conditionalTransport{transport},
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &S3Storage{
+	s := &S3Storage{
 		s3:     client,
 		bucket: cfg.Bucket,
 		log:    l,
-	}, nil
+		rangedRead: rangedReadConfig{
+			threshold:   cfg.RangedReadThreshold,
+			partSize:    cfg.RangedReadPartSize,
+			concurrency: cfg.RangedReadConcurrency,
+		},
+	}
+	s.codec = newBlobCodec(flags.StorageFormatJSON, flags.StorageCompressionNone, s)
+	return s, nil
 }
 
 func (s *S3Storage) Exists(ctx context.Context, hash common.Hash) (bool, error) {
@@ -63,7 +99,7 @@ func (s *S3Storage) Read(ctx context.Context, hash common.Hash) (BlobData, error
 		return BlobData{}, ErrStorage
 	}
 	defer res.Close()
-	_, err = res.Stat()
+	info, err := res.Stat()
 	if err != nil {
 		errResponse := minio.ToErrorResponse(err)
 		if errResponse.Code == "NoSuchKey" {
@@ -75,8 +111,13 @@ func (s *S3Storage) Read(ctx context.Context, hash common.Hash) (BlobData, error
 		}
 	}
 
-	var data BlobData
-	err = json.NewDecoder(res).Decode(&data)
+	b, err := s.readObject(ctx, hash.String(), res, info)
+	if err != nil {
+		s.log.Info("unexpected error fetching blob", "hash", hash.String(), "err", err)
+		return BlobData{}, ErrStorage
+	}
+
+	data, err := s.codec.decode(ctx, b)
 	if err != nil {
 		s.log.Warn("error decoding blob", "hash", hash.String(), "err", err)
 		return BlobData{}, ErrMarshaling
@@ -86,15 +127,64 @@ func (s *S3Storage) Read(ctx context.Context, hash common.Hash) (BlobData, error
 }
 
 func (s *S3Storage) Write(ctx context.Context, data BlobData) error {
-	b, err := json.Marshal(data)
+	b, err := s.codec.encode(ctx, data)
 	if err != nil {
 		s.log.Warn("error encoding blob", "err", err)
 		return ErrMarshaling
 	}
 
+	if err := s.put(ctx, data.Header.BeaconBlockHash.String(), data, b); err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+// WriteIfNotExists puts the blob with If-None-Match: *, which S3 refuses with a 412 if the blob exists.
+func (s *S3Storage) WriteIfNotExists(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding blob", "err", err)
+		return ErrMarshaling
+	}
+
+	err = s.put(context.WithValue(ctx, ifNoneMatchKey{}, true), data.Header.BeaconBlockHash.String(), data, b)
+	if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+		res, err := s.s3.GetObject(ctx, s.bucket, data.Header.BeaconBlockHash.String(), minio.GetObjectOptions{})
+		if err != nil {
+			s.log.Info("unexpected error fetching existing blob", "err", err)
+			return ErrStorage
+		}
+		defer res.Close()
+
+		stored, err := io.ReadAll(res)
+		if err != nil {
+			s.log.Info("unexpected error fetching existing blob", "err", err)
+			return ErrStorage
+		}
+
+		return compareStoredBlobData(ctx, s.codec, stored, data)
+	}
+
+	if err != nil {
+		s.log.Warn("error writing blob", "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	return nil
+}
+
+// put puts the encoded blob data under the given key.
+func (s *S3Storage) put(ctx context.Context, key string, data BlobData, b []byte) error {
 	reader := bytes.NewReader(b)
-	_, err = s.s3.PutObject(ctx, s.bucket, data.Header.BeaconBlockHash.String(), reader, int64(len(b)), minio.PutObjectOptions{
-		ContentType: "application/json",
+	_, err := s.s3.PutObject(ctx, s.bucket, key, reader, int64(len(b)), minio.PutObjectOptions{
+		ContentType: s.codec.contentType(),
+		UserMetadata: s.userMetadata(map[string]string{
+			slotMetadataKey: strconv.FormatUint(data.Header.Slot, 10),
+		}),
 		UserTags: map[string]string{
 			"App-Name":          "BlobArchiver",
 			"Chain":             "Ethereum",
@@ -103,11 +193,814 @@ func (s *S3Storage) Write(ctx context.Context, data BlobData) error {
 		},
 	})
 
+	return err
+}
+
+// userMetadata returns the given user metadata of an object, with the instance ID added if it is set.
+func (s *S3Storage) userMetadata(metadata map[string]string) map[string]string {
+	if s.instanceID == "" {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string, 1)
+	}
+	metadata[instanceIDMetadataKey] = s.instanceID
+	return metadata
+}
+
+// ifNoneMatchKey marks the context of a put that must only create the object, see conditionalTransport.
+type ifNoneMatchKey struct{}
+
+// conditionalTransport sets If-None-Match: * on the puts whose context is marked with ifNoneMatchKey, so that S3 refuses
+// them if the object exists. minio-go quotes the ETags of conditional puts, so it can't set the wildcard itself.
+type conditionalTransport struct {
+	http.RoundTripper
+}
+
+func (t conditionalTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodPut && r.Context().Value(ifNoneMatchKey{}) != nil {
+		r = r.Clone(r.Context())
+		r.Header.Set("If-None-Match", "*")
+	}
+
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// Stat reads the header from the object metadata. Objects written before the slot was recorded in the metadata are
+// read in full instead.
+func (s *S3Storage) Stat(ctx context.Context, hash common.Hash) (Header, error) {
+	info, err := s.s3.StatObject(ctx, s.bucket, hash.String(), minio.StatObjectOptions{})
 	if err != nil {
-		s.log.Warn("error writing blob", "err", err)
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return Header{}, ErrNotFound
+		}
+
+		s.log.Info("unexpected error fetching blob metadata", "hash", hash.String(), "err", err)
+		return Header{}, ErrStorage
+	}
+
+	slot := info.Metadata.Get("X-Amz-Meta-" + slotMetadataKey)
+	if slot == "" {
+		data, err := s.Read(ctx, hash)
+		if err != nil {
+			return Header{}, err
+		}
+
+		return data.Header, nil
+	}
+
+	parsed, err := strconv.ParseUint(slot, 10, 64)
+	if err != nil {
+		s.log.Warn("invalid slot metadata", "hash", hash.String(), "slot", slot)
+		return Header{}, ErrMarshaling
+	}
+
+	return Header{
+		BeaconBlockHash: hash,
+		Slot:            parsed,
+	}, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, fn func(hash common.Hash) error) error {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing blobs", "err", object.Err)
+			return ErrStorage
+		}
+
+		if !isBlobKey(object.Key) {
+			continue
+		}
+
+		if err := fn(common.HexToHash(object.Key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, hash common.Hash) error {
+	// Removing a key that doesn't exist succeeds, so the blob is checked for first to report ErrNotFound like the other
+	// data stores
+	_, err := s.s3.StatObject(ctx, s.bucket, hash.String(), minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrNotFound
+		}
+
+		s.log.Warn("error checking blob before deleting it", "hash", hash.String(), "err", err)
 		return ErrStorage
 	}
 
-	s.log.Info("wrote blob", "hash", data.Header.BeaconBlockHash.String())
+	err = s.s3.RemoveObject(ctx, s.bucket, hash.String(), minio.RemoveObjectOptions{})
+	if err != nil {
+		s.log.Warn("error deleting blob", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	// The block needn't be checked for, as it is optional
+	err = s.s3.RemoveObject(ctx, s.bucket, blockKey(hash), minio.RemoveObjectOptions{})
+	if err != nil {
+		s.log.Warn("error deleting block", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	if err := s.deletePartials(ctx, hash); err != nil {
+		return err
+	}
+
+	s.log.Info("deleted blob", "hash", hash.String())
+	return nil
+}
+
+// ReadSlotIndex reads the root of the slot from the name of its entry, see slotIndexDir.
+func (s *S3Storage) ReadSlotIndex(ctx context.Context, slot uint64) (common.Hash, error) {
+	hashes, err := s.slotIndexHashes(ctx, slot)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if len(hashes) == 0 {
+		return common.Hash{}, ErrNotFound
+	}
+
+	return hashes[0], nil
+}
+
+// ListSlotIndex lists the entries of the slot index in the range. S3 lists keys in lexicographic order, which is slot
+// order as slots are zero padded, so a single listing starting at the first slot of the range returns the slots and
+// roots in order, and stops at the end of the range, without reading any object.
+func (s *S3Storage) ListSlotIndex(ctx context.Context, from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prefix := s.slotIndexPrefix()
+	listed := false
+	var last uint64
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:     prefix + "/",
+		Recursive:  true,
+		StartAfter: slotDir(prefix, from),
+	}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing slot index", "err", object.Err)
+			return ErrStorage
+		}
+
+		slot, hash, ok := parseSlotKey(strings.TrimPrefix(object.Key, prefix+"/"))
+		if !ok || slot < from || (listed && slot == last) {
+			continue
+		}
+
+		if slot > to {
+			break
+		}
+
+		listed, last = true, slot
+		if err := fn(slot, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteSlotIndex writes an empty object named by the slot and root. Other entries of the slot are removed first, so the
+// slot is briefly without an entry rather than with two.
+func (s *S3Storage) WriteSlotIndex(ctx context.Context, slot uint64, hash common.Hash) error {
+	hashes, err := s.slotIndexHashes(ctx, slot)
+	if err != nil {
+		return err
+	}
+
+	named := false
+	for _, other := range hashes {
+		if other == hash {
+			named = true
+			continue
+		}
+
+		if err := s.s3.RemoveObject(ctx, s.bucket, s.slotIndexName(slot, other), minio.RemoveObjectOptions{}); err != nil {
+			s.log.Warn("error removing stale slot index entry", "slot", slot, "hash", other.String(), "err", err)
+			return ErrStorage
+		}
+	}
+
+	if named {
+		return nil
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, s.slotIndexName(slot, hash), bytes.NewReader(nil), 0, minio.PutObjectOptions{
+		ContentType:  "text/plain",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing slot index", "err", err, "slot", slot)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// DeleteSlotIndex removes the entries of the slot.
+func (s *S3Storage) DeleteSlotIndex(ctx context.Context, slot uint64) error {
+	hashes, err := s.slotIndexHashes(ctx, slot)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if err := s.s3.RemoveObject(ctx, s.bucket, s.slotIndexName(slot, hash), minio.RemoveObjectOptions{}); err != nil {
+			s.log.Warn("error deleting slot index", "slot", slot, "hash", hash.String(), "err", err)
+			return ErrStorage
+		}
+	}
+
+	return nil
+}
+
+// slotIndexPrefix returns the key prefix of the slot index. On S3, every entry of the slot index is an empty object
+// named by the zero-padded slot and the root, so that entries are listed in slot order with their roots without reading
+// them: under slotKeyPrefix with the slot key scheme, where the names are those of the blocks, and under
+// slotIndexPrefix otherwise.
+func (s *S3Storage) slotIndexPrefix() string {
+	if s.keyScheme == flags.KeySchemeSlot {
+		return slotKeyPrefix
+	}
+
+	return slotIndexPrefix
+}
+
+// slotIndexName returns the name of the slot index entry pointing the slot at the given beacon block hash.
+func (s *S3Storage) slotIndexName(slot uint64, hash common.Hash) string {
+	return path.Join(slotDir(s.slotIndexPrefix(), slot), hash.String())
+}
+
+// slotIndexHashes returns the hashes of the slot index entries of the slot, in the order of their keys.
+func (s *S3Storage) slotIndexHashes(ctx context.Context, slot uint64) ([]common.Hash, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prefix := s.slotIndexPrefix()
+	var hashes []common.Hash
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: slotDir(prefix, slot) + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing slot index", "slot", slot, "err", object.Err)
+			return nil, ErrStorage
+		}
+
+		if _, hash, ok := parseSlotKey(strings.TrimPrefix(object.Key, prefix+"/")); ok {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return hashes, nil
+}
+
+func (s *S3Storage) ReadLatest(ctx context.Context) (Header, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, latestKey, minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching latest pointer", "err", err)
+		return Header{}, ErrStorage
+	}
+	defer res.Close()
+
+	var header Header
+	err = json.NewDecoder(res).Decode(&header)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return Header{}, ErrNotFound
+		} else if errResponse.Code != "" {
+			s.log.Info("unexpected error fetching latest pointer", "err", err)
+			return Header{}, ErrStorage
+		}
+
+		s.log.Warn("error decoding latest pointer", "err", err)
+		return Header{}, ErrMarshaling
+	}
+
+	return header, nil
+}
+
+// WriteLatest overwrites the pointer in a single put, which S3 applies atomically.
+func (s *S3Storage) WriteLatest(ctx context.Context, header Header) error {
+	b, err := json.Marshal(header)
+	if err != nil {
+		s.log.Warn("error encoding latest pointer", "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, latestKey, bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: s.userMetadata(nil),
+		CacheControl: "no-cache",
+	})
+
+	if err != nil {
+		s.log.Warn("error writing latest pointer", "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadBackfillCheckpoint(ctx context.Context) ([]Header, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, backfillCheckpointKey, minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching backfill checkpoint", "err", err)
+		return nil, ErrStorage
+	}
+	defer res.Close()
+
+	var headers []Header
+	err = json.NewDecoder(res).Decode(&headers)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		} else if errResponse.Code != "" {
+			s.log.Info("unexpected error fetching backfill checkpoint", "err", err)
+			return nil, ErrStorage
+		}
+
+		s.log.Warn("error decoding backfill checkpoint", "err", err)
+		return nil, ErrMarshaling
+	}
+
+	return headers, nil
+}
+
+// WriteBackfillCheckpoint overwrites the checkpoint in a single put, which S3 applies atomically.
+func (s *S3Storage) WriteBackfillCheckpoint(ctx context.Context, headers []Header) error {
+	b, err := json.Marshal(headers)
+	if err != nil {
+		s.log.Warn("error encoding backfill checkpoint", "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, backfillCheckpointKey, bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing backfill checkpoint", "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadCIDIndex(ctx context.Context, hash common.Hash) ([]string, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, cidIndexKey(hash), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching cid index", "hash", hash.String(), "err", err)
+		return nil, ErrStorage
+	}
+	defer res.Close()
+
+	var cids []string
+	err = json.NewDecoder(res).Decode(&cids)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		} else if errResponse.Code != "" {
+			s.log.Info("unexpected error fetching cid index", "hash", hash.String(), "err", err)
+			return nil, ErrStorage
+		}
+
+		s.log.Warn("error decoding cid index", "hash", hash.String(), "err", err)
+		return nil, ErrMarshaling
+	}
+
+	return cids, nil
+}
+
+func (s *S3Storage) WriteCIDIndex(ctx context.Context, hash common.Hash, cids []string) error {
+	b, err := json.Marshal(cids)
+	if err != nil {
+		s.log.Warn("error encoding cid index", "hash", hash.String(), "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, cidIndexKey(hash), bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing cid index", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadExecutionIndex(ctx context.Context, number uint64) (common.Hash, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, executionIndexKey(number), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching execution index", "number", number, "err", err)
+		return common.Hash{}, ErrStorage
+	}
+	defer res.Close()
+
+	data, err := io.ReadAll(res)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return common.Hash{}, ErrNotFound
+		} else {
+			s.log.Info("unexpected error fetching execution index", "number", number, "err", err)
+			return common.Hash{}, ErrStorage
+		}
+	}
+
+	hash := common.HexToHash(string(data))
+	if hash == (common.Hash{}) {
+		s.log.Warn("invalid execution index entry", "number", number)
+		return common.Hash{}, ErrMarshaling
+	}
+
+	return hash, nil
+}
+
+func (s *S3Storage) WriteExecutionIndex(ctx context.Context, number uint64, hash common.Hash) error {
+	b := []byte(hash.String())
+	_, err := s.s3.PutObject(ctx, s.bucket, executionIndexKey(number), bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "text/plain",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing execution index", "err", err, "number", number)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) StageWrite(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding staged blob", "err", err)
+		return ErrMarshaling
+	}
+
+	if err := s.put(ctx, stagedKey(data.Header.BeaconBlockHash), data, b); err != nil {
+		s.log.Warn("error writing staged blob", "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// CommitStaged copies the staged object into place, along with its metadata and tags, and then removes it. S3 has no
+// rename, so a staged object left behind by a failure between the two is replaced by the next stage of the block.
+func (s *S3Storage) CommitStaged(ctx context.Context, hash common.Hash) error {
+	_, err := s.s3.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: hash.String()},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: stagedKey(hash)},
+	)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrNotFound
+		}
+
+		s.log.Warn("error committing staged blob", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	if err := s.s3.RemoveObject(ctx, s.bucket, stagedKey(hash), minio.RemoveObjectOptions{}); err != nil {
+		s.log.Warn("error removing committed staged blob", "hash", hash.String(), "err", err)
+	}
+
+	s.log.Info("wrote blob", "hash", hash.String())
+	return nil
+}
+
+func (s *S3Storage) DiscardStaged(ctx context.Context, hash common.Hash) error {
+	err := s.s3.RemoveObject(ctx, s.bucket, stagedKey(hash), minio.RemoveObjectOptions{})
+	if err != nil {
+		s.log.Warn("error discarding staged blob", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadLease(ctx context.Context) (Lease, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var names []string
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: leasePrefix + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing lease", "err", object.Err)
+			return Lease{}, ErrStorage
+		}
+
+		names = append(names, strings.TrimPrefix(object.Key, leasePrefix+"/"))
+	}
+
+	term, found := latestLeaseTerm(names)
+	if !found {
+		return Lease{}, ErrNotFound
+	}
+
+	res, err := s.s3.GetObject(ctx, s.bucket, leaseKey(term), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching lease", "err", err)
+		return Lease{}, ErrStorage
+	}
+	defer res.Close()
+
+	var lease Lease
+	err = json.NewDecoder(res).Decode(&lease)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			// Deleted by the writer of the next term since it was listed
+			return Lease{}, ErrNotFound
+		} else if errResponse.Code != "" {
+			s.log.Info("unexpected error fetching lease", "err", err)
+			return Lease{}, ErrStorage
+		}
+
+		s.log.Warn("error decoding lease", "err", err)
+		return Lease{}, ErrMarshaling
+	}
+
+	return lease, nil
+}
+
+// WriteLease puts the term with If-None-Match: *, which S3 refuses with a 412 if the term exists.
+func (s *S3Storage) WriteLease(ctx context.Context, lease Lease) error {
+	b, err := json.Marshal(lease)
+	if err != nil {
+		s.log.Warn("error encoding lease", "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(context.WithValue(ctx, ifNoneMatchKey{}, true), s.bucket, leaseKey(lease.Term), bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: s.userMetadata(nil),
+		CacheControl: "no-cache",
+	})
+	if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+		return ErrLeaseTaken
+	}
+	if err != nil {
+		s.log.Warn("error writing lease", "err", err)
+		return ErrStorage
+	}
+
+	if lease.Term > 0 {
+		if err := s.s3.RemoveObject(ctx, s.bucket, leaseKey(lease.Term-1), minio.RemoveObjectOptions{}); err != nil {
+			s.log.Warn("error deleting previous lease term", "err", err, "term", lease.Term-1)
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadBlock(ctx context.Context, hash common.Hash) (*spec.VersionedSignedBeaconBlock, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, blockKey(hash), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching block", "hash", hash.String(), "err", err)
+		return nil, ErrStorage
+	}
+	defer res.Close()
+
+	b, err := io.ReadAll(res)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+
+		s.log.Info("unexpected error fetching block", "hash", hash.String(), "err", err)
+		return nil, ErrStorage
+	}
+
+	block, err := decodeBlock(b)
+	if err != nil {
+		s.log.Warn("error decoding block", "hash", hash.String(), "err", err)
+		return nil, ErrMarshaling
+	}
+
+	return block, nil
+}
+
+func (s *S3Storage) WriteBlock(ctx context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error {
+	b, err := encodeBlock(block)
+	if err != nil {
+		s.log.Warn("error encoding block", "hash", hash.String(), "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, blockKey(hash), bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing block", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ReadDictionary(ctx context.Context, version uint32) ([]byte, error) {
+	res, err := s.s3.GetObject(ctx, s.bucket, dictionaryKey(version), minio.GetObjectOptions{})
+	if err != nil {
+		s.log.Info("unexpected error fetching dictionary", "version", version, "err", err)
+		return nil, ErrStorage
+	}
+	defer res.Close()
+
+	dict, err := io.ReadAll(res)
+	if err != nil {
+		errResponse := minio.ToErrorResponse(err)
+		if errResponse.Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+
+		s.log.Info("unexpected error fetching dictionary", "version", version, "err", err)
+		return nil, ErrStorage
+	}
+
+	return dict, nil
+}
+
+func (s *S3Storage) LatestDictionaryVersion(ctx context.Context) (uint32, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	latest := uint32(0)
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: dictionaryPrefix + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing dictionaries", "err", object.Err)
+			return 0, ErrStorage
+		}
+
+		if version, ok := parseDictionaryKey(object.Key); ok {
+			latest = max(latest, version)
+		}
+	}
+
+	return latest, nil
+}
+
+func (s *S3Storage) WriteDictionary(ctx context.Context, version uint32, dict []byte) error {
+	if err := s.codec.useDictionary(version, dict); err != nil {
+		s.log.Warn("error loading dictionary", "version", version, "err", err)
+		return ErrMarshaling
+	}
+
+	_, err := s.s3.PutObject(ctx, s.bucket, dictionaryKey(version), bytes.NewReader(dict), int64(len(dict)), minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing dictionary", "version", version, "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+func (s *S3Storage) ListWanted(ctx context.Context, fn func(hash common.Hash) error) error {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: wantedPrefix + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing wanted blocks", "err", object.Err)
+			return ErrStorage
+		}
+
+		name := strings.TrimPrefix(object.Key, wantedPrefix+"/")
+		if !isBlobKey(name) {
+			continue
+		}
+
+		if err := fn(common.HexToHash(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) WriteWanted(ctx context.Context, hash common.Hash) error {
+	_, err := s.s3.PutObject(ctx, s.bucket, wantedKey(hash), bytes.NewReader(nil), 0, minio.PutObjectOptions{
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing wanted block", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// DeleteWanted succeeds for blocks that aren't queued, as removing a key that doesn't exist succeeds.
+func (s *S3Storage) DeleteWanted(ctx context.Context, hash common.Hash) error {
+	err := s.s3.RemoveObject(ctx, s.bucket, wantedKey(hash), minio.RemoveObjectOptions{})
+	if err != nil {
+		s.log.Warn("error deleting wanted block", "hash", hash.String(), "err", err)
+		return ErrStorage
+	}
+
+	return nil
+}
+
+// ReadPartials reads the objects under the block's partial blob data prefix, which S3 lists in the order of their keys.
+func (s *S3Storage) ReadPartials(ctx context.Context, hash common.Hash) ([]BlobData, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var partials []BlobData
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: partialDir(hash) + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing partial blobs", "hash", hash.String(), "err", object.Err)
+			return nil, ErrStorage
+		}
+
+		res, err := s.s3.GetObject(ctx, s.bucket, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			s.log.Info("unexpected error fetching partial blob", "key", object.Key, "err", err)
+			return nil, ErrStorage
+		}
+
+		b, err := io.ReadAll(res)
+		res.Close()
+		if err != nil {
+			s.log.Info("unexpected error fetching partial blob", "key", object.Key, "err", err)
+			return nil, ErrStorage
+		}
+
+		data, err := s.codec.decode(ctx, b)
+		if err != nil {
+			s.log.Warn("error decoding partial blob", "key", object.Key, "err", err)
+			return nil, ErrMarshaling
+		}
+
+		partials = append(partials, data)
+	}
+
+	return partials, nil
+}
+
+func (s *S3Storage) WritePartial(ctx context.Context, data BlobData) error {
+	b, err := s.codec.encode(ctx, data)
+	if err != nil {
+		s.log.Warn("error encoding partial blob", "err", err)
+		return ErrMarshaling
+	}
+
+	_, err = s.s3.PutObject(ctx, s.bucket, partialKey(data), bytes.NewReader(b), int64(len(b)), minio.PutObjectOptions{
+		ContentType:  s.codec.contentType(),
+		UserMetadata: s.userMetadata(nil),
+	})
+
+	if err != nil {
+		s.log.Warn("error writing partial blob", "hash", data.Header.BeaconBlockHash.String(), "err", err)
+		return ErrStorage
+	}
+
+	s.log.Info("wrote partial blob", "hash", data.Header.BeaconBlockHash.String(), "sidecars", len(data.BlobSidecars.Data))
+	return nil
+}
+
+// deletePartials removes the objects under the block's partial blob data prefix.
+func (s *S3Storage) deletePartials(ctx context.Context, hash common.Hash) error {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.s3.ListObjects(lctx, s.bucket, minio.ListObjectsOptions{Prefix: partialDir(hash) + "/"}) {
+		if object.Err != nil {
+			s.log.Info("unexpected error listing partial blobs", "hash", hash.String(), "err", object.Err)
+			return ErrStorage
+		}
+
+		if err := s.s3.RemoveObject(ctx, s.bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			s.log.Warn("error deleting partial blob", "key", object.Key, "err", err)
+			return ErrStorage
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/sync/errgroup"
+)
+
+// rangedReadConfig configures reading large objects with concurrent ranged GETs, see S3Storage.readObject.
+type rangedReadConfig struct {
+	// threshold is the size in bytes above which objects are read in parts, 0 to always read them with a single GET.
+	threshold int64
+	// partSize is the size in bytes of each part.
+	partSize int64
+	// concurrency is the number of parts fetched at once.
+	concurrency int
+}
+
+// readObject reads the whole object res, of which info is the stat. Stating an object only sends a HEAD request, so
+// objects up to the ranged read threshold are then read from res with a single GET, and larger objects with concurrent
+// ranged GETs of a part each, into their place in the result. The ranged GETs only succeed while the object has the
+// ETag of the stat, so that the parts of an object overwritten in the meantime aren't mixed, and each part must be
+// exactly as long as requested.
+func (s *S3Storage) readObject(ctx context.Context, key string, res *minio.Object, info minio.ObjectInfo) ([]byte, error) {
+	cfg := s.rangedRead
+	if cfg.threshold == 0 || info.Size <= cfg.threshold {
+		return io.ReadAll(res)
+	}
+
+	result := make([]byte, info.Size)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(cfg.concurrency)
+	for start := int64(0); start < info.Size; start += cfg.partSize {
+		start, end := start, min(start+cfg.partSize, info.Size)
+		g.Go(func() error {
+			return s.readRange(gctx, key, info.ETag, start, result[start:end])
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// readRange reads the part of the object starting at offset into dst, if the object still has the given ETag.
+func (s *S3Storage) readRange(ctx context.Context, key string, etag string, offset int64, dst []byte) error {
+	end := offset + int64(len(dst)) - 1
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetMatchETag(etag); err != nil {
+		return err
+	}
+	if err := opts.SetRange(offset, end); err != nil {
+		return err
+	}
+
+	part, err := s.s3.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+
+	if _, err := io.ReadFull(part, dst); err != nil {
+		return fmt.Errorf("failed to read bytes %d-%d: %w", offset, end, err)
+	}
+
+	var extra [1]byte
+	if n, _ := part.Read(extra[:]); n > 0 {
+		return fmt.Errorf("read of bytes %d-%d returned more bytes", offset, end)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 serves HEADs and GETs of the objects of a bucket, honoring ranges and If-Match, and records the ranges of the
+// GETs.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	ranges  []string
+	// latency delays every GET of an object, and bandwidth limits the bytes per second of each response, as a remote S3
+	// would. Responses are not limited if bandwidth is 0.
+	latency   time.Duration
+	bandwidth int
+}
+
+// throttledWriter writes at most bandwidth bytes per second.
+type throttledWriter struct {
+	http.ResponseWriter
+	bandwidth int
+}
+
+func (w throttledWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Duration(len(b)) * time.Second / time.Duration(w.bandwidth))
+	return w.ResponseWriter.Write(b)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("location") {
+		_, _ = w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/blobs/")
+	f.mu.Lock()
+	object, ok := f.objects[key]
+	etag := f.etags[key]
+	if r.Method == http.MethodGet {
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+	}
+	f.mu.Unlock()
+
+	time.Sleep(f.latency)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	if f.bandwidth > 0 {
+		w = throttledWriter{ResponseWriter: w, bandwidth: f.bandwidth}
+	}
+	http.ServeContent(w, r, "", time.Unix(1700000000, 0), bytes.NewReader(object))
+}
+
+func (f *fakeS3) put(key string, object []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = object
+	f.etags[key] = fmt.Sprintf(`"%x"`, len(f.etags)+1)
+}
+
+func (f *fakeS3) requestedRanges() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ranges...)
+}
+
+func setupFakeS3(t testing.TB, cfg flags.S3Config) (*S3Storage, *fakeS3) {
+	fake := &fakeS3{objects: make(map[string][]byte), etags: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg.Endpoint = strings.TrimPrefix(server.URL, "http://")
+	cfg.Bucket = "blobs"
+	cfg.S3CredentialType = flags.S3CredentialStatic
+	cfg.AccessKey = "admin"
+	cfg.SecretAccessKey = "password"
+	s3, err := NewS3Storage(cfg, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	return s3, fake
+}
+
+func TestS3RangedRead(t *testing.T) {
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+	encoded, err := EncodeBlobData(data)
+	require.NoError(t, err)
+	size := int64(len(encoded))
+	data.Header.Format = flags.StorageFormatJSON
+
+	t.Run("ranged above threshold", func(t *testing.T) {
+		s3, fake := setupFakeS3(t, flags.S3Config{RangedReadThreshold: size - 1, RangedReadPartSize: 100_000, RangedReadConcurrency: 2})
+		fake.put(data.Header.BeaconBlockHash.String(), encoded)
+
+		read, err := s3.Read(context.Background(), data.Header.BeaconBlockHash)
+		require.NoError(t, err)
+		require.Equal(t, data, read)
+
+		// The object is fetched in parts of the configured size
+		var expected []string
+		for start := int64(0); start < size; start += 100_000 {
+			expected = append(expected, fmt.Sprintf("bytes=%d-%d", start, min(start+100_000, size)-1))
+		}
+		require.ElementsMatch(t, expected, fake.requestedRanges())
+	})
+
+	t.Run("single get below threshold", func(t *testing.T) {
+		s3, fake := setupFakeS3(t, flags.S3Config{RangedReadThreshold: size, RangedReadPartSize: 100_000, RangedReadConcurrency: 2})
+		fake.put(data.Header.BeaconBlockHash.String(), encoded)
+
+		read, err := s3.Read(context.Background(), data.Header.BeaconBlockHash)
+		require.NoError(t, err)
+		require.Equal(t, data, read)
+		require.Equal(t, []string{""}, fake.requestedRanges())
+	})
+
+	t.Run("object replaced during read", func(t *testing.T) {
+		s3, fake := setupFakeS3(t, flags.S3Config{RangedReadThreshold: 1, RangedReadPartSize: 100_000, RangedReadConcurrency: 2})
+		fake.put(data.Header.BeaconBlockHash.String(), encoded)
+
+		// The parts are only served while the object has the ETag of the first GET
+		res, err := s3.s3.GetObject(context.Background(), "blobs", data.Header.BeaconBlockHash.String(), minio.GetObjectOptions{})
+		require.NoError(t, err)
+		info, err := res.Stat()
+		require.NoError(t, err)
+		fake.put(data.Header.BeaconBlockHash.String(), encoded)
+
+		_, err = s3.readObject(context.Background(), data.Header.BeaconBlockHash.String(), res, info)
+		require.Error(t, err)
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		s3, _ := setupFakeS3(t, flags.S3Config{RangedReadThreshold: 1, RangedReadPartSize: 100_000, RangedReadConcurrency: 2})
+
+		_, err := s3.Read(context.Background(), data.Header.BeaconBlockHash)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// BenchmarkS3RangedRead reads an object the size of the blob data of a block with 9 blobs from a fake S3 with 5ms of
+// latency and 50MB/s per response, with a single GET and with ranged GETs.
+func BenchmarkS3RangedRead(b *testing.B) {
+	object := make([]byte, 9*2*blobSidecarSize)
+	_, err := rand.Read(object)
+	require.NoError(b, err)
+
+	for _, cfg := range []flags.S3Config{
+		{},
+		{RangedReadThreshold: 1, RangedReadPartSize: 512 << 10, RangedReadConcurrency: 4},
+	} {
+		b.Run(fmt.Sprintf("threshold=%d", cfg.RangedReadThreshold), func(b *testing.B) {
+			s3, fake := setupFakeS3(b, cfg)
+			fake.latency = 5 * time.Millisecond
+			fake.bandwidth = 50 << 20
+			fake.put("object", object)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res, err := s3.s3.GetObject(context.Background(), "blobs", "object", minio.GetObjectOptions{})
+				require.NoError(b, err)
+				info, err := res.Stat()
+				require.NoError(b, err)
+				read, err := s3.readObject(context.Background(), "object", res, info)
+				require.NoError(b, err)
+				require.Equal(b, object, read)
+				_ = res.Close()
+			}
+		})
+	}
+}
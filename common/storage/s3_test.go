@@ -7,6 +7,7 @@ import (
 
 	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/minio/minio-go/v7"
 	"github.com/stretchr/testify/require"
@@ -34,7 +35,7 @@ func setupS3(t *testing.T) *S3Storage {
 
 	require.NoError(t, err)
 
-	for object := range s3.s3.ListObjects(context.Background(), "blobs", minio.ListObjectsOptions{}) {
+	for object := range s3.s3.ListObjects(context.Background(), "blobs", minio.ListObjectsOptions{Recursive: true}) {
 		err = s3.s3.RemoveObject(context.Background(), "blobs", object.Key, minio.RemoveObjectOptions{})
 		require.NoError(t, err)
 	}
@@ -54,3 +55,104 @@ func TestS3Read(t *testing.T) {
 
 	runTestRead(t, s3)
 }
+
+func TestS3SlotIndex(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestSlotIndex(t, s3)
+}
+
+func TestS3ListSlotIndex(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestListSlotIndex(t, s3)
+}
+
+func TestS3SlotKeys(t *testing.T) {
+	for _, run := range []func(t *testing.T, s DataStore){runTestSlotIndex, runTestListSlotIndex, runTestSlotKeys} {
+		s3 := setupS3(t)
+		s3.keyScheme = flags.KeySchemeSlot
+		run(t, s3)
+	}
+}
+
+func TestS3ListAndDelete(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestListAndDelete(t, s3)
+}
+
+func TestS3Latest(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestLatest(t, s3)
+}
+
+func TestS3CIDIndex(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestCIDIndex(t, s3)
+}
+
+func TestS3ExecutionIndex(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestExecutionIndex(t, s3)
+}
+
+func TestS3StagedWrites(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestStagedWrites(t, s3)
+}
+
+func TestS3Lease(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestLease(t, s3)
+}
+
+func TestS3BackfillCheckpoint(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestBackfillCheckpoint(t, s3)
+}
+
+func TestS3Wanted(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestWanted(t, s3)
+}
+
+func TestS3Partials(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestPartials(t, s3)
+}
+
+func TestS3Block(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestBlock(t, s3)
+}
+
+func TestS3WriteIfNotExists(t *testing.T) {
+	s3 := setupS3(t)
+
+	runTestWriteIfNotExists(t, s3)
+}
+
+func TestS3InstanceID(t *testing.T) {
+	s3 := setupS3(t)
+	s3.instanceID = "archiver-1"
+
+	data := BlobData{Header: Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10}}
+	require.NoError(t, s3.Write(context.Background(), data))
+	require.NoError(t, s3.WriteSlotIndex(context.Background(), 10, data.Header.BeaconBlockHash))
+
+	for _, key := range []string{data.Header.BeaconBlockHash.String(), s3.slotIndexName(10, data.Header.BeaconBlockHash)} {
+		info, err := s3.s3.StatObject(context.Background(), "blobs", key, minio.StatObjectOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "archiver-1", info.Metadata.Get("X-Amz-Meta-"+instanceIDMetadataKey))
+	}
+}
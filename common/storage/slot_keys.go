@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// slotKeyPrefix is the key prefix under which blocks are named by slot with the slot key scheme, see
+// flags.KeySchemeSlot. A block is named by its slot and root, e.g. slots/00000000000000001234/<beacon block hash>, and
+// these names replace the entries of the slot index. Slots are zero padded to the width of the largest slot, so that
+// keys sort in slot order.
+const slotKeyPrefix = "slots"
+
+// slotKeyDir returns the key prefix of the names of the blocks of the slot, without a trailing slash.
+func slotKeyDir(slot uint64) string {
+	return slotDir(slotKeyPrefix, slot)
+}
+
+// slotKey returns the name of the block of the slot with the slot key scheme.
+func slotKey(slot uint64, hash common.Hash) string {
+	return path.Join(slotKeyDir(slot), hash.String())
+}
+
+// slotDir returns the key of the slot under the given prefix, zero padded like the names of the slot key scheme, without
+// a trailing slash.
+func slotDir(prefix string, slot uint64) string {
+	return path.Join(prefix, fmt.Sprintf("%020d", slot))
+}
+
+// parseSlotKey returns the slot and beacon block hash of a name of the slot key scheme, relative to slotKeyPrefix, i.e.
+// <slot>/<beacon block hash>. It returns false if the name isn't one.
+func parseSlotKey(name string) (uint64, common.Hash, bool) {
+	slotName, hashName, found := strings.Cut(name, "/")
+	if !found || len(slotName) != 20 || !isBlobKey(hashName) {
+		return 0, common.Hash{}, false
+	}
+
+	slot, err := strconv.ParseUint(slotName, 10, 64)
+	if err != nil {
+		return 0, common.Hash{}, false
+	}
+
+	return slot, common.HexToHash(hashName), true
+}
@@ -1,17 +1,48 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/base-org/blob-archiver/common/flags"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
 )
 
 const (
 	blobSidecarSize = 131928
+	// slotIndexPrefix is the key prefix under which slot index entries are stored.
+	slotIndexPrefix = "slot"
+	// latestKey is the key of the pointer to the most recently archived block.
+	latestKey = "latest"
+	// cidIndexPrefix is the key prefix under which CID index entries are stored.
+	cidIndexPrefix = "cid"
+	// backfillCheckpointKey is the key of the blocks a backfill stopped at before completing.
+	backfillCheckpointKey = "backfill"
+	// blockPrefix is the key prefix under which full beacon blocks are stored.
+	blockPrefix = "block"
+	// wantedPrefix is the key prefix under which the blocks of the wanted queue are stored.
+	wantedPrefix = "wanted"
+	// executionIndexPrefix is the key prefix under which execution block number index entries are stored.
+	executionIndexPrefix = "execution"
+	// stagedPrefix is the key prefix under which staged blob data is stored until it is committed.
+	stagedPrefix = "staged"
+	// leasePrefix is the key prefix under which the terms of the lease of the writing archiver are stored.
+	leasePrefix = "lease"
 )
 
 var (
@@ -21,10 +52,50 @@ var (
 	ErrStorage = errors.New("error accessing storage")
 	// ErrMarshaling is returned when there is an error in (un)marshaling the blob
 	ErrMarshaling = errors.New("error encoding/decoding blob")
+	// ErrPartialWrite is returned when the blob data was written but the slot index entry pointing at it was not.
+	ErrPartialWrite = errors.New("blob written without slot index")
+	// ErrWriteDeduped is returned by conditional writes when identical blob data is already stored, e.g. because a
+	// concurrent writer stored it first. The write can be treated as successful.
+	ErrWriteDeduped = errors.New("identical blob already stored")
+	// ErrWriteConflict is returned by conditional writes when different blob data is already stored for the block.
+	ErrWriteConflict = errors.New("different blob already stored")
+	// ErrLeaseTaken is returned when a term of the lease was already written by another writer.
+	ErrLeaseTaken = errors.New("lease term already taken")
+	// ErrUnsupported is returned by wrappers of data stores when a data store they wrap lacks an optional capability,
+	// e.g. isn't a LeaseStore.
+	ErrUnsupported = errors.New("not supported by data store")
 )
 
+// Lease is a term of the lease held by the only archiver writing to a data store, see LeaseStore.WriteLease. The
+// holder of a term holds the lease until it expires, and renews it by writing the next term before that. Once it has
+// expired, any archiver can take the lease over by writing the next term.
+type Lease struct {
+	Term    uint64    `json:"term"`
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
 type Header struct {
 	BeaconBlockHash common.Hash `json:"beacon_block_hash"`
+	Slot            uint64      `json:"slot,omitempty"`
+	// Optimistic is true if the beacon node had only optimistically imported the block when its blobs were archived.
+	Optimistic bool `json:"optimistic,omitempty"`
+	// Commitments is the number of blob KZG commitments of the block, which is the number of blob sidecars it should have.
+	// It is only recorded by archivers checking the completeness of blocks, 0 if unknown.
+	Commitments uint64 `json:"commitments,omitempty"`
+	// ExecutionBlockNumber is the block number of the execution payload of the block. It is only recorded by archivers
+	// maintaining the execution block number index, 0 if unknown.
+	ExecutionBlockNumber uint64 `json:"execution_block_number,omitempty"`
+	// Format is the storage format the blob data was read in, which is recorded in every object written, see
+	// formatPrefix, and detected for objects written before it was. It is only set on blob data read from a data store,
+	// and isn't part of the encoded header, so that blob data is encoded the same regardless of how it was stored.
+	Format flags.StorageFormat `json:"-"`
+}
+
+// Incomplete returns true if the block is known to have more blob commitments than the given number of sidecars, e.g.
+// because the beacon node didn't have all of them when it was archived.
+func (h Header) Incomplete(sidecars int) bool {
+	return uint64(sidecars) < h.Commitments
 }
 
 type BlobSidecars struct {
@@ -51,13 +122,411 @@ func (b *BlobSidecars) MarshalSSZ() ([]byte, error) {
 	return result, nil
 }
 
+// WriteSSZ writes the same bytes as MarshalSSZ to the writer, one sidecar at a time, so that only a single marshaled
+// sidecar is held in memory however many sidecars there are. It returns the number of bytes written, after which an
+// error leaves the SSZ truncated.
+func (b *BlobSidecars) WriteSSZ(w io.Writer) (int64, error) {
+	buf := make([]byte, 0, blobSidecarSize)
+	var written int64
+
+	for _, sidecar := range b.Data {
+		sidecarBytes, err := sidecar.MarshalSSZTo(buf[:0])
+		if err != nil {
+			return written, err
+		}
+
+		n, err := w.Write(sidecarBytes)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
 func (b *BlobSidecars) SizeSSZ() int {
 	return len(b.Data) * blobSidecarSize
 }
 
+// BlobData is the object stored for every beacon block. Its encoding must be byte-deterministic, so that re-archiving a
+// block produces an identical object: only structs and slices may be used, never maps.
 type BlobData struct {
 	Header       Header       `json:"header"`
 	BlobSidecars BlobSidecars `json:"blob_sidecars"`
+	// DataColumnSidecars are the data column sidecars of the block, see DataColumnSidecar. Archivers don't source them
+	// yet, so they are only stored when written by the caller, and omitted from blob data without them, which is encoded
+	// exactly as before they were introduced.
+	DataColumnSidecars []*DataColumnSidecar `json:"data_column_sidecars,omitempty"`
+}
+
+// EncodeBlobData serializes the blob data into JSON, the default format it is stored in. The same blob data always
+// produces the same bytes.
+func EncodeBlobData(data BlobData) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// sszPrefix marks blob data stored as SSZ. JSON documents never start with a zero byte, so the format of stored blob
+// data can be detected from its first byte.
+var sszPrefix = []byte{0x00, 's', 's', 'z'}
+
+// sszFixedSize is the size of the fixed part of the SSZ container: the beacon block hash, the slot and the offset of the
+// blob sidecars.
+const sszFixedSize = 32 + 8 + 4
+
+// sszOptimisticFixedSize is the size of the fixed part of the SSZ container of an optimistic block, which is followed by
+// a bool marking it optimistic. Other blocks are encoded without it, so the offset of the blob sidecars tells them apart.
+const sszOptimisticFixedSize = sszFixedSize + 1
+
+// sszCommitmentsFixedSize is the size of the fixed part of the SSZ container of a block whose number of blob commitments
+// is recorded, which is followed by the optimistic bool, set or not, and the number of commitments as a uint64.
+const sszCommitmentsFixedSize = sszOptimisticFixedSize + 8
+
+// sszColumnsFixedSize is the size of the fixed part of the SSZ container of a block with data column sidecars, which is
+// followed by the optimistic bool, the number of commitments, and the offset of the data column sidecars, which come
+// after the blob sidecars.
+const sszColumnsFixedSize = sszCommitmentsFixedSize + 4
+
+// sszExecutionFixedSize is the size of the fixed part of the SSZ container of a block whose execution block number is
+// recorded, which is followed by the fields of sszColumnsFixedSize, whether it has data column sidecars or not, and the
+// execution block number as a uint64.
+const sszExecutionFixedSize = sszColumnsFixedSize + 8
+
+// EncodeBlobDataSSZ serializes the blob data into SSZ, prefixed with sszPrefix. The blob data is encoded as the SSZ
+// container {beacon_block_hash: Bytes32, slot: uint64, blob_sidecars: List[BlobSidecar]}, so the blob sidecars are
+// stored exactly as they are served to clients requesting SSZ. Optimistic blocks have an additional optimistic: bool
+// field, and blocks whose number of commitments is recorded additional optimistic: bool and commitments: uint64 fields.
+// Blocks with data column sidecars have all three, and a data_column_sidecars: List[DataColumnSidecar] field. Blocks
+// whose execution block number is recorded have all four, and an additional execution_block_number: uint64 field.
+func EncodeBlobDataSSZ(data BlobData) ([]byte, error) {
+	sidecars, err := data.BlobSidecars.MarshalSSZ()
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := MarshalDataColumnSidecarsSSZ(data.DataColumnSidecars)
+	if err != nil {
+		return nil, err
+	}
+
+	fixedSize := sszFixedSize
+	if data.Header.ExecutionBlockNumber > 0 {
+		fixedSize = sszExecutionFixedSize
+	} else if len(data.DataColumnSidecars) > 0 {
+		fixedSize = sszColumnsFixedSize
+	} else if data.Header.Commitments > 0 {
+		fixedSize = sszCommitmentsFixedSize
+	} else if data.Header.Optimistic {
+		fixedSize = sszOptimisticFixedSize
+	}
+
+	result := make([]byte, 0, len(sszPrefix)+fixedSize+len(sidecars)+len(columns))
+	result = append(result, sszPrefix...)
+	result = append(result, data.Header.BeaconBlockHash.Bytes()...)
+	result = binary.LittleEndian.AppendUint64(result, data.Header.Slot)
+	result = binary.LittleEndian.AppendUint32(result, uint32(fixedSize))
+	if fixedSize >= sszOptimisticFixedSize {
+		optimistic := byte(0)
+		if data.Header.Optimistic {
+			optimistic = 1
+		}
+		result = append(result, optimistic)
+	}
+	if fixedSize >= sszCommitmentsFixedSize {
+		result = binary.LittleEndian.AppendUint64(result, data.Header.Commitments)
+	}
+	if fixedSize >= sszColumnsFixedSize {
+		result = binary.LittleEndian.AppendUint32(result, uint32(fixedSize+len(sidecars)))
+	}
+	if fixedSize == sszExecutionFixedSize {
+		result = binary.LittleEndian.AppendUint64(result, data.Header.ExecutionBlockNumber)
+	}
+	result = append(result, sidecars...)
+	return append(result, columns...), nil
+}
+
+// snappyPrefix marks blob data stored as snappy compressed SSZ. It is followed by the snappy block encoding of the blob
+// data encoded by EncodeBlobDataSSZ.
+var snappyPrefix = []byte{0x00, 's', 'n', 'p'}
+
+// EncodeBlobDataSnappySSZ serializes the blob data into SSZ, see EncodeBlobDataSSZ, compressed with snappy and prefixed
+// with snappyPrefix.
+func EncodeBlobDataSnappySSZ(data BlobData) ([]byte, error) {
+	b, err := EncodeBlobDataSSZ(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, len(snappyPrefix), len(snappyPrefix)+snappy.MaxEncodedLen(len(b)))
+	copy(result, snappyPrefix)
+	compressed := snappy.Encode(result[len(snappyPrefix):cap(result)], b)
+	return result[:len(snappyPrefix)+len(compressed)], nil
+}
+
+// formatPrefix marks blob data whose storage format is recorded. It is followed by the version of the format, see
+// formatVersions, and the blob data encoded in that format, so that it is decoded by its recorded format. Blob data
+// written before the format was recorded starts with the prefix of its format instead, or is JSON, and its format is
+// detected from that.
+var formatPrefix = []byte{0x00, 'f', 'm', 't'}
+
+// formatVersions are the versions recorded for each storage format, see formatPrefix. Versions are never reused.
+var formatVersions = map[flags.StorageFormat]byte{
+	flags.StorageFormatJSON:      1,
+	flags.StorageFormatSSZ:       2,
+	flags.StorageFormatSnappySSZ: 3,
+}
+
+// encodeBlobData serializes the blob data into the given format, prefixed with formatPrefix and the version of the
+// format.
+func encodeBlobData(data BlobData, format flags.StorageFormat) ([]byte, error) {
+	version, ok := formatVersions[format]
+	if !ok {
+		format, version = flags.StorageFormatJSON, formatVersions[flags.StorageFormatJSON]
+	}
+
+	var b []byte
+	var err error
+	switch format {
+	case flags.StorageFormatSSZ:
+		b, err = EncodeBlobDataSSZ(data)
+	case flags.StorageFormatSnappySSZ:
+		b, err = EncodeBlobDataSnappySSZ(data)
+	default:
+		b, err = EncodeBlobData(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(formatPrefix)+1+len(b))
+	result = append(result, formatPrefix...)
+	result = append(result, version)
+	return append(result, b...), nil
+}
+
+// storedFormat returns the storage format of stored blob data, and the blob data encoded in it. The format is read from
+// its recorded version, or detected from the prefix of blob data written before the format was recorded.
+func storedFormat(b []byte) (flags.StorageFormat, []byte, error) {
+	if !bytes.HasPrefix(b, formatPrefix) {
+		if bytes.HasPrefix(b, snappyPrefix) {
+			return flags.StorageFormatSnappySSZ, b, nil
+		} else if bytes.HasPrefix(b, sszPrefix) {
+			return flags.StorageFormatSSZ, b, nil
+		}
+		return flags.StorageFormatJSON, b, nil
+	}
+
+	if len(b) == len(formatPrefix) {
+		return "", nil, errors.New("blob data format version missing")
+	}
+
+	version := b[len(formatPrefix)]
+	for format, v := range formatVersions {
+		if v == version {
+			return format, b[len(formatPrefix)+1:], nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("unknown blob data format version: %d", version)
+}
+
+// compareStoredBlobData compares the object stored for a block with the blob data a conditional write was refused for,
+// returning ErrWriteDeduped if they hold the same blob data, and ErrWriteConflict otherwise. The blob data is compared
+// rather than the objects, so that the same blob data stored in another format or compression is a duplicate.
+func compareStoredBlobData(ctx context.Context, codec *blobCodec, stored []byte, data BlobData) error {
+	existing, err := codec.decode(ctx, stored)
+	if err != nil {
+		return ErrWriteConflict
+	}
+
+	a, err := EncodeBlobData(existing)
+	if err != nil {
+		return ErrMarshaling
+	}
+
+	b, err := EncodeBlobData(data)
+	if err != nil {
+		return ErrMarshaling
+	}
+
+	if !bytes.Equal(a, b) {
+		return ErrWriteConflict
+	}
+
+	return ErrWriteDeduped
+}
+
+// DecodeBlobData deserializes blob data stored in any format, by its recorded format, see storedFormat, and records the
+// format in the header.
+func DecodeBlobData(b []byte) (BlobData, error) {
+	format, b, err := storedFormat(b)
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	var data BlobData
+	switch format {
+	case flags.StorageFormatSnappySSZ:
+		data, err = decodeBlobDataSnappySSZ(b)
+	case flags.StorageFormatSSZ:
+		data, err = decodeBlobDataSSZ(b)
+	default:
+		err = json.Unmarshal(b, &data)
+	}
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	data.Header.Format = format
+	return data, nil
+}
+
+// decodeBlobDataSnappySSZ deserializes blob data encoded by EncodeBlobDataSnappySSZ.
+func decodeBlobDataSnappySSZ(b []byte) (BlobData, error) {
+	if !bytes.HasPrefix(b, snappyPrefix) {
+		return BlobData{}, errors.New("snappy blob data prefix missing")
+	}
+
+	decompressed, err := snappy.Decode(nil, b[len(snappyPrefix):])
+	if err != nil {
+		return BlobData{}, fmt.Errorf("failed to decompress snappy blob data: %w", err)
+	}
+
+	if !bytes.HasPrefix(decompressed, sszPrefix) {
+		return BlobData{}, errors.New("snappy blob data is not ssz")
+	}
+
+	return decodeBlobDataSSZ(decompressed)
+}
+
+// decodeBlobDataSSZ deserializes blob data encoded by EncodeBlobDataSSZ.
+func decodeBlobDataSSZ(b []byte) (BlobData, error) {
+	if !bytes.HasPrefix(b, sszPrefix) {
+		return BlobData{}, errors.New("ssz blob data prefix missing")
+	}
+
+	b = b[len(sszPrefix):]
+	if len(b) < sszFixedSize {
+		return BlobData{}, errors.New("ssz blob data too short")
+	}
+
+	offset := binary.LittleEndian.Uint32(b[40:sszFixedSize])
+	if (offset != sszFixedSize && offset != sszOptimisticFixedSize && offset != sszCommitmentsFixedSize && offset != sszColumnsFixedSize && offset != sszExecutionFixedSize) || int(offset) > len(b) {
+		return BlobData{}, fmt.Errorf("invalid ssz blob sidecars offset: %d", offset)
+	}
+
+	// Only blocks whose number of commitments is recorded may have the optimistic flag unset
+	optimistic := false
+	if offset >= sszOptimisticFixedSize {
+		flag := b[sszFixedSize]
+		if flag > 1 || (flag == 0 && offset == sszOptimisticFixedSize) {
+			return BlobData{}, fmt.Errorf("invalid ssz optimistic flag: %d", flag)
+		}
+		optimistic = flag == 1
+	}
+
+	commitments := uint64(0)
+	if offset >= sszCommitmentsFixedSize {
+		commitments = binary.LittleEndian.Uint64(b[sszOptimisticFixedSize:sszCommitmentsFixedSize])
+	}
+
+	executionBlockNumber := uint64(0)
+	if offset == sszExecutionFixedSize {
+		executionBlockNumber = binary.LittleEndian.Uint64(b[sszColumnsFixedSize:sszExecutionFixedSize])
+	}
+
+	end := uint32(len(b))
+	if offset >= sszColumnsFixedSize {
+		end = binary.LittleEndian.Uint32(b[sszCommitmentsFixedSize:sszColumnsFixedSize])
+		if end < offset || int(end) > len(b) {
+			return BlobData{}, fmt.Errorf("invalid ssz data column sidecars offset: %d", end)
+		}
+	}
+
+	sidecars := b[offset:end]
+	if len(sidecars)%blobSidecarSize != 0 {
+		return BlobData{}, fmt.Errorf("invalid ssz blob sidecars length: %d", len(sidecars))
+	}
+
+	columns, err := unmarshalDataColumnSidecarsSSZ(b[end:])
+	if err != nil {
+		return BlobData{}, err
+	}
+
+	data := BlobData{
+		Header: Header{
+			BeaconBlockHash:      common.BytesToHash(b[:32]),
+			Slot:                 binary.LittleEndian.Uint64(b[32:40]),
+			Optimistic:           optimistic,
+			Commitments:          commitments,
+			ExecutionBlockNumber: executionBlockNumber,
+		},
+		BlobSidecars: BlobSidecars{
+			Data: make([]*deneb.BlobSidecar, len(sidecars)/blobSidecarSize),
+		},
+		DataColumnSidecars: columns,
+	}
+
+	for i := range data.BlobSidecars.Data {
+		sidecar := new(deneb.BlobSidecar)
+		if err := sidecar.UnmarshalSSZ(sidecars[i*blobSidecarSize : (i+1)*blobSidecarSize]); err != nil {
+			return BlobData{}, err
+		}
+		data.BlobSidecars.Data[i] = sidecar
+	}
+
+	return data, nil
+}
+
+// storedBlock is the encoding of a stored beacon block, the same as the response of the beacon API's block endpoint.
+type storedBlock struct {
+	Version spec.DataVersion `json:"version"`
+	Data    json.RawMessage  `json:"data"`
+}
+
+// encodeBlock serializes the beacon block as JSON. Blobs were introduced in deneb, so only deneb blocks are supported.
+func encodeBlock(block *spec.VersionedSignedBeaconBlock) ([]byte, error) {
+	if block == nil || block.Version != spec.DataVersionDeneb || block.Deneb == nil {
+		return nil, errors.New("unsupported beacon block version")
+	}
+
+	data, err := json.Marshal(block.Deneb)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&storedBlock{Version: block.Version, Data: data})
+}
+
+// decodeBlock deserializes a beacon block encoded by encodeBlock.
+func decodeBlock(b []byte) (*spec.VersionedSignedBeaconBlock, error) {
+	var stored storedBlock
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+
+	if stored.Version != spec.DataVersionDeneb {
+		return nil, fmt.Errorf("unsupported beacon block version: %s", stored.Version)
+	}
+
+	block := &spec.VersionedSignedBeaconBlock{Version: stored.Version, Deneb: new(deneb.SignedBeaconBlock)}
+	if err := json.Unmarshal(stored.Data, block.Deneb); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// contentType returns the content type of blob data stored in the given format.
+func contentType(format flags.StorageFormat) string {
+	switch format {
+	case flags.StorageFormatSSZ:
+		return "application/octet-stream"
+	case flags.StorageFormatSnappySSZ:
+		return "application/x-snappy"
+	default:
+		return "application/json"
+	}
 }
 
 // DataStoreReader is the interface for reading from a data store.
@@ -74,6 +543,77 @@ type DataStoreReader interface {
 	// - ErrStorage: there was an error accessing the data store.
 	// - ErrMarshaling: there was an error decoding the blob data.
 	Read(ctx context.Context, hash common.Hash) (BlobData, error)
+	// ReadSlotIndex reads the beacon block hash stored in the slot index for the given slot.
+	// It should return one of the following:
+	// - nil: reading the index entry was successful. The beacon block hash is also returned.
+	// - ErrNotFound: there is no index entry for the slot.
+	// - ErrStorage: there was an error accessing the data store.
+	ReadSlotIndex(ctx context.Context, slot uint64) (common.Hash, error)
+	// ListSlotIndex calls fn with the slot and beacon block hash of every slot index entry in the inclusive slot range,
+	// in ascending slot order, so that blobs can be enumerated by slot without reading their headers. Only blobs that
+	// were written with a slot index entry are listed. Listing stops at the first error returned by fn, which is then
+	// returned. Otherwise, it should return one of the following:
+	// - nil: listing was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: an entry could not be decoded.
+	ListSlotIndex(ctx context.Context, from, to uint64, fn func(slot uint64, hash common.Hash) error) error
+	// Stat returns the header of the blob data stored for the given beacon block hash, without necessarily reading the
+	// blob sidecars. It should return one of the following:
+	// - nil: the header was read successfully.
+	// - ErrNotFound: the blob data was not found in the data store.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the header.
+	Stat(ctx context.Context, hash common.Hash) (Header, error)
+	// List calls fn with the beacon block hash of every blob stored in the data store, in no particular order. Listing
+	// stops at the first error returned by fn, which is then returned. Otherwise, it should return one of the following:
+	// - nil: listing was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	List(ctx context.Context, fn func(hash common.Hash) error) error
+	// ReadLatest reads the pointer to the most recently archived block, see DataStoreWriter.WriteLatest.
+	// It should return one of the following:
+	// - nil: reading the pointer was successful. The header of the latest block is also returned.
+	// - ErrNotFound: no pointer has been written yet.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the pointer.
+	ReadLatest(ctx context.Context) (Header, error)
+	// ReadCIDIndex reads the content identifiers the blobs of the given beacon block hash were pinned under in a
+	// content-addressed store, in the order of their blob index.
+	// It should return one of the following:
+	// - nil: reading the index entry was successful. The CIDs are also returned.
+	// - ErrNotFound: there is no index entry for the block.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the index entry.
+	ReadCIDIndex(ctx context.Context, hash common.Hash) ([]string, error)
+	// ReadBackfillCheckpoint reads the blocks backfills stopped at before completing, see
+	// DataStoreWriter.WriteBackfillCheckpoint.
+	// It should return one of the following:
+	// - nil: reading the checkpoint was successful. The headers of the blocks are also returned, and may be empty.
+	// - ErrNotFound: no checkpoint has been written yet.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the checkpoint.
+	ReadBackfillCheckpoint(ctx context.Context) ([]Header, error)
+	// ReadBlock reads the full signed beacon block stored for the given beacon block hash, see DataStoreWriter.WriteBlock.
+	// It should return one of the following:
+	// - nil: reading the block was successful. The block is also returned.
+	// - ErrNotFound: the block was not found in the data store.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the block.
+	ReadBlock(ctx context.Context, hash common.Hash) (*spec.VersionedSignedBeaconBlock, error)
+	// ReadPartials reads the partial blob data written for the given beacon block hash, see
+	// DataStoreWriter.WritePartial, in ascending order of their keys. See AssembleBlobData to merge it.
+	// It should return one of the following:
+	// - nil: reading the partial blob data was successful. The partial blob data is also returned, and may be empty.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding partial blob data.
+	ReadPartials(ctx context.Context, hash common.Hash) ([]BlobData, error)
+	// ReadExecutionIndex reads the beacon block hash stored in the execution block number index for the given execution
+	// block number, see DataStoreWriter.WriteExecutionIndex.
+	// It should return one of the following:
+	// - nil: reading the index entry was successful. The beacon block hash is also returned.
+	// - ErrNotFound: there is no index entry for the execution block number.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the index entry.
+	ReadExecutionIndex(ctx context.Context, number uint64) (common.Hash, error)
 }
 
 // DataStoreWriter is the interface for writing to a data store.
@@ -83,6 +623,163 @@ type DataStoreWriter interface {
 	// - ErrStorage: there was an error accessing the data store.
 	// - ErrMarshaling: there was an error encoding the blob data.
 	Write(ctx context.Context, data BlobData) error
+	// WriteIfNotExists writes the given blob data to the data store unless blob data is already stored for the block,
+	// which is checked atomically with the write, so that concurrent writers never overwrite each other. It should return
+	// one of the following errors:
+	// - nil: writing the blob was successful.
+	// - ErrWriteDeduped: the same blob data was already stored, nothing was written.
+	// - ErrWriteConflict: different blob data was already stored, nothing was written.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the blob data.
+	WriteIfNotExists(ctx context.Context, data BlobData) error
+	// WriteSlotIndex writes a slot index entry pointing the given slot at the given beacon block hash. It should return
+	// one of the following errors:
+	// - nil: writing the index entry was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	WriteSlotIndex(ctx context.Context, slot uint64, hash common.Hash) error
+	// Delete deletes the blob data for the given beacon block hash, and the beacon block and partial blob data stored
+	// for it, if any. It should return one of the following errors:
+	// - nil: deleting the blob was successful.
+	// - ErrNotFound: the blob data was not found in the data store.
+	// - ErrStorage: there was an error accessing the data store.
+	Delete(ctx context.Context, hash common.Hash) error
+	// DeleteSlotIndex deletes the slot index entry for the given slot. It should return one of the following errors:
+	// - nil: deleting the index entry was successful.
+	// - ErrNotFound: there is no index entry for the slot.
+	// - ErrStorage: there was an error accessing the data store.
+	DeleteSlotIndex(ctx context.Context, slot uint64) error
+	// WriteLatest overwrites the pointer to the most recently archived block. Unlike blobs, the pointer is mutable, so a
+	// reader may observe the previous pointer after a write, or a pointer to a block that has since been reorged out.
+	// It should return one of the following errors:
+	// - nil: writing the pointer was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the pointer.
+	WriteLatest(ctx context.Context, header Header) error
+	// WriteCIDIndex writes the CID index entry of the given beacon block hash, see DataStoreReader.ReadCIDIndex. It
+	// should return one of the following errors:
+	// - nil: writing the index entry was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the index entry.
+	WriteCIDIndex(ctx context.Context, hash common.Hash, cids []string) error
+	// WriteBackfillCheckpoint overwrites the blocks backfills stopped at before completing, whose blobs are stored but
+	// whose ancestors may not be, so that backfilling can resume from them. Writing no headers clears the checkpoint.
+	// It should return one of the following errors:
+	// - nil: writing the checkpoint was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the checkpoint.
+	WriteBackfillCheckpoint(ctx context.Context, headers []Header) error
+	// WriteBlock writes the full signed beacon block of the given beacon block hash, alongside its blob data, for uses
+	// that need more of the block than its blobs. Only deneb blocks are supported. It should return one of the following
+	// errors:
+	// - nil: writing the block was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the block.
+	WriteBlock(ctx context.Context, hash common.Hash, block *spec.VersionedSignedBeaconBlock) error
+	// WritePartial writes blob data holding some of the blob sidecars of a block, for blocks whose sidecars are archived
+	// incrementally, e.g. as some indices arrive later. Partial blob data is keyed by the block and the indices of its
+	// sidecars, so writing the same indices again replaces it, and is only read by AssembleBlobData. It should return
+	// one of the following errors:
+	// - nil: writing the partial blob data was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the blob data.
+	WritePartial(ctx context.Context, data BlobData) error
+	// WriteExecutionIndex writes an execution block number index entry pointing the given execution block number at the
+	// given beacon block hash, for readers looking blocks up by the block number of their execution payload. Index
+	// entries are not deleted along with their blocks, so an entry may point at a block that is no longer stored. It
+	// should return one of the following errors:
+	// - nil: writing the index entry was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	WriteExecutionIndex(ctx context.Context, number uint64, hash common.Hash) error
+}
+
+// The following are optional interfaces of data stores, for features that not every data store may support. Features
+// relying on one assert it on the data store when they are enabled, and fail to start if it is missing. All data stores
+// of this package implement every one of them. Wrappers, e.g. MetricsStorage and MirrorStorage, implement them too,
+// returning ErrUnsupported if a data store they wrap doesn't.
+
+// LeaseStore is a data store that holds the lease of the archivers writing to it.
+type LeaseStore interface {
+	// ReadLease reads the latest term of the lease, see WriteLease.
+	// It should return one of the following:
+	// - nil: reading the lease was successful. The latest term is also returned.
+	// - ErrNotFound: no term of the lease has been written yet.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error decoding the lease.
+	ReadLease(ctx context.Context) (Lease, error)
+	// WriteLease writes the given term of the lease, unless it was already written, which is checked atomically with the
+	// write, so that of the archivers competing for a term only one gets it. The term before it is deleted. It should
+	// return one of the following errors:
+	// - nil: writing the term was successful.
+	// - ErrLeaseTaken: the term was already written.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the lease.
+	WriteLease(ctx context.Context, lease Lease) error
+}
+
+// StagingStore is a data store that blob data can be staged in before it is committed.
+type StagingStore interface {
+	// StageWrite writes the given blob data to a staging area, where it isn't read, listed or found to exist, until
+	// CommitStaged moves it into place or DiscardStaged deletes it, for writes that must only become visible once
+	// they are staged in every data store, see MirrorStorage. Staging blob data for the same block again replaces it.
+	// It should return one of the following errors:
+	// - nil: staging the blob was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: there was an error encoding the blob data.
+	StageWrite(ctx context.Context, data BlobData) error
+	// CommitStaged moves the blob data staged for the given beacon block hash into place, replacing any blob data stored
+	// for it. It should return one of the following errors:
+	// - nil: committing the blob was successful.
+	// - ErrNotFound: there is no blob data staged for the block.
+	// - ErrStorage: there was an error accessing the data store.
+	CommitStaged(ctx context.Context, hash common.Hash) error
+	// DiscardStaged deletes the blob data staged for the given beacon block hash. Discarding blob data that isn't
+	// staged succeeds. It should return one of the following errors:
+	// - nil: discarding the blob was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	DiscardStaged(ctx context.Context, hash common.Hash) error
+}
+
+// WantedStore is a data store that holds the queue of blocks readers couldn't find.
+type WantedStore interface {
+	// WriteWanted adds the given beacon block hash to the wanted queue, the blocks that readers couldn't find and that
+	// the archiver should fetch. Adding a block that is already queued has no effect. It should return one of the
+	// following errors:
+	// - nil: adding the block was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	WriteWanted(ctx context.Context, hash common.Hash) error
+	// DeleteWanted removes the given beacon block hash from the wanted queue. Removing a block that isn't queued
+	// succeeds. It should return one of the following errors:
+	// - nil: removing the block was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	DeleteWanted(ctx context.Context, hash common.Hash) error
+	// ListWanted calls fn with the beacon block hash of every block in the wanted queue, see WriteWanted, in no
+	// particular order. Listing stops at the first error returned by fn, which is then returned. Otherwise, it should
+	// return one of the following:
+	// - nil: listing was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	ListWanted(ctx context.Context, fn func(hash common.Hash) error) error
+}
+
+// DictionaryStore is a data store that holds the dictionaries blob data is compressed with.
+type DictionaryStore interface {
+	// ReadDictionary reads the compression dictionary of the given version, see WriteDictionary.
+	// It should return one of the following:
+	// - nil: reading the dictionary was successful. The dictionary is also returned.
+	// - ErrNotFound: there is no dictionary of the version.
+	// - ErrStorage: there was an error accessing the data store.
+	ReadDictionary(ctx context.Context, version uint32) ([]byte, error)
+	// LatestDictionaryVersion returns the highest version of the compression dictionaries stored, 0 if there are none.
+	// It should return one of the following:
+	// - nil: listing the dictionaries was successful. The version is also returned.
+	// - ErrStorage: there was an error accessing the data store.
+	LatestDictionaryVersion(ctx context.Context) (uint32, error)
+	// WriteDictionary writes the zstd compression dictionary of the given version, see TrainDictionary, and makes
+	// subsequent writes of blob data compressed with zstd use it. Dictionaries are never deleted, so that blob data
+	// compressed with older dictionaries remains readable. It should return one of the following errors:
+	// - nil: writing the dictionary was successful.
+	// - ErrStorage: there was an error accessing the data store.
+	// - ErrMarshaling: the dictionary is invalid.
+	WriteDictionary(ctx context.Context, version uint32, dict []byte) error
 }
 
 // DataStore is the interface for a data store that can be both written to and read from.
@@ -91,10 +788,201 @@ type DataStore interface {
 	DataStoreWriter
 }
 
-func NewStorage(cfg flags.StorageConfig, l log.Logger) (DataStore, error) {
+// WriteWithSlotIndex writes the blob data and a slot index entry for it as a single logical operation. None of the
+// backends support transactions, so the ordering is fixed: the blob data is written first, then the index entry. This
+// guarantees an index entry never points at a blob that is missing. If the index write fails, ErrPartialWrite is
+// returned and ReconcileSlotIndex should be used to repair the index once the blob is known to exist.
+func WriteWithSlotIndex(ctx context.Context, s DataStoreWriter, data BlobData) error {
+	if err := s.Write(ctx, data); err != nil {
+		return err
+	}
+
+	if err := s.WriteSlotIndex(ctx, data.Header.Slot, data.Header.BeaconBlockHash); err != nil {
+		return fmt.Errorf("%w: %w", ErrPartialWrite, err)
+	}
+
+	return nil
+}
+
+// WriteIfNotExistsWithSlotIndex is WriteWithSlotIndex with a conditional write of the blob data, see
+// DataStoreWriter.WriteIfNotExists. If the same blob data was already stored, the slot index entry is still written, as
+// the writer that stored it may not have written it yet, and ErrWriteDeduped is returned.
+func WriteIfNotExistsWithSlotIndex(ctx context.Context, s DataStoreWriter, data BlobData) error {
+	err := s.WriteIfNotExists(ctx, data)
+	if err != nil && !errors.Is(err, ErrWriteDeduped) {
+		return err
+	}
+
+	if err := s.WriteSlotIndex(ctx, data.Header.Slot, data.Header.BeaconBlockHash); err != nil {
+		return fmt.Errorf("%w: %w", ErrPartialWrite, err)
+	}
+
+	return err
+}
+
+// ReconcileSlotIndex makes sure the slot index entry for the given slot points at the given beacon block hash, writing
+// it if it is missing or stale. It returns true if the index needed to be repaired.
+func ReconcileSlotIndex(ctx context.Context, s DataStore, slot uint64, hash common.Hash) (bool, error) {
+	indexed, err := s.ReadSlotIndex(ctx, slot)
+	if err == nil && indexed == hash {
+		return false, nil
+	}
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+
+	if err := s.WriteSlotIndex(ctx, slot, hash); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteWithSlotIndex deletes the blob data described by the header, along with the slot index entry pointing at it.
+// The index entry is deleted first, so that it never points at a missing blob. Entries pointing at a different block
+// are left untouched.
+func DeleteWithSlotIndex(ctx context.Context, s DataStore, header Header) error {
+	if header.Slot != 0 {
+		indexed, err := s.ReadSlotIndex(ctx, header.Slot)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if err == nil && indexed == header.BeaconBlockHash {
+			if err := s.DeleteSlotIndex(ctx, header.Slot); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+	}
+
+	return s.Delete(ctx, header.BeaconBlockHash)
+}
+
+// isBlobKey returns true if the key is the name of a stored blob, i.e. a hex encoded beacon block hash.
+func isBlobKey(key string) bool {
+	if len(key) != 66 || !strings.HasPrefix(key, "0x") {
+		return false
+	}
+
+	_, err := hexutil.Decode(key)
+	return err == nil
+}
+
+// listSlotIndex reads the slot index entries with the given names that are within the inclusive slot range from s, and
+// calls fn with them in ascending slot order. Names that aren't slots are ignored, and entries deleted since they were
+// listed are skipped.
+func listSlotIndex(ctx context.Context, s DataStoreReader, names []string, from, to uint64, fn func(slot uint64, hash common.Hash) error) error {
+	var slots []uint64
+	for _, name := range names {
+		slot, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || slot < from || slot > to {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	slices.Sort(slots)
+
+	for _, slot := range slots {
+		hash, err := s.ReadSlotIndex(ctx, slot)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(slot, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// slotIndexKey returns the key of the slot index entry of the slot, zero padded so that entries sort in slot order.
+func slotIndexKey(slot uint64) string {
+	return slotDir(slotIndexPrefix, slot)
+}
+
+func executionIndexKey(number uint64) string {
+	return path.Join(executionIndexPrefix, strconv.FormatUint(number, 10))
+}
+
+// leaseKey returns the key of a term of the lease, zero padded so that terms sort in order.
+func leaseKey(term uint64) string {
+	return path.Join(leasePrefix, fmt.Sprintf("%020d", term))
+}
+
+// latestLeaseTerm returns the highest term of the lease among the given key names, or false if none of them is a term.
+func latestLeaseTerm(names []string) (uint64, bool) {
+	var latest uint64
+	found := false
+	for _, name := range names {
+		term, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || found && term <= latest {
+			continue
+		}
+		latest, found = term, true
+	}
+
+	return latest, found
+}
+
+func stagedKey(hash common.Hash) string {
+	return path.Join(stagedPrefix, hash.String())
+}
+
+func cidIndexKey(hash common.Hash) string {
+	return path.Join(cidIndexPrefix, hash.String())
+}
+
+func blockKey(hash common.Hash) string {
+	return path.Join(blockPrefix, hash.String())
+}
+
+func wantedKey(hash common.Hash) string {
+	return path.Join(wantedPrefix, hash.String())
+}
+
+// NewStorage creates the data store described by the configuration. If m is not nil, the operations on the data store
+// are recorded with it, labeled with the URL of the data store.
+func NewStorage(cfg flags.StorageConfig, m Metricer, l log.Logger) (DataStore, error) {
+	var store DataStore
 	if cfg.DataStorageType == flags.DataStorageS3 {
-		return NewS3Storage(cfg.S3Config, l)
+		s, err := NewS3Storage(cfg.S3Config, l)
+		if err != nil {
+			return nil, err
+		}
+		s.codec = newBlobCodec(cfg.Format, cfg.Compression, s)
+		s.codec.metrics = m
+		s.instanceID = cfg.InstanceID
+		s.keyScheme = cfg.KeyScheme
+		store = s
+	} else if cfg.DataStorageType == flags.DataStoragePebble {
+		if cfg.InstanceID != "" {
+			return nil, errors.New("the pebble data-store can't record an instance id")
+		}
+
+		s, err := NewPebbleStorage(cfg.PebbleDirectory, l)
+		if err != nil {
+			return nil, err
+		}
+		s.codec = newBlobCodec(cfg.Format, cfg.Compression, s)
+		s.codec.metrics = m
+		s.keyScheme = cfg.KeyScheme
+		store = s
 	} else {
-		return NewFileStorage(cfg.FileStorageDirectory, l), nil
+		s := NewFileStorage(cfg.FileStorageDirectory, l)
+		s.codec = newBlobCodec(cfg.Format, cfg.Compression, s)
+		s.codec.metrics = m
+		s.instanceID = cfg.InstanceID
+		s.keyScheme = cfg.KeyScheme
+		store = s
+	}
+
+	if m != nil {
+		store = NewMetricsStorage(store, cfg.URL(), m)
 	}
+
+	return store, nil
 }
@@ -1,11 +1,24 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"slices"
 	"testing"
 
 	"github.com/attestantio/go-eth2-client/api"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/base-org/blob-archiver/common/blobtest"
+	"github.com/base-org/blob-archiver/common/flags"
+	"github.com/ethereum-optimism/optimism/op-service/metrics"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/require"
 )
 
@@ -42,3 +55,357 @@ func TestMarshalSSZ(t *testing.T) {
 		require.Equal(t, b.Data[i].KZGProof, sidecars.Sidecars[i].KZGProof)
 	}
 }
+
+// limitedWriter accepts up to limit bytes, and fails writes beyond them.
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) > w.limit {
+		return 0, errors.New("write limit exceeded")
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestWriteSSZ(t *testing.T) {
+	b := &BlobSidecars{Data: blobtest.NewBlobSidecars(t, 4)}
+
+	expected, err := b.MarshalSSZ()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	written, err := b.WriteSSZ(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(expected)), written)
+	require.Equal(t, expected, buf.Bytes())
+
+	w := &limitedWriter{limit: 2*blobSidecarSize + 1}
+	written, err = b.WriteSSZ(w)
+	require.Error(t, err)
+	require.Equal(t, int64(2*blobSidecarSize), written)
+	require.Equal(t, expected[:written], w.Bytes())
+}
+
+func TestEncodeBlobDataIsDeterministic(t *testing.T) {
+	data := BlobData{
+		Header: Header{
+			BeaconBlockHash: common.Hash{1, 2, 3},
+			Slot:            10,
+		},
+		BlobSidecars: BlobSidecars{
+			Data: blobtest.NewBlobSidecars(t, 3),
+		},
+	}
+
+	first, err := EncodeBlobData(data)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		again, err := EncodeBlobData(data)
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+	}
+
+	// Decoding and re-encoding also yields the same bytes
+	var decoded BlobData
+	require.NoError(t, json.Unmarshal(first, &decoded))
+	reencoded, err := EncodeBlobData(decoded)
+	require.NoError(t, err)
+	require.Equal(t, first, reencoded)
+}
+
+func TestBlobDataFormatsRoundtrip(t *testing.T) {
+	data := BlobData{
+		Header: Header{
+			BeaconBlockHash: common.Hash{1, 2, 3},
+			Slot:            10,
+		},
+		BlobSidecars: BlobSidecars{
+			Data: blobtest.NewBlobSidecars(t, 3),
+		},
+	}
+
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+		encoded, err := encodeBlobData(data, format)
+		require.NoError(t, err)
+
+		decoded, err := DecodeBlobData(encoded)
+		require.NoError(t, err)
+		expected := data
+		expected.Header.Format = format
+		require.Equal(t, expected, decoded)
+
+		reencoded, err := encodeBlobData(decoded, format)
+		require.NoError(t, err)
+		require.Equal(t, encoded, reencoded)
+	}
+
+	// The SSZ encoding stores the sidecars as they are served
+	encoded, err := EncodeBlobDataSSZ(data)
+	require.NoError(t, err)
+	sidecars, err := data.BlobSidecars.MarshalSSZ()
+	require.NoError(t, err)
+	require.Equal(t, sidecars, encoded[len(encoded)-len(sidecars):])
+
+	// Blocks without blobs are supported too
+	empty := BlobData{Header: Header{BeaconBlockHash: common.Hash{4}, Slot: 11}, BlobSidecars: BlobSidecars{Data: []*deneb.BlobSidecar{}}}
+	encoded, err = EncodeBlobDataSSZ(empty)
+	require.NoError(t, err)
+	decoded, err := DecodeBlobData(encoded)
+	require.NoError(t, err)
+	empty.Header.Format = flags.StorageFormatSSZ
+	require.Equal(t, empty, decoded)
+
+	// The optimistic flag of a block survives every format
+	optimistic := data
+	optimistic.Header.Optimistic = true
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+		encoded, err := encodeBlobData(optimistic, format)
+		require.NoError(t, err)
+
+		decoded, err := DecodeBlobData(encoded)
+		require.NoError(t, err)
+		optimistic.Header.Format = format
+		require.Equal(t, optimistic, decoded)
+	}
+
+	// So does the number of commitments, with or without the optimistic flag
+	for _, header := range []Header{
+		{BeaconBlockHash: common.Hash{1}, Slot: 10, Commitments: 4},
+		{BeaconBlockHash: common.Hash{1}, Slot: 10, Commitments: 4, Optimistic: true},
+	} {
+		counted := data
+		counted.Header = header
+		for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+			encoded, err := encodeBlobData(counted, format)
+			require.NoError(t, err)
+
+			decoded, err := DecodeBlobData(encoded)
+			require.NoError(t, err)
+			counted.Header.Format = format
+			require.Equal(t, counted, decoded)
+			require.True(t, decoded.Header.Incomplete(len(data.BlobSidecars.Data)))
+		}
+	}
+
+	// And the execution block number, with or without the other fields
+	for _, header := range []Header{
+		{BeaconBlockHash: common.Hash{1}, Slot: 10, ExecutionBlockNumber: 19426587},
+		{BeaconBlockHash: common.Hash{1}, Slot: 10, ExecutionBlockNumber: 19426587, Commitments: 4, Optimistic: true},
+	} {
+		numbered := data
+		numbered.Header = header
+		for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+			encoded, err := encodeBlobData(numbered, format)
+			require.NoError(t, err)
+
+			decoded, err := DecodeBlobData(encoded)
+			require.NoError(t, err)
+			numbered.Header.Format = format
+			require.Equal(t, numbered, decoded)
+		}
+	}
+}
+
+func TestDecodeInvalidSSZ(t *testing.T) {
+	encoded, err := EncodeBlobDataSSZ(BlobData{BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)}})
+	require.NoError(t, err)
+
+	_, err = DecodeBlobData(encoded[:len(encoded)-1])
+	require.Error(t, err)
+
+	_, err = DecodeBlobData(encoded[:len(sszPrefix)+10])
+	require.Error(t, err)
+
+	// Snappy compressed data must be valid, and decompress to SSZ
+	compressed, err := EncodeBlobDataSnappySSZ(BlobData{BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)}})
+	require.NoError(t, err)
+	_, err = DecodeBlobData(compressed[:len(compressed)-1])
+	require.Error(t, err)
+
+	_, err = DecodeBlobData(append(slices.Clone(snappyPrefix), snappy.Encode(nil, []byte(`{"header":{}}`))...))
+	require.Error(t, err)
+}
+
+func TestSnappySSZStorageFormat(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStorage(flags.StorageConfig{
+		DataStorageType:      flags.DataStorageFile,
+		FileStorageDirectory: dir,
+		Format:               flags.StorageFormatSnappySSZ,
+	}, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	require.NoError(t, store.Write(context.Background(), data))
+	raw, err := os.ReadFile(path.Join(dir, data.Header.BeaconBlockHash.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(raw, append(slices.Clone(formatPrefix), formatVersions[flags.StorageFormatSnappySSZ])))
+	require.True(t, bytes.HasPrefix(raw[len(formatPrefix)+1:], snappyPrefix))
+
+	read, err := store.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatSnappySSZ
+	require.Equal(t, data, read)
+
+	// Objects written in other formats are still read
+	other := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{4, 5, 6}, Slot: 11},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}
+	raw, err = EncodeBlobDataSSZ(other)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, other.Header.BeaconBlockHash.String()), raw, 0644))
+
+	read, err = store.Read(context.Background(), other.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	other.Header.Format = flags.StorageFormatSSZ
+	require.Equal(t, other, read)
+}
+
+func TestStorageFormats(t *testing.T) {
+	dir := t.TempDir()
+	sszStore, err := NewStorage(flags.StorageConfig{
+		DataStorageType:      flags.DataStorageFile,
+		FileStorageDirectory: dir,
+		Format:               flags.StorageFormatSSZ,
+	}, nil, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+
+	data := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+	}
+
+	require.NoError(t, sszStore.Write(context.Background(), data))
+	raw, err := os.ReadFile(path.Join(dir, data.Header.BeaconBlockHash.String()))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(raw[len(formatPrefix)+1:], sszPrefix))
+
+	read, err := sszStore.Read(context.Background(), data.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	data.Header.Format = flags.StorageFormatSSZ
+	require.Equal(t, data, read)
+
+	// Objects written as JSON, e.g. before the format was changed, are still read
+	other := BlobData{
+		Header:       Header{BeaconBlockHash: common.Hash{4, 5, 6}, Slot: 11},
+		BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)},
+	}
+	raw, err = EncodeBlobData(other)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, other.Header.BeaconBlockHash.String()), raw, 0644))
+
+	read, err = sszStore.Read(context.Background(), other.Header.BeaconBlockHash)
+	require.NoError(t, err)
+	other.Header.Format = flags.StorageFormatJSON
+	require.Equal(t, other, read)
+}
+
+func TestSlotIndexKeysSortInSlotOrder(t *testing.T) {
+	require.Equal(t, "slot/00000000000000001234", slotIndexKey(1234))
+
+	slots := []uint64{1000, 11, 5, 100, 9, 10, 18446744073709551615}
+	var keys []string
+	for _, slot := range slots {
+		keys = append(keys, slotIndexKey(slot))
+	}
+	slices.Sort(keys)
+	slices.Sort(slots)
+
+	for i, slot := range slots {
+		require.Equal(t, slotIndexKey(slot), keys[i])
+	}
+}
+
+func TestPebbleRejectsInstanceID(t *testing.T) {
+	cfg := flags.StorageConfig{
+		DataStorageType: flags.DataStoragePebble,
+		PebbleDirectory: t.TempDir(),
+		Format:          flags.StorageFormatSSZ,
+		Compression:     flags.StorageCompressionNone,
+		KeyScheme:       flags.KeySchemeRoot,
+		InstanceID:      "archiver-a",
+	}
+	require.ErrorContains(t, cfg.Check(), "instance id")
+	_, err := NewStorage(cfg, nil, testlog.Logger(t, log.LvlInfo))
+	require.ErrorContains(t, err, "instance id")
+
+	// Without an instance id the same config is valid
+	cfg.InstanceID = ""
+	require.NoError(t, cfg.Check())
+}
+
+func TestStorageFormatRecorded(t *testing.T) {
+	for _, format := range []flags.StorageFormat{flags.StorageFormatJSON, flags.StorageFormatSSZ, flags.StorageFormatSnappySSZ} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := NewStorage(flags.StorageConfig{
+				DataStorageType:      flags.DataStorageFile,
+				FileStorageDirectory: dir,
+				Format:               format,
+			}, nil, testlog.Logger(t, log.LvlInfo))
+			require.NoError(t, err)
+
+			data := BlobData{
+				Header:       Header{BeaconBlockHash: common.Hash{1, 2, 3}, Slot: 10},
+				BlobSidecars: BlobSidecars{Data: blobtest.NewBlobSidecars(t, 2)},
+			}
+			require.NoError(t, store.Write(context.Background(), data))
+
+			// Every object records the version of its format
+			raw, err := os.ReadFile(path.Join(dir, data.Header.BeaconBlockHash.String()))
+			require.NoError(t, err)
+			require.Equal(t, append(slices.Clone(formatPrefix), formatVersions[format]), raw[:len(formatPrefix)+1])
+
+			read, err := store.Read(context.Background(), data.Header.BeaconBlockHash)
+			require.NoError(t, err)
+			require.Equal(t, format, read.Header.Format)
+			require.Equal(t, data.BlobSidecars, read.BlobSidecars)
+
+			// Objects written before the format was recorded are decoded by their prefix
+			legacy, err := encodeBlobData(data, format)
+			require.NoError(t, err)
+			decoded, err := DecodeBlobData(legacy[len(formatPrefix)+1:])
+			require.NoError(t, err)
+			require.Equal(t, format, decoded.Header.Format)
+			require.Equal(t, data.BlobSidecars, decoded.BlobSidecars)
+		})
+	}
+
+	_, err := DecodeBlobData(append(slices.Clone(formatPrefix), 0xff))
+	require.ErrorContains(t, err, "unknown blob data format version")
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	// Every data store of this package implements every optional interface
+	for _, store := range []DataStore{&S3Storage{}, &FileStorage{}, &PebbleStorage{}} {
+		require.Implements(t, (*LeaseStore)(nil), store)
+		require.Implements(t, (*StagingStore)(nil), store)
+		require.Implements(t, (*WantedStore)(nil), store)
+		require.Implements(t, (*DictionaryStore)(nil), store)
+	}
+
+	// Wrappers of a data store lacking the optional interfaces return ErrUnsupported
+	fs, cleanup := setup(t)
+	defer cleanup()
+	bare := struct{ DataStore }{fs}
+	logger := testlog.Logger(t, log.LvlInfo)
+	for _, wrapper := range []DataStore{
+		NewMetricsStorage(bare, "file://bare", NewMetrics(metrics.With(metrics.NewRegistry()), "test")),
+		NewMirrorStorage(bare, nil, 1, &recordingMirrorMetrics{}, logger),
+	} {
+		_, err := wrapper.(LeaseStore).ReadLease(context.Background())
+		require.ErrorIs(t, err, ErrUnsupported)
+		require.ErrorIs(t, wrapper.(StagingStore).StageWrite(context.Background(), BlobData{}), ErrUnsupported)
+		require.ErrorIs(t, wrapper.(WantedStore).WriteWanted(context.Background(), common.Hash{1}), ErrUnsupported)
+		_, err = wrapper.(DictionaryStore).LatestDictionaryVersion(context.Background())
+		require.ErrorIs(t, err, ErrUnsupported)
+	}
+}
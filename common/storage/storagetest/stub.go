@@ -2,6 +2,8 @@ package storagetest
 
 import (
 	"context"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/base-org/blob-archiver/common/storage"
@@ -12,13 +14,16 @@ import (
 
 type TestFileStorage struct {
 	*storage.FileStorage
-	writeFailCount int
+	dir                     string
+	writeFailCount          int
+	slotIndexWriteFailCount int
 }
 
 func NewTestFileStorage(t *testing.T, l log.Logger) *TestFileStorage {
 	dir := t.TempDir()
 	return &TestFileStorage{
 		FileStorage: storage.NewFileStorage(dir, l),
+		dir:         dir,
 	}
 }
 
@@ -26,6 +31,19 @@ func (s *TestFileStorage) WritesFailTimes(times int) {
 	s.writeFailCount = times
 }
 
+func (s *TestFileStorage) SlotIndexWritesFailTimes(times int) {
+	s.slotIndexWriteFailCount = times
+}
+
+func (s *TestFileStorage) WriteSlotIndex(_ context.Context, slot uint64, hash common.Hash) error {
+	if s.slotIndexWriteFailCount > 0 {
+		s.slotIndexWriteFailCount--
+		return storage.ErrStorage
+	}
+
+	return s.FileStorage.WriteSlotIndex(context.Background(), slot, hash)
+}
+
 func (s *TestFileStorage) Write(_ context.Context, data storage.BlobData) error {
 	if s.writeFailCount > 0 {
 		s.writeFailCount--
@@ -35,6 +53,15 @@ func (s *TestFileStorage) Write(_ context.Context, data storage.BlobData) error
 	return s.FileStorage.Write(context.Background(), data)
 }
 
+func (s *TestFileStorage) WriteIfNotExists(_ context.Context, data storage.BlobData) error {
+	if s.writeFailCount > 0 {
+		s.writeFailCount--
+		return storage.ErrStorage
+	}
+
+	return s.FileStorage.WriteIfNotExists(context.Background(), data)
+}
+
 func (fs *TestFileStorage) CheckExistsOrFail(t *testing.T, hash common.Hash) {
 	exists, err := fs.Exists(context.Background(), hash)
 	require.NoError(t, err)
@@ -58,3 +85,10 @@ func (fs *TestFileStorage) ReadOrFail(t *testing.T, hash common.Hash) storage.Bl
 	require.NotNil(t, data)
 	return data
 }
+
+// ReadRawOrFail returns the stored bytes of the blob data for the given hash.
+func (fs *TestFileStorage) ReadRawOrFail(t *testing.T, hash common.Hash) []byte {
+	data, err := os.ReadFile(path.Join(fs.dir, hash.String()))
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,41 @@
+// Package tracing links metrics to the traces of the operations they measure.
+package tracing
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/ethereum-optimism/optimism/op-service/httputil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDLabel is the label of the exemplars that carry the ID of the trace an observation was made in.
+const TraceIDLabel = "trace_id"
+
+// Observe observes the value, attaching an exemplar with the trace ID if the context carries a sampled span, so that
+// e.g. a slow request in a latency histogram links to its trace. Without tracing, or for spans that aren't sampled, the
+// value is observed without an exemplar.
+func Observe(ctx context.Context, observer prometheus.Observer, value float64) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.HasTraceID() && spanContext.IsSampled() {
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{TraceIDLabel: spanContext.TraceID().String()})
+			return
+		}
+	}
+
+	observer.Observe(value)
+}
+
+// StartMetricsServer starts a server for the metrics of the registry like opmetrics.StartServer, but serves the
+// OpenMetrics format to scrapers that accept it, which is the only format exemplars are exposed in.
+func StartMetricsServer(r *prometheus.Registry, hostname string, port int) (*httputil.HTTPServer, error) {
+	addr := net.JoinHostPort(hostname, strconv.Itoa(port))
+	h := promhttp.InstrumentMetricHandler(
+		r, promhttp.HandlerFor(r, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	)
+	return httputil.StartHTTPServer(addr, h)
+}
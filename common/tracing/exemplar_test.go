@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func observed(t *testing.T, histogram prometheus.Histogram) *dto.Histogram {
+	var metric dto.Metric
+	require.NoError(t, histogram.Write(&metric))
+	return metric.GetHistogram()
+}
+
+func TestObserveAttachesTraceID(t *testing.T) {
+	traceID := trace.TraceID{0x01, 0x02, 0x03}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test", Buckets: []float64{1}})
+	Observe(ctx, histogram, 0.5)
+
+	h := observed(t, histogram)
+	require.Equal(t, uint64(1), h.GetSampleCount())
+	exemplar := h.GetBucket()[0].GetExemplar()
+	require.NotNil(t, exemplar)
+	require.Equal(t, 0.5, exemplar.GetValue())
+	require.Len(t, exemplar.GetLabel(), 1)
+	require.Equal(t, TraceIDLabel, exemplar.GetLabel()[0].GetName())
+	require.Equal(t, traceID.String(), exemplar.GetLabel()[0].GetValue())
+}
+
+func TestObserveWithoutTracing(t *testing.T) {
+	unsampled := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01},
+		SpanID:  trace.SpanID{0x01},
+	}))
+
+	for _, ctx := range []context.Context{context.Background(), unsampled} {
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test", Buckets: []float64{1}})
+		Observe(ctx, histogram, 0.5)
+
+		h := observed(t, histogram)
+		require.Equal(t, uint64(1), h.GetSampleCount())
+		require.Nil(t, h.GetBucket()[0].GetExemplar())
+	}
+}
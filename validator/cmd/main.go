@@ -57,8 +57,8 @@ func Main() cliapp.LifecycleAction {
 		}
 
 		beaconClient := service.NewBlobSidecarClient(cfg.BeaconConfig.BeaconURL)
-		blobClient := service.NewBlobSidecarClient(cfg.BeaconConfig.BeaconURL)
+		blobClient := service.NewBlobSidecarClient(cfg.BlobConfig.BeaconURL)
 
-		return service.NewValidator(l, headerClient, beaconClient, blobClient, closeApp), nil
+		return service.NewValidator(l, cfg, headerClient, beaconClient, blobClient, closeApp), nil
 	}
 }
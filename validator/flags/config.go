@@ -1,6 +1,7 @@
 package flags
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,6 +14,12 @@ type ValidatorConfig struct {
 	LogConfig    oplog.CLIConfig
 	BeaconConfig common.BeaconConfig
 	BlobConfig   common.BeaconConfig
+	// Concurrency is the number of slots checked at once, and BeaconConcurrency the maximum number of requests to the
+	// beacon node in flight at once, shared by all slots being checked.
+	Concurrency       int
+	BeaconConcurrency int
+	// ProgressInterval is how often the progress of the validation is logged, never if 0.
+	ProgressInterval time.Duration
 }
 
 func (c ValidatorConfig) Check() error {
@@ -24,11 +31,24 @@ func (c ValidatorConfig) Check() error {
 		return fmt.Errorf("blob config check failed: %w", err)
 	}
 
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	if c.BeaconConcurrency < 1 {
+		return errors.New("beacon concurrency must be at least 1")
+	}
+
+	if c.ProgressInterval < 0 {
+		return errors.New("progress interval must not be negative")
+	}
+
 	return nil
 }
 
 func ReadConfig(cliCtx *cli.Context) ValidatorConfig {
 	timeout, _ := time.ParseDuration(cliCtx.String(BeaconClientTimeoutFlag.Name))
+	progressInterval, _ := time.ParseDuration(cliCtx.String(ProgressIntervalFlag.Name))
 
 	return ValidatorConfig{
 		LogConfig: oplog.ReadCLIConfig(cliCtx),
@@ -40,5 +60,8 @@ func ReadConfig(cliCtx *cli.Context) ValidatorConfig {
 			BeaconURL:           cliCtx.String(BlobApiClientUrlFlag.Name),
 			BeaconClientTimeout: timeout,
 		},
+		Concurrency:       cliCtx.Int(ConcurrencyFlag.Name),
+		BeaconConcurrency: cliCtx.Int(BeaconConcurrencyFlag.Name),
+		ProgressInterval:  progressInterval,
 	}
 }
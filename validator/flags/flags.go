@@ -27,11 +27,30 @@ var (
 		Required: true,
 		EnvVars:  opservice.PrefixEnvVar(EnvVarPrefix, "BLOB_API_HTTP"),
 	}
+	ConcurrencyFlag = &cli.IntFlag{
+		Name:    "concurrency",
+		Usage:   "The number of slots checked at once",
+		Value:   8,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "CONCURRENCY"),
+	}
+	BeaconConcurrencyFlag = &cli.IntFlag{
+		Name:    "beacon-concurrency",
+		Usage:   "The maximum number of requests to the beacon node in flight at once, shared by all slots being checked",
+		Value:   4,
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "BEACON_CONCURRENCY"),
+	}
+	ProgressIntervalFlag = &cli.StringFlag{
+		Name:    "progress-interval",
+		Usage:   "How often the progress of the validation is logged, 0 to never log it",
+		Value:   "30s",
+		EnvVars: opservice.PrefixEnvVar(EnvVarPrefix, "PROGRESS_INTERVAL"),
+	}
 )
 
 func init() {
 	Flags = append(Flags, oplog.CLIFlags(EnvVarPrefix)...)
 	Flags = append(Flags, BeaconClientTimeoutFlag, L1BeaconClientUrlFlag, BlobApiClientUrlFlag)
+	Flags = append(Flags, ConcurrencyFlag, BeaconConcurrencyFlag, ProgressIntervalFlag)
 }
 
 // Flags contains the list of configuration options available to the binary.
@@ -7,19 +7,26 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	client "github.com/attestantio/go-eth2-client"
 	"github.com/attestantio/go-eth2-client/api"
 	v1 "github.com/attestantio/go-eth2-client/api/v1"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/validator/flags"
 	"github.com/ethereum-optimism/optimism/op-service/retry"
 	"github.com/ethereum/go-ethereum/log"
 )
 
 var ErrAlreadyStopped = errors.New("already stopped")
 
+// ErrValidationFailed is returned once the validation is complete if the blobs of any block mismatched or couldn't be
+// fetched, so that the validator exits with an error.
+var ErrValidationFailed = errors.New("validation failed")
+
 const (
 	// 5 blocks per minute, 120 minutes
 	twoHoursOfBlocks = 5 * 120
@@ -31,9 +38,11 @@ const (
 	retryAttempts = 10
 )
 
-func NewValidator(l log.Logger, headerClient client.BeaconBlockHeadersProvider, beaconAPI BlobSidecarClient, blobAPI BlobSidecarClient, app context.CancelCauseFunc) *ValidatorService {
+func NewValidator(l log.Logger, cfg flags.ValidatorConfig, headerClient client.BeaconBlockHeadersProvider, beaconAPI BlobSidecarClient, blobAPI BlobSidecarClient, app context.CancelCauseFunc) *ValidatorService {
 	return &ValidatorService{
 		log:          l,
+		cfg:          cfg,
+		beaconSem:    make(chan struct{}, cfg.BeaconConcurrency),
 		headerClient: headerClient,
 		beaconAPI:    beaconAPI,
 		blobAPI:      blobAPI,
@@ -42,8 +51,13 @@ func NewValidator(l log.Logger, headerClient client.BeaconBlockHeadersProvider,
 }
 
 type ValidatorService struct {
-	stopped      atomic.Bool
-	log          log.Logger
+	stopped atomic.Bool
+	// failed is set once the validation is complete if any check failed.
+	failed atomic.Bool
+	log    log.Logger
+	cfg    flags.ValidatorConfig
+	// beaconSem bounds the requests to the beacon-node in flight, see fetchFromBeacon.
+	beaconSem    chan struct{}
 	headerClient client.BeaconBlockHeadersProvider
 	beaconAPI    BlobSidecarClient
 	blobAPI      BlobSidecarClient
@@ -66,7 +80,7 @@ func (a *ValidatorService) Start(ctx context.Context) error {
 	end := header.Data.Header.Message.Slot - finalizedL1Offset
 	start := end - twoHoursOfBlocks
 
-	go a.checkBlobs(ctx, start, end)
+	go a.validate(ctx, start, end)
 
 	return nil
 }
@@ -80,6 +94,10 @@ func (a *ValidatorService) Stop(ctx context.Context) error {
 	a.log.Info("Stopping validator")
 	a.stopped.Store(true)
 
+	if a.failed.Load() {
+		return ErrValidationFailed
+	}
+
 	return nil
 }
 
@@ -97,69 +115,188 @@ type CheckBlobResult struct {
 	MismatchedData []string
 }
 
-// checkBlobs iterates all blocks in the range start:end and checks that the blobs from the beacon-node and blob-api
-// are identical, when encoded in both JSON and SSZ.
+// Failed returns whether the blobs of any block mismatched or couldn't be fetched.
+func (r CheckBlobResult) Failed() bool {
+	return len(r.ErrorFetching) > 0 || len(r.MismatchedStatus) > 0 || len(r.MismatchedData) > 0
+}
+
+// merge appends the slots of the other result to those of the result.
+func (r *CheckBlobResult) merge(other CheckBlobResult) {
+	r.ErrorFetching = append(r.ErrorFetching, other.ErrorFetching...)
+	r.MismatchedStatus = append(r.MismatchedStatus, other.MismatchedStatus...)
+	r.MismatchedData = append(r.MismatchedData, other.MismatchedData...)
+}
+
+// validate checks the blobs of all blocks in the range start:end, logs the report of the checks and closes the app,
+// with ErrValidationFailed if any check failed. The app isn't closed if the validation was interrupted.
+func (a *ValidatorService) validate(ctx context.Context, start phase0.Slot, end phase0.Slot) {
+	result := a.checkBlobs(ctx, start, end)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if !result.Failed() {
+		a.log.Info("validation succeeded", "start", start, "end", end)
+		a.closeApp(nil)
+		return
+	}
+
+	a.log.Error("validation failed", "start", start, "end", end,
+		"errorFetching", result.ErrorFetching, "mismatchedStatus", result.MismatchedStatus, "mismatchedData", result.MismatchedData)
+	a.failed.Store(true)
+	a.closeApp(ErrValidationFailed)
+}
+
+// checkBlobs checks all blocks in the range start:end, Concurrency blocks at once, and returns the aggregated result
+// in order of slot. The progress is logged every ProgressInterval.
 func (a *ValidatorService) checkBlobs(ctx context.Context, start phase0.Slot, end phase0.Slot) CheckBlobResult {
-	var result CheckBlobResult
+	results := make([]CheckBlobResult, end-start+1)
+	p := &progress{total: uint64(len(results)), started: time.Now()}
+
+	done := make(chan struct{})
+	defer close(done)
+	if a.cfg.ProgressInterval > 0 {
+		go a.logProgress(p, done)
+	}
 
+	slots := make(chan phase0.Slot)
+	var wg sync.WaitGroup
+	for i := 0; i < a.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				result := a.checkSlot(ctx, slot)
+				results[slot-start] = result
+				p.record(result)
+			}
+		}()
+	}
+
+feed:
 	for slot := start; slot <= end; slot++ {
-		for _, format := range []Format{FormatJson, FormatSSZ} {
-			id := strconv.FormatUint(uint64(slot), 10)
+		select {
+		case <-ctx.Done():
+			break feed
+		case slots <- slot:
+		}
+	}
+	close(slots)
+	wg.Wait()
 
-			l := a.log.New("format", format, "slot", slot)
+	var result CheckBlobResult
+	for _, r := range results {
+		result.merge(r)
+	}
 
-			blobStatus, blobResponse, blobError := retry.Do2(ctx, retryAttempts, retry.Exponential(), func() (int, storage.BlobSidecars, error) {
-				return a.blobAPI.FetchSidecars(id, format)
-			})
+	return result
+}
 
-			if blobError != nil {
-				result.ErrorFetching = append(result.ErrorFetching, id)
-				l.Error(validationErrorLog, "reason", "error-blob-api", "error", blobError, "status", blobStatus)
-				continue
-			}
+// checkSlot checks that the blobs of the block at the slot from the beacon-node and blob-api are identical, when encoded
+// in both JSON and SSZ.
+func (a *ValidatorService) checkSlot(ctx context.Context, slot phase0.Slot) CheckBlobResult {
+	var result CheckBlobResult
 
-			beaconStatus, beaconResponse, beaconErr := retry.Do2(ctx, retryAttempts, retry.Exponential(), func() (int, storage.BlobSidecars, error) {
-				return a.beaconAPI.FetchSidecars(id, format)
-			})
+	for _, format := range []Format{FormatJson, FormatSSZ} {
+		id := strconv.FormatUint(uint64(slot), 10)
 
-			if beaconErr != nil {
-				result.ErrorFetching = append(result.ErrorFetching, id)
-				l.Error(validationErrorLog, "reason", "error-beacon-api", "error", beaconErr, "status", beaconStatus)
-				continue
-			}
+		l := a.log.New("format", format, "slot", slot)
 
-			if beaconStatus != blobStatus {
-				result.MismatchedStatus = append(result.MismatchedStatus, id)
-				l.Error(validationErrorLog, "reason", "status-code-mismatch", "beaconStatus", beaconStatus, "blobStatus", blobStatus)
-				continue
-			}
+		blobStatus, blobResponse, blobError := retry.Do2(ctx, retryAttempts, retry.Exponential(), func() (int, storage.BlobSidecars, error) {
+			return a.blobAPI.FetchSidecars(id, format)
+		})
 
-			if beaconStatus != http.StatusOK {
-				// This can happen if the slot has been missed
-				l.Info("matching error status", "beacon", beaconStatus, "blob", blobStatus)
-				continue
+		if blobError != nil {
+			result.ErrorFetching = append(result.ErrorFetching, id)
+			l.Error(validationErrorLog, "reason", "error-blob-api", "error", blobError, "status", blobStatus)
+			continue
+		}
 
-			}
+		beaconStatus, beaconResponse, beaconErr := retry.Do2(ctx, retryAttempts, retry.Exponential(), func() (int, storage.BlobSidecars, error) {
+			return a.fetchFromBeacon(ctx, id, format)
+		})
 
-			if !reflect.DeepEqual(beaconResponse, blobResponse) {
-				result.MismatchedData = append(result.MismatchedData, id)
-				l.Error(validationErrorLog, "reason", "response-mismatch")
-			}
+		if beaconErr != nil {
+			result.ErrorFetching = append(result.ErrorFetching, id)
+			l.Error(validationErrorLog, "reason", "error-beacon-api", "error", beaconErr, "status", beaconStatus)
+			continue
+		}
 
-			l.Info("completed blob check", "blobs", len(beaconResponse.Data))
+		if beaconStatus != blobStatus {
+			result.MismatchedStatus = append(result.MismatchedStatus, id)
+			l.Error(validationErrorLog, "reason", "status-code-mismatch", "beaconStatus", beaconStatus, "blobStatus", blobStatus)
+			continue
 		}
 
-		// Check if we should stop validation otherwise continue
-		select {
-		case <-ctx.Done():
-			return result
-		default:
+		if beaconStatus != http.StatusOK {
+			// This can happen if the slot has been missed
+			l.Info("matching error status", "beacon", beaconStatus, "blob", blobStatus)
 			continue
+
+		}
+
+		if !reflect.DeepEqual(beaconResponse, blobResponse) {
+			result.MismatchedData = append(result.MismatchedData, id)
+			l.Error(validationErrorLog, "reason", "response-mismatch")
 		}
-	}
 
-	// Validation is complete, shutdown the app
-	a.closeApp(nil)
+		l.Info("completed blob check", "blobs", len(beaconResponse.Data))
+	}
 
 	return result
 }
+
+// fetchFromBeacon fetches the sidecars from the beacon-node once fewer than BeaconConcurrency requests to it are in
+// flight, across all slots being checked.
+func (a *ValidatorService) fetchFromBeacon(ctx context.Context, id string, format Format) (int, storage.BlobSidecars, error) {
+	select {
+	case a.beaconSem <- struct{}{}:
+	case <-ctx.Done():
+		return 0, storage.BlobSidecars{}, ctx.Err()
+	}
+	defer func() { <-a.beaconSem }()
+
+	return a.beaconAPI.FetchSidecars(id, format)
+}
+
+// progress counts the slots checked by a validation, and those that failed their check.
+type progress struct {
+	total   uint64
+	started time.Time
+	checked atomic.Uint64
+	failed  atomic.Uint64
+}
+
+func (p *progress) record(result CheckBlobResult) {
+	p.checked.Add(1)
+	if result.Failed() {
+		p.failed.Add(1)
+	}
+}
+
+// eta estimates the time left until all slots are checked at the average rate so far, or 0 before the first slot was.
+func (p *progress) eta(now time.Time) time.Duration {
+	checked := p.checked.Load()
+	if checked == 0 || checked >= p.total {
+		return 0
+	}
+
+	perSlot := now.Sub(p.started) / time.Duration(checked)
+	return perSlot * time.Duration(p.total-checked)
+}
+
+// logProgress logs the progress of the validation every ProgressInterval until done is closed.
+func (a *ValidatorService) logProgress(p *progress, done <-chan struct{}) {
+	t := time.NewTicker(a.cfg.ProgressInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			a.log.Info("validation progress", "checked", p.checked.Load(), "total", p.total, "failed", p.failed.Load(),
+				"eta", p.eta(now).Round(time.Second))
+		}
+	}
+}
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/base-org/blob-archiver/common/beacon/beacontest"
 	"github.com/base-org/blob-archiver/common/blobtest"
 	"github.com/base-org/blob-archiver/common/storage"
+	"github.com/base-org/blob-archiver/validator/flags"
 	"github.com/ethereum-optimism/optimism/op-service/testlog"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/stretchr/testify/require"
@@ -71,7 +74,7 @@ func setup(t *testing.T) (*ValidatorService, *beacontest.StubBeaconClient, *stub
 		data: make(map[string]response),
 	}
 
-	return NewValidator(l, headerClient, beacon, blob, cancel), headerClient, beacon, blob
+	return NewValidator(l, flags.ValidatorConfig{Concurrency: 4, BeaconConcurrency: 2}, headerClient, beacon, blob, cancel), headerClient, beacon, blob
 }
 
 func TestValidatorService_OnFetchError(t *testing.T) {
@@ -211,3 +214,100 @@ func TestValidatorService_MistmatchedBlobFields(t *testing.T) {
 		})
 	}
 }
+
+// concurrencyTrackingClient wraps a client, recording the maximum number of requests in flight at once. Each request
+// takes delay, so that requests overlap.
+type concurrencyTrackingClient struct {
+	BlobSidecarClient
+	delay       time.Duration
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *concurrencyTrackingClient) FetchSidecars(id string, format Format) (int, storage.BlobSidecars, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	time.Sleep(c.delay)
+	return c.BlobSidecarClient.FetchSidecars(id, format)
+}
+
+func TestValidatorService_BoundedConcurrency(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	headers := beacontest.NewDefaultStubBeaconClient(t)
+	beaconStub := &stubBlobSidecarClient{data: make(map[string]response)}
+	blobStub := &stubBlobSidecarClient{data: make(map[string]response)}
+	beaconStub.setResponses(headers)
+	blobStub.setResponses(headers)
+
+	beacon := &concurrencyTrackingClient{BlobSidecarClient: beaconStub, delay: 20 * time.Millisecond}
+	blob := &concurrencyTrackingClient{BlobSidecarClient: blobStub, delay: 20 * time.Millisecond}
+	cfg := flags.ValidatorConfig{Concurrency: 4, BeaconConcurrency: 2, ProgressInterval: 10 * time.Millisecond}
+	validator := NewValidator(l, cfg, headers, beacon, blob, func(error) {})
+
+	result := validator.checkBlobs(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.False(t, result.Failed())
+
+	// Slots are checked by all workers at once, but the beacon-node is only sent as many requests as the semaphore allows
+	require.Equal(t, cfg.Concurrency, blob.maxInFlight)
+	require.Equal(t, cfg.BeaconConcurrency, beacon.maxInFlight)
+}
+
+func TestValidatorService_FailsOnMismatch(t *testing.T) {
+	l := testlog.Logger(t, log.LvlInfo)
+	headers := beacontest.NewDefaultStubBeaconClient(t)
+	beacon := &stubBlobSidecarClient{data: make(map[string]response)}
+	blob := &stubBlobSidecarClient{data: make(map[string]response)}
+	beacon.setResponses(headers)
+	blob.setResponses(headers)
+
+	var closed []error
+	closeApp := func(cause error) { closed = append(closed, cause) }
+	cfg := flags.ValidatorConfig{Concurrency: 4, BeaconConcurrency: 2}
+
+	// Without mismatches, the validator exits successfully
+	validator := NewValidator(l, cfg, headers, beacon, blob, closeApp)
+	validator.validate(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Equal(t, []error{nil}, closed)
+	require.NoError(t, validator.Stop(context.Background()))
+
+	// With an injected mismatch, it exits with an error
+	blob.setResponse(blockOne, 200, storage.BlobSidecars{Data: blobtest.NewBlobSidecars(t, 1)}, nil)
+
+	closed = nil
+	validator = NewValidator(l, cfg, headers, beacon, blob, closeApp)
+	validator.validate(context.Background(), phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Equal(t, []error{ErrValidationFailed}, closed)
+	require.ErrorIs(t, validator.Stop(context.Background()), ErrValidationFailed)
+
+	// An interrupted validation doesn't close the app
+	closed = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	validator = NewValidator(l, cfg, headers, beacon, blob, closeApp)
+	validator.validate(ctx, phase0.Slot(blobtest.StartSlot), phase0.Slot(blobtest.EndSlot))
+	require.Empty(t, closed)
+}
+
+func TestProgress_ETA(t *testing.T) {
+	started := time.Unix(1000, 0)
+	p := &progress{total: 10, started: started}
+	require.Zero(t, p.eta(started.Add(time.Minute)))
+
+	for i := 0; i < 4; i++ {
+		p.record(CheckBlobResult{})
+	}
+	p.record(CheckBlobResult{MismatchedData: []string{"1"}})
+
+	require.Equal(t, 5*time.Minute, p.eta(started.Add(5*time.Minute)))
+	require.Equal(t, uint64(1), p.failed.Load())
+}